@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"                 //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/golang/protobuf/proto"                  //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"                //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// batchEntry is a call read from a batch manifest, given via -batch.
+type batchEntry struct {
+	batchCall
+	// the line of the manifest, starting at 1
+	line     int
+	captures []captureExpr
+}
+
+// batchResult is the outcome of a call in a batch, which is printed as a
+// single line of JSON.
+type batchResult struct {
+	// Line is the line of the manifest that defines the call.
+	Line   int    `json:"line"`
+	Method string `json:"method"`
+	// Responses are the response messages, in JSON format.
+	Responses []json.RawMessage `json:"responses"`
+	// Status, Code, and Message describe the final status, if the call
+	// completed.
+	Status  string `json:"status,omitempty"`
+	Code    *int   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// DurationMs is how long the call took, in milliseconds.
+	DurationMs float64 `json:"durationMs"`
+	// Error is set if the call could not be made, such as when the method or
+	// the request data is invalid.
+	Error string `json:"error,omitempty"`
+	// Passed reports whether the call met its expectations and captured its
+	// variables, if it has any, and Failures describes each one that it did
+	// not meet or could not capture.
+	Passed   *bool    `json:"passed,omitempty"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// readBatchManifest reads the calls in the given manifest, which has one JSON
+// object per line, in the form written by 'export testcase'. Blank lines and
+// lines that start with '#' are ignored. Request data that names a file is
+// read from that file, relative to the manifest.
+func readBatchManifest(fileName string) ([]batchEntry, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir := filepath.Dir(fileName)
+	var entries []batchEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry := batchEntry{line: line}
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&entry.batchCall); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, line, err)
+		}
+		if entry.Method == "" {
+			return nil, fmt.Errorf("%s:%d: no method given", fileName, line)
+		}
+		if strings.HasPrefix(entry.Data, "@") {
+			b, err := os.ReadFile(filepath.Join(dir, entry.Data[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", fileName, line, err)
+			}
+			entry.Data = string(b)
+		}
+		if entry.captures, err = parseCaptures(entry.Capture); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, line, err)
+		}
+		if entry.Expect != nil && entry.Expect.Responses != "" {
+			entry.Expect.Responses = filepath.Join(dir, entry.Expect.Responses)
+		}
+		entries = append(entries, entry)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: no calls defined", fileName)
+	}
+	return entries, nil
+}
+
+// runInOrder calls run with each index from 0 to n-1, with at most parallel
+// calls in progress at once, and calls report with each index in order, as
+// soon as the runs for it and for all earlier indexes are done.
+func runInOrder(n, parallel int, run func(i int), report func(i int)) {
+	if parallel < 1 {
+		parallel = 1
+	}
+	done := make([]chan struct{}, n)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	go func() {
+		sem := make(chan struct{}, parallel)
+		for i := 0; i < n; i++ {
+			sem <- struct{}{}
+			go func(i int) {
+				run(i)
+				close(done[i])
+				<-sem
+			}(i)
+		}
+	}()
+	for i := 0; i < n; i++ {
+		<-done[i]
+		report(i)
+	}
+}
+
+// runBatch makes the calls in the given -batch manifest and prints their
+// results. It exits with an error code if any call could not be made or did
+// not meet its expectations.
+func runBatch(ctx context.Context, entries []batchEntry, descSource grpcurl.DescriptorSource, ch grpcdynamic.Channel, headers []string, vars map[string]string, format grpcurl.Format) {
+	runner := batchRunner{
+		source:  descSource,
+		ch:      ch,
+		headers: headers,
+		vars:    vars,
+		format:  format,
+		options: grpcurl.FormatOptions{
+			EmitJSONDefaultFields: *emitDefaults,
+			AllowUnknownFields:    *allowUnknownFields,
+			UseProtoNames:         *useProtoNames,
+		},
+	}
+	errored, failed, err := runner.run(ctx, os.Stdout, entries, *parallel)
+	if err != nil {
+		fail(err, "Failed to write results")
+	}
+	if errored > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: %d of %d calls could not be made\n", errored, len(entries))
+		exit(1)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: %d of %d calls did not meet their expectations\n", failed, len(entries))
+		exit(expectationFailedExitCode)
+	}
+}
+
+// batchRunner makes the calls of a batch on a shared channel.
+type batchRunner struct {
+	source grpcurl.DescriptorSource
+	ch     grpcdynamic.Channel
+	// headers are sent with every call, before the call's own
+	headers []string
+	// vars are the variables given via -batch-var, which calls may reference
+	// like captured variables; a captured variable takes precedence
+	vars map[string]string
+	// format and options are used to parse request data
+	format  grpcurl.Format
+	options grpcurl.FormatOptions
+}
+
+// run makes the given calls, with at most parallel calls in progress at once,
+// and writes the result of each to out as a line of JSON, in the order of the
+// calls. A call that references a variable waits for the call that captures
+// it. It returns the number of calls that could not be made and the number
+// that did not meet their expectations.
+func (b *batchRunner) run(ctx context.Context, out io.Writer, entries []batchEntry, parallel int) (errored, failed int, err error) {
+	captures := make([][]captureExpr, len(entries))
+	for i := range entries {
+		captures[i] = entries[i].captures
+	}
+	chain := newCaptureChain(captures)
+	results := make([]batchResult, len(entries))
+	runInOrder(len(entries), parallel, func(i int) {
+		var captured map[string]interface{}
+		results[i], captured = b.call(ctx, &entries[i], chain, i)
+		chain.finish(i, captured)
+	}, func(i int) {
+		r := &results[i]
+		if r.Error != "" {
+			errored++
+		} else if r.Passed != nil && !*r.Passed {
+			failed++
+		}
+		if err != nil {
+			return
+		}
+		var line []byte
+		if line, err = json.Marshal(r); err == nil {
+			_, err = out.Write(append(line, '\n'))
+		}
+	})
+	return errored, failed, err
+}
+
+// call makes the i-th call of a batch, returning its result and the variables
+// it captured, which are nil if it could not be made.
+func (b *batchRunner) call(ctx context.Context, entry *batchEntry, chain *captureChain, i int) (batchResult, map[string]interface{}) {
+	result := batchResult{Line: entry.line, Method: entry.Method, Responses: []json.RawMessage{}}
+	callFailed := func(err error) (batchResult, map[string]interface{}) {
+		result.Error = err.Error()
+		return result, nil
+	}
+	mtd, err := findMethod(b.source, entry.Method)
+	if err != nil {
+		return callFailed(err)
+	}
+	data, err := chain.expand(ctx, i, entry.Data, true)
+	if err != nil {
+		return callFailed(err)
+	}
+	entryHeaders, err := chain.expandAll(ctx, i, entry.Headers)
+	if err != nil {
+		return callFailed(err)
+	}
+	data = expandVariables(data, b.vars, true)
+	headers := append([]string{}, b.headers...)
+	for _, header := range entryHeaders {
+		headers = append(headers, expandVariables(header, b.vars, false))
+	}
+	rf, _, err := grpcurl.RequestParserAndFormatter(b.format, b.source, strings.NewReader(data), b.options)
+	if err != nil {
+		return callFailed(err)
+	}
+	jsonOptions := b.options
+	jsonOptions.CompactJSON = true
+	_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, b.source, nil, jsonOptions)
+	if err != nil {
+		return callFailed(err)
+	}
+
+	h := &batchHandler{DefaultEventHandler: &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: formatter}}
+	start := time.Now()
+	err = grpcurl.InvokeRPC(ctx, b.source, b.ch, entry.Method, headers, h, rf.Next)
+	result.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		return callFailed(err)
+	}
+	var responses []string
+	for _, resp := range h.responses {
+		str, err := formatter(resp)
+		if err != nil {
+			return callFailed(fmt.Errorf("failed to format response: %v", err))
+		}
+		responses = append(responses, str)
+		result.Responses = append(result.Responses, json.RawMessage(str))
+	}
+	result.Status = h.Status.Code().String()
+	code := int(h.Status.Code())
+	result.Code = &code
+	result.Message = h.Status.Message()
+
+	var failures []string
+	if entry.Expect != nil {
+		if failures, err = b.check(entry.Expect, mtd, h); err != nil {
+			return callFailed(err)
+		}
+	}
+	captured, captureFailures := captureVariables(entry.captures, responses)
+	failures = append(failures, captureFailures...)
+	if entry.Expect != nil || len(entry.captures) > 0 {
+		passed := len(failures) == 0
+		result.Passed = &passed
+		result.Failures = failures
+	}
+	return result, captured
+}
+
+// check returns a description of each way in which the outcome of a call,
+// recorded by the given handler, differs from the given expectation.
+func (b *batchRunner) check(expect *batchExpectation, mtd *desc.MethodDescriptor, h *batchHandler) ([]string, error) {
+	var failures []string
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(b.source)}
+	if len(expect.Status) > 0 {
+		var expected spb.Status
+		if err := unmarshaler.Unmarshal(bytes.NewReader(expect.Status), &expected); err != nil {
+			return nil, fmt.Errorf("could not parse expected status: %v", err)
+		}
+		want := status.FromProto(&expected)
+		if want.Code() != h.Status.Code() || want.Message() != h.Status.Message() {
+			failures = append(failures, fmt.Sprintf("expected status %s (%q), but got %s (%q)", want.Code(), want.Message(), h.Status.Code(), h.Status.Message()))
+		}
+	}
+	if expect.Responses != "" {
+		f, err := os.Open(expect.Responses)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		parser := grpcurl.NewJSONRequestParserWithUnmarshaler(f, unmarshaler)
+		var expected []proto.Message
+		for {
+			msg := dynamicpb.NewMessage(mtd.GetOutputType().UnwrapMessage())
+			if err := parser.Next(msg); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("could not parse expected responses: %v", err)
+			}
+			expected = append(expected, msg)
+		}
+		if len(expected) != len(h.responses) {
+			failures = append(failures, fmt.Sprintf("expected %d responses, but got %d", len(expected), len(h.responses)))
+		} else {
+			for i := range expected {
+				if !proto.Equal(expected[i], h.responses[i]) {
+					failures = append(failures, fmt.Sprintf("response %d differs from the expected response", i+1))
+				}
+			}
+		}
+	}
+	return failures, nil
+}
+
+// batchHandler keeps the response messages of a call in a batch.
+type batchHandler struct {
+	*grpcurl.DefaultEventHandler
+	responses []proto.Message
+}
+
+func (h *batchHandler) OnReceiveResponse(resp proto.Message) {
+	h.DefaultEventHandler.OnReceiveResponse(resp)
+	h.responses = append(h.responses, resp)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestBatch(t *testing.T) {
+	cc, source := startTestServer(t)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"batch.jsonl": `{"method":"testing.TestService/UnaryCall","data":"@requests.json","expect":{"status":{},"responses":"responses.json"}}
+
+# a comment
+{"method":"testing.TestService/UnaryCall","headers":["fail-early: 5"],"expect":{"status":{"code":5,"message":"fail"}}}
+{"method":"testing.TestService/StreamingOutputCall","data":"{\"response_parameters\":[{\"size\":2},{\"size\":1}]}"}
+{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"Ynll\"}}","expect":{"responses":"responses.json"}}
+{"method":"testing.TestService/Nope"}
+`,
+		"requests.json":  `{"payload": {"body": "aGk="}}`,
+		"responses.json": `{"payload": {"body": "aGk="}}`,
+		"bad.jsonl":      `{"method":"testing.TestService/UnaryCall","dat":"{}"}`,
+	})
+	if _, err := readBatchManifest(filepath.Join(dir, "bad.jsonl")); err == nil || !strings.Contains(err.Error(), `bad.jsonl:1: json: unknown field "dat"`) {
+		t.Errorf("expected error for unknown field, got %v", err)
+	}
+	entries, err := readBatchManifest(filepath.Join(dir, "batch.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 || entries[0].Data != `{"payload": {"body": "aGk="}}` || entries[1].line != 4 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	runner := batchRunner{source: source, ch: cc, format: grpcurl.FormatJSON}
+	var out bytes.Buffer
+	errored, failed, err := runner.run(context.Background(), &out, entries, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errored != 1 || failed != 1 {
+		t.Errorf("expected 1 error and 1 failure, got %d and %d", errored, failed)
+	}
+
+	type result struct {
+		Line      int               `json:"line"`
+		Responses []json.RawMessage `json:"responses"`
+		Status    string            `json:"status"`
+		Code      *int              `json:"code"`
+		Passed    *bool             `json:"passed"`
+		Failures  []string          `json:"failures"`
+		Error     string            `json:"error"`
+	}
+	var results []result
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r result
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+	if len(results) != 5 {
+		t.Fatalf("expected 5 results, got %d", len(results))
+	}
+	var lines []int
+	for _, r := range results {
+		lines = append(lines, r.Line)
+	}
+	if expected := []int{1, 4, 5, 6, 7}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected results for lines %v, got %v", expected, lines)
+	}
+	if r := results[0]; r.Status != "OK" || r.Passed == nil || !*r.Passed || string(r.Responses[0]) != `{"payload":{"body":"aGk="}}` {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r := results[1]; r.Status != "NotFound" || *r.Code != 5 || r.Passed == nil || !*r.Passed {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r := results[2]; len(r.Responses) != 2 || r.Passed != nil {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r := results[3]; r.Passed == nil || *r.Passed || !reflect.DeepEqual(r.Failures, []string{"response 1 differs from the expected response"}) {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if r := results[4]; r.Error == "" || r.Code != nil {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
+
+func TestBatchCaptures(t *testing.T) {
+	cc, source := startTestServer(t)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"batch.jsonl": `{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"aGk=\"}}","capture":{"body":".payload.body"}}
+{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"${body}\"}}"}
+{"method":"testing.TestService/EmptyCall","capture":{"body":".payload.body"}}
+{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"${body}\"}}"}
+`,
+		"bad.jsonl": `{"method":"testing.TestService/UnaryCall","capture":{"a b":"."}}`,
+	})
+	if _, err := readBatchManifest(filepath.Join(dir, "bad.jsonl")); err == nil || !strings.Contains(err.Error(), `invalid capture name "a b"`) {
+		t.Errorf("expected error for invalid capture name, got %v", err)
+	}
+	entries, err := readBatchManifest(filepath.Join(dir, "batch.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := batchRunner{source: source, ch: cc, format: grpcurl.FormatJSON}
+	var out bytes.Buffer
+	errored, failed, err := runner.run(context.Background(), &out, entries, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errored != 1 || failed != 1 {
+		t.Errorf("expected 1 error and 1 failure, got %d and %d", errored, failed)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, s := range []string{
+		`"responses":[{"payload":{"body":"aGk="}}]`,
+		`"responses":[{"payload":{"body":"aGk="}}]`,
+		`"failures":["could not capture \"body\": jq expression \".payload.body\" yielded null"]`,
+		`"error":"variable \"body\" was not captured, since the call that captures it failed"`,
+	} {
+		if !strings.Contains(lines[i], s) {
+			t.Errorf("expected result %d to contain %s, got %s", i+1, s, lines[i])
+		}
+	}
+}
+
+func TestBatchVars(t *testing.T) {
+	cc, source := startTestServer(t)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"batch.jsonl": `{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"${body}\"}}"}
+{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"Ynll\"}}","capture":{"body":".payload.body"}}
+{"method":"testing.TestService/UnaryCall","data":"{\"payload\":{\"body\":\"${body}\"}}"}
+{"method":"testing.TestService/UnaryCall","headers":["fail-early: ${code}"]}
+`,
+	})
+	entries, err := readBatchManifest(filepath.Join(dir, "batch.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := batchRunner{source: source, ch: cc, format: grpcurl.FormatJSON, vars: map[string]string{"body": "aGk=", "code": "5"}}
+	var out bytes.Buffer
+	if _, _, err := runner.run(context.Background(), &out, entries, 1); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for i, s := range []string{
+		// the -batch-var value
+		`"responses":[{"payload":{"body":"aGk="}}]`,
+		`"responses":[{"payload":{"body":"Ynll"}}]`,
+		// the captured variable takes precedence
+		`"responses":[{"payload":{"body":"Ynll"}}]`,
+		`"status":"NotFound"`,
+	} {
+		if !strings.Contains(lines[i], s) {
+			t.Errorf("expected result %d to contain %s, got %s", i+1, s, lines[i])
+		}
+	}
+}
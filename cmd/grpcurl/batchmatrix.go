@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// requestMatrix is the contents of a file given via -batch-matrix, which lists
+// the environments against which the calls in a -batch manifest are made.
+type requestMatrix struct {
+	// Vars are variables that calls may reference in every environment.
+	Vars map[string]string `yaml:"vars"`
+	// Environments are the environments in which to make the calls, in the
+	// order in which they are run and reported.
+	Environments []matrixEnvironment `yaml:"environments"`
+}
+
+// matrixEnvironment is an environment in a -batch-matrix file.
+type matrixEnvironment struct {
+	// Name identifies the environment in results and the report.
+	Name string `yaml:"name"`
+	// Address is the address of the environment's server, in any form
+	// accepted on the command line.
+	Address string `yaml:"address"`
+	// Headers are sent with every call, in "name: value" form, as if given
+	// via -H.
+	Headers []string `yaml:"headers"`
+	// Vars are variables that calls may reference in this environment. They
+	// take precedence over the matrix's variables.
+	Vars map[string]string `yaml:"vars"`
+}
+
+// readBatchMatrix reads and checks the matrix in the given YAML file.
+func readBatchMatrix(fileName string) (*requestMatrix, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var m requestMatrix
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	if len(m.Environments) == 0 {
+		return nil, fmt.Errorf("%s: no environments defined", fileName)
+	}
+	names := map[string]bool{}
+	for i, env := range m.Environments {
+		if env.Name == "" {
+			return nil, fmt.Errorf("%s: environment #%d has no name", fileName, i+1)
+		}
+		if names[env.Name] {
+			return nil, fmt.Errorf("%s: environment %q is defined more than once", fileName, env.Name)
+		}
+		names[env.Name] = true
+		if env.Address == "" {
+			return nil, fmt.Errorf("%s: environment %q has no address", fileName, env.Name)
+		}
+		for _, vars := range []map[string]string{m.Vars, env.Vars} {
+			for name := range vars {
+				if !isVariableName(name) {
+					return nil, fmt.Errorf("%s: invalid variable name %q: must be letters, digits, and underscores, and not start with a digit", fileName, name)
+				}
+			}
+		}
+	}
+	return &m, nil
+}
+
+// args returns the arguments with which grpcurl is run to make the calls in
+// the given environment: the flags that were given, except -batch-matrix, and
+// the environment's headers, variables, and address. Variables given via
+// -batch-var take precedence over those in the matrix. The -v and -vv flags
+// are left out, since verbose output is written to stdout, from which the
+// results are read.
+func (m *requestMatrix) args(flags *flag.FlagSet, env *matrixEnvironment) []string {
+	var args, cmdLineVars []string
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "batch-matrix", "v", "vv":
+			return
+		case "batch-var":
+			for _, v := range *f.Value.(*multiString) {
+				cmdLineVars = append(cmdLineVars, "-batch-var="+v)
+			}
+			return
+		}
+		if values, ok := f.Value.(*multiString); ok {
+			for _, v := range *values {
+				args = append(args, "-"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	for _, h := range env.Headers {
+		args = append(args, "-H="+h)
+	}
+	vars := map[string]string{}
+	for name, value := range m.Vars {
+		vars[name] = value
+	}
+	for name, value := range env.Vars {
+		vars[name] = value
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-batch-var="+name+"="+vars[name])
+	}
+	args = append(args, cmdLineVars...)
+	return append(args, env.Address)
+}
+
+// runBatchMatrixFile makes the calls of the -batch manifest in each
+// environment of the -batch-matrix file, and exits with the resulting code.
+// The given positional arguments must be empty.
+func runBatchMatrixFile(args []string) {
+	parseEnv()
+	if *batchFile == "" {
+		fail(nil, "The -batch-matrix argument must be used with -batch.")
+	}
+	if len(args) > 0 {
+		fail(nil, "The -batch-matrix argument cannot be used with an address or verb; each environment has its own address.")
+	}
+	if _, err := readBatchManifest(*batchFile); err != nil {
+		fail(err, "Failed to read -batch manifest")
+	}
+	if _, err := parseVariables(batchVars); err != nil {
+		fail(nil, "The -batch-var argument is invalid: %v", err)
+	}
+	if *verbose || *veryVerbose {
+		warn("The -v and -vv arguments are not used with -batch-matrix.")
+	}
+	m, err := readBatchMatrix(*batchMatrix)
+	if err != nil {
+		fail(err, "Failed to read -batch-matrix")
+	}
+	code, err := runBatchMatrix(m, flags, execGrpcurl, os.Stdout, os.Stderr)
+	if err != nil {
+		fail(err, "Failed to run -batch-matrix")
+	}
+	exit(code)
+}
+
+// matrixResult is the result of a call in a -batch manifest, made in an
+// environment of a -batch-matrix, which is printed as a single line of JSON.
+type matrixResult struct {
+	Environment string `json:"environment"`
+	batchResult
+}
+
+// matrixRunFunc runs grpcurl with the given arguments, writing its output to
+// stdout, and returns its exit code.
+type matrixRunFunc func(args []string, stdout io.Writer) (int, error)
+
+// runBatchMatrix makes the calls of a batch in each environment of the given
+// matrix, in turn, using run. The results are written to out, each as a line
+// of JSON that includes the environment's name, and then a report that
+// compares the outcomes of the calls across the environments is written to
+// report. It returns the exit code: 6 if any call did not meet its
+// expectations in any environment, 1 if any other error occurred, such as a
+// call that could not be made, and 0 otherwise.
+func runBatchMatrix(m *requestMatrix, flags *flag.FlagSet, run matrixRunFunc, out, report io.Writer) (int, error) {
+	results := make([][]batchResult, len(m.Environments))
+	exitCodes := make([]int, len(m.Environments))
+	for i := range m.Environments {
+		env := &m.Environments[i]
+		w := &lineWriter{fn: func(line []byte) error {
+			var r matrixResult
+			if err := json.Unmarshal(line, &r.batchResult); err != nil {
+				return fmt.Errorf("invalid result for environment %q: %v", env.Name, err)
+			}
+			r.Environment = env.Name
+			results[i] = append(results[i], r.batchResult)
+			b, err := json.Marshal(&r)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(append(b, '\n'))
+			return err
+		}}
+		var err error
+		exitCodes[i], err = run(m.args(flags, env), w)
+		// an error reading the results also makes the run fail, so it is
+		// reported first
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to run batch in environment %q: %v", env.Name, err)
+		}
+	}
+	if err := writeMatrixReport(report, m, results, exitCodes); err != nil {
+		return 0, err
+	}
+	exitCode := 0
+	for _, code := range exitCodes {
+		switch code {
+		case 0:
+		case expectationFailedExitCode:
+			if exitCode == 0 {
+				exitCode = code
+			}
+		default:
+			exitCode = 1
+		}
+	}
+	return exitCode, nil
+}
+
+// writeMatrixReport writes a table with a row for each call in the batch and
+// a column for each environment, which shows the outcome of the call in that
+// environment, followed by a column that shows whether the outcomes differ.
+func writeMatrixReport(w io.Writer, m *requestMatrix, results [][]batchResult, exitCodes []int) error {
+	type call struct {
+		line   int
+		method string
+	}
+	var calls []call
+	outcomes := map[int][]string{}
+	for i, envResults := range results {
+		for _, r := range envResults {
+			if outcomes[r.Line] == nil {
+				calls = append(calls, call{line: r.Line, method: r.Method})
+				outcomes[r.Line] = make([]string, len(results))
+				for j := range outcomes[r.Line] {
+					outcomes[r.Line][j] = "-"
+				}
+			}
+			outcomes[r.Line][i] = matrixOutcome(&r)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		return calls[i].line < calls[j].line
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"LINE", "METHOD"}
+	for _, env := range m.Environments {
+		header = append(header, strings.ToUpper(env.Name))
+	}
+	header = append(header, "DIFFERS")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, c := range calls {
+		differs := "no"
+		for _, outcome := range outcomes[c.line][1:] {
+			if outcome != outcomes[c.line][0] {
+				differs = "yes"
+				break
+			}
+		}
+		row := append([]string{fmt.Sprint(c.line), c.method}, outcomes[c.line]...)
+		fmt.Fprintln(tw, strings.Join(append(row, differs), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for i, env := range m.Environments {
+		if len(results[i]) == 0 && exitCodes[i] != 0 {
+			if _, err := fmt.Fprintf(w, "ERROR: no calls were made in environment %q (exit code %d)\n", env.Name, exitCodes[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matrixOutcome describes the outcome of a call for the -batch-matrix report:
+// the name of its status code, followed by "(failed)" if it did not meet its
+// expectations, or "error" if it could not be made.
+func matrixOutcome(r *batchResult) string {
+	if r.Error != "" {
+		return "error"
+	}
+	if r.Passed != nil && !*r.Passed {
+		return r.Status + " (failed)"
+	}
+	return r.Status
+}
+
+// execGrpcurl runs grpcurl with the given arguments, for -batch-matrix. Its
+// errors are written to stderr.
+func execGrpcurl(args []string, stdout io.Writer) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	} else if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// lineWriter calls fn with each line written to it, without its newline. A
+// final line without a newline is passed to fn by Close. Once fn returns an
+// error, writes fail with that error, and Close returns it.
+type lineWriter struct {
+	fn  func(line []byte) error
+	buf []byte
+	err error
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		pos := bytes.IndexByte(w.buf, '\n')
+		if pos < 0 {
+			return len(p), nil
+		}
+		line := w.buf[:pos]
+		w.buf = w.buf[pos+1:]
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if w.err = w.fn(line); w.err != nil {
+			return 0, w.err
+		}
+	}
+}
+
+func (w *lineWriter) Close() error {
+	if w.err != nil || len(bytes.TrimSpace(w.buf)) == 0 {
+		return w.err
+	}
+	line := w.buf
+	w.buf = nil
+	w.err = w.fn(line)
+	return w.err
+}
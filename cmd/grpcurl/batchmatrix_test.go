@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadBatchMatrix(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"matrix.yaml": `
+vars:
+  tenant: acme
+environments:
+  - name: staging
+    address: staging.example.com:443
+    headers: ["x-env: staging"]
+    vars:
+      tenant: test
+  - name: prod
+    address: prod.example.com:443
+`,
+		"empty.yaml":    `environments: []`,
+		"unknown.yaml":  "environments:\n  - name: a\n    adress: a:1\n",
+		"noaddr.yaml":   "environments:\n  - name: a\n",
+		"dup.yaml":      "environments:\n  - name: a\n    address: a:1\n  - name: a\n    address: b:1\n",
+		"badvar.yaml":   "vars:\n  a-b: c\nenvironments:\n  - name: a\n    address: a:1\n",
+		"noname.yaml":   "environments:\n  - address: a:1\n",
+		"notyaml.yaml":  "environments: [",
+		"badtype.yaml":  "environments: a",
+		"envvars.yaml":  "environments:\n  - name: a\n    address: a:1\n    vars:\n      1st: b\n",
+		"emptyenv.yaml": "vars:\n  a: b\n",
+	})
+	m, err := readBatchMatrix(filepath.Join(dir, "matrix.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Environments) != 2 || m.Environments[0].Vars["tenant"] != "test" || m.Vars["tenant"] != "acme" || m.Environments[1].Address != "prod.example.com:443" {
+		t.Errorf("unexpected matrix: %+v", m)
+	}
+	for file, msg := range map[string]string{
+		"empty.yaml":    "no environments defined",
+		"unknown.yaml":  "field adress not found",
+		"noaddr.yaml":   `environment "a" has no address`,
+		"dup.yaml":      `environment "a" is defined more than once`,
+		"badvar.yaml":   `invalid variable name "a-b"`,
+		"noname.yaml":   "environment #1 has no name",
+		"notyaml.yaml":  "yaml:",
+		"badtype.yaml":  "cannot unmarshal",
+		"envvars.yaml":  `invalid variable name "1st"`,
+		"emptyenv.yaml": "no environments defined",
+	} {
+		if _, err := readBatchMatrix(filepath.Join(dir, file)); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error containing %q, got %v", file, msg, err)
+		}
+	}
+}
+
+func TestBatchMatrixArgs(t *testing.T) {
+	fs := flag.NewFlagSet("grpcurl", flag.ContinueOnError)
+	var headers, vars multiString
+	fs.Var(&headers, "H", "")
+	fs.Var(&vars, "batch-var", "")
+	fs.String("batch", "", "")
+	fs.String("batch-matrix", "", "")
+	fs.Bool("plaintext", false, "")
+	fs.Int("parallel", 1, "")
+	fs.Bool("v", false, "")
+	fs.Bool("vv", false, "")
+	if err := fs.Parse([]string{"-batch-var", "tenant=cli", "-H", "a: 1", "-batch", "calls.jsonl", "-batch-matrix", "m.yaml", "-plaintext", "-v", "-vv", "-H", "b: 2"}); err != nil {
+		t.Fatal(err)
+	}
+	m := &requestMatrix{
+		Vars: map[string]string{"tenant": "acme", "region": "us"},
+		Environments: []matrixEnvironment{{
+			Name:    "staging",
+			Address: "staging:443",
+			Headers: []string{"x-env: staging"},
+			Vars:    map[string]string{"region": "eu"},
+		}},
+	}
+	expected := []string{
+		"-H=a: 1", "-H=b: 2", "-batch=calls.jsonl", "-plaintext=true",
+		"-H=x-env: staging",
+		"-batch-var=region=eu", "-batch-var=tenant=acme",
+		// given on the command line, so it takes precedence
+		"-batch-var=tenant=cli",
+		"staging:443",
+	}
+	if args := m.args(fs, &m.Environments[0]); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %q, got %q", expected, args)
+	}
+}
+
+func TestRunBatchMatrix(t *testing.T) {
+	m := &requestMatrix{Environments: []matrixEnvironment{
+		{Name: "staging", Address: "staging:443"},
+		{Name: "prod", Address: "prod:443"},
+		{Name: "dev", Address: "dev:443"},
+	}}
+	fs := flag.NewFlagSet("grpcurl", flag.ContinueOnError)
+	fs.String("batch", "", "")
+	if err := fs.Parse([]string{"-batch", "calls.jsonl"}); err != nil {
+		t.Fatal(err)
+	}
+	var ran [][]string
+	run := func(args []string, stdout io.Writer) (int, error) {
+		ran = append(ran, args)
+		switch args[len(args)-1] {
+		case "staging:443":
+			fmt.Fprintln(stdout, `{"line":1,"method":"foo.Bar/Get","status":"OK","code":0,"passed":true,"durationMs":1}`)
+			fmt.Fprint(stdout, `{"line":3,"method":"foo.Bar/List","status":"OK","code":0,"durationMs":2}`)
+			return 0, nil
+		case "prod:443":
+			fmt.Fprintln(stdout, `{"line":1,"method":"foo.Bar/Get","status":"NotFound","code":5,"passed":false,"failures":["wrong status"],"durationMs":1}`)
+			fmt.Fprintln(stdout, `{"line":3,"method":"foo.Bar/List","status":"OK","code":0,"durationMs":2}`)
+			return expectationFailedExitCode, nil
+		default:
+			return 1, nil
+		}
+	}
+	var out, report bytes.Buffer
+	code, err := runBatchMatrix(m, fs, run, &out, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if len(ran) != 3 || !reflect.DeepEqual(ran[0], []string{"-batch=calls.jsonl", "staging:443"}) {
+		t.Errorf("unexpected runs: %q", ran)
+	}
+
+	var envs []string
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r matrixResult
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		envs = append(envs, fmt.Sprintf("%s:%d", r.Environment, r.Line))
+	}
+	if expected := []string{"staging:1", "staging:3", "prod:1", "prod:3"}; !reflect.DeepEqual(envs, expected) {
+		t.Errorf("expected results %v, got %v", expected, envs)
+	}
+
+	if s := report.String(); s != "LINE  METHOD        STAGING  PROD               DEV  DIFFERS\n"+
+		"1     foo.Bar/Get   OK       NotFound (failed)  -    yes\n"+
+		"3     foo.Bar/List  OK       OK                 -    yes\n"+
+		"ERROR: no calls were made in environment \"dev\" (exit code 1)\n" {
+		t.Errorf("unexpected report:\n%s", s)
+	}
+
+	// only failed expectations
+	m.Environments = m.Environments[:2]
+	report.Reset()
+	if code, err := runBatchMatrix(m, fs, run, io.Discard, &report); err != nil || code != expectationFailedExitCode {
+		t.Errorf("expected exit code %d, got %d (%v)", expectationFailedExitCode, code, err)
+	}
+	if strings.Contains(report.String(), "ERROR") || strings.Count(report.String(), "yes") != 1 || strings.Count(report.String(), "no") != 1 {
+		t.Errorf("unexpected report:\n%s", report.String())
+	}
+}
+
+func TestRunBatchMatrix_InvalidOutput(t *testing.T) {
+	m := &requestMatrix{Environments: []matrixEnvironment{{Name: "staging", Address: "staging:443"}}}
+	fs := flag.NewFlagSet("grpcurl", flag.ContinueOnError)
+	for _, output := range []string{"\nUsing server reflection v1\n", `{"line":1,"method":"foo.Bar/Get","status":"OK"}` + "\nnot json"} {
+		// the run fails because its output could not be written
+		run := func(args []string, stdout io.Writer) (int, error) {
+			if _, err := io.WriteString(stdout, output); err != nil {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		_, err := runBatchMatrix(m, fs, run, io.Discard, io.Discard)
+		if err == nil || !strings.Contains(err.Error(), `invalid result for environment "staging"`) {
+			t.Errorf("%q: expected error about invalid result, got %v", output, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// bsrFetchTimeout is how long to wait for the Buf Schema Registry to return
+// a module's image.
+const bsrFetchTimeout = time.Minute
+
+// bsrReflectionMethod is the path of the Buf reflection API's method that
+// returns a module's image, which is called using the Connect protocol.
+const bsrReflectionMethod = "/buf.reflect.v1beta1.FileDescriptorSetService/GetFileDescriptorSet"
+
+// parseBSRModule parses a -bsr argument, like 'buf.build/acme/payments' or
+// 'buf.build/acme/payments:main', into the registry's host, the module's name,
+// and the optional reference (a commit, tag, label, or draft).
+func parseBSRModule(s string) (host, module, ref string, err error) {
+	module, ref, _ = strings.Cut(s, ":")
+	parts := strings.Split(module, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("%q is not a module name like 'buf.build/owner/repository'", s)
+	}
+	return parts[0], module, ref, nil
+}
+
+// bsrToken returns the token for the given registry from the BUF_TOKEN
+// environment variable. It holds either a single token, or a comma-separated
+// list of 'token@host' entries for different registries.
+func bsrToken(host string) string {
+	env := os.Getenv("BUF_TOKEN")
+	if !strings.Contains(env, "@") {
+		return env
+	}
+	for _, entry := range strings.Split(env, ",") {
+		token, remote, ok := strings.Cut(strings.TrimSpace(entry), "@")
+		if ok && remote == host {
+			return token
+		}
+	}
+	return ""
+}
+
+// loadBSRSource returns a descriptor source for the image of the module
+// named by the given -bsr argument.
+func loadBSRSource(s string) (grpcurl.DescriptorSource, error) {
+	host, module, ref, err := parseBSRModule(s)
+	if err != nil {
+		return nil, err
+	}
+	fds, err := fetchBSRImage("https://"+host, module, ref, bsrToken(host))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return grpcurl.DescriptorSourceFromFileDescriptorSet(fds)
+}
+
+// fetchBSRImage gets the image of the given module, which contains all of its
+// files and their dependencies, from the registry at the given URL.
+func fetchBSRImage(baseURL, module, ref, token string) (*descriptorpb.FileDescriptorSet, error) {
+	// a GetFileDescriptorSetRequest
+	var reqBody []byte
+	reqBody = protowire.AppendTag(reqBody, 1, protowire.BytesType)
+	reqBody = protowire.AppendString(reqBody, module)
+	if ref != "" {
+		reqBody = protowire.AppendTag(reqBody, 2, protowire.BytesType)
+		reqBody = protowire.AppendString(reqBody, ref)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+bsrReflectionMethod, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/proto")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: bsrFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Connect errors are JSON objects with a code and message
+		var connectErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(b, &connectErr) == nil && connectErr.Code != "" {
+			if connectErr.Code == "unauthenticated" && token == "" {
+				return nil, fmt.Errorf("%s: %s; set the BUF_TOKEN environment variable to authenticate", connectErr.Code, connectErr.Message)
+			}
+			return nil, fmt.Errorf("%s: %s", connectErr.Code, connectErr.Message)
+		}
+		return nil, fmt.Errorf("registry returned %s", resp.Status)
+	}
+
+	// the file_descriptor_set field of a GetFileDescriptorSetResponse
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, fmt.Errorf("invalid response: %w", protowire.ParseError(n))
+			}
+			var fds descriptorpb.FileDescriptorSet
+			if err := proto.Unmarshal(v, &fds); err != nil {
+				return nil, fmt.Errorf("invalid response: %w", err)
+			}
+			return &fds, nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid response: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil, fmt.Errorf("response has no descriptors")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestParseBSRModule(t *testing.T) {
+	host, module, ref, err := parseBSRModule("buf.build/acme/payments:main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if host != "buf.build" || module != "buf.build/acme/payments" || ref != "main" {
+		t.Errorf("unexpected result: %s, %s, %s", host, module, ref)
+	}
+	if _, _, ref, _ := parseBSRModule("buf.build/acme/payments"); ref != "" {
+		t.Errorf("expected no reference, got %s", ref)
+	}
+	for _, bad := range []string{"acme/payments", "buf.build/acme", "buf.build//payments", "buf.build/acme/payments/v1"} {
+		if _, _, _, err := parseBSRModule(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestBSRToken(t *testing.T) {
+	t.Setenv("BUF_TOKEN", "secret")
+	if tok := bsrToken("buf.build"); tok != "secret" {
+		t.Errorf("expected single token, got %q", tok)
+	}
+	t.Setenv("BUF_TOKEN", "one@buf.build, two@bsr.example.com")
+	if tok := bsrToken("bsr.example.com"); tok != "two" {
+		t.Errorf("expected token for host, got %q", tok)
+	}
+	if tok := bsrToken("other.example.com"); tok != "" {
+		t.Errorf("expected no token, got %q", tok)
+	}
+}
+
+func TestFetchBSRImage(t *testing.T) {
+	b, err := os.ReadFile("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var image descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &image); err != nil {
+		t.Fatal(err)
+	}
+	var module, ref string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != bsrReflectionMethod || r.Header.Get("Content-Type") != "application/proto" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"code":"unauthenticated","message":"missing token"}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		for len(body) > 0 {
+			num, _, n := protowire.ConsumeTag(body)
+			body = body[n:]
+			v, n := protowire.ConsumeString(body)
+			body = body[n:]
+			switch num {
+			case 1:
+				module = v
+			case 2:
+				ref = v
+			}
+		}
+		var resp []byte
+		resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+		resp = protowire.AppendBytes(resp, b)
+		resp = protowire.AppendTag(resp, 2, protowire.BytesType)
+		resp = protowire.AppendString(resp, "abc123")
+		w.Header().Set("Content-Type", "application/proto")
+		_, _ = w.Write(resp)
+	}))
+	defer registry.Close()
+
+	fds, err := fetchBSRImage(registry.URL, "buf.build/acme/payments", "main", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if module != "buf.build/acme/payments" || ref != "main" {
+		t.Errorf("unexpected request: %s, %s", module, ref)
+	}
+	if !proto.Equal(fds, &image) {
+		t.Error("image does not match")
+	}
+
+	_, err = fetchBSRImage(registry.URL, "buf.build/acme/payments", "", "")
+	if err == nil || !strings.Contains(err.Error(), "BUF_TOKEN") {
+		t.Errorf("expected unauthenticated error, got %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/types/descriptorpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// bufConfig is the contents of a buf.yaml file. Versions v1beta1 and v1
+// describe a single module, whose files are in the build roots, while v2
+// describes all modules of a workspace.
+type bufConfig struct {
+	Version string   `yaml:"version"`
+	Name    string   `yaml:"name"`
+	Deps    []string `yaml:"deps"`
+	Build   struct {
+		Roots    []string `yaml:"roots"`
+		Excludes []string `yaml:"excludes"`
+	} `yaml:"build"`
+	Modules []struct {
+		Path     string   `yaml:"path"`
+		Name     string   `yaml:"name"`
+		Excludes []string `yaml:"excludes"`
+	} `yaml:"modules"`
+}
+
+// bufWorkConfig is the contents of a buf.work.yaml file, which lists the
+// directories of the modules in a v1 workspace.
+type bufWorkConfig struct {
+	Version     string   `yaml:"version"`
+	Directories []string `yaml:"directories"`
+}
+
+// bufLock is the contents of a buf.lock file, which pins the dependencies of
+// a buf.yaml file to commits. Version v1 names a dependency by its remote,
+// owner, and repository, and version v2 by its full name.
+type bufLock struct {
+	Deps []struct {
+		Remote     string `yaml:"remote"`
+		Owner      string `yaml:"owner"`
+		Repository string `yaml:"repository"`
+		Name       string `yaml:"name"`
+		Commit     string `yaml:"commit"`
+	} `yaml:"deps"`
+}
+
+// bufModule is a directory of proto sources in a buf workspace.
+type bufModule struct {
+	// the directory, which is an import path
+	root string
+	// the module's name in the Buf Schema Registry, if any
+	name string
+	// the directories whose files are not part of the module, relative to
+	// the root
+	excludes []string
+}
+
+// bufDep is a dependency of a buf workspace, which is a module in the Buf
+// Schema Registry.
+type bufDep struct {
+	// the module's full name, like 'buf.build/googleapis/googleapis'
+	module string
+	// the commit given in buf.lock, if any
+	commit string
+}
+
+// bufWorkspace is the buf configuration given via -buf-workspace.
+type bufWorkspace struct {
+	modules []bufModule
+	deps    []bufDep
+}
+
+// readBufWorkspace reads the buf.work.yaml or buf.yaml file in the given
+// directory.
+func readBufWorkspace(dir string) (*bufWorkspace, error) {
+	var ws bufWorkspace
+	var work bufWorkConfig
+	if ok, err := readBufYAML(filepath.Join(dir, "buf.work.yaml"), &work); err != nil {
+		return nil, err
+	} else if ok {
+		if len(work.Directories) == 0 {
+			return nil, fmt.Errorf("%s lists no directories", filepath.Join(dir, "buf.work.yaml"))
+		}
+		for _, d := range work.Directories {
+			if err := ws.addConfig(filepath.Join(dir, filepath.FromSlash(d)), true); err != nil {
+				return nil, err
+			}
+		}
+		return &ws, nil
+	}
+	if err := ws.addConfig(dir, false); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// readBufYAML reads the given YAML file into the given value, reporting
+// false if the file does not exist.
+func readBufYAML(fileName string, v interface{}) (bool, error) {
+	b, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := yaml.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return true, nil
+}
+
+// addConfig adds the modules and dependencies given by the buf.yaml and
+// buf.lock files in the given directory. A directory listed in a
+// buf.work.yaml file need not have a buf.yaml file, in which case it is a
+// module without dependencies.
+func (ws *bufWorkspace) addConfig(dir string, optional bool) error {
+	var config bufConfig
+	if ok, err := readBufYAML(filepath.Join(dir, "buf.yaml"), &config); err != nil {
+		return err
+	} else if !ok {
+		if optional {
+			ws.modules = append(ws.modules, bufModule{root: dir})
+			return nil
+		}
+		return fmt.Errorf("%s has no buf.yaml or buf.work.yaml file", dir)
+	}
+
+	switch config.Version {
+	case "v2":
+		if len(config.Modules) == 0 {
+			ws.modules = append(ws.modules, bufModule{root: dir})
+		}
+		for _, m := range config.Modules {
+			modPath := path.Clean(m.Path)
+			mod := bufModule{root: filepath.Join(dir, filepath.FromSlash(modPath)), name: m.Name}
+			// excludes are relative to the buf.yaml file
+			for _, e := range m.Excludes {
+				rel := strings.TrimPrefix(path.Clean(e), modPath+"/")
+				if modPath == "." {
+					rel = path.Clean(e)
+				}
+				mod.excludes = append(mod.excludes, rel)
+			}
+			ws.modules = append(ws.modules, mod)
+		}
+	case "v1", "v1beta1", "":
+		roots := config.Build.Roots
+		if len(roots) == 0 {
+			roots = []string{"."}
+		}
+		for _, root := range roots {
+			root = path.Clean(root)
+			mod := bufModule{root: filepath.Join(dir, filepath.FromSlash(root)), name: config.Name}
+			// excludes are relative to the module, or to a root in v1beta1
+			for _, e := range config.Build.Excludes {
+				e = path.Clean(e)
+				if root != "." && strings.HasPrefix(e, root+"/") {
+					e = strings.TrimPrefix(e, root+"/")
+				}
+				mod.excludes = append(mod.excludes, e)
+			}
+			ws.modules = append(ws.modules, mod)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported version %q", filepath.Join(dir, "buf.yaml"), config.Version)
+	}
+
+	var lock bufLock
+	if _, err := readBufYAML(filepath.Join(dir, "buf.lock"), &lock); err != nil {
+		return err
+	}
+	commits := map[string]string{}
+	for _, d := range lock.Deps {
+		name := d.Name
+		if name == "" {
+			name = d.Remote + "/" + d.Owner + "/" + d.Repository
+		}
+		commits[name] = d.Commit
+	}
+	for _, d := range config.Deps {
+		// a reference in buf.yaml is only used if the dependency is not locked
+		module, ref, _ := strings.Cut(d, ":")
+		if commit, ok := commits[module]; ok {
+			ref = commit
+		}
+		ws.deps = append(ws.deps, bufDep{module: module, commit: ref})
+	}
+	return nil
+}
+
+// importPaths returns the roots of the workspace's modules.
+func (ws *bufWorkspace) importPaths() []string {
+	paths := make([]string, len(ws.modules))
+	for i, mod := range ws.modules {
+		paths[i] = mod.root
+	}
+	return paths
+}
+
+// files returns the names, relative to their module's root, of all proto
+// files in the workspace's modules, less those that a module excludes or that
+// match any of the given exclude patterns.
+func (ws *bufWorkspace) files(excludes []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, mod := range ws.modules {
+		matches, err := globFiles(mod.root, "**/*.proto", false)
+		if err != nil {
+			return nil, err
+		}
+		patterns := append([]string{}, excludes...)
+		for _, e := range mod.excludes {
+			patterns = append(patterns, e+"/**")
+		}
+	files:
+		for _, name := range matches {
+			for _, p := range patterns {
+				if ok, err := matchGlob(filepath.ToSlash(p), name); err != nil {
+					return nil, err
+				} else if ok {
+					continue files
+				}
+			}
+			if !seen[name] {
+				seen[name] = true
+				files = append(files, name)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no proto files found in the workspace")
+	}
+	return files, nil
+}
+
+// loadBufWorkspaceSource returns a descriptor source for the proto files in
+// the buf workspace in the given directory. Its modules' roots are used as
+// import paths, before any other given ones. The given files or patterns are
+// compiled or, if there are none, all files of the workspace's modules. The
+// workspace's dependencies are fetched from the Buf Schema Registry, at the
+// commits pinned in buf.lock files, except those that are modules of the
+// workspace.
+func loadBufWorkspaceSource(dir string, importPaths, files, excludes []string) (grpcurl.DescriptorSource, error) {
+	ws, err := readBufWorkspace(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := append(ws.importPaths(), importPaths...)
+	if len(files) > 0 {
+		files, err = expandProtoFiles(paths, files, excludes)
+	} else {
+		files, err = ws.files(excludes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	local := map[string]bool{}
+	for _, mod := range ws.modules {
+		if mod.name != "" {
+			local[mod.name] = true
+		}
+	}
+	depFiles := map[string]*descriptorpb.FileDescriptorProto{}
+	fetched := map[string]bool{}
+	for _, dep := range ws.deps {
+		if local[dep.module] || fetched[dep.module] {
+			continue
+		}
+		fetched[dep.module] = true
+		host, module, _, err := parseBSRModule(dep.module)
+		if err != nil {
+			return nil, err
+		}
+		fds, err := fetchBSRImage("https://"+host, module, dep.commit, bsrToken(host))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch dependency %s: %w", dep.module, err)
+		}
+		for _, fd := range fds.File {
+			if _, ok := depFiles[fd.GetName()]; !ok {
+				depFiles[fd.GetName()] = fd
+			}
+		}
+	}
+	return parseBufWorkspaceFiles(paths, files, depFiles)
+}
+
+// parseBufWorkspaceFiles compiles the given files, resolving imports using
+// the given import paths and then the given dependencies' files.
+func parseBufWorkspaceFiles(importPaths, files []string, depFiles map[string]*descriptorpb.FileDescriptorProto) (grpcurl.DescriptorSource, error) {
+	p := protoparse.Parser{
+		ImportPaths:           importPaths,
+		IncludeSourceCodeInfo: true,
+		LookupImportProto: func(name string) (*descriptorpb.FileDescriptorProto, error) {
+			if fd, ok := depFiles[name]; ok {
+				return fd, nil
+			}
+			return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+		},
+	}
+	fds, err := p.ParseFiles(files...)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse given files: %v", err)
+	}
+	return grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+}
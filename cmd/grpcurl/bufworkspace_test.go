@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBufWorkspaceV1(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"buf.work.yaml":   "version: v1\ndirectories:\n  - common\n  - api\n",
+		"common/buf.yaml": "version: v1\nname: buf.build/acme/common\n",
+		"common/acme/common/v1/types.proto": `syntax = "proto3";
+package acme.common.v1;
+message Item { string id = 1; }
+`,
+		"api/buf.yaml": `version: v1
+deps:
+  - buf.build/acme/common
+  - buf.build/googleapis/googleapis
+build:
+  excludes:
+    - acme/api/internal
+`,
+		"api/buf.lock": `version: v1
+deps:
+  - remote: buf.build
+    owner: googleapis
+    repository: googleapis
+    commit: 28151c0d0a1641bf938a7672c500e01d
+`,
+		"api/acme/api/v1/api.proto": `syntax = "proto3";
+package acme.api.v1;
+import "acme/common/v1/types.proto";
+service ItemService { rpc Get(acme.common.v1.Item) returns (acme.common.v1.Item); }
+`,
+		"api/acme/api/internal/broken.proto": "this is not a proto file",
+	})
+
+	ws, err := readBufWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedPaths := []string{filepath.Join(dir, "common"), filepath.Join(dir, "api")}
+	if paths := ws.importPaths(); !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("expected import paths %v, got %v", expectedPaths, paths)
+	}
+	expectedDeps := []bufDep{
+		{module: "buf.build/acme/common"},
+		{module: "buf.build/googleapis/googleapis", commit: "28151c0d0a1641bf938a7672c500e01d"},
+	}
+	if !reflect.DeepEqual(ws.deps, expectedDeps) {
+		t.Errorf("expected deps %+v, got %+v", expectedDeps, ws.deps)
+	}
+	files, err := ws.files(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	expectedFiles := []string{"acme/api/v1/api.proto", "acme/common/v1/types.proto"}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("expected files %v, got %v", expectedFiles, files)
+	}
+
+	// the local module satisfies the dependency on it
+	source, err := parseBufWorkspaceFiles(ws.importPaths(), files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.FindSymbol("acme.api.v1.ItemService"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBufWorkspaceV2(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"buf.yaml": `version: v2
+modules:
+  - path: proto
+    excludes:
+      - proto/acme/internal
+deps:
+  - buf.build/googleapis/googleapis
+`,
+		"buf.lock": `version: v2
+deps:
+  - name: buf.build/googleapis/googleapis
+    commit: 28151c0d0a1641bf938a7672c500e01d
+`,
+		"proto/acme/v1/api.proto":     `syntax = "proto3";`,
+		"proto/acme/internal/x.proto": `syntax = "proto3";`,
+		"proto/acme/v1/skip.proto":    `syntax = "proto3";`,
+	})
+
+	ws, err := readBufWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ws.modules) != 1 || ws.modules[0].root != filepath.Join(dir, "proto") {
+		t.Fatalf("unexpected modules: %+v", ws.modules)
+	}
+	if !reflect.DeepEqual(ws.modules[0].excludes, []string{"acme/internal"}) {
+		t.Errorf("unexpected excludes: %v", ws.modules[0].excludes)
+	}
+	expectedDeps := []bufDep{{module: "buf.build/googleapis/googleapis", commit: "28151c0d0a1641bf938a7672c500e01d"}}
+	if !reflect.DeepEqual(ws.deps, expectedDeps) {
+		t.Errorf("expected deps %+v, got %+v", expectedDeps, ws.deps)
+	}
+	files, err := ws.files([]string{"**/skip.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"acme/v1/api.proto"}) {
+		t.Errorf("unexpected files: %v", files)
+	}
+
+	if _, err := readBufWorkspace(t.TempDir()); err == nil {
+		t.Error("expected error for directory without buf configuration")
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/itchyny/gojq"
+)
+
+// variableRefPattern matches a reference to a captured variable, like
+// '${token}'.
+var variableRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// captureExpr is a jq expression, from the 'capture' of a call in a test suite
+// or -batch manifest, whose result for the call's last response is saved as a
+// variable that later calls can reference.
+type captureExpr struct {
+	name string
+	expr string
+	code *gojq.Code
+}
+
+// parseCaptures compiles the given captures, which map the names of variables
+// to jq expressions. The result is sorted by name.
+func parseCaptures(captures map[string]string) ([]captureExpr, error) {
+	var result []captureExpr
+	for name, expr := range captures {
+		if !isVariableName(name) {
+			return nil, fmt.Errorf("invalid capture name %q: must be letters, digits, and underscores, and not start with a digit", name)
+		}
+		query, err := gojq.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jq expression %q for capture %q: %v", expr, name, err)
+		}
+		code, err := gojq.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jq expression %q for capture %q: %v", expr, name, err)
+		}
+		result = append(result, captureExpr{name: name, expr: expr, code: code})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result, nil
+}
+
+// captureVariables evaluates the given captures against the last of the given
+// responses, which are in JSON format. It returns the captured values and a
+// description of each capture that failed.
+func captureVariables(captures []captureExpr, responses []string) (map[string]interface{}, []string) {
+	if len(captures) == 0 {
+		return nil, nil
+	}
+	var failures []string
+	values := map[string]interface{}{}
+	for _, c := range captures {
+		if len(responses) == 0 {
+			failures = append(failures, fmt.Sprintf("no response from which to capture %q", c.name))
+			continue
+		}
+		v, err := c.eval(responses[len(responses)-1])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("could not capture %q: jq expression %q %v", c.name, c.expr, err))
+			continue
+		}
+		values[c.name] = v
+	}
+	return values, failures
+}
+
+// eval returns the first value that the expression yields for the given JSON,
+// which must not be null.
+func (c captureExpr) eval(str string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.UseNumber()
+	var input interface{}
+	if err := dec.Decode(&input); err != nil {
+		return nil, fmt.Errorf("could not be evaluated: %v", err)
+	}
+	v, ok := c.code.Run(normalizeJSONNumbers(input)).Next()
+	if !ok {
+		return nil, fmt.Errorf("yielded no value")
+	}
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("failed: %v", err)
+	}
+	if v == nil {
+		return nil, fmt.Errorf("yielded null")
+	}
+	return v, nil
+}
+
+// captureChain passes the variables captured by a sequence of calls to the
+// later calls that reference them. Calls may run concurrently: a call that
+// references a variable waits for the call that captures it to finish.
+type captureChain struct {
+	// the names of the variables each call captures
+	names []map[string]bool
+	// the variables captured by each call, set before its channel in done is
+	// closed; nil if the call failed
+	values []map[string]interface{}
+	done   []chan struct{}
+}
+
+// newCaptureChain returns a chain for calls with the given captures, or nil if
+// no call captures anything. The methods of a nil chain do nothing.
+func newCaptureChain(captures [][]captureExpr) *captureChain {
+	c := &captureChain{
+		names:  make([]map[string]bool, len(captures)),
+		values: make([]map[string]interface{}, len(captures)),
+		done:   make([]chan struct{}, len(captures)),
+	}
+	found := false
+	for i, exprs := range captures {
+		c.names[i] = map[string]bool{}
+		for _, expr := range exprs {
+			c.names[i][expr.name] = true
+			found = true
+		}
+		c.done[i] = make(chan struct{})
+	}
+	if !found {
+		return nil
+	}
+	return c
+}
+
+// expand replaces each reference in the given text to a variable captured by
+// a call before call i with the variable's value, waiting for that call to
+// finish if necessary. References to other variables are left alone. Values
+// other than strings are inserted as JSON. If inJSON is true, the text is
+// request data, and strings are escaped so they can be referenced inside of
+// a quoted string, like '"${token}"'.
+func (c *captureChain) expand(ctx context.Context, i int, text string, inJSON bool) (string, error) {
+	if c == nil {
+		return text, nil
+	}
+	var err error
+	result := variableRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		name := ref[2 : len(ref)-1] // strip leading `${` and trailing `}`
+		j := i - 1
+		for j >= 0 && !c.names[j][name] {
+			j--
+		}
+		if j < 0 {
+			return ref
+		}
+		select {
+		case <-c.done[j]:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return ref
+		}
+		v, ok := c.values[j][name]
+		if !ok {
+			err = fmt.Errorf("variable %q was not captured, since the call that captures it failed", name)
+			return ref
+		}
+		var str string
+		if str, err = variableText(name, v, inJSON); err != nil {
+			return ref
+		}
+		return str
+	})
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// variableText returns the text with which a reference to the variable with
+// the given name and value is replaced. Values other than strings are
+// inserted as JSON. If inJSON is true, strings are escaped so they can be
+// referenced inside of a quoted string.
+func variableText(name string, v interface{}, inJSON bool) (string, error) {
+	str, ok := v.(string)
+	if ok && !inJSON {
+		return str, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("could not convert variable %q to JSON: %v", name, err)
+	}
+	str = string(b)
+	if ok {
+		// strip the quotes, leaving only the escaped contents
+		str = str[1 : len(str)-1]
+	}
+	return str, nil
+}
+
+// expandVariables replaces each reference in the given text to one of the
+// given variables with its value, as expand does for captured variables.
+// References to other variables are left alone.
+func expandVariables(text string, vars map[string]string, inJSON bool) string {
+	if len(vars) == 0 {
+		return text
+	}
+	return variableRefPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		name := ref[2 : len(ref)-1] // strip leading `${` and trailing `}`
+		v, ok := vars[name]
+		if !ok {
+			return ref
+		}
+		// a string can always be converted
+		str, _ := variableText(name, v, inJSON)
+		return str
+	})
+}
+
+// isVariableName returns true if the given name may be referenced as a
+// variable, like '${name}'.
+func isVariableName(name string) bool {
+	ref := "${" + name + "}"
+	return variableRefPattern.FindString(ref) == ref
+}
+
+// parseVariables parses variables given in "name=value" form.
+func parseVariables(defs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, def := range defs {
+		name, value, ok := strings.Cut(def, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not in 'name=value' form", def)
+		}
+		if !isVariableName(name) {
+			return nil, fmt.Errorf("invalid variable name %q: must be letters, digits, and underscores, and not start with a digit", name)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// expandAll is like expand, for each of the given headers.
+func (c *captureChain) expandAll(ctx context.Context, i int, headers []string) ([]string, error) {
+	if c == nil || len(headers) == 0 {
+		return headers, nil
+	}
+	expanded := make([]string, len(headers))
+	for h, header := range headers {
+		var err error
+		if expanded[h], err = c.expand(ctx, i, header, false); err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+// finish records the variables captured by call i, which are nil if the call
+// failed. It must be called once for every call, even one that captures
+// nothing, so that later calls do not wait forever.
+func (c *captureChain) finish(i int, values map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	c.values[i] = values
+	close(c.done[i])
+}
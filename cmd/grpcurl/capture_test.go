@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCaptures(t *testing.T) {
+	captures, err := parseCaptures(map[string]string{"token": ".session.token", "id": ".id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) != 2 || captures[0].name != "id" || captures[1].name != "token" {
+		t.Errorf("unexpected captures: %+v", captures)
+	}
+	for name, expr := range map[string]string{"1st": ".a", "a-b": ".a", "ok": ".["} {
+		if _, err := parseCaptures(map[string]string{name: expr}); err == nil {
+			t.Errorf("expected error for capture %q of %q", name, expr)
+		}
+	}
+}
+
+func TestCaptureVariables(t *testing.T) {
+	captures, err := parseCaptures(map[string]string{"token": ".session.token", "n": ".count", "missing": ".nope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, failures := captureVariables(captures, []string{`{"session": {"token": "old"}}`, `{"session": {"token": "abc"}, "count": 3}`})
+	if expected := map[string]interface{}{"token": "abc", "n": 3}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected values %v, got %v", expected, values)
+	}
+	if expected := []string{`could not capture "missing": jq expression ".nope" yielded null`}; !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected failures %q, got %q", expected, failures)
+	}
+	_, failures = captureVariables(captures[:1], nil)
+	if expected := []string{`no response from which to capture "missing"`}; !reflect.DeepEqual(failures, expected) {
+		t.Errorf("expected failures %q, got %q", expected, failures)
+	}
+}
+
+func TestCaptureChain(t *testing.T) {
+	login, err := parseCaptures(map[string]string{"token": ".token", "n": ".n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := parseCaptures(map[string]string{"token": ".token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newCaptureChain([][]captureExpr{nil, nil}) != nil {
+		t.Error("expected nil chain when nothing is captured")
+	}
+	chain := newCaptureChain([][]captureExpr{login, nil, again, nil})
+	ctx := context.Background()
+
+	// the first call cannot reference its own variables
+	if s, err := chain.expand(ctx, 0, "${token}", false); err != nil || s != "${token}" {
+		t.Errorf("expected reference to be left alone, got %q, %v", s, err)
+	}
+
+	// a later call waits for the variables to be captured
+	type expanded struct {
+		data    string
+		headers []string
+		err     error
+	}
+	results := make(chan expanded)
+	go func() {
+		var r expanded
+		if r.data, r.err = chain.expand(ctx, 1, `{"token": "${token}", "n": ${n}, "other": "${other}"}`, true); r.err == nil {
+			r.headers, r.err = chain.expandAll(ctx, 1, []string{"authorization: Bearer ${token}"})
+		}
+		results <- r
+	}()
+	select {
+	case <-results:
+		t.Fatal("expected call to wait for variables to be captured")
+	case <-time.After(50 * time.Millisecond):
+	}
+	chain.finish(0, map[string]interface{}{"token": `a"b`, "n": 3})
+	r := <-results
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if expected := `{"token": "a\"b", "n": 3, "other": "${other}"}`; r.data != expected {
+		t.Errorf("expected data %q, got %q", expected, r.data)
+	}
+	if expected := []string{`authorization: Bearer a"b`}; !reflect.DeepEqual(r.headers, expected) {
+		t.Errorf("expected headers %q, got %q", expected, r.headers)
+	}
+
+	// the variable captured by the latest call is used, and it is an error if
+	// that call failed
+	chain.finish(1, nil)
+	chain.finish(2, nil)
+	if _, err := chain.expand(ctx, 3, "${n} ${token}", false); err == nil || !strings.Contains(err.Error(), `variable "token" was not captured`) {
+		t.Errorf("expected error for variable of failed call, got %v", err)
+	}
+	if s, err := chain.expand(ctx, 3, "${n}", false); err != nil || s != "3" {
+		t.Errorf("expected %q, got %q, %v", "3", s, err)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	vars, err := parseVariables([]string{"env=staging", "url=http://x/?a=b", "env=prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"env": "prod", "url": "http://x/?a=b"}; !reflect.DeepEqual(vars, expected) {
+		t.Errorf("expected variables %v, got %v", expected, vars)
+	}
+	for _, def := range []string{"env", "1st=a", "a}b=c", "=a"} {
+		if _, err := parseVariables([]string{def}); err == nil {
+			t.Errorf("expected error for variable %q", def)
+		}
+	}
+
+	vars = map[string]string{"env": "prod", "q": `say "hi"`}
+	if s := expandVariables(`{"env": "${env}", "q": "${q}", "token": "${token}"}`, vars, true); s != `{"env": "prod", "q": "say \"hi\"", "token": "${token}"}` {
+		t.Errorf("unexpected expansion: %s", s)
+	}
+	if s := expandVariables(`x-q: ${q}`, vars, false); s != `x-q: say "hi"` {
+		t.Errorf("unexpected expansion: %s", s)
+	}
+}
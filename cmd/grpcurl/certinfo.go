@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// certRecorder wraps transport credentials in order to record the certificate
+// chain presented by the server, for -show-cert and the 'cert' verb. The chain
+// is recorded even if it fails verification, since that is when it is most
+// useful to see it.
+type certRecorder struct {
+	credentials.TransportCredentials
+
+	mu    sync.Mutex
+	chain []*x509.Certificate
+}
+
+func (r *certRecorder) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := r.TransportCredentials.ClientHandshake(ctx, addr, rawConn)
+	var verifyErr *tls.CertificateVerificationError
+	if tlsInfo, ok := authInfo.(credentials.TLSInfo); ok {
+		r.record(tlsInfo.State.PeerCertificates)
+	} else if errors.As(err, &verifyErr) {
+		r.record(verifyErr.UnverifiedCertificates)
+	}
+	return conn, authInfo, err
+}
+
+func (r *certRecorder) record(chain []*x509.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chain = chain
+}
+
+// recordVerified changes the given config so that the server's certificates
+// are also recorded when they are checked by its VerifyConnection function,
+// such as for -tofu or -pinned-cert, which may reject them.
+func (r *certRecorder) recordVerified(conf *tls.Config) {
+	verify := conf.VerifyConnection
+	if verify == nil {
+		return
+	}
+	conf.VerifyConnection = func(state tls.ConnectionState) error {
+		r.record(state.PeerCertificates)
+		return verify(state)
+	}
+}
+
+// certificates returns the recorded chain, which is empty if no handshake got
+// as far as the server sending its certificates.
+func (r *certRecorder) certificates() []*x509.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.chain
+}
+
+// printCertChain describes each certificate of the given chain, starting with
+// the server's own, to the given writer.
+func printCertChain(w io.Writer, chain []*x509.Certificate) {
+	if len(chain) == 0 {
+		fmt.Fprintln(w, "Server presented no certificates")
+		return
+	}
+	fmt.Fprintln(w, "Server certificate chain:")
+	now := time.Now()
+	for i, cert := range chain {
+		fmt.Fprintf(w, "  %d: %s\n", i, cert.Subject)
+		if sans := certSANs(cert); len(sans) > 0 {
+			fmt.Fprintf(w, "    Subject alternative names: %s\n", strings.Join(sans, ", "))
+		}
+		fmt.Fprintf(w, "    Issuer: %s\n", cert.Issuer)
+		fmt.Fprintf(w, "    Valid from: %s\n", cert.NotBefore.Format(time.RFC3339))
+		expiry := cert.NotAfter.Format(time.RFC3339)
+		switch {
+		case now.After(cert.NotAfter):
+			expiry += " (EXPIRED)"
+		case now.Before(cert.NotBefore):
+			expiry += " (NOT YET VALID)"
+		default:
+			expiry += fmt.Sprintf(" (in %d days)", int(cert.NotAfter.Sub(now).Hours()/24))
+		}
+		fmt.Fprintf(w, "    Expires: %s\n", expiry)
+		if usages := keyUsages(cert); len(usages) > 0 {
+			fmt.Fprintf(w, "    Key usage: %s\n", strings.Join(usages, ", "))
+		}
+		if usages := extKeyUsages(cert); len(usages) > 0 {
+			fmt.Fprintf(w, "    Extended key usage: %s\n", strings.Join(usages, ", "))
+		}
+		if cert.BasicConstraintsValid && cert.IsCA {
+			fmt.Fprintln(w, "    CA: true")
+		}
+		fmt.Fprintf(w, "    Public key: %s\n", publicKeyDescription(cert))
+		fmt.Fprintf(w, "    Public key hash: %s\n", spkiPin(cert))
+		fmt.Fprintf(w, "    Fingerprint: %s\n", certFingerprint(cert))
+	}
+}
+
+func certSANs(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "Digital Signature"},
+	{x509.KeyUsageContentCommitment, "Content Commitment"},
+	{x509.KeyUsageKeyEncipherment, "Key Encipherment"},
+	{x509.KeyUsageDataEncipherment, "Data Encipherment"},
+	{x509.KeyUsageKeyAgreement, "Key Agreement"},
+	{x509.KeyUsageCertSign, "Certificate Sign"},
+	{x509.KeyUsageCRLSign, "CRL Sign"},
+	{x509.KeyUsageEncipherOnly, "Encipher Only"},
+	{x509.KeyUsageDecipherOnly, "Decipher Only"},
+}
+
+func keyUsages(cert *x509.Certificate) []string {
+	var names []string
+	for _, u := range keyUsageNames {
+		if cert.KeyUsage&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "Any",
+	x509.ExtKeyUsageServerAuth:      "Server Authentication",
+	x509.ExtKeyUsageClientAuth:      "Client Authentication",
+	x509.ExtKeyUsageCodeSigning:     "Code Signing",
+	x509.ExtKeyUsageEmailProtection: "Email Protection",
+	x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+}
+
+func extKeyUsages(cert *x509.Certificate) []string {
+	var names []string
+	for _, u := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[u]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("%d", u))
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+func publicKeyDescription(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return cert.PublicKeyAlgorithm.String()
+	}
+}
+
+// runCert prints the certificate chain presented by the server, for the
+// 'cert' verb. The chain is printed even if it failed verification, in which
+// case dialErr is the error from dialing the server.
+func runCert(target string, certs *certRecorder, dialErr error) {
+	if chain := certs.certificates(); dialErr == nil || len(chain) > 0 {
+		printCertChain(os.Stdout, chain)
+	}
+	if dialErr != nil {
+		fail(dialErr, "Failed to dial target host %q", target)
+	}
+}
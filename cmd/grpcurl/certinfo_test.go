@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintCertChain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.example"},
+		DNSNames:     []string{"test.example"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-48 * time.Hour),
+		NotAfter:     time.Now().Add(-24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	printCertChain(&buf, []*x509.Certificate{cert})
+	out := buf.String()
+	for _, expected := range []string{
+		"  0: CN=test.example\n",
+		"    Subject alternative names: test.example, 127.0.0.1\n",
+		"    Issuer: CN=test.example\n",
+		"(EXPIRED)\n",
+		"    Key usage: Digital Signature\n",
+		"    Extended key usage: Server Authentication\n",
+		"    Public key: ECDSA P-256\n",
+		"    Public key hash: " + spkiPin(cert) + "\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("output does not contain %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestCertRecorder_RecordVerified(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("cert"), RawSubjectPublicKeyInfo: []byte("public key")}
+	conf := &tls.Config{VerifyConnection: verifyPinnedCert([][]byte{make([]byte, 32)})}
+	r := &certRecorder{}
+	r.recordVerified(conf)
+	err := conf.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+	if !errors.Is(err, errPinMismatch) {
+		t.Errorf("expected the original verification to fail, got %v", err)
+	}
+	if chain := r.certificates(); len(chain) != 1 || chain[0] != cert {
+		t.Errorf("rejected certificate was not recorded: %v", chain)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+// commandExcludedFlags are flags that are left out of the command printed by
+// -print-command, since their effects are already reflected in other flags
+// or they do not affect the RPC.
+var commandExcludedFlags = map[string]bool{"print-command": true, "config": true, "profile": true}
+
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// shellQuote quotes the given string, if necessary, for use as a single word
+// in a POSIX shell.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// equivalentCommand returns a command line that is equivalent to the current
+// invocation, with every flag that is in effect given explicitly, including
+// those set via the environment or a profile. Flags are listed in
+// alphabetical order, followed by the given positional arguments.
+func equivalentCommand(prog string, fs *flag.FlagSet, args []string) string {
+	words := []string{shellQuote(prog)}
+	fs.Visit(func(f *flag.Flag) {
+		if commandExcludedFlags[f.Name] {
+			return
+		}
+		if vals, ok := f.Value.(*multiString); ok {
+			for _, v := range *vals {
+				words = append(words, "-"+f.Name, shellQuote(v))
+			}
+			return
+		}
+		if isBoolFlag(f) {
+			if f.Value.String() == "true" {
+				words = append(words, "-"+f.Name)
+			} else {
+				words = append(words, "-"+f.Name+"="+f.Value.String())
+			}
+			return
+		}
+		words = append(words, "-"+f.Name, shellQuote(f.Value.String()))
+	})
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestEquivalentCommand(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("plaintext", false, "")
+	fs.Bool("emit-defaults", true, "")
+	fs.Float64("max-time", 0, "")
+	fs.String("d", "", "")
+	fs.Bool("print-command", false, "")
+	var headers multiString
+	fs.Var(&headers, "H", "")
+	err := fs.Parse([]string{"-print-command", "-plaintext", "-emit-defaults=false", "-H", "a: 1", "-H", "b: it's", "-d", `{"x":1}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Set("max-time", "2.5"); err != nil {
+		t.Fatal(err)
+	}
+	actual := equivalentCommand("grpcurl", fs, []string{"localhost:8080", "my.Service/Method"})
+	expected := `grpcurl -H 'a: 1' -H 'b: it'\''s' -d '{"x":1}' -emit-defaults=false -max-time 2.5 -plaintext localhost:8080 my.Service/Method`
+	if actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
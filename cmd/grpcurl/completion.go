@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// completionCacheTTL is how long service and method names fetched for shell
+// completion are reused, so that pressing tab repeatedly does not query the
+// server each time.
+const completionCacheTTL = time.Minute
+
+// completeVerb is the hidden verb that shell completion scripts use to ask
+// grpcurl for candidates. Its arguments are the words on the command line
+// after the program name, up to and including the word being completed.
+const completeVerb = "__complete"
+
+// completeSymbolsVerb is used internally by completeVerb when service and
+// method names are needed, which requires querying the descriptor source.
+const completeSymbolsVerb = "__complete-symbols"
+
+// firstVerbs are the verbs that may be given before an address.
+var firstVerbs = []string{"list", "describe", "replay", "export-openapi", "diff", "validate", "mock", "export", "proxy", "support-bundle", "shell", "test", "completion"}
+
+// addressVerbs are the verbs that may be given after an address.
+var addressVerbs = []string{"list", "describe", "replay", "export-openapi", "diff", "proxy", "cert", "validate", "test"}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for {{prog}}
+_{{func}}_complete() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local -a words
+    read -ra words <<< "$line"
+    if [[ "$line" =~ [[:space:]]$ ]]; then
+        words+=("")
+    fi
+    local IFS=$'\n'
+    COMPREPLY=($({{prog}} {{verb}} "${words[@]:1}" 2>/dev/null))
+    # bash treats ':' as a word break, so only the part after it is replaced
+    local cur="${words[${#words[@]}-1]}"
+    if [[ "$cur" == *:* && "$COMP_WORDBREAKS" == *:* ]]; then
+        local prefix="${cur%"${cur##*:}"}"
+        COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+    fi
+}
+complete -o default -F _{{func}}_complete {{prog}}
+`,
+	"zsh": `#compdef {{prog}}
+# zsh completion for {{prog}}
+_{{func}}_complete() {
+    local -a candidates
+    candidates=("${(@f)$({{prog}} {{verb}} "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n "${candidates[1]}" ]]; then
+        compadd -- "${candidates[@]}"
+    else
+        _files
+    fi
+}
+compdef _{{func}}_complete {{prog}}
+`,
+	"fish": `# fish completion for {{prog}}
+function __{{func}}_complete
+    set -l words (commandline -opc) (commandline -ct)
+    {{prog}} {{verb}} $words[2..-1] 2>/dev/null
+end
+complete -c {{prog}} -a '(__{{func}}_complete)'
+`,
+}
+
+// completionScript returns the completion script for the given shell, for the
+// program with the given name.
+func completionScript(shell, prog string) (string, error) {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q; must be bash, zsh, or fish", shell)
+	}
+	fn := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, prog)
+	r := strings.NewReplacer("{{prog}}", prog, "{{func}}", fn, "{{verb}}", completeVerb)
+	return r.Replace(script), nil
+}
+
+// completionRequest describes what should be completed, given the words on a
+// command line.
+type completionRequest struct {
+	// prefix is the word being completed
+	prefix string
+	// candidates that can be determined without querying the server
+	candidates []string
+	// if true, service and method names should also be completed, by
+	// querying the server at address (if non-empty) using the given flags
+	symbols   bool
+	address   string
+	flagWords []string
+	// cacheFile is where the service and method names are cached
+	cacheFile string
+}
+
+// parseCompletionWords determines what to complete for the given words. The
+// last word is the one being completed.
+func parseCompletionWords(fs *flag.FlagSet, words []string) completionRequest {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	req := completionRequest{prefix: words[len(words)-1]}
+	if strings.HasPrefix(req.prefix, "-") {
+		fs.VisitAll(func(f *flag.Flag) {
+			if !isUnsupportedFlag(f.Name) {
+				req.candidates = append(req.candidates, "-"+f.Name)
+			}
+		})
+		return req
+	}
+	var positional []string
+	prev := words[:len(words)-1]
+	for i := 0; i < len(prev); i++ {
+		w := prev[i]
+		if !strings.HasPrefix(w, "-") || w == "-" {
+			positional = append(positional, w)
+			continue
+		}
+		req.flagWords = append(req.flagWords, w)
+		name := strings.TrimLeft(w, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil || isBoolFlag(f) {
+			continue
+		}
+		if i == len(prev)-1 {
+			// completing the flag's value, which is usually a file name
+			return completionRequest{prefix: req.prefix}
+		}
+		i++
+		req.flagWords = append(req.flagWords, prev[i])
+	}
+
+	switch {
+	case len(positional) == 0:
+		req.candidates = firstVerbs
+	case contains(firstVerbs, positional[0]):
+		// no address, so symbols may only come from protoset or proto flags
+		if len(positional) == 1 && (positional[0] == "list" || positional[0] == "describe" || positional[0] == "validate") {
+			req.symbols = true
+		}
+	case len(positional) == 1:
+		req.candidates = addressVerbs
+		req.symbols = true
+		req.address = positional[0]
+	case len(positional) == 2 && (positional[1] == "list" || positional[1] == "describe" || positional[1] == "validate"):
+		req.symbols = true
+		req.address = positional[0]
+	}
+	return req
+}
+
+// runCompletion prints the completion script for the shell named in the given
+// arguments, for the 'completion' verb.
+func runCompletion(args []string) {
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fail(nil, "The 'completion' verb requires a shell name: bash, zsh, or fish.")
+	}
+	script, err := completionScript(flags.Arg(0), filepath.Base(os.Args[0]))
+	if err != nil {
+		fail(nil, "%v", err)
+	}
+	fmt.Print(script)
+}
+
+// startCompletion prints the completions of the given words, for the hidden
+// verb used by completion scripts. If service and method names should also be
+// completed and they are not cached, it parses the flags of the command being
+// completed and returns the request along with the arguments with which
+// grpcurl continues, to query the server. Otherwise, it returns nil.
+func startCompletion(words []string) (*completionRequest, []string) {
+	// The words being completed are not parsed as flags.
+	req := parseCompletionWords(flags, words)
+	printCompletions(os.Stdout, req.candidates, req.prefix)
+	if !req.symbols {
+		return nil, nil
+	}
+	req.cacheFile = completionCacheFile(req.address, req.flagWords)
+	if symbols, ok := readCompletionCache(req.cacheFile); ok {
+		printCompletions(os.Stdout, symbols, req.prefix)
+		return nil, nil
+	}
+	flags.Parse(req.flagWords)
+	if req.address != "" {
+		return &req, []string{req.address, completeSymbolsVerb}
+	}
+	return &req, []string{completeSymbolsVerb}
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runCompleteSymbols prints the names of the services and methods in the
+// given source that start with the given prefix, for tab completion, and
+// caches them in the given file.
+func runCompleteSymbols(descSource grpcurl.DescriptorSource, cacheFile, prefix string) {
+	symbols, err := completionSymbols(descSource)
+	if err != nil {
+		fail(err, "Failed to list services")
+	}
+	if err := writeCompletionCache(cacheFile, symbols); err != nil {
+		warn("Failed to cache completions: %v", err)
+	}
+	printCompletions(os.Stdout, symbols, prefix)
+}
+
+// printCompletions prints each candidate that starts with the given prefix.
+func printCompletions(out io.Writer, candidates []string, prefix string) {
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			fmt.Fprintln(out, c)
+		}
+	}
+}
+
+// completionSymbols returns the names of the services in the given source and
+// of their methods, in "service.Method" form.
+func completionSymbols(descSource grpcurl.DescriptorSource) ([]string, error) {
+	svcs, err := listAPIServices(descSource)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []string
+	for _, svc := range svcs {
+		symbols = append(symbols, svc)
+		methods, err := grpcurl.ListMethods(descSource, svc)
+		if err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, methods...)
+	}
+	return symbols, nil
+}
+
+// completionCacheFile returns the file in which symbols are cached for the
+// given address and flags, or the empty string if there is no cache
+// directory.
+func completionCacheFile(address string, flagWords []string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{address}, flagWords...), "\x00")))
+	return filepath.Join(dir, "grpcurl", "completion", hex.EncodeToString(sum[:16]))
+}
+
+// readCompletionCache returns the cached symbols in the given file, if it
+// was written within completionCacheTTL.
+func readCompletionCache(fileName string) ([]string, bool) {
+	if fileName == "" {
+		return nil, false
+	}
+	info, err := os.Stat(fileName)
+	if err != nil || time.Since(info.ModTime()) > completionCacheTTL {
+		return nil, false
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var symbols []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		symbols = append(symbols, scanner.Text())
+	}
+	return symbols, scanner.Err() == nil
+}
+
+func writeCompletionCache(fileName string, symbols []string) error {
+	if fileName == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	for _, s := range symbols {
+		sb.WriteString(s)
+		sb.WriteByte('\n')
+	}
+	return os.WriteFile(fileName, []byte(sb.String()), 0600)
+}
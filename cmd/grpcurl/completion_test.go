@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCompletionWords(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("plaintext", false, "")
+	fs.String("protoset", "", "")
+	fs.String("proto", "", "")
+
+	testCases := []struct {
+		words    []string
+		expected completionRequest
+	}{
+		{
+			words:    []string{"-pro"},
+			expected: completionRequest{prefix: "-pro", candidates: []string{"-plaintext", "-proto", "-protoset"}},
+		},
+		{
+			words:    []string{"-plaintext", ""},
+			expected: completionRequest{candidates: firstVerbs, flagWords: []string{"-plaintext"}},
+		},
+		{
+			words:    []string{"-plaintext", "localhost:8080", "my."},
+			expected: completionRequest{prefix: "my.", candidates: addressVerbs, symbols: true, address: "localhost:8080", flagWords: []string{"-plaintext"}},
+		},
+		{
+			words:    []string{"-protoset", "x.protoset", "describe", ""},
+			expected: completionRequest{symbols: true, flagWords: []string{"-protoset", "x.protoset"}},
+		},
+		{
+			words:    []string{"-protoset=x.protoset", "localhost:8080", "list", "my"},
+			expected: completionRequest{prefix: "my", symbols: true, address: "localhost:8080", flagWords: []string{"-protoset=x.protoset"}},
+		},
+		{
+			// value of a flag
+			words:    []string{"-protoset", "x."},
+			expected: completionRequest{prefix: "x."},
+		},
+		{
+			// request data after the method name
+			words:    []string{"localhost:8080", "my.Service/Method", ""},
+			expected: completionRequest{},
+		},
+	}
+	for _, tc := range testCases {
+		actual := parseCompletionWords(fs, tc.words)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%q: expected %+v, got %+v", tc.words, tc.expected, actual)
+		}
+	}
+}
+
+func TestCompleteUnsupportedFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("key", "", "")
+	fs.String("key-provider", "", "")
+
+	// -key-provider is only completed if this build supports it
+	expected := []string{"-key"}
+	if pkcs11Supported {
+		expected = append(expected, "-key-provider")
+	}
+	if actual := parseCompletionWords(fs, []string{"-key"}).candidates; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected candidates %q, got %q", expected, actual)
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell, "my-grpcurl")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", shell, err)
+		}
+		if !strings.Contains(script, "my-grpcurl "+completeVerb) || !strings.Contains(script, "_my_grpcurl_complete") {
+			t.Errorf("%s: script does not invoke program:\n%s", shell, script)
+		}
+		if strings.Contains(script, "{{") {
+			t.Errorf("%s: script has unreplaced placeholders:\n%s", shell, script)
+		}
+	}
+	if _, err := completionScript("tcsh", "grpcurl"); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+func TestCompletionCache(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "sub", "cache")
+	if _, ok := readCompletionCache(fileName); ok {
+		t.Fatal("expected cache miss")
+	}
+	symbols := []string{"my.Service", "my.Service.Method"}
+	if err := writeCompletionCache(fileName, symbols); err != nil {
+		t.Fatal(err)
+	}
+	actual, ok := readCompletionCache(fileName)
+	if !ok || !reflect.DeepEqual(actual, symbols) {
+		t.Errorf("expected %v, got %v (ok=%v)", symbols, actual, ok)
+	}
+}
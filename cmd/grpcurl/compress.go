@@ -0,0 +1,115 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// defaultAcceptEncoding is the default value of -accept-encoding.
+const defaultAcceptEncoding = "gzip,zstd,snappy"
+
+// compressors are the compression codecs that can be given via
+// -accept-encoding, keyed by name.
+var compressors = map[string]encoding.Compressor{
+	"gzip": compressor{
+		name: "gzip",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	"zstd": compressor{
+		name: "zstd",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return &closeOnEOFReader{ReadCloser: d.IOReadCloser()}, nil
+		},
+	},
+	// snappy uses the framing format, since messages are streamed
+	"snappy": compressor{
+		name: "snappy",
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return snappy.NewBufferedWriter(w), nil
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return snappy.NewReader(r), nil
+		},
+	},
+}
+
+// compressor is an encoding.Compressor implemented by the given functions.
+type compressor struct {
+	name      string
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	newReader func(io.Reader) (io.Reader, error)
+}
+
+func (c compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return c.newWriter(w)
+}
+
+func (c compressor) Decompress(r io.Reader) (io.Reader, error) {
+	return c.newReader(r)
+}
+
+func (c compressor) Name() string {
+	return c.name
+}
+
+// closeOnEOFReader closes the underlying reader once it has been fully read,
+// since gRPC does not close decompressors.
+type closeOnEOFReader struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (r *closeOnEOFReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, io.EOF
+	}
+	n, err := r.ReadCloser.Read(p)
+	if err != nil {
+		r.closed = true
+		r.ReadCloser.Close()
+	}
+	return n, err
+}
+
+// registerCompressors registers the compressors with the given names, which
+// is a comma-separated list, for -accept-encoding. These are the codecs that
+// are advertised to servers and that can be used to decode responses. The
+// name 'identity' means no compression, so it registers nothing.
+func registerCompressors(names string) error {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "identity" {
+			continue
+		}
+		c, ok := compressors[name]
+		if !ok {
+			var known []string
+			for k := range compressors {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unsupported encoding %q; must be one of %s, or identity", name, strings.Join(known, ", "))
+		}
+		encoding.RegisterCompressor(c)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressors(t *testing.T) {
+	data := []byte(strings.Repeat("grpcurl compression test ", 100))
+	for name, c := range compressors {
+		t.Run(name, func(t *testing.T) {
+			if c.Name() != name {
+				t.Errorf("compressor registered as %q has name %q", name, c.Name())
+			}
+			var buf bytes.Buffer
+			w, err := c.Compress(&buf)
+			if err != nil {
+				t.Fatalf("failed to create writer: %v", err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+			if buf.Len() >= len(data) {
+				t.Errorf("compressed data is not smaller: %d >= %d", buf.Len(), len(data))
+			}
+			r, err := c.Decompress(&buf)
+			if err != nil {
+				t.Fatalf("failed to create reader: %v", err)
+			}
+			actual, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("failed to decompress: %v", err)
+			}
+			if !bytes.Equal(actual, data) {
+				t.Error("decompressed data does not match original")
+			}
+		})
+	}
+}
+
+func TestRegisterCompressors(t *testing.T) {
+	for _, names := range []string{"", "identity", "gzip", " zstd , snappy", defaultAcceptEncoding} {
+		if err := registerCompressors(names); err != nil {
+			t.Errorf("registerCompressors(%q): unexpected error: %v", names, err)
+		}
+	}
+	if err := registerCompressors("gzip,brotli"); err == nil || !strings.Contains(err.Error(), `"brotli"`) {
+		t.Errorf("expected error for unsupported encoding, got %v", err)
+	}
+}
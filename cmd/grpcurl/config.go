@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProfileName is the profile used when -profile is not present.
+const defaultProfileName = "default"
+
+// configFile is the YAML file given via -config. For example:
+//
+//	profiles:
+//	  default:
+//	    connect-timeout: 5
+//	    max-time: 30
+//	    methods:
+//	      my.pkg.ReportService/Generate:
+//	        max-time: 300
+//	      my.pkg.SearchService:
+//	        max-time: 60
+type configFile struct {
+	Profiles map[string]*profile `yaml:"profiles"`
+}
+
+// profile is a named set of defaults in a config file.
+type profile struct {
+	timeouts `yaml:",inline"`
+	// Methods overrides the profile's timeouts for particular methods or,
+	// when the key is a service name, for all methods in a service.
+	Methods map[string]timeouts `yaml:"methods"`
+}
+
+// timeouts are defaults for the -connect-timeout and -max-time flags, in
+// seconds. A nil value means no default is configured.
+type timeouts struct {
+	ConnectTimeout *float64 `yaml:"connect-timeout"`
+	MaxTime        *float64 `yaml:"max-time"`
+}
+
+// defaultConfigFile returns the file used when -config is not present.
+func defaultConfigFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".grpcurl", "config.yaml"), nil
+}
+
+// loadProfile reads the named profile from the given config file. If
+// required is false, a missing file or profile is not an error and nil is
+// returned.
+func loadProfile(fileName, name string, required bool) (*profile, error) {
+	b, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) && !required {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f configFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	p := f.Profiles[name]
+	if p == nil && required {
+		return nil, fmt.Errorf("no profile named %q", name)
+	}
+	if p != nil {
+		if err := p.check(); err != nil {
+			return nil, fmt.Errorf("profile %q: %v", name, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *profile) check() error {
+	all := []timeouts{p.timeouts}
+	for _, t := range p.Methods {
+		all = append(all, t)
+	}
+	for _, t := range all {
+		if t.ConnectTimeout != nil && *t.ConnectTimeout < 0 {
+			return fmt.Errorf("connect-timeout must not be negative")
+		}
+		if t.MaxTime != nil && *t.MaxTime < 0 {
+			return fmt.Errorf("max-time must not be negative")
+		}
+	}
+	return nil
+}
+
+// timeoutsFor returns the timeouts to use for the given method, which may be
+// in "service/method" or "service.method" form, or empty if no method is
+// being invoked. Settings for the method take precedence over those for its
+// service, which take precedence over those for the profile.
+func (p *profile) timeoutsFor(method string) timeouts {
+	result := p.timeouts
+	if method == "" {
+		return result
+	}
+	method = strings.TrimPrefix(method, "/")
+	pos := strings.LastIndex(method, "/")
+	if pos < 0 {
+		pos = strings.LastIndex(method, ".")
+	}
+	if pos < 0 {
+		return result
+	}
+	svc, name := method[:pos], method[pos+1:]
+	for _, key := range []string{svc, svc + "/" + name, svc + "." + name} {
+		t, ok := p.Methods[key]
+		if !ok {
+			continue
+		}
+		if t.ConnectTimeout != nil {
+			result.ConnectTimeout = t.ConnectTimeout
+		}
+		if t.MaxTime != nil {
+			result.MaxTime = t.MaxTime
+		}
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+profiles:
+  default:
+    connect-timeout: 5
+    max-time: 30
+    methods:
+      my.pkg.SearchService:
+        max-time: 60
+      my.pkg.SearchService/Reindex:
+        max-time: 600
+      my.pkg.ReportService.Generate:
+        connect-timeout: 1
+  bad:
+    max-time: -1
+`
+	if err := os.WriteFile(fileName, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadProfile(fileName, "default", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testCases := []struct {
+		method                  string
+		connectTimeout, maxTime float64
+	}{
+		{"", 5, 30},
+		{"my.pkg.OtherService/Get", 5, 30},
+		{"my.pkg.SearchService/Query", 5, 60},
+		{"my.pkg.SearchService.Reindex", 5, 600},
+		{"my.pkg.ReportService/Generate", 1, 30},
+	}
+	for _, tc := range testCases {
+		to := p.timeoutsFor(tc.method)
+		if *to.ConnectTimeout != tc.connectTimeout || *to.MaxTime != tc.maxTime {
+			t.Errorf("%q: expected %v and %v, got %v and %v", tc.method, tc.connectTimeout, tc.maxTime, *to.ConnectTimeout, *to.MaxTime)
+		}
+	}
+
+	if _, err := loadProfile(fileName, "bad", true); err == nil {
+		t.Error("expected error for negative timeout")
+	}
+	if _, err := loadProfile(fileName, "missing", true); err == nil {
+		t.Error("expected error for missing profile")
+	}
+	if p, err := loadProfile(fileName, "missing", false); p != nil || err != nil {
+		t.Errorf("expected no profile and no error, got %v, %v", p, err)
+	}
+	if p, err := loadProfile(filepath.Join(t.TempDir(), "none.yaml"), "default", false); p != nil || err != nil {
+		t.Errorf("expected no profile and no error for missing file, got %v, %v", p, err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// consulScheme is the prefix of targets, like
+// 'consul://service-name?dc=dc1&tag=grpc', whose addresses are the healthy
+// instances of a service registered with Consul.
+const consulScheme = "consul://"
+
+// consulResolverScheme is the scheme of targets that are resolved via the
+// Consul agent.
+const consulResolverScheme = "grpcurl-consul"
+
+// defaultConsulAddr is the address of the Consul agent when the
+// CONSUL_HTTP_ADDR environment variable is not set.
+const defaultConsulAddr = "127.0.0.1:8500"
+
+// consulFetchTimeout is how long to wait for the Consul agent to return the
+// instances of a service.
+const consulFetchTimeout = 10 * time.Second
+
+// consulTarget is a parsed 'consul://' target.
+type consulTarget struct {
+	service string
+	// query is the query string of the agent's health endpoint, with the
+	// datacenter, tags, and sorting from the target
+	query url.Values
+}
+
+// parseConsulTarget parses a 'consul://service-name' target, whose query may
+// include the datacenter ('dc'), tags that instances must have ('tag', which
+// may be repeated), and a node by whose distance instances are sorted
+// ('near').
+func parseConsulTarget(target string) (*consulTarget, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme+"://" != consulScheme || u.Host == "" || (u.Path != "" && u.Path != "/") || u.User != nil || u.Fragment != "" {
+		return nil, fmt.Errorf("%q is not in 'consul://service-name' form", target)
+	}
+	query := url.Values{"passing": {"1"}}
+	for key, vals := range u.Query() {
+		switch key {
+		case "dc", "near":
+			if len(vals) > 1 {
+				return nil, fmt.Errorf("%q: the %q parameter may only be given once", target, key)
+			}
+		case "tag":
+		default:
+			return nil, fmt.Errorf("%q: unsupported parameter %q; only 'dc', 'tag', and 'near' are supported", target, key)
+		}
+		query[key] = vals
+	}
+	return &consulTarget{service: u.Host, query: query}, nil
+}
+
+// consulAgent returns the base URL of the Consul agent and the ACL token, if
+// any, from the CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN environment variables,
+// as used by the consul command.
+func consulAgent() (baseURL, token string) {
+	addr := os.Getenv("CONSUL_HTTP_ADDR")
+	if addr == "" {
+		addr = defaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/"), os.Getenv("CONSUL_HTTP_TOKEN")
+}
+
+// consulResolverBuilder builds resolvers that look up the healthy instances
+// of a service via the Consul agent at the given URL.
+type consulResolverBuilder struct {
+	target  *consulTarget
+	baseURL string
+	token   string
+}
+
+func (b *consulResolverBuilder) Build(_ resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	// the query is not part of the target's endpoint, so the parsed target
+	// is used instead
+	addrs, err := fetchConsulInstances(b.baseURL, b.token, b.target)
+	if err != nil {
+		return nil, err
+	}
+	var state resolver.State
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	if err := cc.UpdateState(state); err != nil {
+		return nil, err
+	}
+	return execResolver{}, nil
+}
+
+func (b *consulResolverBuilder) Scheme() string {
+	return consulResolverScheme
+}
+
+// fetchConsulInstances returns the addresses, in "host:port" form, of the
+// instances of the given service whose health checks are all passing.
+func fetchConsulInstances(baseURL, token string, target *consulTarget) ([]string, error) {
+	reqURL := baseURL + "/v1/health/service/" + url.PathEscape(target.service) + "?" + target.query.Encode()
+	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	client := &http.Client{Timeout: consulFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Consul agent: %w", err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Consul agent: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if msg := strings.TrimSpace(string(b)); msg != "" {
+			return nil, fmt.Errorf("agent returned %s: %s", resp.Status, msg)
+		}
+		return nil, fmt.Errorf("agent returned %s", resp.Status)
+	}
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("agent returned invalid response: %w", err)
+	}
+	var addrs []string
+	for _, entry := range entries {
+		// the service's address defaults to that of its node
+		host := entry.Service.Address
+		if host == "" {
+			host = entry.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)))
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no healthy instances of service %q", target.service)
+	}
+	return addrs, nil
+}
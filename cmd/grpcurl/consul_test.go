@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseConsulTarget(t *testing.T) {
+	testCases := map[string]*consulTarget{
+		"consul://payments": {service: "payments", query: url.Values{"passing": {"1"}}},
+		"consul://payments/?dc=dc1&tag=grpc&tag=v2": {service: "payments", query: url.Values{
+			"passing": {"1"},
+			"dc":      {"dc1"},
+			"tag":     {"grpc", "v2"},
+		}},
+		"consul://payments?near=_agent": {service: "payments", query: url.Values{"passing": {"1"}, "near": {"_agent"}}},
+	}
+	for target, expected := range testCases {
+		actual, err := parseConsulTarget(target)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", target, err)
+		} else if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %+v, got %+v", target, expected, actual)
+		}
+	}
+
+	for _, target := range []string{
+		"consul://",
+		"consul://payments/extra",
+		"consul://payments?dc=dc1&dc=dc2",
+		"consul://payments?passing=0",
+		"consul://token@payments",
+	} {
+		if _, err := parseConsulTarget(target); err == nil {
+			t.Errorf("expected error for %q", target)
+		}
+	}
+}
+
+func TestFetchConsulInstances(t *testing.T) {
+	var query url.Values
+	var token string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/payments" {
+			http.Error(w, "unknown service", http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		token = r.Header.Get("X-Consul-Token")
+		if query.Get("dc") == "empty" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8443}},
+			{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "2001:db8::2", "Port": 9443}}
+		]`))
+	}))
+	defer svr.Close()
+
+	target, err := parseConsulTarget("consul://payments?dc=dc1&tag=grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := fetchConsulInstances(svr.URL, "secret", target)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"10.0.0.1:8443", "[2001:db8::2]:9443"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("expected %v, got %v", expected, addrs)
+	}
+	expectedQuery := url.Values{"passing": {"1"}, "dc": {"dc1"}, "tag": {"grpc"}}
+	if !reflect.DeepEqual(query, expectedQuery) {
+		t.Errorf("expected query %v, got %v", expectedQuery, query)
+	}
+	if token != "secret" {
+		t.Errorf("expected token %q, got %q", "secret", token)
+	}
+
+	target, err = parseConsulTarget("consul://payments?dc=empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fetchConsulInstances(svr.URL, "", target); err == nil {
+		t.Error("expected error when there are no healthy instances")
+	}
+	if _, err := fetchConsulInstances(svr.URL, "", &consulTarget{service: "orders"}); err == nil {
+		t.Error("expected error for unknown service")
+	}
+}
+
+func TestConsulAgent(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_ADDR", "")
+	t.Setenv("CONSUL_HTTP_TOKEN", "")
+	if baseURL, token := consulAgent(); baseURL != "http://127.0.0.1:8500" || token != "" {
+		t.Errorf("unexpected defaults: %q, %q", baseURL, token)
+	}
+	t.Setenv("CONSUL_HTTP_ADDR", "https://consul.example.com:8501/")
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+	if baseURL, token := consulAgent(); baseURL != "https://consul.example.com:8501" || token != "secret" {
+		t.Errorf("unexpected agent: %q, %q", baseURL, token)
+	}
+}
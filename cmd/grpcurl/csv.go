@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/types/descriptorpb"
+	"gopkg.in/yaml.v3"
+)
+
+// csvMappingFile is the YAML file given via -csv-mapping. It maps the names
+// of CSV columns, from the header row, to fields of the request message. For
+// example:
+//
+//	columns:
+//	  Customer ID: customer.id
+//	  Email: customer.email
+//	  Quantity: quantity
+type csvMappingFile struct {
+	Columns map[string]string `yaml:"columns"`
+}
+
+// loadCSVMapping reads the column to field mapping in the given file.
+func loadCSVMapping(fileName string) (map[string]string, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var f csvMappingFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	if len(f.Columns) == 0 {
+		return nil, fmt.Errorf("%s: no columns are mapped", fileName)
+	}
+	return f.Columns, nil
+}
+
+// csvColumn is a column of CSV input and the field to which it is mapped.
+type csvColumn struct {
+	index int
+	// path is the field and, if it is nested, the message fields that
+	// contain it
+	path []*desc.FieldDescriptor
+}
+
+// resolveFieldPath resolves a dot-separated field path, like "customer.id",
+// for the given message. Field names may be proto or JSON names. All fields
+// except the last must be singular message fields.
+func resolveFieldPath(md *desc.MessageDescriptor, path string) ([]*desc.FieldDescriptor, error) {
+	var fields []*desc.FieldDescriptor
+	for i, name := range strings.Split(path, ".") {
+		if i > 0 {
+			prev := fields[i-1]
+			if prev.GetMessageType() == nil || prev.IsRepeated() {
+				return nil, fmt.Errorf("field path %q: %s is not a singular message field", path, prev.GetName())
+			}
+			md = prev.GetMessageType()
+		}
+		fd := md.FindFieldByName(name)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field path %q: message %s has no field named %q", path, md.GetFullyQualifiedName(), name)
+		}
+		fields = append(fields, fd)
+	}
+	return fields, nil
+}
+
+// csvRequests returns a reader of JSON request messages, one per row of the
+// given CSV input, for the given message type. The first row of the input is
+// a header, whose column names are mapped to fields via the given mapping.
+// Rows are converted as they are read, so requests can be streamed.
+func csvRequests(in io.ReadCloser, md *desc.MessageDescriptor, mapping map[string]string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(convertCSV(pw, in, md, mapping))
+	}()
+	return struct {
+		io.Reader
+		io.Closer
+	}{pr, multiCloser{pr, in}}
+}
+
+func convertCSV(out io.Writer, in io.Reader, md *desc.MessageDescriptor, mapping map[string]string) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	columns, err := csvColumns(header, md, mapping)
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		msg, err := csvRowMessage(row, columns)
+		if err != nil {
+			return fmt.Errorf("CSV line %d: %v", line, err)
+		}
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("CSV line %d: %v", line, err)
+		}
+		if _, err := out.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+}
+
+func csvColumns(header []string, md *desc.MessageDescriptor, mapping map[string]string) ([]csvColumn, error) {
+	indexes := map[string]int{}
+	for i, name := range header {
+		indexes[strings.TrimSpace(name)] = i
+	}
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var columns []csvColumn
+	for _, name := range names {
+		path := mapping[name]
+		i, ok := indexes[name]
+		if !ok {
+			return nil, fmt.Errorf("CSV header has no column named %q", name)
+		}
+		fields, err := resolveFieldPath(md, path)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, csvColumn{index: i, path: fields})
+	}
+	return columns, nil
+}
+
+// csvRowMessage returns the JSON form of the message for the given row. Empty
+// cells are omitted.
+func csvRowMessage(row []string, columns []csvColumn) (map[string]interface{}, error) {
+	msg := map[string]interface{}{}
+	for _, col := range columns {
+		if col.index >= len(row) || row[col.index] == "" {
+			continue
+		}
+		m := msg
+		for _, fd := range col.path[:len(col.path)-1] {
+			child, ok := m[fd.GetJSONName()].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				m[fd.GetJSONName()] = child
+			}
+			m = child
+		}
+		fd := col.path[len(col.path)-1]
+		v, err := csvValue(fd, row[col.index])
+		if err != nil {
+			return nil, err
+		}
+		m[fd.GetJSONName()] = v
+	}
+	return msg, nil
+}
+
+// csvValue converts a cell to the JSON value for the given field. Cells for
+// message, repeated, and map fields must contain JSON.
+func csvValue(fd *desc.FieldDescriptor, cell string) (interface{}, error) {
+	if fd.IsRepeated() || fd.GetMessageType() != nil {
+		if !json.Valid([]byte(cell)) {
+			return nil, fmt.Errorf("value for field %s must be JSON: %q", fd.GetName(), cell)
+		}
+		return json.RawMessage(cell), nil
+	}
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, fmt.Errorf("value for field %s must be a boolean: %q", fd.GetName(), cell)
+		}
+		return b, nil
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return cell, nil
+	default:
+		// numbers and enums; values that are not numbers, like enum value
+		// names and "NaN", are left as strings
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			return json.Number(cell), nil
+		}
+		return cell, nil
+	}
+}
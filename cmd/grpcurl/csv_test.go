@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestCSVRequests(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage(&grpcurl_testing.SimpleRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := map[string]string{
+		"size":    "response_size",
+		"user":    "fillUsername",
+		"type":    "response_type",
+		"code":    "response_status.code",
+		"message": "response_status.message",
+		"payload": "payload",
+	}
+	input := `size,user,type,code,message,payload,ignored
+3,true,COMPRESSABLE,5,"not, found","{""body"":""YWJj""}",x
+,false,,,,,
+`
+	r := csvRequests(io.NopCloser(strings.NewReader(input)), md, mapping)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to convert CSV: %v", err)
+	}
+	expected := `{"fillUsername":true,"payload":{"body":"YWJj"},"responseSize":3,"responseStatus":{"code":5,"message":"not, found"},"responseType":"COMPRESSABLE"}
+{"fillUsername":false}
+`
+	if string(b) != expected {
+		t.Errorf("wrong output:\nexpected: %s\ngot: %s", expected, b)
+	}
+}
+
+func TestCSVRequestsErrors(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage(&grpcurl_testing.SimpleRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		mapping map[string]string
+		input   string
+		errText string
+	}{
+		{"missing column", map[string]string{"a": "response_size"}, "b\n1\n", `no column named "a"`},
+		{"unknown field", map[string]string{"a": "foo"}, "a\n1\n", `has no field named "foo"`},
+		{"not a message", map[string]string{"a": "response_size.foo"}, "a\n1\n", "not a singular message field"},
+		{"bad bool", map[string]string{"a": "fill_username"}, "a\nyes\n", "line 2: value for field fill_username must be a boolean"},
+		{"bad JSON", map[string]string{"a": "payload"}, "a\n{\n", "must be JSON"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := csvRequests(io.NopCloser(strings.NewReader(tc.input)), md, tc.mapping)
+			defer r.Close()
+			_, err := io.ReadAll(r)
+			if err == nil || !strings.Contains(err.Error(), tc.errText) {
+				t.Errorf("expected error containing %q, got %v", tc.errText, err)
+			}
+		})
+	}
+}
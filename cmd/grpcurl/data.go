@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// openRequestData returns a reader for the request data given via -d, which
+// may be repeated. The values are concatenated, separated so that each one
+// starts a new message in the given format.
+func openRequestData(data []string, format grpcurl.Format) (io.ReadCloser, error) {
+	separator := "\n"
+	if format == grpcurl.FormatText {
+		separator = "\x1e"
+	}
+	var readers []io.Reader
+	var closers multiCloser
+	for i, d := range data {
+		r, err := openRequestDataValue(d)
+		if err != nil {
+			closers.Close()
+			return nil, err
+		}
+		if i > 0 {
+			readers = append(readers, strings.NewReader(separator))
+		}
+		readers = append(readers, r)
+		closers = append(closers, r)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), closers}, nil
+}
+
+// multiCloser closes all of its elements, returning the first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var err error
+	for _, c := range m {
+		if cErr := c.Close(); err == nil {
+			err = cErr
+		}
+	}
+	return err
+}
+
+// openRequestDataValue returns a reader for one value given via -d. Like
+// curl, a value of '@' or '@-' reads from stdin and '@' followed by a file
+// name reads from that file. Gzip-compressed input, such as a '.json.gz'
+// file, is transparently decompressed. Any other value is the data itself.
+func openRequestDataValue(data string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(data, "@") {
+		return io.NopCloser(strings.NewReader(data)), nil
+	}
+	var f io.ReadCloser
+	if data == "@" || data == "@-" {
+		f = io.NopCloser(os.Stdin)
+	} else {
+		var err error
+		if f, err = os.Open(data[1:]); err != nil {
+			return nil, err
+		}
+	}
+	r := bufio.NewReader(f)
+	if magic, err := r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return gzipReadCloser{gz, f}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// gzipReadCloser decompresses data and closes both the gzip reader and the
+// underlying file.
+type gzipReadCloser struct {
+	*gzip.Reader
+	f io.Closer
+}
+
+func (g gzipReadCloser) Close() error {
+	err := g.Reader.Close()
+	if fErr := g.f.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestOpenRequestData(t *testing.T) {
+	dir := t.TempDir()
+	const content = `{"name": "abc"}`
+	plainFile := filepath.Join(dir, "req.json")
+	if err := os.WriteFile(plainFile, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gzFile := filepath.Join(dir, "req.json.gz")
+	if err := os.WriteFile(gzFile, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{content, "@" + plainFile, "@" + gzFile} {
+		r, err := openRequestDataValue(data)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", data, err)
+		}
+		actual, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: failed to read: %v", data, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("%s: failed to close: %v", data, err)
+		}
+		if string(actual) != content {
+			t.Errorf("%s: expected %q, got %q", data, content, actual)
+		}
+	}
+
+	if _, err := openRequestData([]string{"{}", "@" + filepath.Join(dir, "missing.json")}, grpcurl.FormatJSON); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	testCases := []struct {
+		format   grpcurl.Format
+		data     []string
+		expected string
+	}{
+		{grpcurl.FormatJSON, []string{`{"a": 1}`, "@" + gzFile, `{"b": 2}`}, `{"a": 1}` + "\n" + content + "\n" + `{"b": 2}`},
+		{grpcurl.FormatText, []string{"a: 1", "b: 2"}, "a: 1\x1eb: 2"},
+	}
+	for _, tc := range testCases {
+		r, err := openRequestData(tc.data, tc.format)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.data, err)
+		}
+		actual, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%q: failed to read: %v", tc.data, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("%q: failed to close: %v", tc.data, err)
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.data, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// Categories of diagnostics that can be enabled via -debug.
+const (
+	debugTransport  = "transport"
+	debugReflection = "reflection"
+	debugFormat     = "format"
+	debugRetry      = "retry"
+)
+
+var allDebugCategories = []string{debugTransport, debugReflection, debugFormat, debugRetry}
+
+// debugEnabled holds the categories that were enabled via -debug.
+var debugEnabled = map[string]bool{}
+
+var debugOut io.Writer = os.Stderr
+
+// parseDebugCategories parses the comma-separated list of categories given
+// via -debug. The special category "all" enables all of them.
+func parseDebugCategories(list string) (map[string]bool, error) {
+	enabled := map[string]bool{}
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if c == "all" {
+			for _, c := range allDebugCategories {
+				enabled[c] = true
+			}
+			continue
+		}
+		known := false
+		for _, k := range allDebugCategories {
+			if c == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown debug category %q; valid categories are %s, and all", c, strings.Join(allDebugCategories, ", "))
+		}
+		enabled[c] = true
+	}
+	return enabled, nil
+}
+
+func debugf(category, msg string, args ...interface{}) {
+	if !debugEnabled[category] {
+		return
+	}
+	fmt.Fprintf(debugOut, "[%s] %s\n", category, fmt.Sprintf(msg, args...))
+}
+
+// enableTransportLogging routes the gRPC library's own logs, which describe
+// name resolution, connection state, and transport events, to stderr.
+func enableTransportLogging() {
+	grpclog.SetLoggerV2(grpclog.NewLoggerV2WithVerbosity(debugOut, io.Discard, debugOut, 2))
+}
+
+// grpcTraceVerbosity is the verbosity of the gRPC library's logs for
+// -grpc-go-trace. The library logs at levels up to 2, so this includes all of
+// them, even if later versions add more.
+const grpcTraceVerbosity = 99
+
+// enableGRPCTrace routes all of the gRPC library's logs, at every severity and
+// verbosity, to the given destination, for -grpc-go-trace. This is the same as
+// setting GRPC_GO_LOG_SEVERITY_LEVEL=info and GRPC_GO_LOG_VERBOSITY_LEVEL=99,
+// but only for this invocation. The destination is a file name, or "-" or
+// "stderr" for stderr. The file is appended to if it exists.
+func enableGRPCTrace(dest string) error {
+	var w io.Writer = os.Stderr
+	if dest != "-" && dest != "stderr" {
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+	grpclog.SetLoggerV2(grpclog.NewLoggerV2WithVerbosity(w, w, w, grpcTraceVerbosity))
+	return nil
+}
+
+// debugDescriptorSource logs each request made to the underlying source,
+// which is expected to be backed by server reflection.
+type debugDescriptorSource struct {
+	grpcurl.DescriptorSource
+}
+
+func (s debugDescriptorSource) ListServices() ([]string, error) {
+	start := time.Now()
+	svcs, err := s.DescriptorSource.ListServices()
+	if err != nil {
+		debugf(debugReflection, "ListServices failed after %v: %v", time.Since(start), err)
+	} else {
+		debugf(debugReflection, "ListServices returned %d service(s) in %v", len(svcs), time.Since(start))
+	}
+	return svcs, err
+}
+
+func (s debugDescriptorSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	start := time.Now()
+	d, err := s.DescriptorSource.FindSymbol(fullyQualifiedName)
+	if err != nil {
+		debugf(debugReflection, "FindSymbol %s failed after %v: %v", fullyQualifiedName, time.Since(start), err)
+	} else {
+		debugf(debugReflection, "FindSymbol %s found in %s in %v", fullyQualifiedName, d.GetFile().GetName(), time.Since(start))
+	}
+	return d, err
+}
+
+func (s debugDescriptorSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	start := time.Now()
+	exts, err := s.DescriptorSource.AllExtensionsForType(typeName)
+	if err != nil {
+		debugf(debugReflection, "AllExtensionsForType %s failed after %v: %v", typeName, time.Since(start), err)
+	} else {
+		debugf(debugReflection, "AllExtensionsForType %s returned %d extension(s) in %v", typeName, len(exts), time.Since(start))
+	}
+	return exts, err
+}
+
+// debugRequestParser logs each request message that is parsed.
+type debugRequestParser struct {
+	grpcurl.RequestParser
+}
+
+func (p debugRequestParser) Next(m proto.Message) error {
+	err := p.RequestParser.Next(m)
+	n := p.RequestParser.NumRequests()
+	if err == io.EOF {
+		debugf(debugFormat, "End of request data after %d message(s)", n)
+	} else if err != nil {
+		debugf(debugFormat, "Failed to parse request #%d: %v", n, err)
+	} else {
+		debugf(debugFormat, "Parsed request #%d as %s (%d bytes encoded)", n, proto.MessageName(m), proto.Size(m))
+	}
+	return err
+}
+
+// debugFormatter logs each message that is formatted.
+func debugFormatter(formatter grpcurl.Formatter) grpcurl.Formatter {
+	return func(m proto.Message) (string, error) {
+		start := time.Now()
+		str, err := formatter(m)
+		if err != nil {
+			debugf(debugFormat, "Failed to format %s: %v", proto.MessageName(m), err)
+		} else {
+			debugf(debugFormat, "Formatted %s (%d bytes encoded) in %v", proto.MessageName(m), proto.Size(m), time.Since(start))
+		}
+		return str, err
+	}
+}
+
+// retryMetadataKeys are headers and trailers that relate to retries.
+// Besides gRPC's own, this includes "retry-after", which some servers and
+// proxies use to advertise throttling.
+var retryMetadataKeys = []string{"grpc-previous-rpc-attempts", "grpc-retry-pushback-ms", "retry-after"}
+
+// debugRetryHandler logs retry-related metadata and the final status of an
+// RPC, to help diagnose retry behavior.
+type debugRetryHandler struct {
+	grpcurl.InvocationEventHandler
+}
+
+func (h debugRetryHandler) OnReceiveHeaders(md metadata.MD) {
+	logRetryMetadata("headers", md)
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h debugRetryHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	logRetryMetadata("trailers", md)
+	debugf(debugRetry, "Final status: %s", stat.Code())
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+func logRetryMetadata(kind string, md metadata.MD) {
+	var found []string
+	for _, k := range retryMetadataKeys {
+		for _, v := range md.Get(k) {
+			found = append(found, k+": "+v)
+		}
+	}
+	sort.Strings(found)
+	if len(found) == 0 {
+		debugf(debugRetry, "No retry metadata in response %s", kind)
+		return
+	}
+	for _, f := range found {
+		debugf(debugRetry, "Response %s include %s", kind, f)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/grpclog"
+)
+
+func TestParseDebugCategories(t *testing.T) {
+	testCases := []struct {
+		list     string
+		expected map[string]bool
+	}{
+		{"", map[string]bool{}},
+		{"transport", map[string]bool{debugTransport: true}},
+		{" Reflection , format,", map[string]bool{debugReflection: true, debugFormat: true}},
+		{"all", map[string]bool{debugTransport: true, debugReflection: true, debugFormat: true, debugRetry: true}},
+	}
+	for _, tc := range testCases {
+		actual, err := parseDebugCategories(tc.list)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.list, err)
+		} else if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%q: expected %v, got %v", tc.list, tc.expected, actual)
+		}
+	}
+
+	if _, err := parseDebugCategories("transport,bogus"); err == nil {
+		t.Error("expected error for unknown category")
+	}
+}
+
+func TestEnableGRPCTrace(t *testing.T) {
+	defer grpclog.SetLoggerV2(grpclog.NewLoggerV2(io.Discard, io.Discard, io.Discard))
+	fileName := filepath.Join(t.TempDir(), "trace.log")
+	if err := enableGRPCTrace(fileName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grpclog.Info("info message")
+	if grpclog.V(2) {
+		grpclog.Info("verbose message")
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"info message", "verbose message"} {
+		if !strings.Contains(string(b), msg) {
+			t.Errorf("expected trace to contain %q, got %q", msg, b)
+		}
+	}
+
+	if err := enableGRPCTrace(filepath.Join(t.TempDir(), "missing", "trace.log")); err == nil {
+		t.Error("expected error for file in missing directory")
+	}
+}
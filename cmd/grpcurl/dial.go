@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/alts"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// dialer dials the server given on the command line, with the resolver,
+// credentials, and other options that main validated and set up.
+type dialer struct {
+	target     string
+	parsedAddr *grpcurl.Target
+	// local is the transport for a server on the same machine, if any
+	local          *localTransport
+	sshTun         *sshTunnel
+	dnsResolver    *dnsResolverBuilder
+	consulResolver *consulResolverBuilder
+	serviceConfig  string
+	rpcPathPrefix  string
+
+	usetls, forcePlaintext       bool
+	minTLSVersion, maxTLSVersion uint16
+	cipherSuites                 []uint16
+	pins                         [][]byte
+
+	tracer         *otelTracer
+	events         *eventLog
+	rootTiming     *timingData
+	verbosityLevel int
+	// certVerb and supportBundle are set for the 'cert' and 'support-bundle'
+	// verbs, which report the certificates and handshake themselves
+	certVerb, supportBundle bool
+
+	// handshake and certs record the TLS handshake and the server's
+	// certificates, when they are reported; they are set by dial
+	handshake *handshakeRecorder
+	certs     *certRecorder
+}
+
+// dial connects to the server, waiting for the connection to be ready or for
+// -connect-timeout to elapse.
+func (d *dialer) dial(ctx context.Context) (*grpc.ClientConn, error) {
+	dialTiming := d.rootTiming.Child("Dial")
+	defer dialTiming.Done()
+	dialTime := 10 * time.Second
+	if *connectTimeout > 0 {
+		dialTime = floatSecondsToDuration(*connectTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTime)
+	defer cancel()
+	var opts []grpc.DialOption
+	if *keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepaliveParams(*keepaliveTime, *keepaliveTimeout, *keepalivePermitWithoutStream)))
+	}
+	if *maxMsgSz > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(*maxMsgSz)))
+	}
+	dialTarget := d.target
+	if *resolverExec != "" {
+		opts = append(opts, grpc.WithResolvers(&execResolverBuilder{cmdLine: *resolverExec}))
+		dialTarget = execResolverScheme + ":///" + d.target
+	} else if d.dnsResolver != nil {
+		opts = append(opts, grpc.WithResolvers(d.dnsResolver))
+		dialTarget = dnsResolverScheme + ":///" + d.target
+		if strings.HasPrefix(d.target, srvScheme) && *authority == "" && *serverName == "" {
+			// the service's name names the server, for its certificate
+			opts = append(opts, grpc.WithAuthority(srvAuthority(d.target)))
+		} else if isMultiAddressTarget(d.target) && *authority == "" && *serverName == "" {
+			// the first address names the server, for its certificate
+			opts = append(opts, grpc.WithAuthority(strings.SplitN(d.target, ",", 2)[0]))
+		}
+	} else if d.consulResolver != nil {
+		// the service's name is the default authority
+		opts = append(opts, grpc.WithResolvers(d.consulResolver))
+		dialTarget = consulResolverScheme + ":///" + d.consulResolver.target.service
+	} else if d.local != nil {
+		dialTarget = d.local.dialTarget
+		if d.local.dialer != nil {
+			opts = append(opts, grpc.WithContextDialer(d.local.dialer))
+			if *authority == "" {
+				// as for Unix domain sockets, the pipe's name is not a
+				// valid authority
+				opts = append(opts, grpc.WithAuthority("localhost"))
+			}
+		}
+	}
+	if d.serviceConfig != "" {
+		opts = append(opts, grpc.WithDefaultServiceConfig(d.serviceConfig))
+	}
+	if *noProxy {
+		opts = append(opts, grpc.WithNoProxy())
+	}
+	if d.sshTun != nil {
+		opts = append(opts, grpc.WithContextDialer(d.sshTun.dial))
+	}
+	if d.verbosityLevel > 0 && (*lbPolicy != "" || isMultiAddressTarget(d.target) ||
+		strings.HasPrefix(d.target, srvScheme) || d.consulResolver != nil) {
+		opts = append(opts, grpc.WithStatsHandler(&backendLogger{out: os.Stdout}))
+	}
+	if d.verbosityLevel > 0 {
+		opts = append(opts, grpc.WithStatsHandler(&retryLogger{out: os.Stdout}))
+	}
+	if d.tracer != nil {
+		opts = append(opts, grpc.WithStatsHandler(d.tracer.statsHandler()))
+	}
+	if d.rpcPathPrefix != "" {
+		opts = append(opts, withPathPrefix(d.rpcPathPrefix)...)
+	}
+	var creds credentials.TransportCredentials
+	if d.forcePlaintext {
+		if *authority != "" {
+			opts = append(opts, grpc.WithAuthority(*authority))
+		}
+	} else if *usealts {
+		clientOptions := alts.DefaultClientOptions()
+		if len(altsTargetServiceAccounts) > 0 {
+			clientOptions.TargetServiceAccounts = altsTargetServiceAccounts
+		}
+		if *altsHandshakerServiceAddress != "" {
+			clientOptions.HandshakerServiceAddress = *altsHandshakerServiceAddress
+		}
+		creds = alts.NewClientCreds(clientOptions)
+	} else if d.usetls {
+		tlsTiming := dialTiming.Child("TLS Setup")
+		defer tlsTiming.Done()
+
+		certFile, keyFile := *cert, *key
+		if *keyProvider != "" {
+			// the certificate is loaded along with the key, below
+			certFile = ""
+		}
+		tlsConf, err := grpcurl.ClientTLSConfig(*insecure, *cacert, certFile, keyFile)
+		if err != nil {
+			fail(err, "Failed to create TLS config")
+		}
+		if *keyProvider != "" {
+			clientCert, err := loadPKCS11Key(*keyProvider, *cert)
+			if err != nil {
+				fail(err, "Failed to load client key from -key-provider")
+			}
+			tlsConf.Certificates = []tls.Certificate{clientCert}
+		}
+		tlsConf.MinVersion = d.minTLSVersion
+		tlsConf.MaxVersion = d.maxTLSVersion
+		tlsConf.CipherSuites = d.cipherSuites
+
+		if *tofu {
+			hosts := &knownHosts{fileName: *knownHostsFile}
+			if hosts.fileName == "" {
+				if hosts.fileName, err = defaultKnownHostsFile(); err != nil {
+					fail(err, "Failed to locate known hosts file")
+				}
+			}
+			hosts.onAdd = func(host, fingerprint string) {
+				warn("Trusting certificate of %s on first use; recorded fingerprint %s in %s.", host, fingerprint, hosts.fileName)
+			}
+			// the certificate chain is not verified; only the fingerprint
+			tlsConf.InsecureSkipVerify = true
+			tlsConf.VerifyConnection = hosts.verifyConnection(d.target)
+		}
+		if len(d.pins) > 0 {
+			// the certificate chain is not verified; only the key
+			tlsConf.InsecureSkipVerify = true
+			tlsConf.VerifyConnection = verifyPinnedCert(d.pins)
+		}
+
+		// For proxy scenarios, ensure TLS ServerName is just the hostname
+		if d.parsedAddr != nil && d.parsedAddr.IsURL && d.parsedAddr.Path != "" && d.parsedAddr.Path != "/" {
+			// Set TLS ServerName to just the hostname for certificate verification
+			tlsConf.ServerName = d.parsedAddr.Host
+		}
+
+		if *showCert || d.certVerb {
+			d.certs = &certRecorder{}
+			d.certs.recordVerified(tlsConf)
+		}
+
+		sslKeylogFile := os.Getenv("SSLKEYLOGFILE")
+		if sslKeylogFile != "" {
+			w, err := os.OpenFile(sslKeylogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				fail(err, "Could not open SSLKEYLOGFILE %s", sslKeylogFile)
+			}
+			tlsConf.KeyLogWriter = w
+		}
+
+		creds = credentials.NewTLS(tlsConf)
+
+		// can use either -servername or -authority; but not both
+		if *serverName != "" && *authority != "" {
+			if *serverName == *authority {
+				warn("Both -servername and -authority are present; prefer only -authority.")
+			} else {
+				fail(nil, "Cannot specify different values for -servername and -authority.")
+			}
+		}
+		overrideName := *serverName
+		if overrideName == "" {
+			overrideName = *authority
+		}
+
+		if overrideName != "" {
+			opts = append(opts, grpc.WithAuthority(overrideName))
+		}
+		tlsTiming.Done()
+	} else {
+		panic("Should have defaulted to use TLS.")
+	}
+
+	grpcurlUA := "grpcurl/" + version
+	if version == noVersion {
+		grpcurlUA = "grpcurl/dev-build (no version set)"
+	}
+	if *userAgent != "" {
+		grpcurlUA = *userAgent + " " + grpcurlUA
+	}
+	opts = append(opts, grpc.WithUserAgent(grpcurlUA))
+
+	if (*handshakeOnly || d.supportBundle || d.verbosityLevel > 0) && creds != nil {
+		d.handshake = &handshakeRecorder{TransportCredentials: creds}
+		creds = d.handshake
+	}
+	if d.certs != nil {
+		d.certs.TransportCredentials = creds
+		creds = d.certs
+	}
+
+	blockingDialTiming := dialTiming.Child("BlockingDial")
+	defer blockingDialTiming.Done()
+	security := "plain-text"
+	if creds != nil {
+		security = creds.Info().SecurityProtocol
+	}
+	debugf(debugTransport, "Dialing %s using %s", d.target, security)
+	if *traceHTTP2 {
+		creds = newHTTP2Tracer(creds, os.Stderr)
+	}
+	dialStart := time.Now()
+	cc, err := grpcurl.BlockingDial(ctx, "", dialTarget, creds, opts...)
+	d.events.dial(d.target, time.Since(dialStart), err)
+	d.tracer.dialed(dialStart, err)
+	if *showCert && !d.certVerb && d.certs != nil {
+		if chain := d.certs.certificates(); err == nil || len(chain) > 0 {
+			printCertChain(os.Stderr, chain)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	debugf(debugTransport, "Connected to %s in %v", d.target, time.Since(dialStart))
+	if d.handshake != nil && d.verbosityLevel > 0 && !*handshakeOnly && !d.supportBundle {
+		printNegotiatedTLS(os.Stdout, d.handshake)
+	}
+	if d.handshake != nil {
+		d.handshake.addTiming(blockingDialTiming)
+	}
+	return cc, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// runDiff prints the differences between the schema in the given source and
+// that in the given protoset file, for the 'diff' verb. It exits with
+// diffFoundExitCode if there are any.
+func runDiff(descSource grpcurl.DescriptorSource, protosetFile string) {
+	otherSource, err := grpcurl.DescriptorSourceFromProtoSets(protosetFile)
+	if err != nil {
+		fail(err, "Failed to process proto descriptor set %s", protosetFile)
+	}
+	oldSchema, err := collectSchema(descSource)
+	if err != nil {
+		fail(err, "Failed to collect services")
+	}
+	newSchema, err := collectSchema(otherSource)
+	if err != nil {
+		fail(err, "Failed to collect services from %s", protosetFile)
+	}
+	lines := diffSchemas(oldSchema, newSchema)
+	if len(lines) == 0 {
+		fmt.Println("(No differences)")
+	} else {
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		exit(diffFoundExitCode)
+	}
+}
+
+// schemaElements are the services in a descriptor source along with all
+// message and enum types reachable from them, keyed by fully-qualified name.
+type schemaElements struct {
+	services map[string]*desc.ServiceDescriptor
+	messages map[string]*desc.MessageDescriptor
+	enums    map[string]*desc.EnumDescriptor
+}
+
+func collectSchema(source grpcurl.DescriptorSource) (*schemaElements, error) {
+	svcs, err := listAPIServices(source)
+	if err != nil {
+		return nil, err
+	}
+	s := &schemaElements{
+		services: map[string]*desc.ServiceDescriptor{},
+		messages: map[string]*desc.MessageDescriptor{},
+		enums:    map[string]*desc.EnumDescriptor{},
+	}
+	for _, svc := range svcs {
+		d, err := source.FindSymbol(svc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve service %q: %v", svc, err)
+		}
+		sd, ok := d.(*desc.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a service", svc)
+		}
+		s.services[svc] = sd
+		for _, mtd := range sd.GetMethods() {
+			s.addMessage(mtd.GetInputType())
+			s.addMessage(mtd.GetOutputType())
+		}
+	}
+	return s, nil
+}
+
+func (s *schemaElements) addMessage(md *desc.MessageDescriptor) {
+	if _, ok := s.messages[md.GetFullyQualifiedName()]; ok {
+		return
+	}
+	if !md.IsMapEntry() {
+		// map entries are described by the types of map fields
+		s.messages[md.GetFullyQualifiedName()] = md
+	}
+	for _, fld := range md.GetFields() {
+		if fmd := fld.GetMessageType(); fmd != nil {
+			s.addMessage(fmd)
+		} else if ed := fld.GetEnumType(); ed != nil {
+			s.enums[ed.GetFullyQualifiedName()] = ed
+		}
+	}
+}
+
+// diffSchemas describes the differences between the two given schemas as
+// lines of text. Lines start with "+" for elements only in newSchema, "-" for
+// elements only in oldSchema, and "~" for elements that were changed.
+func diffSchemas(oldSchema, newSchema *schemaElements) []string {
+	var d schemaDiff
+
+	for _, name := range unionKeys(oldSchema.services, newSchema.services) {
+		oldSvc, newSvc := oldSchema.services[name], newSchema.services[name]
+		if !d.addedOrRemoved("service", name, oldSvc != nil, newSvc != nil) {
+			d.diffService(oldSvc, newSvc)
+		}
+	}
+	for _, name := range unionKeys(oldSchema.messages, newSchema.messages) {
+		oldMsg, newMsg := oldSchema.messages[name], newSchema.messages[name]
+		if !d.addedOrRemoved("message", name, oldMsg != nil, newMsg != nil) {
+			d.diffMessage(oldMsg, newMsg)
+		}
+	}
+	for _, name := range unionKeys(oldSchema.enums, newSchema.enums) {
+		oldEnum, newEnum := oldSchema.enums[name], newSchema.enums[name]
+		if !d.addedOrRemoved("enum", name, oldEnum != nil, newEnum != nil) {
+			d.diffEnum(oldEnum, newEnum)
+		}
+	}
+	return d.lines
+}
+
+type schemaDiff struct {
+	lines []string
+}
+
+// addedOrRemoved records an element that is present in only one schema. It
+// returns false if the element is present in both.
+func (d *schemaDiff) addedOrRemoved(kind, name string, inOld, inNew bool) bool {
+	switch {
+	case inOld && inNew:
+		return false
+	case inNew:
+		d.lines = append(d.lines, fmt.Sprintf("+ %s %s", kind, name))
+	default:
+		d.lines = append(d.lines, fmt.Sprintf("- %s %s", kind, name))
+	}
+	return true
+}
+
+func (d *schemaDiff) changed(kind, name, what, oldVal, newVal string) {
+	if oldVal != newVal {
+		d.lines = append(d.lines, fmt.Sprintf("~ %s %s: %s changed from %s to %s", kind, name, what, oldVal, newVal))
+	}
+}
+
+func (d *schemaDiff) diffService(oldSvc, newSvc *desc.ServiceDescriptor) {
+	oldMethods := map[string]*desc.MethodDescriptor{}
+	for _, mtd := range oldSvc.GetMethods() {
+		oldMethods[mtd.GetName()] = mtd
+	}
+	newMethods := map[string]*desc.MethodDescriptor{}
+	for _, mtd := range newSvc.GetMethods() {
+		newMethods[mtd.GetName()] = mtd
+	}
+	for _, name := range unionKeys(oldMethods, newMethods) {
+		oldMtd, newMtd := oldMethods[name], newMethods[name]
+		fullName := oldSvc.GetFullyQualifiedName() + "/" + name
+		if d.addedOrRemoved("method", fullName, oldMtd != nil, newMtd != nil) {
+			continue
+		}
+		d.changed("method", fullName, "request type", methodTypeString(oldMtd.GetInputType(), oldMtd.IsClientStreaming()), methodTypeString(newMtd.GetInputType(), newMtd.IsClientStreaming()))
+		d.changed("method", fullName, "response type", methodTypeString(oldMtd.GetOutputType(), oldMtd.IsServerStreaming()), methodTypeString(newMtd.GetOutputType(), newMtd.IsServerStreaming()))
+	}
+}
+
+func (d *schemaDiff) diffMessage(oldMsg, newMsg *desc.MessageDescriptor) {
+	oldFields := map[string]*desc.FieldDescriptor{}
+	for _, fld := range oldMsg.GetFields() {
+		oldFields[fld.GetName()] = fld
+	}
+	newFields := map[string]*desc.FieldDescriptor{}
+	for _, fld := range newMsg.GetFields() {
+		newFields[fld.GetName()] = fld
+	}
+	for _, name := range unionKeys(oldFields, newFields) {
+		oldFld, newFld := oldFields[name], newFields[name]
+		fullName := oldMsg.GetFullyQualifiedName() + "." + name
+		if d.addedOrRemoved("field", fullName, oldFld != nil, newFld != nil) {
+			continue
+		}
+		d.changed("field", fullName, "number", fmt.Sprint(oldFld.GetNumber()), fmt.Sprint(newFld.GetNumber()))
+		d.changed("field", fullName, "type", fieldTypeString(oldFld), fieldTypeString(newFld))
+	}
+}
+
+func (d *schemaDiff) diffEnum(oldEnum, newEnum *desc.EnumDescriptor) {
+	oldValues := map[string]*desc.EnumValueDescriptor{}
+	for _, v := range oldEnum.GetValues() {
+		oldValues[v.GetName()] = v
+	}
+	newValues := map[string]*desc.EnumValueDescriptor{}
+	for _, v := range newEnum.GetValues() {
+		newValues[v.GetName()] = v
+	}
+	for _, name := range unionKeys(oldValues, newValues) {
+		oldVal, newVal := oldValues[name], newValues[name]
+		fullName := oldEnum.GetFullyQualifiedName() + "." + name
+		if d.addedOrRemoved("enum value", fullName, oldVal != nil, newVal != nil) {
+			continue
+		}
+		d.changed("enum value", fullName, "number", fmt.Sprint(oldVal.GetNumber()), fmt.Sprint(newVal.GetNumber()))
+	}
+}
+
+func methodTypeString(md *desc.MessageDescriptor, streaming bool) string {
+	if streaming {
+		return "stream " + md.GetFullyQualifiedName()
+	}
+	return md.GetFullyQualifiedName()
+}
+
+// fieldTypeString describes the type of a field in proto syntax, such as
+// "repeated string" or "map<string, foo.Bar>".
+func fieldTypeString(fld *desc.FieldDescriptor) string {
+	if fld.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldTypeString(fld.GetMapKeyType()), fieldTypeString(fld.GetMapValueType()))
+	}
+	var typeName string
+	if md := fld.GetMessageType(); md != nil {
+		typeName = md.GetFullyQualifiedName()
+	} else if ed := fld.GetEnumType(); ed != nil {
+		typeName = ed.GetFullyQualifiedName()
+	} else {
+		typeName = strings.ToLower(strings.TrimPrefix(fld.GetType().String(), "TYPE_"))
+	}
+	if fld.IsRepeated() {
+		return "repeated " + typeName
+	}
+	return typeName
+}
+
+func unionKeys[T any](a, b map[string]T) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	oldSchema := parseSchema(t, `
+		syntax = "proto3";
+		package foo;
+		service Svc {
+		  rpc Get(Req) returns (Resp);
+		  rpc Watch(Req) returns (stream Resp);
+		  rpc Delete(Req) returns (Resp);
+		}
+		message Req {
+		  string id = 1;
+		  int32 limit = 2;
+		  map<string, string> labels = 3;
+		}
+		message Resp {
+		  Kind kind = 1;
+		}
+		enum Kind {
+		  UNKNOWN = 0;
+		  A = 1;
+		  B = 2;
+		}`)
+	newSchema := parseSchema(t, `
+		syntax = "proto3";
+		package foo;
+		service Svc {
+		  rpc Get(Req) returns (Resp);
+		  rpc Watch(Req) returns (Resp);
+		  rpc Create(Req) returns (Resp);
+		}
+		message Req {
+		  string id = 1;
+		  int64 limit = 2;
+		  map<string, string> labels = 3;
+		  bool dry_run = 4;
+		}
+		message Resp {
+		  Kind kind = 1;
+		}
+		enum Kind {
+		  UNKNOWN = 0;
+		  A = 1;
+		  C = 3;
+		}`)
+
+	expected := []string{
+		"+ method foo.Svc/Create",
+		"- method foo.Svc/Delete",
+		"~ method foo.Svc/Watch: response type changed from stream foo.Resp to foo.Resp",
+		"+ field foo.Req.dry_run",
+		"~ field foo.Req.limit: type changed from int32 to int64",
+		"- enum value foo.Kind.B",
+		"+ enum value foo.Kind.C",
+	}
+	if actual := diffSchemas(oldSchema, newSchema); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong diff:\nexpected: %q\ngot: %q", expected, actual)
+	}
+	if actual := diffSchemas(oldSchema, oldSchema); len(actual) != 0 {
+		t.Errorf("expected no differences, got %q", actual)
+	}
+}
+
+func parseSchema(t *testing.T, source string) *schemaElements {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"test.proto": source}),
+	}
+	fds, err := p.ParseFiles("test.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	descSource, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	schema, err := collectSchema(descSource)
+	if err != nil {
+		t.Fatalf("failed to collect schema: %v", err)
+	}
+	return schema
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// dnsResolverScheme is the scheme of targets that are resolved using the
+// settings given via -dns-server, -dns-timeout, and -resolve.
+const dnsResolverScheme = "grpcurl-dns"
+
+// defaultDNSPort is the port of a -dns-server that has no port.
+const defaultDNSPort = "53"
+
+// srvScheme is the prefix of targets, like
+// 'srv://_grpc._tcp.service.example.com', whose addresses are published via
+// DNS SRV records.
+const srvScheme = "srv://"
+
+// dnsResolverBuilder builds resolvers that look up targets using a particular
+// DNS server, with a timeout, or that map them to pinned addresses. A target
+// may also be a comma-separated list of addresses, whose results are combined,
+// or an 'srv://' target.
+type dnsResolverBuilder struct {
+	// server is the DNS server, in "host:port" form, or empty to use the
+	// system's resolver configuration
+	server  string
+	timeout time.Duration
+	// pinned maps targets, in "host:port" form, to addresses, from -resolve
+	pinned map[string][]string
+}
+
+func (b *dnsResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	var state resolver.State
+	for _, t := range strings.Split(target.Endpoint(), ",") {
+		var addrs []string
+		var err error
+		if strings.HasPrefix(t, srvScheme) {
+			addrs, err = b.resolveSRV(strings.TrimPrefix(t, srvScheme))
+		} else {
+			addrs, err = b.resolve(t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+		}
+	}
+	if err := cc.UpdateState(state); err != nil {
+		return nil, err
+	}
+	return execResolver{}, nil
+}
+
+func (b *dnsResolverBuilder) Scheme() string {
+	return dnsResolverScheme
+}
+
+// resolve returns the addresses, in "host:port" form, for the given target.
+func (b *dnsResolverBuilder) resolve(target string) ([]string, error) {
+	if addrs, ok := b.pinned[target]; ok {
+		return addrs, nil
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return []string{target}, nil
+	}
+	r, ctx, cancel := b.netResolver()
+	defer cancel()
+	ips, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip, port)
+	}
+	return addrs, nil
+}
+
+// resolveSRV returns the addresses, in "host:port" form, of the targets of the
+// SRV records with the given name, in order of priority and, within each
+// priority, randomized by weight.
+func (b *dnsResolverBuilder) resolveSRV(name string) ([]string, error) {
+	r, ctx, cancel := b.netResolver()
+	_, srvs, err := r.LookupSRV(ctx, "", "", name)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, srv := range srvs {
+		target := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port)))
+		srvAddrs, err := b.resolve(target)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, srvAddrs...)
+	}
+	return addrs, nil
+}
+
+// netResolver returns a resolver that uses the DNS server, if any, and a
+// context with the timeout, if any.
+func (b *dnsResolverBuilder) netResolver() (*net.Resolver, context.Context, context.CancelFunc) {
+	r := &net.Resolver{PreferGo: true}
+	if b.server != "" {
+		r.Dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, b.server)
+		}
+	}
+	if b.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		return r, ctx, cancel
+	}
+	return r, context.Background(), func() {}
+}
+
+// srvAuthority returns the authority for an 'srv://' target, which is the
+// name of the service without the '_service._proto.' labels, like
+// 'service.example.com' for 'srv://_grpc._tcp.service.example.com'.
+func srvAuthority(target string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(target, srvScheme), ".")
+	labels := strings.Split(name, ".")
+	for len(labels) > 1 && strings.HasPrefix(labels[0], "_") {
+		labels = labels[1:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// parseDNSServer returns the given -dns-server in "host:port" form.
+func parseDNSServer(server string) (string, error) {
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server, nil
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(server, "["), "]")
+	if host == "" || strings.ContainsAny(host, "[]") {
+		return "", fmt.Errorf("invalid DNS server %q", server)
+	}
+	return net.JoinHostPort(host, defaultDNSPort), nil
+}
+
+// parseResolveEntries parses -resolve values, which are in curl's
+// 'host:port:addr[,addr]...' form, into a map of targets to addresses.
+// IPv6 addresses may be in brackets.
+func parseResolveEntries(entries []string) (map[string][]string, error) {
+	pinned := map[string][]string{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("%q should be in 'host:port:addr' form", entry)
+		}
+		host, port := parts[0], parts[1]
+		target := net.JoinHostPort(host, port)
+		for _, addr := range strings.Split(parts[2], ",") {
+			ip := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("%q: %q is not an IP address", entry, addr)
+			}
+			pinned[target] = append(pinned[target], net.JoinHostPort(ip, port))
+		}
+	}
+	return pinned, nil
+}
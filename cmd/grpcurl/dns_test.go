@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestParseResolveEntries(t *testing.T) {
+	pinned, err := parseResolveEntries([]string{
+		"api.example.com:443:10.0.0.1",
+		"api.example.com:8443:10.0.0.2,[2001:db8::1]",
+		"api.example.com:443:10.0.0.3",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string][]string{
+		"api.example.com:443":  {"10.0.0.1:443", "10.0.0.3:443"},
+		"api.example.com:8443": {"10.0.0.2:8443", "[2001:db8::1]:8443"},
+	}
+	if !reflect.DeepEqual(pinned, expected) {
+		t.Errorf("expected %v, got %v", expected, pinned)
+	}
+
+	for _, entry := range []string{"api.example.com", "api.example.com:443", "api.example.com:443:", ":443:10.0.0.1", "api.example.com:443:not-an-ip"} {
+		if _, err := parseResolveEntries([]string{entry}); err == nil {
+			t.Errorf("expected error for %q", entry)
+		}
+	}
+}
+
+func TestParseDNSServer(t *testing.T) {
+	testCases := map[string]string{
+		"10.0.0.2":         "10.0.0.2:53",
+		"10.0.0.2:5353":    "10.0.0.2:5353",
+		"dns.example.com":  "dns.example.com:53",
+		"[2001:db8::53]":   "[2001:db8::53]:53",
+		"[2001:db8::53]:5": "[2001:db8::53]:5",
+		"2001:db8::53":     "[2001:db8::53]:53",
+	}
+	for server, expected := range testCases {
+		actual, err := parseDNSServer(server)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", server, err)
+		} else if actual != expected {
+			t.Errorf("%q: expected %q, got %q", server, expected, actual)
+		}
+	}
+	if _, err := parseDNSServer(""); err == nil {
+		t.Error("expected error for empty server")
+	}
+}
+
+func TestDNSResolverBuilderResolve(t *testing.T) {
+	b := &dnsResolverBuilder{
+		// an unreachable server, which should not be consulted
+		server: "127.0.0.1:1",
+		pinned: map[string][]string{"api.example.com:443": {"10.0.0.1:443"}},
+	}
+	testCases := map[string][]string{
+		"api.example.com:443": {"10.0.0.1:443"},
+		"10.1.2.3:8080":       {"10.1.2.3:8080"},
+		"[::1]:8080":          {"[::1]:8080"},
+	}
+	for target, expected := range testCases {
+		actual, err := b.resolve(target)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", target, err)
+		} else if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%q: expected %v, got %v", target, expected, actual)
+		}
+	}
+}
+
+type stateRecorder struct {
+	resolver.ClientConn
+	state resolver.State
+}
+
+func (r *stateRecorder) UpdateState(state resolver.State) error {
+	r.state = state
+	return nil
+}
+
+func TestDNSResolverBuilderMultipleAddresses(t *testing.T) {
+	b := &dnsResolverBuilder{
+		pinned: map[string][]string{"api.example.com:443": {"10.0.0.1:443", "10.0.0.2:443"}},
+	}
+	var cc stateRecorder
+	target := resolver.Target{URL: url.URL{Scheme: dnsResolverScheme, Path: "/api.example.com:443,10.0.0.3:443"}}
+	if _, err := b.Build(target, &cc, resolver.BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var addrs []string
+	for _, addr := range cc.state.Addresses {
+		addrs = append(addrs, addr.Addr)
+	}
+	expected := []string{"10.0.0.1:443", "10.0.0.2:443", "10.0.0.3:443"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("expected %v, got %v", expected, addrs)
+	}
+}
+
+// startSRVServer starts a DNS server that answers queries for SRV records
+// with the given name, returning its address.
+func startSRVServer(t *testing.T, name string, srvs []dnsmessage.SRVResource) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true})
+			_ = b.StartQuestions()
+			_ = b.Question(q)
+			_ = b.StartAnswers()
+			if q.Type == dnsmessage.TypeSRV && q.Name.String() == name {
+				for _, srv := range srvs {
+					_ = b.SRVResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, srv)
+				}
+			}
+			msg, err := b.Finish()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(msg, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDNSResolverBuilderSRV(t *testing.T) {
+	server := startSRVServer(t, "_grpc._tcp.svc.example.com.", []dnsmessage.SRVResource{
+		{Priority: 2, Weight: 1, Port: 9443, Target: dnsmessage.MustNewName("b.example.com.")},
+		{Priority: 1, Weight: 1, Port: 8443, Target: dnsmessage.MustNewName("a.example.com.")},
+	})
+	b := &dnsResolverBuilder{
+		server:  server,
+		timeout: 5 * time.Second,
+		pinned: map[string][]string{
+			"a.example.com:8443": {"10.0.0.1:8443"},
+			"b.example.com:9443": {"10.0.0.2:9443", "10.0.0.3:9443"},
+		},
+	}
+	var cc stateRecorder
+	target := resolver.Target{URL: url.URL{Scheme: dnsResolverScheme, Path: "/srv://_grpc._tcp.svc.example.com"}}
+	if _, err := b.Build(target, &cc, resolver.BuildOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var addrs []string
+	for _, addr := range cc.state.Addresses {
+		addrs = append(addrs, addr.Addr)
+	}
+	// in order of priority
+	expected := []string{"10.0.0.1:8443", "10.0.0.2:9443", "10.0.0.3:9443"}
+	if !reflect.DeepEqual(addrs, expected) {
+		t.Errorf("expected %v, got %v", expected, addrs)
+	}
+
+	if _, err := b.resolveSRV("_grpc._tcp.nope.example.com"); err == nil {
+		t.Error("expected error for name without SRV records")
+	}
+}
+
+func TestSRVAuthority(t *testing.T) {
+	testCases := map[string]string{
+		"srv://_grpc._tcp.svc.example.com":  "svc.example.com",
+		"srv://_grpc._tcp.svc.example.com.": "svc.example.com",
+		"srv://svc.example.com":             "svc.example.com",
+		"srv://_grpc":                       "_grpc",
+	}
+	for target, expected := range testCases {
+		if actual := srvAuthority(target); actual != expected {
+			t.Errorf("%q: expected %q, got %q", target, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envFlagPrefix is the prefix of environment variables that provide values
+// for flags not given on the command line.
+const envFlagPrefix = "GRPCURL_"
+
+// flagEnvName returns the name of the environment variable for the given flag,
+// such as GRPCURL_MAX_TIME for -max-time.
+func flagEnvName(name string) string {
+	return envFlagPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// setFlagsFromEnv sets each flag that was not given on the command line from
+// its environment variable, if present. Flags that may be repeated accept
+// multiple values in the variable, one per line. Since flags set this way are
+// then considered present, calling this again has no effect.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	present := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		present[f.Name] = true
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || present[f.Name] {
+			return
+		}
+		envName := flagEnvName(f.Name)
+		val, ok := os.LookupEnv(envName)
+		if !ok {
+			return
+		}
+		vals := []string{val}
+		if _, ok := f.Value.(*multiString); ok {
+			vals = strings.Split(strings.TrimRight(val, "\n"), "\n")
+		}
+		for _, v := range vals {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("invalid value %q for $%s: %v", v, envName, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestSetFlagsFromEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	plaintext := fs.Bool("plaintext", false, "")
+	maxTime := fs.Float64("max-time", 0, "")
+	cacert := fs.String("cacert", "", "")
+	var headers multiString
+	fs.Var(&headers, "H", "")
+
+	t.Setenv("GRPCURL_PLAINTEXT", "true")
+	t.Setenv("GRPCURL_MAX_TIME", "2.5")
+	t.Setenv("GRPCURL_CACERT", "env.pem")
+	t.Setenv("GRPCURL_H", "a: 1\nb: 2\n")
+	if err := fs.Parse([]string{"-cacert", "flag.pem"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFlagsFromEnv(fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// setting again has no effect
+	if err := setFlagsFromEnv(fs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*plaintext || *maxTime != 2.5 {
+		t.Errorf("flags not set from environment: plaintext=%v, max-time=%v", *plaintext, *maxTime)
+	}
+	if *cacert != "flag.pem" {
+		t.Errorf("explicit flag should take precedence, got %q", *cacert)
+	}
+	if expected := (multiString{"a: 1", "b: 2"}); !reflect.DeepEqual(headers, expected) {
+		t.Errorf("expected headers %q, got %q", expected, headers)
+	}
+
+	t.Setenv("GRPCURL_MAX_TIME", "soon")
+	fs2 := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs2.Float64("max-time", 0, "")
+	if err := setFlagsFromEnv(fs2); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
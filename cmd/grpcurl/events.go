@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// callEvent is a line in the file written via -events-out.
+type callEvent struct {
+	// Event is the kind of event: "dial", "method", "request_headers",
+	// "request", "response_headers", "response", "response_trailers",
+	// "status", "error", or "done".
+	Event string `json:"event"`
+	// ElapsedMs is the time since the log was started, in milliseconds.
+	ElapsedMs float64 `json:"elapsedMs"`
+
+	Target   string              `json:"target,omitempty"`
+	Method   string              `json:"method,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	// Index, Size, and SHA256 describe a request or response message. The
+	// index starts at 1 and the hash is of the message's binary encoding.
+	Index  int    `json:"index,omitempty"`
+	Size   *int   `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	// Code and Message describe the final status.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// DurationMs is how long a dial or the whole call took, in milliseconds.
+	DurationMs float64 `json:"durationMs,omitempty"`
+	Requests   *int    `json:"requests,omitempty"`
+	Responses  *int    `json:"responses,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// eventLog writes events, one JSON object per line, to the file given via
+// -events-out. Each event is written as soon as it occurs, so the log is
+// complete even if grpcurl exits early. A nil *eventLog discards events.
+type eventLog struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+	err   error
+
+	requests, responses int
+}
+
+func newEventLog(fileName string) (*eventLog, error) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, start: time.Now()}, nil
+}
+
+func (l *eventLog) log(ev callEvent) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	ev.ElapsedMs = durationMillis(time.Since(l.start))
+	b, err := json.Marshal(ev)
+	if err != nil {
+		l.err = err
+		return
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		l.err = err
+	}
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (l *eventLog) dial(target string, d time.Duration, err error) {
+	ev := callEvent{Event: "dial", Target: target, DurationMs: durationMillis(d)}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	l.log(ev)
+}
+
+func (l *eventLog) message(event string, index int, m proto.Message) {
+	if l == nil {
+		return
+	}
+	ev := callEvent{Event: event, Index: index}
+	if b, err := proto.Marshal(m); err != nil {
+		ev.Error = err.Error()
+	} else {
+		sum := sha256.Sum256(b)
+		size := len(b)
+		ev.Size = &size
+		ev.SHA256 = hex.EncodeToString(sum[:])
+	}
+	l.log(ev)
+}
+
+// done records the outcome of the call. The given error is one returned from
+// invoking the RPC, which is not a status returned by the server.
+func (l *eventLog) done(d time.Duration, err error) {
+	if err != nil {
+		l.log(callEvent{Event: "error", Error: err.Error()})
+	}
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	requests, responses := l.requests, l.responses
+	l.mu.Unlock()
+	l.log(callEvent{Event: "done", DurationMs: durationMillis(d), Requests: &requests, Responses: &responses})
+}
+
+// close closes the file, returning the first error that occurred when
+// writing to it.
+func (l *eventLog) close() error {
+	if err := l.f.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+func (l *eventLog) wrapParser(rp grpcurl.RequestParser) grpcurl.RequestParser {
+	return &eventRequestParser{RequestParser: rp, l: l}
+}
+
+func (l *eventLog) wrapHandler(h grpcurl.InvocationEventHandler) grpcurl.InvocationEventHandler {
+	return &eventHandler{InvocationEventHandler: h, l: l}
+}
+
+type eventRequestParser struct {
+	grpcurl.RequestParser
+	l *eventLog
+}
+
+func (p *eventRequestParser) Next(m proto.Message) error {
+	err := p.RequestParser.Next(m)
+	if err == nil {
+		p.l.mu.Lock()
+		p.l.requests++
+		index := p.l.requests
+		p.l.mu.Unlock()
+		p.l.message("request", index, m)
+	}
+	return err
+}
+
+type eventHandler struct {
+	grpcurl.InvocationEventHandler
+	l *eventLog
+}
+
+func (h *eventHandler) OnResolveMethod(md *desc.MethodDescriptor) {
+	h.l.log(callEvent{Event: "method", Method: md.GetFullyQualifiedName()})
+	h.InvocationEventHandler.OnResolveMethod(md)
+}
+
+func (h *eventHandler) OnSendHeaders(md metadata.MD) {
+	h.l.log(callEvent{Event: "request_headers", Metadata: metadataForSession(md)})
+	h.InvocationEventHandler.OnSendHeaders(md)
+}
+
+func (h *eventHandler) OnReceiveHeaders(md metadata.MD) {
+	h.l.log(callEvent{Event: "response_headers", Metadata: metadataForSession(md)})
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h *eventHandler) OnReceiveResponse(resp proto.Message) {
+	h.l.mu.Lock()
+	h.l.responses++
+	index := h.l.responses
+	h.l.mu.Unlock()
+	h.l.message("response", index, resp)
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (h *eventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.l.log(callEvent{Event: "response_trailers", Metadata: metadataForSession(md)})
+	h.l.log(callEvent{Event: "status", Code: stat.Code().String(), Message: stat.Message()})
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
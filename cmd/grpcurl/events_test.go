@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestEventLog(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events.ndjson")
+	l, err := newEventLog(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.dial("localhost:1234", time.Millisecond, nil)
+	h := l.wrapHandler(&grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: grpcurl.NewJSONFormatter(false, nil)})
+	h.OnSendHeaders(metadata.Pairs("x-foo", "bar"))
+	h.OnReceiveHeaders(nil)
+	h.OnReceiveResponse(wrapperspb.String("abc"))
+	h.OnReceiveResponse(&wrapperspb.StringValue{})
+	h.OnReceiveTrailers(status.New(codes.NotFound, "nope"), nil)
+	l.done(time.Second, nil)
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []callEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev callEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	var kinds []string
+	for _, ev := range events {
+		kinds = append(kinds, ev.Event)
+	}
+	expected := []string{"dial", "request_headers", "response_headers", "response", "response", "response_trailers", "status", "done"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Fatalf("wrong events: expected %v, got %v", expected, kinds)
+	}
+	if md := events[1].Metadata; !reflect.DeepEqual(md, map[string][]string{"x-foo": {"bar"}}) {
+		t.Errorf("wrong request headers: %v", md)
+	}
+	if ev := events[3]; ev.Index != 1 || ev.Size == nil || *ev.Size != 5 || len(ev.SHA256) != 64 {
+		t.Errorf("wrong first response event: %+v", ev)
+	}
+	if ev := events[4]; ev.Index != 2 || ev.Size == nil || *ev.Size != 0 {
+		t.Errorf("wrong second response event: %+v", ev)
+	}
+	if ev := events[6]; ev.Code != "NotFound" || ev.Message != "nope" {
+		t.Errorf("wrong status event: %+v", ev)
+	}
+	if ev := events[7]; ev.Responses == nil || *ev.Responses != 2 || ev.Requests == nil || *ev.Requests != 0 {
+		t.Errorf("wrong done event: %+v", ev)
+	}
+}
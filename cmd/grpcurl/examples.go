@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// defaultExamplesDir is the directory searched for example requests when
+// -examples-dir is not present.
+const defaultExamplesDir = "examples"
+
+// exampleFileExtension returns the extension of example request files for
+// the given format.
+func exampleFileExtension(format grpcurl.Format) string {
+	if format == grpcurl.FormatText {
+		return ".txt"
+	}
+	return ".json"
+}
+
+// findExample returns the name of the file in the given directory that holds
+// an example request for the given method, or the empty string if there is
+// none. The method may be in "service/method" or "service.method" form. For
+// a method "my.pkg.Service/Method" and json format, the candidates are:
+//
+//	<dir>/my.pkg.Service/Method.json
+//	<dir>/my.pkg.Service.Method.json
+func findExample(dir, method string, format grpcurl.Format) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	method = strings.TrimPrefix(method, "/")
+	pos := strings.LastIndex(method, "/")
+	if pos < 0 {
+		pos = strings.LastIndex(method, ".")
+	}
+	if pos < 0 {
+		return "", nil
+	}
+	svc, name := method[:pos], method[pos+1:]
+	ext := exampleFileExtension(format)
+	for _, fileName := range []string{
+		filepath.Join(dir, svc, name+ext),
+		filepath.Join(dir, svc+"."+name+ext),
+	} {
+		info, err := os.Stat(fileName)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return fileName, nil
+		}
+	}
+	return "", nil
+}
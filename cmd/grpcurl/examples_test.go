@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestFindExample(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "my.pkg.Service"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "my.pkg.Service", "Nested.json")
+	flat := filepath.Join(dir, "my.pkg.Service.Flat.json")
+	text := filepath.Join(dir, "my.pkg.Service.Flat.txt")
+	for _, fileName := range []string{nested, flat, text} {
+		if err := os.WriteFile(fileName, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		dir, method string
+		format      grpcurl.Format
+		want        string
+	}{
+		{dir, "my.pkg.Service/Nested", grpcurl.FormatJSON, nested},
+		{dir, "my.pkg.Service.Nested", grpcurl.FormatJSON, nested},
+		{dir, "/my.pkg.Service/Flat", grpcurl.FormatJSON, flat},
+		{dir, "my.pkg.Service/Flat", grpcurl.FormatText, text},
+		{dir, "my.pkg.Service/Nested", grpcurl.FormatText, ""},
+		{dir, "my.pkg.Service/Missing", grpcurl.FormatJSON, ""},
+		{dir, "Service", grpcurl.FormatJSON, ""},
+		{"", "my.pkg.Service/Nested", grpcurl.FormatJSON, ""},
+		{filepath.Join(dir, "missing"), "my.pkg.Service/Nested", grpcurl.FormatJSON, ""},
+	}
+	for _, tc := range testCases {
+		got, err := findExample(tc.dir, tc.method, tc.format)
+		if err != nil {
+			t.Errorf("findExample(%q, %q): unexpected error: %v", tc.dir, tc.method, err)
+		} else if got != tc.want {
+			t.Errorf("findExample(%q, %q) = %q, want %q", tc.dir, tc.method, got, tc.want)
+		}
+	}
+}
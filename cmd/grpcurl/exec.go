@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// shellCommand returns a command that runs the given command line using the
+// platform's shell, so that it may include arguments and quoting.
+func shellCommand(cmdLine string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdLine)
+	}
+	return exec.Command("/bin/sh", "-c", cmdLine)
+}
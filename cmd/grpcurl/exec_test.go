@@ -0,0 +1,25 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestShellCommandUsesShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands require a POSIX shell")
+	}
+	// the command line may use quoting and shell features
+	out, err := shellCommand(`printf '%s|' "a b" c | tr '|' ,`).Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "a b,c,"; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+
+	err = shellCommand("exit 4").Run()
+	if err == nil || err.Error() != "exit status 4" {
+		t.Errorf("expected exit status 4, got %v", err)
+	}
+}
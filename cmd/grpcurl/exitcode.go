@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// maxStatusCode is the largest status code defined by gRPC.
+const maxStatusCode = codes.Unauthenticated
+
+// parseStatusCodeList parses a comma-separated list of status codes, given via
+// -fail-on-codes or -ok-codes. Each code may be numeric or a name, like
+// "NOT_FOUND" or "NotFound".
+func parseStatusCodeList(list string) (map[codes.Code]bool, error) {
+	result := map[codes.Code]bool{}
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		code, err := parseStatusCodeName(s)
+		if err != nil {
+			return nil, err
+		}
+		result[code] = true
+	}
+	return result, nil
+}
+
+func parseStatusCodeName(s string) (codes.Code, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n > int(maxStatusCode) {
+			return 0, fmt.Errorf("status code %d is out of range", n)
+		}
+		return codes.Code(n), nil
+	}
+	name := strings.ReplaceAll(s, "_", "")
+	for c := codes.OK; c <= maxStatusCode; c++ {
+		if strings.EqualFold(name, c.String()) {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status code %q", s)
+}
+
+// statusExitPolicy decides the exit code used when an RPC completes with a
+// non-OK status.
+type statusExitPolicy struct {
+	mode string
+	// if non-nil, only these codes are failures
+	failOn map[codes.Code]bool
+	// these codes are not failures
+	ok map[codes.Code]bool
+}
+
+// exitCode returns the exit code for the given status code, and false if the
+// status should not cause a non-zero exit.
+func (p statusExitPolicy) exitCode(code codes.Code) (int, bool) {
+	if code == codes.OK || p.mode == "curl" || p.ok[code] {
+		return 0, false
+	}
+	if p.failOn != nil && !p.failOn[code] {
+		return 0, false
+	}
+	if p.mode == "passthrough" {
+		return int(code), true
+	}
+	return statusCodeOffset + int(code), true
+}
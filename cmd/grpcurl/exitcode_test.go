@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseStatusCodeList(t *testing.T) {
+	actual, err := parseStatusCodeList("5, NOT_FOUND,PermissionDenied,unavailable")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []codes.Code{codes.NotFound, codes.PermissionDenied, codes.Unavailable} {
+		if !actual[c] {
+			t.Errorf("expected %v in result", c)
+		}
+	}
+	if len(actual) != 3 {
+		t.Errorf("expected 3 codes, got %v", actual)
+	}
+	for _, list := range []string{"17", "-1", "NOPE"} {
+		if _, err := parseStatusCodeList(list); err == nil {
+			t.Errorf("%q: expected error", list)
+		}
+	}
+}
+
+func TestStatusExitPolicy(t *testing.T) {
+	testCases := []struct {
+		policy   statusExitPolicy
+		code     codes.Code
+		expected int
+		fails    bool
+	}{
+		{statusExitPolicy{mode: "offset"}, codes.OK, 0, false},
+		{statusExitPolicy{mode: "offset"}, codes.NotFound, 69, true},
+		{statusExitPolicy{mode: "passthrough"}, codes.NotFound, 5, true},
+		{statusExitPolicy{mode: "curl"}, codes.NotFound, 0, false},
+		{statusExitPolicy{mode: "offset", ok: map[codes.Code]bool{codes.NotFound: true}}, codes.NotFound, 0, false},
+		{statusExitPolicy{mode: "offset", ok: map[codes.Code]bool{codes.NotFound: true}}, codes.Internal, 77, true},
+		{statusExitPolicy{mode: "passthrough", failOn: map[codes.Code]bool{codes.Internal: true}}, codes.NotFound, 0, false},
+		{statusExitPolicy{mode: "passthrough", failOn: map[codes.Code]bool{codes.Internal: true}}, codes.Internal, 13, true},
+	}
+	for i, tc := range testCases {
+		code, fails := tc.policy.exitCode(tc.code)
+		if code != tc.expected || fails != tc.fails {
+			t.Errorf("case %d: expected %d, %v; got %d, %v", i, tc.expected, tc.fails, code, fails)
+		}
+	}
+}
+
+func TestMaxLatency(t *testing.T) {
+	cc, _ := startTestServer(t)
+	// the server waits 200ms before its response
+	req := `{"response_parameters": [{"size": 1, "interval_us": 200000}]}`
+	args := []string{"-plaintext", "-protoset", "../../internal/testing/test.protoset", "-d", req}
+	method := "testing.TestService/StreamingOutputCall"
+
+	_, stderr, code := runGrpcurl(t, append(args, "-max-latency", "0.05", cc.Target(), method)...)
+	if code != latencyExceededExitCode {
+		t.Errorf("expected exit code %d, got %d: %s", latencyExceededExitCode, code, stderr)
+	}
+	if !strings.HasPrefix(stderr, "ERROR: RPC took ") || !strings.HasSuffix(stderr, ", which exceeds -max-latency of 50ms\n") {
+		t.Errorf("unexpected error output: %q", stderr)
+	}
+
+	_, stderr, code = runGrpcurl(t, append(args, "-max-latency", "10", cc.Target(), method)...)
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d: %s", code, stderr)
+	}
+}
+
+func TestFailWithBody(t *testing.T) {
+	cc, _ := startTestServer(t)
+	args := []string{"-plaintext", "-protoset", "../../internal/testing/test.protoset", "-fail"}
+
+	// the status follows the responses on stdout
+	stdout, stderr, code := runGrpcurl(t, append(args, "-H", "fail-late: 5", "-d", `{"response_parameters": [{"size": 1}]}`,
+		cc.Target(), "testing.TestService/StreamingOutputCall")...)
+	if code != 64+int(codes.NotFound) {
+		t.Errorf("expected exit code %d, got %d: %s", 64+int(codes.NotFound), code, stderr)
+	}
+	expected := "{\n  \"payload\": {\n    \"body\": \"AA==\"\n  }\n}\n{\n  \"code\": 5,\n  \"message\": \"fail\"\n}\n"
+	if stdout != expected {
+		t.Errorf("expected stdout %q, got %q", expected, stdout)
+	}
+	if stderr != "" {
+		t.Errorf("expected no error output, got %q", stderr)
+	}
+
+	// the status is formatted using -format
+	stdout, stderr, code = runGrpcurl(t, append(args, "-H", "fail-early: 7", "-format", "text",
+		cc.Target(), "testing.TestService/EmptyCall")...)
+	if code != 64+int(codes.PermissionDenied) {
+		t.Errorf("expected exit code %d, got %d: %s", 64+int(codes.PermissionDenied), code, stderr)
+	}
+	if expected := "code: 7\nmessage: \"fail\"\n"; stdout != expected {
+		t.Errorf("expected stdout %q, got %q", expected, stdout)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/itchyny/gojq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// responseExpectations are the assertions about the outcome of an RPC, given
+// via -expect-status, -expect-response-contains, and -expect-jq. They are
+// checked once the RPC completes, against its status and the responses
+// recorded by expectationHandler.
+type responseExpectations struct {
+	// if non-nil, the status code the RPC must complete with
+	status *codes.Code
+	// each must be a substring of at least one formatted response
+	contains []string
+	// each must yield only true values for every response
+	jq []jqExpectation
+
+	// formatter is used to format responses for the 'contains' checks, and
+	// jsonFormatter to format them for the 'jq' checks
+	formatter     grpcurl.Formatter
+	jsonFormatter grpcurl.Formatter
+	// if set, the JSON form of every response is recorded even if there are
+	// no jq expectations, such as to capture variables from it
+	keepJSON bool
+
+	responses []recordedResponse
+}
+
+type jqExpectation struct {
+	expr string
+	code *gojq.Code
+}
+
+type recordedResponse struct {
+	text string
+	json string
+	err  error
+}
+
+func newJQExpectation(expr string) (jqExpectation, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return jqExpectation{}, err
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return jqExpectation{}, err
+	}
+	return jqExpectation{expr: expr, code: code}, nil
+}
+
+// expectationHandler records every response message for the expectations
+// given via -expect-* flags, in addition to handling them as usual.
+type expectationHandler struct {
+	grpcurl.InvocationEventHandler
+	expect *responseExpectations
+}
+
+func (h expectationHandler) OnReceiveResponse(m proto.Message) {
+	h.InvocationEventHandler.OnReceiveResponse(m)
+	var resp recordedResponse
+	if len(h.expect.contains) > 0 {
+		resp.text, resp.err = h.expect.formatter(m)
+	}
+	if (len(h.expect.jq) > 0 || h.expect.keepJSON) && resp.err == nil {
+		resp.json, resp.err = h.expect.jsonFormatter(m)
+	}
+	h.expect.responses = append(h.expect.responses, resp)
+}
+
+// check returns a description of each expectation that the RPC, which
+// completed with the given status, did not meet.
+func (e *responseExpectations) check(stat *status.Status) []string {
+	var failures []string
+	if e.status != nil && stat.Code() != *e.status {
+		failure := fmt.Sprintf("expected status %s, but got %s", *e.status, stat.Code())
+		if stat.Message() != "" {
+			failure += fmt.Sprintf(" (%s)", stat.Message())
+		}
+		failures = append(failures, failure)
+	}
+	for i, resp := range e.responses {
+		if resp.err != nil {
+			failures = append(failures, fmt.Sprintf("could not format response %d: %v", i+1, resp.err))
+		}
+	}
+	for _, s := range e.contains {
+		found := false
+		for _, resp := range e.responses {
+			if strings.Contains(resp.text, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("no response contains %q", s))
+		}
+	}
+	for _, jq := range e.jq {
+		if len(e.responses) == 0 {
+			failures = append(failures, fmt.Sprintf("no responses to evaluate -expect-jq %q", jq.expr))
+			continue
+		}
+		for i, resp := range e.responses {
+			if resp.err != nil {
+				continue
+			}
+			if err := jq.eval(resp.json); err != nil {
+				failures = append(failures, fmt.Sprintf("-expect-jq %q %v for response %d", jq.expr, err, i+1))
+			}
+		}
+	}
+	return failures
+}
+
+// eval evaluates the expression against the given JSON, returning an error
+// unless it yields at least one value and all values are true, as in jq:
+// anything other than false or null.
+func (e jqExpectation) eval(str string) error {
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.UseNumber()
+	var input interface{}
+	if err := dec.Decode(&input); err != nil {
+		return fmt.Errorf("could not be evaluated: %v", err)
+	}
+	iter := e.code.Run(normalizeJSONNumbers(input))
+	count := 0
+	for {
+		v, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := v.(error); ok {
+			return fmt.Errorf("failed: %v", err)
+		}
+		if v == nil {
+			return fmt.Errorf("yielded null")
+		} else if v == false {
+			return fmt.Errorf("yielded false")
+		}
+		count++
+	}
+	if count == 0 {
+		return fmt.Errorf("yielded no value")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestResponseExpectations(t *testing.T) {
+	formatter := grpcurl.NewJSONFormatter(false, nil)
+	ready, err := structpb.NewStruct(map[string]interface{}{"status": "READY", "count": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	starting, err := structpb.NewStruct(map[string]interface{}{"status": "STARTING", "count": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notFound := codes.NotFound
+
+	testCases := []struct {
+		name      string
+		status    *codes.Code
+		contains  []string
+		jq        []string
+		responses []*structpb.Struct
+		stat      *status.Status
+		failures  []string
+	}{
+		{
+			name:      "met",
+			contains:  []string{`"READY"`},
+			jq:        []string{`.status == "READY"`, ".count"},
+			responses: []*structpb.Struct{ready},
+			stat:      status.New(codes.OK, ""),
+		},
+		{
+			name:   "expected non-OK status",
+			status: &notFound,
+			stat:   status.New(codes.NotFound, "missing"),
+		},
+		{
+			name:     "unexpected status",
+			status:   &notFound,
+			stat:     status.New(codes.OK, ""),
+			failures: []string{"expected status NotFound, but got OK"},
+		},
+		{
+			name:      "contains in any response",
+			contains:  []string{"STARTING", "READY", "STOPPED"},
+			responses: []*structpb.Struct{starting, ready},
+			stat:      status.New(codes.OK, ""),
+			failures:  []string{`no response contains "STOPPED"`},
+		},
+		{
+			name:      "jq for every response",
+			jq:        []string{`.status == "READY"`, ".count > 0, .status", ".missing", "empty"},
+			responses: []*structpb.Struct{ready, starting},
+			stat:      status.New(codes.OK, ""),
+			failures: []string{
+				`-expect-jq ".status == \"READY\"" yielded false for response 2`,
+				`-expect-jq ".count > 0, .status" yielded false for response 2`,
+				`-expect-jq ".missing" yielded null for response 1`,
+				`-expect-jq ".missing" yielded null for response 2`,
+				`-expect-jq "empty" yielded no value for response 1`,
+				`-expect-jq "empty" yielded no value for response 2`,
+			},
+		},
+		{
+			name:     "jq without responses",
+			jq:       []string{".status"},
+			stat:     status.New(codes.OK, ""),
+			failures: []string{`no responses to evaluate -expect-jq ".status"`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &responseExpectations{
+				status:        tc.status,
+				contains:      tc.contains,
+				formatter:     formatter,
+				jsonFormatter: formatter,
+			}
+			for _, expr := range tc.jq {
+				jq, err := newJQExpectation(expr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				e.jq = append(e.jq, jq)
+			}
+			h := expectationHandler{
+				InvocationEventHandler: &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: formatter},
+				expect:                 e,
+			}
+			for _, resp := range tc.responses {
+				h.OnReceiveResponse(resp)
+			}
+			if failures := e.check(tc.stat); !reflect.DeepEqual(failures, tc.failures) {
+				t.Errorf("expected failures %q, got %q", tc.failures, failures)
+			}
+		})
+	}
+}
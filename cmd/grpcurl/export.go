@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Names of the files that make up an exported test case.
+const (
+	testCaseManifestFile  = "batch.jsonl"
+	testCaseProtosetFile  = "descriptors.protoset"
+	testCaseRequestsFile  = "requests.json"
+	testCaseResponsesFile = "responses.json"
+	testCaseReadmeFile    = "README"
+)
+
+// batchCall is a single entry in a batch manifest, which contains one JSON
+// object per line.
+type batchCall struct {
+	// Method is the fully-qualified name of the method to invoke.
+	Method string `json:"method"`
+	// Headers are the request headers, in "name: value" form.
+	Headers []string `json:"headers,omitempty"`
+	// Data is the request data, in the same form accepted by -d. If it starts
+	// with '@' then the rest is the name of a file, relative to the manifest,
+	// from which the data is read.
+	Data string `json:"data,omitempty"`
+	// Expect, if present, describes the expected outcome of the call.
+	Expect *batchExpectation `json:"expect,omitempty"`
+	// Capture maps the names of variables to jq expressions, whose results
+	// for the last response are referenced by later calls as '${name}'.
+	Capture map[string]string `json:"capture,omitempty"`
+}
+
+type batchExpectation struct {
+	// Status is the expected status, as a google.rpc.Status message in JSON
+	// format.
+	Status json.RawMessage `json:"status,omitempty"`
+	// Responses is the name of a file, relative to the manifest, that contains
+	// the expected response messages in JSON format.
+	Responses string `json:"responses,omitempty"`
+}
+
+func runExport(args []string) {
+	if len(args) == 0 {
+		fail(nil, "Too few arguments.")
+	}
+	switch args[0] {
+	case "testcase":
+		if len(args) < 3 {
+			fail(nil, "Too few arguments.")
+		}
+		if len(args) > 3 {
+			fail(nil, "Too many arguments.")
+		}
+		session, err := readSession(args[1])
+		if err != nil {
+			fail(err, "Failed to read session from %s", args[1])
+		}
+		if len(session.Protoset) == 0 {
+			warn("The session does not include descriptors; the test case will require another descriptor source.")
+		}
+		if err := exportTestCase(session, args[2]); err != nil {
+			fail(err, "Failed to export test case to %s", args[2])
+		}
+		fmt.Fprintf(os.Stderr, "Exported test case for %s to %s\n", session.Method, args[2])
+	default:
+		fail(nil, "Unknown export format %q; supported formats: testcase.", args[0])
+	}
+}
+
+// exportTestCase writes the given session into dir as a test case that can
+// be run with the -batch flag: a manifest with a single call, the request and
+// expected response messages, and the descriptors needed to make the call.
+func exportTestCase(s *recordedSession, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	call := batchCall{
+		Method:  s.Method,
+		Headers: s.headers(),
+	}
+	if len(s.Requests) > 0 {
+		if err := writeMessages(filepath.Join(dir, testCaseRequestsFile), s.Requests); err != nil {
+			return err
+		}
+		call.Data = "@" + testCaseRequestsFile
+	}
+	if len(s.Status) > 0 || len(s.Responses) > 0 {
+		call.Expect = &batchExpectation{Status: s.Status}
+		if len(s.Responses) > 0 {
+			if err := writeMessages(filepath.Join(dir, testCaseResponsesFile), s.Responses); err != nil {
+				return err
+			}
+			call.Expect.Responses = testCaseResponsesFile
+		}
+	}
+	manifest, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, testCaseManifestFile), append(manifest, '\n'), 0666); err != nil {
+		return err
+	}
+
+	runCmd := "grpcurl "
+	if len(s.Protoset) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, testCaseProtosetFile), s.Protoset, 0666); err != nil {
+			return err
+		}
+		runCmd += "-protoset " + testCaseProtosetFile + " "
+	}
+	runCmd += "-batch " + testCaseManifestFile + " <address>"
+
+	var readme strings.Builder
+	fmt.Fprintf(&readme, "This test case was exported from a session recorded with grpcurl.\n\n")
+	fmt.Fprintf(&readme, "Method: %s\n", s.Method)
+	if s.Target != "" {
+		fmt.Fprintf(&readme, "Recorded against: %s\n", s.Target)
+	}
+	if !s.Start.IsZero() {
+		fmt.Fprintf(&readme, "Recorded at: %s\n", s.Start.Format(time.RFC3339))
+	}
+	if s.Error != "" {
+		fmt.Fprintf(&readme, "Recorded error: %s\n", s.Error)
+	}
+	fmt.Fprintf(&readme, "\nTo run it, use the following from this directory, along with any other\n")
+	fmt.Fprintf(&readme, "flags needed to connect to the server (such as -plaintext):\n\n")
+	fmt.Fprintf(&readme, "  %s\n", runCmd)
+	return os.WriteFile(filepath.Join(dir, testCaseReadmeFile), []byte(readme.String()), 0666)
+}
+
+// writeMessages writes the given messages to a file as a stream of JSON
+// values, in the form accepted by -d.
+func writeMessages(fileName string, msgs []recordedMessage) error {
+	var buf bytes.Buffer
+	for i, msg := range msgs {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		if err := json.Indent(&buf, msg.Message, "", "  "); err != nil {
+			return fmt.Errorf("could not format message #%d: %v", i+1, err)
+		}
+		buf.WriteByte('\n')
+	}
+	return os.WriteFile(fileName, buf.Bytes(), 0666)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportTestCase(t *testing.T) {
+	session := &recordedSession{
+		Version:        sessionFormatVersion,
+		Method:         "foo.Bar/Baz",
+		RequestHeaders: map[string][]string{"foo": {"bar"}},
+		Requests: []recordedMessage{
+			{Elapsed: "1ms", Message: json.RawMessage(`{"a":1}`)},
+			{Elapsed: "2ms", Message: json.RawMessage(`{"a":2}`)},
+		},
+		Responses: []recordedMessage{
+			{Elapsed: "3ms", Message: json.RawMessage(`{"b":"x"}`)},
+		},
+		Status:   json.RawMessage(`{"code":5,"message":"not here"}`),
+		Protoset: []byte{1, 2, 3},
+	}
+	dir := filepath.Join(t.TempDir(), "testcase")
+	if err := exportTestCase(session, dir); err != nil {
+		t.Fatalf("failed to export test case: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, testCaseManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var call batchCall
+	if err := json.Unmarshal(b, &call); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	expected := batchCall{
+		Method:  "foo.Bar/Baz",
+		Headers: []string{"foo: bar"},
+		Data:    "@" + testCaseRequestsFile,
+		Expect: &batchExpectation{
+			Status:    json.RawMessage(`{"code":5,"message":"not here"}`),
+			Responses: testCaseResponsesFile,
+		},
+	}
+	if !reflect.DeepEqual(call, expected) {
+		t.Errorf("wrong manifest: expected %+v, got %+v", expected, call)
+	}
+
+	b, err = os.ReadFile(filepath.Join(dir, testCaseRequestsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRequests := "{\n  \"a\": 1\n}\n\n{\n  \"a\": 2\n}\n"
+	if string(b) != expectedRequests {
+		t.Errorf("wrong requests: expected %q, got %q", expectedRequests, string(b))
+	}
+	if _, err := os.Stat(filepath.Join(dir, testCaseResponsesFile)); err != nil {
+		t.Errorf("expected responses file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, testCaseProtosetFile)); err != nil {
+		t.Errorf("expected protoset file: %v", err)
+	}
+}
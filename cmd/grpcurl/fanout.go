@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"                  //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"                //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic"             //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// fanOutResult is the outcome of the calls made when invoking a unary method
+// with -parallel.
+type fanOutResult struct {
+	// the number of calls that completed with each status code
+	counts map[codes.Code]int
+	// the number of calls that could not be made, such as when the
+	// connection failed
+	errors int
+}
+
+// runFanOut invokes the given unary method once for each request message read
+// from rf, with at most parallel calls in progress at once. If there is only
+// one request message, or none, in which case it is empty, it is sent in
+// parallel calls. Responses are printed to out as they arrive, using the given
+// formatter, and the status of each failed call is printed to errOut, along
+// with the number of the request, starting at 1. It returns an error if the
+// request data could not be parsed, after waiting for the calls in progress.
+func runFanOut(ctx context.Context, out, errOut io.Writer, source grpcurl.DescriptorSource, ch grpcdynamic.Channel, mtd *desc.MethodDescriptor, headers []string, rf grpcurl.RequestParser, formatter grpcurl.Formatter, parallel int) (fanOutResult, error) {
+	result := fanOutResult{counts: map[codes.Code]int{}}
+	var mu sync.Mutex
+	call := func(i int, req proto.Message) {
+		supplier := func(m proto.Message) error {
+			if req == nil {
+				return io.EOF
+			}
+			b, err := proto.Marshal(req)
+			req = nil
+			if err != nil {
+				return err
+			}
+			return proto.Unmarshal(b, m)
+		}
+		var responses []string
+		h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: formatter}
+		err := grpcurl.InvokeRPC(ctx, source, ch, mtd.GetFullyQualifiedName(), headers, fanOutHandler{h, &responses}, supplier)
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resp := range responses {
+			fmt.Fprintln(out, resp)
+		}
+		if err != nil {
+			result.errors++
+			fmt.Fprintf(errOut, "Request %d: %v\n", i, err)
+			return
+		}
+		result.counts[h.Status.Code()]++
+		if h.Status.Code() != codes.OK {
+			fmt.Fprintf(errOut, "Request %d: %s: %s\n", i, h.Status.Code(), h.Status.Message())
+		}
+	}
+
+	next := func() (proto.Message, error) {
+		msg := dynamic.NewMessage(mtd.GetInputType())
+		if err := rf.Next(msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+	first, err := next()
+	if err == io.EOF {
+		first, err = dynamic.NewMessage(mtd.GetInputType()), nil
+	} else if err == nil {
+		var second proto.Message
+		if second, err = next(); err == nil {
+			// one request per call
+			return result, runFanOutRequests(parallel, call, next, first, second)
+		}
+	}
+	if err != io.EOF && err != nil {
+		return result, err
+	}
+	// the same request in every call
+	var wg sync.WaitGroup
+	for i := 1; i <= parallel; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			call(i, first)
+		}(i)
+	}
+	wg.Wait()
+	return result, nil
+}
+
+// runFanOutRequests makes a call with each of the given requests and then with
+// each one returned by next, until it returns an error, using the given number
+// of workers. It returns the error from next, unless it is io.EOF.
+func runFanOutRequests(workers int, call func(int, proto.Message), next func() (proto.Message, error), reqs ...proto.Message) error {
+	type indexedRequest struct {
+		i   int
+		req proto.Message
+	}
+	queue := make(chan indexedRequest)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				call(r.i, r.req)
+			}
+		}()
+	}
+	var err error
+	i := 0
+	for {
+		var req proto.Message
+		if len(reqs) > 0 {
+			req, reqs = reqs[0], reqs[1:]
+		} else if req, err = next(); err != nil {
+			break
+		}
+		i++
+		queue <- indexedRequest{i, req}
+	}
+	close(queue)
+	wg.Wait()
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// fanOutHandler keeps the formatted response messages of a call, so they can
+// be printed together once the call completes.
+type fanOutHandler struct {
+	*grpcurl.DefaultEventHandler
+	responses *[]string
+}
+
+func (h fanOutHandler) OnReceiveResponse(resp proto.Message) {
+	h.DefaultEventHandler.OnReceiveResponse(resp)
+	str, err := h.Formatter(resp)
+	if err != nil {
+		str = fmt.Sprintf("(could not format response: %v)", err)
+	}
+	*h.responses = append(*h.responses, str)
+}
+
+// total returns the number of calls that were made or attempted.
+func (r fanOutResult) total() int {
+	total := r.errors
+	for _, n := range r.counts {
+		total += n
+	}
+	return total
+}
+
+// print writes a summary of the result to w: the number of calls that
+// completed with each status code and that could not be made.
+func (r fanOutResult) print(w io.Writer, mtd *desc.MethodDescriptor, parallel int) {
+	fmt.Fprintf(w, "Made %d calls to %s, %d at a time:\n", r.total(), mtd.GetFullyQualifiedName(), parallel)
+	for _, code := range r.statusCodes() {
+		fmt.Fprintf(w, "  %-20s %d\n", code, r.counts[code])
+	}
+	if r.errors > 0 {
+		fmt.Fprintf(w, "  %-20s %d\n", "(not completed)", r.errors)
+	}
+}
+
+// statusCodes returns the status codes with which the calls completed, in
+// numeric order.
+func (r fanOutResult) statusCodes() []codes.Code {
+	var result []codes.Code
+	for code := range r.counts {
+		result = append(result, code)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestRunFanOut(t *testing.T) {
+	cc, source := startTestServer(t)
+	mtd, err := findMethod(source, "testing.TestService/UnaryCall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := grpcurl.FormatOptions{CompactJSON: true}
+
+	testCases := []struct {
+		name              string
+		data              string
+		headers           []string
+		expectedResponses []string
+		expectedCounts    map[codes.Code]int
+		expectedErr       string
+	}{
+		{
+			name:              "single request",
+			data:              `{"payload": {"body": "aGk="}}`,
+			expectedResponses: []string{`{"payload":{"body":"aGk="}}`, `{"payload":{"body":"aGk="}}`, `{"payload":{"body":"aGk="}}`},
+			expectedCounts:    map[codes.Code]int{codes.OK: 3},
+		},
+		{
+			name:              "no request",
+			expectedResponses: []string{`{}`, `{}`, `{}`},
+			expectedCounts:    map[codes.Code]int{codes.OK: 3},
+		},
+		{
+			name:              "request per call",
+			data:              `{"payload": {"body": "YQ=="}} {"payload": {"body": "Yg=="}} {"payload": {"body": "Yw=="}} {"payload": {"body": "ZA=="}} {"payload": {"body": "ZQ=="}}`,
+			expectedResponses: []string{`{"payload":{"body":"YQ=="}}`, `{"payload":{"body":"Yg=="}}`, `{"payload":{"body":"Yw=="}}`, `{"payload":{"body":"ZA=="}}`, `{"payload":{"body":"ZQ=="}}`},
+			expectedCounts:    map[codes.Code]int{codes.OK: 5},
+		},
+		{
+			name:           "failures",
+			data:           `{} {}`,
+			headers:        []string{"fail-early: 5"},
+			expectedCounts: map[codes.Code]int{codes.NotFound: 2},
+		},
+		{
+			name:              "invalid request",
+			data:              `{} {} {"nope": 1}`,
+			expectedResponses: []string{`{}`, `{}`},
+			expectedCounts:    map[codes.Code]int{codes.OK: 2},
+			expectedErr:       "nope",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rf, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, source, strings.NewReader(tc.data), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out, errOut bytes.Buffer
+			result, err := runFanOut(context.Background(), &out, &errOut, source, cc, mtd, tc.headers, rf, formatter, 3)
+			if tc.expectedErr == "" && err != nil {
+				t.Fatal(err)
+			} else if tc.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), tc.expectedErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+			}
+			// responses are printed in the order the calls complete
+			var responses []string
+			if out.Len() > 0 {
+				responses = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			}
+			sort.Strings(responses)
+			sort.Strings(tc.expectedResponses)
+			if strings.Join(responses, "\n") != strings.Join(tc.expectedResponses, "\n") {
+				t.Errorf("expected responses %q, got %q", tc.expectedResponses, responses)
+			}
+			if len(result.counts) != len(tc.expectedCounts) || result.errors != 0 {
+				t.Errorf("expected counts %v, got %v and %d errors", tc.expectedCounts, result.counts, result.errors)
+			}
+			for code, n := range tc.expectedCounts {
+				if result.counts[code] != n {
+					t.Errorf("expected counts %v, got %v", tc.expectedCounts, result.counts)
+				}
+			}
+			if n := strings.Count(errOut.String(), ": NotFound: fail\n"); n != tc.expectedCounts[codes.NotFound] {
+				t.Errorf("expected %d failures printed, got:\n%s", tc.expectedCounts[codes.NotFound], errOut.String())
+			}
+		})
+	}
+}
+
+func TestFanOutResultPrint(t *testing.T) {
+	result := fanOutResult{counts: map[codes.Code]int{codes.Unavailable: 1, codes.OK: 7}, errors: 2}
+	_, source := startTestServer(t)
+	mtd, err := findMethod(source, "testing.TestService/UnaryCall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	result.print(&out, mtd, 4)
+	expected := `Made 10 calls to testing.TestService.UnaryCall, 4 at a time:
+  OK                   7
+  Unavailable          1
+  (not completed)      2
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"                  //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"                //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic"             //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const (
+	// fuzzMaxDepth is how deeply messages are nested in a generated request.
+	// Only required fields are set in messages at this depth, and messages
+	// nested in those are empty.
+	fuzzMaxDepth = 4
+	// fuzzMaxElements is the largest number of elements generated for a
+	// repeated or map field.
+	fuzzMaxElements = 3
+)
+
+// fuzzStrings are string values that are often mishandled.
+var fuzzStrings = []string{"", " ", "héllo, 世界", "'\"\\<>&%${}", "\x00", "-1", strings.Repeat("x", 1024)}
+
+// requestFuzzer generates random request messages for -fuzz. Each value is
+// valid for its field's type: a declared value for an enum, at most one field
+// of a oneof, valid UTF-8 for a string, and so on. Values are often edge
+// cases, like the limits of numeric types or empty strings, since those are
+// more likely than others to find bugs. Other fields are set at random, but
+// required fields (see isRequiredField) are always set.
+type requestFuzzer struct {
+	rnd *rand.Rand
+}
+
+func newRequestFuzzer(seed int64) *requestFuzzer {
+	return &requestFuzzer{rnd: rand.New(rand.NewSource(seed))}
+}
+
+// message returns a random message of the given type, nested at the given
+// depth in the request.
+func (f *requestFuzzer) message(md *desc.MessageDescriptor, depth int) *dynamic.Message {
+	msg := dynamic.NewMessage(md)
+	if depth > fuzzMaxDepth {
+		return msg
+	}
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Any":
+		// a random type URL could not be resolved, so it is left empty
+		return msg
+	case "google.protobuf.Timestamp":
+		// between 0001-01-01 and 9999-12-31, the range that may be formatted
+		msg.SetFieldByNumber(1, f.rnd.Int63n(315537897600)-62135596800)
+		msg.SetFieldByNumber(2, f.rnd.Int31n(1e9))
+		return msg
+	case "google.protobuf.Duration":
+		// non-negative and at most 10,000 years, the range that may be formatted
+		msg.SetFieldByNumber(1, f.rnd.Int63n(315576000000))
+		msg.SetFieldByNumber(2, f.rnd.Int31n(1e9))
+		return msg
+	}
+	for _, ood := range md.GetOneOfs() {
+		if depth == fuzzMaxDepth || ood.IsSynthetic() {
+			// a proto3 optional field, which is handled like other fields
+			continue
+		}
+		choices := ood.GetChoices()
+		if i := f.rnd.Intn(len(choices) + 1); i < len(choices) {
+			f.setField(msg, choices[i], depth)
+		}
+	}
+	for _, fd := range md.GetFields() {
+		if ood := fd.GetOneOf(); ood != nil && !ood.IsSynthetic() {
+			continue
+		}
+		if !isRequiredField(fd) && (depth == fuzzMaxDepth || f.rnd.Intn(2) == 0) {
+			continue
+		}
+		f.setField(msg, fd, depth)
+	}
+	return msg
+}
+
+func (f *requestFuzzer) setField(msg *dynamic.Message, fd *desc.FieldDescriptor, depth int) {
+	switch {
+	case fd.IsMap():
+		for i := f.rnd.Intn(fuzzMaxElements + 1); i > 0; i-- {
+			msg.PutMapField(fd, f.value(fd.GetMapKeyType(), depth), f.value(fd.GetMapValueType(), depth))
+		}
+	case fd.IsRepeated():
+		for i := f.rnd.Intn(fuzzMaxElements + 1); i > 0; i-- {
+			msg.AddRepeatedField(fd, f.value(fd, depth))
+		}
+	default:
+		msg.SetField(fd, f.value(fd, depth))
+	}
+}
+
+// value returns a random value for the given field, or for an element of it
+// if it is repeated.
+func (f *requestFuzzer) value(fd *desc.FieldDescriptor, depth int) interface{} {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return f.rnd.Intn(2) == 1
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(f.integer(math.MinInt32, math.MaxInt32, int64(int32(f.rnd.Uint32()))))
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return f.integer(math.MinInt64, math.MaxInt64, int64(f.rnd.Uint64()))
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(f.integer(0, math.MaxUint32, int64(f.rnd.Uint32())))
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if f.rnd.Intn(2) == 0 {
+			edges := []uint64{0, 1, math.MaxUint64}
+			return edges[f.rnd.Intn(len(edges))]
+		}
+		return f.rnd.Uint64()
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return float32(f.float(math.MaxFloat32, math.SmallestNonzeroFloat32))
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return f.float(math.MaxFloat64, math.SmallestNonzeroFloat64)
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		if f.rnd.Intn(2) == 0 {
+			return fuzzStrings[f.rnd.Intn(len(fuzzStrings))]
+		}
+		b := make([]byte, f.rnd.Intn(17))
+		for i := range b {
+			b[i] = byte(' ' + f.rnd.Intn('~'-' '+1))
+		}
+		return string(b)
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		b := make([]byte, f.rnd.Intn(33))
+		f.rnd.Read(b)
+		return b
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		values := fd.GetEnumType().GetValues()
+		return values[f.rnd.Intn(len(values))].GetNumber()
+	default:
+		// a message or group
+		return f.message(fd.GetMessageType(), depth+1)
+	}
+}
+
+// integer returns either an edge case, including the given limits, or the
+// given random value.
+func (f *requestFuzzer) integer(min, max, random int64) int64 {
+	edges := []int64{0, 1, -1, min, max}
+	if min == 0 {
+		edges = []int64{0, 1, max}
+	}
+	if f.rnd.Intn(2) == 0 {
+		return edges[f.rnd.Intn(len(edges))]
+	}
+	return random
+}
+
+// float returns either an edge case, including the given limits, or a random
+// value.
+func (f *requestFuzzer) float(max, smallest float64) float64 {
+	edges := []float64{0, 1, -1, max, -max, smallest, math.Inf(1), math.Inf(-1), math.NaN()}
+	if f.rnd.Intn(2) == 0 {
+		return edges[f.rnd.Intn(len(edges))]
+	}
+	return (f.rnd.Float64() - 0.5) * math.Pow(10, float64(f.rnd.Intn(20)))
+}
+
+// fuzzResult is the outcome of the RPCs made for -fuzz.
+type fuzzResult struct {
+	// the number of RPCs that completed with each status code
+	counts map[codes.Code]int
+	// the first request that resulted in each status code
+	examples map[codes.Code]proto.Message
+}
+
+// runFuzzMethod invokes the given method with random requests, for -fuzz, and
+// prints a summary of the resulting status codes.
+func runFuzzMethod(ctx context.Context, descSource grpcurl.DescriptorSource, ch grpcdynamic.Channel, symbol string, headers []string, format grpcurl.Format, compactJSON bool, verbose bool) {
+	mtd, err := findMethod(descSource, symbol)
+	if err != nil {
+		fail(err, "Failed to resolve method %q", symbol)
+	}
+	options := grpcurl.FormatOptions{
+		EmitJSONDefaultFields: *emitDefaults,
+		UseProtoNames:         *useProtoNames,
+		CompactJSON:           compactJSON,
+	}
+	formatter := newProtoscopeFormatter(*keepUnknown)
+	if format != "protoscope" {
+		_, formatter, err = grpcurl.RequestParserAndFormatter(format, descSource, nil, options)
+		if err != nil {
+			fail(err, "Failed to construct formatter for %q", format)
+		}
+	}
+	seed := *fuzzSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	var out io.Writer
+	if verbose {
+		out = os.Stdout
+	}
+	result := runFuzz(ctx, out, descSource, ch, mtd, headers, formatter, *fuzzCount, seed)
+	if out != nil {
+		fmt.Println()
+	}
+	result.print(os.Stdout, mtd, seed, formatter)
+}
+
+// runFuzz invokes the given method with count random requests, one per RPC,
+// generated using the given seed. If out is non-nil, each request and its
+// status is printed to it. It stops early if the given context is done.
+func runFuzz(ctx context.Context, out io.Writer, source grpcurl.DescriptorSource, ch grpcdynamic.Channel, mtd *desc.MethodDescriptor, headers []string, formatter grpcurl.Formatter, count int, seed int64) fuzzResult {
+	result := fuzzResult{counts: map[codes.Code]int{}, examples: map[codes.Code]proto.Message{}}
+	fuzzer := newRequestFuzzer(seed)
+	for i := 1; i <= count && ctx.Err() == nil; i++ {
+		req := fuzzer.message(mtd.GetInputType(), 0)
+		sent := false
+		supplier := func(m proto.Message) error {
+			if sent {
+				return io.EOF
+			}
+			sent = true
+			b, err := req.Marshal()
+			if err != nil {
+				return err
+			}
+			return proto.Unmarshal(b, m)
+		}
+		h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: formatter}
+		err := grpcurl.InvokeRPC(ctx, source, ch, mtd.GetFullyQualifiedName(), headers, h, supplier)
+		stat := h.Status
+		if err != nil {
+			stat = status.Convert(err)
+		}
+		result.counts[stat.Code()]++
+		if _, ok := result.examples[stat.Code()]; !ok {
+			result.examples[stat.Code()] = req
+		}
+		if out != nil {
+			str, err := formatter(req)
+			if err != nil {
+				str = fmt.Sprintf("(could not format request: %v)", err)
+			}
+			fmt.Fprintf(out, "Request %d:\n%s\nStatus: %s", i, str, stat.Code())
+			if stat.Message() != "" {
+				fmt.Fprintf(out, ": %s", stat.Message())
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	return result
+}
+
+// print writes a summary of the result to w: the number of RPCs that
+// completed with each status code and, for each non-OK status, the first
+// request that resulted in it.
+func (r fuzzResult) print(w io.Writer, mtd *desc.MethodDescriptor, seed int64, formatter grpcurl.Formatter) {
+	total := 0
+	var statusCodes []codes.Code
+	for code, n := range r.counts {
+		total += n
+		statusCodes = append(statusCodes, code)
+	}
+	sort.Slice(statusCodes, func(i, j int) bool {
+		return statusCodes[i] < statusCodes[j]
+	})
+	fmt.Fprintf(w, "Made %d calls to %s with random requests (seed %d):\n", total, mtd.GetFullyQualifiedName(), seed)
+	for _, code := range statusCodes {
+		fmt.Fprintf(w, "  %-20s %d\n", code, r.counts[code])
+	}
+	for _, code := range statusCodes {
+		if code == codes.OK {
+			continue
+		}
+		str, err := formatter(r.examples[code])
+		if err != nil {
+			str = fmt.Sprintf("(could not format request: %v)", err)
+		}
+		fmt.Fprintf(w, "\nFirst request that resulted in %s:\n%s\n", code, str)
+	}
+}
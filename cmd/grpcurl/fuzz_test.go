@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/jsonpb"             //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic"         //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRequestFuzzer(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"svc.proto": `syntax = "proto2";
+package svc;
+import "google/protobuf/timestamp.proto";
+enum Color { RED = 1; GREEN = 5; BLUE = 9; }
+message Request {
+  required string id = 1;
+  optional Color color = 2;
+  repeated double values = 3;
+  map<int64, Request> children = 4;
+  oneof choice {
+    string name = 5;
+    uint64 number = 6;
+    Request nested = 7;
+  }
+  optional google.protobuf.Timestamp at = 8;
+  optional bytes data = 9;
+}`,
+		}),
+	}
+	fds, err := p.ParseFiles("svc.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	md := fds[0].FindMessage("svc.Request")
+
+	fuzzer := newRequestFuzzer(42)
+	var first []byte
+	oneofs := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		msg := fuzzer.message(md, 0)
+		b, err := msg.Marshal()
+		if err != nil {
+			t.Fatalf("request %d could not be encoded: %v", i, err)
+		}
+		if i == 0 {
+			first = b
+		}
+		checkFuzzedMessage(t, msg, oneofs)
+		// every request can be formatted
+		if _, err := (&jsonpb.Marshaler{}).MarshalToString(msg); err != nil {
+			t.Fatalf("request %d could not be formatted: %v", i, err)
+		}
+	}
+	for _, name := range []string{"", "name", "number", "nested"} {
+		if !oneofs[name] {
+			t.Errorf("oneof was never set to %q", name)
+		}
+	}
+
+	// the same seed results in the same requests
+	b, err := newRequestFuzzer(42).message(md, 0).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(first) {
+		t.Error("expected the same request for the same seed")
+	}
+}
+
+func checkFuzzedMessage(t *testing.T, msg *dynamic.Message, oneofs map[string]bool) {
+	t.Helper()
+	if !msg.HasFieldName("id") {
+		t.Fatal("required field was not set")
+	}
+	if !utf8.ValidString(msg.GetFieldByName("id").(string)) {
+		t.Fatal("string is not valid UTF-8")
+	}
+	if msg.HasFieldName("color") {
+		switch msg.GetFieldByName("color").(int32) {
+		case 1, 5, 9:
+		default:
+			t.Fatalf("undeclared enum value %v", msg.GetFieldByName("color"))
+		}
+	}
+	set := ""
+	for _, name := range []string{"name", "number", "nested"} {
+		if msg.HasFieldName(name) {
+			if set != "" {
+				t.Fatalf("both %s and %s of oneof are set", set, name)
+			}
+			set = name
+		}
+	}
+	oneofs[set] = true
+	if msg.HasFieldName("at") {
+		var ts timestamppb.Timestamp
+		if err := msg.GetFieldByName("at").(*dynamic.Message).ConvertTo(&ts); err != nil {
+			t.Fatal(err)
+		}
+		if err := ts.CheckValid(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range msg.GetFieldByName("children").(map[interface{}]interface{}) {
+		checkFuzzedMessage(t, v.(*dynamic.Message), oneofs)
+	}
+	if msg.HasFieldName("nested") {
+		checkFuzzedMessage(t, msg.GetFieldByName("nested").(*dynamic.Message), oneofs)
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"     //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// runAsHTTP translates the request for the given method into the equivalent
+// REST calls, for -as-http, and either prints them as curl commands or makes
+// the first one, exiting with an error code per the given policy if its status
+// is not OK.
+func runAsHTTP(ctx context.Context, descSource grpcurl.DescriptorSource, symbol, baseURL string, headers []string, format grpcurl.Format, verbose bool, exitPolicy statusExitPolicy) {
+	mtd, err := findMethod(descSource, symbol)
+	if err != nil {
+		fail(err, "Failed to resolve method %q", symbol)
+	}
+	in, err := openRequestData(requestData, format)
+	if err != nil {
+		fail(err, "Failed to read request data")
+	}
+	if *dTemplate {
+		if in, err = expandRequestTemplate(in); err != nil {
+			fail(err, "Failed to process request data template")
+		}
+	}
+	defer in.Close()
+	options := grpcurl.FormatOptions{AllowUnknownFields: *allowUnknownFields}
+	rf, _, err := grpcurl.RequestParserAndFormatter(format, descSource, in, options)
+	if err != nil {
+		fail(err, "Failed to construct request parser for %q", format)
+	}
+	req, err := singleRequest(rf, mtd.GetInputType())
+	if err != nil {
+		fail(err, "Failed to parse request")
+	}
+	translator := &httpCallTranslator{
+		useProtoNames: *useProtoNames,
+		anyResolver:   grpcurl.AnyResolverFromDescriptorSource(descSource),
+	}
+	calls, err := translator.httpCalls(mtd, req)
+	if err != nil {
+		fail(err, "Failed to translate request into a REST call")
+	}
+	httpHeaders := gatewayHeaders(headers)
+	if *asHTTP == "show" {
+		for i, call := range calls {
+			if len(calls) > 1 {
+				fmt.Printf("# binding %d of %d\n", i+1, len(calls))
+			}
+			fmt.Println(call.curlCommand(baseURL, httpHeaders))
+		}
+		return
+	}
+	st, err := calls[0].do(ctx, baseURL, httpHeaders, *insecure, verbose, os.Stdout)
+	if err != nil {
+		fail(err, "Failed to make REST call")
+	}
+	if st != nil {
+		grpcurl.PrintStatusWithDetailTables(os.Stderr, st, nil)
+		if code, ok := exitPolicy.exitCode(st.Code()); ok {
+			exit(code)
+		}
+	}
+}
+
+// httpCall is a REST call that is equivalent to an RPC, per one of the
+// google.api.http bindings of its method, as translated by a gateway like
+// grpc-gateway.
+type httpCall struct {
+	method string
+	// path is the path, with its variables bound to the request's fields,
+	// and the query string, if any
+	path string
+	// body is the JSON request body, or nil if there is none
+	body []byte
+}
+
+// httpCallTranslator translates requests into REST calls.
+type httpCallTranslator struct {
+	// useProtoNames is whether fields are named as in the proto sources,
+	// instead of by their JSON names, in the body and query string
+	useProtoNames bool
+	anyResolver   jsonpb.AnyResolver
+}
+
+// httpCalls returns a REST call for each of the google.api.http bindings of
+// the given method, for the given request.
+func (t *httpCallTranslator) httpCalls(mtd *desc.MethodDescriptor, req *dynamic.Message) ([]*httpCall, error) {
+	if mtd.IsClientStreaming() {
+		return nil, fmt.Errorf("method %s is client-streaming, which cannot be called via REST", mtd.GetFullyQualifiedName())
+	}
+	rules := httpRules(mtd)
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("method %s has no google.api.http annotation", mtd.GetFullyQualifiedName())
+	}
+	var calls []*httpCall
+	for i, rule := range rules {
+		call, err := t.httpCall(mtd, rule, req)
+		if err != nil {
+			if len(rules) > 1 {
+				return nil, fmt.Errorf("binding %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// singleRequest returns the only request from the given parser, or an empty
+// request if there is none.
+func singleRequest(rf grpcurl.RequestParser, md *desc.MessageDescriptor) (*dynamic.Message, error) {
+	req := dynamic.NewMessage(md)
+	if err := rf.Next(req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err := rf.Next(dynamic.NewMessage(md)); err == nil {
+		return nil, fmt.Errorf("only a single request is supported")
+	} else if err != io.EOF {
+		return nil, err
+	}
+	return req, nil
+}
+
+// httpCall returns the REST call for the given binding and request, per the
+// semantics described in google/api/http.proto: fields referenced by the path
+// template are bound to the path, the body holds the field named by the
+// rule's body (or, for '*', all other fields), and the remaining fields are
+// given as query parameters.
+func (t *httpCallTranslator) httpCall(mtd *desc.MethodDescriptor, rule *annotations.HttpRule, req *dynamic.Message) (*httpCall, error) {
+	var method, template string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, template = http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		method, template = http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		method, template = http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		method, template = http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, template = http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		method, template = strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return nil, fmt.Errorf("HTTP rule has no pattern")
+	}
+
+	b, err := req.MarshalJSONPB(&jsonpb.Marshaler{OrigName: t.useProtoNames, AnyResolver: t.anyResolver})
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	md := mtd.GetInputType()
+
+	// bind the path's variables, like '{name}' or '{name=shelves/*}'
+	var path strings.Builder
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		v, pattern, _ := strings.Cut(template[start+1:end], "=")
+		val, err := t.takeField(fields, md, v)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := queryValue(val)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("field %q is bound to the path, so it must be set to a non-empty value", v)
+		}
+		path.WriteString(template[:start])
+		if strings.Contains(pattern, "/") || strings.Contains(pattern, "**") {
+			// the value spans several segments, like 'shelves/1'
+			segments := strings.Split(s, "/")
+			for i := range segments {
+				segments[i] = url.PathEscape(segments[i])
+			}
+			path.WriteString(strings.Join(segments, "/"))
+		} else {
+			path.WriteString(url.PathEscape(s))
+		}
+		template = template[end+1:]
+	}
+	path.WriteString(template)
+
+	call := &httpCall{method: method}
+	switch body := rule.GetBody(); body {
+	case "":
+	case "*":
+		if call.body, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+		fields = nil
+	default:
+		fld := md.FindFieldByName(body)
+		if fld == nil {
+			return nil, fmt.Errorf("body field %q not found in %s", body, md.GetFullyQualifiedName())
+		}
+		val, ok := fields[t.fieldName(fld)]
+		delete(fields, t.fieldName(fld))
+		if !ok {
+			switch {
+			case fld.IsRepeated() && !fld.IsMap():
+				val = []interface{}{}
+			case fld.GetMessageType() != nil:
+				val = map[string]interface{}{}
+			}
+		}
+		if call.body, err = json.Marshal(val); err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{}
+	if err := t.addQueryParams(query, "", md, fields); err != nil {
+		return nil, err
+	}
+	call.path = path.String()
+	if len(query) > 0 {
+		call.path += "?" + query.Encode()
+	}
+	return call, nil
+}
+
+// takeField removes the value of the field with the given dot-separated path
+// of names from the given JSON object, and returns it.
+func (t *httpCallTranslator) takeField(fields map[string]interface{}, md *desc.MessageDescriptor, fieldPath string) (interface{}, error) {
+	names := strings.Split(fieldPath, ".")
+	for i, name := range names {
+		if md == nil {
+			return nil, fmt.Errorf("field path %q refers to a field of a non-message", fieldPath)
+		}
+		fld := md.FindFieldByName(name)
+		if fld == nil {
+			return nil, fmt.Errorf("field %q not found in %s", name, md.GetFullyQualifiedName())
+		}
+		val := fields[t.fieldName(fld)]
+		if i == len(names)-1 {
+			delete(fields, t.fieldName(fld))
+			return val, nil
+		}
+		if fields, _ = val.(map[string]interface{}); fields == nil {
+			return nil, nil
+		}
+		md = fld.GetMessageType()
+	}
+	return nil, nil
+}
+
+// addQueryParams adds the given fields, of the given message, to the query,
+// with the names of nested fields joined by dots.
+func (t *httpCallTranslator) addQueryParams(query url.Values, prefix string, md *desc.MessageDescriptor, fields map[string]interface{}) error {
+	found := 0
+	for _, fld := range md.GetFields() {
+		name := t.fieldName(fld)
+		val, ok := fields[name]
+		if !ok {
+			continue
+		}
+		found++
+		if s, ok := queryValue(val); ok {
+			query.Add(prefix+name, s)
+			continue
+		}
+		switch val := val.(type) {
+		case []interface{}:
+			for _, elem := range val {
+				s, ok := queryValue(elem)
+				if !ok {
+					return fmt.Errorf("field %q cannot be given as a query parameter; it must be bound to the body", prefix+name)
+				}
+				query.Add(prefix+name, s)
+			}
+		case map[string]interface{}:
+			if fld.IsMap() || fld.GetMessageType() == nil {
+				return fmt.Errorf("field %q cannot be given as a query parameter; it must be bound to the body", prefix+name)
+			}
+			if err := t.addQueryParams(query, prefix+name+".", fld.GetMessageType(), val); err != nil {
+				return err
+			}
+		}
+	}
+	if found < len(fields) {
+		// the JSON form of some well-known types, like google.protobuf.Struct,
+		// is not an object with the message's fields
+		return fmt.Errorf("field %q cannot be given as a query parameter; it must be bound to the body", strings.TrimSuffix(prefix, "."))
+	}
+	return nil
+}
+
+func (t *httpCallTranslator) fieldName(fld *desc.FieldDescriptor) string {
+	if t.useProtoNames {
+		return fld.GetName()
+	}
+	return fld.GetJSONName()
+}
+
+// queryValue returns the given JSON value as a string, if it is a scalar.
+func queryValue(val interface{}) (string, bool) {
+	switch val := val.(type) {
+	case string:
+		return val, true
+	case json.Number:
+		return val.String(), true
+	case bool:
+		if val {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+// httpBaseURL returns the URL of the gateway at the given address, which must
+// be in 'host:port' form, with the given path prefix, if any.
+func httpBaseURL(address string, useTLS bool, pathPrefix string) (string, error) {
+	if strings.Contains(address, "://") || isMultiAddressTarget(address) {
+		return "", fmt.Errorf("the address must be an 'http://' or 'https://' URL or in 'host:port' form")
+	}
+	if useTLS {
+		return "https://" + address + pathPrefix, nil
+	}
+	return "http://" + address + pathPrefix, nil
+}
+
+// gatewayHeaders converts headers, in 'name: value' form, into the HTTP
+// headers from which a gateway like grpc-gateway derives the RPC's metadata:
+// the authorization header is passed as is, and others have a
+// 'Grpc-Metadata-' prefix.
+func gatewayHeaders(headers []string) [][2]string {
+	var result [][2]string
+	for _, h := range headers {
+		name, val, ok := strings.Cut(h, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "authorization" {
+			name = "Grpc-Metadata-" + name
+		}
+		result = append(result, [2]string{name, strings.TrimSpace(val)})
+	}
+	return result
+}
+
+// curlCommand returns a curl command line that makes the given call to the
+// gateway at the given URL.
+func (c *httpCall) curlCommand(baseURL string, headers [][2]string) string {
+	words := []string{"curl"}
+	if c.method != http.MethodGet {
+		words = append(words, "-X", c.method)
+	}
+	words = append(words, shellQuote(baseURL+c.path))
+	for _, h := range headers {
+		words = append(words, "-H", shellQuote(h[0]+": "+h[1]))
+	}
+	if c.body != nil {
+		words = append(words, "-H", shellQuote("Content-Type: application/json"), "-d", shellQuote(string(c.body)))
+	}
+	return strings.Join(words, " ")
+}
+
+// do makes the given call to the gateway at the given URL, writing the
+// response's body to out. In verbose mode, the response's status line and
+// headers are written first. The returned status describes an unsuccessful
+// response, from the code and message in its body if it is a JSON-encoded
+// google.rpc.Status, as grpc-gateway returns.
+func (c *httpCall) do(ctx context.Context, baseURL string, headers [][2]string, insecureSkipVerify, verbose bool, out io.Writer) (*status.Status, error) {
+	var body io.Reader
+	if c.body != nil {
+		body = bytes.NewReader(c.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.method, baseURL+c.path, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		req.Header.Add(h[0], h[1])
+	}
+	if c.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		fmt.Fprintf(out, "\n%s %s\n", resp.Proto, resp.Status)
+		_ = resp.Header.Write(out)
+		fmt.Fprintln(out)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = out.Write(b)
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			fmt.Fprintln(out)
+		}
+		return nil, nil
+	}
+	var errBody struct {
+		Code    *int32 `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(b, &errBody) == nil && errBody.Code != nil {
+		return status.New(codes.Code(*errBody.Code), errBody.Message), nil
+	}
+	return status.Newf(codes.Unknown, "gateway returned %s: %s", resp.Status, strings.TrimSpace(string(b))), nil
+}
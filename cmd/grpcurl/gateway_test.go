@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"            //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic"         //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func loadLibraryMethod(t *testing.T, name string) *desc.MethodDescriptor {
+	t.Helper()
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"google/api/http.proto": testHTTPProto,
+			"library.proto":         testLibraryProto,
+		}),
+	}
+	fds, err := p.ParseFiles("library.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	mtd := fds[0].FindService("library.Library").FindMethodByName(name)
+	if mtd == nil {
+		t.Fatalf("method %s not found", name)
+	}
+	return mtd
+}
+
+func TestHTTPCalls(t *testing.T) {
+	translator := &httpCallTranslator{}
+	testCases := []struct {
+		method   string
+		request  string
+		expected []httpCall
+	}{
+		{
+			method:  "GetBook",
+			request: `{"name": "shelves/1/books/2", "includeReviews": true, "filter": {"pageCount": 3, "genre": "FICTION"}}`,
+			expected: []httpCall{
+				{method: "GET", path: "/v1/shelves/1/books/2?filter.genre=FICTION&filter.pageCount=3&includeReviews=true"},
+				{method: "GET", path: "/v1/books/shelves%2F1%2Fbooks%2F2?filter.genre=FICTION&filter.pageCount=3&includeReviews=true"},
+			},
+		},
+		{
+			method:  "CreateBook",
+			request: `{"parent": "shelves/1", "book": {"name": "Dune"}}`,
+			expected: []httpCall{
+				{method: "POST", path: "/v1/shelves/1/books", body: []byte(`{"name":"Dune"}`)},
+			},
+		},
+		{
+			method:  "CreateBook",
+			request: `{"parent": "shelves/1"}`,
+			expected: []httpCall{
+				{method: "POST", path: "/v1/shelves/1/books", body: []byte(`{}`)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		mtd := loadLibraryMethod(t, tc.method)
+		req := dynamic.NewMessage(mtd.GetInputType())
+		if err := req.UnmarshalJSON([]byte(tc.request)); err != nil {
+			t.Fatal(err)
+		}
+		calls, err := translator.httpCalls(mtd, req)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.method, err)
+			continue
+		}
+		if len(calls) != len(tc.expected) {
+			t.Errorf("%s: expected %d calls, got %d", tc.method, len(tc.expected), len(calls))
+			continue
+		}
+		for i, call := range calls {
+			exp := tc.expected[i]
+			if call.method != exp.method || call.path != exp.path || !bytes.Equal(call.body, exp.body) {
+				t.Errorf("%s: expected %s %s %s, got %s %s %s", tc.method, exp.method, exp.path, exp.body, call.method, call.path, call.body)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		method, request string
+	}{
+		// the name is bound to the path
+		{"GetBook", `{}`},
+		// a repeated message cannot be a query parameter
+		{"GetBook", `{"name": "shelves/1/books/2", "filter": {"related": [{"name": "x"}]}}`},
+		// no google.api.http annotation
+		{"Ping", `{}`},
+	} {
+		mtd := loadLibraryMethod(t, tc.method)
+		req := dynamic.NewMessage(mtd.GetInputType())
+		if err := req.UnmarshalJSON([]byte(tc.request)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := translator.httpCalls(mtd, req); err == nil {
+			t.Errorf("%s %s: expected error", tc.method, tc.request)
+		}
+	}
+
+	// with proto names
+	mtd := loadLibraryMethod(t, "GetBook")
+	req := dynamic.NewMessage(mtd.GetInputType())
+	if err := req.UnmarshalJSON([]byte(`{"name": "b", "includeReviews": true}`)); err != nil {
+		t.Fatal(err)
+	}
+	calls, err := (&httpCallTranslator{useProtoNames: true}).httpCalls(mtd, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/v1/books/b?include_reviews=true"; calls[1].path != expected {
+		t.Errorf("expected %s, got %s", expected, calls[1].path)
+	}
+}
+
+func TestSingleRequest(t *testing.T) {
+	mtd := loadLibraryMethod(t, "Ping")
+	for _, tc := range []struct {
+		data      string
+		expectErr bool
+	}{
+		{``, false},
+		{`{"name": "a"}`, false},
+		{`{"name": "a"} {"name": "b"}`, true},
+		{`{"name": `, true},
+	} {
+		rf := grpcurl.NewJSONRequestParser(strings.NewReader(tc.data), nil)
+		_, err := singleRequest(rf, mtd.GetInputType())
+		if (err != nil) != tc.expectErr {
+			t.Errorf("%q: unexpected error result: %v", tc.data, err)
+		}
+	}
+}
+
+func TestCurlCommand(t *testing.T) {
+	headers := gatewayHeaders([]string{"Authorization: Bearer abc", "x-tenant: a b"})
+	call := &httpCall{method: "POST", path: "/v1/shelves/1/books", body: []byte(`{"name":"Don't"}`)}
+	expected := `curl -X POST https://api.example.com/v1/shelves/1/books -H 'authorization: Bearer abc' -H 'Grpc-Metadata-x-tenant: a b' -H 'Content-Type: application/json' -d '{"name":"Don'\''t"}'`
+	if actual := call.curlCommand("https://api.example.com", headers); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+	call = &httpCall{method: "GET", path: "/v1/books/1?includeReviews=true"}
+	expected = `curl 'https://api.example.com/v1/books/1?includeReviews=true'`
+	if actual := call.curlCommand("https://api.example.com", nil); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestHTTPBaseURL(t *testing.T) {
+	testCases := []struct {
+		address  string
+		useTLS   bool
+		prefix   string
+		expected string
+	}{
+		{"api.example.com:443", true, "", "https://api.example.com:443"},
+		{"localhost:8080", false, "/tenant-a", "http://localhost:8080/tenant-a"},
+	}
+	for _, tc := range testCases {
+		actual, err := httpBaseURL(tc.address, tc.useTLS, tc.prefix)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.address, err)
+		} else if actual != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.address, tc.expected, actual)
+		}
+	}
+	for _, address := range []string{"unix:///tmp/sock", "host1:443,host2:443"} {
+		if _, err := httpBaseURL(address, true, ""); err == nil {
+			t.Errorf("expected error for %q", address)
+		}
+	}
+}
+
+func TestHTTPCallDo(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/books/1" && r.Header.Get("Grpc-Metadata-x-tenant") == "a":
+			_, _ = w.Write([]byte(`{"name":"1"}`))
+		case r.URL.Path == "/v1/books/2":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":5,"message":"book 2 not found","details":[]}`))
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer svr.Close()
+	headers := gatewayHeaders([]string{"x-tenant: a"})
+
+	var out bytes.Buffer
+	st, err := (&httpCall{method: "GET", path: "/v1/books/1"}).do(context.Background(), svr.URL, headers, false, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil {
+		t.Errorf("unexpected status: %v", st)
+	}
+	if out.String() != "{\"name\":\"1\"}\n" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+
+	out.Reset()
+	st, err = (&httpCall{method: "GET", path: "/v1/books/2"}).do(context.Background(), svr.URL, headers, false, true, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Code() != codes.NotFound || st.Message() != "book 2 not found" {
+		t.Errorf("unexpected status: %v", st)
+	}
+	if !strings.Contains(out.String(), "404 Not Found") {
+		t.Errorf("verbose output should include the status line: %q", out.String())
+	}
+
+	st, err = (&httpCall{method: "GET", path: "/v1/books/3"}).do(context.Background(), svr.URL, headers, false, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Code() != codes.Unknown || !strings.Contains(st.Message(), "502 Bad Gateway") {
+		t.Errorf("unexpected status: %v", st)
+	}
+}
@@ -4,12 +4,9 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"io"
 	"math"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -17,18 +14,12 @@ import (
 	"time"
 
 	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
-	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/alts"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/keepalive"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/descriptorpb"
 
-	// Register gzip compressor so compressed responses will work
-	_ "google.golang.org/grpc/encoding/gzip"
 	// Register xds so xds and xds-experimental resolver schemes work
 	_ "google.golang.org/grpc/xds"
 
@@ -40,6 +31,20 @@ import (
 // the response status codes emitted use an offset of 64
 const statusCodeOffset = 64
 
+// The exit code used when an RPC succeeds but takes longer than the
+// duration given via -max-latency.
+const latencyExceededExitCode = 3
+
+// The exit code used when the 'diff' verb finds differences.
+const diffFoundExitCode = 4
+
+// The exit code used when the 'validate' verb finds invalid request data.
+const invalidRequestExitCode = 5
+
+// The exit code used when an RPC does not meet an expectation given via
+// -expect-status, -expect-response-contains, or -expect-jq.
+const expectationFailedExitCode = 6
+
 const noVersion = "dev build <no version set>"
 
 var version = noVersion
@@ -62,16 +67,48 @@ var (
 		Skip server certificate and domain verification. (NOT SECURE!) Not
 		valid with -plaintext option.`))
 
+	tofu = flags.Bool("tofu", false, prettify(`
+		Trust the server's certificate on first use, instead of verifying it
+		using trusted root certificates. The first time grpcurl connects to an
+		address, the fingerprint of the certificate is recorded in the file
+		given via -known-hosts. Later connections fail if the server presents
+		a different certificate. This is a safer alternative to -insecure for
+		servers with self-signed certificates. Not valid with -plaintext or
+		-insecure options.`))
+	knownHostsFile = flags.String("known-hosts", "", prettify(`
+		The file in which -tofu records certificate fingerprints. Defaults to
+		.grpcurl/known_hosts in the user's home directory.`))
+
 	// TLS Options
 	cacert = flags.String("cacert", "", prettify(`
 		File containing trusted root certificates for verifying the server.
-		Ignored if -insecure is specified.`))
+		Ignored if -insecure, -tofu, or -pinned-cert is specified.`))
 	cert = flags.String("cert", "", prettify(`
 		File containing client certificate (public key), to present to the
 		server. Not valid with -plaintext option. Must also provide -key option.`))
 	key = flags.String("key", "", prettify(`
 		File containing client private key, to present to the server. Not valid
 		with -plaintext option. Must also provide -cert option.`))
+	keyProvider = flags.String("key-provider", "", prettify(`
+		A PKCS#11 URI, like 'pkcs11:token=name;object=label?module-path=lib.so',
+		identifying a client private key in a hardware security module or smart
+		card, to use instead of -key. The PIN, if the token requires one, is
+		given with the pin-value or pin-source query attribute. The client
+		certificate is read from -cert or, if that is not present, from the
+		token. Requires a build of grpcurl with cgo enabled.`))
+	tlsMinVersion = flags.String("tls-min-version", "", prettify(`
+		The minimum TLS version to negotiate: 1.0, 1.1, 1.2, or 1.3. Defaults
+		to 1.2.`))
+	tlsMaxVersion = flags.String("tls-max-version", "", prettify(`
+		The maximum TLS version to negotiate: 1.0, 1.1, 1.2, or 1.3. Defaults
+		to 1.3.`))
+	ciphers = flags.String("ciphers", "", prettify(`
+		A comma-separated list of the cipher suites to offer for TLS 1.2 and
+		earlier, using the names in Go's crypto/tls package, like
+		'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256'. The cipher suites of TLS 1.3
+		cannot be configured, so use -tls-max-version 1.2 to use only the given
+		suites. In verbose mode, the negotiated TLS version, cipher suite, and
+		ALPN protocol are shown.`))
 
 	// ALTS Options
 	usealts = flags.Bool("alts", false, prettify(`
@@ -80,11 +117,24 @@ var (
 	altsTargetServiceAccounts    multiString
 
 	protoset      multiString
+	protosetHdrs  multiString
 	protoFiles    multiString
+	protoExcludes multiString
 	importPaths   multiString
+	requestData   multiString
 	addlHeaders   multiString
 	rpcHeaders    multiString
 	reflHeaders   multiString
+	headerFiles   multiString
+	alsoOutputs   multiString
+	mockSessions  multiString
+	resolveAddrs  multiString
+	altAddresses  multiString
+	pinnedCerts   multiString
+	templateOneof multiString
+	expectSubstrs multiString
+	expectJQ      multiString
+	batchVars     multiString
 	expandHeaders = flags.Bool("expand-headers", false, prettify(`
 		If set, headers may use '${NAME}' syntax to reference environment
 		variables. These will be expanded to the actual environment variable
@@ -101,25 +151,36 @@ var (
 		server's certificate. It defaults to the address that is provided in the
 		positional arguments, or 'localhost' in the case of a unix domain
 		socket.`))
+	pathPrefix = flags.String("path-prefix", "", prettify(`
+		A prefix, like '/tenant-a', added to the HTTP/2 ":path" pseudo-header
+		of every RPC, including those for server reflection, for gateways that
+		route gRPC traffic by path. If the address is an 'http://' or
+		'https://' URL with a path, that path is the default prefix.`))
 	userAgent = flags.String("user-agent", "", prettify(`
 		If set, the specified value will be added to the User-Agent header set
 		by the grpc-go library.
 		`))
-	data = flags.String("d", "", prettify(`
-		Data for request contents. If the value is '@' then the request contents
-		are read from stdin. For calls that accept a stream of requests, the
-		contents should include all such request messages concatenated together
-		(possibly delimited; see -format).`))
 	format = flags.String("format", "json", prettify(`
-		The format of request data. The allowed values are 'json' or 'text'. For
+		The format of request data. The allowed values are 'json', 'text',
+		'csv', or another format registered with the grpcurl library. For
 		'json', the input data must be in JSON format. Multiple request values
 		may be concatenated (messages with a JSON representation other than
-		object must be separated by whitespace, such as a newline). For 'text',
-		the input data must be in the protobuf text format, in which case
-		multiple request values must be separated by the "record separator"
-		ASCII character: 0x1E. The stream should not end in a record separator.
-		If it does, it will be interpreted as a final, blank message after the
-		separator.`))
+		object must be separated by whitespace, such as a newline). For
+		'text', the input data must be in the protobuf text format, in which
+		case multiple request values must be separated by the "record
+		separator" ASCII character: 0x1E. The stream should not end in a
+		record separator. If it does, it will be interpreted as a final, blank
+		message after the separator. For 'csv', each row of the input after the header row is
+		converted into a request message, using the mapping of columns to
+		fields given via -csv-mapping; responses are printed in json format
+		unless -format-out is present.`))
+	csvMapping = flags.String("csv-mapping", "", prettify(`
+		A YAML file that maps CSV column names to request fields, for use with
+		'-format csv'. It has a 'columns' key, whose value maps each column
+		name to a field name or, for a nested field, a dot-separated path like
+		'customer.id'. Columns that are not mapped are ignored and empty cells
+		are omitted. Cells for message, repeated, and map fields must contain
+		JSON.`))
 	allowUnknownFields = flags.Bool("allow-unknown-fields", false, prettify(`
 		When true, the request contents, if 'json' format is used, allows
 		unknown fields to be present. They will be ignored when parsing
@@ -127,25 +188,252 @@ var (
 	connectTimeout = flags.Float64("connect-timeout", 0, prettify(`
 		The maximum time, in seconds, to wait for connection to be established.
 		Defaults to 10 seconds.`))
+	configPath = flags.String("config", "", prettify(`
+		A YAML file with named profiles that provide defaults for the
+		-connect-timeout and -max-time flags. The file has a 'profiles' map,
+		and each profile may set 'connect-timeout' and 'max-time' (in seconds)
+		along with a 'methods' map that overrides them for particular methods
+		or services, keyed by fully-qualified name (such as
+		'my.pkg.Service/SlowMethod' or 'my.pkg.Service'). Flags given on the
+		command line or via the environment take precedence. Defaults to
+		.grpcurl/config.yaml in the user's home directory, which is only used
+		if it exists.`))
+	profileName = flags.String("profile", "", prettify(`
+		The name of the profile in the -config file to use. Defaults to the
+		profile named 'default'.`))
 	formatError = flags.Bool("format-error", false, prettify(`
 		When a non-zero status is returned, format the response using the
 		value set by the -format flag .`))
+	failWithBody = flags.Bool("fail", false, prettify(`
+		When a non-zero status is returned, print the status, formatted using
+		the value set by the -format flag (as with -format-error), to stdout
+		after any response messages instead of to stderr. The exit code is
+		still non-zero (see 'Exit status' in the usage). This allows the whole
+		result of a failed call to be captured from stdout while the failure
+		is detected from the exit code.`))
+	exitCodeMode = flags.String("exit-code-mode", "offset", prettify(`
+		How the exit code reflects an RPC that completes with a non-OK status.
+		With 'offset', the default, the exit code is 64 plus the status code.
+		With 'passthrough', the exit code is the status code itself, which may
+		then be confused with grpcurl's own exit codes for errors. With 'curl',
+		the exit code is zero regardless of the status, so only failures to
+		complete the RPC, such as connection errors, result in a non-zero exit
+		code. See 'Exit status' in the usage.`))
+	failOnCodes = flags.String("fail-on-codes", "", prettify(`
+		A comma-separated list of status codes, either numbers or names like
+		NOT_FOUND, that cause a non-zero exit code. Other non-OK statuses
+		result in an exit code of zero. Cannot be used with -ok-codes or with
+		an -exit-code-mode of 'curl'.`))
+	okCodes = flags.String("ok-codes", "", prettify(`
+		A comma-separated list of status codes, either numbers or names like
+		NOT_FOUND, that result in an exit code of zero, like OK. Cannot be
+		used with -fail-on-codes or with an -exit-code-mode of 'curl'.`))
 	keepaliveTime = flags.Float64("keepalive-time", 0, prettify(`
 		If present, the maximum idle time in seconds, after which a keepalive
 		probe is sent. If the connection remains idle and no keepalive response
-		is received for this same period then the connection is closed and the
-		operation fails.`))
+		is received for this same period (or for -keepalive-timeout, if
+		present) then the connection is closed and the operation fails.`))
+	keepaliveTimeout = flags.Float64("keepalive-timeout", 0, prettify(`
+		The time in seconds to wait for a response to a keepalive probe before
+		closing the connection. If not present, the value of -keepalive-time
+		is used. Only used with -keepalive-time.`))
+	keepalivePermitWithoutStream = flags.Bool("keepalive-permit-without-stream", false, prettify(`
+		If true, keepalive probes are sent even when there are no calls in
+		progress on the connection. Together with -keepalive-time and
+		-keepalive-timeout, this reproduces the keepalive behavior of a
+		production client, for debugging connections that are dropped while
+		idle, such as by a load balancer. Note that servers may close
+		connections whose keepalive probes are too frequent. Only used with
+		-keepalive-time.`))
 	maxTime = flags.Float64("max-time", 0, prettify(`
 		The maximum total time the operation can take, in seconds. This sets a
                 timeout on the gRPC context, allowing both client and server to give up
 		after the deadline has past. This is useful for preventing batch jobs
                 that use grpcurl from hanging due to slow or bad network links or due
 		to incorrect stream method usage.`))
+	propagateDeadlineFrom = flags.String("propagate-deadline-from", "", prettify(`
+		The name of an environment variable that holds the time remaining, in
+		seconds, before a deadline that should be propagated to the RPC. This
+		is useful when grpcurl is run on behalf of a server handler, so the
+		outgoing call gives up when the handler's deadline passes, like a call
+		from an in-process client would. If the variable is not set, no
+		deadline is propagated. If -max-time is also present, the earlier of
+		the two deadlines is used.`))
+	propagateMetadata = flags.String("propagate-metadata", "", prettify(`
+		A comma-separated list of metadata keys, such as trace or request IDs,
+		to propagate from the environment to the RPC. The value for each key
+		is read from the environment variable with the same name in upper case
+		and with dashes replaced by underscores, so 'x-request-id' is read from
+		X_REQUEST_ID. To name the variable explicitly, use 'key=VAR' form.
+		Keys whose variables are not set are skipped. Like -rpc-header, these
+		are excluded from reflection requests.`))
+	maxLatency = flags.Float64("max-latency", 0, prettify(`
+		The maximum time, in seconds, that an RPC may take to complete. If the
+		final status is received after this much time has elapsed, grpcurl
+		exits with code 3 even if the RPC succeeded. Unlike -max-time, this
+		does not cause the RPC to be cancelled.`))
+	expectStatus = flags.String("expect-status", "", prettify(`
+		The status code, either a number or a name like NOT_FOUND, that the
+		RPC is expected to complete with. If it completes with a different
+		status, grpcurl exits with code 6. If it completes with this status,
+		even a non-OK one, the status does not cause a non-zero exit code.
+		Together with -expect-response-contains and -expect-jq, this allows
+		a single grpcurl command to be used as a smoke test.`))
+	batchFile = flags.String("batch", "", prettify(`
+		The name of a manifest file with calls to make, instead of invoking a
+		single method. Each line is a JSON object with the 'method' to invoke,
+		its 'headers' in "name: value" form, and its request 'data' in the
+		form accepted by -d, where data that starts with '@' names a file
+		relative to the manifest. A line may also have an 'expect' object,
+		like those written by 'export testcase', and a 'capture' object that
+		maps names to jq expressions, like {"token": ".session.token"}. Each
+		expression is evaluated against the call's last response, and later
+		calls may reference the result as '${token}' in their data and
+		headers. All calls use the same connection and descriptors. The
+		result of each call is printed as a line of JSON, in the order of the
+		manifest, with its responses, status, duration in milliseconds, and
+		whether it met its expectation and captured its variables.`))
+	batchMatrix = flags.String("batch-matrix", "", prettify(`
+		The name of a YAML file that lists environments, such as staging,
+		canary, and prod, against each of which the calls in the -batch
+		manifest are made, instead of against a single address. Its
+		'environments' key lists objects with the environment's 'name', its
+		'address', and optionally the 'headers' sent with every call and the
+		'vars' that calls may reference (see -batch-var). A top-level 'vars'
+		key gives variables for all environments. Each result is printed with
+		the name of its environment. Afterwards, a report that shows the
+		outcome of each call in each environment, and which calls had
+		different outcomes, is printed to stderr.`))
+	parallel = flags.Int("parallel", 1, prettify(`
+		The number of calls that may be in progress at once. It has two uses:
+		With -batch, it is the number of calls from the manifest that are
+		made at once, and results are still printed in the order of the
+		manifest. When invoking a unary method, the call is fanned out: each
+		request message is sent in its own call, or a single request message
+		is sent in this many calls. Responses are then printed as they
+		arrive, followed by the number of calls that completed with each
+		status code. If any call fails, the exit code is that of the lowest
+		failing status code, as when a single call fails. It is not used when
+		replaying a session.`))
+	maxResponses = flags.Int("max-responses", 0, prettify(`
+		The number of response messages after which a server-streaming or
+		bidi-streaming call is cancelled. The call is then treated as
+		successful, with an OK status, rather than CANCELLED. This is useful
+		for sampling a stream that never ends, such as one that watches for
+		changes. If not specified or zero, all responses are received.`))
+	fuzzCount = flags.Int("fuzz", 0, prettify(`
+		The number of random requests with which to invoke the method, each
+		in its own RPC, instead of using request data. Every request is valid
+		for the method's request type, with fields set at random, often to
+		edge cases like empty strings or the limits of numeric types. Enum
+		fields are set to declared values, at most one field of each oneof is
+		set, and required fields are always set. A summary of the status codes
+		is printed, with the first request that resulted in each non-OK one.
+		With -v, every request and its status are printed. This can find bugs
+		in a server's validation of requests.`))
+	asHTTP = flags.String("as-http", "", prettify(`
+		Instead of invoking the method via gRPC, translate the request into
+		the equivalent REST call, per the method's google.api.http
+		annotations, as a gateway like grpc-gateway does. With 'show', a curl
+		command is printed for each of the method's HTTP bindings. With
+		'exec', the call for the first binding is made to the address, which
+		must then be the gateway, and the response is printed. The URL is
+		based on the address, using 'http' with -plaintext, and -path-prefix.
+		Headers given via -H are sent with a 'Grpc-Metadata-' prefix, except
+		for 'authorization'. Only a single request is supported.`))
+	fuzzSeed = flags.Int64("fuzz-seed", 0, prettify(`
+		The seed used to generate random requests for -fuzz, which makes the
+		requests the same as in a previous run that printed the seed. If not
+		specified, a new seed is used each time.`))
+	junitOut = flags.String("junit-out", "", prettify(`
+		The name of a file to which a JUnit XML report of the results of the
+		'test' verb is written, for CI systems that display test results.`))
 	maxMsgSz = flags.Int("max-msg-sz", 0, prettify(`
 		The maximum encoded size of a response message, in bytes, that grpcurl
 		will accept. If not specified, defaults to 4,194,304 (4 megabytes).`))
+	formatOut = flags.String("format-out", "", prettify(`
+		The format of response data, if different from the format given via
+		-format. The allowed values are 'json', 'text', 'ndjson', 'protoscope',
+		or another format registered with the grpcurl library. With 'ndjson',
+		each response message is printed as compact JSON on a single line,
+		with no indentation or separators, which is convenient for tools that
+		process a stream of JSON values (such as 'jq -c' or log shippers).
+		With 'protoscope', each response message is printed in its wire form,
+		in the protoscope language: each field's number and raw value (with a
+		suffix like 'i32' or 'z' that shows its encoding), annotated with the
+		field's name. This shows what was really sent, which is useful when
+		the descriptor of the message is stale.`))
+	keepUnknown = flags.Bool("keep-unknown", false, prettify(`
+		When using '-format-out protoscope', include the fields of response
+		messages that are not in their descriptors, which are annotated as
+		unknown. Otherwise, they are omitted.`))
+	anyResolve = flags.String("any-resolve", "off", prettify(`
+		How to format a google.protobuf.Any message in a JSON response whose
+		type is not in the descriptors given via -protoset, -proto, or server
+		reflection. With 'off', its contents are shown as base64-encoded
+		binary data, in an "@value" property. With 'reflection', the type is
+		looked up via server reflection, even when descriptors are given via
+		-protoset or -proto, and the contents are shown as a JSON object if it
+		is found (or as binary data if not). With 'error', the response
+		cannot be formatted, and the call fails.`))
 	emitDefaults = flags.Bool("emit-defaults", false, prettify(`
 		Emit default values for JSON-encoded responses.`))
+	jqExpr = flags.String("jq", "", prettify(`
+		A jq expression that is applied to each response message before it is
+		printed, such as '.items[].name'. Each value produced by the expression
+		is printed as JSON. Error statuses are reported as usual. Requires the
+		json format.`))
+	includeMetadata = flags.Bool("include-metadata", false, prettify(`
+		Print the results of an RPC as a single JSON object with 'headers',
+		'messages', 'trailers', and 'status' properties, so that scripts can
+		consume response metadata and the status along with the response
+		messages. The status has 'code', 'name', 'message', and 'details'
+		properties. Values of binary metadata are base64-encoded. Requires the
+		json format and cannot be used with -jq, -output-template, or
+		-output-dir.`))
+	outputTemplate = flags.String("output-template", "", prettify(`
+		A Go text/template that is used to print each response message, such
+		as '{{.user.id}} {{.user.name}}'. The template is given the JSON form of
+		the message, so fields are referenced by their JSON names. A 'json'
+		function is available to print nested values as JSON. Requires the json
+		format and cannot be used with -jq.`))
+	useProtoNames = flags.Bool("use-proto-names", false, prettify(`
+		Use the original field names from the proto sources (typically
+		snake_case) in JSON output, instead of lowerCamelCase JSON names. JSON
+		input may use either form of field name.`))
+	bsrModule = flags.String("bsr", "", prettify(`
+		A module in the Buf Schema Registry, like 'buf.build/acme/payments' or
+		'buf.build/acme/payments:<reference>', whose image is fetched from the
+		registry and used to determine the RPC schema instead of querying for
+		it from the remote server via the gRPC reflection API. The reference
+		may be a commit, tag, label, or draft, and defaults to the latest
+		commit. The token in the BUF_TOKEN environment variable, if present,
+		is used to authenticate. It is an error to use -bsr with -protoset,
+		-proto, -proto-git, or -buf-workspace flags.`))
+	protoGit = flags.String("proto-git", "", prettify(`
+		A git repository of proto sources, like
+		'https://github.com/org/protos.git#ref=main&path=proto/', which is
+		fetched and compiled to determine the RPC schema instead of querying
+		for it from the remote server via the gRPC reflection API. The ref may
+		be a branch, tag, or commit, and defaults to the default branch. The
+		path is the directory in the repository that holds the protos, and
+		defaults to its root. Only the latest commit of the ref is fetched,
+		into a clone in the user's cache directory that is reused by later
+		runs. All proto files in the path are compiled unless -proto flags
+		name the files, relative to the path, to compile. The path is used as
+		the first import path. Requires the git command. It is an error to use
+		-proto-git with -protoset or -buf-workspace flags.`))
+	bufWorkspaceDir = flags.String("buf-workspace", "", prettify(`
+		A directory with a buf.work.yaml or buf.yaml file, whose modules' proto
+		sources are compiled to determine the RPC schema instead of querying
+		for it from the remote server via the gRPC reflection API. The
+		modules' directories are used as import paths, before any given via
+		-import-path, and the files that the configuration excludes are
+		omitted. All of the modules' files are compiled unless -proto flags
+		name the files to compile. Dependencies are fetched from the Buf
+		Schema Registry, at the commits pinned in buf.lock files, using the
+		token in the BUF_TOKEN environment variable if present. It is an error
+		to use -buf-workspace with -protoset flags.`))
 	protosetOut = flags.String("protoset-out", "", prettify(`
 		The name of a file to be written that will contain a FileDescriptorSet
 		proto. With the list and describe verbs, the listed or described
@@ -161,12 +449,312 @@ var (
 		this option is given, the method being invoked and its transitive
 		dependencies will be included in the generated .proto files in the
 		output directory.`))
+	listenAddr = flags.String("listen", "", prettify(`
+		The address on which to listen, in 'host:port' form, when running a
+		server with the 'mock' or 'proxy' verbs. Defaults to 'localhost:0',
+		which selects an ephemeral port.`))
+	bundleOut = flags.String("bundle-out", "", prettify(`
+		The name of the archive written by the 'support-bundle' verb. If not
+		present, the archive is written to the current directory and named
+		after the time it was created.`))
+	proxyTarget = flags.String("target", "", prettify(`
+		The address of the server to which calls are forwarded, when the
+		'proxy' verb is given before the address, or to which the calls of a
+		test suite are made, when the 'test' verb is given before the address.
+		This is an alternative to providing the address as a positional
+		argument.`))
+	watch = flags.Bool("watch", false, prettify(`
+		With the 'mock' or 'proxy' verbs, watch the files given via -protoset
+		or -proto flags (including all proto files in the import paths) and
+		reload the descriptors when they change, without restarting. Changes
+		to the schema are logged to stderr. If the new files cannot be loaded,
+		the previous descriptors remain in use.`))
+	stubsFile = flags.String("stubs", "", prettify(`
+		The name of a YAML file that defines canned responses for the 'mock'
+		verb. Methods that have no matching stub will respond with a template
+		message, like the one shown by -msg-template.`))
+	outputDir = flags.String("output-dir", "", prettify(`
+		A directory to which each response message is written, in a file of
+		its own, instead of being printed. This is useful for streams whose
+		many or large responses are processed separately later. The directory
+		is created if it does not exist. See -output-pattern.`))
+	dumpRaw = flags.String("dump-raw", "", prettify(`
+		Print or save the encoded form of each response message, as it was
+		received (after decompression), in addition to the usual output. This
+		helps investigate discrepancies between what grpcurl and another client
+		decode from the same bytes. The value may be 'hex' or 'base64', to
+		print each message after its formatted form, or 'file:' followed by the
+		name of a directory, to write each message to a file named like
+		'resp-1.bin' in the directory, which is created if necessary.`))
+	outputRawAbove = flags.Int("output-raw-above", 0, prettify(`
+		When writing responses to the -output-dir directory, each response
+		message whose encoded size, in bytes, is at least this large is written
+		to its file as it is received, in binary form, without being decoded
+		or formatted. This keeps memory use down for very large messages,
+		whose decoded and formatted forms take many times their encoded size.
+		The file is named like the others, but with a '.bin' extension. Such
+		large messages usually also require -max-msg-sz.`))
+	outputPattern = flags.String("output-pattern", "", prettify(`
+		The pattern for names of files written to the -output-dir directory,
+		in which '%d' is replaced with the number of the response, starting at
+		1. Defaults to 'resp-%d.json', or 'resp-%d.txt' for the text format.`))
+	preserveTiming = flags.Bool("preserve-timing", false, prettify(`
+		When replaying a session without an address, or serving a session
+		with the 'mock' verb, reproduce the recorded delays between response
+		messages instead of sending them all at once. See -timing-speed.`))
+	timingSpeed = flags.Float64("timing-speed", 1, prettify(`
+		A multiplier for the speed at which recorded delays are reproduced
+		with -preserve-timing. For example, 2 plays responses back twice as
+		fast as they were recorded and 0.5 plays them at half speed.`))
+	recordFile = flags.String("record", "", prettify(`
+		The name of a file to which a record of the RPC invocation is written.
+		The record includes request and response messages, metadata, the final
+		status, and the descriptors needed to interpret them. The file can
+		later be used with the 'replay' verb to re-issue the same requests.`))
+	eventsOut = flags.String("events-out", "", prettify(`
+		The name of a file to which a log of the RPC invocation's events is
+		written, as newline-delimited JSON: one object per event, with an
+		'event' field that indicates its kind, such as 'dial', 'request',
+		'response', or 'status', and the time elapsed since just before
+		connecting, in 'elapsedMs'. Messages are described by their size and
+		SHA-256 hash, rather than their contents. This allows tests to make
+		assertions about the structure of a call without parsing verbose
+		output.`))
+	statsLineFormat = flags.String("stats-line", "", prettify(`
+		After invoking or replaying a method, print a single machine-readable
+		line with the number of requests and responses, the total size of
+		their binary encoding in bytes, the duration in milliseconds, and the
+		status code. The value is the line's format: 'kv', for space-separated
+		'key=value' pairs, or 'json'. The line is written to the file
+		descriptor given via -stats-fd.`))
+	statsFD = flags.Int("stats-fd", 2, prettify(`
+		The file descriptor to which the -stats-line is written. Defaults to 2
+		(stderr). Use a descriptor opened by the shell, such as 3 with '3>file',
+		to keep the line separate from other output.`))
+	resolverExec = flags.String("resolver-exec", "", prettify(`
+		A command, run via the shell, that resolves the address into the
+		addresses of servers to which to connect, instead of using DNS. The
+		address is given to the command in the GRPCURL_TARGET environment
+		variable, so it need not be in 'host:port' form. The command must
+		print one address per line, in 'host:port' form, optionally followed by
+		attributes in 'key=value' form. The 'servername' attribute overrides
+		the name used to verify the server's certificate; other attributes are
+		made available to load balancing policies. Blank lines and lines that
+		start with '#' are ignored.`))
+	dnsServer = flags.String("dns-server", "", prettify(`
+		The DNS server, in 'host:port' form, used to resolve the address,
+		instead of the system's configured servers. The port defaults to 53.`))
+	dnsTimeout = flags.Float64("dns-timeout", 0, prettify(`
+		The maximum time, in seconds, to wait for the address to be resolved
+		via DNS. Fractional values (e.g. 0.5) are allowed.`))
+	noProxy = flags.Bool("no-proxy", false, prettify(`
+		Do not connect via a proxy. By default, the proxy given via the
+		HTTPS_PROXY environment variable is used or, if it is not set, the
+		HTTPS proxy in the system's settings on macOS and Windows. Proxy
+		auto-config (PAC) files are not supported.`))
+	maxRetryCount = flags.Int("max-retries", 0, prettify(`
+		The maximum number of times to retry an RPC that fails with one of the
+		codes given via -retry-codes, up to 4. Retries are delayed with an
+		exponential backoff, unless the server asks for a particular delay
+		(or for no retry) via the grpc-retry-pushback-ms trailer. Requests are
+		buffered so that they can be resent. In verbose mode, the retry
+		metadata of each attempt is shown.`))
+	retryCodes = flags.String("retry-codes", defaultRetryCodes, prettify(`
+		A comma-separated list of status codes, as names like 'UNAVAILABLE' or
+		numbers, for which RPCs are retried when -max-retries is present.`))
+	lbPolicy = flags.String("lb-policy", "", prettify(`
+		The client-side load balancing policy, such as 'round_robin' or
+		'pick_first'. When this is present, all of the addresses to which the
+		address resolves are used, such as those of the pods of a headless
+		Kubernetes service. The address may also be a comma-separated list,
+		like 'host1:443,host2:443'. In verbose mode, the address of the
+		backend to which each call is sent is shown.`))
+	sshKey = flags.String("ssh-key", "", prettify(`
+		The private key file used to authenticate with the SSH server, for an
+		'ssh://' address. The key must not be protected by a passphrase. By
+		default, the keys in the SSH agent (via SSH_AUTH_SOCK) and the keys
+		~/.ssh/id_ed25519, ~/.ssh/id_ecdsa, and ~/.ssh/id_rsa are tried.`))
+	sshKnownHosts = flags.String("ssh-known-hosts", "", prettify(`
+		The known_hosts file used to verify the SSH server's host key, for an
+		'ssh://' address. Defaults to ~/.ssh/known_hosts.`))
+	transformCmd = flags.String("transform-cmd", "", prettify(`
+		A command, run via the shell, that transforms the encoded bytes of each
+		message that is sent or received when invoking an RPC, such as to add
+		or remove application-level encryption. The command is run once per
+		message: the message is written to its stdin and the transformed
+		message is read from its stdout. The GRPCURL_DIRECTION environment
+		variable is set to 'request' or 'response' and GRPCURL_METHOD is set to
+		the full path of the method being invoked. Requests are transformed
+		after they are encoded, and responses before they are decoded.`))
+	codecName = flags.String("codec", "", prettify(`
+		The codec used to encode and decode messages when invoking an RPC.
+		Besides 'proto', the default, this may be 'proto-deterministic', which
+		encodes map fields in a consistent order, or 'json', for servers that
+		accept messages in JSON form with a content-type of
+		'application/grpc+json'. Other codecs may be registered by programs
+		that embed grpcurl.`))
+	preCallExec = flags.String("pre-call-exec", "", prettify(`
+		A command, run via the shell, before invoking an RPC. The environment
+		variables GRPCURL_TARGET and GRPCURL_METHOD are set to the target
+		address and the full name of the method. If the command fails, the RPC
+		is not invoked and grpcurl exits with code 1.`))
+	postCallExec = flags.String("post-call-exec", "", prettify(`
+		A command, run via the shell, after an RPC completes, whether it
+		succeeded or not. In addition to the variables set for -pre-call-exec,
+		the environment variables GRPCURL_STATUS, GRPCURL_STATUS_CODE, and
+		GRPCURL_STATUS_MESSAGE describe the RPC's status (such as 'NotFound',
+		'5', and the error message), GRPCURL_DURATION_MS is how long the RPC
+		took in milliseconds, and GRPCURL_REQUEST_COUNT and
+		GRPCURL_RESPONSE_COUNT are the number of messages sent and received.
+		A failure of the command is reported but does not change grpcurl's
+		exit code. The output of both commands is written to stderr.`))
 	msgTemplate = flags.Bool("msg-template", false, prettify(`
-		When describing messages, show a template of input data.`))
+		When describing messages, show a template of input data. Repeated and
+		map fields have one example element, nested messages are fleshed out,
+		well-known types are shown in their JSON forms, and the first field of
+		each oneof is set (see -template-oneof).`))
+	templateDepth = flags.Int("template-depth", 0, prettify(`
+		The number of levels of nested messages to flesh out in a template
+		shown via -msg-template, including the described message. Deeper
+		message fields are left unset. Zero, the default, means no limit,
+		though recursive messages are only fleshed out once.`))
+	describeImports = flags.Bool("describe-imports", false, prettify(`
+		When describing, precede each element with the syntax, package, and
+		import statements of its file, so the output can be pasted into a
+		.proto file and compiled. Only the imports that the element needs,
+		for the types it references and the custom options it uses, are
+		included.`))
+	dTemplate = flags.Bool("d-template", false, prettify(`
+		Process the request data as a Go text/template before parsing it. The
+		functions {{uuid}}, {{now}}, {{randInt 1 100}}, and {{env "FOO"}} are
+		available, to generate a random UUID, the current time in RFC 3339
+		format, a random integer in the given range (inclusive), and the value
+		of an environment variable. Each use of a function produces a new
+		value, so every message in a stream can differ. All request data is
+		read before the first message is sent, so this cannot be used to
+		interactively stream requests from stdin.`))
+	examplesDir = flags.String("examples-dir", defaultExamplesDir, prettify(`
+		A directory of example requests. When invoking a method without -d,
+		the request is read from '<dir>/<service>/<method>.json', or from
+		'<dir>/<service>.<method>.json', if either exists, instead of sending
+		an empty message. (The extension is '.txt' for text format.) Service
+		names are fully-qualified, like 'my.pkg.Service'. Describing a method
+		also shows its example request. Set to an empty string to disable.`))
+	sizeEstimate = flags.Bool("size-estimate", false, prettify(`
+		When describing messages, show estimates of their encoded size in the
+		binary format: the minimum size, with only required fields set, and
+		the size of the message template or, if -d is present, of each given
+		message. Sizes are broken down by field, and fields that account for
+		more than half of a message's size are flagged as dominant. This is
+		useful for reviewing payload budgets.`))
+	printCommand = flags.Bool("print-command", false, prettify(`
+		Print an equivalent command line to stderr before invoking or
+		replaying a method, with every flag that is in effect given
+		explicitly. Flags set via GRPCURL_* environment variables and
+		timeouts from a -config profile are included, so the command can be
+		used as-is in scripts and automation. With the 'shell' verb, the
+		command of each call is printed before it is made.`))
 	verbose = flags.Bool("v", false, prettify(`
 		Enable verbose output.`))
 	veryVerbose = flags.Bool("vv", false, prettify(`
 		Enable very verbose output (includes timing data).`))
+	timingOut = flags.String("timing-out", "", prettify(`
+		Write a machine-readable report of the timing data shown via -vv, in
+		the given format, which must be 'json'. When a method is invoked, the
+		report also includes the time at which each message was sent or
+		received, relative to the start of the RPC, the size of each message,
+		the total bytes sent and received, and the status. The report is
+		written to stderr, or to the file given via -timing-file, even if the
+		RPC fails.`))
+	timingFile = flags.String("timing-file", "", prettify(`
+		The file to which the report is written via -timing-out, instead of
+		stderr.`))
+	debugCategories = flags.String("debug", "", prettify(`
+		A comma-separated list of categories of diagnostics to print to stderr,
+		for more targeted output than -v or -vv. The categories are:
+		'transport' (logs from the gRPC library about name resolution,
+		connections, and transport events), 'reflection' (each request made
+		via server reflection), 'format' (parsing of request messages and
+		formatting of responses), and 'retry' (retry-related response metadata
+		and the final status). Use 'all' to enable all of them.`))
+	grpcGoTrace = flags.String("grpc-go-trace", "", prettify(`
+		Enable all of the gRPC library's internal logging, which traces name
+		resolution, load balancing, connection state, and HTTP/2 transport
+		events in detail, and write it to the given file, or to stderr if the
+		value is '-' or 'stderr'. This is the same as setting the
+		GRPC_GO_LOG_SEVERITY_LEVEL and GRPC_GO_LOG_VERBOSITY_LEVEL environment
+		variables, but only for this invocation. It is more detailed than
+		'-debug transport'.`))
+	traceHTTP2 = flags.Bool("trace-http2", false, prettify(`
+		Log the HTTP/2 frames sent and received over each connection to
+		stderr, like 'curl --http2 -v': the type, stream, and flags of each
+		frame, the headers in HEADERS frames, the size of DATA frames, and the
+		details of SETTINGS, WINDOW_UPDATE, PING, RST_STREAM, and GOAWAY
+		frames. Frames are logged after TLS decryption. This shows flow
+		control and connection-level problems, such as those caused by proxies,
+		that are not visible in gRPC's own errors.`))
+	otelEndpoint = flags.String("otel-endpoint", "", prettify(`
+		The address of an OpenTelemetry collector to which to send a client
+		span for the invocation, via OTLP. The span has events for dialing,
+		server reflection, and each message sent and received, and its context
+		is sent to the server in the 'traceparent' header, so that the
+		server's spans are part of the same trace. The address is 'host:port'
+		for OTLP over gRPC, without TLS, or an 'http://' or 'https://' URL for
+		OTLP over HTTP, like 'http://localhost:4318'. If the TRACEPARENT
+		environment variable is set, the span is a child of the span it names.
+		The OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES environment
+		variables are honored. In verbose mode, the trace ID is shown.`))
+	xdsStatus = flags.Bool("xds-status", false, prettify(`
+		Connect to an 'xds:///' address, print the xDS resources (listeners,
+		route configurations, clusters, and endpoints) to which it resolved,
+		with their status, and then exit without invoking anything. With -v,
+		the contents of each resource are also printed. No symbol or verb may
+		be given with this option.`))
+	xdsBootstrap = flags.String("xds-bootstrap", "", prettify(`
+		The xDS bootstrap file used to resolve 'xds:///' addresses, instead of
+		the one given via the GRPC_XDS_BOOTSTRAP environment variable.`))
+	handshakeOnly = flags.Bool("handshake-only", false, prettify(`
+		Connect to the server, complete the transport handshake (including TLS
+		and ALPN negotiation), print details about the connection and timing
+		data, and then exit without invoking anything. If -use-reflection is
+		explicitly set to true, a request to list services is also made via the
+		reflection API to verify that the server can respond to RPCs. No symbol
+		or verb may be given with this option.`))
+	showCert = flags.Bool("show-cert", false, prettify(`
+		Print the server's certificate chain to stderr after the TLS
+		handshake, before invoking anything. Each certificate's subject,
+		subject alternative names, issuer, validity, and key usage are shown.
+		The chain is printed even if it fails verification. To print the chain
+		instead of invoking anything, use the 'cert' verb.`))
+	acceptEncoding = flags.String("accept-encoding", defaultAcceptEncoding, prettify(`
+		A comma-separated list of the compression codecs that are advertised
+		to the server, via the grpc-accept-encoding header, and that can be
+		used to decode compressed messages. The supported codecs are 'gzip',
+		'zstd', and 'snappy'. Use 'identity' to advertise none.`))
+	separateReflConn = flags.Bool("separate-reflection-connection", false, prettify(`
+		Use a separate connection for server reflection, so that the RPC is
+		invoked on a fresh connection that reflection has not used. This helps
+		with load balancers that route the reflection service differently
+		than other services. Both connections are made to the same address
+		with the same credentials; only their headers differ, since headers
+		given via -reflect-header are only sent on the reflection connection
+		and those given via -rpc-header only with the RPC.`))
+	reflectVersion = flags.String("reflect-version", reflectVersionAuto, prettify(`
+		The version of the server reflection service to use: v1, v1alpha, or
+		auto. With auto, v1 is tried first, and v1alpha is used if the server
+		does not implement v1. Some proxies only route one of the two
+		services. With -v, the version that was used, and why v1 was not, is
+		printed.`))
+	reflectCacheDir = flags.String("reflect-cache", "", prettify(`
+		A directory in which to cache the descriptors fetched via server
+		reflection, such as ~/.cache/grpcurl. Each server's descriptors are
+		stored in a protoset file named after its address. Later runs against
+		the same server use the cached descriptors, without making any
+		reflection requests, until they are older than -reflect-cache-ttl.
+		To see a server's changes sooner, delete its file.`))
+	reflectCacheTTL = flags.Float64("reflect-cache-ttl", 3600, prettify(`
+		The maximum age, in seconds, of descriptors cached via -reflect-cache
+		that may be used. Defaults to one hour.`))
 	serverName = flags.String("servername", "", prettify(`
 		Override server name when validating TLS certificate. This flag is
 		ignored if -plaintext or -insecure is used.
@@ -178,10 +766,26 @@ var (
 )
 
 func init() {
+	flags.Var(&requestData, "d", prettify(`
+		Data for request contents. If the value is '@' or '@-' then the request
+		contents are read from stdin. If it is '@' followed by a file name, such
+		as '@req.json', they are read from that file. Input that is compressed
+		with gzip, such as a '.json.gz' file, is decompressed. For calls that
+		accept a stream of requests, the contents should include all such
+		request messages concatenated together (possibly delimited; see
+		-format). Alternatively, this flag may be repeated, with each value
+		providing the next request messages in the stream, so literal
+		messages and '@' file names may be mixed. While such a call is in
+		progress, an interrupt (Ctrl-C) ends the stream of requests, and the
+		server's response and status are printed as usual; a second interrupt,
+		or a server that does not finish within a few seconds, cancels the call.`))
 	flags.Var(&addlHeaders, "H", prettify(`
 		Additional headers in 'name: value' format. May specify more than one
 		via multiple flags. These headers will also be included in reflection
-		requests to a server.`))
+		requests to a server. The values of binary headers, whose names end in
+		'-bin', must be base64-encoded, or be '@' followed by the name of a file
+		whose contents are used as the value. This also applies to
+		-rpc-header and -reflect-header.`))
 	flags.Var(&rpcHeaders, "rpc-header", prettify(`
 		Additional RPC headers in 'name: value' format. May specify more than
 		one via multiple flags. These headers will *only* be used when invoking
@@ -191,6 +795,54 @@ func init() {
 		than one via multiple flags. These headers will *only* be used during
 		reflection requests and will be excluded when invoking the requested RPC
 		method.`))
+	flags.Var(&altAddresses, "alt-address", prettify(`
+		Another address of the server, in 'host:port' form, which is used
+		along with the given address as if they were given as a
+		comma-separated list, like 'host1:443,host2:443'. By default, the
+		addresses are tried in order until a connection succeeds, so this
+		demonstrates failover; with '-lb-policy round_robin', calls are
+		spread across all of them. In verbose mode, the address that served
+		each call is shown. May specify more than one via multiple flags.`))
+	flags.Var(&resolveAddrs, "resolve", prettify(`
+		Resolve the given host and port to the given address, in
+		'host:port:addr' form like curl, instead of using DNS. The address
+		may be a comma-separated list, and IPv6 addresses must be in brackets,
+		like 'api.example.com:443:[2001:db8::1]'. The host is still used to
+		verify the server's certificate. May specify more than one via
+		multiple flags.`))
+	flags.Var(&pinnedCerts, "pinned-cert", prettify(`
+		Accept the server's certificate only if the SHA-256 hash of its public
+		key matches the given pin, in 'sha256:<hex>' or 'sha256:<base64>'
+		form, instead of verifying it using trusted root certificates. This is
+		a safer alternative to -insecure for servers with self-signed
+		certificates whose key is known. May specify more than one via
+		multiple flags, such as to allow for a key being rotated. Not valid
+		with -plaintext, -insecure, or -tofu options.`))
+	flags.Var(&templateOneof, "template-oneof", prettify(`
+		The name of a field to set, in a template shown via -msg-template, for
+		the oneof that includes it, instead of the oneof's first field. The
+		name may be fully-qualified, like 'acme.Payment.card', to select a
+		field of a particular message. May specify more than one via multiple
+		flags.`))
+	flags.Var(&expectSubstrs, "expect-response-contains", prettify(`
+		Text that at least one response message is expected to contain, as
+		formatted for output (before any -jq expression is applied). If no
+		response contains it, grpcurl exits with code 6. May specify more than
+		one via multiple flags.`))
+	flags.Var(&expectJQ, "expect-jq", prettify(`
+		A jq expression, such as '.status == "READY"', that is expected to
+		be true for every response message. The expression is applied to the
+		JSON form of each response, and it must yield at least one value and
+		no values that are false or null. If it does not, or if there are no
+		responses, grpcurl exits with code 6. May specify more than one via
+		multiple flags.`))
+	flags.Var(&headerFiles, "header-file", prettify(`
+		The name of a file with additional headers, one per line in
+		'name: value' format. Blank lines and lines that start with '#' are
+		ignored, and environment variables may be referenced using '${NAME}'
+		syntax. The headers are used like those given via -H, before any
+		given via -H, -rpc-header, or -reflect-header. May specify more than
+		one via multiple flags.`))
 	flags.Var(&protoset, "protoset", prettify(`
 		The name of a file containing an encoded FileDescriptorSet. This file's
 		contents will be used to determine the RPC schema instead of querying
@@ -199,7 +851,15 @@ func init() {
 		those exposed by the remote server), and the 'describe' action describes
 		symbols found in the given descriptors. May specify more than one via
 		multiple -protoset flags. It is an error to use both -protoset and
-		-proto flags.`))
+		-proto flags. The name may also be an 'http://' or 'https://' URL, from
+		which the file is downloaded, such as a descriptor set published by a
+		CI system. If the URL ends with '#sha256=<hex>', the download must have
+		that SHA-256 hash.`))
+	flags.Var(&protosetHdrs, "protoset-header", prettify(`
+		Additional headers in 'name: value' format, such as for authorization,
+		to send when downloading -protoset URLs. May specify more than one via
+		multiple flags. With -expand-headers, they may reference environment
+		variables using '${NAME}' syntax.`))
 	flags.Var(&protoFiles, "proto", prettify(`
 		The name of a proto source file. Source files given will be used to
 		determine the RPC schema instead of querying for it from the remote
@@ -209,14 +869,24 @@ func init() {
 		symbols found in the given files. May specify more than one via multiple
 		-proto flags. Imports will be resolved using the given -import-path
 		flags. Multiple proto files can be specified by specifying multiple
-		-proto flags. It is an error to use both -protoset and -proto flags.`))
+		-proto flags. It is an error to use both -protoset and -proto flags.
+		The name may also be a glob pattern, like 'api/**/*.proto', which is
+		expanded by grpcurl to the files in the import paths that match it,
+		where '**' matches any number of directories. Quote the pattern so
+		that the shell does not expand it.`))
+	flags.Var(&protoExcludes, "proto-exclude", prettify(`
+		A glob pattern, like 'api/**/internal/*.proto', of proto source files
+		to omit from those given via -proto flags. May specify more than one
+		via multiple flags.`))
 	flags.Var(&importPaths, "import-path", prettify(`
 		The path to a directory from which proto sources can be imported, for
 		use with -proto flags. Multiple import paths can be configured by
 		specifying multiple -import-path flags. Paths will be searched in the
 		order given. If no import paths are given, all files (including all
 		imports) must be provided as -proto flags, and grpcurl will attempt to
-		resolve all import statements from the set of file names given.`))
+		resolve all import statements from the set of file names given. The
+		path may also be a glob pattern, like 'vendor/*/proto', which is
+		expanded to the directories that match it, in lexical order.`))
 	flags.Var(&reflection, "use-reflection", prettify(`
 		When true, server reflection will be used to determine the RPC schema.
 		Defaults to true unless a -proto or -protoset option is provided. If
@@ -231,6 +901,29 @@ func init() {
 		expected accounts, the RPC will not be issued. If no such arguments are
 		provided, no check will be performed, and the RPC will be issued
 		regardless of the server's service account.`))
+	flags.Var(&alsoOutputs, "also-output", prettify(`
+		An additional output for response messages, in 'format=file' form,
+		such as 'binary=out.bin'. Each response is written to the named file in
+		the given format as well as being printed as usual, so a stream of
+		responses can be captured in more than one format in a single call. The
+		format may be 'json', 'ndjson', 'text' (with messages separated by the
+		"record separator" character, 0x1E), or 'binary' (the encoded messages,
+		each prefixed with its length as a varint). Options like -jq and
+		-output-template do not affect these outputs. May specify more than one
+		via multiple flags.`))
+	flags.Var(&mockSessions, "session", prettify(`
+		The name of a session file, written via -record, from which the 'mock'
+		verb creates a stub that responds with the recorded response metadata,
+		messages, and status. Unless the method is client-streaming, the stub
+		only applies to requests that match the recorded one. Stubs from
+		sessions are consulted after those in the -stubs file. If no protoset
+		or proto flags are given, the descriptors in the sessions are used.
+		May specify more than one via multiple flags.`))
+	flags.Var(&batchVars, "batch-var", prettify(`
+		A variable, in 'name=value' form, that calls in the -batch manifest may
+		reference as '${name}' in their data and headers, like a captured
+		variable. A variable captured by an earlier call takes precedence. May
+		specify more than one via multiple flags.`))
 }
 
 type multiString []string
@@ -287,6 +980,53 @@ func (cs compositeSource) AllExtensionsForType(typeName string) ([]*desc.FieldDe
 	return exts, nil
 }
 
+// codecChannel returns the given connection as a channel that uses the given
+// codec, if any, for the messages of each call.
+func codecChannel(cc *grpc.ClientConn, codec encoding.Codec) grpcdynamic.Channel {
+	if codec != nil {
+		return grpcurl.ChannelWithCodec(cc, codec)
+	}
+	return cc
+}
+
+// keepaliveParams returns the keepalive parameters given via -keepalive-time,
+// -keepalive-timeout, and -keepalive-permit-without-stream. If the timeout is
+// zero, it is the same as the time.
+func keepaliveParams(timeSecs, timeoutSecs float64, permitWithoutStream bool) keepalive.ClientParameters {
+	if timeoutSecs == 0 {
+		timeoutSecs = timeSecs
+	}
+	return keepalive.ClientParameters{
+		Time:                floatSecondsToDuration(timeSecs),
+		Timeout:             floatSecondsToDuration(timeoutSecs),
+		PermitWithoutStream: permitWithoutStream,
+	}
+}
+
+// anyTypeSource uses server reflection as a fallback for resolving the types
+// of google.protobuf.Any messages that are not in the descriptors of another
+// source, for '-any-resolve reflection'.
+type anyTypeSource struct {
+	grpcurl.DescriptorSource
+	reflection grpcurl.DescriptorSource
+}
+
+func (s anyTypeSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	d, err := s.DescriptorSource.FindSymbol(fullyQualifiedName)
+	if err == nil {
+		return d, nil
+	}
+	return s.reflection.FindSymbol(fullyQualifiedName)
+}
+
+func (s anyTypeSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	exts, err := s.DescriptorSource.AllExtensionsForType(typeName)
+	if err != nil {
+		return s.reflection.AllExtensionsForType(typeName)
+	}
+	return exts, nil
+}
+
 type timingData struct {
 	Title  string
 	Start  time.Time
@@ -313,128 +1053,6 @@ func (d *timingData) Done() {
 	}
 }
 
-// parsedTarget holds the components of a parsed URL target
-type parsedTarget struct {
-	address string // host:port format for gRPC dialing
-	scheme  string // original scheme (http, https, etc.)
-	host    string // hostname or IP
-	port    string // port number
-	path    string // URL path
-	useTLS  bool   // whether to use TLS based on scheme
-	wasURL  bool   // whether the original target was a URL
-}
-
-// parseTarget parses a target address that may be a URL or a simple host:port
-func parseTarget(target string) (*parsedTarget, error) {
-	// Handle special cases first
-	if strings.HasPrefix(target, "unix://") || strings.HasPrefix(target, "xds:///") {
-		return &parsedTarget{
-			address: target,
-			scheme:  "",
-			host:    target,
-			port:    "",
-			path:    "",
-			useTLS:  false,
-			wasURL:  false,
-		}, nil
-	}
-
-	// Try to parse as URL
-	parsed, err := url.Parse(target)
-	if err != nil {
-		// Not a URL, treat as host:port
-		return &parsedTarget{
-			address: target,
-			scheme:  "",
-			host:    target,
-			port:    "",
-			path:    "",
-			useTLS:  false,
-			wasURL:  false,
-		}, nil
-	}
-
-	// Check if this is a real URL with a known scheme or just a host:port
-	if parsed.Scheme != "" && parsed.Scheme != "http" && parsed.Scheme != "https" {
-		// Check if it looks like a simple host:port (scheme would be the hostname)
-		if parsed.Host == "" && parsed.Path == "" && parsed.RawQuery == "" && parsed.Fragment == "" {
-			// This is likely a host:port being misinterpreted as scheme:path
-			return &parsedTarget{
-				address: target,
-				scheme:  "",
-				host:    target,
-				port:    "",
-				path:    "",
-				useTLS:  false,
-				wasURL:  false,
-			}, nil
-		}
-
-		// Unknown scheme, treat as-is
-		return &parsedTarget{
-			address: target,
-			scheme:  parsed.Scheme,
-			host:    target,
-			port:    "",
-			path:    "",
-			useTLS:  false,
-			wasURL:  false,
-		}, nil
-	}
-
-	// If no scheme, treat as host:port
-	if parsed.Scheme == "" {
-		return &parsedTarget{
-			address: target,
-			scheme:  "",
-			host:    target,
-			port:    "",
-			path:    "",
-			useTLS:  false,
-			wasURL:  false,
-		}, nil
-	}
-
-	// Handle HTTP/HTTPS URL schemes
-	if parsed.Scheme == "http" || parsed.Scheme == "https" {
-		host := parsed.Hostname()
-		port := parsed.Port()
-
-		// Set default ports
-		if port == "" {
-			if parsed.Scheme == "https" {
-				port = "443"
-			} else {
-				port = "80"
-			}
-		}
-
-		// Construct address in host:port format
-		address := host + ":" + port
-
-		return &parsedTarget{
-			address: address,
-			scheme:  parsed.Scheme,
-			host:    host,
-			port:    port,
-			path:    parsed.Path,
-			useTLS:  parsed.Scheme == "https",
-			wasURL:  true,
-		}, nil
-	}
-
-	// Fallback: treat as host:port
-	return &parsedTarget{
-		address: target,
-		scheme:  "",
-		host:    target,
-		port:    "",
-		path:    "",
-		useTLS:  false,
-		wasURL:  false,
-	}, nil
-}
-
 func main() {
 	flags.Usage = usage
 	flags.Parse(os.Args[1:])
@@ -448,564 +1066,325 @@ func main() {
 	}
 
 	args := flags.Args()
-
-	if len(args) == 0 {
-		fail(nil, "Too few arguments.")
-	}
-	var target string
-	var parsedAddr *parsedTarget
-	if args[0] != "list" && args[0] != "describe" {
-		target = args[0]
-		args = args[1:]
-
-		// Parse the target to handle URLs and extract components
-		var err error
-		parsedAddr, err = parseTarget(target)
-		if err != nil {
-			fail(err, "Failed to parse target address %q", target)
-		}
-
-		// Use the parsed address for dialing
-		target = parsedAddr.address
+	// The calls of a -batch-matrix are made by running grpcurl again for
+	// each environment, with the environment's address.
+	if *batchMatrix != "" {
+		runBatchMatrixFile(args)
+		return
 	}
-
 	if len(args) == 0 {
 		fail(nil, "Too few arguments.")
 	}
-	var list, describe, invoke bool
-	if args[0] == "list" {
-		list = true
-		args = args[1:]
-	} else if args[0] == "describe" {
-		describe = true
-		args = args[1:]
-	} else {
-		invoke = true
-	}
-
-	verbosityLevel := 0
-	if *verbose {
-		verbosityLevel = 1
-	}
-
-	var rootTiming *timingData
-	if *veryVerbose {
-		verbosityLevel = 2
-
-		rootTiming = &timingData{Title: "Timing Data", Start: time.Now()}
-		defer func() {
-			rootTiming.Done()
-			dumpTiming(rootTiming, 0)
-		}()
-	}
 
-	var symbol string
-	if invoke {
-		if len(args) == 0 {
-			fail(nil, "Too few arguments.")
-		}
-		symbol = args[0]
-		args = args[1:]
-	} else {
-		if *data != "" {
-			warn("The -d argument is not used with 'list' or 'describe' verb.")
-		}
-		if len(rpcHeaders) > 0 {
-			warn("The -rpc-header argument is not used with 'list' or 'describe' verb.")
-		}
-		if len(args) > 0 {
-			symbol = args[0]
-			args = args[1:]
+	// Some verbs are stand-alone commands that do not use a target address.
+	// Flags for these may also be given after the verb.
+	var completion *completionRequest
+	switch args[0] {
+	case "completion":
+		runCompletion(args[1:])
+		return
+	case completeVerb:
+		if completion, args = startCompletion(args[1:]); completion == nil {
+			return
 		}
+		parseEnv()
+	case "mock":
+		flags.Parse(args[1:])
+		parseEnv()
+		runMock(flags.Args())
+		return
+	case "export":
+		flags.Parse(args[1:])
+		parseEnv()
+		runExport(flags.Args())
+		return
+	case "support-bundle", "shell", "proxy", "test":
+		args = verbFirstArgs(args[0], args[1:])
+	default:
+		parseEnv()
+	}
+
+	o := parseOptions(args, completion)
+	defer o.close()
+	if o.verb == "support-bundle" {
+		reflectionHeaders := append(append([]string{}, addlHeaders...), reflHeaders...)
+		runSupportBundle(o.ctx, o.target, reflectionHeaders, o.headers(), func() (*grpc.ClientConn, *handshakeRecorder, error) {
+			cc, err := o.tryDial()
+			return cc, o.d.handshake, err
+		})
+		return
 	}
+	o.connect()
 
-	if len(args) > 0 {
-		fail(nil, "Too many arguments.")
-	}
-	if invoke && target == "" {
-		fail(nil, "No host:port specified.")
-	}
-	if len(protoset) == 0 && len(protoFiles) == 0 && target == "" {
-		fail(nil, "No host:port specified, no protoset specified, and no proto sources specified.")
-	}
-	if len(protoset) > 0 && len(reflHeaders) > 0 {
-		warn("The -reflect-header argument is not used when -protoset files are used.")
-	}
-	if len(protoset) > 0 && len(protoFiles) > 0 {
-		fail(nil, "Use either -protoset files or -proto files, but not both.")
-	}
-	if len(importPaths) > 0 && len(protoFiles) == 0 {
-		warn("The -import-path argument is not used unless -proto files are used.")
-	}
-	if !reflection.val && len(protoset) == 0 && len(protoFiles) == 0 {
-		fail(nil, "No protoset files or proto files specified and -use-reflection set to false.")
-	}
-
-	// Protoset or protofiles provided and -use-reflection unset
-	if !reflection.set && (len(protoset) > 0 || len(protoFiles) > 0) {
-		reflection.val = false
-	}
-
-	ctx := context.Background()
-	if *maxTime > 0 {
-		timeout := floatSecondsToDuration(*maxTime)
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, timeout)
-		defer cancel()
-	}
-
-	// default behavior is to use tls
-	usetls := !*plaintext && !*usealts
-	forcePlaintext := *plaintext
-
-	// Override TLS usage based on URL scheme if target was parsed as URL
-	if parsedAddr != nil && parsedAddr.wasURL {
-		if parsedAddr.useTLS && (*plaintext || *usealts) {
-			fail(nil, "Target URL scheme 'https' requires TLS but -plaintext or -alts flag is set.")
+	switch {
+	case *handshakeOnly:
+		o.conn()
+		runHandshake(o.target, o.d.handshake, o.refClient, o.rootTiming)
+	case o.verb == "cert":
+		var dialErr error
+		if o.cc == nil {
+			o.cc, dialErr = o.tryDial()
 		}
-		if !parsedAddr.useTLS && !*plaintext && !*usealts {
-			// URL scheme is http, force plaintext
-			usetls = false
-			forcePlaintext = true
-		} else if parsedAddr.useTLS && !*plaintext && !*usealts {
-			// URL scheme is https, ensure TLS is used
-			usetls = true
+		runCert(o.target, o.d.certs, dialErr)
+	case *xdsStatus:
+		o.cc = runXDSStatus(o.target, o.verbosityLevel > 0, o.tryDial)
+	case o.verb == "list":
+		runList(o.descSource, o.symbol, o.listAll)
+	case o.verb == "proxy":
+		runProxy(o.conn(), o.descSource, o.headers())
+	case o.verb == "test":
+		runTest(o.ctx, o.suite, o.descSource, o.channel(), o.headers())
+	case o.verb == "shell":
+		runShell(o.ctx, o.descSource, o.channel(), o.target, o.headers(), grpcurl.Format(o.inFormat))
+	case o.verb == completeSymbolsVerb:
+		runCompleteSymbols(o.descSource, o.completion.cacheFile, o.completion.prefix)
+	case o.verb == "diff":
+		runDiff(o.descSource, o.symbol)
+	case o.verb == "validate":
+		runValidate(o.descSource, o.symbol, grpcurl.Format(o.inFormat))
+	case o.verb == "export-openapi":
+		runExportOpenAPI(o.descSource, o.symbol)
+	case o.verb == "describe":
+		runDescribe(o.descSource, o.symbol, grpcurl.Format(o.inFormat))
+	case o.batch:
+		runBatch(o.ctx, o.batchEntries, o.descSource, o.channel(), o.headers(), o.batchVariables, grpcurl.Format(o.inFormat))
+	case o.verb == "invoke" && *asHTTP != "":
+		baseURL, err := httpBaseURL(o.target, o.d.usetls, o.d.rpcPathPrefix)
+		if err != nil {
+			fail(nil, "The -as-http argument cannot be used with this address: %v", err)
 		}
+		runAsHTTP(o.ctx, o.descSource, o.symbol, baseURL, o.headers(), grpcurl.Format(o.inFormat), o.verbosityLevel > 0, o.exitPolicy)
+	case o.verb == "invoke" && *fuzzCount > 0:
+		runFuzzMethod(o.ctx, o.descSource, o.channel(), o.symbol, o.headers(), grpcurl.Format(o.outFormat), o.compactJSON, o.verbosityLevel > 0)
+	default:
+		// Invoke an RPC (or replay one from a session)
+		runInvoke(o.ctx, o.invocation())
 	}
+}
 
-	// Do extra validation on arguments and figure out what user asked us to do.
-	if *connectTimeout < 0 {
-		fail(nil, "The -connect-timeout argument must not be negative.")
-	}
-	if *keepaliveTime < 0 {
-		fail(nil, "The -keepalive-time argument must not be negative.")
-	}
-	if *maxTime < 0 {
-		fail(nil, "The -max-time argument must not be negative.")
-	}
-	if *maxMsgSz < 0 {
-		fail(nil, "The -max-msg-sz argument must not be negative.")
-	}
-	if *plaintext && *usealts {
-		fail(nil, "The -plaintext and -alts arguments are mutually exclusive.")
-	}
-	if *insecure && !usetls {
-		fail(nil, "The -insecure argument can only be used with TLS.")
-	}
-	if *cert != "" && !usetls {
-		fail(nil, "The -cert argument can only be used with TLS.")
-	}
-	if *key != "" && !usetls {
-		fail(nil, "The -key argument can only be used with TLS.")
-	}
-	if (*key == "") != (*cert == "") {
-		fail(nil, "The -cert and -key arguments must be used together and both be present.")
-	}
-	if *altsHandshakerServiceAddress != "" && !*usealts {
-		fail(nil, "The -alts-handshaker-service argument must be used with the -alts argument.")
-	}
-	if len(altsTargetServiceAccounts) > 0 && !*usealts {
-		fail(nil, "The -alts-target-service-account argument must be used with the -alts argument.")
-	}
-	if *format != "json" && *format != "text" {
-		fail(nil, "The -format option must be 'json' or 'text'.")
-	}
-	if *emitDefaults && *format != "json" {
-		warn("The -emit-defaults is only used when using json format.")
-	}
-
-	dial := func() *grpc.ClientConn {
-		dialTiming := rootTiming.Child("Dial")
-		defer dialTiming.Done()
-		dialTime := 10 * time.Second
-		if *connectTimeout > 0 {
-			dialTime = floatSecondsToDuration(*connectTimeout)
-		}
-		ctx, cancel := context.WithTimeout(ctx, dialTime)
-		defer cancel()
-		var opts []grpc.DialOption
-		if *keepaliveTime > 0 {
-			timeout := floatSecondsToDuration(*keepaliveTime)
-			opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
-				Time:    timeout,
-				Timeout: timeout,
-			}))
-		}
-		if *maxMsgSz > 0 {
-			opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(*maxMsgSz)))
-		}
-		if isUnixSocket != nil && isUnixSocket() && !strings.HasPrefix(target, "unix://") {
-			// prepend unix:// to the address if it's not already there
-			// this is to maintain backwards compatibility because the custom dialer is replaced by
-			// the default dialer in grpc-go.
-			// https://github.com/fullstorydev/grpcurl/pull/480
-			target = "unix://" + target
-		}
-		var creds credentials.TransportCredentials
-		if forcePlaintext {
-			if *authority != "" {
-				opts = append(opts, grpc.WithAuthority(*authority))
-			}
-		} else if *usealts {
-			clientOptions := alts.DefaultClientOptions()
-			if len(altsTargetServiceAccounts) > 0 {
-				clientOptions.TargetServiceAccounts = altsTargetServiceAccounts
-			}
-			if *altsHandshakerServiceAddress != "" {
-				clientOptions.HandshakerServiceAddress = *altsHandshakerServiceAddress
-			}
-			creds = alts.NewClientCreds(clientOptions)
-		} else if usetls {
-			tlsTiming := dialTiming.Child("TLS Setup")
-			defer tlsTiming.Done()
-
-			tlsConf, err := grpcurl.ClientTLSConfig(*insecure, *cacert, *cert, *key)
-			if err != nil {
-				fail(err, "Failed to create TLS config")
-			}
-
-			// For proxy scenarios, ensure TLS ServerName is just the hostname
-			if parsedAddr != nil && parsedAddr.wasURL && parsedAddr.path != "" && parsedAddr.path != "/" {
-				// Set TLS ServerName to just the hostname for certificate verification
-				tlsConf.ServerName = parsedAddr.host
-			}
-
-			sslKeylogFile := os.Getenv("SSLKEYLOGFILE")
-			if sslKeylogFile != "" {
-				w, err := os.OpenFile(sslKeylogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-				if err != nil {
-					fail(err, "Could not open SSLKEYLOGFILE %s", sslKeylogFile)
-				}
-				tlsConf.KeyLogWriter = w
-			}
-
-			creds = credentials.NewTLS(tlsConf)
-
-			// can use either -servername or -authority; but not both
-			if *serverName != "" && *authority != "" {
-				if *serverName == *authority {
-					warn("Both -servername and -authority are present; prefer only -authority.")
-				} else {
-					fail(nil, "Cannot specify different values for -servername and -authority.")
-				}
-			}
-			overrideName := *serverName
-			if overrideName == "" {
-				overrideName = *authority
-			}
-
-			if overrideName != "" {
-				opts = append(opts, grpc.WithAuthority(overrideName))
-			}
-			tlsTiming.Done()
-		} else {
-			panic("Should have defaulted to use TLS.")
-		}
-
-		grpcurlUA := "grpcurl/" + version
-		if version == noVersion {
-			grpcurlUA = "grpcurl/dev-build (no version set)"
-		}
-		if *userAgent != "" {
-			grpcurlUA = *userAgent + " " + grpcurlUA
-		}
-		opts = append(opts, grpc.WithUserAgent(grpcurlUA))
-
-		blockingDialTiming := dialTiming.Child("BlockingDial")
-		defer blockingDialTiming.Done()
-		cc, err := grpcurl.BlockingDial(ctx, "", target, creds, opts...)
-		if err != nil {
-			fail(err, "Failed to dial target host %q", target)
-		}
-		return cc
+// listAPIServices returns the names of all services in the given source other
+// than the reflection service, which is not usually considered part of a
+// server's API.
+func listAPIServices(descSource grpcurl.DescriptorSource) ([]string, error) {
+	svcs, err := grpcurl.ListServices(descSource)
+	if err != nil {
+		return nil, err
 	}
-	printFormattedStatus := func(w io.Writer, stat *status.Status, formatter grpcurl.Formatter) {
-		formattedStatus, err := formatter(stat.Proto())
-		if err != nil {
-			fmt.Fprintf(w, "ERROR: %v", err.Error())
+	var names []string
+	for _, svc := range svcs {
+		if strings.HasPrefix(svc, "grpc.reflection.") {
+			continue
 		}
-		fmt.Fprint(w, formattedStatus)
+		names = append(names, svc)
 	}
+	return names, nil
+}
 
-	if *expandHeaders {
-		var err error
-		addlHeaders, err = grpcurl.ExpandHeaders(addlHeaders)
-		if err != nil {
-			fail(err, "Failed to expand additional headers")
-		}
-		rpcHeaders, err = grpcurl.ExpandHeaders(rpcHeaders)
+// runDescribe prints the descriptors of the given symbol, or of all services
+// in the given source, for the 'describe' verb. With -msg-template, messages
+// are followed by a template; methods are followed by an example request from
+// -examples-dir, if there is one, and, with -size-estimate, messages are
+// followed by an estimate of their encoded size.
+func runDescribe(descSource grpcurl.DescriptorSource, symbol string, inFormat grpcurl.Format) {
+	var symbols []string
+	if symbol != "" {
+		symbols = []string{symbol}
+	} else {
+		// if no symbol given, describe all exposed services
+		svcs, err := descSource.ListServices()
 		if err != nil {
-			fail(err, "Failed to expand rpc headers")
+			fail(err, "Failed to list services")
 		}
-		reflHeaders, err = grpcurl.ExpandHeaders(reflHeaders)
-		if err != nil {
-			fail(err, "Failed to expand reflection headers")
+		if len(svcs) == 0 {
+			fmt.Println("Server returned an empty list of exposed services")
 		}
+		symbols = svcs
 	}
+	for _, s := range symbols {
+		if s[0] == '.' {
+			s = s[1:]
+		}
 
-	// Add path information as custom header for reverse proxy routing
-	if parsedAddr != nil && parsedAddr.wasURL && parsedAddr.path != "" && parsedAddr.path != "/" {
-		addlHeaders = append(addlHeaders, "x-grpc-path: "+parsedAddr.path)
-	}
-
-	var cc *grpc.ClientConn
-	var descSource grpcurl.DescriptorSource
-	var refClient *grpcreflect.Client
-	var fileSource grpcurl.DescriptorSource
-	if len(protoset) > 0 {
-		var err error
-		fileSource, err = grpcurl.DescriptorSourceFromProtoSets(protoset...)
+		dsc, err := descSource.FindSymbol(s)
 		if err != nil {
-			fail(err, "Failed to process proto descriptor sets.")
+			fail(err, "Failed to resolve symbol %q", s)
 		}
-	} else if len(protoFiles) > 0 {
-		var err error
-		fileSource, err = grpcurl.DescriptorSourceFromProtoFiles(importPaths, protoFiles...)
+
+		fqn := dsc.GetFullyQualifiedName()
+		dsc, elementType, err := describedElement(dsc)
 		if err != nil {
-			fail(err, "Failed to process proto source files.")
+			fail(err, "Failed to describe symbol %q", s)
 		}
-	}
-	if reflection.val {
-		md := grpcurl.MetadataFromHeaders(append(addlHeaders, reflHeaders...))
-		refCtx := metadata.NewOutgoingContext(ctx, md)
-		cc = dial()
-		refClient = grpcreflect.NewClientAuto(refCtx, cc)
-		refClient.AllowMissingFileDescriptors()
-		reflSource := grpcurl.DescriptorSourceFromServer(ctx, refClient)
-		if fileSource != nil {
-			descSource = compositeSource{reflSource, fileSource}
-		} else {
-			descSource = reflSource
-		}
-	} else {
-		descSource = fileSource
-	}
 
-	// arrange for the RPCs to be cleanly shutdown
-	reset := func() {
-		if refClient != nil {
-			refClient.Reset()
-			refClient = nil
+		var txt string
+		if *describeImports {
+			txt, err = grpcurl.GetStandaloneDescriptorText(dsc, descSource)
+		} else {
+			txt, err = grpcurl.GetDescriptorText(dsc, descSource)
 		}
-		if cc != nil {
-			cc.Close()
-			cc = nil
+		if err != nil {
+			fail(err, "Failed to describe symbol %q", s)
 		}
-	}
-	defer reset()
-	exit = func(code int) {
-		// since defers aren't run by os.Exit...
-		reset()
-		os.Exit(code)
-	}
-
-	if list {
-		if symbol == "" {
-			svcs, err := grpcurl.ListServices(descSource)
+		fmt.Printf("%s is %s:\n", fqn, elementType)
+		fmt.Println(txt)
+
+		if dsc, ok := dsc.(*desc.MessageDescriptor); ok && *msgTemplate {
+			// for messages, also show a template in JSON, to make it easier to
+			// create a request to invoke an RPC
+			tmpl := grpcurl.MakeTemplateWithOptions(dsc, grpcurl.TemplateOptions{
+				MaxDepth: *templateDepth,
+				Oneofs:   templateOneof,
+			})
+			options := grpcurl.FormatOptions{EmitJSONDefaultFields: true, UseProtoNames: *useProtoNames}
+			_, formatter, err := grpcurl.RequestParserAndFormatter(inFormat, descSource, nil, options)
 			if err != nil {
-				fail(err, "Failed to list services")
-			}
-			if len(svcs) == 0 {
-				fmt.Println("(No services)")
-			} else {
-				for _, svc := range svcs {
-					fmt.Printf("%s\n", svc)
-				}
-			}
-			if err := writeProtoset(descSource, svcs...); err != nil {
-				fail(err, "Failed to write protoset to %s", *protosetOut)
-			}
-			if err := writeProtos(descSource, svcs...); err != nil {
-				fail(err, "Failed to write protos to %s", *protoOut)
+				fail(err, "Failed to construct formatter for %q", *format)
 			}
-		} else {
-			methods, err := grpcurl.ListMethods(descSource, symbol)
+			str, err := formatter(tmpl)
 			if err != nil {
-				fail(err, "Failed to list methods for service %q", symbol)
-			}
-			if len(methods) == 0 {
-				fmt.Println("(No methods)") // probably unlikely
-			} else {
-				for _, m := range methods {
-					fmt.Printf("%s\n", m)
-				}
-			}
-			if err := writeProtoset(descSource, symbol); err != nil {
-				fail(err, "Failed to write protoset to %s", *protosetOut)
-			}
-			if err := writeProtos(descSource, symbol); err != nil {
-				fail(err, "Failed to write protos to %s", *protoOut)
+				fail(err, "Failed to print template for message %s", s)
 			}
+			fmt.Println("\nMessage template:")
+			fmt.Println(str)
 		}
-
-	} else if describe {
-		var symbols []string
-		if symbol != "" {
-			symbols = []string{symbol}
-		} else {
-			// if no symbol given, describe all exposed services
-			svcs, err := descSource.ListServices()
+		if dsc, ok := dsc.(*desc.MethodDescriptor); ok {
+			example, err := findExample(*examplesDir, dsc.GetFullyQualifiedName(), inFormat)
 			if err != nil {
-				fail(err, "Failed to list services")
+				fail(err, "Failed to find example request for method %s", s)
 			}
-			if len(svcs) == 0 {
-				fmt.Println("Server returned an empty list of exposed services")
+			if example != "" {
+				b, err := os.ReadFile(example)
+				if err != nil {
+					fail(err, "Failed to read example request for method %s", s)
+				}
+				fmt.Printf("\nExample request (from %s):\n", example)
+				fmt.Println(strings.TrimRight(string(b), "\n"))
 			}
-			symbols = svcs
 		}
-		for _, s := range symbols {
-			if s[0] == '.' {
-				s = s[1:]
-			}
-
-			dsc, err := descSource.FindSymbol(s)
-			if err != nil {
-				fail(err, "Failed to resolve symbol %q", s)
+		if dsc, ok := dsc.(*desc.MessageDescriptor); ok && *sizeEstimate {
+			options := grpcurl.FormatOptions{AllowUnknownFields: *allowUnknownFields}
+			if err := printSizeEstimate(os.Stdout, dsc, descSource, inFormat, requestData, options); err != nil {
+				fail(err, "Failed to estimate size of message %s", s)
 			}
+		}
+	}
+	if err := writeProtoset(descSource, symbols...); err != nil {
+		fail(err, "Failed to write protoset to %s", *protosetOut)
+	}
+	if err := writeProtos(descSource, symbol); err != nil {
+		fail(err, "Failed to write protos to %s", *protoOut)
+	}
+}
 
-			fqn := dsc.GetFullyQualifiedName()
-			var elementType string
-			switch d := dsc.(type) {
-			case *desc.MessageDescriptor:
-				elementType = "a message"
-				parent, ok := d.GetParent().(*desc.MessageDescriptor)
-				if ok {
-					if d.IsMapEntry() {
-						for _, f := range parent.GetFields() {
-							if f.IsMap() && f.GetMessageType() == d {
-								// found it: describe the map field instead
-								elementType = "the entry type for a map field"
-								dsc = f
-								break
-							}
-						}
-					} else {
-						// see if it's a group
-						for _, f := range parent.GetFields() {
-							if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP && f.GetMessageType() == d {
-								// found it: describe the map field instead
-								elementType = "the type of a group field"
-								dsc = f
-								break
-							}
-						}
+// describedElement returns the element that is described for the given
+// descriptor, along with a phrase for what kind of element it is, like "a
+// message". The entry type of a map field and the type of a group field are
+// described via the field.
+func describedElement(dsc desc.Descriptor) (desc.Descriptor, string, error) {
+	var elementType string
+	switch d := dsc.(type) {
+	case *desc.MessageDescriptor:
+		elementType = "a message"
+		parent, ok := d.GetParent().(*desc.MessageDescriptor)
+		if ok {
+			if d.IsMapEntry() {
+				for _, f := range parent.GetFields() {
+					if f.IsMap() && f.GetMessageType() == d {
+						// found it: describe the map field instead
+						elementType = "the entry type for a map field"
+						dsc = f
+						break
 					}
 				}
-			case *desc.FieldDescriptor:
-				elementType = "a field"
-				if d.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
-					elementType = "a group field"
-				} else if d.IsExtension() {
-					elementType = "an extension"
-				}
-			case *desc.OneOfDescriptor:
-				elementType = "a one-of"
-			case *desc.EnumDescriptor:
-				elementType = "an enum"
-			case *desc.EnumValueDescriptor:
-				elementType = "an enum value"
-			case *desc.ServiceDescriptor:
-				elementType = "a service"
-			case *desc.MethodDescriptor:
-				elementType = "a method"
-			default:
-				err = fmt.Errorf("descriptor has unrecognized type %T", dsc)
-				fail(err, "Failed to describe symbol %q", s)
-			}
-
-			txt, err := grpcurl.GetDescriptorText(dsc, descSource)
-			if err != nil {
-				fail(err, "Failed to describe symbol %q", s)
-			}
-			fmt.Printf("%s is %s:\n", fqn, elementType)
-			fmt.Println(txt)
-
-			if dsc, ok := dsc.(*desc.MessageDescriptor); ok && *msgTemplate {
-				// for messages, also show a template in JSON, to make it easier to
-				// create a request to invoke an RPC
-				tmpl := grpcurl.MakeTemplate(dsc)
-				options := grpcurl.FormatOptions{EmitJSONDefaultFields: true}
-				_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.Format(*format), descSource, nil, options)
-				if err != nil {
-					fail(err, "Failed to construct formatter for %q", *format)
-				}
-				str, err := formatter(tmpl)
-				if err != nil {
-					fail(err, "Failed to print template for message %s", s)
+			} else {
+				// see if it's a group
+				for _, f := range parent.GetFields() {
+					if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP && f.GetMessageType() == d {
+						// found it: describe the map field instead
+						elementType = "the type of a group field"
+						dsc = f
+						break
+					}
 				}
-				fmt.Println("\nMessage template:")
-				fmt.Println(str)
 			}
 		}
-		if err := writeProtoset(descSource, symbols...); err != nil {
-			fail(err, "Failed to write protoset to %s", *protosetOut)
-		}
-		if err := writeProtos(descSource, symbol); err != nil {
-			fail(err, "Failed to write protos to %s", *protoOut)
+	case *desc.FieldDescriptor:
+		elementType = "a field"
+		if d.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			elementType = "a group field"
+		} else if d.IsExtension() {
+			elementType = "an extension"
 		}
+	case *desc.OneOfDescriptor:
+		elementType = "a one-of"
+	case *desc.EnumDescriptor:
+		elementType = "an enum"
+	case *desc.EnumValueDescriptor:
+		elementType = "an enum value"
+	case *desc.ServiceDescriptor:
+		elementType = "a service"
+	case *desc.MethodDescriptor:
+		elementType = "a method"
+	default:
+		return nil, "", fmt.Errorf("descriptor has unrecognized type %T", dsc)
+	}
+	return dsc, elementType, nil
+}
 
-	} else {
-		// Invoke an RPC
-		if cc == nil {
-			cc = dial()
-		}
-		var in io.Reader
-		if *data == "@" {
-			in = os.Stdin
-		} else {
-			in = strings.NewReader(*data)
-		}
+// replaySpeed returns the speed at which recorded timing is reproduced, or
+// zero if -preserve-timing was not given.
+func replaySpeed() float64 {
+	if !*preserveTiming {
+		return 0
+	}
+	if *timingSpeed <= 0 {
+		fail(nil, "The -timing-speed argument must be positive.")
+	}
+	return *timingSpeed
+}
 
-		// if not verbose output, then also include record delimiters
-		// between each message, so output could potentially be piped
-		// to another grpcurl process
-		includeSeparators := verbosityLevel == 0
-		options := grpcurl.FormatOptions{
-			EmitJSONDefaultFields: *emitDefaults,
-			IncludeTextSeparator:  includeSeparators,
-			AllowUnknownFields:    *allowUnknownFields,
+// loadFileSource returns a descriptor source backed by the files given via
+// -protoset or -proto flags, or the module given via -bsr. It returns nil if
+// none of them were used.
+func loadFileSource() grpcurl.DescriptorSource {
+	fileSource, err := readFileSource()
+	if err != nil {
+		if len(protoset) > 0 {
+			fail(err, "Failed to process proto descriptor sets.")
 		}
-		rf, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.Format(*format), descSource, in, options)
-		if err != nil {
-			fail(err, "Failed to construct request parser and formatter for %q", *format)
+		if *bsrModule != "" {
+			fail(err, "Failed to fetch module from the Buf Schema Registry")
+		}
+		if *protoGit != "" {
+			fail(err, "Failed to process proto sources from git repository.")
 		}
-		h := &grpcurl.DefaultEventHandler{
-			Out:            os.Stdout,
-			Formatter:      formatter,
-			VerbosityLevel: verbosityLevel,
+		if *bufWorkspaceDir != "" {
+			fail(err, "Failed to process proto sources from buf workspace.")
 		}
+		fail(err, "Failed to process proto source files.")
+	}
+	return fileSource
+}
 
-		invokeTiming := rootTiming.Child("InvokeRPC")
-		err = grpcurl.InvokeRPC(ctx, descSource, cc, symbol, append(addlHeaders, rpcHeaders...), h, rf.Next)
-		invokeTiming.Done()
+// readFileSource is like loadFileSource, but returns an error instead of
+// exiting if the files cannot be processed.
+func readFileSource() (grpcurl.DescriptorSource, error) {
+	if len(protoset) > 0 {
+		return loadProtosets(protoset)
+	} else if *protoGit != "" {
+		return loadProtoGitSource(*protoGit, importPaths, protoFiles, protoExcludes)
+	} else if *bufWorkspaceDir != "" {
+		return loadBufWorkspaceSource(*bufWorkspaceDir, importPaths, protoFiles, protoExcludes)
+	} else if len(protoFiles) > 0 {
+		files, err := expandProtoFiles(importPaths, protoFiles, protoExcludes)
 		if err != nil {
-			if errStatus, ok := status.FromError(err); ok && *formatError {
-				h.Status = errStatus
-			} else {
-				fail(err, "Error invoking method %q", symbol)
-			}
-		}
-		reqSuffix := ""
-		respSuffix := ""
-		reqCount := rf.NumRequests()
-		if reqCount != 1 {
-			reqSuffix = "s"
-		}
-		if h.NumResponses != 1 {
-			respSuffix = "s"
-		}
-		if verbosityLevel > 0 {
-			fmt.Printf("Sent %d request%s and received %d response%s\n", reqCount, reqSuffix, h.NumResponses, respSuffix)
-		}
-		if h.Status.Code() != codes.OK {
-			if *formatError {
-				printFormattedStatus(os.Stderr, h.Status, formatter)
-			} else {
-				grpcurl.PrintStatus(os.Stderr, h.Status, formatter)
-			}
-			exit(statusCodeOffset + int(h.Status.Code()))
+			return nil, err
 		}
+		return grpcurl.DescriptorSourceFromProtoFiles(importPaths, files...)
+	} else if *bsrModule != "" {
+		return loadBSRSource(*bsrModule)
 	}
+	return nil, nil
 }
 
 func dumpTiming(td *timingData, lvl int) {
@@ -1022,13 +1401,45 @@ func dumpTiming(td *timingData, lvl int) {
 func usage() {
 	fmt.Fprintf(os.Stderr, `Usage:
 	%s [flags] [address] [list|describe] [symbol]
-
-The 'address' is only optional when used with 'list' or 'describe' and a
-protoset or proto flag is provided.
+	%s [flags] [address] list -a [service]
+	%s [flags] [address] replay session-file
+	%s [flags] address proxy
+	%s [flags] [address] export-openapi [service]
+	%s [flags] [address] diff protoset-file
+	%s [flags] mock
+	%s [flags] export testcase session-file directory
+	%s [flags] support-bundle address
+	%s [flags] shell address
+	%s [flags] address cert
+	%s [flags] [address] validate method
+	%s [flags] [address] test suite-file
+	%s [flags] -batch manifest-file address
+	%s completion bash|zsh|fish
+
+The 'address' is only optional when used with 'list', 'describe', 'diff',
+'validate', or 'export-openapi' and a protoset or proto flag is provided, or
+with 'replay'.
+
+The 'address' may be a comma-separated list, like 'host1:443,host2:443', or
+more addresses may be given via -alt-address. The addresses are tried in order
+until a connection succeeds, or calls are balanced across them with
+-lb-policy. In verbose mode, the address that served each call is shown. An
+address like 'srv://_grpc._tcp.service.example.com' is resolved via the DNS SRV
+records of that name, into the addresses of their targets, in order of
+priority. The server's name is then assumed to be 'service.example.com', unless
+-authority or -servername is given. An address like
+'consul://service-name?dc=dc1&tag=grpc' is resolved into the addresses of the
+healthy instances of that service, via the Consul agent given by the
+CONSUL_HTTP_ADDR environment variable (default '127.0.0.1:8500'), using the
+CONSUL_HTTP_TOKEN environment variable, if set. The 'dc', 'tag' (which may be
+repeated), and 'near' parameters are optional. The server's name is then
+assumed to be 'service-name'.
 
 If 'list' is indicated, the symbol (if present) should be a fully-qualified
 service name. If present, all methods of that service are listed. If not
 present, all exposed services are listed, or all services defined in protosets.
+With 'list -a', every service (or just the given one) is listed along with its
+methods, each marked as unary, client-stream, server-stream, or bidi-stream.
 
 If 'describe' is indicated, the descriptor for the given symbol is shown. The
 symbol should be a fully-qualified service, enum, or message name. If no symbol
@@ -1040,15 +1451,206 @@ be used to invoke the named method. If no body is given but one is required
 (i.e. the method is unary or server-streaming), an empty instance of the
 method's request type will be sent.
 
+If 'export-openapi' is indicated, an OpenAPI v3 document in JSON format is
+written to stdout that describes the given service or, if no service is given,
+all exposed or known services. Methods with google.api.http annotations are
+described using those HTTP bindings; others are described as a POST to the
+method's gRPC path.
+
+If 'diff' is indicated, the services exposed by the server (or defined in the
+given protoset or proto flags) are compared to those defined in the given
+protoset file, along with the message and enum types they use. Each added (+),
+removed (-), or changed (~) service, method, field, type, and enum value is
+printed, describing how the file differs from the other source.
+
+If 'replay' is indicated, the requests and request metadata in the given session
+file, which was written using the -record flag, are used to invoke the same
+method again. The session can be replayed against a different address than
+the one that was originally used. Descriptors stored in the session are used
+unless other descriptor sources are given. If no address is given, no RPC is
+made: the recorded responses and status are printed as if the method had been
+invoked, optionally with their original timing (see -preserve-timing).
+
+If 'proxy' is indicated, a server is started that listens on the address given
+via -listen and forwards all calls to the given address. Request and response
+messages are logged as they pass through, decoded using the descriptor sources.
+The proxy verb may also be given first, with the address provided via -target.
+
+If 'mock' is indicated, a server is started that implements all services found
+in the given protoset or proto flags. Responses are generated from templates
+or can be defined in a stubs file (see -stubs) or by recorded sessions (see
+-session). It listens on the address given
+via -listen until the process is interrupted.
+
+If 'support-bundle' is indicated, diagnostics for the given address are
+collected into a gzipped tar archive (see -bundle-out) that can be attached to
+a support ticket. The archive describes the versions of grpcurl, gRPC, and Go,
+the command line (with header values redacted), name resolution, the
+connection and TLS handshake, the services listed via server reflection, and
+the result of a standard health check. A failed check is recorded in the
+archive rather than causing the command to fail.
+
+If 'shell' is indicated, an interactive prompt is opened for the given address,
+whose commands list and describe services and invoke methods, like 'call
+my.Service/Method {"id": 1}'. The connection and descriptors are shared by all
+commands, so the cost of dialing and reflection is paid once per session. When
+run in a terminal, service and method names are completed via Tab, and earlier
+commands are recalled via the arrow keys. Type 'help' for a list of commands.
+
+If 'cert' is indicated, the certificate chain presented by the server at the
+given address is printed, including each certificate's subject, subject
+alternative names, issuer, validity, and key usage, and nothing is invoked.
+The chain is printed even if it fails verification, along with the error.
+
+If 'validate' is indicated, the request data given via -d is parsed as the
+requests of the given method, which is not invoked. Each problem is printed:
+unknown fields, values of the wrong type, too many messages for the method, and
+missing required fields, which are proto2 required fields and those annotated
+as required using google.api.field_behavior, protovalidate, or
+protoc-gen-validate. This can check files of canned requests, such as in a
+pre-commit hook.
+
+If 'test' is indicated, the calls defined in the given YAML file are made and
+the result of each is printed, followed by a summary. Each call names a method,
+its request messages and headers, and its expected outcome: the status (OK by
+default), text the responses contain, jq expressions that are true for every
+response, and a maximum latency. The calls are made one after another or, if
+the suite sets 'parallel', several at once. A call may 'capture' values from
+its last response using jq expressions, which later calls reference as
+'${name}' in their request data and headers; such a call waits for the one
+that captures the value, even when calls run in parallel. The address may be
+given first or set via the suite's 'address', or -target if the verb comes
+first. A JUnit XML report can be written via -junit-out. For example:
+
+	address: localhost:8080
+	tests:
+	  - name: log in
+	    method: acme.AuthService/Login
+	    request: {"user": "test", "password": "secret"}
+	    capture:
+	      token: .session.token
+	  - name: get item
+	    method: acme.ItemService/GetItem
+	    headers: ["authorization: Bearer ${token}"]
+	    request: {"id": "123"}
+	    expect:
+	      contains: ['"name": "widget"']
+	      jq: ['.price > 0']
+	      max_latency: 0.5
+	  - method: acme.ItemService/GetItem
+	    request: {"id": "missing"}
+	    expect:
+	      status: NOT_FOUND
+
+If -batch is given instead of a verb or method, the calls listed in the given
+manifest file are made over a single connection, and the result of each is
+printed as a line of JSON (see -batch and -parallel). If -batch-matrix is
+also given, no address is given; the calls are made against the address of
+each environment in the matrix file, and a report that compares their outcomes
+across the environments is written to stderr.
+
+If 'completion' is indicated, a script that provides tab completion for the
+given shell is written to stdout. For example, add 'source <(grpcurl
+completion bash)' to ~/.bashrc. Besides flags and verbs, the script completes
+service and method names, by listing them with the flags and address already
+on the command line. These names are cached for a minute.
+
+If 'export testcase' is indicated, the given session file, which was written
+using the -record flag, is converted into a self-contained directory with the
+session's descriptors, request messages, expected responses, and a manifest
+that can be run with the -batch flag.
+
 The address will typically be in the form "host:port" where host can be an IP
 address or a hostname and port is a numeric port or service name. If an IPv6
-address is given, it must be surrounded by brackets, like "[2001:db8::1]". For
-Unix variants, if a -unix=true flag is present, then the address must be the
-path to the domain socket.
+address is given, it must be surrounded by brackets, like "[2001:db8::1]". A
+link-local address may include a zone, like "[fe80::1%%eth0]:50051"; as in
+URLs, the '%%' may also be escaped as "%%25". For Unix variants, if a -unix=true
+flag is present, then the address must be the path to the domain socket. The
+address may also be a URL like "unix:///path/to/socket", "unix-abstract:name"
+for an abstract socket on Linux, or "npipe:////./pipe/name" for a named pipe
+on Windows.
+
+An address like "ssh://user@bastion:22/host:port" connects to "host:port" via
+an SSH tunnel through the SSH server "bastion", such as a jump host. The user
+defaults to the current user and the SSH port to 22. The host is resolved by
+the SSH server, so it may be a name that is only known inside its network.
+
+The formats of request and response data, for -format and -format-out, are
+those registered with the grpcurl library: %s. Besides these,
+-format also accepts 'csv', and -format-out also accepts 'ndjson' and
+'protoscope'.
+
+Any flag that is not given on the command line may be set via an environment
+variable named after the flag, in upper case with dashes replaced by
+underscores and prefixed with GRPCURL_. For example, GRPCURL_PLAINTEXT=true is
+the same as -plaintext and GRPCURL_MAX_TIME=5 is the same as -max-time 5. For
+flags that may be repeated, such as -H, the variable may contain multiple
+values, one per line.
+
+Exit status:
+	0	The command succeeded.
+	1	An error occurred, such as failing to connect to the server, to
+		resolve a symbol, or to parse request data.
+	2	The arguments were invalid.
+	3	The RPC succeeded but took longer than -max-latency.
+	4	The 'diff' verb found differences.
+	5	The 'validate' verb found invalid request data.
+	6	The RPC did not meet an expectation given via -expect-status,
+		-expect-response-contains, or -expect-jq, a call run by the
+		'test' verb failed, or a call in a -batch manifest did not meet
+		its expectation.
+	64+N	The RPC completed with the non-OK gRPC status code N. For
+		example, 69 indicates NOT_FOUND (code 5). If -exit-code-mode is
+		'passthrough', the exit code is N instead. If it is 'curl', the
+		exit code is 0. Which statuses cause a non-zero exit code can be
+		changed with -fail-on-codes or -ok-codes.
 
 Available flags:
-`, os.Args[0])
-	flags.PrintDefaults()
+`, os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], registeredFormatList())
+	printFlagDefaults()
+}
+
+// isUnsupportedFlag reports whether the named flag is not supported by this
+// build of grpcurl, such as -key-provider in a build without cgo. Such flags
+// are left out of the usage and of completions.
+func isUnsupportedFlag(name string) bool {
+	return name == "key-provider" && !pkcs11Supported
+}
+
+// printFlagDefaults prints the flags and their defaults, like
+// flags.PrintDefaults, except for those that are not supported.
+func printFlagDefaults() {
+	supported := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	supported.SetOutput(flags.Output())
+	flags.VisitAll(func(f *flag.Flag) {
+		if isUnsupportedFlag(f.Name) {
+			return
+		}
+		supported.Var(f.Value, f.Name, f.Usage)
+		supported.Lookup(f.Name).DefValue = f.DefValue
+	})
+	supported.PrintDefaults()
+}
+
+// isRegisteredFormat returns true if the given format of request or response
+// data is registered with the grpcurl library.
+func isRegisteredFormat(format string) bool {
+	for _, f := range grpcurl.RegisteredFormats() {
+		if string(f) == format {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredFormatList returns the formats registered with the grpcurl
+// library, quoted and separated by commas, for use in messages.
+func registeredFormatList() string {
+	var names []string
+	for _, f := range grpcurl.RegisteredFormats() {
+		names = append(names, "'"+string(f)+"'")
+	}
+	return strings.Join(names, ", ")
 }
 
 func prettify(docString string) string {
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	grpcreflection "google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestAnyTypeSource(t *testing.T) {
+	// the type in the Any message is only in the fallback source, which
+	// stands in for server reflection
+	fileSource, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSource, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/example.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := anyTypeSource{DescriptorSource: fileSource, reflection: otherSource}
+
+	// a TestRequest, with file_names: ["a"]
+	msg := &anypb.Any{TypeUrl: "type.googleapis.com/TestRequest", Value: []byte{10, 1, 'a'}}
+	for _, tc := range []struct {
+		source   grpcurl.DescriptorSource
+		expected string
+	}{
+		{fileSource, `"@value":"CgFh"`},
+		{source, `"fileNames":["a"]`},
+	} {
+		_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, tc.source, nil, grpcurl.FormatOptions{CompactJSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		str, err := formatter(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(str, tc.expected) {
+			t.Errorf("expected output to contain %s, got %s", tc.expected, str)
+		}
+	}
+	if _, err := source.FindSymbol("testing.TestService"); err != nil {
+		t.Errorf("expected to find symbol in the first source: %v", err)
+	}
+	if _, err := source.FindSymbol("foo.Nope"); err == nil {
+		t.Error("expected error for unknown symbol")
+	}
+}
+
+func TestKeepaliveParams(t *testing.T) {
+	for _, tc := range []struct {
+		time, timeout float64
+		permit        bool
+		expected      keepalive.ClientParameters
+	}{
+		{time: 30, expected: keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 30 * time.Second}},
+		{time: 30, timeout: 2.5, permit: true, expected: keepalive.ClientParameters{Time: 30 * time.Second, Timeout: 2500 * time.Millisecond, PermitWithoutStream: true}},
+	} {
+		if actual := keepaliveParams(tc.time, tc.timeout, tc.permit); actual != tc.expected {
+			t.Errorf("%v, %v, %v: expected %+v, got %+v", tc.time, tc.timeout, tc.permit, tc.expected, actual)
+		}
+	}
+}
+
+// recordedCall is a call received by a server started by
+// startRecordingServer.
+type recordedCall struct {
+	method string
+	// client is the client's address, which identifies its connection
+	client string
+	md     metadata.MD
+}
+
+// startRecordingServer starts a server of the test service, with server
+// reflection, that records every call it receives. It returns the server's
+// address and a function that returns the calls received so far.
+func startRecordingServer(t *testing.T) (string, func() []recordedCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []recordedCall
+	record := func(ctx context.Context, method string) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		var client string
+		if p, ok := peer.FromContext(ctx); ok {
+			client = p.Addr.String()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, recordedCall{method: method, client: client, md: md})
+	}
+	svr := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			record(ctx, info.FullMethod)
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			record(ss.Context(), info.FullMethod)
+			return handler(srv, ss)
+		}))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	grpcreflection.Register(svr)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	return l.Addr().String(), func() []recordedCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedCall(nil), calls...)
+	}
+}
+
+func TestSeparateReflectionConnection(t *testing.T) {
+	addr, calls := startRecordingServer(t)
+	_, stderr, code := runGrpcurl(t, "-plaintext", "-separate-reflection-connection",
+		"-H", "x-all: yes", "-reflect-header", "x-reflect: yes", "-rpc-header", "x-rpc: yes",
+		addr, "testing.TestService/EmptyCall")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+
+	var reflClients, rpcClients []string
+	for _, c := range calls() {
+		if strings.HasPrefix(c.method, "/grpc.reflection.") {
+			reflClients = append(reflClients, c.client)
+			if len(c.md.Get("x-reflect")) != 1 || len(c.md.Get("x-rpc")) != 0 {
+				t.Errorf("reflection call %s should only have the reflection header: %v", c.method, c.md)
+			}
+		} else {
+			rpcClients = append(rpcClients, c.client)
+			if len(c.md.Get("x-rpc")) != 1 || len(c.md.Get("x-reflect")) != 0 {
+				t.Errorf("call %s should only have the RPC header: %v", c.method, c.md)
+			}
+		}
+		if len(c.md.Get("x-all")) != 1 {
+			t.Errorf("call %s should have the header given via -H: %v", c.method, c.md)
+		}
+	}
+	if len(reflClients) == 0 || len(rpcClients) != 1 {
+		t.Fatalf("expected reflection calls and 1 RPC, got %d and %d", len(reflClients), len(rpcClients))
+	}
+	for _, client := range reflClients {
+		if client == rpcClients[0] {
+			t.Errorf("expected reflection to use a separate connection, but it used the RPC's, from %s", client)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc/credentials"
+)
+
+// handshakeRecorder wraps transport credentials in order to capture details
+// about the handshake, so they can be reported when -handshake-only is used.
+type handshakeRecorder struct {
+	credentials.TransportCredentials
+
+	mu       sync.Mutex
+	start    time.Time
+	duration time.Duration
+	authInfo credentials.AuthInfo
+}
+
+func (r *handshakeRecorder) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	start := time.Now()
+	conn, authInfo, err := r.TransportCredentials.ClientHandshake(ctx, addr, rawConn)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start = start
+	r.duration = time.Since(start)
+	r.authInfo = authInfo
+	return conn, authInfo, err
+}
+
+// addTiming adds the duration of the handshake as a child of the given
+// timing data.
+func (r *handshakeRecorder) addTiming(td *timingData) {
+	if td == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.start.IsZero() {
+		return
+	}
+	td.Sub = append(td.Sub, &timingData{Title: "Handshake", Start: r.start, Value: r.duration})
+}
+
+// printHandshakeDetails describes the negotiated connection parameters to the
+// given writer. A nil recorder means that no transport security was used.
+func printHandshakeDetails(w io.Writer, target string, r *handshakeRecorder) {
+	fmt.Fprintf(w, "Connected to %s\n", target)
+	if r == nil {
+		fmt.Fprintln(w, "  Security: none (plain-text)")
+		return
+	}
+	r.mu.Lock()
+	authInfo := r.authInfo
+	r.mu.Unlock()
+
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	if !ok {
+		if authInfo != nil {
+			fmt.Fprintf(w, "  Security: %s\n", authInfo.AuthType())
+		}
+		return
+	}
+	state := tlsInfo.State
+	fmt.Fprintf(w, "  Security: %s\n", tlsInfo.AuthType())
+	printTLSParameters(w, state)
+	if state.ServerName != "" {
+		fmt.Fprintf(w, "  Server name: %s\n", state.ServerName)
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		fmt.Fprintf(w, "  Server certificate: %s\n", leaf.Subject)
+		if len(leaf.DNSNames) > 0 {
+			fmt.Fprintf(w, "    DNS names: %s\n", strings.Join(leaf.DNSNames, ", "))
+		}
+		fmt.Fprintf(w, "    Issuer: %s\n", leaf.Issuer)
+		fmt.Fprintf(w, "    Expires: %s\n", leaf.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// printNegotiatedTLS describes the TLS version, cipher suite, and ALPN protocol
+// that were negotiated, for verbose output. Nothing is printed if TLS was not
+// used.
+func printNegotiatedTLS(w io.Writer, r *handshakeRecorder) {
+	r.mu.Lock()
+	authInfo := r.authInfo
+	r.mu.Unlock()
+	if tlsInfo, ok := authInfo.(credentials.TLSInfo); ok {
+		fmt.Fprintln(w, "\nNegotiated TLS parameters:")
+		printTLSParameters(w, tlsInfo.State)
+	}
+}
+
+func printTLSParameters(w io.Writer, state tls.ConnectionState) {
+	alpn := state.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "(none)"
+	}
+	fmt.Fprintf(w, "  Version: %s\n", tls.VersionName(state.Version))
+	fmt.Fprintf(w, "  Cipher suite: %s\n", tls.CipherSuiteName(state.CipherSuite))
+	fmt.Fprintf(w, "  ALPN: %s\n", alpn)
+}
+
+// runHandshake prints the details of the handshake with the server, for
+// -handshake-only. If server reflection was requested explicitly, it also
+// checks that reflection works by listing the server's services.
+func runHandshake(target string, handshake *handshakeRecorder, refClient *grpcreflect.Client, rootTiming *timingData) {
+	printHandshakeDetails(os.Stdout, target, handshake)
+	if refClient != nil && reflection.set {
+		reflTiming := rootTiming.Child("Reflection")
+		svcs, err := refClient.ListServices()
+		reflTiming.Done()
+		if err != nil {
+			fail(err, "Failed to list services via reflection")
+		}
+		fmt.Printf("  Reflection: %d service(s) exposed\n", len(svcs))
+	}
+}
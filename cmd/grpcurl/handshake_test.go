@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+const testCACert = "../../internal/testing/tls/ca.crt"
+
+// startTLSTestServer starts a server of the test service that uses TLS, with
+// a certificate for localhost that is signed by testCACert, and returns its
+// address.
+func startTLSTestServer(t *testing.T) string {
+	t.Helper()
+	creds, err := grpcurl.ServerTransportCredentials("", "../../internal/testing/tls/server.crt", "../../internal/testing/tls/server.key", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := grpc.NewServer(grpc.Creds(creds))
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	return l.Addr().String()
+}
+
+func TestHandshakeRecorder(t *testing.T) {
+	addr := startTLSTestServer(t)
+	tlsConf, err := grpcurl.ClientTLSConfig(false, testCACert, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &handshakeRecorder{TransportCredentials: credentials.NewTLS(tlsConf)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := grpcurl.BlockingDial(ctx, "", addr, r)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer cc.Close()
+
+	var out bytes.Buffer
+	printHandshakeDetails(&out, addr, r)
+	for _, s := range []string{
+		"Connected to " + addr + "\n  Security: tls\n  Version: TLS 1.",
+		"\n  Cipher suite: TLS_",
+		"  ALPN: h2\n",
+		"  Server certificate: CN=server\n    DNS names: localhost\n    Issuer: ",
+		"    Expires: 2027-08-25T15:45:52Z\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected output to contain %q:\n%s", s, out.String())
+		}
+	}
+
+	out.Reset()
+	printNegotiatedTLS(&out, r)
+	if !strings.HasPrefix(out.String(), "\nNegotiated TLS parameters:\n  Version: TLS 1.") {
+		t.Errorf("unexpected negotiated parameters:\n%s", out.String())
+	}
+
+	td := &timingData{Title: "Dial"}
+	r.addTiming(td)
+	if len(td.Sub) != 1 || td.Sub[0].Title != "Handshake" || td.Sub[0].Value <= 0 {
+		t.Errorf("expected handshake timing, got %+v", td.Sub)
+	}
+}
+
+func TestPrintHandshakeDetailsPlaintext(t *testing.T) {
+	var out bytes.Buffer
+	printHandshakeDetails(&out, "localhost:8080", nil)
+	if expected := "Connected to localhost:8080\n  Security: none (plain-text)\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestHandshakeOnly(t *testing.T) {
+	addr := startTLSTestServer(t)
+	stdout, stderr, code := runGrpcurl(t, "-cacert", testCACert, "-handshake-only", addr)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	for _, s := range []string{"Connected to " + addr + "\n", "  Security: tls\n", "  Server certificate: CN=server\n"} {
+		if !strings.Contains(stdout, s) {
+			t.Errorf("expected output to contain %q:\n%s", s, stdout)
+		}
+	}
+
+	cc, _ := startTestServer(t)
+	stdout, stderr, code = runGrpcurl(t, "-plaintext", "-handshake-only", cc.Target())
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	// the output ends with timing data
+	if expected := "Connected to " + cc.Target() + "\n  Security: none (plain-text)\nTiming Data: "; !strings.HasPrefix(stdout, expected) {
+		t.Errorf("expected output to start with %q, got %q", expected, stdout)
+	}
+
+	// the server's certificate is not trusted without its CA
+	stdout, stderr, code = runGrpcurl(t, "-connect-timeout", "2", "-handshake-only", addr)
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if stdout != "" || !strings.Contains(stderr, "Failed to dial target host") {
+		t.Errorf("expected dial error, got stdout %q and stderr %q", stdout, stderr)
+	}
+
+	// -handshake-only does not take a verb or method
+	_, stderr, code = runGrpcurl(t, "-plaintext", "-handshake-only", cc.Target(), "list")
+	if code != 2 {
+		t.Errorf("expected exit code 2, got %d: %s", code, stderr)
+	}
+}
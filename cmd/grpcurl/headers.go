@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// readHeaderFile reads headers from the given file, given via -header-file.
+// Each non-blank line that is not a comment (starting with '#') is a header
+// in "name: value" form. References to environment variables, in '${NAME}'
+// form, are expanded.
+func readHeaderFile(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var headers []string
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if pos := strings.IndexByte(line, ':'); pos <= 0 {
+			return nil, fmt.Errorf("line %d: expecting header in 'name: value' form", lineNum)
+		}
+		headers = append(headers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return grpcurl.ExpandHeaders(headers)
+}
+
+// readBinaryHeaderFiles returns the given headers, but with the values of
+// binary headers (those whose names end in "-bin") that are in "@file" form
+// replaced with the base64-encoded contents of the named file.
+func readBinaryHeaderFiles(headers []string) ([]string, error) {
+	result := make([]string, len(headers))
+	for i, header := range headers {
+		result[i] = header
+		pos := strings.IndexByte(header, ':')
+		if pos < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(header[:pos]))
+		val := strings.TrimSpace(header[pos+1:])
+		if !strings.HasSuffix(name, "-bin") || !strings.HasPrefix(val, "@") {
+			continue
+		}
+		b, err := os.ReadFile(val[1:])
+		if err != nil {
+			return nil, fmt.Errorf("header %q: %w", name, err)
+		}
+		result[i] = name + ": " + base64.StdEncoding.EncodeToString(b)
+	}
+	return result, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadBinaryHeaderFiles(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(fileName, []byte{0, 1, 2}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	headers := []string{
+		"x-foo: @bar",
+		"X-Data-Bin: @" + fileName,
+		"x-other-bin: AAEC",
+		"x-empty",
+	}
+	actual, err := readBinaryHeaderFiles(headers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"x-foo: @bar", "x-data-bin: AAEC", "x-other-bin: AAEC", "x-empty"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong headers: expected %v, got %v", expected, actual)
+	}
+
+	if _, err := readBinaryHeaderFiles([]string{"x-data-bin: @" + fileName + ".missing"}); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestReadHeaderFile(t *testing.T) {
+	t.Setenv("GRPCURL_TEST_TOKEN", "abc")
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "headers.txt")
+	contents := "# credentials\nauthorization: Bearer ${GRPCURL_TEST_TOKEN}\n\n  x-tenant: acme  \n"
+	if err := os.WriteFile(fileName, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := readHeaderFile(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"authorization: Bearer abc", "x-tenant: acme"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("wrong headers: expected %v, got %v", expected, actual)
+	}
+
+	badFileName := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(badFileName, []byte("x-foo: bar\njust a line\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readHeaderFile(badFileName); err == nil {
+		t.Error("expected error for line without a header")
+	}
+}
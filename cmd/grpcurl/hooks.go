@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// callInfo describes an invocation, for the commands given via -pre-call-exec
+// and -post-call-exec. The remaining fields are only set once the call is
+// done.
+type callInfo struct {
+	target    string
+	method    string
+	done      bool
+	stat      *status.Status
+	duration  time.Duration
+	requests  int
+	responses int
+}
+
+// env returns the environment variables that describe the call.
+func (c callInfo) env() []string {
+	env := []string{
+		"GRPCURL_TARGET=" + c.target,
+		"GRPCURL_METHOD=" + c.method,
+	}
+	if c.done {
+		env = append(env,
+			"GRPCURL_STATUS="+c.stat.Code().String(),
+			"GRPCURL_STATUS_CODE="+strconv.Itoa(int(c.stat.Code())),
+			"GRPCURL_STATUS_MESSAGE="+c.stat.Message(),
+			"GRPCURL_DURATION_MS="+strconv.FormatInt(c.duration.Milliseconds(), 10),
+			"GRPCURL_REQUEST_COUNT="+strconv.Itoa(c.requests),
+			"GRPCURL_RESPONSE_COUNT="+strconv.Itoa(c.responses),
+		)
+	}
+	return env
+}
+
+// runCallHook runs the given command line with the call's details in its
+// environment. The command's output is sent to stderr so that it does not
+// get mixed up with the RPC's output.
+func runCallHook(cmdLine string, info callInfo) error {
+	cmd := shellCommand(cmdLine)
+	cmd.Env = append(os.Environ(), info.env()...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%q failed: %w", cmdLine, err)
+	}
+	return nil
+}
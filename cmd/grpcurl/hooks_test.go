@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallInfoEnv(t *testing.T) {
+	info := callInfo{target: "localhost:8080", method: "foo.Bar/Baz"}
+	expected := []string{"GRPCURL_TARGET=localhost:8080", "GRPCURL_METHOD=foo.Bar/Baz"}
+	if actual := info.env(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	info.done = true
+	info.stat = status.New(codes.NotFound, "no such thing")
+	info.duration = 1500 * time.Millisecond
+	info.requests = 2
+	info.responses = 3
+	expected = append(expected,
+		"GRPCURL_STATUS=NotFound",
+		"GRPCURL_STATUS_CODE=5",
+		"GRPCURL_STATUS_MESSAGE=no such thing",
+		"GRPCURL_DURATION_MS=1500",
+		"GRPCURL_REQUEST_COUNT=2",
+		"GRPCURL_RESPONSE_COUNT=3",
+	)
+	if actual := info.env(); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestRunCallHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands require a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	info := callInfo{target: "localhost:8080", method: "foo.Bar/Baz", done: true, stat: status.New(codes.OK, "")}
+	cmdLine := `echo "$GRPCURL_METHOD $GRPCURL_STATUS" > '` + out + `'`
+	if err := runCallHook(cmdLine, info); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "foo.Bar/Baz OK\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+
+	err = runCallHook("exit 3", info)
+	if err == nil || err.Error() != `"exit 3" failed: exit status 3` {
+		t.Errorf("expected failure of command, got %v", err)
+	}
+}
+
+func TestCallHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands require a POSIX shell")
+	}
+	cc, _ := startTestServer(t)
+	out := filepath.Join(t.TempDir(), "out")
+	args := []string{"-plaintext", "-protoset", "../../internal/testing/test.protoset"}
+	method := "testing.TestService/EmptyCall"
+
+	preCall := `echo "pre $GRPCURL_TARGET $GRPCURL_METHOD" >> '` + out + `'`
+	postCall := `echo "post $GRPCURL_STATUS $GRPCURL_STATUS_CODE $GRPCURL_STATUS_MESSAGE $GRPCURL_REQUEST_COUNT $GRPCURL_RESPONSE_COUNT" >> '` + out + `'`
+	_, stderr, code := runGrpcurl(t, append(args, "-pre-call-exec", preCall, "-post-call-exec", postCall,
+		"-H", "fail-early: 5", cc.Target(), method)...)
+	if code != 64+int(codes.NotFound) {
+		t.Errorf("expected exit code %d, got %d: %s", 64+int(codes.NotFound), code, stderr)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "pre " + cc.Target() + " testing.TestService/EmptyCall\npost NotFound 5 fail 0 0\n"
+	if string(b) != expected {
+		t.Errorf("expected hooks to write %q, got %q", expected, b)
+	}
+
+	// the RPC is not invoked if the pre-call command fails
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, code = runGrpcurl(t, append(args, "-pre-call-exec", "exit 3", "-post-call-exec", postCall, cc.Target(), method)...)
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr, `Pre-call command failed: "exit 3" failed: exit status 3`) {
+		t.Errorf("unexpected error output: %q", stderr)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected post-call command not to run, got %v", err)
+	}
+
+	// a failed post-call command is only a warning
+	stdout, stderr, code := runGrpcurl(t, append(args, "-post-call-exec", "exit 3", cc.Target(), method)...)
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if stdout != "{}\n" {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+	if !strings.Contains(stderr, `Warning: Post-call command failed: "exit 3" failed: exit status 3`) {
+		t.Errorf("unexpected error output: %q", stderr)
+	}
+}
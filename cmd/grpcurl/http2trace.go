@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+	"google.golang.org/grpc/credentials"
+	insecurecreds "google.golang.org/grpc/credentials/insecure"
+)
+
+// http2Tracer wraps transport credentials so that the HTTP/2 frames sent and
+// received over each connection, after the handshake, are logged, for
+// -trace-http2. Header blocks are decoded, so that the headers are logged
+// along with the frames that carry them.
+type http2Tracer struct {
+	credentials.TransportCredentials
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// newHTTP2Tracer returns a tracer that logs to the given writer. If creds is
+// nil, the connection is not secured.
+func newHTTP2Tracer(creds credentials.TransportCredentials, out io.Writer) *http2Tracer {
+	if creds == nil {
+		creds = insecurecreds.NewCredentials()
+	}
+	return &http2Tracer{TransportCredentials: creds, out: out}
+}
+
+func (t *http2Tracer) ClientHandshake(ctx context.Context, addr string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, authInfo, err := t.TransportCredentials.ClientHandshake(ctx, addr, rawConn)
+	if err != nil {
+		return conn, authInfo, err
+	}
+	t.logf("Connected to %s", conn.RemoteAddr())
+	sent := t.decode(">", true)
+	received := t.decode("<", false)
+	return &http2TraceConn{Conn: conn, sent: sent, received: received}, authInfo, nil
+}
+
+// logf writes a line of the trace. Lines for frames in each direction are
+// written from different goroutines, so they are written one at a time.
+func (t *http2Tracer) logf(msg string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, "[http2] %s\n", fmt.Sprintf(msg, args...))
+}
+
+// decode starts decoding frames written to the returned pipe, which is fed
+// the bytes sent or received over a connection, and logging them with the
+// given prefix. A client starts by sending the connection preface, which is
+// not a frame. If the bytes cannot be decoded, the rest of the connection's
+// frames are not logged.
+func (t *http2Tracer) decode(prefix string, client bool) *io.PipeWriter {
+	pr, pw := io.Pipe()
+	go func() {
+		defer pr.Close()
+		if client {
+			preface := make([]byte, len(http2.ClientPreface))
+			if _, err := io.ReadFull(pr, preface); err != nil {
+				return
+			}
+		}
+		fr := http2.NewFramer(io.Discard, pr)
+		fr.SetMaxReadFrameSize(1<<24 - 1)
+		fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+		for {
+			f, err := fr.ReadFrame()
+			if se, ok := err.(http2.StreamError); ok {
+				// the frame is malformed, but the connection can go on
+				t.logf("%s invalid frame on stream %d: %v", prefix, se.StreamID, se)
+				continue
+			}
+			if err != nil {
+				if err != io.EOF && err != io.ErrClosedPipe {
+					t.logf("%s failed to decode frame, tracing stopped: %v", prefix, err)
+				}
+				// consume the rest so the connection is not blocked
+				_, _ = io.Copy(io.Discard, pr)
+				return
+			}
+			t.logFrame(prefix, f)
+		}
+	}()
+	return pw
+}
+
+func (t *http2Tracer) logFrame(prefix string, f http2.Frame) {
+	hdr := f.Header()
+	desc := fmt.Sprintf("%s %s stream=%d", prefix, hdr.Type, hdr.StreamID)
+	var details []string
+	var headers []hpack.HeaderField
+	switch f := f.(type) {
+	case *http2.DataFrame:
+		details = append(details, fmt.Sprintf("length=%d", len(f.Data())))
+	case *http2.MetaHeadersFrame:
+		headers = f.Fields
+		if f.Truncated {
+			details = append(details, "truncated")
+		}
+	case *http2.WindowUpdateFrame:
+		details = append(details, fmt.Sprintf("increment=%d", f.Increment))
+	case *http2.RSTStreamFrame:
+		details = append(details, fmt.Sprintf("error=%s", f.ErrCode))
+	case *http2.GoAwayFrame:
+		details = append(details, fmt.Sprintf("last-stream=%d error=%s", f.LastStreamID, f.ErrCode))
+		if debug := f.DebugData(); len(debug) > 0 {
+			details = append(details, fmt.Sprintf("debug=%q", debug))
+		}
+	case *http2.SettingsFrame:
+		_ = f.ForeachSetting(func(s http2.Setting) error {
+			details = append(details, fmt.Sprintf("%s=%d", s.ID, s.Val))
+			return nil
+		})
+	case *http2.PingFrame:
+		details = append(details, fmt.Sprintf("data=%x", f.Data))
+	}
+	if flags := frameFlags(hdr); flags != "" {
+		details = append(details, flags)
+	}
+	if len(details) > 0 {
+		desc += " " + strings.Join(details, " ")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, "[http2] %s\n", desc)
+	for _, h := range headers {
+		fmt.Fprintf(t.out, "[http2] %s     %s: %s\n", prefix, h.Name, h.Value)
+	}
+}
+
+// frameFlags returns the names of the flags that are set in the given frame
+// header, like 'END_STREAM|END_HEADERS'. The same bit means different things
+// for different types of frames.
+func frameFlags(hdr http2.FrameHeader) string {
+	var names []string
+	has := func(flag http2.Flags) bool {
+		return hdr.Flags&flag != 0
+	}
+	switch hdr.Type {
+	case http2.FrameData:
+		if has(http2.FlagDataEndStream) {
+			names = append(names, "END_STREAM")
+		}
+	case http2.FrameHeaders:
+		if has(http2.FlagHeadersEndStream) {
+			names = append(names, "END_STREAM")
+		}
+		if has(http2.FlagHeadersEndHeaders) {
+			names = append(names, "END_HEADERS")
+		}
+	case http2.FrameSettings:
+		if has(http2.FlagSettingsAck) {
+			names = append(names, "ACK")
+		}
+	case http2.FramePing:
+		if has(http2.FlagPingAck) {
+			names = append(names, "ACK")
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// http2TraceConn copies the bytes sent and received over a connection to the
+// pipes from which they are decoded.
+type http2TraceConn struct {
+	net.Conn
+	sent, received *io.PipeWriter
+}
+
+func (c *http2TraceConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		_, _ = c.received.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *http2TraceConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		_, _ = c.sent.Write(b[:n])
+	}
+	return n, err
+}
+
+func (c *http2TraceConn) Close() error {
+	c.sent.Close()
+	c.received.Close()
+	return c.Conn.Close()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestHTTP2Tracer(t *testing.T) {
+	var out bytes.Buffer
+	tracer := newHTTP2Tracer(nil, &out)
+	client, server := net.Pipe()
+	defer server.Close()
+	conn, _, err := tracer.ClientHandshake(context.Background(), "localhost:8080", client)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	// the server discards what the client sends
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		t.Fatal(err)
+	}
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	_ = enc.WriteField(hpack.HeaderField{Name: ":method", Value: "POST"})
+	_ = enc.WriteField(hpack.HeaderField{Name: ":path", Value: "/pkg.Service/Method"})
+	fr := http2.NewFramer(conn, nil)
+	if err := fr.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndHeaders: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.WriteData(1, true, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// and replies with a GOAWAY
+	go func() {
+		_ = http2.NewFramer(server, nil).WriteGoAway(1, http2.ErrCodeEnhanceYourCalm, []byte("too many pings"))
+	}()
+	if _, err := http2.NewFramer(nil, conn).ReadFrame(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"[http2] > HEADERS stream=1 END_HEADERS\n",
+		"[http2] >     :path: /pkg.Service/Method\n",
+		"[http2] > DATA stream=1 length=5 END_STREAM\n",
+		`[http2] < GOAWAY stream=0 last-stream=1 error=ENHANCE_YOUR_CALM debug="too many pings"` + "\n",
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tracer.mu.Lock()
+		actual := out.String()
+		tracer.mu.Unlock()
+		missing := ""
+		for _, e := range expected {
+			if !strings.Contains(actual, e) {
+				missing = e
+				break
+			}
+		}
+		if missing == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected trace to contain %q, got:\n%s", missing, actual)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// interruptGracePeriod is how long to wait for the server to complete a
+// client-streaming or bidi-streaming call after the request stream is closed
+// due to an interrupt signal, before the call is cancelled.
+const interruptGracePeriod = 5 * time.Second
+
+// streamInterrupter handles interrupt signals, such as via Ctrl-C, during a
+// client-streaming or bidi-streaming call. Rather than killing the process
+// mid-stream, the first signal ends the request stream, so the server can
+// send its final response and status, and the second signal (or the end of
+// the grace period) cancels the call.
+type streamInterrupter struct {
+	sigs        chan os.Signal
+	interrupted chan struct{}
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+// handleStreamInterrupts starts handling interrupt signals for a streaming
+// call that uses the returned context. A message about the first signal is
+// printed to errOut. The caller must call stop once the call completes.
+func handleStreamInterrupts(ctx context.Context, errOut io.Writer, gracePeriod time.Duration) (context.Context, *streamInterrupter) {
+	ctx, cancel := context.WithCancel(ctx)
+	si := &streamInterrupter{
+		sigs:        make(chan os.Signal, 1),
+		interrupted: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	signal.Notify(si.sigs, os.Interrupt)
+	go func() {
+		defer cancel()
+		select {
+		case <-si.sigs:
+		case <-si.done:
+			return
+		}
+		fmt.Fprintln(errOut, "Interrupted: closing the request stream and waiting for the server to finish; interrupt again to cancel the call.")
+		close(si.interrupted)
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-si.sigs:
+		case <-timer.C:
+		case <-si.done:
+		}
+	}()
+	return ctx, si
+}
+
+// stop stops handling interrupt signals, restoring the default behavior of
+// killing the process.
+func (si *streamInterrupter) stop() {
+	si.stopOnce.Do(func() {
+		signal.Stop(si.sigs)
+		close(si.done)
+	})
+}
+
+// wrapParser returns a parser that yields no more requests once an interrupt
+// signal is received, even if the given parser is waiting for input, such as
+// a message being typed on stdin.
+func (si *streamInterrupter) wrapParser(rp grpcurl.RequestParser) grpcurl.RequestParser {
+	return &interruptibleRequestParser{RequestParser: rp, si: si}
+}
+
+type interruptibleRequestParser struct {
+	grpcurl.RequestParser
+	si    *streamInterrupter
+	count int
+}
+
+func (p *interruptibleRequestParser) Next(m proto.Message) error {
+	select {
+	case <-p.si.interrupted:
+		return io.EOF
+	default:
+	}
+	// parse into a separate message, since the wrapped parser may still be
+	// using it after the signal is received
+	msg := proto.Clone(m)
+	msg.Reset()
+	result := make(chan error, 1)
+	go func() {
+		result <- p.RequestParser.Next(msg)
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return err
+		}
+		m.Reset()
+		proto.Merge(m, msg)
+		p.count++
+		return nil
+	case <-p.si.interrupted:
+		// the call to the wrapped parser is abandoned
+		return io.EOF
+	}
+}
+
+func (p *interruptibleRequestParser) NumRequests() int {
+	return p.count
+}
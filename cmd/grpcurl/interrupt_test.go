@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// blockingRequestParser yields one message and then blocks until unblock is
+// closed, as if waiting for a message to be typed.
+type blockingRequestParser struct {
+	count   int
+	unblock chan struct{}
+}
+
+func (p *blockingRequestParser) Next(m proto.Message) error {
+	if p.count > 0 {
+		<-p.unblock
+		return io.EOF
+	}
+	p.count++
+	proto.Merge(m, wrapperspb.String("abc"))
+	return nil
+}
+
+func (p *blockingRequestParser) NumRequests() int {
+	return p.count
+}
+
+func TestStreamInterrupter(t *testing.T) {
+	for _, second := range []bool{true, false} {
+		var errOut bytes.Buffer
+		ctx, si := handleStreamInterrupts(context.Background(), &errOut, 50*time.Millisecond)
+		parser := &blockingRequestParser{unblock: make(chan struct{})}
+		rp := si.wrapParser(parser)
+
+		var msg wrapperspb.StringValue
+		if err := rp.Next(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetValue() != "abc" {
+			t.Errorf("expected request %q, got %q", "abc", msg.GetValue())
+		}
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			si.sigs <- os.Interrupt
+		}()
+		// the wrapped parser is blocked, but the signal ends the stream
+		if err := rp.Next(&msg); err != io.EOF {
+			t.Fatalf("expected io.EOF after signal, got %v", err)
+		}
+		if err := rp.Next(&msg); err != io.EOF {
+			t.Fatalf("expected io.EOF after signal, got %v", err)
+		}
+		if rp.NumRequests() != 1 {
+			t.Errorf("expected 1 request, got %d", rp.NumRequests())
+		}
+		if ctx.Err() != nil {
+			t.Error("call should not be cancelled by the first signal")
+		}
+		if !strings.Contains(errOut.String(), "Interrupted: closing the request stream") {
+			t.Errorf("unexpected output: %q", errOut.String())
+		}
+
+		// the call is cancelled by a second signal or after the grace period
+		if second {
+			si.sigs <- os.Interrupt
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("call was not cancelled")
+		}
+		si.stop()
+		// stopping more than once is harmless
+		si.stop()
+		close(parser.unblock)
+	}
+}
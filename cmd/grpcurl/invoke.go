@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// invocation is what main validated and set up for invoking a method, or for
+// replaying a session, which runInvoke uses to make the call.
+type invocation struct {
+	// target is the address of the server, which is empty when replaying a
+	// session without one
+	target string
+	symbol string
+	// session is the session being replayed, if any
+	session *recordedSession
+	source  grpcurl.DescriptorSource
+	// anySource is used to resolve the types of Any messages
+	anySource grpcurl.DescriptorSource
+	cc        *grpc.ClientConn
+	codec     encoding.Codec
+	headers   []string
+
+	// inFormat is the format of the request data given to the parser, and
+	// outFormat that of the responses
+	inFormat, outFormat grpcurl.Format
+	compactJSON         bool
+	csvFieldMapping     map[string]string
+	filesPattern        string
+	filter              *jqFilter
+	outTemplate         *template.Template
+	expectations        *responseExpectations
+	extraOutputs        []*extraOutput
+	dump                *rawDump
+	events              *eventLog
+	statsOut            io.Writer
+	timing              *timingReport
+	tracer              *otelTracer
+	rootTiming          *timingData
+	exitPolicy          statusExitPolicy
+	verbosityLevel      int
+}
+
+// runInvoke invokes a method, or replays a session, and prints the responses
+// and status. It exits with an error code if the call fails, does not meet
+// its expectations, or takes longer than -max-latency.
+func runInvoke(ctx context.Context, inv *invocation) {
+	target, symbol, session, descSource, cc, codec := inv.target, inv.symbol, inv.session, inv.source, inv.cc, inv.codec
+	replay := session != nil
+	if len(requestData) == 0 && !replay && inv.csvFieldMapping == nil {
+		example, err := findExample(*examplesDir, symbol, inv.inFormat)
+		if err != nil {
+			fail(err, "Failed to find example request")
+		}
+		if example != "" {
+			if inv.verbosityLevel > 0 {
+				fmt.Fprintf(os.Stderr, "Using example request from %s\n", example)
+			}
+			requestData = multiString{"@" + example}
+		}
+	}
+	in, err := openRequestData(requestData, inv.inFormat)
+	if err != nil {
+		fail(err, "Failed to read request data")
+	}
+	if *dTemplate {
+		if in, err = expandRequestTemplate(in); err != nil {
+			fail(err, "Failed to process request data template")
+		}
+	}
+	if inv.csvFieldMapping != nil {
+		mtd, err := findMethod(descSource, symbol)
+		if err != nil {
+			fail(err, "Failed to resolve method %q", symbol)
+		}
+		in = csvRequests(in, mtd.GetInputType(), inv.csvFieldMapping)
+	}
+	defer in.Close()
+
+	// if not verbose output, then also include record delimiters
+	// between each message, so output could potentially be piped
+	// to another grpcurl process
+	includeSeparators := inv.verbosityLevel == 0 && *outputDir == ""
+	options := grpcurl.FormatOptions{
+		EmitJSONDefaultFields: *emitDefaults,
+		IncludeTextSeparator:  includeSeparators,
+		AllowUnknownFields:    *allowUnknownFields,
+		UseProtoNames:         *useProtoNames,
+		CompactJSON:           inv.compactJSON,
+		FailOnUnknownAny:      *anyResolve == "error",
+	}
+	anySource := inv.anySource
+	rf, formatter, err := grpcurl.RequestParserAndFormatter(inv.inFormat, anySource, in, options)
+	if err != nil {
+		fail(err, "Failed to construct request parser and formatter for %q", *format)
+	}
+	if inv.outFormat == "protoscope" {
+		formatter = newProtoscopeFormatter(*keepUnknown)
+	} else if inv.outFormat != inv.inFormat {
+		_, formatter, err = grpcurl.RequestParserAndFormatter(inv.outFormat, anySource, nil, options)
+		if err != nil {
+			fail(err, "Failed to construct formatter for %q", inv.outFormat)
+		}
+	}
+	h := &grpcurl.DefaultEventHandler{
+		Out:            os.Stdout,
+		Formatter:      formatter,
+		VerbosityLevel: inv.verbosityLevel,
+	}
+	if inv.filter != nil {
+		h.Formatter = inv.filter.wrap(formatter)
+	} else if inv.outTemplate != nil {
+		h.Formatter = templateFormatter(inv.outTemplate, formatter)
+	}
+	if debugEnabled[debugFormat] {
+		h.Formatter = debugFormatter(h.Formatter)
+	}
+	var handler grpcurl.InvocationEventHandler = h
+	if *includeMetadata {
+		// the envelope handler prints everything; h is still used to
+		// track the number of responses and the status
+		envelope := &grpcurl.EnvelopeEventHandler{Out: os.Stdout, Formatter: h.Formatter, Compact: inv.compactJSON}
+		h.Out = io.Discard
+		handler = teeEventHandler{h, envelope}
+	}
+	var filesHandler *responseFilesHandler
+	if *outputDir != "" {
+		if err := os.MkdirAll(*outputDir, 0777); err != nil {
+			fail(err, "Failed to create output directory %s", *outputDir)
+		}
+		filesHandler = &responseFilesHandler{DefaultEventHandler: h, dir: *outputDir, pattern: inv.filesPattern}
+		if *outputRawAbove > 0 && target != "" {
+			filesHandler.raw = &rawResponses{dir: *outputDir, pattern: inv.filesPattern, threshold: *outputRawAbove}
+			codec = filesHandler.raw.codec(codec)
+		}
+		handler = filesHandler
+	}
+	dump := inv.dump
+	if dump != nil && target != "" {
+		if dump.dir != "" {
+			if err := os.MkdirAll(dump.dir, 0777); err != nil {
+				fail(err, "Failed to create directory %s for -dump-raw", dump.dir)
+			}
+		}
+		dump.out = os.Stdout
+		codec = dump.codec(codec)
+		handler = rawDumpHandler{InvocationEventHandler: handler, dump: dump}
+	}
+	headers := inv.headers
+	if !replay && *parallel > 1 && target != "" {
+		mtd, err := findMethod(descSource, symbol)
+		if err != nil {
+			fail(err, "Failed to resolve method %q", symbol)
+		}
+		if mtd.IsClientStreaming() || mtd.IsServerStreaming() {
+			fail(nil, "The -parallel argument can only be used to invoke a unary method.")
+		}
+		ch := invokeChannel(cc, codec)
+		result, err := runFanOut(ctx, os.Stdout, os.Stderr, descSource, ch, mtd, headers, rf, h.Formatter, *parallel)
+		result.print(os.Stderr, mtd, *parallel)
+		if err != nil {
+			fail(err, "Failed to read request data")
+		}
+		if result.errors > 0 {
+			fmt.Fprintf(os.Stderr, "ERROR: %d of %d calls could not be made\n", result.errors, result.total())
+			exit(1)
+		}
+		for _, code := range result.statusCodes() {
+			if exitCode, ok := inv.exitPolicy.exitCode(code); ok {
+				exit(exitCode)
+			}
+		}
+		return
+	}
+	if session != nil {
+		rf = session.requestParser(descSource)
+		headers = append(session.headers(), headers...)
+	}
+	if debugEnabled[debugFormat] {
+		rf = debugRequestParser{rf}
+	}
+	if debugEnabled[debugRetry] {
+		handler = debugRetryHandler{handler}
+	}
+	if len(inv.extraOutputs) > 0 {
+		for _, o := range inv.extraOutputs {
+			if err := o.open(anySource, options); err != nil {
+				fail(err, "Failed to create output file %s", o.fileName)
+			}
+		}
+		handler = extraOutputHandler{InvocationEventHandler: handler, outputs: inv.extraOutputs}
+	}
+	expectations := inv.expectations
+	if expectations != nil {
+		expectations.formatter = formatter
+		expectations.jsonFormatter = formatter
+		if inv.outFormat != "json" {
+			_, expectations.jsonFormatter, err = grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, anySource, nil, options)
+			if err != nil {
+				fail(err, "Failed to construct formatter for -expect-jq")
+			}
+		}
+		handler = expectationHandler{InvocationEventHandler: handler, expect: expectations}
+	}
+	var recorder *sessionRecorder
+	if *recordFile != "" {
+		recorder = newSessionRecorder(target, symbol, descSource)
+		rf = recorder.wrapParser(rf)
+		handler = recorder.wrapHandler(handler)
+	}
+	events := inv.events
+	if events != nil {
+		rf = events.wrapParser(rf)
+		handler = events.wrapHandler(handler)
+	}
+	var stats *callStats
+	if inv.statsOut != nil {
+		stats = &callStats{}
+		rf = stats.wrapParser(rf)
+		handler = stats.wrapHandler(handler)
+	}
+
+	timing := inv.timing
+	if timing != nil {
+		rf = timing.wrapParser(rf)
+		handler = timing.wrapHandler(handler)
+	}
+
+	call := callInfo{target: target, method: symbol}
+	if *preCallExec != "" {
+		if err := runCallHook(*preCallExec, call); err != nil {
+			fail(err, "Pre-call command failed")
+		}
+	}
+
+	invokeTiming := inv.rootTiming.Child("InvokeRPC")
+	invokeStart := time.Now()
+	if timing != nil {
+		timing.startCall(target, symbol)
+	}
+	if target == "" {
+		// no address, so just play back the session's responses
+		err = session.play(ctx, descSource, handler, replaySpeed())
+	} else {
+		ch := invokeChannel(cc, codec)
+		callCtx := ctx
+		var interrupts *streamInterrupter
+		if mtd, err := findMethod(descSource, symbol); err == nil && mtd.IsClientStreaming() {
+			// an interrupt closes the request stream, instead of
+			// killing the process mid-stream
+			callCtx, interrupts = handleStreamInterrupts(ctx, os.Stderr, interruptGracePeriod)
+			rf = interrupts.wrapParser(rf)
+		}
+		var limit *maxResponsesHandler
+		if *maxResponses > 0 {
+			callCtx, limit = limitResponses(callCtx, handler, *maxResponses)
+			handler = limit
+		}
+		err = grpcurl.InvokeRPC(callCtx, descSource, ch, symbol, headers, handler, rf.Next)
+		if limit != nil {
+			limit.done()
+		}
+		if interrupts != nil {
+			interrupts.stop()
+		}
+	}
+	latency := time.Since(invokeStart)
+	invokeTiming.Done()
+	if inv.tracer != nil || timing != nil {
+		stat := h.Status
+		if err != nil {
+			stat = status.Convert(err)
+		}
+		inv.tracer.finish(stat)
+		if timing != nil {
+			timing.endCall(rf.NumRequests(), h.NumResponses, latency, stat)
+		}
+	}
+	if events != nil {
+		events.done(latency, err)
+		if err := events.close(); err != nil {
+			warn("Failed to write events to %s: %v", *eventsOut, err)
+		}
+	}
+	for _, o := range inv.extraOutputs {
+		if err := o.close(); err != nil {
+			warn("Failed to write responses to %s: %v", o.fileName, err)
+		}
+	}
+	if filesHandler != nil && filesHandler.err != nil {
+		fail(filesHandler.err, "Failed to write responses to %s", *outputDir)
+	}
+	if dump != nil && dump.err != nil {
+		fail(dump.err, "Failed to write responses to %s", dump.dir)
+	}
+	if *postCallExec != "" {
+		call.done = true
+		call.stat = h.Status
+		if err != nil {
+			call.stat = status.Convert(err)
+		}
+		call.duration = latency
+		call.requests = rf.NumRequests()
+		call.responses = h.NumResponses
+		if err := runCallHook(*postCallExec, call); err != nil {
+			warn("Post-call command failed: %v", err)
+		}
+	}
+	if recorder != nil {
+		if err := recorder.finish(*recordFile, err); err != nil {
+			warn("Failed to write record of RPC to %s: %v", *recordFile, err)
+		}
+	}
+	if stats != nil {
+		stat := h.Status
+		if err != nil {
+			stat = status.Convert(err)
+		}
+		line := newStatsLine(stats, rf.NumRequests(), h.NumResponses, latency, stat)
+		if err := line.write(inv.statsOut, *statsLineFormat); err != nil {
+			warn("Failed to write -stats-line to file descriptor %d: %v", *statsFD, err)
+		}
+	}
+	if err != nil {
+		if errStatus, ok := status.FromError(err); ok && (*formatError || *failWithBody) {
+			h.Status = errStatus
+		} else {
+			fail(err, "Error invoking method %q", symbol)
+		}
+	}
+	reqSuffix := ""
+	respSuffix := ""
+	reqCount := rf.NumRequests()
+	if reqCount != 1 {
+		reqSuffix = "s"
+	}
+	if h.NumResponses != 1 {
+		respSuffix = "s"
+	}
+	if inv.verbosityLevel > 0 {
+		fmt.Printf("Sent %d request%s and received %d response%s\n", reqCount, reqSuffix, h.NumResponses, respSuffix)
+	}
+	if session != nil {
+		if code, ok := session.statusCode(); ok && code != h.Status.Code() {
+			warn("Status %s differs from recorded status %s.", h.Status.Code(), code)
+		}
+	}
+	var failures []string
+	if expectations != nil {
+		failures = expectations.check(h.Status)
+	}
+	if h.Status.Code() != codes.OK {
+		if *failWithBody && !*includeMetadata {
+			printFormattedStatus(os.Stdout, h.Status, formatter)
+			fmt.Println()
+		} else if *formatError {
+			printFormattedStatus(os.Stderr, h.Status, formatter)
+		} else {
+			grpcurl.PrintStatusWithDetailTables(os.Stderr, h.Status, formatter)
+		}
+		// an expected status is not a failure, and an unexpected one is
+		// reported below as an unmet expectation
+		if expectations == nil || expectations.status == nil {
+			if code, ok := inv.exitPolicy.exitCode(h.Status.Code()); ok {
+				exit(code)
+			}
+		}
+	}
+	if len(failures) > 0 {
+		for _, f := range failures {
+			fmt.Fprintf(os.Stderr, "ERROR: Expectation failed: %s\n", f)
+		}
+		exit(expectationFailedExitCode)
+	}
+	if *maxLatency > 0 && latency > floatSecondsToDuration(*maxLatency) {
+		fmt.Fprintf(os.Stderr, "ERROR: RPC took %v, which exceeds -max-latency of %v\n", latency, floatSecondsToDuration(*maxLatency))
+		exit(latencyExceededExitCode)
+	}
+}
+
+// invokeChannel returns the channel on which a method is invoked: the given
+// connection, which uses the given codec, if any, or which passes messages
+// through the -transform-cmd command.
+func invokeChannel(cc *grpc.ClientConn, codec encoding.Codec) grpcdynamic.Channel {
+	if *transformCmd != "" {
+		return transformChannel{Channel: cc, cmdLine: *transformCmd, base: codec}
+	}
+	return codecChannel(cc, codec)
+}
+
+// printFormattedStatus prints the given status using the given formatter, for
+// -format-error and -fail.
+func printFormattedStatus(w io.Writer, stat *status.Status, formatter grpcurl.Formatter) {
+	formattedStatus, err := formatter(stat.Proto())
+	if err != nil {
+		fmt.Fprintf(w, "ERROR: %v", err.Error())
+	}
+	fmt.Fprint(w, formattedStatus)
+}
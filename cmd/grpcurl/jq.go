@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/itchyny/gojq"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// jqFilter is a compiled jq expression, given via -jq.
+type jqFilter struct {
+	code *gojq.Code
+	// compact, if true, causes results to be printed as compact JSON on a
+	// single line instead of being indented.
+	compact bool
+}
+
+func newJQFilter(expr string) (*jqFilter, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return &jqFilter{code: code}, nil
+}
+
+// wrap returns a formatter that applies the filter to the JSON produced by
+// the given formatter. Each value the filter yields is formatted as JSON, on
+// its own line.
+func (f *jqFilter) wrap(formatter grpcurl.Formatter) grpcurl.Formatter {
+	return func(msg proto.Message) (string, error) {
+		str, err := formatter(msg)
+		if err != nil {
+			return "", err
+		}
+		var input interface{}
+		dec := json.NewDecoder(strings.NewReader(str))
+		dec.UseNumber()
+		if err := dec.Decode(&input); err != nil {
+			return "", err
+		}
+		input = normalizeJSONNumbers(input)
+
+		var results []string
+		iter := f.code.Run(input)
+		for {
+			v, ok := iter.Next()
+			if !ok {
+				break
+			}
+			if err, ok := v.(error); ok {
+				return "", fmt.Errorf("jq: %v", err)
+			}
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			if !f.compact {
+				enc.SetIndent("", "  ")
+			}
+			if err := enc.Encode(v); err != nil {
+				return "", err
+			}
+			results = append(results, strings.TrimSuffix(buf.String(), "\n"))
+		}
+		return strings.Join(results, "\n"), nil
+	}
+}
+
+// normalizeJSONNumbers converts json.Number values, which gojq does not
+// accept, into integers where possible and floats otherwise. Decoding with
+// json.Number first means large integers do not lose precision.
+func normalizeJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeJSONNumbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestJQFilter(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"name":  "abc",
+		"count": 3,
+		"items": []interface{}{"x", "y"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatter := grpcurl.NewJSONFormatter(false, nil)
+
+	testCases := []struct {
+		expr, expected string
+	}{
+		{".name", `"abc"`},
+		{".count + 1", `4`},
+		{".items[]", "\"x\"\n\"y\""},
+		{"{n: .name}", "{\n  \"n\": \"abc\"\n}"},
+		{"select(.count > 5)", ""},
+	}
+	for _, tc := range testCases {
+		filter, err := newJQFilter(tc.expr)
+		if err != nil {
+			t.Errorf("%s: failed to compile: %v", tc.expr, err)
+			continue
+		}
+		actual, err := filter.wrap(formatter)(msg)
+		if err != nil {
+			t.Errorf("%s: failed to format: %v", tc.expr, err)
+		} else if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.expr, tc.expected, actual)
+		}
+	}
+
+	filter, err := newJQFilter("{n: .name}, .items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter.compact = true
+	actual, err := filter.wrap(formatter)(msg)
+	if err != nil {
+		t.Errorf("failed to format: %v", err)
+	} else if expected := "{\"n\":\"abc\"}\n[\"x\",\"y\"]"; actual != expected {
+		t.Errorf("compact: expected %q, got %q", expected, actual)
+	}
+
+	if _, err := newJQFilter(".["); err == nil {
+		t.Error("expected error for invalid expression")
+	}
+}
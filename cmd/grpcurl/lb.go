@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/stats"
+)
+
+// validateLBPolicy checks that the load balancing policy given via
+// -lb-policy is registered.
+func validateLBPolicy(policy string) error {
+	if balancer.Get(policy) == nil {
+		return fmt.Errorf("unknown load balancing policy %q; try pick_first or round_robin", policy)
+	}
+	return nil
+}
+
+// defaultServiceConfig returns a service config, in JSON, that selects the
+// given load balancing policy, for -lb-policy, and applies the given retry
+// policy to all methods, for -max-retries. Either may be empty. If both are,
+// this returns an empty string.
+func defaultServiceConfig(lbPolicy string, retry map[string]interface{}) (string, error) {
+	config := map[string]interface{}{}
+	if lbPolicy != "" {
+		config["loadBalancingConfig"] = []map[string]interface{}{{lbPolicy: map[string]interface{}{}}}
+	}
+	if retry != nil {
+		config["methodConfig"] = []map[string]interface{}{{
+			// a name with no service matches all methods
+			"name":        []map[string]interface{}{{}},
+			"retryPolicy": retry,
+		}}
+	}
+	if len(config) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// isMultiAddressTarget returns true if the given target is a comma-separated
+// list of addresses, like 'host1:443,host2:443'.
+func isMultiAddressTarget(target string) bool {
+	return strings.Contains(target, ",") && !strings.Contains(target, "://")
+}
+
+// withAltAddresses returns the given target with the given addresses, from
+// -alt-address, appended to it, as a comma-separated list. All must be in
+// "host:port" form.
+func withAltAddresses(target string, alts []string) (string, error) {
+	addrs := append([]string{target}, alts...)
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil || strings.ContainsAny(addr, ",/") {
+			return "", fmt.Errorf("%q is not in 'host:port' form", addr)
+		}
+	}
+	return strings.Join(addrs, ","), nil
+}
+
+// backendLogger is a stats handler that reports the address of the backend
+// to which each RPC, other than those of the reflection service, is sent. It
+// is used in verbose mode with -lb-policy or a multi-address target, to show
+// how calls are balanced.
+type backendLogger struct {
+	out io.Writer
+}
+
+func (l *backendLogger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (l *backendLogger) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.OutHeader); ok && h.Client && h.RemoteAddr != nil && !strings.HasPrefix(h.FullMethod, "/grpc.reflection.") {
+		fmt.Fprintf(l.out, "\nSending request to backend %s\n", h.RemoteAddr)
+	}
+}
+
+func (l *backendLogger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (l *backendLogger) HandleConn(context.Context, stats.ConnStats) {}
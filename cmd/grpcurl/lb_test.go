@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestDefaultServiceConfig(t *testing.T) {
+	if err := validateLBPolicy("round_robin"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateLBPolicy("no_such_policy"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+
+	config, err := defaultServiceConfig("round_robin", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"loadBalancingConfig":[{"round_robin":{}}]}`
+	if config != expected {
+		t.Errorf("expected %s, got %s", expected, config)
+	}
+
+	config, err = defaultServiceConfig("", retryPolicy(2, map[codes.Code]bool{codes.Unavailable: true, codes.Aborted: true}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `{"methodConfig":[{"name":[{}],"retryPolicy":{"backoffMultiplier":2,"initialBackoff":"0.1s","maxAttempts":3,"maxBackoff":"1s","retryableStatusCodes":[10,14]}}]}`
+	if config != expected {
+		t.Errorf("expected %s, got %s", expected, config)
+	}
+
+	if config, err := defaultServiceConfig("", nil); err != nil || config != "" {
+		t.Errorf("expected no config, got %q, %v", config, err)
+	}
+}
+
+func TestIsMultiAddressTarget(t *testing.T) {
+	testCases := map[string]bool{
+		"localhost:8080":                false,
+		"host1:443,host2:443":           true,
+		"dns:///host1:443":              false,
+		"xds:///my-service,with-commas": false,
+	}
+	for target, expected := range testCases {
+		if actual := isMultiAddressTarget(target); actual != expected {
+			t.Errorf("%q: expected %v, got %v", target, expected, actual)
+		}
+	}
+}
+
+func TestWithAltAddresses(t *testing.T) {
+	target, err := withAltAddresses("host1:443", []string{"host2:443", "[::1]:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "host1:443,host2:443,[::1]:8443"; target != expected {
+		t.Errorf("expected %q, got %q", expected, target)
+	}
+	for _, tc := range [][]string{
+		{"https://example.com", "host2:443"},
+		{"host1:443", "host2"},
+		{"host1:443,host2:443", "host3:443"},
+	} {
+		if _, err := withAltAddresses(tc[0], tc[1:]); err == nil {
+			t.Errorf("%q: expected error", tc)
+		}
+	}
+}
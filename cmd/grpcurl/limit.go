@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// maxResponsesHandler cancels a call once it has received the number of
+// responses given via -max-responses, which is useful for sampling a stream
+// that never ends. The resulting CANCELLED status is reported as OK, since
+// the call ended as requested.
+type maxResponsesHandler struct {
+	grpcurl.InvocationEventHandler
+	max    int
+	cancel context.CancelFunc
+	count  int
+}
+
+// limitResponses returns a context for a call and a handler that cancels it
+// after max responses, which are passed to the given handler.
+func limitResponses(ctx context.Context, h grpcurl.InvocationEventHandler, max int) (context.Context, *maxResponsesHandler) {
+	ctx, cancel := context.WithCancel(ctx)
+	return ctx, &maxResponsesHandler{InvocationEventHandler: h, max: max, cancel: cancel}
+}
+
+func (h *maxResponsesHandler) OnReceiveResponse(m proto.Message) {
+	if h.count >= h.max {
+		// received before the cancellation took effect
+		return
+	}
+	h.count++
+	h.InvocationEventHandler.OnReceiveResponse(m)
+	if h.count == h.max {
+		h.cancel()
+	}
+}
+
+func (h *maxResponsesHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	if h.count >= h.max && stat.Code() == codes.Canceled {
+		stat = status.New(codes.OK, "")
+	}
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
+
+// done releases the resources of the call's context.
+func (h *maxResponsesHandler) done() {
+	h.cancel()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestMaxResponsesHandler(t *testing.T) {
+	for _, tc := range []struct {
+		responses int
+		code      codes.Code
+		expected  codes.Code
+	}{
+		// cancelled after the limit, which is success
+		{responses: 3, code: codes.Canceled, expected: codes.OK},
+		// the stream ended before the limit
+		{responses: 1, code: codes.OK, expected: codes.OK},
+		// cancelled for some other reason before the limit
+		{responses: 1, code: codes.Canceled, expected: codes.Canceled},
+		// failed after the limit
+		{responses: 2, code: codes.Internal, expected: codes.Internal},
+	} {
+		h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: grpcurl.NewJSONFormatter(false, nil)}
+		ctx, limit := limitResponses(context.Background(), h, 2)
+		for i := 0; i < tc.responses; i++ {
+			limit.OnReceiveResponse(wrapperspb.String("abc"))
+		}
+		limit.OnReceiveTrailers(status.New(tc.code, ""), nil)
+		if expected := min(tc.responses, 2); h.NumResponses != expected {
+			t.Errorf("%d responses: expected %d handled, got %d", tc.responses, expected, h.NumResponses)
+		}
+		if cancelled := ctx.Err() != nil; cancelled != (tc.responses >= 2) {
+			t.Errorf("%d responses: expected cancelled to be %v", tc.responses, !cancelled)
+		}
+		if h.Status.Code() != tc.expected {
+			t.Errorf("%d responses with %v: expected status %v, got %v", tc.responses, tc.code, tc.expected, h.Status.Code())
+		}
+		limit.done()
+	}
+}
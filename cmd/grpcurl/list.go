@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// methodKind describes how many messages a method sends and receives: one
+// each for 'unary', or a stream of requests, responses, or both.
+func methodKind(md *desc.MethodDescriptor) string {
+	switch {
+	case md.IsClientStreaming() && md.IsServerStreaming():
+		return "bidi-stream"
+	case md.IsClientStreaming():
+		return "client-stream"
+	case md.IsServerStreaming():
+		return "server-stream"
+	default:
+		return "unary"
+	}
+}
+
+// printServiceMethods writes the name of each of the given services to w,
+// followed by its methods, indented, along with the kind of each method. This
+// is the output of 'list -a'.
+func printServiceMethods(w io.Writer, source grpcurl.DescriptorSource, svcs []string) error {
+	for _, svc := range svcs {
+		dsc, err := source.FindSymbol(svc)
+		if err != nil {
+			return err
+		}
+		sd, ok := dsc.(*desc.ServiceDescriptor)
+		if !ok {
+			return fmt.Errorf("%s is not a service", svc)
+		}
+		fmt.Fprintln(w, sd.GetFullyQualifiedName())
+		methods := append([]*desc.MethodDescriptor(nil), sd.GetMethods()...)
+		if len(methods) == 0 {
+			fmt.Fprintln(w, "  (No methods)")
+			continue
+		}
+		sort.Slice(methods, func(i, j int) bool {
+			return methods[i].GetName() < methods[j].GetName()
+		})
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, md := range methods {
+			fmt.Fprintf(tw, "  %s\t%s\n", md.GetName(), methodKind(md))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runList prints the services in the given source, or the methods of the
+// given service, for the 'list' verb. With 'list -a', it prints the methods
+// of all services, or of the given one, along with their request and
+// response types.
+func runList(descSource grpcurl.DescriptorSource, symbol string, listAll bool) {
+	if listAll {
+		svcs := []string{symbol}
+		if symbol == "" {
+			var err error
+			svcs, err = grpcurl.ListServices(descSource)
+			if err != nil {
+				fail(err, "Failed to list services")
+			}
+		}
+		if len(svcs) == 0 {
+			fmt.Println("(No services)")
+		} else if err := printServiceMethods(os.Stdout, descSource, svcs); err != nil {
+			fail(err, "Failed to list methods")
+		}
+		if err := writeProtoset(descSource, svcs...); err != nil {
+			fail(err, "Failed to write protoset to %s", *protosetOut)
+		}
+		if err := writeProtos(descSource, svcs...); err != nil {
+			fail(err, "Failed to write protos to %s", *protoOut)
+		}
+	} else if symbol == "" {
+		svcs, err := grpcurl.ListServices(descSource)
+		if err != nil {
+			fail(err, "Failed to list services")
+		}
+		if len(svcs) == 0 {
+			fmt.Println("(No services)")
+		} else {
+			for _, svc := range svcs {
+				fmt.Printf("%s\n", svc)
+			}
+		}
+		if err := writeProtoset(descSource, svcs...); err != nil {
+			fail(err, "Failed to write protoset to %s", *protosetOut)
+		}
+		if err := writeProtos(descSource, svcs...); err != nil {
+			fail(err, "Failed to write protos to %s", *protoOut)
+		}
+	} else {
+		methods, err := grpcurl.ListMethods(descSource, symbol)
+		if err != nil {
+			fail(err, "Failed to list methods for service %q", symbol)
+		}
+		if len(methods) == 0 {
+			fmt.Println("(No methods)") // probably unlikely
+		} else {
+			for _, m := range methods {
+				fmt.Printf("%s\n", m)
+			}
+		}
+		if err := writeProtoset(descSource, symbol); err != nil {
+			fail(err, "Failed to write protoset to %s", *protosetOut)
+		}
+		if err := writeProtos(descSource, symbol); err != nil {
+			fail(err, "Failed to write protos to %s", *protoOut)
+		}
+	}
+}
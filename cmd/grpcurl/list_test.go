@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestPrintServiceMethods(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := printServiceMethods(&buf, source, []string{"testing.TestService"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `testing.TestService
+  EmptyCall            unary
+  FullDuplexCall       bidi-stream
+  HalfDuplexCall       bidi-stream
+  StreamingInputCall   client-stream
+  StreamingOutputCall  server-stream
+  UnaryCall            unary
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	if err := printServiceMethods(&buf, source, []string{"testing.SimpleRequest"}); err == nil {
+		t.Error("expected error for a symbol that is not a service")
+	}
+}
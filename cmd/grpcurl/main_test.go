@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// runMainEnv is set in the environment of a test binary that is run by
+// runGrpcurl, so that it runs grpcurl instead of the tests.
+const runMainEnv = "GRPCURL_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runGrpcurl runs grpcurl with the given arguments, in a new process, and
+// returns what it wrote to stdout and stderr and its exit code. This lets
+// tests check the behavior of whole invocations, including exit codes.
+func runGrpcurl(t *testing.T, args ...string) (stdout, stderr string, exitCode int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("failed to run grpcurl: %v", err)
+	}
+	return outBuf.String(), errBuf.String(), exitCode
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"     //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	serverreflection "google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// mockStubFile is the structure of the YAML file given via -stubs.
+type mockStubFile struct {
+	Stubs []*mockStub `yaml:"stubs"`
+}
+
+// mockStub describes a canned response for a method. Stubs are consulted in
+// the order they appear in the file and the first one whose method and match
+// criteria apply to a request is used.
+type mockStub struct {
+	// Method is the fully-qualified name of the method, in either
+	// 'service/method' or 'service.method' form.
+	Method string `yaml:"method"`
+	// Match, if present, must be a subset of the JSON form of the request
+	// message for this stub to apply.
+	Match interface{} `yaml:"match"`
+	// Headers and Trailers are sent as response metadata.
+	Headers  map[string]string `yaml:"headers"`
+	Trailers map[string]string `yaml:"trailers"`
+	// Response is a single response message. Responses can be used instead,
+	// to send multiple messages for server-streaming and bidi methods.
+	Response  interface{}   `yaml:"response"`
+	Responses []interface{} `yaml:"responses"`
+	// Status, if present, is the status with which the RPC completes, after
+	// any responses are sent.
+	Status *mockStatus `yaml:"status"`
+	// Delay, if present, is how long to wait before responding, in a form
+	// accepted by time.ParseDuration.
+	Delay string `yaml:"delay"`
+
+	delay     time.Duration
+	headers   metadata.MD
+	trailers  metadata.MD
+	responses []proto.Message
+	status    *status.Status
+	// delays, for stubs created from recorded sessions, is how long to wait
+	// before sending each response in order to reproduce the original timing
+	// (only used with -preserve-timing).
+	delays []time.Duration
+}
+
+type mockStatus struct {
+	// Code is the name of the status code, like "NOT_FOUND", or its number.
+	Code    interface{} `yaml:"code"`
+	Message string      `yaml:"message"`
+}
+
+// loadMockStubs reads and validates the stubs in the given file. The returned
+// map is keyed by the full method name, in "/service/method" form.
+func loadMockStubs(fileName string, descSource grpcurl.DescriptorSource) (map[string][]*mockStub, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var f mockStubFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)}
+	stubs := map[string][]*mockStub{}
+	for i, stub := range f.Stubs {
+		mtd, err := findMethod(descSource, stub.Method)
+		if err != nil {
+			return nil, fmt.Errorf("stub #%d: %v", i+1, err)
+		}
+		if stub.Response != nil && len(stub.Responses) > 0 {
+			return nil, fmt.Errorf("stub #%d: only one of 'response' and 'responses' may be present", i+1)
+		}
+		values := stub.Responses
+		if stub.Response != nil {
+			values = []interface{}{stub.Response}
+		}
+		if len(values) > 1 && !mtd.IsServerStreaming() {
+			return nil, fmt.Errorf("stub #%d: method %s is not server-streaming, so it cannot have multiple responses", i+1, mtd.GetFullyQualifiedName())
+		}
+		for j, v := range values {
+			js, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("stub #%d: response #%d: %v", i+1, j+1, err)
+			}
+			msg := dynamic.NewMessage(mtd.GetOutputType())
+			if err := unmarshaler.Unmarshal(bytes.NewReader(js), msg); err != nil {
+				return nil, fmt.Errorf("stub #%d: response #%d is not a valid %s: %v", i+1, j+1, mtd.GetOutputType().GetFullyQualifiedName(), err)
+			}
+			stub.responses = append(stub.responses, msg)
+		}
+		if stub.Status != nil {
+			code, err := parseStatusCode(stub.Status.Code)
+			if err != nil {
+				return nil, fmt.Errorf("stub #%d: %v", i+1, err)
+			}
+			stub.status = status.New(code, stub.Status.Message)
+		}
+		if stub.Delay != "" {
+			if stub.delay, err = time.ParseDuration(stub.Delay); err != nil {
+				return nil, fmt.Errorf("stub #%d: invalid delay: %v", i+1, err)
+			}
+		}
+		stub.headers = metadata.New(stub.Headers)
+		stub.trailers = metadata.New(stub.Trailers)
+		name := fullMethodName(mtd)
+		stubs[name] = append(stubs[name], stub)
+	}
+	return stubs, nil
+}
+
+// stubFromSession creates a stub that responds like the recorded session.
+// Unless the method is client-streaming, the stub only matches requests like
+// the recorded one.
+func stubFromSession(s *recordedSession, descSource grpcurl.DescriptorSource, speed float64) (*mockStub, error) {
+	mtd, err := findMethod(descSource, s.Method)
+	if err != nil {
+		return nil, err
+	}
+	if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
+		return nil, fmt.Errorf("method %s is bidi-streaming, which is not supported", mtd.GetFullyQualifiedName())
+	}
+	stub := &mockStub{
+		Method:   fullMethodName(mtd),
+		headers:  sessionMetadata(s.ResponseHeaders),
+		trailers: sessionMetadata(s.ResponseTrailers),
+	}
+	if !mtd.IsClientStreaming() && len(s.Requests) > 0 {
+		if err := json.Unmarshal(s.Requests[0].Message, &stub.Match); err != nil {
+			return nil, fmt.Errorf("could not parse request: %v", err)
+		}
+	}
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)}
+	for i, resp := range s.Responses {
+		msg := dynamic.NewMessage(mtd.GetOutputType())
+		if err := unmarshaler.Unmarshal(bytes.NewReader(resp.Message), msg); err != nil {
+			return nil, fmt.Errorf("could not parse response #%d: %v", i+1, err)
+		}
+		stub.responses = append(stub.responses, msg)
+	}
+	if stub.status, err = s.status(descSource); err != nil {
+		return nil, err
+	}
+	if stub.status == nil && s.Error != "" {
+		stub.status = status.New(codes.Unknown, s.Error)
+	}
+	if speed > 0 {
+		if stub.delays, err = s.responseDelays(speed); err != nil {
+			return nil, err
+		}
+	}
+	return stub, nil
+}
+
+// parseStatusCode accepts either a numeric code or a name like "NOT_FOUND".
+func parseStatusCode(v interface{}) (codes.Code, error) {
+	switch v := v.(type) {
+	case nil:
+		return codes.OK, nil
+	case int:
+		return codes.Code(v), nil
+	case string:
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(v) + `"`)); err != nil {
+			return 0, err
+		}
+		return code, nil
+	default:
+		return 0, fmt.Errorf("invalid status code: %v", v)
+	}
+}
+
+func findMethod(descSource grpcurl.DescriptorSource, methodName string) (*desc.MethodDescriptor, error) {
+	methodName = strings.TrimPrefix(methodName, "/")
+	pos := strings.LastIndex(methodName, "/")
+	if pos < 0 {
+		pos = strings.LastIndex(methodName, ".")
+	}
+	if pos < 0 {
+		return nil, fmt.Errorf("method name %q is not in expected format: 'service/method' or 'service.method'", methodName)
+	}
+	svc, mth := methodName[:pos], methodName[pos+1:]
+	dsc, err := descSource.FindSymbol(svc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find service %q: %v", svc, err)
+	}
+	sd, ok := dsc.(*desc.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a service", svc)
+	}
+	mtd := sd.FindMethodByName(mth)
+	if mtd == nil {
+		return nil, fmt.Errorf("service %q does not include a method named %q", svc, mth)
+	}
+	return mtd, nil
+}
+
+func fullMethodName(mtd *desc.MethodDescriptor) string {
+	return "/" + mtd.GetService().GetFullyQualifiedName() + "/" + mtd.GetName()
+}
+
+// jsonSubset returns true if the given pattern, which is the result of
+// unmarshaling YAML or JSON, is a subset of the given value. Scalars are
+// compared using their string form, so that numbers match regardless of
+// whether they were decoded as integers or floats.
+func jsonSubset(pattern, value interface{}) bool {
+	switch pattern := pattern.(type) {
+	case map[string]interface{}:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, p := range pattern {
+			v, ok := m[k]
+			if !ok || !jsonSubset(p, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		s, ok := value.([]interface{})
+		if !ok || len(s) != len(pattern) {
+			return false
+		}
+		for i := range pattern {
+			if !jsonSubset(pattern[i], s[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return fmt.Sprint(pattern) == fmt.Sprint(value)
+	}
+}
+
+type mockServer struct {
+	descSource grpcurl.DescriptorSource
+	formatter  grpcurl.Formatter
+	marshaler  jsonpb.Marshaler
+	out        io.Writer
+
+	mu      sync.Mutex // serializes writes to out
+	methods map[string]*desc.MethodDescriptor
+	stubs   map[string][]*mockStub
+
+	// files and types are used by the reflection service
+	files *protoregistry.Files
+	types *protoregistry.Types
+}
+
+func newMockServer(descSource grpcurl.DescriptorSource, stubs map[string][]*mockStub, formatter grpcurl.Formatter, out io.Writer) (*mockServer, error) {
+	svcs, err := descSource.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	methods := map[string]*desc.MethodDescriptor{}
+	for _, svc := range svcs {
+		dsc, err := descSource.FindSymbol(svc)
+		if err != nil {
+			return nil, err
+		}
+		sd, ok := dsc.(*desc.ServiceDescriptor)
+		if !ok {
+			continue
+		}
+		for _, mtd := range sd.GetMethods() {
+			methods[fullMethodName(mtd)] = mtd
+		}
+	}
+	fds, err := grpcurl.GetAllFiles(descSource)
+	if err != nil {
+		return nil, err
+	}
+	files := &protoregistry.Files{}
+	types := &protoregistry.Types{}
+	for _, fd := range fds {
+		fd := fd.UnwrapFile()
+		if err := files.RegisterFile(fd); err != nil {
+			return nil, err
+		}
+		if err := registerExtensions(types, fd.Extensions(), fd.Messages()); err != nil {
+			return nil, err
+		}
+	}
+	return &mockServer{
+		descSource: descSource,
+		formatter:  formatter,
+		marshaler:  jsonpb.Marshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)},
+		out:        out,
+		methods:    methods,
+		stubs:      stubs,
+		files:      files,
+		types:      types,
+	}, nil
+}
+
+// handleStream is a grpc.StreamHandler that implements all methods.
+func (s *mockServer) handleStream(_ interface{}, stream grpc.ServerStream) error {
+	name, _ := grpc.MethodFromServerStream(stream)
+	mtd := s.methods[name]
+	if mtd == nil {
+		return status.Errorf(codes.Unimplemented, "method %s is not implemented by this mock server", name)
+	}
+
+	var req proto.Message
+	for {
+		msg := dynamic.NewMessage(mtd.GetInputType())
+		err := stream.RecvMsg(msg)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		req = msg
+		s.logRequest(name, req)
+		if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
+			// bidi streams get a response for each request
+			if err := s.respond(stream, mtd, req); err != nil {
+				return err
+			}
+		} else if !mtd.IsClientStreaming() {
+			break
+		}
+	}
+	if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
+		return nil
+	}
+	if req == nil {
+		req = dynamic.NewMessage(mtd.GetInputType())
+	}
+	return s.respond(stream, mtd, req)
+}
+
+func (s *mockServer) logRequest(method string, req proto.Message) {
+	if s.out == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	str, err := s.formatter(req)
+	if err != nil {
+		fmt.Fprintf(s.out, "%s: failed to format request: %v\n", method, err)
+		return
+	}
+	fmt.Fprintf(s.out, "%s:\n%s\n", method, str)
+}
+
+// respond sends the response for the given request, using the first stub
+// that matches it or else a template message.
+func (s *mockServer) respond(stream grpc.ServerStream, mtd *desc.MethodDescriptor, req proto.Message) error {
+	stub, err := s.findStub(mtd, req)
+	if err != nil {
+		return err
+	}
+	if stub == nil {
+		// no stub, so generate a response from a template
+		return stream.SendMsg(grpcurl.MakeTemplate(mtd.GetOutputType()))
+	}
+	if stub.delay > 0 {
+		select {
+		case <-time.After(stub.delay):
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+	if len(stub.headers) > 0 {
+		// this fails if headers were already sent, in which case there is
+		// nothing else to do
+		_ = stream.SetHeader(stub.headers)
+	}
+	if len(stub.trailers) > 0 {
+		stream.SetTrailer(stub.trailers)
+	}
+	for i, resp := range stub.responses {
+		if i < len(stub.delays) {
+			select {
+			case <-time.After(stub.delays[i]):
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			}
+		}
+		if err := stream.SendMsg(resp); err != nil {
+			return err
+		}
+	}
+	// a nil or OK status results in a nil error
+	return stub.status.Err()
+}
+
+func (s *mockServer) findStub(mtd *desc.MethodDescriptor, req proto.Message) (*mockStub, error) {
+	stubs := s.stubs[fullMethodName(mtd)]
+	if len(stubs) == 0 {
+		return nil, nil
+	}
+	var reqJSON interface{}
+	js, err := s.marshaler.MarshalToString(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to convert request to JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(js), &reqJSON); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to convert request to JSON: %v", err)
+	}
+	for _, stub := range stubs {
+		if stub.Match == nil || jsonSubset(stub.Match, reqJSON) {
+			return stub, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetServiceInfo implements serverreflection.ServiceInfoProvider, so that the
+// mocked services can be listed via server reflection.
+func (s *mockServer) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := map[string]grpc.ServiceInfo{}
+	for _, mtd := range s.methods {
+		info[mtd.GetService().GetFullyQualifiedName()] = grpc.ServiceInfo{}
+	}
+	return info
+}
+
+// mockHolder serves requests using the current mock server, which is
+// replaced when descriptors are reloaded via -watch.
+type mockHolder struct {
+	atomic.Pointer[mockServer]
+}
+
+func (h *mockHolder) handleStream(srv interface{}, stream grpc.ServerStream) error {
+	return h.Load().handleStream(srv, stream)
+}
+
+// GetServiceInfo implements serverreflection.ServiceInfoProvider.
+func (h *mockHolder) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return h.Load().GetServiceInfo()
+}
+
+// FindFileByPath implements protodesc.Resolver, for the reflection service.
+func (h *mockHolder) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	return h.Load().files.FindFileByPath(path)
+}
+
+// FindDescriptorByName implements protodesc.Resolver, for the reflection
+// service.
+func (h *mockHolder) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return h.Load().files.FindDescriptorByName(name)
+}
+
+// FindExtensionByName implements serverreflection.ExtensionResolver.
+func (h *mockHolder) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return h.Load().types.FindExtensionByName(field)
+}
+
+// FindExtensionByNumber implements serverreflection.ExtensionResolver.
+func (h *mockHolder) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return h.Load().types.FindExtensionByNumber(message, field)
+}
+
+// RangeExtensionsByMessage implements serverreflection.ExtensionResolver.
+func (h *mockHolder) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionType) bool) {
+	h.Load().types.RangeExtensionsByMessage(message, f)
+}
+
+// registerMockReflection registers the reflection service on the given
+// server, using the descriptors of the mocked services.
+func registerMockReflection(svr *grpc.Server, mock *mockHolder) {
+	opts := serverreflection.ServerOptions{
+		Services:           mock,
+		DescriptorResolver: mock,
+		ExtensionResolver:  mock,
+	}
+	reflectionv1.RegisterServerReflectionServer(svr, serverreflection.NewServerV1(opts))
+	reflectionv1alpha.RegisterServerReflectionServer(svr, serverreflection.NewServer(opts))
+}
+
+func registerExtensions(types *protoregistry.Types, exts protoreflect.ExtensionDescriptors, msgs protoreflect.MessageDescriptors) error {
+	for i := 0; i < exts.Len(); i++ {
+		if err := types.RegisterExtension(dynamicpb.NewExtensionType(exts.Get(i))); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		if err := registerExtensions(types, md.Extensions(), md.Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMock(args []string) {
+	if len(args) > 0 {
+		fail(nil, "Too many arguments.")
+	}
+	var sessions []*recordedSession
+	for _, fileName := range mockSessions {
+		s, err := readSession(fileName)
+		if err != nil {
+			fail(err, "Failed to read session from %s", fileName)
+		}
+		sessions = append(sessions, s)
+	}
+	descSource := loadFileSource()
+	if descSource == nil {
+		var err error
+		descSource, err = sessionsDescriptorSource(sessions)
+		if err != nil {
+			fail(err, "Failed to process descriptors in sessions")
+		}
+	}
+	if descSource == nil {
+		fail(nil, "The 'mock' verb requires -protoset or -proto flags.")
+	}
+	if !isRegisteredFormat(*format) {
+		fail(nil, "The -format option must be one of the registered formats: %s.", registeredFormatList())
+	}
+
+	var out io.Writer
+	if *verbose || *veryVerbose {
+		out = os.Stdout
+	}
+	mock, err := loadMock(descSource, sessions, out)
+	if err != nil {
+		fail(err, "Failed to create mock server")
+	}
+	var holder mockHolder
+	holder.Store(mock)
+	if *watch {
+		if len(protoset) == 0 && len(protoFiles) == 0 {
+			fail(nil, "The -watch argument requires -protoset or -proto flags.")
+		}
+		w, err := newDescriptorWatcher(descSource, os.Stderr, func(source grpcurl.DescriptorSource) error {
+			mock, err := loadMock(source, sessions, out)
+			if err != nil {
+				return err
+			}
+			holder.Store(mock)
+			return nil
+		})
+		if err != nil {
+			fail(err, "Failed to watch descriptor files")
+		}
+		go w.run()
+	}
+
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(holder.handleStream))
+	registerMockReflection(svr, &holder)
+
+	addr := *listenAddr
+	if addr == "" {
+		addr = "localhost:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fail(err, "Failed to listen on %s", addr)
+	}
+	fmt.Fprintf(os.Stderr, "Mock server listening on %s\n", l.Addr())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		svr.GracefulStop()
+	}()
+	if err := svr.Serve(l); err != nil {
+		fail(err, "Mock server failed")
+	}
+}
+
+// loadMock creates a mock server for the services in the given source, with
+// the stubs given via -stubs and those from the given sessions.
+func loadMock(descSource grpcurl.DescriptorSource, sessions []*recordedSession, out io.Writer) (*mockServer, error) {
+	stubs := map[string][]*mockStub{}
+	if *stubsFile != "" {
+		var err error
+		stubs, err = loadMockStubs(*stubsFile, descSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stubs from %s: %v", *stubsFile, err)
+		}
+	}
+	// stubs from sessions are consulted after those in the stubs file
+	for i, s := range sessions {
+		stub, err := stubFromSession(s, descSource, replaySpeed())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stub from session %s: %v", mockSessions[i], err)
+		}
+		stubs[stub.Method] = append(stubs[stub.Method], stub)
+	}
+	_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.Format(*format), descSource, nil, grpcurl.FormatOptions{
+		EmitJSONDefaultFields: *emitDefaults,
+		UseProtoNames:         *useProtoNames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct formatter for %q: %v", *format, err)
+	}
+	mock, err := newMockServer(descSource, stubs, formatter, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve services: %v", err)
+	}
+	return mock, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestJSONSubset(t *testing.T) {
+	testCases := []struct {
+		pattern, value string
+		expected       bool
+	}{
+		{`{}`, `{"a": 1}`, true},
+		{`{"a": 1}`, `{"a": 1, "b": 2}`, true},
+		{`{"a": 1}`, `{"a": 2}`, false},
+		{`{"c": 1}`, `{"a": 1}`, false},
+		{`{"a": {"b": "x"}}`, `{"a": {"b": "x", "c": "y"}}`, true},
+		{`{"a": ["x", "y"]}`, `{"a": ["x", "y"]}`, true},
+		{`{"a": ["x"]}`, `{"a": ["x", "y"]}`, false},
+		{`{"a": {"b": 1}}`, `{"a": 1}`, false},
+	}
+	for _, tc := range testCases {
+		var pattern, value interface{}
+		if err := json.Unmarshal([]byte(tc.pattern), &pattern); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tc.value), &value); err != nil {
+			t.Fatal(err)
+		}
+		if actual := jsonSubset(pattern, value); actual != tc.expected {
+			t.Errorf("jsonSubset(%s, %s): expected %v, got %v", tc.pattern, tc.value, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseStatusCode(t *testing.T) {
+	testCases := []struct {
+		input    interface{}
+		expected codes.Code
+	}{
+		{nil, codes.OK},
+		{5, codes.NotFound},
+		{"NOT_FOUND", codes.NotFound},
+		{"permission_denied", codes.PermissionDenied},
+	}
+	for _, tc := range testCases {
+		code, err := parseStatusCode(tc.input)
+		if err != nil {
+			t.Errorf("parseStatusCode(%v): unexpected error: %v", tc.input, err)
+		} else if code != tc.expected {
+			t.Errorf("parseStatusCode(%v): expected %v, got %v", tc.input, tc.expected, code)
+		}
+	}
+	if _, err := parseStatusCode("NOT_A_CODE"); err == nil {
+		t.Error("expected error for invalid status code name")
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const openAPIVersion = "3.0.3"
+
+// The name of the schema used to describe error responses.
+const openAPIStatusSchema = "google.rpc.Status"
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Tags       []openAPITag                            `json:"tags,omitempty"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	// These indicate streaming methods, which have no faithful
+	// representation in OpenAPI.
+	ClientStreaming bool `json:"x-grpc-client-streaming,omitempty"`
+	ServerStreaming bool `json:"x-grpc-server-streaming,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+}
+
+// Schemas for well-known types whose JSON representation is not an object
+// with one property per field.
+var wellKnownSchemas = map[string]func() *openAPISchema{
+	"google.protobuf.Any": func() *openAPISchema {
+		return &openAPISchema{
+			Type:                 "object",
+			Properties:           map[string]*openAPISchema{"@type": {Type: "string"}},
+			AdditionalProperties: &openAPISchema{},
+		}
+	},
+	"google.protobuf.Timestamp":   func() *openAPISchema { return &openAPISchema{Type: "string", Format: "date-time"} },
+	"google.protobuf.Duration":    func() *openAPISchema { return &openAPISchema{Type: "string"} },
+	"google.protobuf.FieldMask":   func() *openAPISchema { return &openAPISchema{Type: "string"} },
+	"google.protobuf.Empty":       func() *openAPISchema { return &openAPISchema{Type: "object"} },
+	"google.protobuf.Struct":      func() *openAPISchema { return &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}} },
+	"google.protobuf.Value":       func() *openAPISchema { return &openAPISchema{} },
+	"google.protobuf.ListValue":   func() *openAPISchema { return &openAPISchema{Type: "array", Items: &openAPISchema{}} },
+	"google.protobuf.BoolValue":   func() *openAPISchema { return &openAPISchema{Type: "boolean"} },
+	"google.protobuf.StringValue": func() *openAPISchema { return &openAPISchema{Type: "string"} },
+	"google.protobuf.BytesValue":  func() *openAPISchema { return &openAPISchema{Type: "string", Format: "byte"} },
+	"google.protobuf.Int32Value":  func() *openAPISchema { return &openAPISchema{Type: "integer", Format: "int32"} },
+	"google.protobuf.UInt32Value": func() *openAPISchema { return &openAPISchema{Type: "integer", Format: "int64"} },
+	"google.protobuf.Int64Value":  func() *openAPISchema { return &openAPISchema{Type: "string", Format: "int64"} },
+	"google.protobuf.UInt64Value": func() *openAPISchema { return &openAPISchema{Type: "string", Format: "uint64"} },
+	"google.protobuf.FloatValue":  func() *openAPISchema { return &openAPISchema{Type: "number", Format: "float"} },
+	"google.protobuf.DoubleValue": func() *openAPISchema { return &openAPISchema{Type: "number", Format: "double"} },
+}
+
+// openAPIGenerator converts service descriptors into an OpenAPI document.
+// Messages and enums are described in the document's components and are
+// referenced by their fully-qualified names.
+type openAPIGenerator struct {
+	useProtoNames bool
+	doc           openAPIDocument
+}
+
+// runExportOpenAPI writes an OpenAPI document that describes the given
+// service, or all services in the given source, to stdout, for the
+// 'export-openapi' verb.
+func runExportOpenAPI(descSource grpcurl.DescriptorSource, symbol string) {
+	var svcs []string
+	if symbol != "" {
+		svcs = []string{symbol}
+	} else {
+		var err error
+		svcs, err = listAPIServices(descSource)
+		if err != nil {
+			fail(err, "Failed to list services")
+		}
+	}
+	if err := writeOpenAPI(os.Stdout, descSource, svcs, *useProtoNames); err != nil {
+		fail(err, "Failed to export OpenAPI document")
+	}
+}
+
+// writeOpenAPI writes an OpenAPI document, in JSON format, that describes the
+// given services. Methods that have google.api.http annotations are described
+// using those HTTP bindings. Other methods are described as a POST to the
+// method's gRPC path, with the request message as the body.
+func writeOpenAPI(w io.Writer, descSource grpcurl.DescriptorSource, serviceNames []string, useProtoNames bool) error {
+	g := &openAPIGenerator{
+		useProtoNames: useProtoNames,
+		doc: openAPIDocument{
+			OpenAPI: openAPIVersion,
+			Info:    openAPIInfo{Title: "gRPC services", Version: "unspecified"},
+			Paths:   map[string]map[string]*openAPIOperation{},
+			Components: openAPIComponents{
+				Schemas: map[string]*openAPISchema{
+					openAPIStatusSchema: {
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"code":    {Type: "integer", Format: "int32"},
+							"message": {Type: "string"},
+							"details": {Type: "array", Items: wellKnownSchemas["google.protobuf.Any"]()},
+						},
+					},
+				},
+			},
+		},
+	}
+	if len(serviceNames) == 1 {
+		g.doc.Info.Title = serviceNames[0]
+	}
+	for _, name := range serviceNames {
+		dsc, err := descSource.FindSymbol(name)
+		if err != nil {
+			return fmt.Errorf("failed to resolve service %q: %v", name, err)
+		}
+		sd, ok := dsc.(*desc.ServiceDescriptor)
+		if !ok {
+			return fmt.Errorf("%q is not a service", name)
+		}
+		if err := g.addService(sd); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(&g.doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func (g *openAPIGenerator) addService(sd *desc.ServiceDescriptor) error {
+	svcName := sd.GetFullyQualifiedName()
+	g.doc.Tags = append(g.doc.Tags, openAPITag{Name: svcName, Description: comments(sd)})
+	for _, mtd := range sd.GetMethods() {
+		rules := httpRules(mtd)
+		if len(rules) == 0 {
+			op := g.newOperation(mtd, "")
+			op.RequestBody = g.requestBody(g.messageSchema(mtd.GetInputType()))
+			op.Responses["200"] = g.response(g.messageSchema(mtd.GetOutputType()))
+			g.addOperation("/"+svcName+"/"+mtd.GetName(), "post", op)
+			continue
+		}
+		for i, rule := range rules {
+			suffix := ""
+			if i > 0 {
+				suffix = fmt.Sprintf("_%d", i)
+			}
+			if err := g.addBinding(mtd, rule, suffix); err != nil {
+				return fmt.Errorf("method %s: %v", mtd.GetFullyQualifiedName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *openAPIGenerator) newOperation(mtd *desc.MethodDescriptor, suffix string) *openAPIOperation {
+	svcName := mtd.GetService().GetFullyQualifiedName()
+	return &openAPIOperation{
+		OperationID:     strings.ReplaceAll(svcName, ".", "_") + "_" + mtd.GetName() + suffix,
+		Description:     comments(mtd),
+		Tags:            []string{svcName},
+		Responses:       map[string]*openAPIResponse{"default": g.errorResponse()},
+		ClientStreaming: mtd.IsClientStreaming(),
+		ServerStreaming: mtd.IsServerStreaming(),
+	}
+}
+
+func (g *openAPIGenerator) addOperation(path, method string, op *openAPIOperation) {
+	ops := g.doc.Paths[path]
+	if ops == nil {
+		ops = map[string]*openAPIOperation{}
+		g.doc.Paths[path] = ops
+	}
+	ops[method] = op
+}
+
+// addBinding describes a method via the given HTTP rule, per the semantics
+// described in google/api/http.proto.
+func (g *openAPIGenerator) addBinding(mtd *desc.MethodDescriptor, rule *annotations.HttpRule, suffix string) error {
+	var method, template string
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		method, template = "get", pattern.Get
+	case *annotations.HttpRule_Put:
+		method, template = "put", pattern.Put
+	case *annotations.HttpRule_Post:
+		method, template = "post", pattern.Post
+	case *annotations.HttpRule_Delete:
+		method, template = "delete", pattern.Delete
+	case *annotations.HttpRule_Patch:
+		method, template = "patch", pattern.Patch
+	case *annotations.HttpRule_Custom:
+		method, template = strings.ToLower(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+		switch method {
+		case "head", "options", "trace":
+		default:
+			return fmt.Errorf("unsupported HTTP method %q", pattern.Custom.GetKind())
+		}
+	default:
+		return fmt.Errorf("HTTP rule has no pattern")
+	}
+
+	path, pathVars := convertPathTemplate(template)
+	op := g.newOperation(mtd, suffix)
+	inputType := mtd.GetInputType()
+	// top-level fields that are bound to the path or body
+	boundFields := map[string]bool{}
+	for _, v := range pathVars {
+		fld, err := findFieldPath(inputType, v)
+		if err != nil {
+			return err
+		}
+		boundFields[strings.SplitN(v, ".", 2)[0]] = true
+		op.Parameters = append(op.Parameters, &openAPIParameter{
+			Name:     v,
+			In:       "path",
+			Required: true,
+			Schema:   g.fieldSchema(fld),
+		})
+	}
+
+	switch body := rule.GetBody(); body {
+	case "":
+	case "*":
+		op.RequestBody = g.requestBody(g.messageSchema(inputType))
+	default:
+		fld := inputType.FindFieldByName(body)
+		if fld == nil {
+			return fmt.Errorf("body field %q not found in %s", body, inputType.GetFullyQualifiedName())
+		}
+		boundFields[body] = true
+		op.RequestBody = g.requestBody(g.fieldSchema(fld))
+	}
+	if rule.GetBody() != "*" {
+		// remaining fields with simple values can be supplied as query parameters
+		for _, fld := range inputType.GetFields() {
+			if boundFields[fld.GetName()] || !hasSimpleJSONValue(fld) {
+				continue
+			}
+			op.Parameters = append(op.Parameters, &openAPIParameter{
+				Name:   g.fieldName(fld),
+				In:     "query",
+				Schema: g.fieldSchema(fld),
+			})
+		}
+	}
+
+	if respBody := rule.GetResponseBody(); respBody != "" {
+		fld := mtd.GetOutputType().FindFieldByName(respBody)
+		if fld == nil {
+			return fmt.Errorf("response body field %q not found in %s", respBody, mtd.GetOutputType().GetFullyQualifiedName())
+		}
+		op.Responses["200"] = g.response(g.fieldSchema(fld))
+	} else {
+		op.Responses["200"] = g.response(g.messageSchema(mtd.GetOutputType()))
+	}
+	g.addOperation(path, method, op)
+	return nil
+}
+
+func (g *openAPIGenerator) requestBody(schema *openAPISchema) *openAPIRequestBody {
+	return &openAPIRequestBody{
+		Required: true,
+		Content:  map[string]openAPIMediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func (g *openAPIGenerator) response(schema *openAPISchema) *openAPIResponse {
+	return &openAPIResponse{
+		Description: "A successful response.",
+		Content:     map[string]openAPIMediaType{"application/json": {Schema: schema}},
+	}
+}
+
+func (g *openAPIGenerator) errorResponse() *openAPIResponse {
+	return &openAPIResponse{
+		Description: "An error response.",
+		Content:     map[string]openAPIMediaType{"application/json": {Schema: schemaRef(openAPIStatusSchema)}},
+	}
+}
+
+func (g *openAPIGenerator) fieldName(fld *desc.FieldDescriptor) string {
+	if g.useProtoNames {
+		return fld.GetName()
+	}
+	return fld.GetJSONName()
+}
+
+func (g *openAPIGenerator) fieldSchema(fld *desc.FieldDescriptor) *openAPISchema {
+	var schema *openAPISchema
+	if fld.IsMap() {
+		schema = &openAPISchema{
+			Type:                 "object",
+			AdditionalProperties: g.fieldSchema(fld.GetMapValueType()),
+		}
+	} else {
+		switch fld.GetType() {
+		case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+			schema = g.messageSchema(fld.GetMessageType())
+		case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+			schema = g.enumSchema(fld.GetEnumType())
+		default:
+			schema = scalarSchema(fld.GetType())
+		}
+		if fld.IsRepeated() {
+			schema = &openAPISchema{Type: "array", Items: schema}
+		}
+	}
+	if c := comments(fld); c != "" {
+		if schema.Ref != "" {
+			// siblings of $ref are ignored in OpenAPI 3.0
+			return schema
+		}
+		schema.Description = c
+	}
+	return schema
+}
+
+func (g *openAPIGenerator) messageSchema(md *desc.MessageDescriptor) *openAPISchema {
+	name := md.GetFullyQualifiedName()
+	if wk, ok := wellKnownSchemas[name]; ok {
+		return wk()
+	}
+	if _, ok := g.doc.Components.Schemas[name]; !ok {
+		schema := &openAPISchema{
+			Type:        "object",
+			Description: comments(md),
+			Properties:  map[string]*openAPISchema{},
+		}
+		// register before visiting fields, in case the message is recursive
+		g.doc.Components.Schemas[name] = schema
+		for _, fld := range md.GetFields() {
+			schema.Properties[g.fieldName(fld)] = g.fieldSchema(fld)
+		}
+	}
+	return schemaRef(name)
+}
+
+func (g *openAPIGenerator) enumSchema(ed *desc.EnumDescriptor) *openAPISchema {
+	name := ed.GetFullyQualifiedName()
+	if name == "google.protobuf.NullValue" {
+		// represented as a JSON null
+		return &openAPISchema{}
+	}
+	if _, ok := g.doc.Components.Schemas[name]; !ok {
+		schema := &openAPISchema{Type: "string", Description: comments(ed)}
+		for _, v := range ed.GetValues() {
+			schema.Enum = append(schema.Enum, v.GetName())
+		}
+		g.doc.Components.Schemas[name] = schema
+	}
+	return schemaRef(name)
+}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+// scalarSchema returns the schema for the JSON representation of a scalar
+// field. As in the JSON mapping for protobuf, 64-bit integers are strings.
+func scalarSchema(t descriptorpb.FieldDescriptorProto_Type) *openAPISchema {
+	switch t {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return &openAPISchema{Type: "string", Format: "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		return &openAPISchema{Type: "string", Format: "uint64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return &openAPISchema{Type: "number", Format: "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return &openAPISchema{Type: "number", Format: "double"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return &openAPISchema{Type: "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return &openAPISchema{Type: "string", Format: "byte"}
+	default:
+		return &openAPISchema{Type: "string"}
+	}
+}
+
+// hasSimpleJSONValue returns true if the given field's value can be given as
+// a query parameter, which is the case for non-map fields whose JSON value is
+// not an object.
+func hasSimpleJSONValue(fld *desc.FieldDescriptor) bool {
+	if fld.IsMap() {
+		return false
+	}
+	if md := fld.GetMessageType(); md != nil {
+		switch md.GetFullyQualifiedName() {
+		case "google.protobuf.Any", "google.protobuf.Empty", "google.protobuf.Struct",
+			"google.protobuf.Value", "google.protobuf.ListValue":
+			return false
+		}
+		_, ok := wellKnownSchemas[md.GetFullyQualifiedName()]
+		return ok
+	}
+	return true
+}
+
+// convertPathTemplate converts a path template from an HTTP rule into an
+// OpenAPI path, returning the path and the names of its variables. Variables
+// with patterns, like "{name=shelves/*}", become just "{name}".
+func convertPathTemplate(template string) (string, []string) {
+	var path strings.Builder
+	var vars []string
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		v := template[start+1 : end]
+		if eq := strings.IndexByte(v, '='); eq >= 0 {
+			v = v[:eq]
+		}
+		vars = append(vars, v)
+		path.WriteString(template[:start])
+		path.WriteString("{" + v + "}")
+		template = template[end+1:]
+	}
+	path.WriteString(template)
+	return path.String(), vars
+}
+
+// findFieldPath resolves a dot-separated path of field names, starting from
+// the given message.
+func findFieldPath(md *desc.MessageDescriptor, fieldPath string) (*desc.FieldDescriptor, error) {
+	var fld *desc.FieldDescriptor
+	for _, name := range strings.Split(fieldPath, ".") {
+		if md == nil {
+			return nil, fmt.Errorf("field path %q refers to a field of a non-message", fieldPath)
+		}
+		fld = md.FindFieldByName(name)
+		if fld == nil {
+			return nil, fmt.Errorf("field %q not found in %s", name, md.GetFullyQualifiedName())
+		}
+		md = fld.GetMessageType()
+	}
+	return fld, nil
+}
+
+// httpRules returns the HTTP bindings for the given method, from its
+// google.api.http option, if present.
+func httpRules(mtd *desc.MethodDescriptor) []*annotations.HttpRule {
+	opts := mtd.GetMethodOptions()
+	if opts == nil {
+		return nil
+	}
+	if !proto.HasExtension(opts, annotations.E_Http) {
+		// The options may have been parsed before the extension was known, in
+		// which case it is stored as an unrecognized field. So parse them again.
+		b, err := proto.Marshal(opts)
+		if err != nil {
+			return nil
+		}
+		var reparsed descriptorpb.MethodOptions
+		if err := (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(b, &reparsed); err != nil {
+			return nil
+		}
+		if !proto.HasExtension(&reparsed, annotations.E_Http) {
+			return nil
+		}
+		opts = &reparsed
+	}
+	rule, _ := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	if rule == nil {
+		return nil
+	}
+	return append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+}
+
+func comments(d desc.Descriptor) string {
+	return strings.TrimSpace(d.GetSourceInfo().GetLeadingComments())
+}
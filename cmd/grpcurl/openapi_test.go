@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const testHTTPProto = `
+syntax = "proto3";
+package google.api;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MethodOptions {
+  HttpRule http = 72295728;
+}
+message HttpRule {
+  string selector = 1;
+  oneof pattern {
+    string get = 2;
+    string put = 3;
+    string post = 4;
+    string delete = 5;
+    string patch = 6;
+    CustomHttpPattern custom = 8;
+  }
+  string body = 7;
+  string response_body = 12;
+  repeated HttpRule additional_bindings = 11;
+}
+message CustomHttpPattern {
+  string kind = 1;
+  string path = 2;
+}
+`
+
+const testLibraryProto = `
+syntax = "proto3";
+package library;
+import "google/api/http.proto";
+import "google/protobuf/timestamp.proto";
+
+// Manages books.
+service Library {
+  rpc GetBook(GetBookRequest) returns (Book) {
+    option (google.api.http) = {
+      get: "/v1/{name=shelves/*/books/*}"
+      additional_bindings { get: "/v1/books/{name}" }
+    };
+  }
+  rpc CreateBook(CreateBookRequest) returns (Book) {
+    option (google.api.http) = { post: "/v1/{parent=shelves/*}/books" body: "book" };
+  }
+  rpc Ping(Book) returns (Book);
+}
+message GetBookRequest {
+  string name = 1;
+  bool include_reviews = 2;
+  Book filter = 3;
+}
+message CreateBookRequest {
+  string parent = 1;
+  Book book = 2;
+}
+message Book {
+  string name = 1;
+  int64 page_count = 2;
+  google.protobuf.Timestamp published_at = 3;
+  repeated Book related = 4;
+  Genre genre = 5;
+}
+enum Genre {
+  UNKNOWN = 0;
+  FICTION = 1;
+}
+`
+
+func TestWriteOpenAPI(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"google/api/http.proto": testHTTPProto,
+			"library.proto":         testLibraryProto,
+		}),
+	}
+	fds, err := p.ParseFiles("library.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	descSource, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOpenAPI(&buf, descSource, []string{"library.Library"}, false); err != nil {
+		t.Fatalf("failed to write OpenAPI document: %v", err)
+	}
+	var doc openAPIDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to parse OpenAPI document: %v", err)
+	}
+
+	var paths []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			paths = append(paths, method+" "+path)
+		}
+	}
+	expectedPaths := map[string]bool{
+		"get /v1/{name}":             true,
+		"get /v1/books/{name}":       true,
+		"post /v1/{parent}/books":    true,
+		"post /library.Library/Ping": true,
+	}
+	if len(paths) != len(expectedPaths) {
+		t.Errorf("wrong paths: %v", paths)
+	}
+	for _, p := range paths {
+		if !expectedPaths[p] {
+			t.Errorf("unexpected path %q", p)
+		}
+	}
+
+	getBook := doc.Paths["/v1/{name}"]["get"]
+	var params []string
+	for _, param := range getBook.Parameters {
+		params = append(params, param.In+":"+param.Name)
+	}
+	// the filter field is a message, so it cannot be a query parameter
+	if expected := []string{"path:name", "query:includeReviews"}; !reflect.DeepEqual(params, expected) {
+		t.Errorf("wrong parameters for GetBook: expected %v, got %v", expected, params)
+	}
+	if getBook.RequestBody != nil {
+		t.Error("GetBook should not have a request body")
+	}
+	createBook := doc.Paths["/v1/{parent}/books"]["post"]
+	if createBook.RequestBody == nil || createBook.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/library.Book" {
+		t.Errorf("wrong request body for CreateBook: %+v", createBook.RequestBody)
+	}
+
+	book := doc.Components.Schemas["library.Book"]
+	if book == nil {
+		t.Fatal("missing schema for library.Book")
+	}
+	expectedProps := map[string]openAPISchema{
+		"pageCount":   {Type: "string", Format: "int64"},
+		"publishedAt": {Type: "string", Format: "date-time"},
+		"genre":       {Ref: "#/components/schemas/library.Genre"},
+	}
+	for name, expected := range expectedProps {
+		if actual := book.Properties[name]; actual == nil || !reflect.DeepEqual(*actual, expected) {
+			t.Errorf("wrong schema for property %q: expected %+v, got %+v", name, expected, actual)
+		}
+	}
+	if related := book.Properties["related"]; related == nil || related.Type != "array" || related.Items.Ref != "#/components/schemas/library.Book" {
+		t.Errorf("wrong schema for recursive property: %+v", related)
+	}
+	if genre := doc.Components.Schemas["library.Genre"]; genre == nil || !reflect.DeepEqual(genre.Enum, []string{"UNKNOWN", "FICTION"}) {
+		t.Errorf("wrong schema for enum: %+v", genre)
+	}
+}
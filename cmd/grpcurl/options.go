@@ -0,0 +1,1416 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// options describe what grpcurl was asked to do, as determined from the
+// positional arguments and the flags, along with what is set up to do it.
+// They are built by parseOptions, which exits with an error if the arguments
+// are invalid.
+type options struct {
+	// verb is the verb given after the address, if any, such as 'list', or
+	// 'invoke' if a method name is given instead. It is empty if neither is
+	// given, for -handshake-only, -xds-status, and -batch.
+	verb string
+	// listAll is set by 'list -a'
+	listAll bool
+	// symbol is the symbol given after the verb, or the method to invoke
+	symbol string
+	// commandArgs are the positional arguments, for -print-command
+	commandArgs []string
+	// completion is set for the hidden verb used for tab completion
+	completion *completionRequest
+
+	target     string
+	parsedAddr *grpcurl.Target
+	sshTun     *sshTunnel
+	// local is the transport for a server on the same machine, if any
+	local *localTransport
+
+	session        *recordedSession
+	suite          *testSuite
+	batch          bool
+	batchEntries   []batchEntry
+	batchVariables map[string]string
+
+	ctx            context.Context
+	verbosityLevel int
+	rootTiming     *timingData
+	timing         *timingReport
+	events         *eventLog
+	tracer         *otelTracer
+	statsOut       io.Writer
+
+	codec      encoding.Codec
+	exitPolicy statusExitPolicy
+	// inFormat is the format of the request data given to the parser, since
+	// CSV rows are converted into JSON messages, and outFormat that of the
+	// responses
+	inFormat, outFormat string
+	compactJSON         bool
+	csvFieldMapping     map[string]string
+	filesPattern        string
+	filter              *jqFilter
+	outTemplate         *template.Template
+	expectations        *responseExpectations
+	extraOutputs        []*extraOutput
+	dump                *rawDump
+
+	d *dialer
+	// cc is the connection to the server, once dialed, and refCC that used
+	// for reflection, which is the same connection unless
+	// -separate-reflection-connection is used
+	cc, refCC  *grpc.ClientConn
+	refClient  *grpcreflect.Client
+	descSource grpcurl.DescriptorSource
+
+	// cleanups are run in reverse order by close
+	cleanups []func()
+}
+
+// parseEnv sets the flags that are not on the command line from the
+// environment. This must be done after all flags are parsed, including those
+// given after a stand-alone verb.
+func parseEnv() {
+	if err := setFlagsFromEnv(flags); err != nil {
+		fail(nil, "%v", err)
+	}
+	// compressors must be registered before dialing or serving, so that
+	// compressed messages can be decoded
+	if err := registerCompressors(*acceptEncoding); err != nil {
+		fail(nil, "The -accept-encoding argument is invalid: %v", err)
+	}
+	if *xdsBootstrap != "" {
+		runWithXDSBootstrap(*xdsBootstrap)
+	}
+}
+
+// verbFirstArgs parses the flags given after a verb that may come before the
+// address, and returns the positional arguments in the usual order, with the
+// address first.
+func verbFirstArgs(verb string, args []string) []string {
+	flags.Parse(args)
+	parseEnv()
+	switch verb {
+	case "proxy":
+		// The address may be given via -target when the verb comes first.
+		if flags.NArg() > 0 {
+			fail(nil, "Too many arguments.")
+		}
+		if *proxyTarget == "" {
+			fail(nil, "No host:port specified; use the -target flag.")
+		}
+		return []string{*proxyTarget, verb}
+	case "test":
+		// The address may be given via -target or in the suite when the verb
+		// comes first.
+		if flags.NArg() == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		if flags.NArg() > 1 {
+			fail(nil, "Too many arguments.")
+		}
+		address := *proxyTarget
+		if address == "" {
+			suite, err := readTestSuite(flags.Arg(0))
+			if err != nil {
+				fail(err, "Failed to read test suite")
+			}
+			address = suite.Address
+		}
+		if address == "" {
+			fail(nil, "No host:port specified; use the -target flag or set 'address' in the test suite.")
+		}
+		return []string{address, verb, flags.Arg(0)}
+	default:
+		if flags.NArg() == 0 {
+			fail(nil, "No host:port specified.")
+		}
+		if flags.NArg() > 1 {
+			fail(nil, "Too many arguments.")
+		}
+		return []string{flags.Arg(0), verb}
+	}
+}
+
+// parseOptions checks the given positional arguments and the flags, and sets
+// up what is needed to act on them, except for the connection and the source
+// of descriptors, which are set up by connect.
+func parseOptions(args []string, completion *completionRequest) *options {
+	o := &options{commandArgs: args, completion: completion, d: &dialer{}}
+	o.parseArgs(args)
+	o.checkVerbFlags()
+	o.checkSourceFlags()
+	o.setUpTiming()
+	o.loadProfile()
+	o.setUpContext()
+	o.checkTransportFlags()
+	o.checkOutputFlags()
+	o.setUpTelemetry()
+	o.setUpDialer()
+	o.readHeaders()
+	return o
+}
+
+// invokesMethod reports whether a method is invoked, or a session replayed.
+func (o *options) invokesMethod() bool {
+	return o.verb == "invoke" || o.verb == "replay"
+}
+
+// close runs the cleanups, in reverse order.
+func (o *options) close() {
+	for i := len(o.cleanups) - 1; i >= 0; i-- {
+		o.cleanups[i]()
+	}
+}
+
+// parseArgs determines the address, verb, and symbol from the positional
+// arguments.
+func (o *options) parseArgs(args []string) {
+	if args[0] != "list" && args[0] != "describe" && args[0] != "replay" && args[0] != "proxy" && args[0] != "export-openapi" && args[0] != "diff" && args[0] != "validate" && args[0] != completeSymbolsVerb {
+		o.parseTarget(args[0])
+		args = args[1:]
+	}
+
+	if o.target == "" && len(altAddresses) > 0 {
+		warn("The -alt-address argument is only used with an address.")
+	}
+
+	if len(args) == 0 && !*handshakeOnly && !*xdsStatus && *batchFile == "" {
+		fail(nil, "Too few arguments.")
+	}
+	o.batch = *batchFile != ""
+	if len(args) > 0 {
+		switch args[0] {
+		case "list", "describe", "replay", "proxy", "export-openapi", "diff", "support-bundle", "cert", "validate", "test", "shell", completeSymbolsVerb:
+			o.verb = args[0]
+			args = args[1:]
+			if o.verb == "list" && len(args) > 0 && args[0] == "-a" {
+				o.listAll = true
+				args = args[1:]
+			}
+		default:
+			o.verb = "invoke"
+		}
+	}
+
+	switch o.verb {
+	case "":
+		// only a handshake is performed, the xDS status is printed, or the
+		// calls in a -batch manifest are made
+	case "invoke":
+		if len(args) == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		o.symbol = args[0]
+		args = args[1:]
+	case "replay":
+		if len(args) == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		var err error
+		o.session, err = readSession(args[0])
+		if err != nil {
+			fail(err, "Failed to read session from %s", args[0])
+		}
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with 'replay' verb.")
+		}
+		o.symbol = o.session.Method
+		args = args[1:]
+	case "proxy", "support-bundle", "cert":
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with '%s' verb.", o.verb)
+		}
+	case "diff":
+		if len(args) == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with 'diff' verb.")
+		}
+		o.symbol = args[0]
+		args = args[1:]
+	case "validate":
+		if len(args) == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		o.symbol = args[0]
+		args = args[1:]
+	case "test":
+		if len(args) == 0 {
+			fail(nil, "Too few arguments.")
+		}
+		var err error
+		o.suite, err = readTestSuite(args[0])
+		if err != nil {
+			fail(err, "Failed to read test suite")
+		}
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with 'test' verb.")
+		}
+		args = args[1:]
+	case "shell":
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with 'shell' verb.")
+			// nor is it in the equivalent commands of calls
+			requestData = nil
+		}
+	case completeSymbolsVerb:
+		// flags for the command being completed are not validated
+	case "export-openapi":
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with 'export-openapi' verb.")
+		}
+		if len(args) > 0 {
+			o.symbol = args[0]
+			args = args[1:]
+		}
+	default:
+		if len(requestData) > 0 && !(o.verb == "describe" && *sizeEstimate) {
+			warn("The -d argument is not used with 'list' or 'describe' verb.")
+		}
+		if len(rpcHeaders) > 0 {
+			warn("The -rpc-header argument is not used with 'list' or 'describe' verb.")
+		}
+		if len(args) > 0 {
+			o.symbol = args[0]
+			args = args[1:]
+		}
+	}
+
+	if len(args) > 0 {
+		fail(nil, "Too many arguments.")
+	}
+	if o.batch && o.verb != "" {
+		fail(nil, "The -batch argument cannot be used with a verb or method name.")
+	}
+	switch {
+	case o.target != "":
+	case o.verb == "invoke", o.verb == "proxy", o.verb == "cert", o.verb == "test", o.verb == "shell", o.batch, *handshakeOnly:
+		fail(nil, "No host:port specified.")
+	}
+	if *handshakeOnly && (o.verb != "" || o.batch) {
+		fail(nil, "The -handshake-only argument cannot be used with a verb or method name.")
+	}
+	if *xdsStatus {
+		if o.verb != "" || o.batch || *handshakeOnly {
+			fail(nil, "The -xds-status argument cannot be used with a verb, method name, or -handshake-only.")
+		}
+		if !strings.HasPrefix(o.target, "xds:///") {
+			fail(nil, "The -xds-status argument requires an 'xds:///' address.")
+		}
+	}
+}
+
+// parseTarget parses the address of the server.
+func (o *options) parseTarget(target string) {
+	if strings.HasPrefix(target, sshScheme) {
+		var err error
+		if o.sshTun, err = parseSSHTarget(target); err != nil {
+			fail(nil, "Invalid SSH address: %v", err)
+		}
+		// the rest of the address is dialed via the SSH server
+		target = o.sshTun.target
+	}
+	if len(altAddresses) > 0 {
+		if o.sshTun != nil {
+			fail(nil, "The -alt-address argument cannot be used with an 'ssh://' address.")
+		}
+		var err error
+		if target, err = withAltAddresses(target, altAddresses); err != nil {
+			fail(nil, "The -alt-address argument can only be used with 'host:port' addresses: %v", err)
+		}
+	}
+
+	// Parse the target to handle URLs and extract components
+	var err error
+	o.parsedAddr, err = grpcurl.ParseTarget(target)
+	if err != nil {
+		fail(err, "Failed to parse target address %q", target)
+	}
+
+	// Use the parsed address for dialing
+	o.target = o.parsedAddr.Address
+
+	o.local, err = parseLocalTarget(o.target, isUnixSocket != nil && isUnixSocket())
+	if err != nil {
+		fail(nil, "Invalid address %q: %v", o.target, err)
+	}
+}
+
+// checkVerbFlags checks the flags that only apply to some verbs, or to
+// invoking a method.
+func (o *options) checkVerbFlags() {
+	invoke := o.verb == "invoke"
+	if (*templateDepth != 0 || len(templateOneof) > 0) && !*msgTemplate {
+		warn("The -template-depth and -template-oneof arguments are only used with -msg-template.")
+	}
+	if *templateDepth < 0 {
+		fail(nil, "The -template-depth argument must not be negative.")
+	}
+	if *sizeEstimate && o.verb != "describe" {
+		warn("The -size-estimate argument is only used with the 'describe' verb.")
+	}
+	if *describeImports && o.verb != "describe" {
+		warn("The -describe-imports argument is only used with the 'describe' verb.")
+	}
+	if *printCommand && !o.invokesMethod() && o.verb != "shell" {
+		warn("The -print-command argument is only used when invoking or replaying a method, or with the 'shell' verb.")
+	}
+	if *failWithBody && !o.invokesMethod() {
+		warn("The -fail argument is only used when invoking or replaying a method.")
+	}
+	if *watch && o.verb != "proxy" {
+		warn("The -watch argument is only used with the 'mock' or 'proxy' verbs.")
+	}
+	if *dTemplate && !invoke {
+		warn("The -d-template argument is only used when invoking a method.")
+	}
+	if *transformCmd != "" && !o.invokesMethod() {
+		warn("The -transform-cmd argument is only used when invoking or replaying a method.")
+	}
+	if *codecName != "" {
+		o.codec = grpcurl.GetCodec(*codecName)
+		if o.codec == nil {
+			fail(nil, "The -codec argument must be one of %s, not %q.", strings.Join(append([]string{"proto"}, grpcurl.CodecNames()...), ", "), *codecName)
+		}
+		if !o.invokesMethod() && o.verb != "test" && o.verb != "shell" && !o.batch {
+			warn("The -codec argument is only used when invoking or replaying a method, or with the 'test' or 'shell' verb or -batch.")
+		}
+	}
+	if o.batch {
+		var err error
+		if o.batchEntries, err = readBatchManifest(*batchFile); err != nil {
+			fail(err, "Failed to read -batch manifest")
+		}
+		if o.batchVariables, err = parseVariables(batchVars); err != nil {
+			fail(nil, "The -batch-var argument is invalid: %v", err)
+		}
+		if len(requestData) > 0 {
+			warn("The -d argument is not used with -batch.")
+		}
+	} else if len(batchVars) > 0 {
+		warn("The -batch-var argument is only used with -batch.")
+	}
+	if *parallel < 1 {
+		fail(nil, "The -parallel argument must be at least 1.")
+	}
+	if *parallel != 1 && !o.batch && !invoke {
+		warn("The -parallel argument is only used with -batch or when invoking a method.")
+	}
+	if *parallel > 1 && invoke {
+		if *fuzzCount > 0 {
+			fail(nil, "The -parallel argument cannot be used with -fuzz.")
+		}
+		if *recordFile != "" || *outputDir != "" || *dumpRaw != "" || *includeMetadata || *expectStatus != "" || len(expectSubstrs) > 0 || len(expectJQ) > 0 {
+			fail(nil, "The -parallel argument cannot be used with -record, -output-dir, -dump-raw, -include-metadata, or -expect-* arguments.")
+		}
+	}
+	if *maxResponses < 0 {
+		fail(nil, "The -max-responses argument must not be negative.")
+	}
+	if *maxResponses > 0 && (!(invoke || o.verb == "replay" && o.target != "") || *fuzzCount > 0 || invoke && *parallel > 1) {
+		warn("The -max-responses argument is only used when invoking a method, including when replaying a session against a server.")
+	}
+	if *fuzzCount < 0 {
+		fail(nil, "The -fuzz argument must not be negative.")
+	}
+	if *fuzzCount > 0 {
+		if !invoke {
+			warn("The -fuzz argument is only used when invoking a method.")
+		}
+		if len(requestData) > 0 {
+			fail(nil, "The -fuzz and -d arguments cannot be used together.")
+		}
+	} else if *fuzzSeed != 0 {
+		warn("The -fuzz-seed argument is only used with -fuzz.")
+	}
+	switch *asHTTP {
+	case "":
+	case "show", "exec":
+		if !invoke {
+			warn("The -as-http argument is only used when invoking a method.")
+		} else if *fuzzCount > 0 || *parallel > 1 {
+			fail(nil, "The -as-http argument cannot be used with -fuzz or -parallel.")
+		}
+	default:
+		fail(nil, "The -as-http argument must be 'show' or 'exec'.")
+	}
+	if *junitOut != "" && o.verb != "test" {
+		warn("The -junit-out argument is only used with the 'test' verb.")
+	}
+	if *recordFile != "" && !o.invokesMethod() {
+		warn("The -record argument is only used when invoking or replaying a method.")
+	}
+	if (*preCallExec != "" || *postCallExec != "") && !o.invokesMethod() {
+		warn("The -pre-call-exec and -post-call-exec arguments are only used when invoking or replaying a method.")
+	}
+	switch *exitCodeMode {
+	case "offset", "passthrough", "curl":
+	default:
+		fail(nil, "The -exit-code-mode option must be 'offset', 'passthrough', or 'curl'.")
+	}
+	o.exitPolicy = statusExitPolicy{mode: *exitCodeMode}
+	if *failOnCodes != "" && *okCodes != "" {
+		fail(nil, "The -fail-on-codes and -ok-codes arguments cannot be used together.")
+	}
+	if (*failOnCodes != "" || *okCodes != "") && *exitCodeMode == "curl" {
+		fail(nil, "The -fail-on-codes and -ok-codes arguments cannot be used with an -exit-code-mode of 'curl'.")
+	}
+	if *failOnCodes != "" {
+		var err error
+		if o.exitPolicy.failOn, err = parseStatusCodeList(*failOnCodes); err != nil {
+			fail(nil, "Invalid -fail-on-codes argument: %v", err)
+		}
+	}
+	if *okCodes != "" {
+		var err error
+		if o.exitPolicy.ok, err = parseStatusCodeList(*okCodes); err != nil {
+			fail(nil, "Invalid -ok-codes argument: %v", err)
+		}
+	}
+	for _, spec := range alsoOutputs {
+		out, err := parseExtraOutput(spec)
+		if err != nil {
+			fail(nil, "The -also-output argument is invalid: %v", err)
+		}
+		o.extraOutputs = append(o.extraOutputs, out)
+	}
+	if len(o.extraOutputs) > 0 && !o.invokesMethod() {
+		warn("The -also-output argument is only used when invoking or replaying a method.")
+	}
+	if *dumpRaw != "" {
+		var err error
+		if o.dump, err = parseRawDump(*dumpRaw); err != nil {
+			fail(nil, "The -dump-raw argument is invalid: %v", err)
+		}
+		if !(invoke || o.verb == "replay" && o.target != "") || *fuzzCount > 0 {
+			warn("The -dump-raw argument is only used when invoking a method, including when replaying a session against a server.")
+		}
+	}
+}
+
+// checkSourceFlags checks the flags that determine the source of
+// descriptors, and whether server reflection is used.
+func (o *options) checkSourceFlags() {
+	sessionProtoset := o.session != nil && len(o.session.Protoset) > 0
+	if len(protoset) == 0 && len(protoFiles) == 0 && *bsrModule == "" && *protoGit == "" && *bufWorkspaceDir == "" && o.target == "" && !sessionProtoset {
+		fail(nil, "No host:port specified, no protoset specified, and no proto sources specified.")
+	}
+	if len(protoset) > 0 && len(reflHeaders) > 0 && *anyResolve != "reflection" {
+		warn("The -reflect-header argument is not used when -protoset files are used.")
+	}
+	if len(protosetHdrs) > 0 {
+		remote := false
+		for _, name := range protoset {
+			remote = remote || isRemoteProtoset(name)
+		}
+		if !remote {
+			warn("The -protoset-header argument is only used when a -protoset is a URL.")
+		}
+	}
+	if len(protoset) > 0 && len(protoFiles) > 0 {
+		fail(nil, "Use either -protoset files or -proto files, but not both.")
+	}
+	if *bsrModule != "" && (len(protoset) > 0 || len(protoFiles) > 0 || *protoGit != "" || *bufWorkspaceDir != "") {
+		fail(nil, "The -bsr argument cannot be used with -protoset, -proto, -proto-git, or -buf-workspace flags.")
+	}
+	if *protoGit != "" && len(protoset) > 0 {
+		fail(nil, "The -proto-git argument cannot be used with -protoset flags.")
+	}
+	if *bufWorkspaceDir != "" && (len(protoset) > 0 || *protoGit != "") {
+		fail(nil, "The -buf-workspace argument cannot be used with -protoset or -proto-git flags.")
+	}
+	if len(importPaths) > 0 && len(protoFiles) == 0 && *protoGit == "" && *bufWorkspaceDir == "" {
+		warn("The -import-path argument is not used unless -proto files are used.")
+	}
+	if len(protoExcludes) > 0 && len(protoFiles) == 0 && *protoGit == "" && *bufWorkspaceDir == "" {
+		warn("The -proto-exclude argument is not used unless -proto files are used.")
+	}
+	if paths, err := expandImportPaths(importPaths); err != nil {
+		fail(nil, "The -import-path argument is invalid: %v", err)
+	} else {
+		importPaths = paths
+	}
+	if !reflection.val && len(protoset) == 0 && len(protoFiles) == 0 && *bsrModule == "" && *protoGit == "" && *bufWorkspaceDir == "" && !sessionProtoset {
+		fail(nil, "No protoset files or proto files specified and -use-reflection set to false.")
+	}
+
+	// Protoset, protofiles, BSR module, git repository, or buf workspace
+	// provided and -use-reflection unset
+	if !reflection.set && (len(protoset) > 0 || len(protoFiles) > 0 || *bsrModule != "" || *protoGit != "" || *bufWorkspaceDir != "") {
+		reflection.val = false
+	}
+	// Likewise when replaying a session that includes descriptors
+	if !reflection.set && sessionProtoset {
+		reflection.val = false
+	}
+	// And when only printing the xDS status or the server's certificates,
+	// which makes no RPCs
+	if *xdsStatus || o.verb == "cert" {
+		reflection.val = false
+	}
+	switch *reflectVersion {
+	case reflectVersionAuto, reflectVersionV1, reflectVersionV1Alpha:
+	default:
+		fail(nil, "The -reflect-version argument must be 'v1', 'v1alpha', or 'auto'.")
+	}
+	if *reflectCacheDir != "" && !reflection.val {
+		warn("The -reflect-cache argument is only used with server reflection.")
+	}
+	if *reflectCacheTTL < 0 {
+		fail(nil, "The -reflect-cache-ttl argument must not be negative.")
+	}
+	if *separateReflConn && !reflection.val {
+		warn("The -separate-reflection-connection argument is only used with server reflection.")
+	}
+	if o.verb == "replay" && o.target == "" && reflection.val {
+		fail(nil, "Replaying a session without an address requires descriptors, from the session or from protoset or proto flags, and cannot use server reflection.")
+	}
+	if *preserveTiming && !(o.verb == "replay" && o.target == "") {
+		warn("The -preserve-timing argument is only used when replaying a session without an address or with the 'mock' verb.")
+	}
+}
+
+// setUpTiming sets the verbosity and arranges for timing data to be printed
+// or written to a report.
+func (o *options) setUpTiming() {
+	if *verbose {
+		o.verbosityLevel = 1
+	}
+	if *veryVerbose {
+		o.verbosityLevel = 2
+	}
+	if *veryVerbose || *handshakeOnly || *timingOut != "" {
+		o.rootTiming = &timingData{Title: "Timing Data", Start: time.Now()}
+	}
+	if *veryVerbose || *handshakeOnly {
+		o.cleanups = append(o.cleanups, func() {
+			o.rootTiming.Done()
+			dumpTiming(o.rootTiming, 0)
+		})
+	}
+	if *timingOut != "" {
+		if *timingOut != "json" {
+			fail(nil, "The -timing-out argument must be 'json'.")
+		}
+		o.timing = newTimingReport(o.rootTiming)
+		writeTiming := func() {
+			if err := o.timing.write(*timingFile); err != nil {
+				warn("Failed to write timing report: %v", err)
+			}
+		}
+		o.cleanups = append(o.cleanups, writeTiming)
+		exitWithoutTiming := exit
+		exit = func(code int) {
+			writeTiming()
+			exitWithoutTiming(code)
+		}
+	} else if *timingFile != "" {
+		warn("The -timing-file argument is only used with -timing-out.")
+	}
+}
+
+// loadProfile sets the timeouts that are not given via flags from the
+// selected profile, if any.
+func (o *options) loadProfile() {
+	configName := *configPath
+	if configName == "" {
+		configName, _ = defaultConfigFile()
+	}
+	if configName == "" {
+		return
+	}
+	name := *profileName
+	if name == "" {
+		name = defaultProfileName
+	}
+	prof, err := loadProfile(configName, name, *configPath != "" || *profileName != "")
+	if err != nil {
+		fail(err, "Failed to load profile from %s", configName)
+	}
+	if prof == nil {
+		return
+	}
+	present := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		present[f.Name] = true
+	})
+	// these are set as flags, so they are included by -print-command
+	t := prof.timeoutsFor(o.symbol)
+	if t.ConnectTimeout != nil && !present["connect-timeout"] {
+		flags.Set("connect-timeout", strconv.FormatFloat(*t.ConnectTimeout, 'f', -1, 64))
+	}
+	if t.MaxTime != nil && !present["max-time"] {
+		flags.Set("max-time", strconv.FormatFloat(*t.MaxTime, 'f', -1, 64))
+	}
+}
+
+// setUpContext creates the context for the RPCs, which is cancelled after
+// -max-time or the propagated deadline.
+func (o *options) setUpContext() {
+	o.ctx = context.Background()
+	if *maxTime > 0 {
+		timeout := floatSecondsToDuration(*maxTime)
+		var cancel context.CancelFunc
+		o.ctx, cancel = context.WithTimeout(o.ctx, timeout)
+		o.cleanups = append(o.cleanups, cancel)
+	}
+	if *propagateDeadlineFrom != "" {
+		timeout, ok, err := propagatedDeadline(*propagateDeadlineFrom)
+		if err != nil {
+			fail(err, "Failed to propagate deadline")
+		}
+		if ok {
+			var cancel context.CancelFunc
+			o.ctx, cancel = context.WithTimeout(o.ctx, timeout)
+			o.cleanups = append(o.cleanups, cancel)
+		}
+	}
+}
+
+// checkTransportFlags checks the flags for timeouts, keepalives, and
+// transport security.
+func (o *options) checkTransportFlags() {
+	// default behavior is to use tls
+	usetls := !*plaintext && !*usealts
+	forcePlaintext := *plaintext
+
+	// Override TLS usage based on URL scheme if target was parsed as URL
+	if o.parsedAddr != nil && o.parsedAddr.IsURL {
+		if o.parsedAddr.UseTLS && (*plaintext || *usealts) {
+			fail(nil, "Target URL scheme 'https' requires TLS but -plaintext or -alts flag is set.")
+		}
+		if !o.parsedAddr.UseTLS && !*plaintext && !*usealts {
+			// URL scheme is http, force plaintext
+			usetls = false
+			forcePlaintext = true
+		} else if o.parsedAddr.UseTLS && !*plaintext && !*usealts {
+			// URL scheme is https, ensure TLS is used
+			usetls = true
+		}
+	}
+	o.d.usetls, o.d.forcePlaintext = usetls, forcePlaintext
+
+	if *connectTimeout < 0 {
+		fail(nil, "The -connect-timeout argument must not be negative.")
+	}
+	if *keepaliveTime < 0 {
+		fail(nil, "The -keepalive-time argument must not be negative.")
+	}
+	if *keepaliveTimeout < 0 {
+		fail(nil, "The -keepalive-timeout argument must not be negative.")
+	}
+	if *keepaliveTime == 0 && (*keepaliveTimeout > 0 || *keepalivePermitWithoutStream) {
+		warn("The -keepalive-timeout and -keepalive-permit-without-stream arguments are only used with -keepalive-time.")
+	}
+	if *maxTime < 0 {
+		fail(nil, "The -max-time argument must not be negative.")
+	}
+	if *maxLatency < 0 {
+		fail(nil, "The -max-latency argument must not be negative.")
+	}
+	if *maxMsgSz < 0 {
+		fail(nil, "The -max-msg-sz argument must not be negative.")
+	}
+	if *plaintext && *usealts {
+		fail(nil, "The -plaintext and -alts arguments are mutually exclusive.")
+	}
+	if *insecure && !usetls {
+		fail(nil, "The -insecure argument can only be used with TLS.")
+	}
+	if *tofu && !usetls {
+		fail(nil, "The -tofu argument can only be used with TLS.")
+	}
+	if *tofu && *insecure {
+		fail(nil, "The -tofu and -insecure arguments are mutually exclusive.")
+	}
+	if o.verb == "cert" && !usetls {
+		fail(nil, "The 'cert' verb can only be used with TLS.")
+	}
+	if *showCert && !usetls {
+		fail(nil, "The -show-cert argument can only be used with TLS.")
+	}
+	if *showCert && o.verb == "cert" {
+		warn("The -show-cert argument is not used with 'cert' verb.")
+	}
+	if *knownHostsFile != "" && !*tofu {
+		warn("The -known-hosts argument is only used with -tofu.")
+	}
+	if len(pinnedCerts) > 0 {
+		if !usetls {
+			fail(nil, "The -pinned-cert argument can only be used with TLS.")
+		}
+		if *insecure || *tofu {
+			fail(nil, "The -pinned-cert argument cannot be used with -insecure or -tofu.")
+		}
+		for _, p := range pinnedCerts {
+			pin, err := parsePin(p)
+			if err != nil {
+				fail(nil, "The -pinned-cert argument is invalid: %v", err)
+			}
+			o.d.pins = append(o.d.pins, pin)
+		}
+	}
+	if *tlsMinVersion != "" || *tlsMaxVersion != "" || *ciphers != "" {
+		if !usetls {
+			fail(nil, "The -tls-min-version, -tls-max-version, and -ciphers arguments can only be used with TLS.")
+		}
+		var err error
+		if *tlsMinVersion != "" {
+			if o.d.minTLSVersion, err = parseTLSVersion(*tlsMinVersion); err != nil {
+				fail(nil, "The -tls-min-version argument is invalid: %v", err)
+			}
+		}
+		if *tlsMaxVersion != "" {
+			if o.d.maxTLSVersion, err = parseTLSVersion(*tlsMaxVersion); err != nil {
+				fail(nil, "The -tls-max-version argument is invalid: %v", err)
+			}
+		}
+		if o.d.minTLSVersion != 0 && o.d.maxTLSVersion != 0 && o.d.minTLSVersion > o.d.maxTLSVersion {
+			fail(nil, "The -tls-min-version argument must not be greater than -tls-max-version.")
+		}
+		if *ciphers != "" {
+			if o.d.cipherSuites, err = parseCipherSuites(*ciphers); err != nil {
+				fail(nil, "The -ciphers argument is invalid: %v", err)
+			}
+			if o.d.maxTLSVersion == 0 || o.d.maxTLSVersion == tls.VersionTLS13 {
+				warn("The -ciphers argument does not apply to TLS 1.3; use -tls-max-version 1.2 to use only the given cipher suites.")
+			}
+		}
+	}
+	if *cert != "" && !usetls {
+		fail(nil, "The -cert argument can only be used with TLS.")
+	}
+	if *key != "" && !usetls {
+		fail(nil, "The -key argument can only be used with TLS.")
+	}
+	if *keyProvider != "" {
+		if !pkcs11Supported {
+			fail(nil, "The -key-provider argument is not supported by this build of grpcurl, which was built without cgo.")
+		}
+		if !usetls {
+			fail(nil, "The -key-provider argument can only be used with TLS.")
+		}
+		if *key != "" {
+			fail(nil, "The -key and -key-provider arguments are mutually exclusive.")
+		}
+		if !strings.HasPrefix(*keyProvider, "pkcs11:") {
+			fail(nil, "The -key-provider argument must be a 'pkcs11:' URI.")
+		}
+	} else if (*key == "") != (*cert == "") {
+		fail(nil, "The -cert and -key arguments must be used together and both be present.")
+	}
+	if *altsHandshakerServiceAddress != "" && !*usealts {
+		fail(nil, "The -alts-handshaker-service argument must be used with the -alts argument.")
+	}
+	if len(altsTargetServiceAccounts) > 0 && !*usealts {
+		fail(nil, "The -alts-target-service-account argument must be used with the -alts argument.")
+	}
+}
+
+// checkOutputFlags checks the flags for the formats of request and response
+// data and for what is done with the responses.
+func (o *options) checkOutputFlags() {
+	if *format != "csv" && !isRegisteredFormat(*format) {
+		fail(nil, "The -format option must be 'csv' or one of the registered formats: %s.", registeredFormatList())
+	}
+	o.inFormat = *format
+	if *format == "csv" {
+		if o.verb != "invoke" {
+			fail(nil, "The csv format can only be used when invoking a method.")
+		}
+		if *csvMapping == "" {
+			fail(nil, "The -csv-mapping argument is required with the csv format.")
+		}
+		var err error
+		if o.csvFieldMapping, err = loadCSVMapping(*csvMapping); err != nil {
+			fail(err, "Failed to load -csv-mapping")
+		}
+		o.inFormat = "json"
+	} else if *csvMapping != "" {
+		warn("The -csv-mapping argument is only used with the csv format.")
+	}
+	o.outFormat = o.inFormat
+	if *formatOut != "" {
+		switch *formatOut {
+		case "json", "text":
+			o.outFormat = *formatOut
+		case "ndjson":
+			o.outFormat, o.compactJSON = "json", true
+		case "protoscope":
+			o.outFormat = *formatOut
+		default:
+			if !isRegisteredFormat(*formatOut) {
+				fail(nil, "The -format-out option must be 'ndjson', 'protoscope', or one of the registered formats: %s.", registeredFormatList())
+			}
+			o.outFormat = *formatOut
+		}
+		if !o.invokesMethod() {
+			warn("The -format-out argument is only used when invoking or replaying a method.")
+		}
+	}
+	switch *anyResolve {
+	case "off":
+	case "reflection", "error":
+		if !o.invokesMethod() || *fuzzCount > 0 {
+			warn("The -any-resolve argument is only used when invoking or replaying a method.")
+		}
+	default:
+		fail(nil, "The -any-resolve argument must be 'off', 'reflection', or 'error'.")
+	}
+	if *keepUnknown && o.outFormat != "protoscope" {
+		warn("The -keep-unknown argument is only used with '-format-out protoscope'.")
+	}
+	o.filesPattern = *outputPattern
+	if *outputDir != "" {
+		if o.filesPattern == "" {
+			o.filesPattern = "resp-%d.json"
+			if o.outFormat == "text" || o.outFormat == "protoscope" {
+				o.filesPattern = "resp-%d.txt"
+			}
+		}
+		if err := checkOutputPattern(o.filesPattern); err != nil {
+			fail(nil, "The -output-pattern argument is invalid: %v", err)
+		}
+		if !o.invokesMethod() {
+			warn("The -output-dir argument is only used when invoking or replaying a method.")
+		}
+	} else if o.filesPattern != "" {
+		warn("The -output-pattern argument is only used with -output-dir.")
+	}
+	if *outputRawAbove < 0 {
+		fail(nil, "The -output-raw-above argument must not be negative.")
+	}
+	if *outputRawAbove > 0 {
+		if *outputDir == "" {
+			warn("The -output-raw-above argument is only used with -output-dir.")
+		} else if len(alsoOutputs) > 0 || *recordFile != "" || *expectStatus != "" || len(expectSubstrs) > 0 || len(expectJQ) > 0 {
+			fail(nil, "The -output-raw-above argument cannot be used with -also-output, -record, or -expect-* arguments.")
+		}
+	}
+	if *emitDefaults && o.inFormat != "json" && o.outFormat != "json" {
+		warn("The -emit-defaults is only used when using json format.")
+	}
+	if *useProtoNames && o.inFormat != "json" && o.outFormat != "json" {
+		warn("The -use-proto-names is only used when using json format.")
+	}
+	if *debugCategories != "" {
+		var err error
+		debugEnabled, err = parseDebugCategories(*debugCategories)
+		if err != nil {
+			fail(nil, "The -debug argument is invalid: %v", err)
+		}
+		if debugEnabled[debugTransport] {
+			enableTransportLogging()
+		}
+	}
+	if *grpcGoTrace != "" {
+		if err := enableGRPCTrace(*grpcGoTrace); err != nil {
+			fail(err, "Failed to open -grpc-go-trace file")
+		}
+	}
+	if *jqExpr != "" {
+		if o.outFormat != "json" {
+			fail(nil, "The -jq argument can only be used with json format.")
+		}
+		if !o.invokesMethod() {
+			warn("The -jq argument is only used when invoking or replaying a method.")
+		}
+		var err error
+		o.filter, err = newJQFilter(*jqExpr)
+		if err != nil {
+			fail(err, "Invalid -jq expression")
+		}
+		o.filter.compact = o.compactJSON
+	}
+	if *expectStatus != "" || len(expectSubstrs) > 0 || len(expectJQ) > 0 {
+		if !o.invokesMethod() {
+			warn("The -expect-status, -expect-response-contains, and -expect-jq arguments are only used when invoking or replaying a method.")
+		}
+		o.expectations = &responseExpectations{contains: expectSubstrs}
+		if *expectStatus != "" {
+			code, err := parseStatusCodeName(*expectStatus)
+			if err != nil {
+				fail(nil, "Invalid -expect-status argument: %v", err)
+			}
+			o.expectations.status = &code
+		}
+		for _, expr := range expectJQ {
+			jq, err := newJQExpectation(expr)
+			if err != nil {
+				fail(err, "Invalid -expect-jq expression %q", expr)
+			}
+			o.expectations.jq = append(o.expectations.jq, jq)
+		}
+	}
+	if *outputTemplate != "" {
+		if o.outFormat != "json" {
+			fail(nil, "The -output-template argument can only be used with json format.")
+		}
+		if *jqExpr != "" {
+			fail(nil, "The -output-template and -jq arguments are mutually exclusive.")
+		}
+		if !o.invokesMethod() {
+			warn("The -output-template argument is only used when invoking or replaying a method.")
+		}
+		var err error
+		o.outTemplate, err = parseOutputTemplate(*outputTemplate)
+		if err != nil {
+			fail(err, "Invalid -output-template")
+		}
+	}
+	if *includeMetadata {
+		if o.outFormat != "json" {
+			fail(nil, "The -include-metadata argument can only be used with json format.")
+		}
+		if *jqExpr != "" || *outputTemplate != "" || *outputDir != "" {
+			fail(nil, "The -include-metadata argument cannot be used with -jq, -output-template, or -output-dir.")
+		}
+		if !o.invokesMethod() {
+			warn("The -include-metadata argument is only used when invoking or replaying a method.")
+		}
+		if o.verbosityLevel > 0 {
+			warn("The -v and -vv arguments are ignored when -include-metadata is used.")
+			o.verbosityLevel = 0
+		}
+	}
+}
+
+// setUpTelemetry sets up the events file, tracing, and the stats line.
+func (o *options) setUpTelemetry() {
+	if *eventsOut != "" {
+		if !o.invokesMethod() {
+			warn("The -events-out argument is only used when invoking or replaying a method.")
+		} else {
+			var err error
+			if o.events, err = newEventLog(*eventsOut); err != nil {
+				fail(err, "Failed to create events file %s", *eventsOut)
+			}
+		}
+	}
+
+	if *otelEndpoint != "" {
+		if o.target == "" {
+			warn("The -otel-endpoint argument is only used when connecting to a server.")
+		} else {
+			name, method := "grpcurl", ""
+			switch o.verb {
+			case "invoke":
+				name, method = o.symbol, o.symbol
+			case "list", "describe":
+				name = "grpcurl " + o.verb
+			}
+			var err error
+			if o.tracer, err = newOTelTracer(o.ctx, *otelEndpoint, name, rpcAttributes(o.target, method)...); err != nil {
+				fail(err, "Failed to create OpenTelemetry exporter")
+			}
+			if o.verbosityLevel > 0 {
+				fmt.Printf("Trace ID: %s\n", o.tracer.traceID())
+			}
+			o.cleanups = append(o.cleanups, func() {
+				o.tracer.shutdown(0)
+			})
+			exitWithoutTrace := exit
+			exit = func(code int) {
+				o.tracer.shutdown(code)
+				exitWithoutTrace(code)
+			}
+		}
+	}
+
+	if *statsLineFormat != "" {
+		if *statsLineFormat != "kv" && *statsLineFormat != "json" {
+			fail(nil, "The -stats-line argument must be 'kv' or 'json'.")
+		}
+		if !o.invokesMethod() {
+			warn("The -stats-line argument is only used when invoking or replaying a method.")
+		}
+		switch *statsFD {
+		case 1:
+			o.statsOut = os.Stdout
+		case 2:
+			o.statsOut = os.Stderr
+		default:
+			if *statsFD < 1 {
+				fail(nil, "The -stats-fd argument must be positive.")
+			}
+			o.statsOut = os.NewFile(uintptr(*statsFD), "stats")
+		}
+	} else if *statsFD != 2 {
+		warn("The -stats-fd argument is only used with -stats-line.")
+	}
+}
+
+// setUpDialer checks the flags for load balancing, retries, name resolution,
+// and proxies, and sets up the dialer of the connection to the server.
+func (o *options) setUpDialer() {
+	target, local := o.target, o.local
+	if *lbPolicy != "" {
+		if err := validateLBPolicy(*lbPolicy); err != nil {
+			fail(nil, "The -lb-policy argument is invalid: %v", err)
+		}
+	}
+	var retry map[string]interface{}
+	if *maxRetryCount < 0 || *maxRetryCount > maxRetries {
+		fail(nil, "The -max-retries argument must be between 0 and %d.", maxRetries)
+	}
+	retryCodeSet, err := parseStatusCodeList(*retryCodes)
+	if err != nil {
+		fail(nil, "The -retry-codes argument is invalid: %v", err)
+	}
+	if *maxRetryCount > 0 {
+		if len(retryCodeSet) == 0 {
+			fail(nil, "The -retry-codes argument must include at least one status code.")
+		}
+		retry = retryPolicy(*maxRetryCount, retryCodeSet)
+	} else if *retryCodes != defaultRetryCodes {
+		warn("The -retry-codes argument is only used with -max-retries.")
+	}
+	serviceConfig, err := defaultServiceConfig(*lbPolicy, retry)
+	if err != nil {
+		fail(err, "Failed to create service config")
+	}
+
+	var dnsResolver *dnsResolverBuilder
+	var consulResolver *consulResolverBuilder
+	if *dnsServer != "" || *dnsTimeout != 0 || len(resolveAddrs) > 0 {
+		if *resolverExec != "" {
+			fail(nil, "The -resolver-exec argument cannot be used with -dns-server, -dns-timeout, or -resolve.")
+		}
+		if *dnsTimeout < 0 {
+			fail(nil, "The -dns-timeout argument must not be negative.")
+		}
+		dnsResolver = &dnsResolverBuilder{timeout: floatSecondsToDuration(*dnsTimeout)}
+		if *dnsServer != "" {
+			var err error
+			if dnsResolver.server, err = parseDNSServer(*dnsServer); err != nil {
+				fail(nil, "The -dns-server argument is invalid: %v", err)
+			}
+		}
+		var err error
+		if dnsResolver.pinned, err = parseResolveEntries(resolveAddrs); err != nil {
+			fail(nil, "The -resolve argument is invalid: %v", err)
+		}
+		if strings.Contains(target, "://") && !strings.HasPrefix(target, srvScheme) || local != nil {
+			fail(nil, "The -dns-server, -dns-timeout, and -resolve arguments can only be used with a 'host:port' or 'srv://' address.")
+		}
+	} else if strings.HasPrefix(target, srvScheme) {
+		if *resolverExec != "" {
+			fail(nil, "The -resolver-exec argument cannot be used with an 'srv://' address.")
+		}
+		dnsResolver = &dnsResolverBuilder{}
+	} else if strings.HasPrefix(target, consulScheme) {
+		if *resolverExec != "" {
+			fail(nil, "The -resolver-exec argument cannot be used with a 'consul://' address.")
+		}
+		consulTarget, err := parseConsulTarget(target)
+		if err != nil {
+			fail(nil, "Invalid address: %v", err)
+		}
+		consulResolver = &consulResolverBuilder{target: consulTarget}
+		consulResolver.baseURL, consulResolver.token = consulAgent()
+	} else if (*lbPolicy != "" || isMultiAddressTarget(target)) && *resolverExec == "" &&
+		!strings.Contains(target, "://") && local == nil {
+		// the address is usually passed through to the dialer, which connects
+		// to just one of its IP addresses; resolve it here so all are used
+		dnsResolver = &dnsResolverBuilder{}
+	}
+
+	if o.sshTun != nil {
+		if *resolverExec != "" || dnsResolver != nil || consulResolver != nil {
+			fail(nil, "An 'ssh://' address cannot be used with -resolver-exec, -dns-server, -dns-timeout, -resolve, -lb-policy, or multiple addresses.")
+		}
+		o.sshTun.keyFile = *sshKey
+		o.sshTun.knownHostsFile = *sshKnownHosts
+		if o.sshTun.knownHostsFile == "" {
+			if o.sshTun.knownHostsFile, err = defaultSSHKnownHostsFile(); err != nil {
+				fail(err, "Failed to locate SSH known hosts file")
+			}
+		}
+	} else if *sshKey != "" || *sshKnownHosts != "" {
+		warn("The -ssh-key and -ssh-known-hosts arguments are only used with an 'ssh://' address.")
+	}
+
+	var rpcPathPrefix string
+	if *pathPrefix != "" {
+		if rpcPathPrefix, err = parsePathPrefix(*pathPrefix); err != nil {
+			fail(nil, "The -path-prefix argument is invalid: %v", err)
+		}
+		if target == "" {
+			warn("The -path-prefix argument is only used with an address.")
+		}
+	} else if o.parsedAddr != nil && o.parsedAddr.IsURL && o.parsedAddr.Path != "" {
+		if rpcPathPrefix, err = parsePathPrefix(o.parsedAddr.Path); err != nil {
+			fail(nil, "Invalid address: the path is invalid: %v", err)
+		}
+	}
+
+	if target != "" && !*noProxy && o.sshTun == nil {
+		useSystemProxy()
+	}
+
+	o.d.target = target
+	o.d.parsedAddr = o.parsedAddr
+	o.d.local = local
+	o.d.sshTun = o.sshTun
+	o.d.dnsResolver = dnsResolver
+	o.d.consulResolver = consulResolver
+	o.d.serviceConfig = serviceConfig
+	o.d.rpcPathPrefix = rpcPathPrefix
+	o.d.tracer = o.tracer
+	o.d.events = o.events
+	o.d.rootTiming = o.rootTiming
+	o.d.verbosityLevel = o.verbosityLevel
+	o.d.certVerb = o.verb == "cert"
+	o.d.supportBundle = o.verb == "support-bundle"
+}
+
+// readHeaders reads the headers given in files, expands the headers given
+// via flags, and adds the propagated and tracing headers.
+func (o *options) readHeaders() {
+	var fileHeaders []string
+	for _, fileName := range headerFiles {
+		hdrs, err := readHeaderFile(fileName)
+		if err != nil {
+			fail(err, "Failed to read headers from %s", fileName)
+		}
+		fileHeaders = append(fileHeaders, hdrs...)
+	}
+	if *expandHeaders {
+		var err error
+		addlHeaders, err = grpcurl.ExpandHeaders(addlHeaders)
+		if err != nil {
+			fail(err, "Failed to expand additional headers")
+		}
+		rpcHeaders, err = grpcurl.ExpandHeaders(rpcHeaders)
+		if err != nil {
+			fail(err, "Failed to expand rpc headers")
+		}
+		reflHeaders, err = grpcurl.ExpandHeaders(reflHeaders)
+		if err != nil {
+			fail(err, "Failed to expand reflection headers")
+		}
+	}
+
+	// file headers are already expanded, so are added after expanding others
+	addlHeaders = append(fileHeaders, addlHeaders...)
+	for _, hdrs := range []*multiString{&addlHeaders, &rpcHeaders, &reflHeaders} {
+		var err error
+		if *hdrs, err = readBinaryHeaderFiles(*hdrs); err != nil {
+			fail(err, "Failed to read binary header value")
+		}
+	}
+	if *propagateMetadata != "" {
+		hdrs, err := propagatedHeaders(*propagateMetadata)
+		if err != nil {
+			fail(err, "Invalid -propagate-metadata argument")
+		}
+		rpcHeaders = append(rpcHeaders, hdrs...)
+	}
+	addlHeaders = append(addlHeaders, o.tracer.headers()...)
+}
+
+// headers returns the headers sent with RPCs other than those for reflection.
+func (o *options) headers() []string {
+	return append(append([]string{}, addlHeaders...), rpcHeaders...)
+}
+
+// tryDial connects to the server.
+func (o *options) tryDial() (*grpc.ClientConn, error) {
+	return o.d.dial(o.ctx)
+}
+
+// dial connects to the server, exiting if it fails.
+func (o *options) dial() *grpc.ClientConn {
+	cc, err := o.tryDial()
+	if err != nil {
+		fail(err, "Failed to dial target host %q", o.target)
+	}
+	return cc
+}
+
+// conn returns the connection to the server, dialing it if it has not been
+// dialed already.
+func (o *options) conn() *grpc.ClientConn {
+	if o.cc == nil {
+		o.cc = o.dial()
+	}
+	return o.cc
+}
+
+// channel returns the connection to the server, dialing it if needed, as a
+// channel that uses the -codec, if any.
+func (o *options) channel() grpcdynamic.Channel {
+	return codecChannel(o.conn(), o.codec)
+}
+
+// connect sets up the source of descriptors, from the files given via flags,
+// from the cache of descriptors, or via server reflection, which dials the
+// server. It arranges for the connections to be closed when grpcurl exits.
+func (o *options) connect() {
+	fileSource := loadFileSource()
+	if fileSource == nil && o.session != nil {
+		var err error
+		fileSource, err = o.session.descriptorSource()
+		if err != nil {
+			fail(err, "Failed to process descriptors in session")
+		}
+	}
+	var refCache *reflectCache
+	var cachedSource grpcurl.DescriptorSource
+	// the handshake checks that reflection works, so it does not use the
+	// cache
+	if reflection.val && *reflectCacheDir != "" && !*handshakeOnly {
+		refCache = newReflectCache(*reflectCacheDir, o.target, *authority, floatSecondsToDuration(*reflectCacheTTL))
+		var err error
+		if cachedSource, err = refCache.load(); err != nil {
+			warn("Failed to read descriptors from -reflect-cache: %v", err)
+			cachedSource = nil
+		} else if cachedSource != nil {
+			debugf(debugReflection, "Using descriptors cached in %s", refCache.fileName)
+		}
+	}
+	if cachedSource != nil {
+		if fileSource != nil {
+			o.descSource = compositeSource{cachedSource, fileSource}
+		} else {
+			o.descSource = cachedSource
+		}
+	} else if reflection.val {
+		md := grpcurl.MetadataFromHeaders(append(addlHeaders, reflHeaders...))
+		refCtx := metadata.NewOutgoingContext(o.ctx, md)
+		if *separateReflConn {
+			// the connection for the RPC is dialed later, when it is needed
+			o.refCC = o.dial()
+		} else {
+			o.refCC = o.conn()
+		}
+		var onNegotiated func(version, reason string)
+		if o.verbosityLevel > 0 {
+			onNegotiated = func(version, reason string) {
+				if reason != "" {
+					fmt.Printf("\nUsing server reflection %s (%s)\n", version, reason)
+				} else {
+					fmt.Printf("\nUsing server reflection %s\n", version)
+				}
+			}
+		}
+		o.refClient = newReflectionClient(refCtx, o.refCC, *reflectVersion, onNegotiated)
+		o.refClient.AllowMissingFileDescriptors()
+		reflSource := grpcurl.DescriptorSourceFromServer(o.ctx, o.refClient)
+		if debugEnabled[debugReflection] {
+			reflSource = debugDescriptorSource{reflSource}
+		}
+		// the results are kept for the rest of the run, so that resolving the
+		// same symbols again, such as to describe and then invoke a method or
+		// to format each response, does not make more reflection requests
+		reflSource = grpcurl.NewCachingSource(reflSource, 0)
+		if refCache != nil {
+			if err := refCache.store(reflSource); err != nil {
+				warn("Failed to write descriptors to -reflect-cache: %v", err)
+			} else {
+				debugf(debugReflection, "Cached descriptors in %s", refCache.fileName)
+			}
+		}
+		if fileSource != nil {
+			o.descSource = compositeSource{reflSource, fileSource}
+		} else {
+			o.descSource = reflSource
+		}
+	} else {
+		o.descSource = fileSource
+	}
+
+	// arrange for the RPCs to be cleanly shutdown
+	o.cleanups = append(o.cleanups, o.reset)
+	exitWithoutReset := exit
+	exit = func(code int) {
+		// since defers aren't run by os.Exit...
+		o.reset()
+		exitWithoutReset(code)
+	}
+}
+
+// reset stops reflection and closes the connections.
+func (o *options) reset() {
+	if o.refClient != nil {
+		o.refClient.Reset()
+		o.refClient = nil
+	}
+	if o.refCC != nil && o.refCC != o.cc {
+		o.refCC.Close()
+	}
+	o.refCC = nil
+	if o.cc != nil {
+		o.cc.Close()
+		o.cc = nil
+	}
+}
+
+// invocation returns the invocation of the method, or the replay of the
+// session. It prints the equivalent command, for -print-command, and dials
+// the server, if there is one.
+func (o *options) invocation() *invocation {
+	if *printCommand {
+		fmt.Fprintln(os.Stderr, equivalentCommand(filepath.Base(os.Args[0]), flags, o.commandArgs))
+	}
+	if o.target != "" {
+		o.conn()
+	}
+	// the source used to resolve the types of Any messages
+	anySource := o.descSource
+	if *anyResolve == "reflection" && !reflection.val && o.cc != nil {
+		md := grpcurl.MetadataFromHeaders(append(addlHeaders, reflHeaders...))
+		o.refClient = newReflectionClient(metadata.NewOutgoingContext(o.ctx, md), o.cc, *reflectVersion, nil)
+		o.refClient.AllowMissingFileDescriptors()
+		anySource = anyTypeSource{DescriptorSource: o.descSource, reflection: grpcurl.DescriptorSourceFromServer(o.ctx, o.refClient)}
+	}
+	return &invocation{
+		target:          o.target,
+		symbol:          o.symbol,
+		session:         o.session,
+		source:          o.descSource,
+		anySource:       anySource,
+		cc:              o.cc,
+		codec:           o.codec,
+		headers:         o.headers(),
+		inFormat:        grpcurl.Format(o.inFormat),
+		outFormat:       grpcurl.Format(o.outFormat),
+		compactJSON:     o.compactJSON,
+		csvFieldMapping: o.csvFieldMapping,
+		filesPattern:    o.filesPattern,
+		filter:          o.filter,
+		outTemplate:     o.outTemplate,
+		expectations:    o.expectations,
+		extraOutputs:    o.extraOutputs,
+		dump:            o.dump,
+		events:          o.events,
+		statsOut:        o.statsOut,
+		timing:          o.timing,
+		tracer:          o.tracer,
+		rootTiming:      o.rootTiming,
+		exitPolicy:      o.exitPolicy,
+		verbosityLevel:  o.verbosityLevel,
+	}
+}
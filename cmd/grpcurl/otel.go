@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// otelTracerName is the name of the instrumentation that creates grpcurl's
+// spans.
+const otelTracerName = "github.com/fullstorydev/grpcurl"
+
+// otelShutdownTimeout is how long to wait for the span to be exported when
+// grpcurl exits.
+const otelShutdownTimeout = 5 * time.Second
+
+// otelTracer emits a client span for the invocation to an OpenTelemetry
+// collector via OTLP, for -otel-endpoint. The span has events for dialing,
+// for server reflection, and for each message, and its context is sent to the
+// server in the traceparent header, so that the server's spans are its
+// children.
+type otelTracer struct {
+	provider *sdktrace.TracerProvider
+	span     trace.Span
+	ctx      context.Context
+	ended    bool
+}
+
+// newOTelTracer starts a span with the given name, which is exported to the
+// given endpoint when shutdown is called. The endpoint is a 'host:port' address
+// for OTLP over gRPC, without TLS, or an 'http://' or 'https://' URL for OTLP
+// over HTTP. If the TRACEPARENT environment variable is set, such as by a CI
+// system, the span is a child of the span it names.
+func newOTelTracer(ctx context.Context, endpoint, name string, attrs ...attribute.KeyValue) (*otelTracer, error) {
+	exporter, err := newOTLPExporter(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "grpcurl"), attribute.String("service.version", version)),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		warn("Failed to export trace: %v", err)
+	}))
+
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	})
+	ctx, span := provider.Tracer(otelTracerName, trace.WithInstrumentationVersion(version)).
+		Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return &otelTracer{provider: provider, span: span, ctx: ctx}, nil
+}
+
+func newOTLPExporter(ctx context.Context, endpoint string) (*otlptrace.Exporter, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// rpcAttributes returns the attributes of a span for calling the given method,
+// which is in 'package.Service/Method' or 'package.Service.Method' form.
+func rpcAttributes(target, method string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	if target != "" {
+		attrs = append(attrs, attribute.String("server.address", target))
+	}
+	if method != "" {
+		pos := strings.LastIndexAny(method, "/.")
+		if pos > 0 {
+			attrs = append(attrs, attribute.String("rpc.service", method[:pos]), attribute.String("rpc.method", method[pos+1:]))
+		}
+	}
+	return attrs
+}
+
+// traceID returns the ID of the trace, for printing.
+func (t *otelTracer) traceID() string {
+	return t.span.SpanContext().TraceID().String()
+}
+
+// headers returns the headers, in 'name: value' form, that send the span's
+// context to the server.
+func (t *otelTracer) headers() []string {
+	if t == nil {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(t.ctx, carrier)
+	var hdrs []string
+	for _, k := range carrier.Keys() {
+		hdrs = append(hdrs, fmt.Sprintf("%s: %s", k, carrier.Get(k)))
+	}
+	return hdrs
+}
+
+// dialed records that a connection was made, or that it failed, after dialing
+// for the given time.
+func (t *otelTracer) dialed(start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	attrs := []attribute.KeyValue{attribute.Int64("duration_ms", time.Since(start).Milliseconds())}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error", err.Error()))
+	}
+	t.span.AddEvent("dial", trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+}
+
+// finish ends the span with the given status of the RPC.
+func (t *otelTracer) finish(st *status.Status) {
+	if t == nil || t.ended {
+		return
+	}
+	t.span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+	if st.Code() != grpccodes.OK {
+		t.span.SetStatus(codes.Error, st.Message())
+	}
+	t.span.End()
+	t.ended = true
+}
+
+// shutdown ends the span, if finish was not called, and exports it. The span
+// is marked as an error if grpcurl is exiting with a non-zero exit code.
+func (t *otelTracer) shutdown(exitCode int) {
+	if !t.ended {
+		if exitCode != 0 {
+			t.span.SetStatus(codes.Error, fmt.Sprintf("exited with code %d", exitCode))
+		}
+		t.span.End()
+		t.ended = true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		warn("Failed to export trace to -otel-endpoint: %v", err)
+	}
+}
+
+// statsHandler returns a handler that adds an event to the span for each
+// message sent or received via the connection. Messages of the server
+// reflection service are recorded as reflection events.
+func (t *otelTracer) statsHandler() stats.Handler {
+	return &otelStatsHandler{span: t.span}
+}
+
+type otelStatsHandler struct {
+	span trace.Span
+}
+
+// otelRPCInfo is the state of an RPC, for numbering its messages.
+type otelRPCInfo struct {
+	method     string
+	sent, recv int64
+}
+
+type otelRPCInfoKey struct{}
+
+func (h *otelStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, otelRPCInfoKey{}, &otelRPCInfo{method: info.FullMethodName})
+}
+
+func (h *otelStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	info, ok := ctx.Value(otelRPCInfoKey{}).(*otelRPCInfo)
+	if !ok {
+		return
+	}
+	var msgType string
+	var id int64
+	var size, wireSize int
+	switch s := s.(type) {
+	case *stats.OutPayload:
+		msgType, id, size, wireSize = "SENT", atomic.AddInt64(&info.sent, 1), s.Length, s.WireLength
+	case *stats.InPayload:
+		msgType, id, size, wireSize = "RECEIVED", atomic.AddInt64(&info.recv, 1), s.Length, s.WireLength
+	default:
+		return
+	}
+	name := "message"
+	if strings.HasPrefix(info.method, "/grpc.reflection.") {
+		name = "reflection"
+	}
+	h.span.AddEvent(name, trace.WithAttributes(
+		attribute.String("rpc.method", info.method),
+		attribute.String("message.type", msgType),
+		attribute.Int64("message.id", id),
+		attribute.Int("message.uncompressed_size", size),
+		attribute.Int("message.wire_size", wireSize),
+	))
+}
+
+func (h *otelStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *otelStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
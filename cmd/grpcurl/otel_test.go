@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTelTracer(t *testing.T) {
+	var mu sync.Mutex
+	var spans []*tracepb.Span
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(b, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		for _, rs := range req.GetResourceSpans() {
+			for _, ss := range rs.GetScopeSpans() {
+				spans = append(spans, ss.GetSpans()...)
+			}
+		}
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(nil)
+	}))
+	defer collector.Close()
+
+	t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	tracer, err := newOTelTracer(context.Background(), collector.URL, "testing.TestService/UnaryCall", rpcAttributes("localhost:8080", "testing.TestService/UnaryCall")...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tracer.traceID() != "0af7651916cd43dd8448eb211c80319c" {
+		t.Errorf("expected trace from TRACEPARENT, got %s", tracer.traceID())
+	}
+	hdrs := tracer.headers()
+	if len(hdrs) != 1 || !strings.HasPrefix(hdrs[0], "traceparent: 00-0af7651916cd43dd8448eb211c80319c-") {
+		t.Errorf("unexpected headers: %v", hdrs)
+	}
+	tracer.dialed(time.Now(), errors.New("connection refused"))
+	tracer.finish(status.New(codes.NotFound, "no such thing"))
+	tracer.shutdown(1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.GetName() != "testing.TestService/UnaryCall" || span.GetKind() != tracepb.Span_SPAN_KIND_CLIENT {
+		t.Errorf("unexpected span: %s, %s", span.GetName(), span.GetKind())
+	}
+	if span.GetStatus().GetCode() != tracepb.Status_STATUS_CODE_ERROR || span.GetStatus().GetMessage() != "no such thing" {
+		t.Errorf("unexpected status: %v", span.GetStatus())
+	}
+	attrs := map[string]string{}
+	for _, kv := range span.GetAttributes() {
+		if v := kv.GetValue().GetStringValue(); v != "" {
+			attrs[kv.GetKey()] = v
+		}
+	}
+	if attrs["rpc.service"] != "testing.TestService" || attrs["rpc.method"] != "UnaryCall" || attrs["server.address"] != "localhost:8080" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+	if len(span.GetEvents()) != 1 || span.GetEvents()[0].GetName() != "dial" {
+		t.Errorf("unexpected events: %v", span.GetEvents())
+	}
+}
+
+func TestRPCAttributes(t *testing.T) {
+	for _, method := range []string{"pkg.Service/Method", "pkg.Service.Method"} {
+		attrs := map[string]string{}
+		for _, kv := range rpcAttributes("", method) {
+			attrs[string(kv.Key)] = kv.Value.AsString()
+		}
+		if attrs["rpc.system"] != "grpc" || attrs["rpc.service"] != "pkg.Service" || attrs["rpc.method"] != "Method" {
+			t.Errorf("%s: unexpected attributes: %v", method, attrs)
+		}
+		if _, ok := attrs["server.address"]; ok {
+			t.Errorf("%s: unexpected server.address", method)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// extraOutputFormats are the formats that may be used with -also-output.
+var extraOutputFormats = []string{"json", "ndjson", "text", "binary"}
+
+// extraOutput is an additional file to which response messages are written,
+// given via -also-output.
+type extraOutput struct {
+	format   string
+	fileName string
+	file     *os.File
+	w        *bufio.Writer
+	// for formats other than binary
+	formatter grpcurl.Formatter
+	err       error
+}
+
+// parseExtraOutput parses an argument to -also-output, which must be in
+// "format=file" form.
+func parseExtraOutput(spec string) (*extraOutput, error) {
+	pos := strings.IndexByte(spec, '=')
+	if pos <= 0 || pos == len(spec)-1 {
+		return nil, fmt.Errorf("%q should be in 'format=file' form", spec)
+	}
+	format, fileName := spec[:pos], spec[pos+1:]
+	for _, f := range extraOutputFormats {
+		if format == f {
+			return &extraOutput{format: format, fileName: fileName}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q; must be one of %s", format, strings.Join(extraOutputFormats, ", "))
+}
+
+// open creates the output file and the formatter used to write to it.
+func (o *extraOutput) open(descSource grpcurl.DescriptorSource, options grpcurl.FormatOptions) error {
+	switch o.format {
+	case "json", "ndjson":
+		options.CompactJSON = o.format == "ndjson"
+		_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, descSource, nil, options)
+		if err != nil {
+			return err
+		}
+		o.formatter = formatter
+	case "text":
+		// always use separators, so the file can be used as input to grpcurl
+		options.IncludeTextSeparator = true
+		_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatText, descSource, nil, options)
+		if err != nil {
+			return err
+		}
+		o.formatter = formatter
+	}
+	f, err := os.Create(o.fileName)
+	if err != nil {
+		return err
+	}
+	o.file = f
+	o.w = bufio.NewWriter(f)
+	return nil
+}
+
+// write writes the given message. Binary output is a sequence of messages,
+// each prefixed with its length as a varint. The other formats write each
+// message followed by a newline.
+func (o *extraOutput) write(m proto.Message) error {
+	if o.formatter == nil {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if _, err := o.w.Write(protowire.AppendVarint(nil, uint64(len(b)))); err != nil {
+			return err
+		}
+		_, err = o.w.Write(b)
+		return err
+	}
+	str, err := o.formatter(m)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(o.w, str)
+	return err
+}
+
+// close flushes and closes the file, returning the first error that occurred
+// when writing to it.
+func (o *extraOutput) close() error {
+	if err := o.w.Flush(); err != nil && o.err == nil {
+		o.err = err
+	}
+	if err := o.file.Close(); err != nil && o.err == nil {
+		o.err = err
+	}
+	return o.err
+}
+
+// extraOutputHandler writes every response message to the files given via
+// -also-output, in addition to handling them as usual.
+type extraOutputHandler struct {
+	grpcurl.InvocationEventHandler
+	outputs []*extraOutput
+}
+
+func (h extraOutputHandler) OnReceiveResponse(m proto.Message) {
+	h.InvocationEventHandler.OnReceiveResponse(m)
+	for _, o := range h.outputs {
+		if o.err == nil {
+			o.err = o.write(m)
+		}
+	}
+}
+
+// checkOutputPattern verifies that the given pattern, when formatted with a
+// response number, yields a distinct file name for each response.
+func checkOutputPattern(pattern string) error {
+	first, second := fmt.Sprintf(pattern, 1), fmt.Sprintf(pattern, 2)
+	if strings.Contains(first, "%!") || first == second {
+		return fmt.Errorf("%q must contain exactly one %%d verb for the response number", pattern)
+	}
+	if strings.ContainsRune(first, filepath.Separator) || strings.ContainsRune(first, '/') {
+		return fmt.Errorf("%q must not contain path separators", pattern)
+	}
+	return nil
+}
+
+// responseFilesHandler writes each response message to its own file, given
+// via -output-dir and -output-pattern, instead of printing it.
+type responseFilesHandler struct {
+	*grpcurl.DefaultEventHandler
+	dir     string
+	pattern string
+	// if non-nil, large responses have already been written in binary form
+	raw *rawResponses
+	err error
+}
+
+func (h *responseFilesHandler) OnReceiveResponse(resp proto.Message) {
+	h.NumResponses++
+	if h.err != nil {
+		return
+	}
+	if fileName, ok := h.raw.written(h.NumResponses); ok {
+		if h.VerbosityLevel > 0 {
+			fmt.Fprintf(h.Out, "\nResponse contents written in binary form to %s\n", fileName)
+		}
+		return
+	}
+	fileName := filepath.Join(h.dir, fmt.Sprintf(h.pattern, h.NumResponses))
+	if h.VerbosityLevel > 0 {
+		fmt.Fprintf(h.Out, "\nResponse contents written to %s\n", fileName)
+	}
+	respStr, err := h.Formatter(resp)
+	if err != nil {
+		h.err = fmt.Errorf("failed to format response message %d: %v", h.NumResponses, err)
+		return
+	}
+	if err := os.WriteFile(fileName, []byte(respStr+"\n"), 0666); err != nil {
+		h.err = err
+	}
+}
+
+// rawResponses writes each response message whose encoded size is at least a
+// threshold, given via -output-raw-above, to its file in the -output-dir
+// directory in binary form, as it is received. Such messages are never decoded
+// or formatted, which would take many times their encoded size in memory.
+type rawResponses struct {
+	dir       string
+	pattern   string
+	threshold int
+
+	mu sync.Mutex
+	// the number of responses received
+	count int
+	// the names of the files written for responses, by response number
+	files map[int]string
+}
+
+// codec returns a codec that decodes responses using the given codec, or the
+// proto codec if it is nil, unless they are written in binary form, in which
+// case the message is left empty.
+func (r *rawResponses) codec(base encoding.Codec) encoding.Codec {
+	if base == nil {
+		base = encoding.GetCodec("proto")
+	}
+	return rawResponseCodec{Codec: base, raw: r}
+}
+
+// fileName returns the name of the file to which the given response is
+// written in binary form. It is the name used for other responses, but with
+// a '.bin' extension.
+func (r *rawResponses) fileName(n int) string {
+	name := fmt.Sprintf(r.pattern, n)
+	if ext := filepath.Ext(name); ext == ".json" || ext == ".txt" {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return filepath.Join(r.dir, name+".bin")
+}
+
+// written returns the name of the file to which the given response was
+// written in binary form, and false if it was not.
+func (r *rawResponses) written(n int) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fileName, ok := r.files[n]
+	return fileName, ok
+}
+
+type rawResponseCodec struct {
+	encoding.Codec
+	raw *rawResponses
+}
+
+func (c rawResponseCodec) Unmarshal(data []byte, v interface{}) error {
+	r := c.raw
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+	if len(data) < r.threshold {
+		return c.Codec.Unmarshal(data, v)
+	}
+	fileName := r.fileName(r.count)
+	if err := os.WriteFile(fileName, data, 0666); err != nil {
+		return err
+	}
+	if r.files == nil {
+		r.files = map[int]string{}
+	}
+	r.files[r.count] = fileName
+	return nil
+}
+
+// rawDump prints or saves the encoded form of each response message, given
+// via -dump-raw, in addition to the usual output, so that the bytes on the
+// wire can be compared with what another client sees.
+type rawDump struct {
+	// "hex" or "base64" if printed; empty if saved to files
+	encoding string
+	// the directory in which the files are saved
+	dir string
+	out io.Writer
+
+	mu sync.Mutex
+	// the encoded responses that were received but not yet handled
+	pending [][]byte
+	count   int
+	err     error
+}
+
+// parseRawDump parses an argument to -dump-raw, which must be 'hex',
+// 'base64', or 'file:' followed by the name of a directory.
+func parseRawDump(spec string) (*rawDump, error) {
+	switch {
+	case spec == "hex" || spec == "base64":
+		return &rawDump{encoding: spec}, nil
+	case strings.HasPrefix(spec, "file:"):
+		dir := strings.TrimPrefix(spec, "file:")
+		if dir == "" {
+			return nil, fmt.Errorf("%q does not name a directory", spec)
+		}
+		return &rawDump{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("%q must be 'hex', 'base64', or 'file:<dir>'", spec)
+	}
+}
+
+// codec returns a codec that records each response message before decoding
+// it using the given codec, or the proto codec if it is nil.
+func (d *rawDump) codec(base encoding.Codec) encoding.Codec {
+	if base == nil {
+		base = encoding.GetCodec("proto")
+	}
+	return rawDumpCodec{Codec: base, dump: d}
+}
+
+type rawDumpCodec struct {
+	encoding.Codec
+	dump *rawDump
+}
+
+func (c rawDumpCodec) Unmarshal(data []byte, v interface{}) error {
+	c.dump.mu.Lock()
+	// the buffer may be reused once this returns
+	c.dump.pending = append(c.dump.pending, append([]byte(nil), data...))
+	c.dump.mu.Unlock()
+	return c.Codec.Unmarshal(data, v)
+}
+
+// next prints or saves the earliest response that was recorded but not yet
+// handled.
+func (d *rawDump) next() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.pending) == 0 {
+		return
+	}
+	data := d.pending[0]
+	d.pending = d.pending[1:]
+	d.count++
+	switch d.encoding {
+	case "hex":
+		fmt.Fprintf(d.out, "Raw response %d (%d bytes): %s\n", d.count, len(data), hex.EncodeToString(data))
+	case "base64":
+		fmt.Fprintf(d.out, "Raw response %d (%d bytes): %s\n", d.count, len(data), base64.StdEncoding.EncodeToString(data))
+	default:
+		if d.err != nil {
+			return
+		}
+		fileName := filepath.Join(d.dir, fmt.Sprintf("resp-%d.bin", d.count))
+		if err := os.WriteFile(fileName, data, 0666); err != nil {
+			d.err = fmt.Errorf("failed to write response message %d: %v", d.count, err)
+		}
+	}
+}
+
+// rawDumpHandler prints or saves the encoded form of every response message
+// after it is handled as usual.
+type rawDumpHandler struct {
+	grpcurl.InvocationEventHandler
+	dump *rawDump
+}
+
+func (h rawDumpHandler) OnReceiveResponse(m proto.Message) {
+	h.InvocationEventHandler.OnReceiveResponse(m)
+	h.dump.next()
+}
+
+// teeEventHandler sends every event to two handlers.
+type teeEventHandler [2]grpcurl.InvocationEventHandler
+
+func (t teeEventHandler) OnResolveMethod(md *desc.MethodDescriptor) {
+	t[0].OnResolveMethod(md)
+	t[1].OnResolveMethod(md)
+}
+
+func (t teeEventHandler) OnSendHeaders(md metadata.MD) {
+	t[0].OnSendHeaders(md)
+	t[1].OnSendHeaders(md)
+}
+
+func (t teeEventHandler) OnReceiveHeaders(md metadata.MD) {
+	t[0].OnReceiveHeaders(md)
+	t[1].OnReceiveHeaders(md)
+}
+
+func (t teeEventHandler) OnReceiveResponse(resp proto.Message) {
+	t[0].OnReceiveResponse(resp)
+	t[1].OnReceiveResponse(resp)
+}
+
+func (t teeEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	t[0].OnReceiveTrailers(stat, md)
+	t[1].OnReceiveTrailers(stat, md)
+}
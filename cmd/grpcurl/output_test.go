@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestParseExtraOutput(t *testing.T) {
+	o, err := parseExtraOutput("ndjson=out/a=b.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.format != "ndjson" || o.fileName != "out/a=b.json" {
+		t.Errorf("wrong result: format %q, file %q", o.format, o.fileName)
+	}
+	for _, spec := range []string{"json", "=file", "json=", "xml=file"} {
+		if _, err := parseExtraOutput(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestExtraOutput(t *testing.T) {
+	dir := t.TempDir()
+	msgs := []*wrapperspb.StringValue{wrapperspb.String("abc"), wrapperspb.String("defg")}
+	testCases := []struct {
+		format, expected string
+	}{
+		{"ndjson", "\"abc\"\n\"defg\"\n"},
+		{"text", "value: \"abc\"\n\x1evalue: \"defg\"\n"},
+		{"binary", string(protowire.AppendVarint(nil, 5)) + "\n\x03abc" + string(protowire.AppendVarint(nil, 6)) + "\n\x04defg"},
+	}
+	for _, tc := range testCases {
+		fileName := filepath.Join(dir, tc.format)
+		o, err := parseExtraOutput(tc.format + "=" + fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.open(nil, grpcurl.FormatOptions{}); err != nil {
+			t.Fatalf("%s: failed to open: %v", tc.format, err)
+		}
+		for _, msg := range msgs {
+			if err := o.write(msg); err != nil {
+				t.Fatalf("%s: failed to write: %v", tc.format, err)
+			}
+		}
+		if err := o.close(); err != nil {
+			t.Fatalf("%s: failed to close: %v", tc.format, err)
+		}
+		actual, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.format, tc.expected, actual)
+		}
+	}
+}
+
+func TestResponseFilesHandler(t *testing.T) {
+	for _, pattern := range []string{"resp", "resp-%d-%d", "%s", "a/%d.json"} {
+		if err := checkOutputPattern(pattern); err == nil {
+			t.Errorf("%q: expected error", pattern)
+		}
+	}
+	if err := checkOutputPattern("resp-%03d.json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	h := &responseFilesHandler{
+		DefaultEventHandler: &grpcurl.DefaultEventHandler{Formatter: grpcurl.NewJSONFormatter(false, nil)},
+		dir:                 dir,
+		pattern:             "resp-%03d.json",
+	}
+	h.OnReceiveResponse(wrapperspb.String("abc"))
+	h.OnReceiveResponse(wrapperspb.String("def"))
+	if h.err != nil {
+		t.Fatalf("failed to write responses: %v", h.err)
+	}
+	if h.NumResponses != 2 {
+		t.Errorf("expected 2 responses, got %d", h.NumResponses)
+	}
+	for i, expected := range []string{"\"abc\"\n", "\"def\"\n"} {
+		actual, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("resp-%03d.json", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != expected {
+			t.Errorf("response #%d: expected %q, got %q", i+1, expected, actual)
+		}
+	}
+}
+
+func TestRawResponses(t *testing.T) {
+	dir := t.TempDir()
+	raw := &rawResponses{dir: dir, pattern: "resp-%03d.json", threshold: 8}
+	for pattern, expected := range map[string]string{
+		"resp-%03d.json": "resp-001.bin",
+		"resp-%d.txt":    "resp-1.bin",
+		"resp-%d":        "resp-1.bin",
+		"resp-%d.pb":     "resp-1.pb.bin",
+	} {
+		r := &rawResponses{dir: dir, pattern: pattern}
+		if actual := r.fileName(1); actual != filepath.Join(dir, expected) {
+			t.Errorf("%q: expected file %q, got %q", pattern, expected, actual)
+		}
+	}
+
+	codec := raw.codec(nil)
+	var msgs []*wrapperspb.StringValue
+	var large []byte
+	for _, s := range []string{"abc", "abcdefghij"} {
+		data, err := codec.Marshal(wrapperspb.String(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &wrapperspb.StringValue{}
+		if err := codec.Unmarshal(data, msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+		large = data
+	}
+	if msgs[0].GetValue() != "abc" || msgs[1].GetValue() != "" {
+		t.Errorf("expected only the small response to be decoded, got %q and %q", msgs[0].GetValue(), msgs[1].GetValue())
+	}
+
+	h := &responseFilesHandler{
+		DefaultEventHandler: &grpcurl.DefaultEventHandler{Formatter: grpcurl.NewJSONFormatter(false, nil)},
+		dir:                 dir,
+		pattern:             "resp-%03d.json",
+		raw:                 raw,
+	}
+	for _, msg := range msgs {
+		h.OnReceiveResponse(msg)
+	}
+	if h.err != nil {
+		t.Fatalf("failed to write responses: %v", h.err)
+	}
+	for name, expected := range map[string]string{
+		"resp-001.json": "\"abc\"\n",
+		"resp-002.bin":  string(large),
+	} {
+		actual, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, actual)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "resp-002.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no formatted file for the large response, got %v", err)
+	}
+}
+
+func TestRawDump(t *testing.T) {
+	for _, spec := range []string{"", "hex64", "file:", "dir"} {
+		if _, err := parseRawDump(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+
+	msgs := []proto.Message{wrapperspb.String("abc"), wrapperspb.String("")}
+	var encoded [][]byte
+	for _, m := range msgs {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, b)
+	}
+	receive := func(d *rawDump) string {
+		var out bytes.Buffer
+		d.out = &out
+		codec := d.codec(nil)
+		h := rawDumpHandler{
+			InvocationEventHandler: &grpcurl.DefaultEventHandler{Out: &out, Formatter: grpcurl.NewJSONFormatter(false, nil)},
+			dump:                   d,
+		}
+		for _, b := range encoded {
+			msg := &wrapperspb.StringValue{}
+			if err := codec.Unmarshal(b, msg); err != nil {
+				t.Fatal(err)
+			}
+			h.OnReceiveResponse(msg)
+		}
+		return out.String()
+	}
+
+	for spec, expected := range map[string]string{
+		"hex":    "\"abc\"\nRaw response 1 (5 bytes): 0a03616263\n\"\"\nRaw response 2 (0 bytes): \n",
+		"base64": "\"abc\"\nRaw response 1 (5 bytes): CgNhYmM=\n\"\"\nRaw response 2 (0 bytes): \n",
+	} {
+		d, err := parseRawDump(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := receive(d); actual != expected {
+			t.Errorf("%s: expected %q, got %q", spec, expected, actual)
+		}
+	}
+
+	dir := t.TempDir()
+	d, err := parseRawDump("file:" + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(d)
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	for i, expected := range encoded {
+		actual, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("resp-%d.bin", i+1)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(actual, expected) {
+			t.Errorf("response %d: expected %x, got %x", i+1, expected, actual)
+		}
+	}
+}
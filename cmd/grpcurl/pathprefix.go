@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// parsePathPrefix validates a -path-prefix argument, or the path of an
+// 'http://' or 'https://' address, and returns it without any trailing
+// slashes. An empty result means there is no prefix.
+func parsePathPrefix(prefix string) (string, error) {
+	if !strings.HasPrefix(prefix, "/") {
+		return "", fmt.Errorf("%q must start with '/'", prefix)
+	}
+	if strings.ContainsAny(prefix, "?# \t") {
+		return "", fmt.Errorf("%q must not contain a query, fragment, or whitespace", prefix)
+	}
+	return strings.TrimRight(prefix, "/"), nil
+}
+
+// withPathPrefix returns dial options that add the given prefix to the
+// HTTP/2 :path of every RPC, which grpc-go takes from the method's name. The
+// prefix applies to server reflection, as well as to the methods invoked, so
+// that a gateway that routes by path sends them all to the same server.
+func withPathPrefix(prefix string) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(ctx, prefix+method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(ctx, desc, cc, prefix+method, opts...)
+		}),
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	insecurecreds "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestParsePathPrefix(t *testing.T) {
+	testCases := map[string]string{
+		"/tenant-a":      "/tenant-a",
+		"/tenant-a/":     "/tenant-a",
+		"/api/tenant-a/": "/api/tenant-a",
+		"/":              "",
+	}
+	for prefix, expected := range testCases {
+		actual, err := parsePathPrefix(prefix)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", prefix, err)
+		} else if actual != expected {
+			t.Errorf("%q: expected %q, got %q", prefix, expected, actual)
+		}
+	}
+	for _, prefix := range []string{"tenant-a", "", "/tenant a", "/tenant?a"} {
+		if _, err := parsePathPrefix(prefix); err == nil {
+			t.Errorf("expected error for %q", prefix)
+		}
+	}
+}
+
+func TestWithPathPrefix(t *testing.T) {
+	// a server that records the :path of each RPC
+	paths := make(chan string, 2)
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		paths <- method
+		var req emptypb.Empty
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		return stream.SendMsg(&emptypb.Empty{})
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	defer svr.Stop()
+
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecurecreds.NewCredentials())}, withPathPrefix("/tenant-a")...)
+	cc, err := grpc.Dial(l.Addr().String(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	ctx := context.Background()
+	if err := cc.Invoke(ctx, "/foo.Bar/Unary", &emptypb.Empty{}, &emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if path := <-paths; path != "/tenant-a/foo.Bar/Unary" {
+		t.Errorf("expected unary path %q, got %q", "/tenant-a/foo.Bar/Unary", path)
+	}
+	stream, err := cc.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/foo.Bar/Stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		t.Fatal(err)
+	}
+	if path := <-paths; path != "/tenant-a/foo.Bar/Stream" {
+		t.Errorf("expected stream path %q, got %q", "/tenant-a/foo.Bar/Stream", path)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// spkiPin returns the pin of the given certificate, which is the SHA-256 hash
+// of its subject public key info. Unlike a fingerprint of the whole
+// certificate, it stays the same when the certificate is renewed with the
+// same key.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return fingerprintPrefix + hex.EncodeToString(sum[:])
+}
+
+// parsePin parses a -pinned-cert argument, which is 'sha256:' followed by the
+// hash in hex, as printed by grpcurl, or in base64, as used by HTTP public key
+// pinning and 'openssl ... | openssl base64'.
+func parsePin(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, fingerprintPrefix) {
+		return nil, fmt.Errorf("%q must start with %q", s, fingerprintPrefix)
+	}
+	s = strings.TrimPrefix(s, fingerprintPrefix)
+	if b, err := hex.DecodeString(strings.ReplaceAll(s, ":", "")); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == sha256.Size {
+		return b, nil
+	}
+	return nil, fmt.Errorf("%q is not a SHA-256 hash in hex or base64", s)
+}
+
+// errPinMismatch indicates that a server presented a certificate whose key
+// does not match any of the pins.
+var errPinMismatch = errors.New("server certificate does not match -pinned-cert")
+
+// verifyPinnedCert returns a function for use as tls.Config.VerifyConnection
+// that accepts the server's leaf certificate only if the hash of its public key
+// is one of the given pins. Other certificates in the chain are not checked,
+// since, without verifying the chain, the server could send any of them.
+func verifyPinnedCert(pins [][]byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		leaf := state.PeerCertificates[0]
+		sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if bytes.Equal(pin, sum[:]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: the certificate for %s has public key hash %s", errPinMismatch, leaf.Subject, spkiPin(leaf))
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	sum := sha256.Sum256([]byte("public key"))
+	for _, s := range []string{
+		"sha256:" + hex.EncodeToString(sum[:]),
+		"sha256:" + base64.StdEncoding.EncodeToString(sum[:]),
+	} {
+		pin, err := parsePin(s)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", s, err)
+		} else if string(pin) != string(sum[:]) {
+			t.Errorf("%s: wrong pin: %x", s, pin)
+		}
+	}
+	for _, s := range []string{
+		hex.EncodeToString(sum[:]),
+		"sha1:" + hex.EncodeToString(sum[:20]),
+		"sha256:" + hex.EncodeToString(sum[:20]),
+		"sha256:not a hash",
+	} {
+		if _, err := parsePin(s); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestVerifyPinnedCert(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("cert"), RawSubjectPublicKeyInfo: []byte("public key")}
+	other := &x509.Certificate{Raw: []byte("other"), RawSubjectPublicKeyInfo: []byte("other key")}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	otherSum := sha256.Sum256(other.RawSubjectPublicKeyInfo)
+
+	verify := verifyPinnedCert([][]byte{otherSum[:], sum[:]})
+	if err := verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); err != nil {
+		t.Errorf("pinned certificate should be accepted: %v", err)
+	}
+	// only the leaf is checked, not the rest of the chain
+	verify = verifyPinnedCert([][]byte{otherSum[:]})
+	err := verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert, other}})
+	if !errors.Is(err, errPinMismatch) {
+		t.Errorf("certificate should be rejected, got %v", err)
+	}
+	if err := verify(tls.ConnectionState{}); err == nil {
+		t.Error("missing certificate should be rejected")
+	}
+}
@@ -0,0 +1,278 @@
+//go:build cgo
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// pkcs11Supported is true since this build can load PKCS#11 modules.
+const pkcs11Supported = true
+
+// loadPKCS11Key returns a client certificate whose private key is in the
+// PKCS#11 token named by the given -key-provider URI. The key never leaves
+// the token: the TLS handshake asks the token to sign with it. The
+// certificate is read from the given file or, if the name is empty, from the
+// token, where it must have the same label or ID as the key.
+func loadPKCS11Key(uri, certFile string) (tls.Certificate, error) {
+	u, err := parsePKCS11URI(uri)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	ctx := pkcs11.New(u.modulePath)
+	if ctx == nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load PKCS#11 module %s", u.modulePath)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to initialize PKCS#11 module %s: %w", u.modulePath, err)
+	}
+	slot, loginRequired, err := findPKCS11Slot(ctx, u)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to open PKCS#11 session: %w", err)
+	}
+	if loginRequired {
+		if u.pin == "" {
+			return tls.Certificate{}, errors.New("the token requires a PIN; provide it with the pin-value or pin-source query attribute")
+		}
+		err := ctx.Login(session, pkcs11.CKU_USER, u.pin)
+		if err != nil && !errors.Is(err, pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN)) {
+			return tls.Certificate{}, fmt.Errorf("failed to log in to token: %w", err)
+		}
+	}
+
+	key, err := findPKCS11Object(ctx, session, u, pkcs11.CKO_PRIVATE_KEY)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to find private key: %w", err)
+	}
+
+	var certChain [][]byte
+	if certFile != "" {
+		certChain, err = readCertChain(certFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+	} else {
+		certObj, err := findPKCS11Object(ctx, session, u, pkcs11.CKO_CERTIFICATE)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to find certificate: %w", err)
+		}
+		attrs, err := ctx.GetAttributeValue(session, certObj, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil)})
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to read certificate: %w", err)
+		}
+		certChain = [][]byte{attrs[0].Value}
+	}
+	leaf, err := x509.ParseCertificate(certChain[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	signer := &pkcs11Signer{ctx: ctx, session: session, key: key, pub: leaf.PublicKey}
+	switch leaf.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return tls.Certificate{}, fmt.Errorf("unsupported key type %T", leaf.PublicKey)
+	}
+	return tls.Certificate{Certificate: certChain, PrivateKey: signer, Leaf: leaf}, nil
+}
+
+// readCertChain reads the PEM-encoded certificates in the given file.
+func readCertChain(fileName string) ([][]byte, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var chain [][]byte
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%s does not contain a PEM-encoded certificate", fileName)
+	}
+	return chain, nil
+}
+
+// findPKCS11Slot returns the slot of the token that matches the URI, and
+// whether the token requires logging in.
+func findPKCS11Slot(ctx *pkcs11.Ctx, u *pkcs11URI) (uint, bool, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list PKCS#11 slots: %w", err)
+	}
+	for _, slot := range slots {
+		if u.slotID != nil && *u.slotID != slot {
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get info of token in slot %d: %w", slot, err)
+		}
+		if matchPKCS11Attr(u.token, info.Label) && matchPKCS11Attr(u.manufacturer, info.ManufacturerID) &&
+			matchPKCS11Attr(u.model, info.Model) && matchPKCS11Attr(u.serial, info.SerialNumber) {
+			return slot, info.Flags&pkcs11.CKF_LOGIN_REQUIRED != 0, nil
+		}
+	}
+	return 0, false, errors.New("no matching PKCS#11 token found")
+}
+
+// matchPKCS11Attr reports whether a token's attribute, which is padded with
+// spaces, matches the one in the URI. An attribute not in the URI matches
+// any value.
+func matchPKCS11Attr(want, got string) bool {
+	return want == "" || want == strings.TrimRight(got, " \x00")
+}
+
+// findPKCS11Object returns the object of the given class that has the label
+// and ID in the URI.
+func findPKCS11Object(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, u *pkcs11URI, class uint) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if u.object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, u.object))
+	}
+	if u.id != nil {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, u.id))
+	}
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		return 0, err
+	}
+	objs, _, err := ctx.FindObjects(session, 2)
+	if finalErr := ctx.FindObjectsFinal(session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch len(objs) {
+	case 0:
+		return 0, errors.New("no matching object in token")
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, errors.New("more than one matching object in token")
+	}
+}
+
+// pkcs11Signer signs with a private key in a PKCS#11 token. A session can
+// only perform one operation at a time, so signing is serialized.
+type pkcs11Signer struct {
+	mu      sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	pub     crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mech *pkcs11.Mechanism
+	data := digest
+	switch pub := s.pub.(type) {
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			params, err := pkcs11PSSParams(pub, opts.HashFunc(), pssOpts.SaltLength)
+			if err != nil {
+				return nil, err
+			}
+			mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params)
+		} else {
+			prefix, ok := pkcs1DigestInfoPrefixes[opts.HashFunc()]
+			if !ok {
+				return nil, fmt.Errorf("unsupported hash function %v", opts.HashFunc())
+			}
+			data = append(append([]byte{}, prefix...), digest...)
+			mech = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		}
+	case *ecdsa.PublicKey:
+		mech = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{mech}, s.key); err != nil {
+		return nil, fmt.Errorf("failed to sign with PKCS#11 key: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign with PKCS#11 key: %w", err)
+	}
+	if _, ok := s.pub.(*ecdsa.PublicKey); ok {
+		// PKCS#11 returns r and s concatenated; TLS wants them ASN.1 encoded
+		return ecdsaASN1Signature(sig)
+	}
+	return sig, nil
+}
+
+// pkcs1DigestInfoPrefixes are the DER prefixes of the DigestInfo structures
+// that are signed for PKCS#1 v1.5 signatures, which the CKM_RSA_PKCS mechanism
+// expects to be included.
+var pkcs1DigestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+func pkcs11PSSParams(pub *rsa.PublicKey, hash crypto.Hash, saltLength int) ([]byte, error) {
+	var hashMech, mgf uint
+	switch hash {
+	case crypto.SHA256:
+		hashMech, mgf = pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256
+	case crypto.SHA384:
+		hashMech, mgf = pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384
+	case crypto.SHA512:
+		hashMech, mgf = pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512
+	default:
+		return nil, fmt.Errorf("unsupported hash function %v", hash)
+	}
+	switch saltLength {
+	case rsa.PSSSaltLengthEqualsHash:
+		saltLength = hash.Size()
+	case rsa.PSSSaltLengthAuto:
+		saltLength = (pub.N.BitLen()-1+7)/8 - 2 - hash.Size()
+	}
+	return pkcs11.NewPSSParams(hashMech, mgf, uint(saltLength)), nil
+}
+
+func ecdsaASN1Signature(sig []byte) ([]byte, error) {
+	if len(sig) == 0 || len(sig)%2 != 0 {
+		return nil, fmt.Errorf("invalid ECDSA signature of length %d", len(sig))
+	}
+	r := new(big.Int).SetBytes(sig[:len(sig)/2])
+	s := new(big.Int).SetBytes(sig[len(sig)/2:])
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+	return b.Bytes()
+}
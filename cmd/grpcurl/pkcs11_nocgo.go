@@ -0,0 +1,21 @@
+//go:build !cgo
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+)
+
+// pkcs11Supported is false since cgo is needed to load PKCS#11 modules. The
+// -key-provider flag is then left out of the usage.
+const pkcs11Supported = false
+
+// loadPKCS11Key is not supported without cgo, which is needed to load the
+// PKCS#11 module.
+func loadPKCS11Key(uri, certFile string) (tls.Certificate, error) {
+	if _, err := parsePKCS11URI(uri); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{}, errors.New("this build of grpcurl does not support PKCS#11; it must be built with cgo enabled (CGO_ENABLED=1)")
+}
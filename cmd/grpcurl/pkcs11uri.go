@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pkcs11URI identifies a private key in a PKCS#11 token, for -key-provider.
+// It is a URI in the form of RFC 7512, like
+// 'pkcs11:token=mytoken;object=mykey?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234'.
+type pkcs11URI struct {
+	// attributes that select the token; empty ones match any token
+	token, manufacturer, model, serial string
+	slotID                             *uint
+	// attributes that select the key, and the certificate; at least one is
+	// present
+	object string
+	id     []byte
+
+	modulePath string
+	pin        string
+}
+
+// parsePKCS11URI parses the given -key-provider argument. The module-path
+// query attribute is required. The PIN may be given with the pin-value
+// attribute, or read from a file named by the pin-source attribute.
+func parsePKCS11URI(s string) (*pkcs11URI, error) {
+	if !strings.HasPrefix(s, "pkcs11:") {
+		return nil, fmt.Errorf("%q is not a pkcs11: URI", s)
+	}
+	s = strings.TrimPrefix(s, "pkcs11:")
+	path, query, _ := strings.Cut(s, "?")
+
+	var u pkcs11URI
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		name, value, err := pkcs11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "token":
+			u.token = value
+		case "manufacturer":
+			u.manufacturer = value
+		case "model":
+			u.model = value
+		case "serial":
+			u.serial = value
+		case "slot-id":
+			id, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slot-id %q", value)
+			}
+			slotID := uint(id)
+			u.slotID = &slotID
+		case "object":
+			u.object = value
+		case "id":
+			u.id = []byte(value)
+		case "type":
+			if value != "private" && value != "cert" {
+				return nil, fmt.Errorf("unsupported object type %q", value)
+			}
+		case "library-description", "library-manufacturer", "library-version", "slot-description", "slot-manufacturer":
+			// these only narrow down which token is used; the module path
+			// and the token attributes are enough to find it
+		default:
+			return nil, fmt.Errorf("unsupported attribute %q", name)
+		}
+	}
+
+	var pinSource string
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		name, value, err := pkcs11Attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "module-path":
+			u.modulePath = value
+		case "pin-value":
+			u.pin = value
+		case "pin-source":
+			pinSource = value
+		default:
+			return nil, fmt.Errorf("unsupported query attribute %q", name)
+		}
+	}
+
+	if u.modulePath == "" {
+		return nil, fmt.Errorf("the module-path query attribute is required")
+	}
+	if u.object == "" && u.id == nil {
+		return nil, fmt.Errorf("the object or id attribute is required")
+	}
+	if pinSource != "" {
+		if u.pin != "" {
+			return nil, fmt.Errorf("pin-value and pin-source cannot both be present")
+		}
+		pinSource = strings.TrimPrefix(pinSource, "file:")
+		b, err := os.ReadFile(pinSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PIN: %w", err)
+		}
+		u.pin = strings.TrimRight(string(b), "\r\n")
+	}
+	return &u, nil
+}
+
+// pkcs11Attribute splits an attribute of a pkcs11: URI into its name and its
+// percent-decoded value.
+func pkcs11Attribute(attr string) (string, string, error) {
+	name, value, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("attribute %q has no value", attr)
+	}
+	value, err := url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("attribute %q: %w", name, err)
+	}
+	return name, value, nil
+}
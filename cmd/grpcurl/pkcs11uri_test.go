@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	if err := os.WriteFile(pinFile, []byte("5678\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := parsePKCS11URI("pkcs11:token=my%20token;object=client;id=%01%02;slot-id=3?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.token != "my token" || u.object != "client" || !bytes.Equal(u.id, []byte{1, 2}) {
+		t.Errorf("unexpected attributes: %+v", u)
+	}
+	if u.slotID == nil || *u.slotID != 3 {
+		t.Errorf("unexpected slot-id: %v", u.slotID)
+	}
+	if u.modulePath != "/usr/lib/softhsm/libsofthsm2.so" || u.pin != "1234" {
+		t.Errorf("unexpected query attributes: %+v", u)
+	}
+
+	u, err = parsePKCS11URI("pkcs11:object=client;type=private?module-path=lib.so&pin-source=file:" + pinFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.pin != "5678" {
+		t.Errorf("expected PIN from pin-source, got %q", u.pin)
+	}
+
+	for _, bad := range []string{
+		"token=foo;object=client?module-path=lib.so",
+		"pkcs11:object=client",
+		"pkcs11:token=foo?module-path=lib.so",
+		"pkcs11:object=client;color=blue?module-path=lib.so",
+		"pkcs11:object=client;slot-id=x?module-path=lib.so",
+		"pkcs11:object=client?module-path=lib.so&pin-value=1&pin-source=" + pinFile,
+		"pkcs11:object=%zz?module-path=lib.so",
+	} {
+		if _, err := parsePKCS11URI(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// propagatedDeadline returns the deadline given in seconds by the named
+// environment variable, via -propagate-deadline-from. This is typically the
+// time remaining for a server handler on whose behalf grpcurl is being run.
+// It returns false if the variable is not set or is empty.
+func propagatedDeadline(envVar string) (time.Duration, bool, error) {
+	val := strings.TrimSpace(os.Getenv(envVar))
+	if val == "" {
+		return 0, false, nil
+	}
+	secs, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("$%s is not a number of seconds: %q", envVar, val)
+	}
+	if secs < 0 {
+		// deadline has already passed
+		secs = 0
+	}
+	return floatSecondsToDuration(secs), true, nil
+}
+
+// propagatedHeaders returns headers, in "name: value" form, for the metadata
+// keys given via -propagate-metadata. Each entry in the comma-separated list
+// is either a key, whose value is read from the environment variable with the
+// same name in upper case and with dashes replaced by underscores (so
+// "x-request-id" is read from $X_REQUEST_ID), or is in "key=VAR" form to name
+// the variable explicitly. Keys whose variables are not set are skipped.
+func propagatedHeaders(spec string) ([]string, error) {
+	var headers []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, envVar := entry, ""
+		if pos := strings.IndexByte(entry, '='); pos >= 0 {
+			key, envVar = strings.TrimSpace(entry[:pos]), strings.TrimSpace(entry[pos+1:])
+			if key == "" || envVar == "" {
+				return nil, fmt.Errorf("%q should be in 'key' or 'key=VAR' form", entry)
+			}
+		} else {
+			envVar = strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		}
+		if val, ok := os.LookupEnv(envVar); ok {
+			headers = append(headers, fmt.Sprintf("%s: %s", strings.ToLower(key), val))
+		}
+	}
+	return headers, nil
+}
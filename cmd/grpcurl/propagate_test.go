@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPropagatedDeadline(t *testing.T) {
+	t.Setenv("GRPCURL_TEST_DEADLINE", "1.5")
+	d, ok, err := propagatedDeadline("GRPCURL_TEST_DEADLINE")
+	if err != nil || !ok || d != 1500*time.Millisecond {
+		t.Errorf("wrong result: %v, %v, %v", d, ok, err)
+	}
+
+	t.Setenv("GRPCURL_TEST_DEADLINE", "-2")
+	d, ok, err = propagatedDeadline("GRPCURL_TEST_DEADLINE")
+	if err != nil || !ok || d != 0 {
+		t.Errorf("wrong result for expired deadline: %v, %v, %v", d, ok, err)
+	}
+
+	t.Setenv("GRPCURL_TEST_DEADLINE", "")
+	if _, ok, err = propagatedDeadline("GRPCURL_TEST_DEADLINE"); err != nil || ok {
+		t.Errorf("wrong result for unset deadline: %v, %v", ok, err)
+	}
+
+	t.Setenv("GRPCURL_TEST_DEADLINE", "soon")
+	if _, _, err = propagatedDeadline("GRPCURL_TEST_DEADLINE"); err == nil {
+		t.Error("expected error for invalid deadline")
+	}
+}
+
+func TestPropagatedHeaders(t *testing.T) {
+	t.Setenv("TRACEPARENT", "00-abc-def-01")
+	t.Setenv("X_REQUEST_ID", "123")
+	t.Setenv("MY_TENANT", "acme")
+	headers, err := propagatedHeaders("traceparent, X-Request-Id,x-missing-key,x-tenant=MY_TENANT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"traceparent: 00-abc-def-01", "x-request-id: 123", "x-tenant: acme"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("expected %v, got %v", expected, headers)
+	}
+	for _, spec := range []string{"=FOO", "foo="} {
+		if _, err := propagatedHeaders(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
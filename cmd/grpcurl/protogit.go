@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// protoGitRepo is a git repository of proto sources, given via -proto-git
+// like 'https://github.com/org/protos.git#ref=main&path=proto/'.
+type protoGitRepo struct {
+	url string
+	// the branch, tag, or commit to use; the default branch if empty
+	ref string
+	// the directory, relative to the root of the repository, that contains
+	// the protos and is used as an import path
+	path string
+}
+
+// parseProtoGitURL parses a -proto-git argument. The ref and path attributes
+// of the fragment are optional.
+func parseProtoGitURL(s string) (*protoGitRepo, error) {
+	repoURL, fragment, _ := strings.Cut(s, "#")
+	if repoURL == "" {
+		return nil, fmt.Errorf("%q has no repository URL", s)
+	}
+	attrs, err := url.ParseQuery(fragment)
+	if err != nil {
+		return nil, fmt.Errorf("%q has an invalid fragment: %w", s, err)
+	}
+	repo := &protoGitRepo{url: repoURL}
+	for name, values := range attrs {
+		switch name {
+		case "ref":
+			repo.ref = values[len(values)-1]
+		case "path":
+			repo.path = path.Clean(values[len(values)-1])
+			if path.IsAbs(repo.path) || repo.path == ".." || strings.HasPrefix(repo.path, "../") {
+				return nil, fmt.Errorf("%q: path must be relative to the root of the repository", s)
+			}
+		default:
+			return nil, fmt.Errorf("%q: unsupported attribute %q; expecting 'ref' or 'path'", s, name)
+		}
+	}
+	return repo, nil
+}
+
+// checkout fetches the ref, and only its latest commit, into the given
+// directory, which is a clone of the repository from a previous run or is
+// created.
+func (r *protoGitRepo) checkout(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := runGit(dir, "init", "-q"); err != nil {
+			return err
+		}
+		if err := runGit(dir, "remote", "add", "origin", r.url); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	ref := r.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := runGit(dir, "fetch", "-q", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+	return runGit(dir, "checkout", "-q", "--force", "FETCH_HEAD")
+}
+
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// loadProtoGitSource returns a descriptor source for the protos in the
+// repository given via -proto-git. The repository is cloned into the user's
+// cache directory, so that later runs only fetch what changed. The given
+// files or patterns, which are relative to the repository's path, are
+// compiled or, if there are none, all proto files found in that path, less
+// those that match the given exclude patterns. Any other import paths are
+// searched after the repository's path.
+func loadProtoGitSource(s string, importPaths, files, excludes []string) (grpcurl.DescriptorSource, error) {
+	repo, err := parseProtoGitURL(s)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(repo.url))
+	dir := filepath.Join(cacheDir, "grpcurl", "git", hex.EncodeToString(sum[:8]))
+	if err := repo.checkout(dir); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", repo.url, err)
+	}
+
+	root := filepath.Join(dir, filepath.FromSlash(repo.path))
+	if len(files) == 0 {
+		files = []string{"**/*.proto"}
+	}
+	files, err = expandProtoFiles([]string{root}, files, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s, err)
+	}
+	return grpcurl.DescriptorSourceFromProtoFiles(append([]string{root}, importPaths...), files...)
+}
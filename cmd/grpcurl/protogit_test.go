@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+)
+
+func TestParseProtoGitURL(t *testing.T) {
+	repo, err := parseProtoGitURL("https://github.com/org/protos.git#ref=main&path=proto/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.url != "https://github.com/org/protos.git" || repo.ref != "main" || repo.path != "proto" {
+		t.Errorf("unexpected result: %+v", repo)
+	}
+	repo, err = parseProtoGitURL("git@github.com:org/protos.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.url != "git@github.com:org/protos.git" || repo.ref != "" || repo.path != "" {
+		t.Errorf("unexpected result: %+v", repo)
+	}
+
+	for _, s := range []string{
+		"#ref=main",
+		"https://github.com/org/protos.git#branch=main",
+		"https://github.com/org/protos.git#path=../other",
+		"https://github.com/org/protos.git#path=/etc",
+	} {
+		if _, err := parseProtoGitURL(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestLoadProtoGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// keep the clone out of the user's real cache directory
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	repoDir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if err := runGit(repoDir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	writeFile("proto/acme/v1/types.proto", `syntax = "proto3";
+package acme.v1;
+message Item { string id = 1; }
+`)
+	writeFile("proto/acme/v1/api.proto", `syntax = "proto3";
+package acme.v1;
+import "acme/v1/types.proto";
+service ItemService { rpc Get(Item) returns (Item); }
+`)
+	git("add", "-A")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+	writeFile("proto/acme/v1/api.proto", `syntax = "proto3";
+package acme.v1;
+import "acme/v1/types.proto";
+service ItemService { rpc Get(Item) returns (Item); rpc Delete(Item) returns (Item); }
+`)
+	git("commit", "-q", "-am", "v2")
+
+	url := "file://" + filepath.ToSlash(repoDir)
+	methods := func(s string, files ...string) int {
+		t.Helper()
+		source, err := loadProtoGitSource(s, nil, files, nil)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", s, err)
+		}
+		d, err := source.FindSymbol("acme.v1.ItemService")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(d.(*desc.ServiceDescriptor).GetMethods())
+	}
+	if n := methods(url + "#path=proto"); n != 2 {
+		t.Errorf("expected 2 methods at the default branch, got %d", n)
+	}
+	// the clone is reused, and the ref is checked out
+	if n := methods(url + "#ref=v1&path=proto"); n != 1 {
+		t.Errorf("expected 1 method at the tag, got %d", n)
+	}
+	if n := methods(url+"#ref=main&path=proto/", "acme/v1/api.proto"); n != 2 {
+		t.Errorf("expected 2 methods at the branch, got %d", n)
+	}
+
+	if _, err := loadProtoGitSource(url+"#ref=nonexistent", nil, nil, nil); err == nil {
+		t.Error("expected error for unknown ref")
+	}
+	// without the path, the imports cannot be resolved
+	if _, err := loadProtoGitSource(url, nil, nil, nil); err == nil {
+		t.Error("expected error for wrong path")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// isGlob reports whether the given -proto or -import-path argument is a glob
+// pattern, instead of a name.
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// matchGlob reports whether the given slash-separated name matches the given
+// pattern. Each element of the pattern is matched like path.Match, except
+// that an element of '**' matches any number of elements, including none.
+func matchGlob(pattern, name string) (bool, error) {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(name); i >= 0; i-- {
+				if ok, err := matchGlobElems(pattern[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		if ok, err := path.Match(pattern[0], name[0]); !ok || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// globBase returns the leading elements of the given pattern that have no
+// wildcards, which is the directory to search for matches.
+func globBase(pattern string) string {
+	elems := strings.Split(pattern, "/")
+	for i, elem := range elems {
+		if isGlob(elem) {
+			return strings.Join(elems[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// globFiles returns the names of the files or, if dirs is true, directories
+// under the given root whose names relative to the root match the given
+// pattern. The names are relative to the root and sorted.
+func globFiles(root, pattern string, dirs bool) ([]string, error) {
+	pattern = path.Clean(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%q: %w", pattern, err)
+	}
+	base := globBase(pattern)
+	start := filepath.Join(root, filepath.FromSlash(base))
+	if _, err := os.Stat(start); os.IsNotExist(err) {
+		return nil, nil
+	}
+	var matches []string
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() != dirs {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ok, err := matchGlob(pattern, rel); err != nil {
+			return err
+		} else if ok {
+			matches = append(matches, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// expandImportPaths returns the given -import-path arguments with any glob
+// patterns replaced by the directories they match.
+func expandImportPaths(patterns []string) ([]string, error) {
+	var paths []string
+	for _, p := range patterns {
+		if !isGlob(p) {
+			paths = append(paths, p)
+			continue
+		}
+		pattern := filepath.ToSlash(p)
+		root := "."
+		if path.IsAbs(pattern) || filepath.VolumeName(p) != "" {
+			// match the pattern relative to its base, which is absolute
+			root = filepath.FromSlash(globBase(pattern))
+			pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, globBase(pattern)), "/")
+		}
+		dirs, err := globFiles(root, pattern, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(dirs) == 0 {
+			return nil, fmt.Errorf("no directories match %q", p)
+		}
+		for _, dir := range dirs {
+			paths = append(paths, filepath.Join(root, filepath.FromSlash(dir)))
+		}
+	}
+	return paths, nil
+}
+
+// expandProtoFiles returns the given -proto arguments with any glob patterns
+// replaced by the names of the files they match. Like the names of proto
+// files, patterns are relative to the given import paths, or to the current
+// directory if there are none. Files that match any of the given exclude
+// patterns are omitted.
+func expandProtoFiles(importPaths, patterns, excludes []string) ([]string, error) {
+	roots := importPaths
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	excluded := func(name string) (bool, error) {
+		for _, exclude := range excludes {
+			if ok, err := matchGlob(filepath.ToSlash(exclude), name); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		var names []string
+		if !isGlob(p) {
+			names = []string{p}
+		} else {
+			for _, root := range roots {
+				matches, err := globFiles(root, filepath.ToSlash(p), false)
+				if err != nil {
+					return nil, err
+				}
+				names = append(names, matches...)
+			}
+			if len(names) == 0 {
+				return nil, fmt.Errorf("no files match %q", p)
+			}
+		}
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if ok, err := excluded(filepath.ToSlash(name)); err != nil {
+				return nil, err
+			} else if !ok {
+				files = append(files, name)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("all proto files are excluded by -proto-exclude")
+	}
+	return files, nil
+}
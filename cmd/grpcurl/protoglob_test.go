@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	testCases := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.proto", "a.proto", true},
+		{"*.proto", "api/a.proto", false},
+		{"api/**/*.proto", "api/a.proto", true},
+		{"api/**/*.proto", "api/v1/b/a.proto", true},
+		{"api/**/*.proto", "other/a.proto", false},
+		{"**/internal/*.proto", "api/v1/internal/a.proto", true},
+		{"**/internal/*.proto", "internal/a.proto", true},
+		{"**", "api/a.proto", true},
+		{"api/v?/*.proto", "api/v1/a.proto", true},
+		{"api/v[2-9]/*.proto", "api/v1/a.proto", false},
+	}
+	for _, tc := range testCases {
+		match, err := matchGlob(tc.pattern, tc.name)
+		if err != nil {
+			t.Errorf("%s: %v", tc.pattern, err)
+		} else if match != tc.match {
+			t.Errorf("matchGlob(%q, %q) = %v, expected %v", tc.pattern, tc.name, match, tc.match)
+		}
+	}
+	if _, err := matchGlob("api/[", "api/a"); err == nil {
+		t.Error("expected error for bad pattern")
+	}
+}
+
+func TestExpandProtoFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"protos/acme/v1/api.proto",
+		"protos/acme/v1/internal/debug.proto",
+		"protos/acme/v2/api.proto",
+		"protos/acme/README.md",
+		"vendor/foo/proto/foo.proto",
+		"vendor/bar/proto/bar.proto",
+	} {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := expandImportPaths([]string{filepath.Join(dir, "protos"), filepath.Join(dir, "vendor/*/proto")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "protos"), filepath.Join(dir, "vendor/bar/proto"), filepath.Join(dir, "vendor/foo/proto")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected import paths %v, got %v", expected, paths)
+	}
+	if _, err := expandImportPaths([]string{filepath.Join(dir, "nothing/*")}); err == nil {
+		t.Error("expected error for pattern without matches")
+	}
+
+	files, err := expandProtoFiles(paths, []string{"acme/**/*.proto", "foo.proto"}, []string{"**/internal/*.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"acme/v1/api.proto", "acme/v2/api.proto", "foo.proto"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+	// matches from every import path are used, but only once
+	files, err = expandProtoFiles(paths, []string{"*.proto", "bar.proto"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"bar.proto", "foo.proto"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+
+	if _, err := expandProtoFiles(paths, []string{"acme/*.proto"}, nil); err == nil {
+		t.Error("expected error for pattern without matches")
+	}
+	if _, err := expandProtoFiles(paths, []string{"acme/v1/api.proto"}, []string{"acme/**"}); err == nil {
+		t.Error("expected error when all files are excluded")
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// newProtoscopeFormatter returns a formatter for '-format-out protoscope',
+// which prints the wire form of each message in the protoscope language: one
+// line per field, with its number and its value, which is annotated with the
+// field's name. Since values are read from the encoded message, they are shown
+// as they were sent, even if the descriptor of the message is stale. Fields
+// that are not in the descriptor are only included if keepUnknown is true.
+//
+// See https://github.com/protocolbuffers/protoscope for the language.
+func newProtoscopeFormatter(keepUnknown bool) grpcurl.Formatter {
+	return func(m proto.Message) (string, error) {
+		var md *desc.MessageDescriptor
+		if dm, ok := m.(*dynamic.Message); ok {
+			md = dm.GetMessageDescriptor()
+		} else if d, err := desc.LoadMessageDescriptorForMessage(m); err == nil {
+			md = d
+		}
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return "", err
+		}
+		p := protoscopePrinter{keepUnknown: keepUnknown}
+		if err := p.message(b, md, 0); err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(p.buf.String(), "\n"), nil
+	}
+}
+
+type protoscopePrinter struct {
+	keepUnknown bool
+	buf         bytes.Buffer
+}
+
+// message prints the fields of the given encoded message, which is described
+// by md, or is unknown if md is nil, with the given indentation.
+func (p *protoscopePrinter) message(b []byte, md *desc.MessageDescriptor, indent int) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("invalid message: %w", protowire.ParseError(n))
+		}
+		tagLen := n
+		if typ == protowire.EndGroupType {
+			return fmt.Errorf("invalid message: unexpected end of group %d", num)
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b[tagLen:])
+		if n < 0 {
+			return fmt.Errorf("invalid message: %w", protowire.ParseError(n))
+		}
+		value := b[tagLen : tagLen+n]
+		b = b[tagLen+n:]
+
+		var fd *desc.FieldDescriptor
+		if md != nil {
+			fd = md.FindFieldByNumber(int32(num))
+		}
+		if fd == nil && md != nil && !p.keepUnknown {
+			continue
+		}
+		if err := p.field(num, typ, value, fd, md != nil, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field prints a field whose value has the given encoding. If fd is nil, the
+// field is unknown, and it is annotated as such if inKnownMessage is true.
+func (p *protoscopePrinter) field(num protowire.Number, typ protowire.Type, value []byte, fd *desc.FieldDescriptor, inKnownMessage bool, indent int) error {
+	comment := ""
+	if fd != nil {
+		comment = fd.GetName()
+	} else if inKnownMessage {
+		comment = "unknown field"
+	}
+	prefix := fmt.Sprintf("%s%d: ", strings.Repeat("  ", indent), num)
+
+	var nested *desc.MessageDescriptor
+	open, close := "{", "}"
+	switch typ {
+	case protowire.StartGroupType:
+		v, _ := protowire.ConsumeGroup(num, value)
+		value, open = v, "!{"
+		if fd != nil {
+			nested = fd.GetMessageType()
+		}
+	case protowire.BytesType:
+		v, _ := protowire.ConsumeBytes(value)
+		switch {
+		case fd != nil && fd.GetMessageType() != nil:
+			value, nested = v, fd.GetMessageType()
+		case fd != nil && fd.IsRepeated() && fd.GetType() != descriptorpb.FieldDescriptorProto_TYPE_STRING && fd.GetType() != descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+			packed, err := protoscopePacked(v, fd)
+			if err != nil {
+				return err
+			}
+			p.line(prefix+"{"+packed+"}", comment)
+			return nil
+		case fd != nil && fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING:
+			p.line(prefix+"{"+protoscopeString(v)+"}", comment)
+			return nil
+		case fd != nil || !looksLikeMessage(v):
+			p.line(prefix+"{"+protoscopeBytes(v)+"}", comment)
+			return nil
+		default:
+			// an unknown field that can be parsed as a message, which it
+			// most likely is
+			value = v
+		}
+	default:
+		str, note := protoscopeScalar(typ, value, fd)
+		if note != "" {
+			comment += ": " + note
+		}
+		p.line(prefix+str, comment)
+		return nil
+	}
+
+	if len(value) == 0 {
+		p.line(prefix+open+close, comment)
+		return nil
+	}
+	p.line(prefix+open, comment)
+	if err := p.message(value, nested, indent+1); err != nil {
+		return err
+	}
+	p.buf.WriteString(strings.Repeat("  ", indent) + close + "\n")
+	return nil
+}
+
+func (p *protoscopePrinter) line(text, comment string) {
+	p.buf.WriteString(text)
+	if comment != "" {
+		p.buf.WriteString("  # " + comment)
+	}
+	p.buf.WriteByte('\n')
+}
+
+// protoscopeScalar returns the value of a varint, 32-bit, or 64-bit field,
+// interpreted according to fd if it is not nil, and a note about the value,
+// which for an enum is the name of the value.
+func protoscopeScalar(typ protowire.Type, value []byte, fd *desc.FieldDescriptor) (string, string) {
+	var t descriptorpb.FieldDescriptorProto_Type
+	if fd != nil {
+		t = fd.GetType()
+	}
+	switch typ {
+	case protowire.VarintType:
+		v, _ := protowire.ConsumeVarint(value)
+		switch t {
+		case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+			if v <= 1 {
+				return strconv.FormatBool(v == 1), ""
+			}
+		case descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+			return strconv.FormatInt(protowire.DecodeZigZag(v), 10) + "z", ""
+		case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_INT64:
+			return strconv.FormatInt(int64(v), 10), ""
+		case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+			str := strconv.FormatInt(int64(v), 10)
+			if ev := fd.GetEnumType().FindValueByNumber(int32(v)); ev != nil {
+				return str, ev.GetName()
+			}
+			return str, ""
+		}
+		return strconv.FormatUint(v, 10), ""
+	case protowire.Fixed32Type:
+		v, _ := protowire.ConsumeFixed32(value)
+		switch t {
+		case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+			return protoscopeFloat(float64(math.Float32frombits(v)), 32), ""
+		case descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+			return strconv.FormatInt(int64(int32(v)), 10) + "i32", ""
+		}
+		return strconv.FormatUint(uint64(v), 10) + "i32", ""
+	case protowire.Fixed64Type:
+		v, _ := protowire.ConsumeFixed64(value)
+		switch t {
+		case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+			return protoscopeFloat(math.Float64frombits(v), 64), ""
+		case descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+			return strconv.FormatInt(int64(v), 10) + "i64", ""
+		}
+		return strconv.FormatUint(v, 10) + "i64", ""
+	}
+	return "", ""
+}
+
+// protoscopeFloat returns a floating point literal of the given width.
+// Literals are 64-bit unless they have an 'i32' suffix, but infinities and
+// NaN always have their width as a suffix, like 'inf32'.
+func protoscopeFloat(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf" + strconv.Itoa(bits)
+	case math.IsInf(f, -1):
+		return "-inf" + strconv.Itoa(bits)
+	case math.IsNaN(f):
+		return "nan" + strconv.Itoa(bits)
+	}
+	str := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(str, ".e") {
+		str += ".0"
+	}
+	if bits == 32 {
+		str += "i32"
+	}
+	return str
+}
+
+// protoscopePacked returns the elements of a packed repeated field, separated
+// by spaces.
+func protoscopePacked(b []byte, fd *desc.FieldDescriptor) (string, error) {
+	typ := protowire.VarintType
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		typ = protowire.Fixed32Type
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED64, descriptorpb.FieldDescriptorProto_TYPE_SFIXED64, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		typ = protowire.Fixed64Type
+	}
+	var elems []string
+	for len(b) > 0 {
+		n := protowire.ConsumeFieldValue(protowire.Number(fd.GetNumber()), typ, b)
+		if n < 0 {
+			return "", fmt.Errorf("invalid packed field %s: %w", fd.GetName(), protowire.ParseError(n))
+		}
+		str, _ := protoscopeScalar(typ, b[:n], fd)
+		elems = append(elems, str)
+		b = b[n:]
+	}
+	return strings.Join(elems, " "), nil
+}
+
+// protoscopeString returns a quoted string literal.
+func protoscopeString(b []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == utf8.RuneError && size == 1, r < ' ', r == 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, b[0])
+		default:
+			sb.Write(b[:size])
+		}
+		b = b[size:]
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// protoscopeBytes returns a literal for the given bytes: a string, if they are
+// printable text, or else a hex literal.
+func protoscopeBytes(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if utf8.Valid(b) && !bytes.ContainsFunc(b, func(r rune) bool {
+		return r < ' ' && r != '\n' && r != '\t' || r == 0x7f
+	}) {
+		return protoscopeString(b)
+	}
+	return "`" + hex.EncodeToString(b) + "`"
+}
+
+// looksLikeMessage returns true if the given bytes can be parsed as a
+// non-empty message.
+func looksLikeMessage(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 || typ == protowire.EndGroupType {
+			return false
+		}
+		b = b[n:]
+		if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoscopeFormatter(t *testing.T) {
+	fd := &descriptorpb.FieldDescriptorProto{
+		Name:    proto.String("id"),
+		Number:  proto.Int32(3),
+		Label:   descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+		Type:    descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+		Options: &descriptorpb.FieldOptions{Packed: proto.Bool(true)},
+	}
+	b, err := proto.Marshal(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fields that are not in the descriptor, as if it were stale
+	b = protowire.AppendTag(b, 99, protowire.VarintType)
+	b = protowire.AppendVarint(b, 7)
+	b = protowire.AppendTag(b, 100, protowire.BytesType)
+	b = protowire.AppendBytes(b, protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "nested"))
+	md, err := desc.LoadMessageDescriptorForMessage(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := dynamic.NewMessage(md)
+	if err := msg.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+
+	known := `1: {"id"}  # name
+3: 3  # number
+4: 3  # label: LABEL_REPEATED
+5: 3  # type: TYPE_INT64
+8: {  # options
+  2: true  # packed
+}`
+	str, err := newProtoscopeFormatter(false)(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != known {
+		t.Errorf("expected:\n%s\ngot:\n%s", known, str)
+	}
+
+	all := known + `
+99: 7  # unknown field
+100: {  # unknown field
+  1: {"nested"}
+}`
+	str, err = newProtoscopeFormatter(true)(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != all {
+		t.Errorf("expected:\n%s\ngot:\n%s", all, str)
+	}
+
+	for _, tc := range []struct {
+		msg      proto.Message
+		expected string
+	}{
+		{wrapperspb.Float(1.5), "1: 1.5i32  # value"},
+		{wrapperspb.Double(2), "1: 2.0  # value"},
+		{wrapperspb.Int32(-1), "1: -1  # value"},
+		{wrapperspb.UInt32(1), "1: 1  # value"},
+		{wrapperspb.Bytes([]byte{0, 1}), "1: {`0001`}  # value"},
+		{wrapperspb.String("a\"b\n"), `1: {"a\"b\n"}  # value`},
+		{&wrapperspb.Int32Value{}, ""},
+	} {
+		str, err := newProtoscopeFormatter(false)(tc.msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.msg, tc.expected, str)
+		}
+	}
+}
+
+func TestProtoscopeFloat(t *testing.T) {
+	for _, tc := range []struct {
+		f        float64
+		bits     int
+		expected string
+	}{
+		{1, 64, "1.0"},
+		{0.25, 32, "0.25i32"},
+		{1e100, 64, "1e+100"},
+		{math.Inf(1), 32, "inf32"},
+		{math.Inf(-1), 64, "-inf64"},
+		{math.NaN(), 64, "nan64"},
+	} {
+		if actual := protoscopeFloat(tc.f, tc.bits); actual != tc.expected {
+			t.Errorf("%v (%d bits): expected %q, got %q", tc.f, tc.bits, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// rawFrame holds the encoded bytes of a single message.
+type rawFrame struct {
+	data []byte
+}
+
+// rawCodec is a codec that does not decode messages, so they can be
+// forwarded exactly as they were received.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	f, ok := v.(*rawFrame)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec cannot marshal %T", v)
+	}
+	return f.data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	f, ok := v.(*rawFrame)
+	if !ok {
+		return fmt.Errorf("rawCodec cannot unmarshal into %T", v)
+	}
+	f.data = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// headers that are set by the transport and must not be forwarded
+var proxyReservedHeaders = []string{":authority", "content-type", "user-agent"}
+
+type debugProxy struct {
+	cc      *grpc.ClientConn
+	schema  atomic.Pointer[proxySchema]
+	headers metadata.MD
+	out     io.Writer
+
+	mu       sync.Mutex // serializes writes to out
+	numCalls int64
+}
+
+// handleStream is a grpc.StreamHandler that forwards all calls to the
+// upstream connection, logging each message that passes through.
+func (p *debugProxy) handleStream(_ interface{}, serverStream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(serverStream)
+	callID := atomic.AddInt64(&p.numCalls, 1)
+	schema := p.schema.Load()
+	mtd := schema.findMethod(method)
+
+	ctx, cancel := context.WithCancel(serverStream.Context())
+	defer cancel()
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = metadata.Join(md, p.headers)
+	for _, k := range proxyReservedHeaders {
+		delete(md, k)
+	}
+	p.logf(callID, "%s\nRequest metadata:\n%s", method, grpcurl.MetadataToString(md))
+
+	streamDesc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	clientStream, err := p.cc.NewStream(metadata.NewOutgoingContext(ctx, md), streamDesc, method, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		p.logf(callID, "Failed to start call: %v", err)
+		return err
+	}
+
+	go func() {
+		// forward requests from the client to the upstream server
+		for i := 1; ; i++ {
+			var f rawFrame
+			if err := serverStream.RecvMsg(&f); err != nil {
+				if err == io.EOF {
+					_ = clientStream.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+			p.logMessage(callID, schema, "Request", i, mtd.inputType(), f.data)
+			if err := clientStream.SendMsg(&f); err != nil {
+				// the error will be reported when receiving
+				return
+			}
+		}
+	}()
+
+	// forward responses from the upstream server back to the client
+	respHeaders, err := clientStream.Header()
+	if err == nil {
+		p.logf(callID, "Response headers:\n%s", grpcurl.MetadataToString(respHeaders))
+		if err := serverStream.SendHeader(respHeaders); err != nil {
+			return err
+		}
+	}
+	var respErr error
+	for i := 1; ; i++ {
+		var f rawFrame
+		if respErr = clientStream.RecvMsg(&f); respErr != nil {
+			break
+		}
+		p.logMessage(callID, schema, "Response", i, mtd.outputType(), f.data)
+		if err := serverStream.SendMsg(&f); err != nil {
+			return err
+		}
+	}
+	if respErr == io.EOF {
+		respErr = nil
+	}
+	trailers := clientStream.Trailer()
+	serverStream.SetTrailer(trailers)
+	stat, _ := status.FromError(respErr)
+	p.logf(callID, "Response trailers:\n%s\nStatus: %s %s", grpcurl.MetadataToString(trailers), stat.Code(), stat.Message())
+	return respErr
+}
+
+// proxyMethod is the descriptor for a proxied method, which may be nil if it
+// could not be resolved.
+type proxyMethod struct {
+	*desc.MethodDescriptor
+}
+
+func (m proxyMethod) inputType() *desc.MessageDescriptor {
+	if m.MethodDescriptor == nil {
+		return nil
+	}
+	return m.GetInputType()
+}
+
+func (m proxyMethod) outputType() *desc.MessageDescriptor {
+	if m.MethodDescriptor == nil {
+		return nil
+	}
+	return m.GetOutputType()
+}
+
+// proxySchema is used to decode and format the messages that pass through a
+// proxy. It is replaced when descriptors are reloaded via -watch.
+type proxySchema struct {
+	descSource grpcurl.DescriptorSource
+	formatter  grpcurl.Formatter
+}
+
+func newProxySchema(descSource grpcurl.DescriptorSource) (*proxySchema, error) {
+	_, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.Format(*format), descSource, nil, grpcurl.FormatOptions{
+		EmitJSONDefaultFields: *emitDefaults,
+		UseProtoNames:         *useProtoNames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct formatter for %q: %v", *format, err)
+	}
+	return &proxySchema{descSource: descSource, formatter: formatter}, nil
+}
+
+func (s *proxySchema) findMethod(method string) proxyMethod {
+	if s.descSource == nil {
+		return proxyMethod{}
+	}
+	mtd, err := findMethod(s.descSource, method)
+	if err != nil {
+		return proxyMethod{}
+	}
+	return proxyMethod{mtd}
+}
+
+func (p *debugProxy) logMessage(callID int64, schema *proxySchema, kind string, index int, md *desc.MessageDescriptor, data []byte) {
+	if md == nil {
+		p.logf(callID, "%s #%d: %d bytes (unknown message type)", kind, index, len(data))
+		return
+	}
+	msg := dynamic.NewMessage(md)
+	if err := msg.Unmarshal(data); err != nil {
+		p.logf(callID, "%s #%d: %d bytes (failed to decode as %s: %v)", kind, index, len(data), md.GetFullyQualifiedName(), err)
+		return
+	}
+	str, err := schema.formatter(msg)
+	if err != nil {
+		p.logf(callID, "%s #%d: %d bytes (failed to format: %v)", kind, index, len(data), err)
+		return
+	}
+	p.logf(callID, "%s #%d:\n%s", kind, index, str)
+}
+
+func (p *debugProxy) logf(callID int64, msg string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, "[call %d] %s\n", callID, fmt.Sprintf(msg, args...))
+}
+
+// runProxy listens for connections and forwards all calls to the given
+// upstream connection until the process is interrupted.
+func runProxy(cc *grpc.ClientConn, descSource grpcurl.DescriptorSource, headers []string) {
+	p := &debugProxy{
+		cc:      cc,
+		headers: grpcurl.MetadataFromHeaders(headers),
+		out:     os.Stdout,
+	}
+	schema, err := newProxySchema(descSource)
+	if err != nil {
+		fail(err, "Failed to create proxy")
+	}
+	p.schema.Store(schema)
+	if *watch {
+		if len(protoset) == 0 && len(protoFiles) == 0 {
+			fail(nil, "The -watch argument requires -protoset or -proto flags.")
+		}
+		fileSource := descSource
+		cs, isComposite := descSource.(compositeSource)
+		if isComposite {
+			fileSource = cs.file
+		}
+		w, err := newDescriptorWatcher(fileSource, os.Stderr, func(source grpcurl.DescriptorSource) error {
+			if isComposite {
+				source = compositeSource{cs.reflection, source}
+			}
+			schema, err := newProxySchema(source)
+			if err != nil {
+				return err
+			}
+			p.schema.Store(schema)
+			return nil
+		})
+		if err != nil {
+			fail(err, "Failed to watch descriptor files")
+		}
+		go w.run()
+	}
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(p.handleStream), grpc.ForceServerCodec(rawCodec{}))
+
+	addr := *listenAddr
+	if addr == "" {
+		addr = "localhost:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fail(err, "Failed to listen on %s", addr)
+	}
+	fmt.Fprintf(os.Stderr, "Proxy listening on %s\n", l.Addr())
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		svr.GracefulStop()
+	}()
+	if err := svr.Serve(l); err != nil {
+		fail(err, "Proxy server failed")
+	}
+}
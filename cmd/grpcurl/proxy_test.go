@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	insecurecreds "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+// startProxy starts a debug proxy in front of the given connection, which
+// decodes messages using the given source, if it is not nil, and adds the
+// given headers to each call. It returns a client of the proxy and the
+// proxy's log.
+func startProxy(t *testing.T, cc *grpc.ClientConn, source grpcurl.DescriptorSource, headers []string) (grpcurl_testing.TestServiceClient, *bytes.Buffer) {
+	t.Helper()
+	var out bytes.Buffer
+	p := &debugProxy{cc: cc, headers: grpcurl.MetadataFromHeaders(headers), out: &out}
+	schema, err := newProxySchema(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.schema.Store(schema)
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(p.handleStream), grpc.ForceServerCodec(rawCodec{}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	proxyCC, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecurecreds.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = proxyCC.Close()
+	})
+	return grpcurl_testing.NewTestServiceClient(proxyCC), &out
+}
+
+func TestProxyUnary(t *testing.T) {
+	cc, source := startTestServer(t)
+	// the server replies with the header that the proxy adds
+	client, out := startProxy(t, cc, source, []string{grpcurl_testing.MetadataReplyHeaders + ": x-proxy: yes"})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), grpcurl_testing.MetadataReplyTrailers, "x-client: yes")
+	var headers, trailers metadata.MD
+	resp, err := client.UnaryCall(ctx, &grpcurl_testing.SimpleRequest{Payload: &grpcurl_testing.Payload{Body: []byte("hi")}}, grpc.Header(&headers), grpc.Trailer(&trailers))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(resp.GetPayload().GetBody()) != "hi" {
+		t.Errorf("expected response body %q, got %q", "hi", resp.GetPayload().GetBody())
+	}
+	if v := headers.Get("x-proxy"); len(v) != 1 || v[0] != "yes" {
+		t.Errorf("expected header added by proxy to be forwarded, got headers %v", headers)
+	}
+	if v := trailers.Get("x-client"); len(v) != 1 || v[0] != "yes" {
+		t.Errorf("expected trailer to be forwarded, got trailers %v", trailers)
+	}
+
+	for _, s := range []string{
+		"[call 1] /testing.TestService/UnaryCall\nRequest metadata:\n",
+		"reply-with-headers: x-proxy: yes\n",
+		"reply-with-trailers: x-client: yes\n",
+		"[call 1] Request #1:\n{\n  \"payload\": {\n    \"body\": \"aGk=\"\n  }\n}\n",
+		"[call 1] Response headers:\n",
+		"x-proxy: yes\n",
+		"[call 1] Response #1:\n{\n  \"payload\": {\n    \"body\": \"aGk=\"\n  }\n}\n",
+		"[call 1] Response trailers:\nx-client: yes\nStatus: OK \n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected log to contain %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestProxyStream(t *testing.T) {
+	cc, source := startTestServer(t)
+	client, out := startProxy(t, cc, source, nil)
+
+	// the server fails the call after its responses are sent
+	ctx := metadata.AppendToOutgoingContext(context.Background(), grpcurl_testing.MetadataFailLate, "5")
+	str, err := client.FullDuplexCall(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, size := range []int32{1, 2} {
+		req := &grpcurl_testing.StreamingOutputCallRequest{ResponseParameters: []*grpcurl_testing.ResponseParameters{{Size: size}}}
+		if err := str.Send(req); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := str.CloseSend(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var sizes []int
+	for {
+		resp, err := str.Recv()
+		if err != nil {
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("expected NotFound error, got %v", err)
+			}
+			break
+		}
+		sizes = append(sizes, len(resp.GetPayload().GetBody()))
+	}
+	if len(sizes) != 2 || sizes[0] != 1 || sizes[1] != 2 {
+		t.Errorf("expected responses of 1 and 2 bytes, got %v", sizes)
+	}
+
+	for _, s := range []string{
+		"[call 1] /testing.TestService/FullDuplexCall\n",
+		"[call 1] Request #1:\n{\n  \"responseParameters\": [\n    {\n      \"size\": 1\n    }\n  ]\n}\n",
+		"[call 1] Request #2:\n{\n  \"responseParameters\": [\n    {\n      \"size\": 2\n    }\n  ]\n}\n",
+		"[call 1] Response #1:\n{\n  \"payload\": {\n    \"body\": \"AA==\"\n  }\n}\n",
+		"[call 1] Response #2:\n{\n  \"payload\": {\n    \"body\": \"AAE=\"\n  }\n}\n",
+		"Status: NotFound fail\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected log to contain %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestProxyUnknownMethod(t *testing.T) {
+	cc, _ := startTestServer(t)
+	// without descriptors, messages are forwarded but not decoded
+	client, out := startProxy(t, cc, nil, nil)
+
+	str, err := client.StreamingInputCall(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := str.Send(&grpcurl_testing.StreamingInputCallRequest{Payload: &grpcurl_testing.Payload{Body: []byte("hello")}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := str.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.GetAggregatedPayloadSize() != 5 {
+		t.Errorf("expected aggregated size 5, got %d", resp.GetAggregatedPayloadSize())
+	}
+	for _, s := range []string{
+		"[call 1] Request #1: 9 bytes (unknown message type)\n",
+		"[call 1] Response #1: 2 bytes (unknown message type)\n",
+		"Status: OK \n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected log to contain %q:\n%s", s, out.String())
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"     //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+const sessionFormatVersion = 1
+
+// recordedSession is the contents of a file written via -record. Messages
+// are stored in JSON format. Values of binary headers (those whose names end
+// in "-bin") are base64-encoded.
+type recordedSession struct {
+	Version          int                 `json:"version"`
+	Target           string              `json:"target"`
+	Method           string              `json:"method"`
+	Start            time.Time           `json:"start"`
+	RequestHeaders   map[string][]string `json:"requestHeaders,omitempty"`
+	Requests         []recordedMessage   `json:"requests"`
+	ResponseHeaders  map[string][]string `json:"responseHeaders,omitempty"`
+	Responses        []recordedMessage   `json:"responses"`
+	ResponseTrailers map[string][]string `json:"responseTrailers,omitempty"`
+	// Status is the final status of the RPC, as a google.rpc.Status message
+	// in JSON format. It is absent if the RPC failed without a status.
+	Status json.RawMessage `json:"status,omitempty"`
+	// Error describes a failure to invoke the RPC that has no status.
+	Error string `json:"error,omitempty"`
+	// Protoset is an encoded FileDescriptorSet that describes the method,
+	// so that the session can be replayed without other descriptor sources.
+	Protoset []byte `json:"protoset,omitempty"`
+}
+
+type recordedMessage struct {
+	// Elapsed is the time since the start of the session at which the
+	// message was sent or received, in a form accepted by time.ParseDuration.
+	Elapsed string          `json:"elapsed"`
+	Message json.RawMessage `json:"message"`
+}
+
+func (m recordedMessage) elapsed() (time.Duration, error) {
+	d, err := time.ParseDuration(m.Elapsed)
+	if err != nil {
+		return 0, fmt.Errorf("invalid elapsed time: %v", err)
+	}
+	return d, nil
+}
+
+func readSession(fileName string) (*recordedSession, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var s recordedSession
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("could not parse session: %v", err)
+	}
+	if s.Version != sessionFormatVersion {
+		return nil, fmt.Errorf("unsupported session format version %d", s.Version)
+	}
+	if s.Method == "" {
+		return nil, fmt.Errorf("session does not indicate a method")
+	}
+	return &s, nil
+}
+
+func writeSession(fileName string, s *recordedSession) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, append(b, '\n'), 0666)
+}
+
+// descriptorSource returns a descriptor source for the descriptors embedded
+// in the session, or nil if there are none.
+func (s *recordedSession) descriptorSource() (grpcurl.DescriptorSource, error) {
+	return sessionsDescriptorSource([]*recordedSession{s})
+}
+
+// sessionsDescriptorSource returns a descriptor source for the descriptors
+// embedded in all of the given sessions, or nil if there are none.
+func sessionsDescriptorSource(sessions []*recordedSession) (grpcurl.DescriptorSource, error) {
+	var fds descriptorpb.FileDescriptorSet
+	seen := map[string]bool{}
+	for _, s := range sessions {
+		if len(s.Protoset) == 0 {
+			continue
+		}
+		var set descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(s.Protoset, &set); err != nil {
+			return nil, fmt.Errorf("could not parse descriptors in session: %v", err)
+		}
+		for _, fd := range set.File {
+			if !seen[fd.GetName()] {
+				seen[fd.GetName()] = true
+				fds.File = append(fds.File, fd)
+			}
+		}
+	}
+	if len(fds.File) == 0 {
+		return nil, nil
+	}
+	return grpcurl.DescriptorSourceFromFileDescriptorSet(&fds)
+}
+
+// headers returns the recorded request headers in "name: value" form.
+func (s *recordedSession) headers() []string {
+	return headersFromMetadata(s.RequestHeaders)
+}
+
+// statusCode returns the code of the recorded status, or false if the
+// session has no status.
+func (s *recordedSession) statusCode() (codes.Code, bool) {
+	if len(s.Status) == 0 {
+		return 0, false
+	}
+	var stat struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(s.Status, &stat); err != nil {
+		return 0, false
+	}
+	return codes.Code(stat.Code), true
+}
+
+// status returns the recorded status, or nil if the session has none.
+func (s *recordedSession) status(descSource grpcurl.DescriptorSource) (*status.Status, error) {
+	if len(s.Status) == 0 {
+		return nil, nil
+	}
+	var stat spb.Status
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(s.Status), &stat); err != nil {
+		return nil, fmt.Errorf("could not parse status in session: %v", err)
+	}
+	return status.FromProto(&stat), nil
+}
+
+// responseDelays returns how long to wait before each recorded response in
+// order to reproduce the original timing, with the delays divided by the
+// given speed. The first delay is measured from the last request.
+func (s *recordedSession) responseDelays(speed float64) ([]time.Duration, error) {
+	var prev time.Duration
+	if n := len(s.Requests); n > 0 {
+		var err error
+		if prev, err = s.Requests[n-1].elapsed(); err != nil {
+			return nil, fmt.Errorf("request #%d: %v", n, err)
+		}
+	}
+	delays := make([]time.Duration, len(s.Responses))
+	for i, resp := range s.Responses {
+		elapsed, err := resp.elapsed()
+		if err != nil {
+			return nil, fmt.Errorf("response #%d: %v", i+1, err)
+		}
+		// for bidi streams, responses may precede the last request
+		if elapsed > prev {
+			delays[i] = time.Duration(float64(elapsed-prev) / speed)
+			prev = elapsed
+		}
+	}
+	return delays, nil
+}
+
+// play sends the events of the recorded RPC to the given handler, without
+// contacting a server. If speed is positive, the recorded delays between
+// responses are reproduced, divided by speed.
+func (s *recordedSession) play(ctx context.Context, descSource grpcurl.DescriptorSource, handler grpcurl.InvocationEventHandler, speed float64) error {
+	if s.Error != "" && len(s.Status) == 0 {
+		return fmt.Errorf("recorded RPC failed: %s", s.Error)
+	}
+	mtd, err := findMethod(descSource, s.Method)
+	if err != nil {
+		return err
+	}
+	stat, err := s.status(descSource)
+	if err != nil {
+		return err
+	}
+	var delays []time.Duration
+	if speed > 0 {
+		if delays, err = s.responseDelays(speed); err != nil {
+			return err
+		}
+	}
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)}
+
+	handler.OnResolveMethod(mtd)
+	handler.OnSendHeaders(sessionMetadata(s.RequestHeaders))
+	handler.OnReceiveHeaders(sessionMetadata(s.ResponseHeaders))
+	for i, resp := range s.Responses {
+		if delays != nil {
+			select {
+			case <-time.After(delays[i]):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		msg := dynamic.NewMessage(mtd.GetOutputType())
+		if err := unmarshaler.Unmarshal(bytes.NewReader(resp.Message), msg); err != nil {
+			return fmt.Errorf("could not parse response #%d: %v", i+1, err)
+		}
+		handler.OnReceiveResponse(msg)
+	}
+	handler.OnReceiveTrailers(stat, sessionMetadata(s.ResponseTrailers))
+	return nil
+}
+
+// requestParser returns a request parser that supplies the recorded
+// request messages.
+func (s *recordedSession) requestParser(descSource grpcurl.DescriptorSource) grpcurl.RequestParser {
+	return &sessionRequestParser{
+		requests:    s.Requests,
+		unmarshaler: jsonpb.Unmarshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSource(descSource)},
+	}
+}
+
+type sessionRequestParser struct {
+	requests    []recordedMessage
+	unmarshaler jsonpb.Unmarshaler
+	count       int
+}
+
+func (p *sessionRequestParser) Next(m proto.Message) error {
+	if p.count >= len(p.requests) {
+		return io.EOF
+	}
+	msg := p.requests[p.count]
+	p.count++
+	return p.unmarshaler.Unmarshal(bytes.NewReader(msg.Message), m)
+}
+
+func (p *sessionRequestParser) NumRequests() int {
+	return p.count
+}
+
+func metadataForSession(md metadata.MD) map[string][]string {
+	if len(md) == 0 {
+		return nil
+	}
+	result := make(map[string][]string, len(md))
+	for k, vs := range md {
+		vals := make([]string, len(vs))
+		for i, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			vals[i] = v
+		}
+		result[k] = vals
+	}
+	return result
+}
+
+// sessionMetadata is the inverse of metadataForSession.
+func sessionMetadata(md map[string][]string) metadata.MD {
+	result := make(metadata.MD, len(md))
+	for k, vs := range md {
+		vals := make([]string, len(vs))
+		for i, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+					v = string(b)
+				}
+			}
+			vals[i] = v
+		}
+		result[k] = vals
+	}
+	return result
+}
+
+func headersFromMetadata(md map[string][]string) []string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var headers []string
+	for _, k := range keys {
+		for _, v := range md[k] {
+			headers = append(headers, k+": "+v)
+		}
+	}
+	return headers
+}
+
+// sessionRecorder captures the events of an RPC invocation into a
+// recordedSession. It wraps both the request parser, to capture request
+// messages, and the event handler, to capture everything else.
+type sessionRecorder struct {
+	descSource grpcurl.DescriptorSource
+	marshaler  jsonpb.Marshaler
+
+	mu      sync.Mutex
+	session recordedSession
+	err     error
+}
+
+func newSessionRecorder(target, method string, descSource grpcurl.DescriptorSource) *sessionRecorder {
+	return &sessionRecorder{
+		descSource: descSource,
+		marshaler:  jsonpb.Marshaler{AnyResolver: grpcurl.AnyResolverFromDescriptorSourceWithFallback(descSource)},
+		session: recordedSession{
+			Version: sessionFormatVersion,
+			Target:  target,
+			Method:  method,
+			Start:   time.Now(),
+		},
+	}
+}
+
+func (r *sessionRecorder) message(m proto.Message) recordedMessage {
+	elapsed := time.Since(r.session.Start)
+	js, err := r.marshaler.MarshalToString(m)
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return recordedMessage{Elapsed: elapsed.String(), Message: json.RawMessage(js)}
+}
+
+func (r *sessionRecorder) wrapParser(rp grpcurl.RequestParser) grpcurl.RequestParser {
+	return &recordingRequestParser{RequestParser: rp, r: r}
+}
+
+func (r *sessionRecorder) wrapHandler(h grpcurl.InvocationEventHandler) grpcurl.InvocationEventHandler {
+	return &recordingEventHandler{InvocationEventHandler: h, r: r}
+}
+
+// finish records the error returned from invoking the RPC, if any, and then
+// writes the session to the given file.
+func (r *sessionRecorder) finish(fileName string, invokeErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if invokeErr != nil {
+		if stat, ok := status.FromError(invokeErr); ok && len(r.session.Status) == 0 {
+			r.recordStatus(stat)
+		} else if !ok {
+			r.session.Error = invokeErr.Error()
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return writeSession(fileName, &r.session)
+}
+
+func (r *sessionRecorder) recordStatus(stat *status.Status) {
+	if stat == nil {
+		// a nil status means OK
+		stat = status.New(codes.OK, "")
+	}
+	js, err := r.marshaler.MarshalToString(stat.Proto())
+	if err != nil {
+		if r.err == nil {
+			r.err = err
+		}
+		return
+	}
+	r.session.Status = json.RawMessage(js)
+}
+
+type recordingRequestParser struct {
+	grpcurl.RequestParser
+	r *sessionRecorder
+}
+
+func (p *recordingRequestParser) Next(m proto.Message) error {
+	err := p.RequestParser.Next(m)
+	if err == nil {
+		p.r.mu.Lock()
+		p.r.session.Requests = append(p.r.session.Requests, p.r.message(m))
+		p.r.mu.Unlock()
+	}
+	return err
+}
+
+type recordingEventHandler struct {
+	grpcurl.InvocationEventHandler
+	r *sessionRecorder
+}
+
+func (h *recordingEventHandler) OnResolveMethod(md *desc.MethodDescriptor) {
+	h.r.mu.Lock()
+	var buf bytes.Buffer
+	if err := grpcurl.WriteProtoset(&buf, h.r.descSource, md.GetService().GetFullyQualifiedName()); err == nil {
+		h.r.session.Protoset = buf.Bytes()
+	}
+	h.r.mu.Unlock()
+	h.InvocationEventHandler.OnResolveMethod(md)
+}
+
+func (h *recordingEventHandler) OnSendHeaders(md metadata.MD) {
+	h.r.mu.Lock()
+	h.r.session.RequestHeaders = metadataForSession(md)
+	h.r.mu.Unlock()
+	h.InvocationEventHandler.OnSendHeaders(md)
+}
+
+func (h *recordingEventHandler) OnReceiveHeaders(md metadata.MD) {
+	h.r.mu.Lock()
+	h.r.session.ResponseHeaders = metadataForSession(md)
+	h.r.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveHeaders(md)
+}
+
+func (h *recordingEventHandler) OnReceiveResponse(resp proto.Message) {
+	h.r.mu.Lock()
+	h.r.session.Responses = append(h.r.session.Responses, h.r.message(resp))
+	h.r.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+func (h *recordingEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.r.mu.Lock()
+	h.r.session.ResponseTrailers = metadataForSession(md)
+	h.r.recordStatus(stat)
+	h.r.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveTrailers(stat, md)
+}
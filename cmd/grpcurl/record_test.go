@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestSessionMetadataRoundTrip(t *testing.T) {
+	md := metadata.MD{
+		"x-foo":   []string{"bar", "baz"},
+		"x-b-bin": []string{"\x00\x01\x02"},
+	}
+	recorded := metadataForSession(md)
+	if recorded["x-b-bin"][0] != "AAEC" {
+		t.Errorf("binary header should be base64-encoded, got %q", recorded["x-b-bin"][0])
+	}
+	headers := headersFromMetadata(recorded)
+	expected := []string{"x-b-bin: AAEC", "x-foo: bar", "x-foo: baz"}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("wrong headers: expected %v, got %v", expected, headers)
+	}
+	if roundTripped := grpcurl.MetadataFromHeaders(headers); !reflect.DeepEqual(roundTripped, md) {
+		t.Errorf("metadata did not survive round trip: expected %v, got %v", md, roundTripped)
+	}
+}
+
+func TestSessionMetadata(t *testing.T) {
+	md := metadata.MD{
+		"x-foo":   []string{"bar", "baz"},
+		"x-b-bin": []string{"\x00\x01\x02"},
+	}
+	if actual := sessionMetadata(metadataForSession(md)); !reflect.DeepEqual(actual, md) {
+		t.Errorf("metadata did not survive round trip: expected %v, got %v", md, actual)
+	}
+}
+
+func TestResponseDelays(t *testing.T) {
+	s := &recordedSession{
+		Requests: []recordedMessage{{Elapsed: "1ms"}, {Elapsed: "10ms"}},
+		Responses: []recordedMessage{
+			{Elapsed: "5ms"}, // precedes the last request, as in a bidi stream
+			{Elapsed: "110ms"},
+			{Elapsed: "310ms"},
+		},
+	}
+	delays, err := s.responseDelays(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("wrong delays: expected %v, got %v", expected, delays)
+	}
+
+	s.Responses[1].Elapsed = "soon"
+	if _, err := s.responseDelays(1); err == nil {
+		t.Error("expected error for invalid elapsed time")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// reflectCache stores the descriptors fetched via server reflection in a
+// protoset file, for -reflect-cache, so that later runs against the same
+// server can use them instead of making reflection requests. The names of the
+// services that the server exposes are stored in a second file, since the
+// protoset's files may define other services too.
+type reflectCache struct {
+	fileName string
+	ttl      time.Duration
+}
+
+// newReflectCache returns the cache for the given server in the given
+// directory. The file is named after the target, with a hash of the target
+// and authority so that different servers never share a file.
+func newReflectCache(dir, target, authority string, ttl time.Duration) *reflectCache {
+	if strings.HasPrefix(dir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, dir[2:])
+		}
+	}
+	sum := sha256.Sum256([]byte(target + "\x00" + authority))
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, target)
+	return &reflectCache{
+		fileName: filepath.Join(dir, name+"-"+hex.EncodeToString(sum[:8])+".binpb"),
+		ttl:      ttl,
+	}
+}
+
+func (c *reflectCache) servicesFileName() string {
+	return strings.TrimSuffix(c.fileName, ".binpb") + ".services"
+}
+
+// load returns the cached descriptors, or nil if there are none or they are
+// older than the TTL.
+func (c *reflectCache) load() (grpcurl.DescriptorSource, error) {
+	info, err := os.Stat(c.fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		return nil, nil
+	}
+	b, err := os.ReadFile(c.servicesFileName())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	source, err := grpcurl.DescriptorSourceFromProtoSets(c.fileName)
+	if err != nil {
+		return nil, err
+	}
+	return cachedDescriptorSource{DescriptorSource: source, services: strings.Fields(string(b))}, nil
+}
+
+// store writes the descriptors of all services of the given source, and their
+// dependencies, to the cache.
+func (c *reflectCache) store(source grpcurl.DescriptorSource) error {
+	svcs, err := source.ListServices()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.fileName), 0700); err != nil {
+		return err
+	}
+	// the protoset is written last, since its time is that of the entry
+	if err := writeFileAtomically(c.servicesFileName(), func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, strings.Join(svcs, "\n"))
+		return err
+	}); err != nil {
+		return err
+	}
+	return writeFileAtomically(c.fileName, func(w io.Writer) error {
+		return grpcurl.WriteProtoset(w, source, svcs...)
+	})
+}
+
+// writeFileAtomically writes a temporary file, using the given function, and
+// renames it to the given name, so that concurrent runs never read a partial
+// file.
+func writeFileAtomically(fileName string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(fileName), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), fileName)
+}
+
+// cachedDescriptorSource is a descriptor source read from the cache, which
+// lists the services that the server exposed.
+type cachedDescriptorSource struct {
+	grpcurl.DescriptorSource
+	services []string
+}
+
+func (s cachedDescriptorSource) ListServices() ([]string, error) {
+	return s.services, nil
+}
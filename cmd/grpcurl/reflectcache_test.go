@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestReflectCache(t *testing.T) {
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cache := newReflectCache(dir, "localhost:8080", "", time.Hour)
+	if !strings.HasPrefix(filepath.Base(cache.fileName), "localhost_8080-") {
+		t.Errorf("unexpected file name: %s", cache.fileName)
+	}
+	if other := newReflectCache(dir, "localhost:8080", "api.example.com", time.Hour); other.fileName == cache.fileName {
+		t.Error("different authorities should not share a file")
+	}
+
+	if cached, err := cache.load(); err != nil || cached != nil {
+		t.Fatalf("expected empty cache, got %v, %v", cached, err)
+	}
+	if err := cache.store(source); err != nil {
+		t.Fatalf("failed to store: %v", err)
+	}
+	cached, err := cache.load()
+	if err != nil || cached == nil {
+		t.Fatalf("expected cached source, got %v, %v", cached, err)
+	}
+	expected, _ := source.ListServices()
+	svcs, err := cached.ListServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the protoset's services are listed in no particular order
+	sort.Strings(expected)
+	sort.Strings(svcs)
+	if !reflect.DeepEqual(svcs, expected) {
+		t.Errorf("expected services %v, got %v", expected, svcs)
+	}
+	if _, err := cached.FindSymbol("testing.TestService"); err != nil {
+		t.Errorf("failed to find service in cached source: %v", err)
+	}
+
+	// an entry older than the TTL is not used
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(cache.fileName, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := cache.load(); err != nil || cached != nil {
+		t.Errorf("expected expired cache, got %v, %v", cached, err)
+	}
+}
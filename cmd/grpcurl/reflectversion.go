@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// Versions of the server reflection service that may be given via
+// -reflect-version.
+const (
+	reflectVersionAuto    = "auto"
+	reflectVersionV1      = "v1"
+	reflectVersionV1Alpha = "v1alpha"
+)
+
+// newReflectionClient returns a client for the given version of the server
+// reflection service. With "auto", v1 is tried first, and v1alpha is used if
+// the server does not implement v1. The onNegotiated function, if non-nil, is
+// called the first time the server responds, with the version that was used
+// and, if v1 was tried and not used, why.
+func newReflectionClient(ctx context.Context, cc grpc.ClientConnInterface, version string, onNegotiated func(version, reason string)) *grpcreflect.Client {
+	conn := &reflectionConn{ClientConnInterface: cc, onNegotiated: onNegotiated}
+	switch version {
+	case reflectVersionV1:
+		// A client for only v1 still falls back to v1alpha when the server
+		// does not implement v1, which panics without a v1alpha stub. So
+		// the connection refuses to call v1alpha instead.
+		conn.v1Only = true
+		return grpcreflect.NewClientAuto(ctx, conn)
+	case reflectVersionV1Alpha:
+		return grpcreflect.NewClientV1Alpha(ctx, refv1alpha.NewServerReflectionClient(conn))
+	default:
+		return grpcreflect.NewClientAuto(ctx, conn)
+	}
+}
+
+// reflectionConn wraps the connection used for server reflection in order to
+// observe which version of the reflection service answers, since the client
+// does not expose it.
+type reflectionConn struct {
+	grpc.ClientConnInterface
+	onNegotiated func(version, reason string)
+	v1Only       bool
+
+	mu         sync.Mutex
+	v1Err      error
+	negotiated bool
+}
+
+func (c *reflectionConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if c.v1Only && reflectionVersion(method) == reflectVersionV1Alpha {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, status.Errorf(codes.Unimplemented, "server reflection v1 failed (%v), and -reflect-version is v1", c.v1Err)
+	}
+	stream, err := c.ClientConnInterface.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		c.failed(method, err)
+		return nil, err
+	}
+	return &reflectionStream{ClientStream: stream, conn: c, method: method}, nil
+}
+
+// failed records an error from the given reflection method. Errors that cause
+// the v1 service to be abandoned are remembered, to explain the fallback.
+func (c *reflectionConn) failed(method string, err error) {
+	if err == io.EOF || status.Code(err) == codes.Canceled {
+		// the stream was closed by the client
+		return
+	}
+	version := reflectionVersion(method)
+	debugf(debugReflection, "Reflection %s failed: %v", version, err)
+	if version != reflectVersionV1 {
+		return
+	}
+	if code := status.Code(err); code == codes.Unimplemented || code == codes.Unavailable {
+		c.mu.Lock()
+		c.v1Err = err
+		c.mu.Unlock()
+	}
+}
+
+func (c *reflectionConn) succeeded(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.negotiated {
+		return
+	}
+	c.negotiated = true
+	version := reflectionVersion(method)
+	var reason string
+	if version == reflectVersionV1Alpha && c.v1Err != nil {
+		reason = fmt.Sprintf("v1 failed: %v", c.v1Err)
+	}
+	debugf(debugReflection, "Using reflection %s", version)
+	if c.onNegotiated != nil {
+		c.onNegotiated(version, reason)
+	}
+}
+
+// reflectionVersion returns the version of the reflection service that the
+// given method name belongs to.
+func reflectionVersion(method string) string {
+	if strings.HasPrefix(method, "/grpc.reflection.v1alpha.") {
+		return reflectVersionV1Alpha
+	}
+	return reflectVersionV1
+}
+
+type reflectionStream struct {
+	grpc.ClientStream
+	conn   *reflectionConn
+	method string
+}
+
+func (s *reflectionStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.conn.failed(s.method, err)
+	} else {
+		s.conn.succeeded(s.method)
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	insecurecreds "google.golang.org/grpc/credentials/insecure"
+	grpcreflection "google.golang.org/grpc/reflection"
+	refv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+func TestNewReflectionClient(t *testing.T) {
+	// a server that only implements the v1alpha reflection service
+	svr := grpc.NewServer()
+	refv1alpha.RegisterServerReflectionServer(svr, grpcreflection.NewServer(grpcreflection.ServerOptions{Services: svr}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	defer svr.Stop()
+
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecurecreds.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	testCases := []struct {
+		version         string
+		expectedVersion string
+		expectedReason  string
+		expectErr       bool
+	}{
+		{version: reflectVersionAuto, expectedVersion: reflectVersionV1Alpha, expectedReason: "v1 failed: rpc error: code = Unimplemented"},
+		{version: reflectVersionV1Alpha, expectedVersion: reflectVersionV1Alpha},
+		{version: reflectVersionV1, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var version, reason string
+			client := newReflectionClient(ctx, cc, tc.version, func(v, r string) {
+				version, reason = v, r
+			})
+			defer client.Reset()
+			svcs, err := client.ListServices()
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got services %v", svcs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tc.expectedVersion {
+				t.Errorf("expected version %s, got %s", tc.expectedVersion, version)
+			}
+			if !strings.HasPrefix(reason, tc.expectedReason) || (tc.expectedReason == "" && reason != "") {
+				t.Errorf("expected reason %q, got %q", tc.expectedReason, reason)
+			}
+		})
+	}
+}
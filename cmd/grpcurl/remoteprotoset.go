@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// protosetFetchTimeout is how long to wait for a remote protoset to be
+// downloaded.
+const protosetFetchTimeout = time.Minute
+
+// isRemoteProtoset reports whether the given -protoset argument is a URL,
+// instead of the name of a file.
+func isRemoteProtoset(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// fetchProtosets downloads the protosets at the given URLs to temporary files,
+// returning the names to load in place of the given ones. Names that are not
+// URLs are returned as is. The returned function removes the temporary files.
+func fetchProtosets(names []string, headers []string) ([]string, func(), error) {
+	var tempFiles []string
+	cleanup := func() {
+		for _, f := range tempFiles {
+			os.Remove(f)
+		}
+	}
+	files := make([]string, len(names))
+	for i, name := range names {
+		if !isRemoteProtoset(name) {
+			files[i] = name
+			continue
+		}
+		b, err := fetchProtoset(name, headers)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		f, err := os.CreateTemp("", "grpcurl-*.protoset")
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		tempFiles = append(tempFiles, f.Name())
+		_, err = f.Write(b)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		files[i] = f.Name()
+	}
+	return files, cleanup, nil
+}
+
+// fetchProtoset downloads the protoset at the given URL, sending the given
+// headers, which are in 'name: value' form. If the URL has a fragment like
+// '#sha256=<hex>', the download must have that hash.
+func fetchProtoset(rawURL string, headers []string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var checksum []byte
+	if u.Fragment != "" {
+		alg, sum, _ := strings.Cut(u.Fragment, "=")
+		if alg != "sha256" {
+			return nil, fmt.Errorf("%s: unsupported checksum %q; expecting '#sha256=<hex>'", rawURL, u.Fragment)
+		}
+		if checksum, err = hex.DecodeString(sum); err != nil || len(checksum) != sha256.Size {
+			return nil, fmt.Errorf("%s: invalid SHA-256 checksum %q", rawURL, sum)
+		}
+		u.Fragment = ""
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q; expecting 'name: value'", h)
+		}
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	client := &http.Client{Timeout: protosetFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	if checksum != nil {
+		if sum := sha256.Sum256(b); !bytes.Equal(sum[:], checksum) {
+			return nil, fmt.Errorf("%s: checksum mismatch: expected sha256=%x, got sha256=%x", u, checksum, sum)
+		}
+	}
+	return b, nil
+}
+
+// loadProtosets returns a descriptor source for the protosets with the given
+// names, which may be URLs.
+func loadProtosets(names []string) (grpcurl.DescriptorSource, error) {
+	headers := []string(protosetHdrs)
+	if *expandHeaders {
+		var err error
+		if headers, err = grpcurl.ExpandHeaders(headers); err != nil {
+			return nil, err
+		}
+	}
+	files, cleanup, err := fetchProtosets(names, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return grpcurl.DescriptorSourceFromProtoSets(files...)
+}
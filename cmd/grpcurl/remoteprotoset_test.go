@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFetchProtosets(t *testing.T) {
+	data, err := os.ReadFile("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+	sum := sha256.Sum256(data)
+	headers := []string{"Authorization: Bearer secret"}
+
+	files, cleanup, err := fetchProtosets([]string{"local.protoset", srv.URL + "/test.protoset#sha256=" + hex.EncodeToString(sum[:])}, headers)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files[0] != "local.protoset" {
+		t.Errorf("local file should not be changed, got %s", files[0])
+	}
+	b, err := os.ReadFile(files[1])
+	if err != nil || string(b) != string(data) {
+		t.Errorf("downloaded file does not match: %v", err)
+	}
+	cleanup()
+	if _, err := os.Stat(files[1]); !os.IsNotExist(err) {
+		t.Errorf("temporary file should be removed, got %v", err)
+	}
+
+	if _, err := fetchProtoset(srv.URL+"/test.protoset", nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+	wrongSum := strings.Repeat("00", sha256.Size)
+	if _, err := fetchProtoset(srv.URL+"/test.protoset#sha256="+wrongSum, headers); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+	if _, err := fetchProtoset(srv.URL+"/test.protoset#md5=abc", headers); err == nil {
+		t.Error("expected error for unsupported checksum")
+	}
+}
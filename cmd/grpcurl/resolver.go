@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// execResolverScheme is the scheme of targets that are resolved by running
+// the command given via -resolver-exec.
+const execResolverScheme = "grpcurl-exec"
+
+// resolverAttributeKey is the type of keys for attributes of addresses that
+// are returned by the command given via -resolver-exec.
+type resolverAttributeKey string
+
+// execResolverBuilder builds resolvers that run a command to map a target to
+// a list of addresses.
+type execResolverBuilder struct {
+	cmdLine string
+}
+
+func (b *execResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs, err := runResolverCommand(b.cmdLine, target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, err
+	}
+	return execResolver{}, nil
+}
+
+func (b *execResolverBuilder) Scheme() string {
+	return execResolverScheme
+}
+
+// execResolver only resolves the target once, when it is built.
+type execResolver struct{}
+
+func (execResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (execResolver) Close() {}
+
+// runResolverCommand runs the given command line to resolve the given target.
+// The target is provided to the command in the GRPCURL_TARGET environment
+// variable.
+func runResolverCommand(cmdLine, target string) ([]resolver.Address, error) {
+	cmd := shellCommand(cmdLine)
+	cmd.Env = append(os.Environ(), "GRPCURL_TARGET="+target)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("resolver command failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("resolver command failed: %v", err)
+	}
+	addrs, err := parseResolvedAddresses(stdout.String())
+	if err != nil {
+		return nil, fmt.Errorf("resolver command returned invalid output: %v", err)
+	}
+	return addrs, nil
+}
+
+// parseResolvedAddresses parses the output of a resolver command. Each line
+// that is not blank or a comment (starting with '#') is an address, in
+// 'host:port' form, optionally followed by attributes in 'key=value' form,
+// separated by whitespace. The 'servername' attribute overrides the name used
+// to verify the server's certificate. Other attributes are attached to the
+// address, for use by load balancing policies.
+func parseResolvedAddresses(output string) ([]resolver.Address, error) {
+	var addrs []resolver.Address
+	for i, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		addr := resolver.Address{Addr: fields[0]}
+		for _, attr := range fields[1:] {
+			pos := strings.IndexByte(attr, '=')
+			if pos <= 0 {
+				return nil, fmt.Errorf("line %d: attribute %q should be in 'key=value' form", i+1, attr)
+			}
+			key, val := attr[:pos], attr[pos+1:]
+			if key == "servername" {
+				addr.ServerName = val
+				continue
+			}
+			if addr.Attributes == nil {
+				addr.Attributes = attributes.New(resolverAttributeKey(key), val)
+			} else {
+				addr.Attributes = addr.Attributes.WithValue(resolverAttributeKey(key), val)
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+	return addrs, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseResolvedAddresses(t *testing.T) {
+	output := "# resolved\n10.0.0.1:443 zone=us-east servername=api.example.com\n\n  10.0.0.2:443\n"
+	addrs, err := parseResolvedAddresses(output)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %d", len(addrs))
+	}
+	if addrs[0].Addr != "10.0.0.1:443" || addrs[0].ServerName != "api.example.com" {
+		t.Errorf("wrong first address: %+v", addrs[0])
+	}
+	if zone := addrs[0].Attributes.Value(resolverAttributeKey("zone")); zone != "us-east" {
+		t.Errorf("wrong zone attribute: %v", zone)
+	}
+	if addrs[1].Addr != "10.0.0.2:443" || addrs[1].Attributes != nil {
+		t.Errorf("wrong second address: %+v", addrs[1])
+	}
+
+	for _, output := range []string{"", "# nothing\n", "10.0.0.1:443 zone"} {
+		if _, err := parseResolvedAddresses(output); err == nil {
+			t.Errorf("%q: expected error", output)
+		}
+	}
+}
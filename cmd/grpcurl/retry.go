@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+)
+
+// defaultRetryCodes is the default value of -retry-codes.
+const defaultRetryCodes = "UNAVAILABLE"
+
+// maxRetries is the largest value of -max-retries, since gRPC makes at most
+// five attempts.
+const maxRetries = 4
+
+// retryPolicy returns the retry policy of a service config that makes up to
+// the given number of retries, for RPCs that fail with the given codes. gRPC
+// waits for a random duration before each retry, with an exponential backoff,
+// unless the server specifies how long to wait via the grpc-retry-pushback-ms
+// trailer, or that the RPC should not be retried.
+func retryPolicy(retries int, retryCodes map[codes.Code]bool) map[string]interface{} {
+	var codeList []int
+	for c := range retryCodes {
+		codeList = append(codeList, int(c))
+	}
+	sort.Ints(codeList)
+	return map[string]interface{}{
+		"maxAttempts":          retries + 1,
+		"initialBackoff":       "0.1s",
+		"maxBackoff":           "1s",
+		"backoffMultiplier":    2,
+		"retryableStatusCodes": codeList,
+	}
+}
+
+// retryLogger is a stats handler that reports the retry-related metadata in
+// the trailers of each attempt of an RPC, in verbose mode. Only the trailers
+// of the last attempt are otherwise shown, so this reveals server pushback
+// that caused earlier attempts to be delayed or abandoned.
+type retryLogger struct {
+	out io.Writer
+}
+
+func (l *retryLogger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (l *retryLogger) HandleRPC(_ context.Context, s stats.RPCStats) {
+	t, ok := s.(*stats.InTrailer)
+	if !ok || !t.Client {
+		return
+	}
+	var found []string
+	for _, k := range retryMetadataKeys {
+		for _, v := range t.Trailer.Get(k) {
+			found = append(found, k+": "+v)
+		}
+	}
+	if len(found) > 0 {
+		sort.Strings(found)
+		fmt.Fprintf(l.out, "\nAttempt ended with retry metadata:\n%s\n", strings.Join(found, "\n"))
+	}
+}
+
+func (l *retryLogger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (l *retryLogger) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+func TestRetryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &retryLogger{out: &buf}
+	l.HandleRPC(context.Background(), &stats.InTrailer{Client: true, Trailer: metadata.Pairs("grpc-retry-pushback-ms", "250", "other", "x")})
+	l.HandleRPC(context.Background(), &stats.InTrailer{Client: true, Trailer: metadata.Pairs("other", "x")})
+	l.HandleRPC(context.Background(), &stats.InTrailer{Client: false, Trailer: metadata.Pairs("grpc-retry-pushback-ms", "1")})
+	expected := "\nAttempt ended with retry metadata:\ngrpc-retry-pushback-ms: 250\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"                //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"golang.org/x/term"
+	"google.golang.org/grpc/codes"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// shellCommands are the commands of the interactive shell.
+var shellCommands = []string{"call", "command", "describe", "exit", "help", "history", "list"}
+
+const shellHelp = `Commands:
+  list [service]              List services, or the methods of the given service
+  describe [symbol]           Describe all services, or the given symbol
+  call method [request-data]  Invoke the given method, with request data in the
+                              form accepted by -d; the request is empty if none
+                              is given
+  command method [request-data]
+                              Print the grpcurl command line that makes the
+                              given call without the shell
+  history                     Print the commands entered in this session
+  help                        Print this help
+  exit                        Exit the shell (or press Ctrl-D)
+`
+
+// shell is the interactive shell of the 'shell' verb. All commands use the
+// same connection and descriptor source, so the cost of dialing and of
+// querying for descriptors is paid only once per session.
+type shell struct {
+	source grpcurl.DescriptorSource
+	ch     grpcdynamic.Channel
+	// headers are sent with every call
+	headers []string
+	format  grpcurl.Format
+	options grpcurl.FormatOptions
+	out     io.Writer
+	// command is the command line with which the shell was started, without
+	// its address and verb, and target is its address; with the method and
+	// request data of a call, they make the equivalent command of the call
+	command, target string
+	// printCommand, set via -print-command, prints the equivalent command of
+	// each call before it is made
+	printCommand bool
+
+	history []string
+	// the names of services and methods, for completion, which are loaded
+	// when first needed
+	services []string
+	methods  []string
+}
+
+// runShell reads and runs commands from stdin, for the 'shell' verb.
+func runShell(ctx context.Context, descSource grpcurl.DescriptorSource, ch grpcdynamic.Channel, target string, headers []string, format grpcurl.Format) {
+	sh := &shell{
+		source:  descSource,
+		ch:      ch,
+		headers: headers,
+		format:  format,
+		options: grpcurl.FormatOptions{
+			EmitJSONDefaultFields: *emitDefaults,
+			AllowUnknownFields:    *allowUnknownFields,
+			UseProtoNames:         *useProtoNames,
+		},
+		out:          os.Stdout,
+		command:      equivalentCommand(filepath.Base(os.Args[0]), flags, nil),
+		target:       target,
+		printCommand: *printCommand,
+	}
+	if err := sh.run(ctx, newLineReader(sh)); err != nil {
+		fail(err, "Failed to read command")
+	}
+}
+
+// lineReader reads the lines of input to the shell.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// newLineReader returns a reader of lines from stdin. If stdin and stdout are
+// terminals, a prompt is shown and lines are edited using the given shell's
+// completion and the history of the session; otherwise lines are read as is.
+func newLineReader(sh *shell) lineReader {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		sc := bufio.NewScanner(os.Stdin)
+		sc.Buffer(nil, 16*1024*1024)
+		return scannerLineReader{sc}
+	}
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "grpcurl> ")
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		newLine, newPos, candidates := sh.complete(line, pos)
+		if len(candidates) > 1 && newLine == line {
+			fmt.Fprintln(t, strings.Join(candidates, "  "))
+		}
+		return newLine, newPos, true
+	}
+	return terminalLineReader{t: t, fd: fd}
+}
+
+// terminalLineReader reads lines from a terminal, which is in raw mode only
+// while a line is read, so that a call can be interrupted via Ctrl-C.
+type terminalLineReader struct {
+	t  *term.Terminal
+	fd int
+}
+
+func (r terminalLineReader) ReadLine() (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = term.Restore(r.fd, state)
+	}()
+	if w, h, err := term.GetSize(r.fd); err == nil && w > 0 {
+		_ = r.t.SetSize(w, h)
+	}
+	return r.t.ReadLine()
+}
+
+type scannerLineReader struct {
+	sc *bufio.Scanner
+}
+
+func (r scannerLineReader) ReadLine() (string, error) {
+	if !r.sc.Scan() {
+		if err := r.sc.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.sc.Text(), nil
+}
+
+// run reads and runs commands from in until it ends or the 'exit' command is
+// given.
+func (sh *shell) run(ctx context.Context, in lineReader) error {
+	for {
+		line, err := in.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !sh.exec(ctx, line) {
+			return nil
+		}
+	}
+}
+
+// exec runs the given command line, returning false if the shell should exit.
+// Errors are printed, rather than ending the session.
+func (sh *shell) exec(ctx context.Context, line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+	sh.history = append(sh.history, line)
+	cmd, rest := line, ""
+	if pos := strings.IndexAny(line, " \t"); pos >= 0 {
+		cmd, rest = line[:pos], strings.TrimSpace(line[pos+1:])
+	}
+	var err error
+	switch cmd {
+	case "exit", "quit":
+		return false
+	case "help":
+		fmt.Fprint(sh.out, shellHelp)
+	case "history":
+		for i, h := range sh.history {
+			fmt.Fprintf(sh.out, "%5d  %s\n", i+1, h)
+		}
+	case "list":
+		err = sh.list(rest)
+	case "describe":
+		err = sh.describe(rest)
+	case "call", "command":
+		method, data := rest, ""
+		if pos := strings.IndexAny(rest, " \t"); pos >= 0 {
+			method, data = rest[:pos], rest[pos+1:]
+		}
+		if method == "" {
+			err = fmt.Errorf("no method given")
+		} else if cmd == "command" {
+			fmt.Fprintln(sh.out, sh.commandLine(method, data))
+		} else {
+			err = sh.call(ctx, method, data)
+		}
+	default:
+		err = fmt.Errorf("unknown command %q; type 'help' for a list of commands", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(sh.out, "Error: %v\n", err)
+	}
+	return true
+}
+
+func (sh *shell) list(svc string) error {
+	if strings.ContainsAny(svc, " \t") {
+		return fmt.Errorf("too many arguments")
+	}
+	var names []string
+	var err error
+	if svc == "" {
+		names, err = grpcurl.ListServices(sh.source)
+	} else {
+		names, err = grpcurl.ListMethods(sh.source, svc)
+	}
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		if svc == "" {
+			fmt.Fprintln(sh.out, "(No services)")
+		} else {
+			fmt.Fprintln(sh.out, "(No methods)")
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintln(sh.out, name)
+	}
+	return nil
+}
+
+func (sh *shell) describe(symbol string) error {
+	if strings.ContainsAny(symbol, " \t") {
+		return fmt.Errorf("too many arguments")
+	}
+	symbols := []string{strings.TrimPrefix(symbol, ".")}
+	if symbol == "" {
+		var err error
+		if symbols, err = sh.source.ListServices(); err != nil {
+			return err
+		}
+	}
+	for _, s := range symbols {
+		dsc, err := sh.source.FindSymbol(s)
+		if err != nil {
+			return err
+		}
+		fqn := dsc.GetFullyQualifiedName()
+		dsc, elementType, err := describedElement(dsc)
+		if err != nil {
+			return err
+		}
+		txt, err := grpcurl.GetDescriptorText(dsc, sh.source)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.out, "%s is %s:\n%s\n", fqn, elementType, txt)
+	}
+	return nil
+}
+
+// commandLine returns the grpcurl command line that invokes the given method
+// with the given request data, as the shell's 'call' command does.
+func (sh *shell) commandLine(method, data string) string {
+	words := []string{sh.command}
+	if data != "" {
+		words = append(words, "-d", shellQuote(data))
+	}
+	return strings.Join(append(words, shellQuote(sh.target), shellQuote(method)), " ")
+}
+
+// call invokes the given method with the given request data. The call is
+// cancelled if an interrupt signal is received, such as via Ctrl-C.
+func (sh *shell) call(ctx context.Context, method, data string) error {
+	if sh.printCommand {
+		fmt.Fprintln(sh.out, sh.commandLine(method, data))
+	}
+	rf, formatter, err := grpcurl.RequestParserAndFormatter(sh.format, sh.source, strings.NewReader(data), sh.options)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	h := &grpcurl.DefaultEventHandler{Out: sh.out, Formatter: formatter}
+	if err := grpcurl.InvokeRPC(ctx, sh.source, sh.ch, method, sh.headers, h, rf.Next); err != nil {
+		return err
+	}
+	if h.Status.Code() != codes.OK {
+		grpcurl.PrintStatusWithDetailTables(sh.out, h.Status, formatter)
+	}
+	return nil
+}
+
+// complete completes the word before pos in the given line: a command, or a
+// service or method name for the commands that take one. It returns the new
+// line and position, with the word extended as far as all candidates for it
+// agree, followed by a space if there is only one, and the candidates.
+func (sh *shell) complete(line string, pos int) (string, int, []string) {
+	before := line[:pos]
+	start := strings.LastIndexAny(before, " \t") + 1
+	word := before[start:]
+	var all []string
+	switch fields := strings.Fields(before[:start]); {
+	case len(fields) == 0:
+		all = shellCommands
+	case len(fields) > 1:
+		// only the first argument is completed
+	case fields[0] == "list":
+		sh.loadCompletionNames()
+		all = sh.services
+	case fields[0] == "describe":
+		sh.loadCompletionNames()
+		all = append(append([]string{}, sh.services...), sh.methods...)
+	case fields[0] == "call", fields[0] == "command":
+		sh.loadCompletionNames()
+		all = sh.methods
+	}
+	var candidates []string
+	for _, c := range all {
+		if strings.HasPrefix(c, word) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return line, pos, nil
+	}
+	completed := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completed) {
+			completed = completed[:len(completed)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		completed += " "
+	}
+	return before[:start] + completed + line[pos:], start + len(completed), candidates
+}
+
+// loadCompletionNames loads the names of services and methods, if they have
+// not been loaded already. Errors are ignored, since they would interrupt the
+// line being edited, and the names are loaded again when next needed.
+func (sh *shell) loadCompletionNames() {
+	if sh.services != nil {
+		return
+	}
+	svcs, err := listAPIServices(sh.source)
+	if err != nil {
+		return
+	}
+	var methods []string
+	for _, svc := range svcs {
+		dsc, err := sh.source.FindSymbol(svc)
+		if err != nil {
+			return
+		}
+		if sd, ok := dsc.(*desc.ServiceDescriptor); ok {
+			for _, md := range sd.GetMethods() {
+				methods = append(methods, md.GetFullyQualifiedName())
+			}
+		}
+	}
+	sort.Strings(methods)
+	sh.services, sh.methods = svcs, methods
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+type linesReader []string
+
+func (r *linesReader) ReadLine() (string, error) {
+	if len(*r) == 0 {
+		return "", io.EOF
+	}
+	line := (*r)[0]
+	*r = (*r)[1:]
+	return line, nil
+}
+
+func TestShell(t *testing.T) {
+	cc, source := startTestServer(t)
+	var out bytes.Buffer
+	sh := &shell{source: source, ch: cc, format: grpcurl.FormatJSON, out: &out}
+
+	in := linesReader{
+		"list testing.TestService",
+		"",
+		"describe testing.Payload",
+		`call testing.TestService/UnaryCall {"payload": {"body": "aGk="}}`,
+		"call testing.TestService/Nope",
+		"bogus",
+		"history",
+		"exit",
+		"list",
+	}
+	if err := sh.run(context.Background(), &in); err != nil {
+		t.Fatal(err)
+	}
+	if len(in) != 1 {
+		t.Errorf("expected shell to stop at 'exit', but %d lines remain", len(in))
+	}
+	for _, s := range []string{
+		"testing.TestService.EmptyCall\ntesting.TestService.FullDuplexCall\n",
+		"testing.Payload is a message:\nmessage Payload {",
+		"{\n  \"payload\": {\n    \"body\": \"aGk=\"\n  }\n}\n",
+		`Error: service "testing.TestService" does not include a method named "Nope"`,
+		`Error: unknown command "bogus"`,
+		"    1  list testing.TestService\n    2  describe testing.Payload\n",
+		"    6  history\n",
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected output to contain %q:\n%s", s, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "    7  ") {
+		t.Errorf("expected history to only include commands before it:\n%s", out.String())
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	cc, source := startTestServer(t)
+	var out bytes.Buffer
+	sh := &shell{source: source, ch: cc, format: grpcurl.FormatJSON, out: &out, command: "grpcurl -plaintext", target: "localhost:8080"}
+
+	in := linesReader{
+		`command testing.TestService/UnaryCall {"payload": {"body": "aGk="}}`,
+		"command testing.TestService/EmptyCall",
+		"command",
+	}
+	if err := sh.run(context.Background(), &in); err != nil {
+		t.Fatal(err)
+	}
+	expected := `grpcurl -plaintext -d '{"payload": {"body": "aGk="}}' localhost:8080 testing.TestService/UnaryCall
+grpcurl -plaintext localhost:8080 testing.TestService/EmptyCall
+Error: no method given
+`
+	if out.String() != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// with -print-command, the command of each call is printed before it is
+	// made
+	out.Reset()
+	sh.printCommand = true
+	in = linesReader{"call testing.TestService/EmptyCall"}
+	if err := sh.run(context.Background(), &in); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "grpcurl -plaintext localhost:8080 testing.TestService/EmptyCall\n{}\n"; out.String() != expected {
+		t.Errorf("expected output:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	_, source := startTestServer(t)
+	sh := &shell{source: source}
+	testCases := []struct {
+		line, expectedLine string
+		pos                int
+		expectedCandidates []string
+	}{
+		{line: "de", expectedLine: "describe "},
+		{line: "h", expectedLine: "h", expectedCandidates: []string{"help", "history"}},
+		{line: "c", expectedLine: "c", expectedCandidates: []string{"call", "command"}},
+		{line: "command testing.TestService.E", expectedLine: "command testing.TestService.EmptyCall "},
+		{line: "list testing.T", expectedLine: "list testing.TestService "},
+		{line: "list t", expectedLine: "list testing.", expectedCandidates: []string{"testing.TestService", "testing.UnimplementedService"}},
+		{line: "call testing.TestService.S", expectedLine: "call testing.TestService.Streaming", expectedCandidates: []string{"testing.TestService.StreamingInputCall", "testing.TestService.StreamingOutputCall"}},
+		{line: "call testing.TestService.U {}", pos: 26, expectedLine: "call testing.TestService.UnaryCall  {}"},
+		{line: "call testing.TestService.UnaryCall x", expectedLine: "call testing.TestService.UnaryCall x"},
+		{line: "nope x", expectedLine: "nope x"},
+	}
+	for _, tc := range testCases {
+		pos := tc.pos
+		if pos == 0 {
+			pos = len(tc.line)
+		}
+		line, newPos, candidates := sh.complete(tc.line, pos)
+		if line != tc.expectedLine {
+			t.Errorf("%q: expected %q, got %q", tc.line, tc.expectedLine, line)
+		}
+		if len(candidates) > 1 && !reflect.DeepEqual(candidates, tc.expectedCandidates) {
+			t.Errorf("%q: expected candidates %q, got %q", tc.line, tc.expectedCandidates, candidates)
+		}
+		if expected := len(tc.expectedLine) - (len(tc.line) - pos); newPos != expected {
+			t.Errorf("%q: expected position %d, got %d", tc.line, expected, newPos)
+		}
+	}
+}
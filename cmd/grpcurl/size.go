@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// dominantFieldShare is the fraction of a message's encoded size above which
+// a single field is flagged by -size-estimate as dominating the size.
+const dominantFieldShare = 0.5
+
+// messageSize is the encoded size of a message, broken down by field.
+type messageSize struct {
+	total  int
+	fields []fieldSize
+}
+
+type fieldSize struct {
+	name string
+	size int
+}
+
+// measureMessage computes the encoded size of the given message and of each
+// of its fields that is set. Since the binary format is a concatenation of
+// encoded fields, the field sizes (which include tags) add up to the total,
+// except for any unknown fields and extensions.
+func measureMessage(m proto.Message) (messageSize, error) {
+	dm, err := dynamic.AsDynamicMessage(m)
+	if err != nil {
+		return messageSize{}, err
+	}
+	b, err := dm.Marshal()
+	if err != nil {
+		return messageSize{}, err
+	}
+	result := messageSize{total: len(b)}
+	md := dm.GetMessageDescriptor()
+	for _, fd := range md.GetFields() {
+		if !dm.HasField(fd) {
+			continue
+		}
+		single := dynamic.NewMessage(md)
+		single.SetField(fd, dm.GetField(fd))
+		b, err := single.Marshal()
+		if err != nil {
+			return messageSize{}, err
+		}
+		if len(b) > 0 {
+			result.fields = append(result.fields, fieldSize{name: fd.GetName(), size: len(b)})
+		}
+	}
+	return result, nil
+}
+
+// minimalMessage returns the smallest valid message of the given type, which
+// has only its required fields set, to their default values.
+func minimalMessage(md *desc.MessageDescriptor) *dynamic.Message {
+	return makeMinimalMessage(md, nil)
+}
+
+func makeMinimalMessage(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) *dynamic.Message {
+	dm := dynamic.NewMessage(md)
+	for _, seen := range path {
+		if seen == md {
+			// a required field that recursively refers to its own type
+			// cannot be satisfied, so stop here
+			return dm
+		}
+	}
+	path = append(path, md)
+	for _, fd := range md.GetFields() {
+		if !fd.IsRequired() {
+			continue
+		}
+		if fd.GetMessageType() != nil {
+			dm.SetField(fd, makeMinimalMessage(fd.GetMessageType(), path))
+		} else {
+			dm.SetField(fd, fd.GetDefaultValue())
+		}
+	}
+	return dm
+}
+
+// printSizeEstimate prints the output of -size-estimate for the given message
+// type: the minimum encoded size and the size of either the message template
+// or, if data was given via -d, each message in it.
+func printSizeEstimate(out io.Writer, md *desc.MessageDescriptor, descSource grpcurl.DescriptorSource, format grpcurl.Format, data []string, options grpcurl.FormatOptions) error {
+	fmt.Fprintln(out, "\nEncoded size estimate:")
+	if err := printMessageSize(out, "minimum", minimalMessage(md)); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return printMessageSize(out, "template", grpcurl.MakeTemplate(md))
+	}
+	in, err := openRequestData(data, format)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	rp, _, err := grpcurl.RequestParserAndFormatter(format, descSource, in, options)
+	if err != nil {
+		return err
+	}
+	for i := 1; ; i++ {
+		msg := dynamic.NewMessage(md)
+		if err := rp.Next(msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error getting message %d: %v", i, err)
+		}
+		if err := printMessageSize(out, fmt.Sprintf("message %d", i), msg); err != nil {
+			return err
+		}
+	}
+}
+
+// printMessageSize prints the encoded size of the given message along with
+// the share of each field, flagging those that dominate.
+func printMessageSize(out io.Writer, label string, m proto.Message) error {
+	size, err := measureMessage(m)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "  %s: %d bytes\n", label, size.total)
+	for _, f := range size.fields {
+		share := float64(f.size) / float64(size.total)
+		var flag string
+		if share > dominantFieldShare {
+			flag = " (dominant)"
+		}
+		fmt.Fprintf(out, "    %-24s %6d bytes %5.1f%%%s\n", f.name, f.size, share*100, flag)
+	}
+	return nil
+}
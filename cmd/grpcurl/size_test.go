@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestMeasureMessage(t *testing.T) {
+	msg := &grpcurl_testing.SimpleRequest{
+		ResponseSize: 100,
+		Payload:      &grpcurl_testing.Payload{Body: make([]byte, 20)},
+	}
+	size, err := measureMessage(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// response_size: tag + varint(100); payload: tag + length + (tag + length + 20 bytes)
+	expected := messageSize{
+		total:  26,
+		fields: []fieldSize{{name: "response_size", size: 2}, {name: "payload", size: 24}},
+	}
+	if !reflect.DeepEqual(size, expected) {
+		t.Errorf("expected %+v, got %+v", expected, size)
+	}
+}
+
+func TestMinimalMessage(t *testing.T) {
+	md, err := desc.LoadMessageDescriptorForMessage(&descriptorpb.UninterpretedOption_NamePart{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := measureMessage(minimalMessage(md))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// both fields are required: an empty string and false
+	if size.total != 4 {
+		t.Errorf("expected minimum size of 4 bytes, got %d", size.total)
+	}
+
+	md, err = desc.LoadMessageDescriptorForMessage(&grpcurl_testing.SimpleRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, err := measureMessage(minimalMessage(md)); err != nil || size.total != 0 {
+		t.Errorf("expected empty message, got %+v (err %v)", size, err)
+	}
+}
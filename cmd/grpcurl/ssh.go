@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshScheme is the prefix of addresses that are reached via an SSH tunnel,
+// like 'ssh://user@bastion/host:port'.
+const sshScheme = "ssh://"
+
+// defaultSSHKeyFiles are the private keys, in ~/.ssh, that are tried when
+// -ssh-key is not given.
+var defaultSSHKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshTunnel dials connections to the server through an SSH server, such as a
+// bastion or jump host, using SSH port forwarding. The SSH connection is made
+// when the first connection is dialed and is shared by later ones.
+type sshTunnel struct {
+	// user is the user name for the SSH server
+	user string
+	// server is the SSH server, in 'host:port' form
+	server string
+	// target is the address of the gRPC server, in 'host:port' form, as seen
+	// from the SSH server
+	target string
+	// keyFile is the private key given via -ssh-key, if any
+	keyFile string
+	// knownHostsFile is used to verify the SSH server's host key
+	knownHostsFile string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// parseSSHTarget parses an address like 'ssh://user@bastion:22/host:port'.
+// The user defaults to the current user and the port of the SSH server to 22.
+func parseSSHTarget(address string) (*sshTunnel, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("%q has no SSH server; use 'ssh://[user@]host[:port]/target-host:target-port'", address)
+	}
+	target := strings.TrimPrefix(u.Path, "/")
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		return nil, fmt.Errorf("%q: the target after the SSH server must be in 'host:port' form", address)
+	}
+	t := &sshTunnel{server: u.Host, target: target}
+	if u.Port() == "" {
+		t.server = net.JoinHostPort(u.Hostname(), "22")
+	}
+	if u.User != nil {
+		t.user = u.User.Username()
+	} else if cur, err := user.Current(); err == nil {
+		t.user = cur.Username
+	} else {
+		return nil, fmt.Errorf("%q has no user name and the current user is unknown: %v", address, err)
+	}
+	return t, nil
+}
+
+// sshDialError is an error connecting to the SSH server. It is not temporary,
+// so that gRPC reports it instead of retrying until the connect timeout.
+type sshDialError struct {
+	err error
+}
+
+func (e sshDialError) Error() string {
+	return e.err.Error()
+}
+
+func (e sshDialError) Unwrap() error {
+	return e.err
+}
+
+func (e sshDialError) Temporary() bool {
+	return false
+}
+
+// dial connects to the given address, which is the target, via the SSH
+// server. It is used as gRPC's dialer. The SSH connection and handshake must
+// complete before the given context is done.
+func (t *sshTunnel) dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, sshDialError{err}
+	}
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s via SSH server %s: %w", addr, t.server, err)
+	}
+	return conn, nil
+}
+
+func (t *sshTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	auth, err := t.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := knownhosts.New(t.knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH known hosts file: %w", err)
+	}
+	config := &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", t.server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server %s: %w", t.server, err)
+	}
+	// the handshake does not take a context, so it is bounded by a deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.server, config)
+	if err != nil {
+		conn.Close()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("SSH server %s is not in %s; connect to it once with ssh to add it", t.server, t.knownHostsFile)
+		}
+		return nil, fmt.Errorf("SSH handshake with %s failed: %w", t.server, err)
+	}
+	conn.SetDeadline(time.Time{})
+	t.client = ssh.NewClient(c, chans, reqs)
+	return t.client, nil
+}
+
+// authMethods returns the ways to authenticate with the SSH server: the key
+// given via -ssh-key or, if none was given, the keys in the SSH agent and the
+// default key files that are not protected by a passphrase.
+func (t *sshTunnel) authMethods() ([]ssh.AuthMethod, error) {
+	if t.keyFile != "" {
+		signer, err := readSSHKey(t.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			debugf(debugTransport, "Failed to connect to SSH agent: %v", err)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		var signers []ssh.Signer
+		for _, name := range defaultSSHKeyFiles {
+			signer, err := readSSHKey(filepath.Join(home, ".ssh", name))
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					debugf(debugTransport, "Not using SSH key: %v", err)
+				}
+				continue
+			}
+			signers = append(signers, signer)
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+		}
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH keys found; start an SSH agent or use -ssh-key")
+	}
+	return methods, nil
+}
+
+func readSSHKey(fileName string) (ssh.Signer, error) {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		var passErr *ssh.PassphraseMissingError
+		if errors.As(err, &passErr) {
+			return nil, fmt.Errorf("%s is protected by a passphrase; add it to an SSH agent instead", fileName)
+		}
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	return signer, nil
+}
+
+// defaultSSHKnownHostsFile returns the path of the user's SSH known_hosts file.
+func defaultSSHKnownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ssh", "known_hosts"), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestParseSSHTarget(t *testing.T) {
+	testCases := []struct {
+		address, user, server, target string
+	}{
+		{"ssh://alice@bastion/backend:443", "alice", "bastion:22", "backend:443"},
+		{"ssh://alice@bastion:2222/backend:443", "alice", "bastion:2222", "backend:443"},
+		{"ssh://bob@[2001:db8::1]/10.0.0.1:50051", "bob", "[2001:db8::1]:22", "10.0.0.1:50051"},
+		{"ssh://alice@bastion/[2001:db8::2]:443", "alice", "bastion:22", "[2001:db8::2]:443"},
+	}
+	for _, tc := range testCases {
+		tun, err := parseSSHTarget(tc.address)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.address, err)
+			continue
+		}
+		if tun.user != tc.user || tun.server != tc.server || tun.target != tc.target {
+			t.Errorf("%s: expected %s, %s, %s; got %s, %s, %s", tc.address, tc.user, tc.server, tc.target, tun.user, tun.server, tun.target)
+		}
+	}
+
+	for _, address := range []string{"ssh://alice@bastion", "ssh://alice@bastion/backend", "ssh:///backend:443"} {
+		if _, err := parseSSHTarget(address); err == nil {
+			t.Errorf("expected error for %q", address)
+		}
+	}
+}
+
+func TestSSHTunnelDial(t *testing.T) {
+	dir := t.TempDir()
+	hostSigner := newTestSSHSigner(t, "")
+	clientSigner := newTestSSHSigner(t, filepath.Join(dir, "id"))
+	sshAddr := startTestSSHServer(t, hostSigner, clientSigner.PublicKey())
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(sshAddr)}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// an echo server, reached via the SSH server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	tun := &sshTunnel{user: "alice", server: sshAddr, keyFile: filepath.Join(dir, "id"), knownHostsFile: knownHosts}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tun.dial(ctx, l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected %q, got %q", "ping", buf)
+	}
+
+	// the host key is verified
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tun = &sshTunnel{user: "alice", server: sshAddr, keyFile: filepath.Join(dir, "id"), knownHostsFile: knownHosts}
+	_, err = tun.dial(ctx, l.Addr().String())
+	if err == nil || !strings.Contains(err.Error(), "is not in") {
+		t.Errorf("expected unknown host error, got %v", err)
+	}
+	if tmp, ok := err.(interface{ Temporary() bool }); !ok || tmp.Temporary() {
+		t.Errorf("expected error to not be temporary")
+	}
+}
+
+// newTestSSHSigner creates a key and, if fileName is not empty, writes its
+// private key to the file.
+func newTestSSHSigner(t *testing.T, fileName string) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileName != "" {
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fileName, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startTestSSHServer starts an SSH server that accepts the given client key
+// and supports port forwarding. It returns the server's address.
+func startTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) string {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					if ch.ChannelType() != "direct-tcpip" {
+						_ = ch.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					var req struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if err := ssh.Unmarshal(ch.ExtraData(), &req); err != nil {
+						_ = ch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					target, err := net.Dial("tcp", net.JoinHostPort(req.Host, strconv.FormatUint(uint64(req.Port), 10)))
+					if err != nil {
+						_ = ch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					c, creqs, err := ch.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(creqs)
+					go func() {
+						_, _ = io.Copy(target, c)
+						target.Close()
+					}()
+					go func() {
+						_, _ = io.Copy(c, target)
+						c.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// callStats counts the bytes in the messages of a call, for -stats-line.
+type callStats struct {
+	mu                          sync.Mutex
+	requestBytes, responseBytes int
+}
+
+func (s *callStats) wrapParser(rp grpcurl.RequestParser) grpcurl.RequestParser {
+	return &statsRequestParser{RequestParser: rp, s: s}
+}
+
+func (s *callStats) wrapHandler(h grpcurl.InvocationEventHandler) grpcurl.InvocationEventHandler {
+	return &statsHandler{InvocationEventHandler: h, s: s}
+}
+
+type statsRequestParser struct {
+	grpcurl.RequestParser
+	s *callStats
+}
+
+func (p *statsRequestParser) Next(m proto.Message) error {
+	err := p.RequestParser.Next(m)
+	if err == nil {
+		p.s.mu.Lock()
+		p.s.requestBytes += proto.Size(m)
+		p.s.mu.Unlock()
+	}
+	return err
+}
+
+type statsHandler struct {
+	grpcurl.InvocationEventHandler
+	s *callStats
+}
+
+func (h *statsHandler) OnReceiveResponse(resp proto.Message) {
+	h.s.mu.Lock()
+	h.s.responseBytes += proto.Size(resp)
+	h.s.mu.Unlock()
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+// statsLine is the line printed via -stats-line. Byte counts are of the
+// messages' binary encoding, before any compression.
+type statsLine struct {
+	Requests      int     `json:"requests"`
+	Responses     int     `json:"responses"`
+	RequestBytes  int     `json:"requestBytes"`
+	ResponseBytes int     `json:"responseBytes"`
+	DurationMs    float64 `json:"durationMs"`
+	Status        string  `json:"status"`
+	Code          int     `json:"code"`
+}
+
+func newStatsLine(s *callStats, requests, responses int, d time.Duration, stat *status.Status) statsLine {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return statsLine{
+		Requests:      requests,
+		Responses:     responses,
+		RequestBytes:  s.requestBytes,
+		ResponseBytes: s.responseBytes,
+		DurationMs:    durationMillis(d),
+		Status:        stat.Code().String(),
+		Code:          int(stat.Code()),
+	}
+}
+
+// write writes the line in the given format, which is "json" or "kv" (for
+// space-separated key=value pairs).
+func (l statsLine) write(w io.Writer, format string) error {
+	if format == "json" {
+		b, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "requests=%d responses=%d requestBytes=%d responseBytes=%d durationMs=%s status=%s code=%d\n",
+		l.Requests, l.Responses, l.RequestBytes, l.ResponseBytes, strconv.FormatFloat(l.DurationMs, 'f', -1, 64), l.Status, l.Code)
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStatsLine(t *testing.T) {
+	line := statsLine{
+		Requests:      3,
+		Responses:     5,
+		RequestBytes:  30,
+		ResponseBytes: 500,
+		DurationMs:    12.5,
+		Status:        "NotFound",
+		Code:          5,
+	}
+	testCases := map[string]string{
+		"kv":   "requests=3 responses=5 requestBytes=30 responseBytes=500 durationMs=12.5 status=NotFound code=5\n",
+		"json": `{"requests":3,"responses":5,"requestBytes":30,"responseBytes":500,"durationMs":12.5,"status":"NotFound","code":5}` + "\n",
+	}
+	for format, expected := range testCases {
+		var sb strings.Builder
+		if err := line.write(&sb, format); err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if sb.String() != expected {
+			t.Errorf("%s: expected %q, got %q", format, expected, sb.String())
+		}
+	}
+}
+
+func TestNewStatsLine(t *testing.T) {
+	stats := &callStats{requestBytes: 10, responseBytes: 20}
+	line := newStatsLine(stats, 1, 2, 1500*time.Microsecond, status.New(codes.Unavailable, "down"))
+	expected := statsLine{
+		Requests:      1,
+		Responses:     2,
+		RequestBytes:  10,
+		ResponseBytes: 20,
+		DurationMs:    1.5,
+		Status:        "Unavailable",
+		Code:          14,
+	}
+	if line != expected {
+		t.Errorf("expected %+v, got %+v", expected, line)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// supportCheckTimeout bounds each of the checks made for a support bundle, so
+// that an unresponsive server does not prevent the bundle from being written.
+const supportCheckTimeout = 10 * time.Second
+
+// redactedHeaderFlags are the flags whose values are headers, which are
+// redacted in a support bundle since they often carry credentials.
+var redactedHeaderFlags = map[string]bool{"H": true, "rpc-header": true, "reflect-header": true}
+
+// runSupportBundle checks that the server at the given address can be
+// resolved, dialed using tryDial, and reached with reflection and health
+// checks, and writes the results to a support bundle, for the
+// 'support-bundle' verb. The given headers are sent with the reflection and
+// health checks, respectively.
+func runSupportBundle(ctx context.Context, target string, reflHeaders, rpcHeaders []string, tryDial func() (*grpc.ClientConn, *handshakeRecorder, error)) {
+	bundle := newSupportBundle()
+	bundle.writeVersionInfo(os.Args)
+	bundle.checkResolution(ctx, target)
+	dialStart := time.Now()
+	cc, handshake, err := tryDial()
+	bundle.checkConnection(target, time.Since(dialStart), handshake, err)
+	if cc != nil {
+		bundle.checkReflection(ctx, cc, reflHeaders, *reflectVersion)
+		bundle.checkHealth(ctx, cc, rpcHeaders)
+		cc.Close()
+	}
+	fileName := *bundleOut
+	if fileName == "" {
+		fileName = defaultSupportBundleName(bundle.created)
+	}
+	if err := bundle.write(fileName); err != nil {
+		fail(err, "Failed to write support bundle to %s", fileName)
+	}
+	fmt.Printf("Wrote support bundle to %s\n", fileName)
+}
+
+// supportBundle is an archive of diagnostics written by the 'support-bundle'
+// verb.
+type supportBundle struct {
+	created time.Time
+	names   []string
+	files   map[string]*bytes.Buffer
+}
+
+func newSupportBundle() *supportBundle {
+	return &supportBundle{created: time.Now(), files: map[string]*bytes.Buffer{}}
+}
+
+// file returns the buffer for the named file in the bundle, creating it if
+// necessary.
+func (b *supportBundle) file(name string) *bytes.Buffer {
+	buf := b.files[name]
+	if buf == nil {
+		buf = &bytes.Buffer{}
+		b.files[name] = buf
+		b.names = append(b.names, name)
+	}
+	return buf
+}
+
+// write writes the bundle as a gzipped tar archive with the given name. All
+// files are placed in a directory named after the archive.
+func (b *supportBundle) write(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	dir := filepath.Base(fileName)
+	for _, ext := range []string{".tgz", ".gz", ".tar"} {
+		dir = strings.TrimSuffix(dir, ext)
+	}
+	for _, name := range b.names {
+		content := b.files[name].Bytes()
+		hdr := &tar.Header{
+			Name:    dir + "/" + name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: b.created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// defaultSupportBundleName returns the name of the archive written when
+// -bundle-out is not present.
+func defaultSupportBundleName(t time.Time) string {
+	return fmt.Sprintf("grpcurl-support-%s.tar.gz", t.Format("20060102-150405"))
+}
+
+// redactArgs returns the given command-line arguments with the values of
+// headers removed, leaving only their names.
+func redactArgs(args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 0; i < len(result); i++ {
+		arg := result[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if pos := strings.IndexByte(name, '='); pos >= 0 {
+			if redactedHeaderFlags[name[:pos]] {
+				result[i] = arg[:len(arg)-len(name)+pos+1] + redactHeader(name[pos+1:])
+			}
+			continue
+		}
+		if redactedHeaderFlags[name] && i+1 < len(result) {
+			i++
+			result[i] = redactHeader(result[i])
+		}
+	}
+	return result
+}
+
+func redactHeader(header string) string {
+	if pos := strings.IndexByte(header, ':'); pos >= 0 {
+		return header[:pos] + ": <redacted>"
+	}
+	return "<redacted>"
+}
+
+// writeVersionInfo describes the versions of grpcurl, gRPC, and Go, along
+// with the redacted command line, to the bundle.
+func (b *supportBundle) writeVersionInfo(args []string) {
+	w := b.file("version.txt")
+	fmt.Fprintf(w, "grpcurl: %s\n", version)
+	fmt.Fprintf(w, "grpc-go: %s\n", grpc.Version)
+	fmt.Fprintf(w, "Go: %s\n", runtime.Version())
+	fmt.Fprintf(w, "Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(w, "Created: %s\n", b.created.Format(time.RFC3339))
+	fmt.Fprintf(w, "Command: %s\n", strings.Join(redactArgs(args), " "))
+}
+
+// checkResolution records the addresses to which the given target's host
+// resolves. Targets that do not use DNS are noted as such.
+func (b *supportBundle) checkResolution(ctx context.Context, target string) {
+	w := b.file("connectivity.txt")
+	host, _, err := net.SplitHostPort(target)
+	if err != nil || strings.Contains(target, "://") {
+		fmt.Fprintf(w, "Resolution: skipped for %s\n", target)
+		return
+	}
+	if net.ParseIP(host) != nil {
+		fmt.Fprintf(w, "Resolution: %s is an IP address\n", host)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, supportCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		fmt.Fprintf(w, "Resolution: failed after %v: %v\n", time.Since(start), err)
+		return
+	}
+	fmt.Fprintf(w, "Resolution: %s resolved to %s in %v\n", host, strings.Join(addrs, ", "), time.Since(start))
+}
+
+// checkConnection records the outcome of dialing the target, including
+// details about the handshake.
+func (b *supportBundle) checkConnection(target string, d time.Duration, handshake *handshakeRecorder, err error) {
+	w := b.file("connectivity.txt")
+	if err != nil {
+		fmt.Fprintf(w, "Connection: failed after %v: %v\n", d, err)
+		return
+	}
+	fmt.Fprintf(w, "Connection: succeeded in %v\n", d)
+	printHandshakeDetails(w, target, handshake)
+}
+
+// checkReflection records the services listed via server reflection, and the
+// version of the reflection service that listed them.
+func (b *supportBundle) checkReflection(ctx context.Context, cc *grpc.ClientConn, headers []string, version string) {
+	w := b.file("reflection.txt")
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, grpcurl.MetadataFromHeaders(headers)), supportCheckTimeout)
+	defer cancel()
+	refClient := newReflectionClient(ctx, cc, version, func(version, reason string) {
+		if reason != "" {
+			fmt.Fprintf(w, "Version: %s (%s)\n", version, reason)
+		} else {
+			fmt.Fprintf(w, "Version: %s\n", version)
+		}
+	})
+	defer refClient.Reset()
+	svcs, err := refClient.ListServices()
+	if err != nil {
+		fmt.Fprintf(w, "Failed to list services: %v\n", err)
+		return
+	}
+	if len(svcs) == 0 {
+		fmt.Fprintln(w, "(No services)")
+	}
+	for _, svc := range svcs {
+		fmt.Fprintln(w, svc)
+	}
+}
+
+// checkHealth records the server's overall status, as reported by the
+// standard health checking service.
+func (b *supportBundle) checkHealth(ctx context.Context, cc *grpc.ClientConn, headers []string) {
+	w := b.file("health.txt")
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, grpcurl.MetadataFromHeaders(headers)), supportCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := grpc_health_v1.NewHealthClient(cc).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		fmt.Fprintf(w, "Health check failed after %v: %v\n", time.Since(start), err)
+		return
+	}
+	fmt.Fprintf(w, "Status: %s (in %v)\n", resp.GetStatus(), time.Since(start))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"grpcurl", "-H", "authorization: Bearer abc", "--rpc-header=x-api-key: 123", "-reflect-header", "token", "-plaintext", "support-bundle", "localhost:1234"}
+	expected := []string{"grpcurl", "-H", "authorization: <redacted>", "--rpc-header=x-api-key: <redacted>", "-reflect-header", "<redacted>", "-plaintext", "support-bundle", "localhost:1234"}
+	if actual := redactArgs(args); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestSupportBundleWrite(t *testing.T) {
+	b := newSupportBundle()
+	fmt.Fprintln(b.file("a.txt"), "first")
+	fmt.Fprintln(b.file("b.txt"), "second")
+	fmt.Fprintln(b.file("a.txt"), "more")
+
+	fileName := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	if err := b.write(fileName); err != nil {
+		t.Fatalf("failed to write bundle: %v", err)
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	contents := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = string(b)
+	}
+	expected := map[string]string{"bundle/a.txt": "first\nmore\n", "bundle/b.txt": "second\n"}
+	if !reflect.DeepEqual(contents, expected) {
+		t.Errorf("expected %q, got %q", expected, contents)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+)
+
+// systemProxy is the proxy configuration in the operating system's settings,
+// such as those managed via System Settings on macOS or Internet Options on
+// Windows.
+type systemProxy struct {
+	// httpsProxy is the address, in 'host:port' form, of the HTTP CONNECT
+	// proxy used for secure connections, or empty if there is none
+	httpsProxy string
+	// noProxy is a list of hosts, domains, and CIDR blocks that are not
+	// proxied, in the form of the NO_PROXY environment variable
+	noProxy []string
+	// pacURL is the URL of a proxy auto-config file, if one is configured
+	pacURL string
+}
+
+// proxyEnvVars are the environment variables that configure a proxy. If any
+// of them is set, the system's settings are not used.
+var proxyEnvVars = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// useSystemProxy configures the gRPC dialer, which honors the HTTPS_PROXY and
+// NO_PROXY environment variables, to use the system's proxy, unless those
+// variables are already set. It must be called before the first connection
+// is dialed.
+func useSystemProxy() {
+	for _, name := range proxyEnvVars {
+		if os.Getenv(name) != "" {
+			debugf(debugTransport, "Using proxy from the %s environment variable", name)
+			return
+		}
+	}
+	p, err := systemProxySettings()
+	if err != nil {
+		debugf(debugTransport, "Failed to read system proxy settings: %v", err)
+		return
+	}
+	if p == nil {
+		return
+	}
+	if p.httpsProxy == "" {
+		if p.pacURL != "" {
+			debugf(debugTransport, "Not using the proxy auto-config file %s: PAC files are not supported; set HTTPS_PROXY instead", p.pacURL)
+		}
+		return
+	}
+	debugf(debugTransport, "Using system proxy %s", p.httpsProxy)
+	os.Setenv("HTTPS_PROXY", "http://"+p.httpsProxy)
+	if len(p.noProxy) > 0 && os.Getenv("NO_PROXY") == "" && os.Getenv("no_proxy") == "" {
+		os.Setenv("NO_PROXY", strings.Join(p.noProxy, ","))
+	}
+}
+
+// parseScutilProxy parses the output of 'scutil --proxy', which prints the
+// proxy settings on macOS, like so:
+//
+//	<dictionary> {
+//	  ExceptionsList : <array> {
+//	    0 : *.local
+//	  }
+//	  HTTPSEnable : 1
+//	  HTTPSPort : 8080
+//	  HTTPSProxy : proxy.example.com
+//	}
+func parseScutilProxy(output string) *systemProxy {
+	values := map[string]string{}
+	var exceptions []string
+	inExceptions := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "}" {
+			inExceptions = false
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		if inExceptions {
+			exceptions = append(exceptions, value)
+		} else if key == "ExceptionsList" {
+			inExceptions = true
+		} else {
+			values[key] = value
+		}
+	}
+
+	var p systemProxy
+	if values["HTTPSEnable"] == "1" && values["HTTPSProxy"] != "" {
+		port := values["HTTPSPort"]
+		if port == "" {
+			port = "80"
+		}
+		p.httpsProxy = values["HTTPSProxy"] + ":" + port
+	}
+	if values["ProxyAutoConfigEnable"] == "1" {
+		p.pacURL = values["ProxyAutoConfigURLString"]
+	}
+	p.noProxy = noProxyEntries(exceptions)
+	return &p
+}
+
+// parseWindowsProxy parses the proxy settings on Windows, which are values
+// in the 'Internet Settings' registry key. The server is either a single
+// 'host:port' for all protocols or a list like 'http=host:80;https=host:443'.
+// The overrides are a semicolon-separated list of hosts that are not proxied.
+func parseWindowsProxy(enabled bool, server, overrides, pacURL string) *systemProxy {
+	p := systemProxy{pacURL: pacURL}
+	if enabled && server != "" {
+		if !strings.Contains(server, "=") {
+			p.httpsProxy = server
+		} else {
+			for _, entry := range strings.Split(server, ";") {
+				if scheme, addr, ok := strings.Cut(entry, "="); ok && strings.EqualFold(scheme, "https") {
+					p.httpsProxy = addr
+				}
+			}
+		}
+		p.httpsProxy = strings.TrimPrefix(p.httpsProxy, "http://")
+		if _, _, err := net.SplitHostPort(p.httpsProxy); p.httpsProxy != "" && err != nil {
+			p.httpsProxy = net.JoinHostPort(p.httpsProxy, "80")
+		}
+	}
+	p.noProxy = noProxyEntries(strings.Split(overrides, ";"))
+	return &p
+}
+
+// noProxyEntries converts a list of exceptions from the system's settings to
+// NO_PROXY entries. Wildcards are only supported as a prefix, like '*.local',
+// so other entries with wildcards, and the special '<local>' entry on Windows,
+// are omitted.
+func noProxyEntries(exceptions []string) []string {
+	var entries []string
+	for _, e := range exceptions {
+		e = strings.TrimSpace(e)
+		if strings.HasPrefix(e, "*.") {
+			e = e[1:]
+		}
+		if e == "" || strings.ContainsAny(e, "*<>") {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os/exec"
+)
+
+// systemProxySettings returns the proxy settings of macOS, via scutil.
+func systemProxySettings() (*systemProxy, error) {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseScutilProxy(string(out)), nil
+}
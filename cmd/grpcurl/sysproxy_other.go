@@ -0,0 +1,9 @@
+//go:build !darwin && !windows
+
+package main
+
+// systemProxySettings returns nil, since there are no system-wide proxy
+// settings other than the environment variables, which gRPC already uses.
+func systemProxySettings() (*systemProxy, error) {
+	return nil, nil
+}
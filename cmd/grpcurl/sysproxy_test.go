@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScutilProxy(t *testing.T) {
+	output := `<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254.0.0/16
+    2 : internal.example.com
+  }
+  FTPPassive : 1
+  HTTPEnable : 1
+  HTTPPort : 3128
+  HTTPProxy : proxy.example.com
+  HTTPSEnable : 1
+  HTTPSPort : 3129
+  HTTPSProxy : secure-proxy.example.com
+  ProxyAutoConfigEnable : 1
+  ProxyAutoConfigURLString : http://wpad.example.com/proxy.pac
+}
+`
+	p := parseScutilProxy(output)
+	expected := &systemProxy{
+		httpsProxy: "secure-proxy.example.com:3129",
+		noProxy:    []string{".local", "169.254.0.0/16", "internal.example.com"},
+		pacURL:     "http://wpad.example.com/proxy.pac",
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("expected %+v, got %+v", expected, p)
+	}
+
+	p = parseScutilProxy("<dictionary> {\n  HTTPSEnable : 0\n  HTTPSProxy : proxy.example.com\n}\n")
+	if p.httpsProxy != "" {
+		t.Errorf("expected no proxy when disabled, got %q", p.httpsProxy)
+	}
+}
+
+func TestParseWindowsProxy(t *testing.T) {
+	testCases := []struct {
+		enabled  bool
+		server   string
+		expected string
+	}{
+		{true, "proxy.example.com:8080", "proxy.example.com:8080"},
+		{true, "http=proxy.example.com:80;https=secure.example.com:443", "secure.example.com:443"},
+		{true, "http=proxy.example.com:80", ""},
+		{true, "proxy.example.com", "proxy.example.com:80"},
+		{false, "proxy.example.com:8080", ""},
+	}
+	for _, tc := range testCases {
+		p := parseWindowsProxy(tc.enabled, tc.server, "", "")
+		if p.httpsProxy != tc.expected {
+			t.Errorf("%q (enabled=%v): expected %q, got %q", tc.server, tc.enabled, tc.expected, p.httpsProxy)
+		}
+	}
+
+	p := parseWindowsProxy(true, "proxy:8080", "*.corp.example.com;10.*;<local>", "http://wpad/proxy.pac")
+	if expected := []string{".corp.example.com"}; !reflect.DeepEqual(p.noProxy, expected) {
+		t.Errorf("expected %v, got %v", expected, p.noProxy)
+	}
+	if p.pacURL != "http://wpad/proxy.pac" {
+		t.Errorf("wrong PAC URL: %q", p.pacURL)
+	}
+}
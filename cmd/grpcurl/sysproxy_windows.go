@@ -0,0 +1,20 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// systemProxySettings returns the proxy settings of Windows, from the
+// current user's Internet Settings.
+func systemProxySettings() (*systemProxy, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	enabled, _, _ := k.GetIntegerValue("ProxyEnable")
+	server, _, _ := k.GetStringValue("ProxyServer")
+	overrides, _, _ := k.GetStringValue("ProxyOverride")
+	pacURL, _, _ := k.GetStringValue("AutoConfigURL")
+	return parseWindowsProxy(enabled != 0, server, overrides, pacURL), nil
+}
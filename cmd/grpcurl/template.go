@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+var outputTemplateFuncs = template.FuncMap{
+	// json renders a value as compact JSON, which is useful for nested
+	// objects and lists.
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+}
+
+func parseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(outputTemplateFuncs).Parse(text)
+}
+
+// templateFormatter returns a formatter that renders the JSON produced by the
+// given formatter using the given template. The template's input is the
+// decoded JSON, so fields are accessed by their JSON names, like {{.user.id}}.
+func templateFormatter(tmpl *template.Template, formatter grpcurl.Formatter) grpcurl.Formatter {
+	return func(msg proto.Message) (string, error) {
+		str, err := formatter(msg)
+		if err != nil {
+			return "", err
+		}
+		var input interface{}
+		dec := json.NewDecoder(strings.NewReader(str))
+		// keep numbers in their original form, instead of as floats
+		dec.UseNumber()
+		if err := dec.Decode(&input); err != nil {
+			return "", err
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, input); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+}
+
+var requestTemplateFuncs = template.FuncMap{
+	// uuid returns a random (version 4) UUID.
+	"uuid": newUUID,
+	// now returns the current time in RFC 3339 format, which is the JSON
+	// format for google.protobuf.Timestamp.
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339Nano)
+	},
+	// randInt returns a random integer between min and max, inclusive.
+	"randInt": func(min, max int64) (int64, error) {
+		if max < min {
+			return 0, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(max-min+1))
+		if err != nil {
+			return 0, err
+		}
+		return min + n.Int64(), nil
+	},
+	// env returns the value of an environment variable, or the empty
+	// string if it is not set.
+	"env": os.Getenv,
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// expandRequestTemplate reads all of the given request data and executes it
+// as a template, for -d-template. The returned reader's Close method closes
+// the given reader.
+func expandRequestTemplate(in io.ReadCloser) (io.ReadCloser, error) {
+	text, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New("request").Funcs(requestTemplateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, nil); err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&out, in}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestTemplateFormatter(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":   12345678,
+			"name": "abc",
+			"tags": []interface{}{"x", "y"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := parseOutputTemplate(`{{.user.id}} {{.user.name}} {{json .user.tags}}`)
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+	actual, err := templateFormatter(tmpl, grpcurl.NewJSONFormatter(false, nil))(msg)
+	if err != nil {
+		t.Fatalf("failed to format: %v", err)
+	}
+	if expected := `12345678 abc ["x","y"]`; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestExpandRequestTemplate(t *testing.T) {
+	t.Setenv("GRPCURL_TEST_VALUE", "abc")
+	in := io.NopCloser(strings.NewReader(`{{uuid}} {{uuid}}|{{now}}|{{randInt 5 7}}|{{env "GRPCURL_TEST_VALUE"}}`))
+	r, err := expandRequestTemplate(in)
+	if err != nil {
+		t.Fatalf("failed to expand template: %v", err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 4 {
+		t.Fatalf("unexpected output: %s", b)
+	}
+
+	uuids := strings.Fields(parts[0])
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, u := range uuids {
+		if !uuidPattern.MatchString(u) {
+			t.Errorf("not a version 4 UUID: %q", u)
+		}
+	}
+	if len(uuids) != 2 || uuids[0] == uuids[1] {
+		t.Errorf("expecting two different UUIDs: %q", parts[0])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, parts[1]); err != nil {
+		t.Errorf("now returned invalid time: %v", err)
+	}
+	if n, err := strconv.Atoi(parts[2]); err != nil || n < 5 || n > 7 {
+		t.Errorf("randInt returned %q, want value in [5, 7]", parts[2])
+	}
+	if parts[3] != "abc" {
+		t.Errorf("env returned %q, want %q", parts[3], "abc")
+	}
+
+	for _, text := range []string{`{{bad}}`, `{{randInt 2 1}}`, `{{`} {
+		if _, err := expandRequestTemplate(io.NopCloser(strings.NewReader(text))); err == nil {
+			t.Errorf("expecting error for template %q", text)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// testSuite is the contents of a file given to the 'test' verb, which lists
+// the calls to make and the outcome each is expected to have.
+type testSuite struct {
+	// Address is the address of the server, used if none is given on the
+	// command line.
+	Address string `yaml:"address"`
+	// Headers are sent with every call, in addition to those given via -H and
+	// -rpc-header, in "name: value" form.
+	Headers []string `yaml:"headers"`
+	// Parallel is the number of calls that may be in progress at once. If it
+	// is zero or one, the calls are made one after another.
+	Parallel int `yaml:"parallel"`
+	// Tests are the calls to make.
+	Tests []testCall `yaml:"tests"`
+
+	// the name of the file, and the directory relative to which the files
+	// named in request data are read
+	fileName string
+	dir      string
+}
+
+// testCall is a single call in a test suite.
+type testCall struct {
+	// Name identifies the call in the report. Defaults to the method name.
+	Name string `yaml:"name"`
+	// Method is the fully-qualified name of the method to invoke.
+	Method string `yaml:"method"`
+	// Headers are the call's request headers, in "name: value" form.
+	Headers []string `yaml:"headers"`
+	// Request is the request message. A string is used as request data in
+	// the same form accepted by -d, which may contain several messages and,
+	// if it starts with '@', names a file relative to the suite from which
+	// the data is read. Anything else is converted to JSON.
+	Request interface{} `yaml:"request"`
+	// Requests are the request messages, for a client-streaming method.
+	Requests []interface{} `yaml:"requests"`
+	// Timeout is the maximum time, in seconds, that the call may take.
+	Timeout float64 `yaml:"timeout"`
+	// Expect describes the expected outcome of the call.
+	Expect struct {
+		// Status is the expected status code, either a number or a name like
+		// NOT_FOUND. Defaults to OK.
+		Status string `yaml:"status"`
+		// Contains lists text that at least one response must contain, in
+		// JSON format.
+		Contains []string `yaml:"contains"`
+		// JQ lists jq expressions that must be true for every response.
+		JQ []string `yaml:"jq"`
+		// MaxLatency is the maximum time, in seconds, that the call may take
+		// to complete. Unlike Timeout, the call is not cancelled.
+		MaxLatency float64 `yaml:"max_latency"`
+	} `yaml:"expect"`
+	// Capture maps the names of variables to jq expressions, whose results
+	// for the last response are referenced by later calls as '${name}', in
+	// their request data and headers.
+	Capture map[string]string `yaml:"capture"`
+
+	status   codes.Code
+	jq       []jqExpectation
+	captures []captureExpr
+}
+
+// testResult is the outcome of a single call in a test suite.
+type testResult struct {
+	name     string
+	method   string
+	duration time.Duration
+	// a description of each expectation the call did not meet
+	failures []string
+	// if non-nil, the call could not be made, such as when the method or the
+	// request data is invalid
+	err error
+}
+
+func (r *testResult) passed() bool {
+	return r.err == nil && len(r.failures) == 0
+}
+
+// readTestSuite reads and checks the test suite in the given YAML file.
+func readTestSuite(fileName string) (*testSuite, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var suite testSuite
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+	suite.fileName = fileName
+	suite.dir = filepath.Dir(fileName)
+	if len(suite.Tests) == 0 {
+		return nil, fmt.Errorf("%s: no tests defined", fileName)
+	}
+	if suite.Parallel < 0 {
+		return nil, fmt.Errorf("%s: parallel must not be negative", fileName)
+	}
+	for i := range suite.Tests {
+		tc := &suite.Tests[i]
+		if err := tc.init(); err != nil {
+			name := tc.Name
+			if name == "" {
+				name = tc.Method
+			}
+			return nil, fmt.Errorf("%s: test %d (%s): %w", fileName, i+1, name, err)
+		}
+	}
+	return &suite, nil
+}
+
+// init checks the call and compiles its expectations.
+func (tc *testCall) init() error {
+	if tc.Method == "" {
+		return fmt.Errorf("no method given")
+	}
+	if tc.Name == "" {
+		tc.Name = tc.Method
+	}
+	if tc.Request != nil && len(tc.Requests) > 0 {
+		return fmt.Errorf("request and requests cannot both be given")
+	}
+	if tc.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if tc.Expect.MaxLatency < 0 {
+		return fmt.Errorf("max_latency must not be negative")
+	}
+	if tc.Expect.Status != "" {
+		code, err := parseStatusCodeName(tc.Expect.Status)
+		if err != nil {
+			return err
+		}
+		tc.status = code
+	}
+	for _, expr := range tc.Expect.JQ {
+		jq, err := newJQExpectation(expr)
+		if err != nil {
+			return fmt.Errorf("invalid jq expression %q: %v", expr, err)
+		}
+		tc.jq = append(tc.jq, jq)
+	}
+	var err error
+	tc.captures, err = parseCaptures(tc.Capture)
+	return err
+}
+
+// requestData returns the call's request data, in JSON format.
+func (tc *testCall) requestData(dir string) (string, error) {
+	if s, ok := tc.Request.(string); ok {
+		if strings.HasPrefix(s, "@") {
+			b, err := os.ReadFile(filepath.Join(dir, s[1:]))
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		}
+		return s, nil
+	}
+	msgs := tc.Requests
+	if tc.Request != nil {
+		msgs = []interface{}{tc.Request}
+	}
+	var data strings.Builder
+	for _, msg := range msgs {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return "", fmt.Errorf("could not convert request to JSON: %v", err)
+		}
+		data.Write(b)
+		data.WriteByte('\n')
+	}
+	return data.String(), nil
+}
+
+// runTest makes the calls in the given suite, for the 'test' verb, and writes
+// a JUnit report if -junit-out was given. It exits with an error code if any
+// call failed.
+func runTest(ctx context.Context, suite *testSuite, descSource grpcurl.DescriptorSource, ch grpcdynamic.Channel, headers []string) {
+	options := grpcurl.FormatOptions{
+		EmitJSONDefaultFields: *emitDefaults,
+		AllowUnknownFields:    *allowUnknownFields,
+		UseProtoNames:         *useProtoNames,
+	}
+	start := time.Now()
+	results := runTestSuite(ctx, os.Stdout, suite, descSource, ch, headers, options)
+	if *junitOut != "" {
+		f, err := os.Create(*junitOut)
+		if err == nil {
+			err = writeJUnitReport(f, suite, results, time.Since(start))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fail(err, "Failed to write JUnit report to %s", *junitOut)
+		}
+	}
+	for _, r := range results {
+		if !r.passed() {
+			exit(expectationFailedExitCode)
+		}
+	}
+}
+
+// runTestSuite makes the calls in the given suite and prints the result of
+// each to out, in the order they are listed, followed by a summary. Headers
+// are sent with every call, before the suite's own. A call that references a
+// variable waits for the call that captures it.
+func runTestSuite(ctx context.Context, out io.Writer, suite *testSuite, source grpcurl.DescriptorSource, ch grpcdynamic.Channel, headers []string, options grpcurl.FormatOptions) []testResult {
+	headers = append(append([]string{}, headers...), suite.Headers...)
+
+	captures := make([][]captureExpr, len(suite.Tests))
+	for i := range suite.Tests {
+		captures[i] = suite.Tests[i].captures
+	}
+	chain := newCaptureChain(captures)
+	results := make([]testResult, len(suite.Tests))
+	failed := 0
+	start := time.Now()
+	runInOrder(len(suite.Tests), suite.Parallel, func(i int) {
+		var captured map[string]interface{}
+		results[i], captured = runTestCall(ctx, &suite.Tests[i], suite.dir, source, ch, headers, options, chain, i)
+		chain.finish(i, captured)
+	}, func(i int) {
+		r := &results[i]
+		outcome := "PASS"
+		if !r.passed() {
+			outcome = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(out, "%-5s %s (%v)\n", outcome, r.name, r.duration.Round(time.Millisecond))
+		if r.err != nil {
+			fmt.Fprintf(out, "      %v\n", r.err)
+		}
+		for _, f := range r.failures {
+			fmt.Fprintf(out, "      %s\n", f)
+		}
+	})
+	fmt.Fprintf(out, "\n%d passed, %d failed, %d total (%v)\n", len(results)-failed, failed, len(results), time.Since(start).Round(time.Millisecond))
+	return results
+}
+
+// runTestCall makes the i-th call of a test suite, returning its result and
+// the variables it captured, which are nil if it could not be made.
+func runTestCall(ctx context.Context, tc *testCall, dir string, source grpcurl.DescriptorSource, ch grpcdynamic.Channel, headers []string, options grpcurl.FormatOptions, chain *captureChain, i int) (testResult, map[string]interface{}) {
+	result := testResult{name: tc.Name, method: tc.Method}
+	data, err := tc.requestData(dir)
+	if err != nil {
+		result.err = fmt.Errorf("failed to read request data: %v", err)
+		return result, nil
+	}
+	if data, err = chain.expand(ctx, i, data, true); err != nil {
+		result.err = err
+		return result, nil
+	}
+	callHeaders, err := chain.expandAll(ctx, i, tc.Headers)
+	if err != nil {
+		result.err = err
+		return result, nil
+	}
+	rf, formatter, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, source, strings.NewReader(data), options)
+	if err != nil {
+		result.err = err
+		return result, nil
+	}
+	expect := &responseExpectations{
+		status:        &tc.status,
+		contains:      tc.Expect.Contains,
+		jq:            tc.jq,
+		formatter:     formatter,
+		jsonFormatter: formatter,
+		keepJSON:      len(tc.captures) > 0,
+	}
+	h := &grpcurl.DefaultEventHandler{Out: io.Discard, Formatter: formatter}
+	if tc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, floatSecondsToDuration(tc.Timeout))
+		defer cancel()
+	}
+	start := time.Now()
+	headers = append(append([]string{}, headers...), callHeaders...)
+	err = grpcurl.InvokeRPC(ctx, source, ch, tc.Method, headers, expectationHandler{InvocationEventHandler: h, expect: expect}, rf.Next)
+	result.duration = time.Since(start)
+	if err != nil {
+		result.err = err
+		return result, nil
+	}
+	result.failures = expect.check(h.Status)
+	if maxLatency := floatSecondsToDuration(tc.Expect.MaxLatency); maxLatency > 0 && result.duration > maxLatency {
+		result.failures = append(result.failures, fmt.Sprintf("took %v, which exceeds max_latency of %v", result.duration, maxLatency))
+	}
+	var responses []string
+	for _, resp := range expect.responses {
+		if resp.err == nil {
+			responses = append(responses, resp.json)
+		}
+	}
+	captured, failures := captureVariables(tc.captures, responses)
+	result.failures = append(result.failures, failures...)
+	return result, captured
+}
+
+// JUnit XML report, written via -junit-out, in the form understood by most CI
+// systems.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the given results of the given suite to w as a
+// JUnit XML report. Calls that could not be made are reported as errors,
+// and those that did not meet their expectations as failures.
+func writeJUnitReport(w io.Writer, suite *testSuite, results []testResult, elapsed time.Duration) error {
+	ts := junitTestSuite{
+		Name:  suite.fileName,
+		Tests: len(results),
+		Time:  junitTime(elapsed),
+	}
+	for _, r := range results {
+		tc := junitTestCase{Name: r.name, Classname: r.method, Time: junitTime(r.duration)}
+		if r.err != nil {
+			tc.Error = &junitMessage{Message: r.err.Error(), Text: r.err.Error()}
+			ts.Errors++
+		} else if len(r.failures) > 0 {
+			tc.Failure = &junitMessage{Message: r.failures[0], Text: strings.Join(r.failures, "\n")}
+			ts.Failures++
+		}
+		ts.Cases = append(ts.Cases, tc)
+	}
+	report := junitTestSuites{
+		Tests:    ts.Tests,
+		Failures: ts.Failures,
+		Errors:   ts.Errors,
+		Time:     ts.Time,
+		Suites:   []junitTestSuite{ts},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	insecurecreds "google.golang.org/grpc/credentials/insecure"
+
+	"github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestReadTestSuite(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"suite.yaml": `address: localhost:8080
+headers: ["x-suite: a"]
+tests:
+  - method: svc.Service/Get
+    request: {"id": 1, "tags": ["a"]}
+    expect:
+      status: 5
+  - name: upload
+    method: svc.Service/Upload
+    requests: [{"id": 1}, {"id": 2}]
+    expect:
+      jq: ['.ok']
+  - method: svc.Service/Get
+    request: "@req.json"
+`,
+		"req.json":    `{"id": 3}`,
+		"empty.yaml":  "address: localhost:8080\n",
+		"typo.yaml":   "tests:\n  - method: svc.Service/Get\n    expect:\n      stauts: OK\n",
+		"both.yaml":   "tests:\n  - method: svc.Service/Get\n    request: {}\n    requests: [{}]\n",
+		"status.yaml": "tests:\n  - method: svc.Service/Get\n    expect:\n      status: NOPE\n",
+		"jq.yaml":     "tests:\n  - method: svc.Service/Get\n    expect:\n      jq: ['.[']\n",
+	})
+
+	suite, err := readTestSuite(filepath.Join(dir, "suite.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.Address != "localhost:8080" || len(suite.Tests) != 3 {
+		t.Fatalf("unexpected suite: %+v", suite)
+	}
+	if suite.Tests[0].Name != "svc.Service/Get" || suite.Tests[0].status != codes.NotFound {
+		t.Errorf("unexpected first test: %+v", suite.Tests[0])
+	}
+	if suite.Tests[1].status != codes.OK || len(suite.Tests[1].jq) != 1 {
+		t.Errorf("unexpected second test: %+v", suite.Tests[1])
+	}
+	var data []string
+	for _, tc := range suite.Tests {
+		d, err := tc.requestData(suite.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, d)
+	}
+	expected := []string{"{\"id\":1,\"tags\":[\"a\"]}\n", "{\"id\":1}\n{\"id\":2}\n", `{"id": 3}`}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("expected request data %q, got %q", expected, data)
+	}
+
+	for name, msg := range map[string]string{
+		"empty.yaml":  "no tests defined",
+		"typo.yaml":   "field stauts not found",
+		"both.yaml":   "request and requests cannot both be given",
+		"status.yaml": `unknown status code "NOPE"`,
+		"jq.yaml":     `invalid jq expression ".["`,
+	} {
+		_, err := readTestSuite(filepath.Join(dir, name))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected error containing %q, got %v", name, msg, err)
+		}
+	}
+}
+
+// startTestServer starts a server for the test service, returning a
+// connection to it and a source of its descriptors.
+func startTestServer(t *testing.T) (*grpc.ClientConn, grpcurl.DescriptorSource) {
+	t.Helper()
+	svr := grpc.NewServer()
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = svr.Serve(l)
+	}()
+	t.Cleanup(svr.Stop)
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecurecreds.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cc.Close()
+	})
+	source, err := grpcurl.DescriptorSourceFromProtoSets("../../internal/testing/test.protoset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cc, source
+}
+
+func TestRunTestSuite(t *testing.T) {
+	cc, source := startTestServer(t)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"suite.yaml": `parallel: 2
+tests:
+  - name: echo
+    method: testing.TestService/UnaryCall
+    request: {"payload": {"body": "aGk="}}
+    expect:
+      contains: ['"aGk="']
+      jq: ['.payload.body == "aGk="']
+  - name: expected failure
+    method: testing.TestService/UnaryCall
+    headers: ["fail-early: 5"]
+    expect:
+      status: NOT_FOUND
+  - name: unexpected failure
+    method: testing.TestService/UnaryCall
+    headers: ["fail-early: 5"]
+  - name: stream
+    method: testing.TestService/StreamingInputCall
+    requests: [{"payload": {"body": "aGk="}}, {"payload": {"body": "aGk="}}]
+    expect:
+      jq: ['.aggregatedPayloadSize == 3']
+  - name: no method
+    method: testing.TestService/Nope
+`,
+	})
+	suite, err := readTestSuite(filepath.Join(dir, "suite.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	results := runTestSuite(context.Background(), &out, suite, source, cc, nil, grpcurl.FormatOptions{})
+	var passed []bool
+	for _, r := range results {
+		passed = append(passed, r.passed())
+	}
+	if expected := []bool{true, true, false, false, false}; !reflect.DeepEqual(passed, expected) {
+		t.Errorf("expected results %v, got %v:\n%s", expected, passed, out.String())
+	}
+	if expected := []string{"expected status OK, but got NotFound (fail)"}; !reflect.DeepEqual(results[2].failures, expected) {
+		t.Errorf("expected failures %q, got %q", expected, results[2].failures)
+	}
+	if expected := []string{`-expect-jq ".aggregatedPayloadSize == 3" yielded false for response 1`}; !reflect.DeepEqual(results[3].failures, expected) {
+		t.Errorf("expected failures %q, got %q", expected, results[3].failures)
+	}
+	if results[4].err == nil {
+		t.Error("expected error for unknown method")
+	}
+	// results are printed in the order of the suite
+	lines := strings.Split(out.String(), "\n")
+	for i, prefix := range []string{"PASS  echo ", "PASS  expected failure ", "FAIL  unexpected failure ", "      expected status OK"} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected line %d to start with %q, got %q", i+1, prefix, lines[i])
+		}
+	}
+	if !strings.Contains(out.String(), "\n2 passed, 3 failed, 5 total (") {
+		t.Errorf("unexpected summary:\n%s", out.String())
+	}
+
+	var report bytes.Buffer
+	if err := writeJUnitReport(&report, suite, results, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<testsuite name="` + filepath.Join(dir, "suite.yaml") + `" tests="5" failures="2" errors="1" time="0.000">`,
+		`<testcase name="echo" classname="testing.TestService/UnaryCall"`,
+		`<failure message="expected status OK, but got NotFound (fail)">`,
+		`<error message="service &#34;testing.TestService&#34; does not include a method named &#34;Nope&#34;">`,
+	} {
+		if !strings.Contains(report.String(), s) {
+			t.Errorf("expected report to contain %q:\n%s", s, report.String())
+		}
+	}
+}
+
+func TestRunTestSuiteCaptures(t *testing.T) {
+	cc, source := startTestServer(t)
+
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"suite.yaml": `parallel: 3
+tests:
+  - name: capture
+    method: testing.TestService/UnaryCall
+    request: {"payload": {"body": "aGk="}}
+    capture:
+      body: .payload.body
+      code: '5'
+  - name: use body
+    method: testing.TestService/UnaryCall
+    request: {"payload": {"body": "${body}"}}
+    expect:
+      jq: ['.payload.body == "aGk="']
+  - name: use code
+    method: testing.TestService/UnaryCall
+    headers: ["fail-early: ${code}"]
+    expect:
+      status: NOT_FOUND
+  - name: capture fails
+    method: testing.TestService/EmptyCall
+    capture:
+      body: .payload.body
+  - name: use failed capture
+    method: testing.TestService/UnaryCall
+    request: {"payload": {"body": "${body}"}}
+`,
+	})
+	suite, err := readTestSuite(filepath.Join(dir, "suite.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	results := runTestSuite(context.Background(), &out, suite, source, cc, nil, grpcurl.FormatOptions{})
+	var passed []bool
+	for _, r := range results {
+		passed = append(passed, r.passed())
+	}
+	if expected := []bool{true, true, true, false, false}; !reflect.DeepEqual(passed, expected) {
+		t.Errorf("expected results %v, got %v:\n%s", expected, passed, out.String())
+	}
+	if expected := []string{`could not capture "body": jq expression ".payload.body" yielded null`}; !reflect.DeepEqual(results[3].failures, expected) {
+		t.Errorf("expected failures %q, got %q", expected, results[3].failures)
+	}
+	if results[4].err == nil || !strings.Contains(results[4].err.Error(), `variable "body" was not captured`) {
+		t.Errorf("expected error for variable that was not captured, got %v", results[4].err)
+	}
+}
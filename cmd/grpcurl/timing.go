@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/grpc/status"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// timingReport collects the timing data of an invocation, and the size and
+// latency of each message, for -timing-out json.
+type timingReport struct {
+	root *timingData
+
+	mu        sync.Mutex
+	call      *callTiming
+	callStart time.Time
+	written   bool
+}
+
+// timingJSON is the JSON form of timingData. Times are in milliseconds, and
+// start times are relative to the start of the root.
+type timingJSON struct {
+	Title      string       `json:"title"`
+	StartMs    float64      `json:"startMs"`
+	DurationMs float64      `json:"durationMs"`
+	Children   []timingJSON `json:"children,omitempty"`
+}
+
+// callTiming describes the RPC, if one was invoked.
+type callTiming struct {
+	Target        string          `json:"target"`
+	Method        string          `json:"method"`
+	Requests      int             `json:"requests"`
+	Responses     int             `json:"responses"`
+	RequestBytes  int             `json:"requestBytes"`
+	ResponseBytes int             `json:"responseBytes"`
+	DurationMs    float64         `json:"durationMs"`
+	Status        string          `json:"status,omitempty"`
+	Code          int             `json:"code"`
+	Messages      []messageTiming `json:"messages"`
+}
+
+// messageTiming describes a message of the RPC. Byte counts are of the
+// message's binary encoding, before any compression, and the time is relative
+// to the start of the RPC.
+type messageTiming struct {
+	Type  string  `json:"type"`
+	Index int     `json:"index"`
+	Bytes int     `json:"bytes"`
+	AtMs  float64 `json:"atMs"`
+}
+
+func newTimingReport(root *timingData) *timingReport {
+	return &timingReport{root: root}
+}
+
+// startCall records the start of an RPC to the given method.
+func (r *timingReport) startCall(target, method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.call = &callTiming{Target: target, Method: method, Messages: []messageTiming{}}
+	r.callStart = time.Now()
+}
+
+// endCall records the end of the RPC.
+func (r *timingReport) endCall(requests, responses int, d time.Duration, stat *status.Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.call.Requests = requests
+	r.call.Responses = responses
+	r.call.DurationMs = durationMillis(d)
+	r.call.Status = stat.Code().String()
+	r.call.Code = int(stat.Code())
+}
+
+func (r *timingReport) addMessage(typ string, index int, m proto.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	size := proto.Size(m)
+	r.call.Messages = append(r.call.Messages, messageTiming{Type: typ, Index: index, Bytes: size, AtMs: durationMillis(time.Since(r.callStart))})
+	if typ == "request" {
+		r.call.RequestBytes += size
+	} else {
+		r.call.ResponseBytes += size
+	}
+}
+
+func (r *timingReport) wrapParser(rp grpcurl.RequestParser) grpcurl.RequestParser {
+	return &timingRequestParser{RequestParser: rp, r: r}
+}
+
+func (r *timingReport) wrapHandler(h grpcurl.InvocationEventHandler) grpcurl.InvocationEventHandler {
+	return &timingHandler{InvocationEventHandler: h, r: r}
+}
+
+type timingRequestParser struct {
+	grpcurl.RequestParser
+	r     *timingReport
+	count int
+}
+
+func (p *timingRequestParser) Next(m proto.Message) error {
+	err := p.RequestParser.Next(m)
+	if err == nil {
+		p.count++
+		p.r.addMessage("request", p.count, m)
+	}
+	return err
+}
+
+type timingHandler struct {
+	grpcurl.InvocationEventHandler
+	r     *timingReport
+	count int
+}
+
+func (h *timingHandler) OnReceiveResponse(resp proto.Message) {
+	h.count++
+	h.r.addMessage("response", h.count, resp)
+	h.InvocationEventHandler.OnReceiveResponse(resp)
+}
+
+// write writes the report, as a JSON document, to the given file or, if the
+// name is empty, to stderr. It only writes the report the first time it is
+// called.
+func (r *timingReport) write(fileName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.written {
+		return nil
+	}
+	r.written = true
+	r.root.Done()
+	doc := struct {
+		Timing timingJSON  `json:"timing"`
+		Call   *callTiming `json:"call,omitempty"`
+	}{Timing: timingToJSON(r.root, r.root.Start), Call: r.call}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if fileName == "" {
+		_, err = os.Stderr.Write(b)
+		return err
+	}
+	return os.WriteFile(fileName, b, 0666)
+}
+
+func timingToJSON(d *timingData, start time.Time) timingJSON {
+	j := timingJSON{
+		Title:      d.Title,
+		StartMs:    durationMillis(d.Start.Sub(start)),
+		DurationMs: durationMillis(d.Value),
+	}
+	for _, sd := range d.Sub {
+		j.Children = append(j.Children, timingToJSON(sd, start))
+	}
+	return j
+}
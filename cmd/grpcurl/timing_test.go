@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTimingReport(t *testing.T) {
+	start := time.Now()
+	root := &timingData{Title: "Timing Data", Start: start}
+	dial := &timingData{Title: "Dial", Start: start.Add(time.Millisecond), Value: 2 * time.Millisecond}
+	root.Sub = append(root.Sub, dial)
+
+	r := newTimingReport(root)
+	r.startCall("localhost:8080", "pkg.Service/Method")
+	r.addMessage("request", 1, wrapperspb.String("abc"))
+	r.addMessage("response", 1, wrapperspb.String("abcdef"))
+	r.addMessage("response", 2, wrapperspb.String(""))
+	r.endCall(1, 2, 5*time.Millisecond, status.New(codes.Unavailable, "oops"))
+
+	fileName := filepath.Join(t.TempDir(), "timing.json")
+	if err := r.write(fileName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// only written once
+	if err := r.write(""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Timing timingJSON `json:"timing"`
+		Call   callTiming `json:"call"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("failed to parse report: %v\n%s", err, b)
+	}
+	if doc.Timing.Title != "Timing Data" || len(doc.Timing.Children) != 1 {
+		t.Fatalf("unexpected timing data: %+v", doc.Timing)
+	}
+	if c := doc.Timing.Children[0]; c.Title != "Dial" || c.StartMs != 1 || c.DurationMs != 2 {
+		t.Errorf("unexpected child timing data: %+v", c)
+	}
+	call := doc.Call
+	if call.Method != "pkg.Service/Method" || call.Requests != 1 || call.Responses != 2 ||
+		call.RequestBytes != 5 || call.ResponseBytes != 8 || call.DurationMs != 5 ||
+		call.Status != "Unavailable" || call.Code != int(codes.Unavailable) {
+		t.Errorf("unexpected call: %+v", call)
+	}
+	if len(call.Messages) != 3 || call.Messages[1].Type != "response" || call.Messages[1].Bytes != 8 {
+		t.Errorf("unexpected messages: %+v", call.Messages)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions are the TLS versions that may be given via -tls-min-version and
+// -tls-max-version.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a TLS version like '1.2'. A 'TLS' prefix, like in
+// 'TLS1.2' or 'TLS 1.2', is allowed.
+func parseTLSVersion(s string) (uint16, error) {
+	v := strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS"))
+	if version, ok := tlsVersions[v]; ok {
+		return version, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q; valid versions are 1.0, 1.1, 1.2, and 1.3", s)
+}
+
+// parseCipherSuites parses a comma-separated list of cipher suite names, like
+// 'TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256', as named by the crypto/tls package.
+// Suites that Go considers insecure are allowed, since they may be needed to
+// connect to old servers. The suites of TLS 1.3 cannot be configured, so they
+// are not allowed.
+func parseCipherSuites(list string) ([]uint16, error) {
+	known := map[string]*tls.CipherSuite{}
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[cs.Name] = cs
+	}
+	var ids []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		cs, ok := known[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		if len(cs.SupportedVersions) == 1 && cs.SupportedVersions[0] == tls.VersionTLS13 {
+			return nil, fmt.Errorf("%s is a TLS 1.3 cipher suite, which cannot be configured", cs.Name)
+		}
+		ids = append(ids, cs.ID)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no cipher suites given")
+	}
+	return ids, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	testCases := map[string]uint16{
+		"1.0":     tls.VersionTLS10,
+		"1.2":     tls.VersionTLS12,
+		"TLS1.3":  tls.VersionTLS13,
+		"tls 1.1": tls.VersionTLS11,
+	}
+	for s, expected := range testCases {
+		actual, err := parseTLSVersion(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", s, err)
+		} else if actual != expected {
+			t.Errorf("%q: expected %x, got %x", s, expected, actual)
+		}
+	}
+	for _, s := range []string{"", "1.4", "SSL3.0", "12"} {
+		if _, err := parseTLSVersion(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := parseCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls_rsa_with_rc4_128_sha,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_RC4_128_SHA}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v, got %v", expected, ids)
+	}
+	for _, list := range []string{"", "TLS_NOT_A_SUITE", "TLS_AES_128_GCM_SHA256"} {
+		if _, err := parseCipherSuites(list); err == nil {
+			t.Errorf("expected error for %q", list)
+		}
+	}
+}
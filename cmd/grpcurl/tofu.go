@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fingerprintPrefix identifies the hash used for fingerprints in a known-hosts
+// file, so that others can be supported later.
+const fingerprintPrefix = "sha256:"
+
+// certFingerprint returns the fingerprint of the given certificate, which is
+// the SHA-256 hash of its DER encoding.
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return fingerprintPrefix + hex.EncodeToString(sum[:])
+}
+
+// defaultKnownHostsFile returns the file used by -tofu when -known-hosts is
+// not present.
+func defaultKnownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".grpcurl", "known_hosts"), nil
+}
+
+// knownHosts checks server certificates against the fingerprints in a file,
+// given via -known-hosts, for trust-on-first-use (-tofu). Each line of the
+// file is a host and port followed by a fingerprint. Blank lines and lines
+// that start with '#' are ignored.
+type knownHosts struct {
+	fileName string
+	// onAdd, if non-nil, is called when a host is seen for the first time
+	// and its fingerprint is added to the file
+	onAdd func(host, fingerprint string)
+
+	mu sync.Mutex
+}
+
+// errCertificateChanged indicates that a server presented a certificate that
+// does not match the one recorded for it.
+var errCertificateChanged = errors.New("server certificate has changed")
+
+// verify checks the given certificate for the given host. If the host has no
+// recorded fingerprint, it is added to the file.
+func (k *knownHosts) verify(host string, cert *x509.Certificate) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fingerprint := certFingerprint(cert)
+	known, err := k.lookup(host)
+	if err != nil {
+		return err
+	}
+	if known == fingerprint {
+		return nil
+	}
+	if known != "" {
+		return fmt.Errorf("%w: %s presented a certificate with fingerprint %s, but %s records %s; if the change is expected, remove the entry for %s from that file",
+			errCertificateChanged, host, fingerprint, k.fileName, known, host)
+	}
+	if err := k.add(host, fingerprint); err != nil {
+		return fmt.Errorf("failed to record certificate in %s: %v", k.fileName, err)
+	}
+	if k.onAdd != nil {
+		k.onAdd(host, fingerprint)
+	}
+	return nil
+}
+
+// lookup returns the fingerprint recorded for the given host, or the empty
+// string if there is none.
+func (k *knownHosts) lookup(host string) (string, error) {
+	f, err := os.Open(k.fileName)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return "", fmt.Errorf("%s: line %d: expecting host and fingerprint", k.fileName, lineNum)
+		}
+		if fields[0] == host {
+			return fields[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+func (k *knownHosts) add(host, fingerprint string) error {
+	if err := os.MkdirAll(filepath.Dir(k.fileName), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(k.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%s %s\n", host, fingerprint); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// verifyConnection returns a function for use as tls.Config.VerifyConnection
+// that verifies the server's leaf certificate for the given host.
+func (k *knownHosts) verifyConnection(host string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server presented no certificate")
+		}
+		return k.verify(host, state.PeerCertificates[0])
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestKnownHosts(t *testing.T) {
+	var added []string
+	k := &knownHosts{
+		fileName: filepath.Join(t.TempDir(), "sub", "known_hosts"),
+		onAdd: func(host, fingerprint string) {
+			added = append(added, host)
+		},
+	}
+	cert1 := &x509.Certificate{Raw: []byte("cert one")}
+	cert2 := &x509.Certificate{Raw: []byte("cert two")}
+
+	if err := k.verify("a.example:443", cert1); err != nil {
+		t.Fatalf("first use should be trusted: %v", err)
+	}
+	if err := k.verify("b.example:443", cert2); err != nil {
+		t.Fatalf("first use should be trusted: %v", err)
+	}
+	if err := k.verify("a.example:443", cert1); err != nil {
+		t.Errorf("same certificate should be trusted: %v", err)
+	}
+	if err := k.verify("a.example:443", cert2); !errors.Is(err, errCertificateChanged) {
+		t.Errorf("changed certificate should be rejected, got %v", err)
+	}
+	if len(added) != 2 || added[0] != "a.example:443" || added[1] != "b.example:443" {
+		t.Errorf("wrong hosts added: %v", added)
+	}
+}
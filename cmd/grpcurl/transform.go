@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// transformChannel is a channel that passes the encoded bytes of every
+// message sent and received through a command, given via -transform-cmd.
+// This allows for things like application-level encryption or signing of
+// message payloads.
+type transformChannel struct {
+	grpcdynamic.Channel
+	cmdLine string
+	// base is the codec whose encoded bytes are transformed; if nil, the
+	// proto codec is used
+	base encoding.Codec
+}
+
+func (ch transformChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return ch.Channel.Invoke(ctx, method, args, reply, append(opts, grpc.ForceCodec(ch.codec(method)))...)
+}
+
+func (ch transformChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return ch.Channel.NewStream(ctx, desc, method, append(opts, grpc.ForceCodec(ch.codec(method)))...)
+}
+
+func (ch transformChannel) codec(method string) encoding.Codec {
+	base := ch.base
+	if base == nil {
+		base = encoding.GetCodec("proto")
+	}
+	return transformCodec{
+		Codec:   base,
+		cmdLine: ch.cmdLine,
+		method:  method,
+	}
+}
+
+// transformCodec wraps the proto codec so that encoded request messages are
+// transformed before they are sent and received response messages are
+// transformed before they are decoded.
+type transformCodec struct {
+	encoding.Codec
+	cmdLine string
+	method  string
+}
+
+func (c transformCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.Codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.transform("request", data)
+}
+
+func (c transformCodec) Unmarshal(data []byte, v interface{}) error {
+	data, err := c.transform("response", data)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(data, v)
+}
+
+// transform runs the command with the given data as its input. Its output is
+// the transformed data. The command can use the GRPCURL_DIRECTION and
+// GRPCURL_METHOD environment variables to tell what kind of message is being
+// transformed.
+func (c transformCodec) transform(direction string, data []byte) ([]byte, error) {
+	cmd := shellCommand(c.cmdLine)
+	cmd.Env = append(os.Environ(), "GRPCURL_DIRECTION="+direction, "GRPCURL_METHOD="+c.method)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("transform command failed for %s: %v: %s", direction, err, msg)
+		}
+		return nil, fmt.Errorf("transform command failed for %s: %v", direction, err)
+	}
+	return stdout.Bytes(), nil
+}
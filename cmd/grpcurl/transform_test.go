@@ -0,0 +1,38 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTransformCodec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands require a POSIX shell")
+	}
+	codec := transformCodec{
+		Codec:   encoding.GetCodec("proto"),
+		cmdLine: `test "$GRPCURL_METHOD" = /foo.Bar/Baz && cat`,
+		method:  "/foo.Bar/Baz",
+	}
+	data, err := codec.Marshal(wrapperspb.String("abc"))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var msg wrapperspb.StringValue
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if !proto.Equal(&msg, wrapperspb.String("abc")) {
+		t.Errorf("wrong message after round trip: %v", &msg)
+	}
+
+	codec.cmdLine = `echo "bad $GRPCURL_DIRECTION" >&2; exit 1`
+	if _, err := codec.Marshal(wrapperspb.String("abc")); err == nil || !strings.Contains(err.Error(), "bad request") {
+		t.Errorf("expected error from failed command, got %v", err)
+	}
+}
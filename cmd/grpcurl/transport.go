@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+)
+
+// Schemes of addresses of servers on the same machine, which are not reached
+// via TCP. gRPC itself supports Unix domain sockets, including abstract ones,
+// but named pipes are dialed by grpcurl.
+const (
+	unixScheme         = "unix:"
+	unixAbstractScheme = "unix-abstract:"
+	namedPipeScheme    = "npipe://"
+)
+
+// localTransport describes how to connect to a server on the same machine,
+// via a Unix domain socket, an abstract Unix socket, or a Windows named pipe.
+type localTransport struct {
+	// dialTarget is the target given to gRPC
+	dialTarget string
+	// dialer, if not nil, connects to the server, instead of gRPC
+	dialer func(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// parseLocalTarget returns the transport for the given address, or nil if it
+// is not for a local transport. If unixFlag is true, because -unix is present,
+// the address is the path of a Unix domain socket.
+func parseLocalTarget(target string, unixFlag bool) (*localTransport, error) {
+	switch {
+	case strings.HasPrefix(target, unixAbstractScheme):
+		if runtime.GOOS != "linux" && runtime.GOOS != "android" {
+			return nil, fmt.Errorf("abstract Unix sockets are not supported on %s", runtime.GOOS)
+		}
+		return &localTransport{dialTarget: target}, nil
+	case strings.HasPrefix(target, unixScheme):
+		return &localTransport{dialTarget: target}, nil
+	case strings.HasPrefix(target, namedPipeScheme):
+		name, err := namedPipeName(target)
+		if err != nil {
+			return nil, err
+		}
+		dialer, err := namedPipeDialer(name)
+		if err != nil {
+			return nil, err
+		}
+		// the address is not used by the dialer, but gRPC needs a target it
+		// can resolve
+		return &localTransport{dialTarget: "passthrough:///" + name, dialer: dialer}, nil
+	case unixFlag:
+		// prepend unix:// to the address if it's not already there
+		// this is to maintain backwards compatibility because the custom dialer is replaced by
+		// the default dialer in grpc-go.
+		// https://github.com/fullstorydev/grpcurl/pull/480
+		return &localTransport{dialTarget: "unix://" + target}, nil
+	}
+	return nil, nil
+}
+
+// namedPipeName converts an address like 'npipe:////./pipe/name', as used by
+// Docker and containerd, to the name of the pipe, like '\\.\pipe\name'.
+func namedPipeName(target string) (string, error) {
+	path := strings.TrimPrefix(target, namedPipeScheme)
+	if !strings.HasPrefix(path, "//") || !strings.Contains(path[2:], "/pipe/") {
+		return "", fmt.Errorf("%q is not a named pipe; use 'npipe:////./pipe/name'", target)
+	}
+	return strings.ReplaceAll(path, "/", `\`), nil
+}
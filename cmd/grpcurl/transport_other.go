@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// namedPipeDialer returns an error, since named pipes are only supported on
+// Windows.
+func namedPipeDialer(string) (func(context.Context, string) (net.Conn, error), error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
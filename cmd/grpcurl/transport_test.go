@@ -0,0 +1,69 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestParseLocalTarget(t *testing.T) {
+	testCases := []struct {
+		target     string
+		unixFlag   bool
+		dialTarget string
+	}{
+		{"localhost:8080", false, ""},
+		{"/tmp/grpc.sock", true, "unix:///tmp/grpc.sock"},
+		{"unix:///tmp/grpc.sock", true, "unix:///tmp/grpc.sock"},
+		{"unix:///tmp/grpc.sock", false, "unix:///tmp/grpc.sock"},
+		{"unix:relative.sock", false, "unix:relative.sock"},
+	}
+	for _, tc := range testCases {
+		local, err := parseLocalTarget(tc.target, tc.unixFlag)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.target, err)
+			continue
+		}
+		if tc.dialTarget == "" {
+			if local != nil {
+				t.Errorf("%s: expected no local transport, got %+v", tc.target, local)
+			}
+		} else if local == nil || local.dialTarget != tc.dialTarget || local.dialer != nil {
+			t.Errorf("%s: expected dial target %s, got %+v", tc.target, tc.dialTarget, local)
+		}
+	}
+
+	local, err := parseLocalTarget("unix-abstract:grpc", false)
+	if runtime.GOOS == "linux" {
+		if err != nil || local.dialTarget != "unix-abstract:grpc" {
+			t.Errorf("unexpected transport for abstract socket: %+v, %v", local, err)
+		}
+	} else if err == nil {
+		t.Error("expected error for abstract socket")
+	}
+
+	local, err = parseLocalTarget("npipe:////./pipe/containerd", false)
+	if runtime.GOOS == "windows" {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		} else if local.dialTarget != `passthrough:///\\.\pipe\containerd` || local.dialer == nil {
+			t.Errorf("unexpected transport for named pipe: %+v", local)
+		}
+	} else if err == nil {
+		t.Error("expected error for named pipe")
+	}
+}
+
+func TestNamedPipeName(t *testing.T) {
+	name, err := namedPipeName("npipe:////./pipe/docker_engine")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name != `\\.\pipe\docker_engine` {
+		t.Errorf(`expected \\.\pipe\docker_engine, got %s`, name)
+	}
+	for _, target := range []string{"npipe://docker_engine", "npipe:////./docker_engine", "npipe://"} {
+		if _, err := namedPipeName(target); err == nil {
+			t.Errorf("expected error for %q", target)
+		}
+	}
+}
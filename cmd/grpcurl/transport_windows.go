@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// namedPipeDialer returns a dialer that connects to the named pipe with the
+// given name, like '\\.\pipe\name'.
+func namedPipeDialer(name string) (func(context.Context, string) (net.Conn, error), error) {
+	return func(ctx context.Context, _ string) (net.Conn, error) {
+		return winio.DialPipeContext(ctx, name)
+	}, nil
+}
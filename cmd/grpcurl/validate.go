@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 required to use APIs in other grpcurl package
+	"google.golang.org/protobuf/encoding/protowire"
+	protov2 "google.golang.org/protobuf/proto"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// Field numbers of the options that mark a field as required, for the
+// 'validate' verb.
+const (
+	// google.api.field_behavior, a repeated FieldBehavior, where 2 is
+	// REQUIRED
+	fieldBehaviorOption   = 1052
+	fieldBehaviorRequired = 2
+	// buf.validate.field, a FieldRules message whose 'required' field is 25
+	protovalidateOption   = 1159
+	protovalidateRequired = 25
+	// validate.rules from protoc-gen-validate, a FieldRules message whose
+	// 'message' field is 17, and that MessageRules message's 'required'
+	// field is 2
+	pgvOption          = 1071
+	pgvMessageRules    = 17
+	pgvMessageRequired = 2
+)
+
+// runValidate checks the request data given via -d against the request type
+// of the given method, for the 'validate' verb. It exits with
+// invalidRequestExitCode if any problems are found.
+func runValidate(descSource grpcurl.DescriptorSource, symbol string, format grpcurl.Format) {
+	mtd, err := findMethod(descSource, symbol)
+	if err != nil {
+		fail(err, "Failed to resolve method %q", symbol)
+	}
+	in, err := openRequestData(requestData, format)
+	if err != nil {
+		fail(err, "Failed to read request data")
+	}
+	if *dTemplate {
+		if in, err = expandRequestTemplate(in); err != nil {
+			fail(err, "Failed to process request data template")
+		}
+	}
+	defer in.Close()
+	options := grpcurl.FormatOptions{
+		AllowUnknownFields: *allowUnknownFields,
+		UseProtoNames:      *useProtoNames,
+	}
+	rf, _, err := grpcurl.RequestParserAndFormatter(format, descSource, in, options)
+	if err != nil {
+		fail(err, "Failed to construct request parser for %q", format)
+	}
+	count, problems := validateRequests(mtd, rf)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		exit(invalidRequestExitCode)
+	}
+	fmt.Printf("Request data is valid (%d message(s) for %s)\n", count, mtd.GetFullyQualifiedName())
+}
+
+// validateRequests parses the request messages for the given method using the
+// given parser, and returns the number of messages and a description of each
+// problem found: a message that cannot be parsed, such as one with unknown
+// fields or values of the wrong type, a missing required field, or too many
+// messages for the method. Parsing stops at the first message that cannot be
+// parsed. Like when invoking the method, no messages means a single empty one
+// for a method that is not client-streaming.
+func validateRequests(mtd *desc.MethodDescriptor, parser grpcurl.RequestParser) (int, []string) {
+	var problems []string
+	count := 0
+	for {
+		msg := dynamic.NewMessage(mtd.GetInputType())
+		err := parser.Next(msg)
+		if err == io.EOF {
+			if count == 0 && !mtd.IsClientStreaming() {
+				count++
+				for _, p := range missingRequiredFields(msg, "") {
+					problems = append(problems, fmt.Sprintf("request %d: %s", count, p))
+				}
+			}
+			break
+		}
+		count++
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("request %d: %v", count, err))
+			break
+		}
+		for _, p := range missingRequiredFields(msg, "") {
+			problems = append(problems, fmt.Sprintf("request %d: %s", count, p))
+		}
+	}
+	if count > 1 && !mtd.IsClientStreaming() {
+		problems = append(problems, fmt.Sprintf("method %q is not client-streaming, but request data contains %d messages", mtd.GetFullyQualifiedName(), count))
+	}
+	return count, problems
+}
+
+// missingRequiredFields returns a description of each required field that is
+// not set in the given message or in the messages nested in it. The given
+// prefix is the path of the message within the request.
+func missingRequiredFields(msg *dynamic.Message, prefix string) []string {
+	var problems []string
+	for _, fd := range msg.GetMessageDescriptor().GetFields() {
+		name := prefix + fd.GetName()
+		if !msg.HasField(fd) {
+			if isRequiredField(fd) {
+				problems = append(problems, fmt.Sprintf("missing required field %q", name))
+			}
+			continue
+		}
+		if fd.GetMessageType() == nil || fd.IsMap() && fd.GetMapValueType().GetMessageType() == nil {
+			continue
+		}
+		switch val := msg.GetField(fd).(type) {
+		case map[interface{}]interface{}:
+			keys := make([]string, 0, len(val))
+			entries := map[string]interface{}{}
+			for k, v := range val {
+				key := fmt.Sprint(k)
+				keys = append(keys, key)
+				entries[key] = v
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				problems = append(problems, missingRequiredFieldsIn(entries[k], fmt.Sprintf("%s[%s].", name, k))...)
+			}
+		case []interface{}:
+			for i, v := range val {
+				problems = append(problems, missingRequiredFieldsIn(v, fmt.Sprintf("%s[%d].", name, i))...)
+			}
+		default:
+			problems = append(problems, missingRequiredFieldsIn(val, name+".")...)
+		}
+	}
+	return problems
+}
+
+func missingRequiredFieldsIn(val interface{}, prefix string) []string {
+	m, ok := val.(proto.Message)
+	if !ok {
+		return nil
+	}
+	dm, err := dynamic.AsDynamicMessage(m)
+	if err != nil {
+		return nil
+	}
+	return missingRequiredFields(dm, prefix)
+}
+
+// isRequiredField reports whether the given field is required: a proto2
+// required field, or one whose options say it is required, using the
+// google.api.field_behavior annotation or the rules of protovalidate or
+// protoc-gen-validate.
+func isRequiredField(fd *desc.FieldDescriptor) bool {
+	if fd.IsRequired() {
+		return true
+	}
+	opts := fd.GetFieldOptions()
+	if opts == nil {
+		return false
+	}
+	// the options may be unknown fields or extensions, depending on how the
+	// descriptors were loaded, so they are checked in their encoded form
+	b, err := protov2.Marshal(opts)
+	if err != nil {
+		return false
+	}
+	required := false
+	forEachField(b, func(num protowire.Number, typ protowire.Type, v []byte) {
+		switch num {
+		case fieldBehaviorOption:
+			if typ == protowire.BytesType {
+				// packed
+				for len(v) > 0 {
+					behavior, n := protowire.ConsumeVarint(v)
+					if n < 0 {
+						return
+					}
+					v = v[n:]
+					required = required || behavior == fieldBehaviorRequired
+				}
+			} else if typ == protowire.VarintType {
+				behavior, _ := protowire.ConsumeVarint(v)
+				required = required || behavior == fieldBehaviorRequired
+			}
+		case protovalidateOption:
+			if typ == protowire.BytesType {
+				required = required || hasTrueField(v, protovalidateRequired)
+			}
+		case pgvOption:
+			if typ == protowire.BytesType {
+				forEachField(v, func(num protowire.Number, typ protowire.Type, v []byte) {
+					if num == pgvMessageRules && typ == protowire.BytesType {
+						required = required || hasTrueField(v, pgvMessageRequired)
+					}
+				})
+			}
+		}
+	})
+	return required
+}
+
+// forEachField calls the given function with the number, type, and value of
+// each field in the given encoded message. The value of a varint field is its
+// encoding, and that of a length-delimited field is its contents.
+func forEachField(b []byte, fn func(protowire.Number, protowire.Type, []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return
+		}
+		b = b[n:]
+		var v []byte
+		if typ == protowire.BytesType {
+			var m int
+			v, m = protowire.ConsumeBytes(b)
+			if m < 0 {
+				return
+			}
+			n = m
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return
+			}
+			v = b[:n]
+		}
+		fn(num, typ, v)
+		b = b[n:]
+	}
+}
+
+// hasTrueField reports whether the given encoded message has a bool field
+// with the given number that is true.
+func hasTrueField(b []byte, num protowire.Number) bool {
+	found := false
+	forEachField(b, func(n protowire.Number, typ protowire.Type, v []byte) {
+		if n == num && typ == protowire.VarintType {
+			val, _ := protowire.ConsumeVarint(v)
+			found = val != 0
+		}
+	})
+	return found
+}
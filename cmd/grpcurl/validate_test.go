@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 required to use APIs in other grpcurl package
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestValidateRequests(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"rules.proto": `syntax = "proto3";
+package rules;
+import "google/protobuf/descriptor.proto";
+enum FieldBehavior { FIELD_BEHAVIOR_UNSPECIFIED = 0; OPTIONAL = 1; REQUIRED = 2; }
+extend google.protobuf.FieldOptions { repeated FieldBehavior field_behavior = 1052; }
+message ProtovalidateRules { bool required = 25; }
+extend google.protobuf.FieldOptions { ProtovalidateRules field = 1159; }
+message MessageRules { bool skip = 1; bool required = 2; }
+message PGVRules { MessageRules message = 17; }
+extend google.protobuf.FieldOptions { PGVRules rules = 1071; }`,
+			"svc.proto": `syntax = "proto3";
+package svc;
+import "rules.proto";
+message Address { string city = 1 [(rules.field_behavior) = REQUIRED]; }
+message Request {
+  string name = 1 [(rules.field) = { required: true }];
+  Address home = 2 [(rules.rules).message = { required: true }];
+  repeated Address others = 3;
+  map<string, Address> by_label = 4;
+  int32 count = 5;
+}
+service Service {
+  rpc Unary(Request) returns (Request);
+  rpc Upload(stream Request) returns (Request);
+}`,
+		}),
+	}
+	fds, err := p.ParseFiles("svc.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	source, err := grpcurl.DescriptorSourceFromFileDescriptors(fds...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := fds[0].FindService("svc.Service")
+
+	testCases := []struct {
+		name     string
+		method   string
+		data     string
+		count    int
+		problems []string
+	}{
+		{
+			name:   "valid",
+			method: "Unary",
+			data:   `{"name": "a", "home": {"city": "b"}}`,
+			count:  1,
+		},
+		{
+			name:   "missing fields",
+			method: "Unary",
+			data:   `{"others": [{"city": "b"}, {}], "by_label": {"work": {}}}`,
+			count:  1,
+			problems: []string{
+				`request 1: missing required field "name"`,
+				`request 1: missing required field "home"`,
+				`request 1: missing required field "others[1].city"`,
+				`request 1: missing required field "by_label[work].city"`,
+			},
+		},
+		{
+			name:     "no data",
+			method:   "Unary",
+			count:    1,
+			problems: []string{`request 1: missing required field "name"`, `request 1: missing required field "home"`},
+		},
+		{
+			name:     "unknown field",
+			method:   "Upload",
+			data:     `{"name": "a", "home": {"city": "b"}} {"nmae": "a"}`,
+			count:    2,
+			problems: []string{"request 2: message type svc.Request has no known field named nmae"},
+		},
+		{
+			name:     "too many messages",
+			method:   "Unary",
+			data:     `{"name": "a", "home": {"city": "b"}} {"name": "c", "home": {"city": "d"}}`,
+			count:    2,
+			problems: []string{`method "svc.Service.Unary" is not client-streaming, but request data contains 2 messages`},
+		},
+		{
+			name:   "stream",
+			method: "Upload",
+			data:   `{"name": "a", "home": {"city": "b"}} {"name": "c", "home": {"city": "d"}}`,
+			count:  2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rf, _, err := grpcurl.RequestParserAndFormatter(grpcurl.FormatJSON, source, strings.NewReader(tc.data), grpcurl.FormatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, problems := validateRequests(sd.FindMethodByName(tc.method), rf)
+			if count != tc.count {
+				t.Errorf("expected %d messages, got %d", tc.count, count)
+			}
+			if !reflect.DeepEqual(problems, tc.problems) {
+				t.Errorf("expected problems %q, got %q", tc.problems, problems)
+			}
+		})
+	}
+}
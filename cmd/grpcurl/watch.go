@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+// watchInterval is how often -watch checks for changed files.
+const watchInterval = time.Second
+
+// watchedFiles returns the files that the descriptors given via -protoset or
+// -proto flags are loaded from. For proto sources, this is all proto files in
+// the import paths, so that changes to imported files are also noticed.
+func watchedFiles() ([]string, error) {
+	if len(protoset) > 0 {
+		// remote protosets are not watched
+		var files []string
+		for _, name := range protoset {
+			if !isRemoteProtoset(name) {
+				files = append(files, name)
+			}
+		}
+		return files, nil
+	}
+	if len(importPaths) == 0 {
+		// expanded again, so that files matching a pattern that are added
+		// later are also noticed
+		return expandProtoFiles(nil, protoFiles, protoExcludes)
+	}
+	var files []string
+	for _, dir := range importPaths {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".proto") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFiles returns the stamps of the given files. Files that cannot be
+// accessed are omitted, so that removing a file counts as a change.
+func statFiles(files []string) map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// descriptorWatcher reloads the descriptors given via -protoset or -proto
+// flags when the files they are loaded from change, for -watch.
+type descriptorWatcher struct {
+	current grpcurl.DescriptorSource
+	stamps  map[string]fileStamp
+	// onReload is called with the new descriptors after they are loaded
+	onReload func(grpcurl.DescriptorSource) error
+	// log receives a message for each reload, including the schema changes
+	log io.Writer
+}
+
+func newDescriptorWatcher(current grpcurl.DescriptorSource, log io.Writer, onReload func(grpcurl.DescriptorSource) error) (*descriptorWatcher, error) {
+	files, err := watchedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return &descriptorWatcher{
+		current:  current,
+		stamps:   statFiles(files),
+		onReload: onReload,
+		log:      log,
+	}, nil
+}
+
+// run checks for changes every watchInterval. It never returns.
+func (w *descriptorWatcher) run() {
+	for range time.Tick(watchInterval) {
+		w.check()
+	}
+}
+
+// check reloads the descriptors if any of the files have changed since the
+// last check. If they cannot be loaded, the error is logged and the previous
+// descriptors remain in use.
+func (w *descriptorWatcher) check() {
+	files, err := watchedFiles()
+	if err != nil {
+		fmt.Fprintf(w.log, "Failed to check for changed descriptors: %v\n", err)
+		return
+	}
+	stamps := statFiles(files)
+	if reflect.DeepEqual(stamps, w.stamps) {
+		return
+	}
+	w.stamps = stamps
+
+	source, err := readFileSource()
+	if err != nil {
+		fmt.Fprintf(w.log, "Failed to reload descriptors, continuing with previous ones: %v\n", err)
+		return
+	}
+	changes, err := schemaChanges(w.current, source)
+	if err != nil {
+		fmt.Fprintf(w.log, "Failed to reload descriptors, continuing with previous ones: %v\n", err)
+		return
+	}
+	if err := w.onReload(source); err != nil {
+		fmt.Fprintf(w.log, "Failed to reload descriptors, continuing with previous ones: %v\n", err)
+		return
+	}
+	w.current = source
+	if len(changes) == 0 {
+		fmt.Fprintln(w.log, "Reloaded descriptors; no schema changes")
+		return
+	}
+	fmt.Fprintln(w.log, "Reloaded descriptors; schema changes:")
+	for _, c := range changes {
+		fmt.Fprintf(w.log, "  %s\n", c)
+	}
+}
+
+func schemaChanges(oldSource, newSource grpcurl.DescriptorSource) ([]string, error) {
+	oldSchema, err := collectSchema(oldSource)
+	if err != nil {
+		return nil, err
+	}
+	newSchema, err := collectSchema(newSource)
+	if err != nil {
+		return nil, err
+	}
+	return diffSchemas(oldSchema, newSchema), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fullstorydev/grpcurl"
+)
+
+func TestDescriptorWatcher(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "test.proto")
+	writeProto := func(content string, age time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// make sure the modification time changes, regardless of the
+		// resolution of the file system's timestamps
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(fileName, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeProto(`syntax = "proto3"; package test; message Empty {} service Svc { rpc A(Empty) returns (Empty); }`, time.Hour)
+
+	oldPaths, oldFiles := importPaths, protoFiles
+	importPaths, protoFiles = multiString{dir}, multiString{"test.proto"}
+	defer func() {
+		importPaths, protoFiles = oldPaths, oldFiles
+	}()
+
+	initial, err := readFileSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloaded grpcurl.DescriptorSource
+	var log strings.Builder
+	w, err := newDescriptorWatcher(initial, &log, func(source grpcurl.DescriptorSource) error {
+		reloaded = source
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.check()
+	if reloaded != nil || log.Len() > 0 {
+		t.Fatalf("unexpected reload when nothing changed: %s", log.String())
+	}
+
+	writeProto(`syntax = "proto3"; package test; message Empty {} service Svc { rpc A(Empty) returns (Empty); rpc B(Empty) returns (Empty); }`, time.Minute)
+	w.check()
+	if reloaded == nil {
+		t.Fatalf("descriptors were not reloaded: %s", log.String())
+	}
+	if _, err := findMethod(reloaded, "test.Svc/B"); err != nil {
+		t.Errorf("reloaded descriptors do not include new method: %v", err)
+	}
+	if !strings.Contains(log.String(), "+ method test.Svc/B") {
+		t.Errorf("log does not include schema change: %s", log.String())
+	}
+
+	reloaded = nil
+	log.Reset()
+	writeProto(`syntax = "proto3"; package test; garbage`, 0)
+	w.check()
+	if reloaded != nil {
+		t.Error("invalid descriptors should not be reloaded")
+	}
+	if !strings.Contains(log.String(), "continuing with previous ones") {
+		t.Errorf("log does not include error: %s", log.String())
+	}
+	if w.current == initial {
+		t.Error("watcher should keep the last successfully loaded descriptors")
+	}
+}
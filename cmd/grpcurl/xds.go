@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	v3statuspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/xds/csds"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// xdsBootstrapEnv is the environment variable from which gRPC reads the name
+// of the xDS bootstrap file.
+const xdsBootstrapEnv = "GRPC_XDS_BOOTSTRAP"
+
+// runWithXDSBootstrap runs grpcurl again, with the same arguments, but with
+// the xDS bootstrap environment variable set to the given file, for
+// -xds-bootstrap. This is necessary because gRPC reads the variable when the
+// program starts. It exits with the exit code of the child process. If the
+// variable is already set to the file, as it is in the child, this returns
+// without doing anything.
+func runWithXDSBootstrap(fileName string) {
+	fileName, err := filepath.Abs(fileName)
+	if err != nil {
+		fail(err, "Failed to resolve xDS bootstrap file")
+	}
+	if os.Getenv(xdsBootstrapEnv) == fileName {
+		return
+	}
+	if _, err := os.Stat(fileName); err != nil {
+		fail(err, "Failed to read xDS bootstrap file")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fail(err, "Failed to locate grpcurl executable")
+	}
+	cmd := exec.Command(self, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), xdsBootstrapEnv+"="+fileName)
+	// interrupts are delivered to the child too, which decides how to exit
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	} else if err != nil {
+		fail(err, "Failed to run grpcurl with xDS bootstrap file")
+	}
+	os.Exit(0)
+}
+
+// xdsResourceOrder is the order in which the types of xDS resources are
+// printed for -xds-status, which is the order in which they are resolved.
+var xdsResourceOrder = map[string]int{
+	"Listener":              0,
+	"RouteConfiguration":    1,
+	"Cluster":               2,
+	"ClusterLoadAssignment": 3,
+}
+
+// xdsStatusReporter reports the xDS resources that gRPC's xDS client has
+// received, for -xds-status.
+type xdsStatusReporter struct {
+	csds *csds.ClientStatusDiscoveryServer
+}
+
+// newXDSStatusReporter returns a reporter. It should be created before
+// connecting to an xds:/// target: it shares the xDS client with the
+// connection and keeps it open, so that the resources can be reported even if
+// the connection fails.
+func newXDSStatusReporter() (*xdsStatusReporter, error) {
+	s, err := csds.NewClientStatusDiscoveryServer()
+	if err != nil {
+		return nil, err
+	}
+	return &xdsStatusReporter{csds: s}, nil
+}
+
+// print prints the resources. If verbose, each resource's contents are also
+// printed, in JSON.
+func (r *xdsStatusReporter) print(w io.Writer, verbose bool) error {
+	resp, err := r.csds.FetchClientStatus(context.Background(), &v3statuspb.ClientStatusRequest{})
+	if err != nil {
+		return err
+	}
+	return writeXDSStatus(w, resp, verbose)
+}
+
+func (r *xdsStatusReporter) close() {
+	r.csds.Close()
+}
+
+func writeXDSStatus(w io.Writer, resp *v3statuspb.ClientStatusResponse, verbose bool) error {
+	var configs []*v3statuspb.ClientConfig_GenericXdsConfig
+	for _, c := range resp.GetConfig() {
+		configs = append(configs, c.GetGenericXdsConfigs()...)
+	}
+	if len(configs) == 0 {
+		_, err := fmt.Fprintln(w, "(No xDS resources)")
+		return err
+	}
+	rank := func(c *v3statuspb.ClientConfig_GenericXdsConfig) int {
+		if r, ok := xdsResourceOrder[xdsResourceType(c.GetTypeUrl())]; ok {
+			return r
+		}
+		return len(xdsResourceOrder)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		if ri, rj := rank(configs[i]), rank(configs[j]); ri != rj {
+			return ri < rj
+		}
+		if configs[i].GetTypeUrl() != configs[j].GetTypeUrl() {
+			return configs[i].GetTypeUrl() < configs[j].GetTypeUrl()
+		}
+		return configs[i].GetName() < configs[j].GetName()
+	})
+
+	for _, c := range configs {
+		fmt.Fprintf(w, "%s %s\n", xdsResourceType(c.GetTypeUrl()), c.GetName())
+		fmt.Fprintf(w, "  Status: %s\n", c.GetClientStatus())
+		if c.GetVersionInfo() != "" {
+			fmt.Fprintf(w, "  Version: %s\n", c.GetVersionInfo())
+		}
+		if e := c.GetErrorState(); e != nil {
+			fmt.Fprintf(w, "  Error: %s\n", e.GetDetails())
+		}
+		if verbose && c.GetXdsConfig() != nil {
+			b, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(c.GetXdsConfig())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "  Resource:\n    %s\n", strings.ReplaceAll(string(b), "\n", "\n    "))
+		}
+	}
+	return nil
+}
+
+// xdsResourceType returns the name of the type in the given type URL, like
+// "Listener" for "type.googleapis.com/envoy.config.listener.v3.Listener".
+func xdsResourceType(typeURL string) string {
+	return typeURL[strings.LastIndex(typeURL, ".")+1:]
+}
+
+// runXDSStatus dials the server using tryDial and prints the status of the
+// xDS resources, for -xds-status. It returns the connection, if one was made.
+func runXDSStatus(target string, verbose bool, tryDial func() (*grpc.ClientConn, error)) *grpc.ClientConn {
+	reporter, err := newXDSStatusReporter()
+	if err != nil {
+		fail(err, "Failed to get xDS status")
+	}
+	defer reporter.close()
+	cc, dialErr := tryDial()
+	// the status is printed even if the connection failed, since it may
+	// show which resource could not be resolved
+	if err := reporter.print(os.Stdout, verbose); err != nil {
+		fail(err, "Failed to get xDS status")
+	}
+	if dialErr != nil {
+		fail(dialErr, "Failed to dial target host %q", target)
+	}
+	return cc
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	v3adminpb "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	v3statuspb "github.com/envoyproxy/go-control-plane/envoy/service/status/v3"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestWriteXDSStatus(t *testing.T) {
+	const typePrefix = "type.googleapis.com/envoy.config."
+	contents, err := anypb.New(wrapperspb.String("route-1"))
+	if err != nil {
+		t.Fatalf("failed to create resource: %v", err)
+	}
+	resp := &v3statuspb.ClientStatusResponse{
+		Config: []*v3statuspb.ClientConfig{{
+			GenericXdsConfigs: []*v3statuspb.ClientConfig_GenericXdsConfig{
+				{TypeUrl: typePrefix + "cluster.v3.Cluster", Name: "cluster-b", VersionInfo: "3", ClientStatus: v3adminpb.ClientResourceStatus_ACKED},
+				{TypeUrl: typePrefix + "cluster.v3.Cluster", Name: "cluster-a", ClientStatus: v3adminpb.ClientResourceStatus_NACKED,
+					ErrorState: &v3adminpb.UpdateFailureState{Details: "bad cluster"}},
+				{TypeUrl: typePrefix + "route.v3.RouteConfiguration", Name: "route-1", VersionInfo: "2", ClientStatus: v3adminpb.ClientResourceStatus_ACKED},
+				{TypeUrl: typePrefix + "listener.v3.Listener", Name: "my-service", VersionInfo: "1", ClientStatus: v3adminpb.ClientResourceStatus_ACKED,
+					XdsConfig: contents},
+			},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeXDSStatus(&buf, resp, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `Listener my-service
+  Status: ACKED
+  Version: 1
+RouteConfiguration route-1
+  Status: ACKED
+  Version: 2
+Cluster cluster-a
+  Status: NACKED
+  Error: bad cluster
+Cluster cluster-b
+  Status: ACKED
+  Version: 3
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeXDSStatus(&buf, resp, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "  Resource:\n    {\n") || !strings.Contains(buf.String(), `"route-1"`) {
+		t.Errorf("expected resource contents, got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeXDSStatus(&buf, &v3statuspb.ClientStatusResponse{}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.String() != "(No xDS resources)\n" {
+		t.Errorf("unexpected output for no resources: %q", buf.String())
+	}
+}
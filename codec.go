@@ -0,0 +1,139 @@
+package grpcurl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 same as above
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	protov2 "google.golang.org/protobuf/proto"
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]encoding.Codec{
+		"proto-deterministic": deterministicCodec{},
+		"json":                jsonCodec{},
+	}
+)
+
+// RegisterCodec makes the given codec available via GetCodec under the given
+// name. The codec's Name method, on the other hand, determines the content
+// subtype used on the wire, so several codecs that use the same wire format
+// (like the deterministic proto codec) can be registered under different
+// names. Registering a codec with the same name as an existing one replaces
+// it.
+func RegisterCodec(name string, codec encoding.Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = codec
+}
+
+// GetCodec returns the codec registered with the given name. Besides those
+// registered via RegisterCodec, this includes "proto-deterministic", which
+// marshals messages deterministically, "json", which uses the JSON format for
+// messages, and any codec registered with the gRPC library (such as "proto").
+// It returns nil if there is no such codec.
+func GetCodec(name string) encoding.Codec {
+	codecsMu.RLock()
+	codec := codecs[name]
+	codecsMu.RUnlock()
+	if codec != nil {
+		return codec
+	}
+	return encoding.GetCodec(name)
+}
+
+// CodecNames returns the names of codecs registered via RegisterCodec, in
+// sorted order. Codecs registered with the gRPC library are not included.
+func CodecNames() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChannelWithCodec returns a channel that uses the given codec for all RPCs,
+// in place of the default proto codec. The returned channel can be given to
+// InvokeRPC.
+func ChannelWithCodec(ch grpcdynamic.Channel, codec encoding.Codec) grpcdynamic.Channel {
+	return codecChannel{Channel: ch, codec: codec}
+}
+
+type codecChannel struct {
+	grpcdynamic.Channel
+	codec encoding.Codec
+}
+
+func (ch codecChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return ch.Channel.Invoke(ctx, method, args, reply, append(opts, grpc.ForceCodec(ch.codec))...)
+}
+
+func (ch codecChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return ch.Channel.NewStream(ctx, desc, method, append(opts, grpc.ForceCodec(ch.codec))...)
+}
+
+// deterministicCodec is the proto codec, but with deterministic marshaling,
+// so that map entries are always written in the same order.
+type deterministicCodec struct{}
+
+func (deterministicCodec) Marshal(v interface{}) ([]byte, error) {
+	// dynamic messages do not support deterministic marshaling via the
+	// protobuf API, but provide their own method for it
+	if dm, ok := v.(interface{ MarshalDeterministic() ([]byte, error) }); ok {
+		return dm.MarshalDeterministic()
+	}
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	return protov2.MarshalOptions{Deterministic: true}.Marshal(proto.MessageV2(msg))
+}
+
+func (deterministicCodec) Unmarshal(data []byte, v interface{}) error {
+	return encoding.GetCodec("proto").Unmarshal(data, v)
+}
+
+func (deterministicCodec) Name() string {
+	return "proto"
+}
+
+// jsonCodec encodes messages in the JSON format, for servers that register a
+// codec named "json".
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	str, err := (&jsonpb.Marshaler{}).MarshalToString(msg)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(str), nil
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	// allow unknown fields, since servers may be newer than their descriptors
+	u := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	return u.Unmarshal(bytes.NewReader(data), msg)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
@@ -0,0 +1,99 @@
+package grpcurl_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb" //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/golang/protobuf/proto"  //lint:ignore SA1019 same as above
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+
+	. "github.com/fullstorydev/grpcurl"
+	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
+)
+
+func TestGetCodec(t *testing.T) {
+	for _, name := range []string{"proto", "proto-deterministic", "json"} {
+		if GetCodec(name) == nil {
+			t.Errorf("GetCodec(%q) returned nil", name)
+		}
+	}
+	if c := GetCodec("no-such-codec"); c != nil {
+		t.Errorf("GetCodec returned %v for unknown codec", c)
+	}
+
+	custom := GetCodec("json")
+	RegisterCodec("test-custom", custom)
+	if GetCodec("test-custom") != custom {
+		t.Error("GetCodec did not return registered codec")
+	}
+	found := false
+	for _, name := range CodecNames() {
+		found = found || name == "test-custom"
+	}
+	if !found {
+		t.Errorf("CodecNames() = %v, missing registered codec", CodecNames())
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	req := &grpcurl_testing.SimpleRequest{
+		ResponseSize: 42,
+		Payload:      &grpcurl_testing.Payload{Body: []byte("abc")},
+	}
+	for _, name := range []string{"proto-deterministic", "json"} {
+		t.Run(name, func(t *testing.T) {
+			codec := GetCodec(name)
+			data, err := codec.Marshal(req)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if name == "json" && !strings.Contains(string(data), `"responseSize":42`) {
+				t.Errorf("unexpected JSON: %s", data)
+			}
+			var got grpcurl_testing.SimpleRequest
+			if err := codec.Unmarshal(data, &got); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if !proto.Equal(req, &got) {
+				t.Errorf("round trip changed message: %v != %v", &got, req)
+			}
+		})
+	}
+
+	// unknown fields are ignored, in case the server is newer
+	var got grpcurl_testing.SimpleRequest
+	if err := GetCodec("json").Unmarshal([]byte(`{"responseSize":1,"newField":true}`), &got); err != nil {
+		t.Errorf("failed to unmarshal with unknown field: %v", err)
+	}
+}
+
+func TestCodecWireName(t *testing.T) {
+	// the deterministic codec must use the same content subtype as proto, so
+	// servers need not know about it
+	if name := GetCodec("proto-deterministic").Name(); name != encoding.GetCodec("proto").Name() {
+		t.Errorf("deterministic codec uses content subtype %q", name)
+	}
+}
+
+func TestChannelWithCodec(t *testing.T) {
+	ch := ChannelWithCodec(ccNoReflect, GetCodec("proto-deterministic"))
+	h := &handler{reqMessages: []string{payload1}}
+	err := InvokeRPC(context.Background(), sourceProtoset, ch, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, func(m proto.Message) error {
+		data, err := h.getRequestData()
+		if err != nil {
+			return err
+		}
+		return jsonpb.UnmarshalString(string(data), m)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	if h.check(t, "testing.TestService.UnaryCall", codes.OK, 1, 1) {
+		if h.respMessages[0] != payload1 {
+			t.Errorf("unexpected response from RPC: expecting %s; got %s", payload1, h.respMessages[0])
+		}
+	}
+}
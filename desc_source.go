@@ -8,15 +8,18 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"              //lint:ignore SA1019 we have to import these because some of their types appear in exported API
 	"github.com/jhump/protoreflect/desc"            //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/desc/protoprint"
-	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -78,47 +81,47 @@ func DescriptorSourceFromProtoFiles(importPaths []string, fileNames ...string) (
 }
 
 // DescriptorSourceFromFileDescriptorSet creates a DescriptorSource that is backed by the FileDescriptorSet.
+// The returned source is also a DescriptorSourceV2; see DescriptorSourceV2From.
 func DescriptorSourceFromFileDescriptorSet(files *descriptorpb.FileDescriptorSet) (DescriptorSource, error) {
 	unresolved := map[string]*descriptorpb.FileDescriptorProto{}
 	for _, fd := range files.File {
 		unresolved[fd.GetName()] = fd
 	}
-	resolved := map[string]*desc.FileDescriptor{}
+	resolved := &protoregistry.Files{}
 	for _, fd := range files.File {
 		_, err := resolveFileDescriptor(unresolved, resolved, fd.GetName())
 		if err != nil {
 			return nil, err
 		}
 	}
-	return &fileSource{files: resolved}, nil
+	return DescriptorSourceFromV2(DescriptorSourceFromFiles(resolved)), nil
 }
 
-func resolveFileDescriptor(unresolved map[string]*descriptorpb.FileDescriptorProto, resolved map[string]*desc.FileDescriptor, filename string) (*desc.FileDescriptor, error) {
-	if r, ok := resolved[filename]; ok {
+func resolveFileDescriptor(unresolved map[string]*descriptorpb.FileDescriptorProto, resolved *protoregistry.Files, filename string) (protoreflect.FileDescriptor, error) {
+	if r, err := resolved.FindFileByPath(filename); err == nil {
 		return r, nil
 	}
 	fd, ok := unresolved[filename]
 	if !ok {
 		return nil, fmt.Errorf("no descriptor found for %q", filename)
 	}
-	deps := make([]*desc.FileDescriptor, 0, len(fd.GetDependency()))
 	for _, dep := range fd.GetDependency() {
-		depFd, err := resolveFileDescriptor(unresolved, resolved, dep)
-		if err != nil {
+		if _, err := resolveFileDescriptor(unresolved, resolved, dep); err != nil {
 			return nil, err
 		}
-		deps = append(deps, depFd)
 	}
-	result, err := desc.CreateFileDescriptor(fd, deps...)
+	result, err := protodesc.NewFile(fd, resolved)
 	if err != nil {
 		return nil, err
 	}
-	resolved[filename] = result
+	if err := resolved.RegisterFile(result); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
 // DescriptorSourceFromFileDescriptors creates a DescriptorSource that is backed by the given
-// file descriptors
+// file descriptors. The returned source is also a DescriptorSourceV2; see DescriptorSourceV2From.
 func DescriptorSourceFromFileDescriptors(files ...*desc.FileDescriptor) (DescriptorSource, error) {
 	fds := map[string]*desc.FileDescriptor{}
 	for _, fd := range files {
@@ -126,7 +129,16 @@ func DescriptorSourceFromFileDescriptors(files ...*desc.FileDescriptor) (Descrip
 			return nil, err
 		}
 	}
-	return &fileSource{files: fds}, nil
+	registry := &protoregistry.Files{}
+	for _, fd := range fds {
+		if err := registry.RegisterFile(fd.UnwrapFile()); err != nil {
+			return nil, err
+		}
+	}
+	// the source returns the given descriptors, rather than wrapping their
+	// files again
+	fs := &filesSource{files: registry}
+	return fs.descriptorSource(fds), nil
 }
 
 func addFile(fd *desc.FileDescriptor, fds map[string]*desc.FileDescriptor) error {
@@ -148,59 +160,6 @@ func addFile(fd *desc.FileDescriptor, fds map[string]*desc.FileDescriptor) error
 	return nil
 }
 
-type fileSource struct {
-	files  map[string]*desc.FileDescriptor
-	er     *dynamic.ExtensionRegistry
-	erInit sync.Once
-}
-
-func (fs *fileSource) ListServices() ([]string, error) {
-	set := map[string]bool{}
-	for _, fd := range fs.files {
-		for _, svc := range fd.GetServices() {
-			set[svc.GetFullyQualifiedName()] = true
-		}
-	}
-	sl := make([]string, 0, len(set))
-	for svc := range set {
-		sl = append(sl, svc)
-	}
-	return sl, nil
-}
-
-// GetAllFiles returns all of the underlying file descriptors. This is
-// more thorough and more efficient than the fallback strategy used by
-// the GetAllFiles package method, for enumerating all files from a
-// descriptor source.
-func (fs *fileSource) GetAllFiles() ([]*desc.FileDescriptor, error) {
-	files := make([]*desc.FileDescriptor, len(fs.files))
-	i := 0
-	for _, fd := range fs.files {
-		files[i] = fd
-		i++
-	}
-	return files, nil
-}
-
-func (fs *fileSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
-	for _, fd := range fs.files {
-		if dsc := fd.FindSymbol(fullyQualifiedName); dsc != nil {
-			return dsc, nil
-		}
-	}
-	return nil, notFound("Symbol", fullyQualifiedName)
-}
-
-func (fs *fileSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
-	fs.erInit.Do(func() {
-		fs.er = &dynamic.ExtensionRegistry{}
-		for _, fd := range fs.files {
-			fs.er.AddExtensionsFromFile(fd)
-		}
-	})
-	return fs.er.AllExtensionsForType(typeName), nil
-}
-
 // DescriptorSourceFromServer creates a DescriptorSource that uses the given gRPC reflection client
 // to interrogate a server for descriptor information. If the server does not support the reflection
 // API then the various DescriptorSource methods will return ErrReflectionNotSupported
@@ -245,6 +204,134 @@ func (ss serverSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescr
 	return exts, nil
 }
 
+// NewCachingSource returns a DescriptorSource that memoizes the results of the
+// given source's methods, so that repeated calls, such as when a method is
+// described and then invoked, do not fetch the same descriptors again, which
+// may require RPCs for a source that uses server reflection. Results are
+// cached for the given TTL, or forever if it is zero or negative. Errors are
+// not cached. The returned source is safe for concurrent use, although
+// concurrent calls for the same symbol before it is cached may each call the
+// underlying source.
+func NewCachingSource(src DescriptorSource, ttl time.Duration) DescriptorSource {
+	return &cachingSource{
+		src:        src,
+		ttl:        ttl,
+		now:        time.Now,
+		symbols:    map[string]cacheEntry{},
+		extensions: map[string]cacheEntry{},
+	}
+}
+
+type cachingSource struct {
+	src DescriptorSource
+	ttl time.Duration
+	// now returns the current time, for testing expiry
+	now func() time.Time
+
+	mu         sync.Mutex
+	services   cacheEntry
+	files      cacheEntry
+	symbols    map[string]cacheEntry
+	extensions map[string]cacheEntry
+}
+
+var _ sourceWithFiles = (*cachingSource)(nil)
+
+type cacheEntry struct {
+	// value is nil if nothing is cached
+	value   interface{}
+	expires time.Time
+}
+
+func (cs *cachingSource) get(entry *cacheEntry) (interface{}, bool) {
+	if entry.value == nil || (cs.ttl > 0 && !cs.now().Before(entry.expires)) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (cs *cachingSource) entry(value interface{}) cacheEntry {
+	return cacheEntry{value: value, expires: cs.now().Add(cs.ttl)}
+}
+
+func (cs *cachingSource) ListServices() ([]string, error) {
+	cs.mu.Lock()
+	v, ok := cs.get(&cs.services)
+	cs.mu.Unlock()
+	if !ok {
+		svcs, err := cs.src.ListServices()
+		if err != nil {
+			return nil, err
+		}
+		v = svcs
+		cs.mu.Lock()
+		cs.services = cs.entry(v)
+		cs.mu.Unlock()
+	}
+	// callers, like ListServices, may sort the slice, so each gets a copy
+	return append([]string(nil), v.([]string)...), nil
+}
+
+func (cs *cachingSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	cs.mu.Lock()
+	entry := cs.symbols[fullyQualifiedName]
+	v, ok := cs.get(&entry)
+	cs.mu.Unlock()
+	if ok {
+		return v.(desc.Descriptor), nil
+	}
+	d, err := cs.src.FindSymbol(fullyQualifiedName)
+	if err != nil {
+		return nil, err
+	}
+	cs.mu.Lock()
+	cs.symbols[fullyQualifiedName] = cs.entry(d)
+	cs.mu.Unlock()
+	return d, nil
+}
+
+func (cs *cachingSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	cs.mu.Lock()
+	entry := cs.extensions[typeName]
+	v, ok := cs.get(&entry)
+	cs.mu.Unlock()
+	if !ok {
+		exts, err := cs.src.AllExtensionsForType(typeName)
+		if err != nil {
+			return nil, err
+		}
+		v = exts
+		cs.mu.Lock()
+		cs.extensions[typeName] = cs.entry(v)
+		cs.mu.Unlock()
+	}
+	return append([]*desc.FieldDescriptor(nil), v.([]*desc.FieldDescriptor)...), nil
+}
+
+// GetAllFiles returns all of the underlying source's files, if it can
+// enumerate them. Otherwise, it returns the files that define the listed
+// services, and their dependencies, as GetAllFiles does.
+func (cs *cachingSource) GetAllFiles() ([]*desc.FileDescriptor, error) {
+	srcFiles, ok := cs.src.(sourceWithFiles)
+	if !ok {
+		return allFilesOfServices(cs)
+	}
+	cs.mu.Lock()
+	v, ok := cs.get(&cs.files)
+	cs.mu.Unlock()
+	if !ok {
+		files, err := srcFiles.GetAllFiles()
+		if err != nil {
+			return files, err
+		}
+		v = files
+		cs.mu.Lock()
+		cs.files = cs.entry(v)
+		cs.mu.Unlock()
+	}
+	return append([]*desc.FileDescriptor(nil), v.([]*desc.FileDescriptor)...), nil
+}
+
 func reflectionSupport(err error) error {
 	if err == nil {
 		return nil
@@ -297,6 +384,9 @@ func addFilesToSet(allFiles []*descriptorpb.FileDescriptorProto, expanded map[st
 
 // WriteProtoFiles will use the given descriptor source to resolve all the given
 // symbols and write proto files with their definitions to the given output directory.
+// If the descriptors include source code info, such as those parsed from proto
+// sources or loaded from a protoset built with --include_source_info, the
+// files' comments are written too.
 func WriteProtoFiles(outProtoDirPath string, descSource DescriptorSource, symbols ...string) error {
 	filenames, fds, err := getFileDescriptors(symbols, descSource)
 	if err != nil {
@@ -3,9 +3,18 @@ package grpcurl
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/golang/protobuf/proto" //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 we have to import this because it appears in exported API
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
@@ -60,3 +69,384 @@ func checkWriteProtoset(t *testing.T, descSrc DescriptorSource, protoset *descri
 		t.Fatalf("written protoset not equal to input:\nExpecting: %s\nActual: %s", protoset, &result)
 	}
 }
+
+func TestCommentsArePreserved(t *testing.T) {
+	dir := t.TempDir()
+	source := `syntax = "proto3";
+
+package comments;
+
+// A widget.
+message Widget {
+  // The widget's name.
+  string name = 1;
+  int32 size = 2; // in millimeters
+}
+
+// Manages widgets.
+service WidgetService {
+  // Returns a widget.
+  rpc GetWidget ( Widget ) returns ( Widget );
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "comments.proto"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileSrc, err := DescriptorSourceFromProtoFiles([]string{dir}, "comments.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	// a protoset written from the parsed files includes their source code info
+	var buf bytes.Buffer
+	if err := WriteProtoset(&buf, fileSrc, "comments.WidgetService"); err != nil {
+		t.Fatalf("failed to write protoset: %v", err)
+	}
+	protosetFile := filepath.Join(dir, "comments.protoset")
+	if err := os.WriteFile(protosetFile, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	protosetSrc, err := DescriptorSourceFromProtoSets(protosetFile)
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+
+	for name, descSrc := range map[string]DescriptorSource{"proto": fileSrc, "protoset": protosetSrc} {
+		t.Run(name, func(t *testing.T) {
+			d, err := descSrc.FindSymbol("comments.Widget")
+			if err != nil {
+				t.Fatal(err)
+			}
+			txt, err := GetDescriptorText(d, descSrc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, comment := range []string{"// A widget.", "// The widget's name.", "// in millimeters"} {
+				if !strings.Contains(txt, comment) {
+					t.Errorf("described message is missing comment %q:\n%s", comment, txt)
+				}
+			}
+
+			outDir := t.TempDir()
+			if err := WriteProtoFiles(outDir, descSrc, "comments.WidgetService"); err != nil {
+				t.Fatalf("failed to write proto files: %v", err)
+			}
+			b, err := os.ReadFile(filepath.Join(outDir, "comments.proto"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, comment := range []string{"// A widget.", "// in millimeters", "// Manages widgets.", "// Returns a widget."} {
+				if !strings.Contains(string(b), comment) {
+					t.Errorf("written file is missing comment %q:\n%s", comment, b)
+				}
+			}
+		})
+	}
+}
+
+// countingSource counts the calls to the methods of a descriptor source.
+type countingSource struct {
+	DescriptorSource
+	mu                                      sync.Mutex
+	listServices, findSymbol, allExtensions int
+}
+
+func (s *countingSource) ListServices() ([]string, error) {
+	s.mu.Lock()
+	s.listServices++
+	s.mu.Unlock()
+	return s.DescriptorSource.ListServices()
+}
+
+func (s *countingSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	s.mu.Lock()
+	s.findSymbol++
+	s.mu.Unlock()
+	return s.DescriptorSource.FindSymbol(fullyQualifiedName)
+}
+
+func (s *countingSource) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	s.mu.Lock()
+	s.allExtensions++
+	s.mu.Unlock()
+	return s.DescriptorSource.AllExtensionsForType(typeName)
+}
+
+func TestCachingSource(t *testing.T) {
+	fileSource, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	src := &countingSource{DescriptorSource: fileSource}
+	now := time.Now()
+	source := NewCachingSource(src, time.Minute)
+	source.(*cachingSource).now = func() time.Time {
+		return now
+	}
+
+	for i := 0; i < 2; i++ {
+		svcs, err := ListServices(source)
+		if err != nil {
+			t.Fatalf("failed to list services: %v", err)
+		}
+		if len(svcs) == 0 {
+			t.Fatal("expected services")
+		}
+		// the cached slice must not be modified by callers
+		svcs[0] = ""
+		if _, err := source.FindSymbol("testing.TestService.UnaryCall"); err != nil {
+			t.Fatalf("failed to find symbol: %v", err)
+		}
+		if _, err := source.AllExtensionsForType("testing.SimpleRequest"); err != nil {
+			t.Fatalf("failed to find extensions: %v", err)
+		}
+		// errors are not cached
+		if _, err := source.FindSymbol("testing.NoSuchService"); err == nil {
+			t.Fatal("expected error for unknown symbol")
+		}
+	}
+	svcs, err := source.ListServices()
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	for _, svc := range svcs {
+		if svc == "" {
+			t.Errorf("cached services were modified: %v", svcs)
+		}
+	}
+	if src.listServices != 1 || src.findSymbol != 3 || src.allExtensions != 1 {
+		t.Errorf("expected 1 ListServices, 3 FindSymbol, and 1 AllExtensionsForType calls, got %d, %d, and %d",
+			src.listServices, src.findSymbol, src.allExtensions)
+	}
+
+	// after the TTL, results are fetched again
+	now = now.Add(time.Minute)
+	if _, err := source.ListServices(); err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	if _, err := source.FindSymbol("testing.TestService.UnaryCall"); err != nil {
+		t.Fatalf("failed to find symbol: %v", err)
+	}
+	if src.listServices != 2 || src.findSymbol != 4 {
+		t.Errorf("expected 2 ListServices and 4 FindSymbol calls after expiry, got %d and %d", src.listServices, src.findSymbol)
+	}
+
+	// all files are still enumerated via the underlying source
+	files, err := GetAllFiles(NewCachingSource(fileSource, 0))
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	expectedFiles, err := GetAllFiles(fileSource)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	if len(files) != len(expectedFiles) {
+		t.Errorf("expected %d files, got %d", len(expectedFiles), len(files))
+	}
+}
+
+func TestCachingSourceConcurrent(t *testing.T) {
+	fileSource, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	source := NewCachingSource(fileSource, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ListServices(source); err != nil {
+				t.Errorf("failed to list services: %v", err)
+			}
+			if _, err := source.FindSymbol("testing.TestService"); err != nil {
+				t.Errorf("failed to find symbol: %v", err)
+			}
+			if _, err := GetAllFiles(source); err != nil {
+				t.Errorf("failed to get all files: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDescriptorSourceFromFiles(t *testing.T) {
+	protoset, err := loadProtoset("./internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load test.protoset: %v", err)
+	}
+	files, err := protodesc.NewFiles(protoset)
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	source := DescriptorSourceFromFiles(files)
+
+	svcs, err := source.ListServices()
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	if len(svcs) == 0 {
+		t.Fatal("expected services")
+	}
+	d, err := source.FindDescriptorByName("testing.TestService.UnaryCall")
+	if err != nil {
+		t.Fatalf("failed to find method: %v", err)
+	}
+	if _, ok := d.(protoreflect.MethodDescriptor); !ok {
+		t.Errorf("expected method descriptor, got %T", d)
+	}
+	if _, err := source.FindDescriptorByName("testing.NoSuchService"); !isNotFoundError(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+
+	// the source can be used with the rest of the package
+	v1 := DescriptorSourceFromV2(source)
+	v1Svcs, err := ListServices(v1)
+	if err != nil {
+		t.Fatalf("failed to list services: %v", err)
+	}
+	if len(v1Svcs) != len(svcs) {
+		t.Errorf("expected %d services, got %d", len(svcs), len(v1Svcs))
+	}
+	md, err := v1.FindSymbol("testing.TestService.UnaryCall")
+	if err != nil {
+		t.Fatalf("failed to find method: %v", err)
+	}
+	if _, ok := md.(*desc.MethodDescriptor); !ok {
+		t.Errorf("expected method descriptor, got %T", md)
+	}
+	fds, err := GetAllFiles(v1)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	if len(fds) != files.NumFiles() {
+		t.Errorf("expected %d files, got %d", files.NumFiles(), len(fds))
+	}
+	if DescriptorSourceV2From(v1) != source {
+		t.Error("expected original source when adapting back")
+	}
+}
+
+func TestDescriptorSourceV2From(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	v2 := DescriptorSourceV2From(source)
+	d, err := v2.FindDescriptorByName("testing.TestService")
+	if err != nil {
+		t.Fatalf("failed to find service: %v", err)
+	}
+	if sd, ok := d.(protoreflect.ServiceDescriptor); !ok {
+		t.Errorf("expected service descriptor, got %T", d)
+	} else if sd.Methods().ByName("UnaryCall") == nil {
+		t.Error("expected service to have UnaryCall method")
+	}
+	if _, err := v2.FindDescriptorByName("testing.NoSuchService"); !isNotFoundError(err) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	files, err := GetAllFilesV2(v2)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	fds, err := GetAllFiles(source)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	if len(files) != len(fds) {
+		t.Fatalf("expected %d files, got %d", len(fds), len(files))
+	}
+	for i := range files {
+		if files[i].Path() != fds[i].GetName() {
+			t.Errorf("file #%d: expected %s, got %s", i, fds[i].GetName(), files[i].Path())
+		}
+	}
+	if DescriptorSourceFromV2(v2) != source {
+		t.Error("expected original source when adapting back")
+	}
+}
+
+func TestDescriptorSourceV2Extensions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ext.proto"), []byte(`
+		syntax = "proto2";
+		package ext;
+		message Foo {
+			extensions 100 to 200;
+		}
+		extend Foo {
+			optional string bar = 100;
+		}
+		message Outer {
+			extend Foo {
+				optional int32 baz = 101;
+			}
+		}
+		`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := DescriptorSourceFromProtoFiles([]string{dir}, "ext.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	fds, err := GetAllFiles(source)
+	if err != nil {
+		t.Fatalf("failed to get all files: %v", err)
+	}
+	files := &protoregistry.Files{}
+	for _, fd := range fds {
+		if err := files.RegisterFile(fd.UnwrapFile()); err != nil {
+			t.Fatalf("failed to register %s: %v", fd.GetName(), err)
+		}
+	}
+
+	for name, v2 := range map[string]DescriptorSourceV2{
+		"files":   DescriptorSourceFromFiles(files),
+		"adapted": DescriptorSourceV2From(source),
+	} {
+		exts, err := v2.AllExtensionsForType("ext.Foo")
+		if err != nil {
+			t.Fatalf("%s: failed to find extensions: %v", name, err)
+		}
+		var names []string
+		for _, ext := range exts {
+			names = append(names, string(ext.FullName()))
+		}
+		sort.Strings(names)
+		if expected := []string{"ext.Outer.baz", "ext.bar"}; strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected extensions %v, got %v", name, expected, names)
+		}
+	}
+	v1Exts, err := DescriptorSourceFromV2(DescriptorSourceFromFiles(files)).AllExtensionsForType("ext.Foo")
+	if err != nil {
+		t.Fatalf("failed to find extensions: %v", err)
+	}
+	if len(v1Exts) != 2 {
+		t.Errorf("expected 2 extensions, got %d", len(v1Exts))
+	}
+}
+
+// unwrappedSource is a DescriptorSource whose symbols are descriptors that do
+// not wrap a protoreflect.Descriptor.
+type unwrappedSource struct {
+	DescriptorSource
+}
+
+func (s unwrappedSource) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	d, err := s.DescriptorSource.FindSymbol(fullyQualifiedName)
+	if err != nil {
+		return nil, err
+	}
+	return struct{ desc.Descriptor }{d}, nil
+}
+
+func TestDescriptorSourceV2FromUnwrappedDescriptor(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/test.protoset")
+	if err != nil {
+		t.Fatalf("failed to load protoset: %v", err)
+	}
+	v2 := DescriptorSourceV2From(unwrappedSource{source})
+	_, err = v2.FindDescriptorByName("testing.TestService")
+	if err == nil || !strings.Contains(err.Error(), "does not wrap a protoreflect.Descriptor") {
+		t.Errorf("expected error for descriptor that does not wrap a protoreflect.Descriptor, got %v", err)
+	}
+}
@@ -0,0 +1,512 @@
+package grpcurl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DescriptorSourceV2 is a source of protobuf descriptor information whose
+// descriptors are those of the google.golang.org/protobuf module
+// (protoreflect), which supports all protobuf editions.
+//
+// Methods are invoked, and their messages resolved, using a DescriptorSourceV2;
+// see InvokeRPCV2. The descriptor sources created from files in this package
+// are DescriptorSourceV2 implementations. DescriptorSource, whose descriptors
+// are those of the deprecated github.com/jhump/protoreflect/desc package, is
+// still supported: DescriptorSourceV2From and DescriptorSourceFromV2 convert a
+// source of one kind to the other.
+type DescriptorSourceV2 interface {
+	// ListServices returns the fully-qualified names of services. It will be all services in a set
+	// of descriptor files or the set of all services exposed by a gRPC server.
+	ListServices() ([]protoreflect.FullName, error)
+	// FindDescriptorByName returns a descriptor for the given fully-qualified name.
+	FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error)
+	// AllExtensionsForType returns all known extension fields that extend the given message type.
+	AllExtensionsForType(typeName protoreflect.FullName) ([]protoreflect.ExtensionDescriptor, error)
+}
+
+// sourceWithFilesV2 is the DescriptorSourceV2 analog of sourceWithFiles.
+type sourceWithFilesV2 interface {
+	GetAllFiles() ([]protoreflect.FileDescriptor, error)
+}
+
+// DescriptorSourceFromFiles creates a DescriptorSourceV2 that is backed by the
+// given registry of files, such as protoregistry.GlobalFiles.
+func DescriptorSourceFromFiles(files *protoregistry.Files) DescriptorSourceV2 {
+	return &filesSource{files: files}
+}
+
+type filesSource struct {
+	files *protoregistry.Files
+
+	// v1 is the DescriptorSource for this source, which is created once so
+	// that its descriptors are only wrapped once
+	v1     *v1Source
+	v1Init sync.Once
+}
+
+var _ sourceWithFilesV2 = (*filesSource)(nil)
+
+func (fs *filesSource) ListServices() ([]protoreflect.FullName, error) {
+	var svcs []protoreflect.FullName
+	fs.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			svcs = append(svcs, fd.Services().Get(i).FullName())
+		}
+		return true
+	})
+	return svcs, nil
+}
+
+func (fs *filesSource) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	d, err := fs.files.FindDescriptorByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		return nil, notFound("Symbol", string(name))
+	}
+	return d, err
+}
+
+func (fs *filesSource) AllExtensionsForType(typeName protoreflect.FullName) ([]protoreflect.ExtensionDescriptor, error) {
+	var exts []protoreflect.ExtensionDescriptor
+	fs.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		exts = appendExtensionsForType(exts, typeName, fd.Extensions(), fd.Messages())
+		return true
+	})
+	return exts, nil
+}
+
+// appendExtensionsForType appends the given extensions, and those declared in
+// the given messages, that extend the given message type.
+func appendExtensionsForType(exts []protoreflect.ExtensionDescriptor, typeName protoreflect.FullName, candidates protoreflect.ExtensionDescriptors, msgs protoreflect.MessageDescriptors) []protoreflect.ExtensionDescriptor {
+	for i := 0; i < candidates.Len(); i++ {
+		if ext := candidates.Get(i); ext.ContainingMessage().FullName() == typeName {
+			exts = append(exts, ext)
+		}
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		exts = appendExtensionsForType(exts, typeName, md.Extensions(), md.Messages())
+	}
+	return exts
+}
+
+func (fs *filesSource) GetAllFiles() ([]protoreflect.FileDescriptor, error) {
+	files := make([]protoreflect.FileDescriptor, 0, fs.files.NumFiles())
+	fs.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		files = append(files, fd)
+		return true
+	})
+	return files, nil
+}
+
+// descriptorSource returns the DescriptorSource for this source. The given
+// files, if any, are the descriptors that it returns for the files they wrap.
+func (fs *filesSource) descriptorSource(files map[string]*desc.FileDescriptor) *v1Source {
+	fs.v1Init.Do(func() {
+		fs.v1 = newV1Source(fs, files)
+	})
+	return fs.v1
+}
+
+// GetAllFilesV2 uses the given descriptor source to return a list of file
+// descriptors, sorted by name. Like GetAllFiles, if an error occurs, it
+// still returns as many files as it can.
+func GetAllFilesV2(source DescriptorSourceV2) ([]protoreflect.FileDescriptor, error) {
+	var files []protoreflect.FileDescriptor
+	var firstError error
+	if srcFiles, ok := source.(sourceWithFilesV2); ok {
+		files, firstError = srcFiles.GetAllFiles()
+	} else {
+		files, firstError = allFilesOfServicesV2(source)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path() < files[j].Path()
+	})
+	return files, firstError
+}
+
+// allFilesOfServicesV2 is the DescriptorSourceV2 analog of allFilesOfServices.
+func allFilesOfServicesV2(source DescriptorSourceV2) ([]protoreflect.FileDescriptor, error) {
+	svcNames, err := source.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var firstError error
+	allFiles := map[string]protoreflect.FileDescriptor{}
+	for _, name := range svcNames {
+		d, err := source.FindDescriptorByName(name)
+		if err != nil {
+			if firstError == nil {
+				firstError = err
+			}
+		} else {
+			addAllFilesToSetV2(d.ParentFile(), allFiles)
+		}
+	}
+	files := make([]protoreflect.FileDescriptor, 0, len(allFiles))
+	for _, fd := range allFiles {
+		files = append(files, fd)
+	}
+	return files, firstError
+}
+
+func addAllFilesToSetV2(fd protoreflect.FileDescriptor, all map[string]protoreflect.FileDescriptor) {
+	if _, ok := all[fd.Path()]; ok {
+		// already added
+		return
+	}
+	all[fd.Path()] = fd
+	for i := 0; i < fd.Imports().Len(); i++ {
+		addAllFilesToSetV2(fd.Imports().Get(i).FileDescriptor, all)
+	}
+}
+
+// DescriptorSourceV2From returns a DescriptorSourceV2 that is backed by the
+// given DescriptorSource. If the given source was created via
+// DescriptorSourceFromV2, or is one of the file-backed sources of this
+// package, the original DescriptorSourceV2 is returned.
+func DescriptorSourceV2From(source DescriptorSource) DescriptorSourceV2 {
+	if s, ok := source.(*v1Source); ok {
+		return s.src
+	}
+	return v2Source{DescriptorSource: source}
+}
+
+// DescriptorSourceFromV2 returns a DescriptorSource that is backed by the
+// given DescriptorSourceV2, for use with functions of this package that
+// accept a DescriptorSource. If the given source was created via
+// DescriptorSourceV2From, the original DescriptorSource is returned.
+func DescriptorSourceFromV2(source DescriptorSourceV2) DescriptorSource {
+	switch s := source.(type) {
+	case v2Source:
+		return s.DescriptorSource
+	case *filesSource:
+		return s.descriptorSource(nil)
+	}
+	return newV1Source(source, nil)
+}
+
+// v2Source adapts a DescriptorSource to DescriptorSourceV2.
+type v2Source struct {
+	DescriptorSource
+}
+
+var _ sourceWithFilesV2 = v2Source{}
+
+func (s v2Source) ListServices() ([]protoreflect.FullName, error) {
+	svcs, err := s.DescriptorSource.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]protoreflect.FullName, len(svcs))
+	for i, svc := range svcs {
+		names[i] = protoreflect.FullName(svc)
+	}
+	return names, nil
+}
+
+func (s v2Source) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	d, err := s.DescriptorSource.FindSymbol(string(name))
+	if err != nil {
+		return nil, err
+	}
+	dw, ok := d.(desc.DescriptorWrapper)
+	if !ok {
+		return nil, fmt.Errorf("descriptor for %q is a %T, which does not wrap a protoreflect.Descriptor", name, d)
+	}
+	return dw.Unwrap(), nil
+}
+
+func (s v2Source) AllExtensionsForType(typeName protoreflect.FullName) ([]protoreflect.ExtensionDescriptor, error) {
+	fields, err := s.DescriptorSource.AllExtensionsForType(string(typeName))
+	if err != nil {
+		return nil, err
+	}
+	exts := make([]protoreflect.ExtensionDescriptor, len(fields))
+	for i, fld := range fields {
+		exts[i] = fld.UnwrapField()
+	}
+	return exts, nil
+}
+
+func (s v2Source) GetAllFiles() ([]protoreflect.FileDescriptor, error) {
+	fds, err := GetAllFiles(s.DescriptorSource)
+	files := make([]protoreflect.FileDescriptor, len(fds))
+	for i, fd := range fds {
+		files[i] = fd.UnwrapFile()
+	}
+	return files, err
+}
+
+// v1Source adapts a DescriptorSourceV2 to DescriptorSource. It wraps each
+// file only once, so that the same descriptors are returned for the same
+// symbol.
+type v1Source struct {
+	src DescriptorSourceV2
+
+	mu sync.Mutex
+	// files are the wrapped files, by path
+	files map[string]*desc.FileDescriptor
+}
+
+// newV1Source returns a v1Source for the given source. The given files, if
+// any, are the descriptors that it returns for the files they wrap.
+func newV1Source(src DescriptorSourceV2, files map[string]*desc.FileDescriptor) *v1Source {
+	s := &v1Source{src: src, files: map[string]*desc.FileDescriptor{}}
+	for name, fd := range files {
+		s.files[name] = fd
+	}
+	return s
+}
+
+// wrapFile returns the desc.FileDescriptor that wraps the given file.
+func (s *v1Source) wrapFile(fd protoreflect.FileDescriptor) (*desc.FileDescriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wrapped, ok := s.files[fd.Path()]; ok && wrapped.UnwrapFile() == fd {
+		return wrapped, nil
+	}
+	wrapped, err := desc.WrapFile(fd)
+	if err != nil {
+		return nil, err
+	}
+	s.files[fd.Path()] = wrapped
+	return wrapped, nil
+}
+
+// wrap returns the desc.Descriptor that wraps the given descriptor.
+func (s *v1Source) wrap(d protoreflect.Descriptor) (desc.Descriptor, error) {
+	fd, err := s.wrapFile(d.ParentFile())
+	if err != nil {
+		return nil, err
+	}
+	if wrapped := fd.FindSymbol(string(d.FullName())); wrapped != nil {
+		return wrapped, nil
+	}
+	return nil, notFound("Symbol", string(d.FullName()))
+}
+
+func (s *v1Source) ListServices() ([]string, error) {
+	names, err := s.src.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	svcs := make([]string, len(names))
+	for i, name := range names {
+		svcs[i] = string(name)
+	}
+	return svcs, nil
+}
+
+func (s *v1Source) FindSymbol(fullyQualifiedName string) (desc.Descriptor, error) {
+	d, err := s.src.FindDescriptorByName(protoreflect.FullName(fullyQualifiedName))
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(d)
+}
+
+func (s *v1Source) AllExtensionsForType(typeName string) ([]*desc.FieldDescriptor, error) {
+	exts, err := s.src.AllExtensionsForType(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]*desc.FieldDescriptor, len(exts))
+	for i, ext := range exts {
+		d, err := s.wrap(ext)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = d.(*desc.FieldDescriptor)
+	}
+	return fields, nil
+}
+
+func (s *v1Source) GetAllFiles() ([]*desc.FileDescriptor, error) {
+	srcFiles, ok := s.src.(sourceWithFilesV2)
+	if !ok {
+		return allFilesOfServices(s)
+	}
+	files, err := srcFiles.GetAllFiles()
+	fds := make([]*desc.FileDescriptor, len(files))
+	for i, fd := range files {
+		var wrapErr error
+		if fds[i], wrapErr = s.wrapFile(fd); wrapErr != nil {
+			return nil, wrapErr
+		}
+	}
+	return fds, err
+}
+
+// typeResolver resolves message and extension types, as dynamicpb types, using
+// a descriptor source. It is used to parse and format messages whose types are
+// only known to the descriptor source, such as the messages in Any fields and
+// extensions that are not linked into the program.
+type typeResolver struct {
+	source DescriptorSourceV2
+
+	mu sync.Mutex
+	// extensions are the extension types found so far, by name
+	extensions map[protoreflect.FullName]protoreflect.ExtensionType
+	// extendees are the messages whose extensions have all been added to
+	// extensions
+	extendees map[protoreflect.FullName]bool
+}
+
+var (
+	_ protoregistry.MessageTypeResolver   = (*typeResolver)(nil)
+	_ protoregistry.ExtensionTypeResolver = (*typeResolver)(nil)
+)
+
+func newTypeResolver(source DescriptorSourceV2) *typeResolver {
+	return &typeResolver{
+		source:     source,
+		extensions: map[protoreflect.FullName]protoreflect.ExtensionType{},
+		extendees:  map[protoreflect.FullName]bool{},
+	}
+}
+
+func (r *typeResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	d, err := r.source.FindDescriptorByName(name)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, protoregistry.NotFound
+		}
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return dynamicpb.NewMessageType(md), nil
+}
+
+func (r *typeResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	name := url
+	if pos := strings.LastIndexByte(url, '/'); pos >= 0 {
+		name = url[pos+1:]
+	}
+	return r.FindMessageByName(protoreflect.FullName(name))
+}
+
+func (r *typeResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	r.mu.Lock()
+	xt := r.extensions[field]
+	r.mu.Unlock()
+	if xt != nil {
+		return xt, nil
+	}
+	d, err := r.source.FindDescriptorByName(field)
+	if err != nil {
+		if isNotFoundError(err) {
+			return nil, protoregistry.NotFound
+		}
+		return nil, err
+	}
+	xd, ok := d.(protoreflect.ExtensionDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an extension", field)
+	}
+	return r.addExtension(xd), nil
+}
+
+func (r *typeResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if err := r.addExtensionsForType(message); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, xt := range r.extensions {
+		if xd := xt.TypeDescriptor(); xd.ContainingMessage().FullName() == message && xd.Number() == field {
+			return xt, nil
+		}
+	}
+	return nil, protoregistry.NotFound
+}
+
+// addExtensionsForType adds the extensions of the given message type, as
+// found by the descriptor source, unless they have been added already.
+func (r *typeResolver) addExtensionsForType(message protoreflect.FullName) error {
+	r.mu.Lock()
+	done := r.extendees[message]
+	r.mu.Unlock()
+	if done {
+		return nil
+	}
+	exts, err := r.source.AllExtensionsForType(message)
+	if err != nil {
+		return err
+	}
+	for _, xd := range exts {
+		r.addExtension(xd)
+	}
+	r.mu.Lock()
+	r.extendees[message] = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *typeResolver) addExtension(xd protoreflect.ExtensionDescriptor) protoreflect.ExtensionType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if xt := r.extensions[xd.FullName()]; xt != nil {
+		return xt
+	}
+	xt := dynamicpb.NewExtensionType(xd)
+	r.extensions[xd.FullName()] = xt
+	return xt
+}
+
+// hasExtensions returns whether any extensions have been added.
+func (r *typeResolver) hasExtensions() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.extensions) > 0
+}
+
+// addAllExtensions adds the extensions of the given message type and of every
+// message type reachable from it via its fields, so that messages of the type
+// can be fully parsed and formatted.
+func (r *typeResolver) addAllExtensions(md protoreflect.MessageDescriptor, alreadyFetched map[protoreflect.FullName]bool) error {
+	if alreadyFetched[md.FullName()] {
+		return nil
+	}
+	alreadyFetched[md.FullName()] = true
+	if md.ExtensionRanges().Len() > 0 {
+		if err := r.addExtensionsForType(md.FullName()); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		var exts []protoreflect.ExtensionDescriptor
+		for _, xt := range r.extensions {
+			if xd := xt.TypeDescriptor(); xd.ContainingMessage().FullName() == md.FullName() {
+				exts = append(exts, xd)
+			}
+		}
+		r.mu.Unlock()
+		for _, xd := range exts {
+			if xd.Message() != nil {
+				if err := r.addAllExtensions(xd.Message(), alreadyFetched); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); fd.Message() != nil {
+			if err := r.addAllExtensions(fd.Message(), alreadyFetched); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
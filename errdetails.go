@@ -0,0 +1,79 @@
+package grpcurl
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// formatErrorDetail returns a readable form of the given error detail message,
+// if it is one of the common types defined in google/rpc/error_details.proto
+// whose contents are best shown as a table: BadRequest, QuotaFailure,
+// PreconditionFailure, and ErrorInfo. It returns false for other types.
+func formatErrorDetail(det *anypb.Any) (string, bool) {
+	msg, err := det.UnmarshalNew()
+	if err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	switch msg := msg.(type) {
+	case *errdetails.BadRequest:
+		buf.WriteString("Bad request:\n")
+		rows := make([][]string, len(msg.GetFieldViolations()))
+		for i, v := range msg.GetFieldViolations() {
+			rows[i] = []string{v.GetField(), v.GetDescription()}
+		}
+		writeDetailTable(&buf, []string{"FIELD", "DESCRIPTION"}, rows)
+	case *errdetails.QuotaFailure:
+		buf.WriteString("Quota failure:\n")
+		rows := make([][]string, len(msg.GetViolations()))
+		for i, v := range msg.GetViolations() {
+			rows[i] = []string{v.GetSubject(), v.GetDescription()}
+		}
+		writeDetailTable(&buf, []string{"SUBJECT", "DESCRIPTION"}, rows)
+	case *errdetails.PreconditionFailure:
+		buf.WriteString("Precondition failure:\n")
+		rows := make([][]string, len(msg.GetViolations()))
+		for i, v := range msg.GetViolations() {
+			rows[i] = []string{v.GetType(), v.GetSubject(), v.GetDescription()}
+		}
+		writeDetailTable(&buf, []string{"TYPE", "SUBJECT", "DESCRIPTION"}, rows)
+	case *errdetails.ErrorInfo:
+		buf.WriteString("Error info:\n")
+		rows := [][]string{{"Reason:", msg.GetReason()}, {"Domain:", msg.GetDomain()}}
+		keys := make([]string, 0, len(msg.GetMetadata()))
+		for k := range msg.GetMetadata() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			rows = append(rows, []string{k + ":", msg.GetMetadata()[k]})
+		}
+		writeDetailTable(&buf, nil, rows)
+	default:
+		return "", false
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), true
+}
+
+// writeDetailTable writes the given rows, and the header if it is not nil, as
+// aligned columns, indented by two spaces.
+func writeDetailTable(buf *bytes.Buffer, header []string, rows [][]string) {
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintf(tw, "  %s\n", strings.Join(header, "\t"))
+	}
+	for _, row := range rows {
+		// newlines and tabs in values would break the alignment
+		for i := range row {
+			row[i] = strings.NewReplacer("\n", " ", "\t", " ").Replace(row[i])
+		}
+		fmt.Fprintf(tw, "  %s\n", strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,96 @@
+package grpcurl
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPrintStatusErrorDetails(t *testing.T) {
+	stat, err := status.New(codes.InvalidArgument, "invalid order").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "customer.email", Description: "must be a valid address"},
+			{Field: "quantity", Description: "must be\npositive"},
+		}},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{
+			{Subject: "project:123", Description: "daily limit exceeded"},
+		}},
+		&errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{
+			{Type: "TOS", Subject: "example.com/terms", Description: "terms not accepted"},
+		}},
+		&errdetails.ErrorInfo{Reason: "API_DISABLED", Domain: "example.com", Metadata: map[string]string{"service": "orders", "consumer": "projects/123"}},
+	)
+	if err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	var buf bytes.Buffer
+	PrintStatusWithDetailTables(&buf, stat, NewJSONFormatter(false, AnyResolverFromDescriptorSource(nil)))
+	expected := `ERROR:
+  Code: InvalidArgument
+  Message: invalid order
+  Details:
+  1)	Bad request:
+    	  FIELD           DESCRIPTION
+    	  customer.email  must be a valid address
+    	  quantity        must be positive
+  2)	Quota failure:
+    	  SUBJECT      DESCRIPTION
+    	  project:123  daily limit exceeded
+  3)	Precondition failure:
+    	  TYPE  SUBJECT            DESCRIPTION
+    	  TOS   example.com/terms  terms not accepted
+  4)	Error info:
+    	  Reason:    API_DISABLED
+    	  Domain:    example.com
+    	  consumer:  projects/123
+    	  service:   orders
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestPrintStatusWithoutDetailTables(t *testing.T) {
+	stat, err := status.New(codes.InvalidArgument, "invalid order").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "quantity", Description: "must be positive"},
+		}},
+	)
+	if err != nil {
+		t.Fatalf("failed to create status: %v", err)
+	}
+	var buf bytes.Buffer
+	PrintStatus(&buf, stat, NewTextFormatter(false))
+	expected := `ERROR:
+  Code: InvalidArgument
+  Message: invalid order
+  Details:
+  1)	[type.googleapis.com/google.rpc.BadRequest]: <
+    	  field_violations: <
+    	    field: "quantity"
+    	    description: "must be positive"
+    	  >
+    	>
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestFormatErrorDetailOtherTypes(t *testing.T) {
+	det, err := anypb.New(durationpb.New(0))
+	if err != nil {
+		t.Fatalf("failed to create detail: %v", err)
+	}
+	if _, ok := formatErrorDetail(det); ok {
+		t.Error("expected other types to not be formatted")
+	}
+	if _, ok := formatErrorDetail(&anypb.Any{TypeUrl: "type.googleapis.com/unknown.Type"}); ok {
+		t.Error("expected unknown types to not be formatted")
+	}
+}
@@ -0,0 +1,150 @@
+package grpcurl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// MessageEvent describes a request or response message of an RPC.
+type MessageEvent struct {
+	// Index is the zero-based position of the message in its stream.
+	Index int
+	// Time is when the message was handed to gRPC to be sent, or when it was
+	// received.
+	Time time.Time
+	// Size is the size of the message's binary encoding, in bytes.
+	Size int
+	// Message is the message itself. Request messages are reused for
+	// subsequent requests, so handlers must not retain them; clone them
+	// instead.
+	Message proto.Message
+}
+
+// StreamEventHandler is a bag of callbacks for handling events that occur in the
+// course of invoking an RPC. It is a finer-grained alternative to InvocationEventHandler,
+// which also reports the request messages that are sent, and describes each message with
+// its position, time, and size, for building tools like recorders and interactive UIs.
+// The callbacks are generally called in the order they are listed below, except that
+// OnSendMessage, for client-streaming and bidi-streaming RPCs, may be called at any time
+// before OnClose. For bidi-streaming RPCs, it is called from a different goroutine than
+// the other callbacks, so it must be thread-safe.
+type StreamEventHandler interface {
+	// OnResolveMethod is called with a descriptor of the method that is being invoked.
+	OnResolveMethod(*desc.MethodDescriptor)
+	// OnSendHeaders is called with the request metadata that is being sent.
+	OnSendHeaders(metadata.MD)
+	// OnSendMessage is called for each request message that is sent.
+	OnSendMessage(MessageEvent)
+	// OnHeaders is called when response headers have been received.
+	OnHeaders(metadata.MD)
+	// OnReceiveMessage is called for each response message received.
+	OnReceiveMessage(MessageEvent)
+	// OnTrailers is called when response trailers have been received.
+	OnTrailers(metadata.MD)
+	// OnClose is called last, exactly once, with the final status of the RPC.
+	// If the RPC failed without a status from the server, such as when the
+	// method could not be resolved or the request data is invalid, the status
+	// describes the error that is also returned by InvokeRPCWithStreamHandler.
+	OnClose(*status.Status)
+}
+
+// InvokeRPCWithStreamHandler is like InvokeRPC, except that the given handler is a
+// StreamEventHandler.
+func InvokeRPCWithStreamHandler(ctx context.Context, source DescriptorSource, ch grpc.ClientConnInterface, methodName string,
+	headers []string, handler StreamEventHandler, requestData RequestSupplier) error {
+
+	adapter := &streamHandlerAdapter{handler: handler}
+	err := InvokeRPC(ctx, source, eventChannel{ClientConnInterface: ch, adapter: adapter}, methodName, headers, adapter, requestData)
+	if !adapter.closed {
+		handler.OnClose(status.Convert(err))
+	}
+	return err
+}
+
+// streamHandlerAdapter adapts a StreamEventHandler to InvocationEventHandler.
+// Request messages are reported via eventChannel.
+type streamHandlerAdapter struct {
+	handler StreamEventHandler
+	// numRequests is the number of requests sent; it is guarded by mu since
+	// requests may be sent from a different goroutine
+	mu           sync.Mutex
+	numRequests  int
+	numResponses int
+	closed       bool
+}
+
+func (a *streamHandlerAdapter) OnResolveMethod(md *desc.MethodDescriptor) {
+	a.handler.OnResolveMethod(md)
+}
+
+func (a *streamHandlerAdapter) OnSendHeaders(md metadata.MD) {
+	a.handler.OnSendHeaders(md)
+}
+
+func (a *streamHandlerAdapter) sent(msg interface{}, t time.Time) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	index := a.numRequests
+	a.numRequests++
+	a.mu.Unlock()
+	a.handler.OnSendMessage(MessageEvent{Index: index, Time: t, Size: proto.Size(m), Message: m})
+}
+
+func (a *streamHandlerAdapter) OnReceiveHeaders(md metadata.MD) {
+	a.handler.OnHeaders(md)
+}
+
+func (a *streamHandlerAdapter) OnReceiveResponse(resp proto.Message) {
+	a.handler.OnReceiveMessage(MessageEvent{Index: a.numResponses, Time: time.Now(), Size: proto.Size(resp), Message: resp})
+	a.numResponses++
+}
+
+func (a *streamHandlerAdapter) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	a.handler.OnTrailers(md)
+	a.closed = true
+	a.handler.OnClose(stat)
+}
+
+// eventChannel is a channel that reports the request messages that are sent
+// via it.
+type eventChannel struct {
+	grpc.ClientConnInterface
+	adapter *streamHandlerAdapter
+}
+
+func (ch eventChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	ch.adapter.sent(args, time.Now())
+	return ch.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (ch eventChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	str, err := ch.ClientConnInterface.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return eventStream{ClientStream: str, adapter: ch.adapter}, nil
+}
+
+type eventStream struct {
+	grpc.ClientStream
+	adapter *streamHandlerAdapter
+}
+
+func (s eventStream) SendMsg(m interface{}) error {
+	t := time.Now()
+	if err := s.ClientStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.adapter.sent(m, t)
+	return nil
+}
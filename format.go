@@ -8,16 +8,21 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
 
-	"github.com/golang/protobuf/jsonpb"     //lint:ignore SA1019 we have to import these because some of their types appear in exported API
-	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 same as above
+	"github.com/golang/protobuf/jsonpb"  //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 same as above
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
 // RequestParser processes input into messages.
@@ -33,8 +38,12 @@ type RequestParser interface {
 }
 
 type jsonRequestParser struct {
-	dec          *json.Decoder
-	unmarshaler  jsonpb.Unmarshaler
+	dec         *json.Decoder
+	unmarshaler jsonpb.Unmarshaler
+	// types, if not nil, resolves the extensions and Any messages of
+	// messages that implement the google.golang.org/protobuf API, which are
+	// then unmarshaled with protojson
+	types        *typeResolver
 	requestCount int
 }
 
@@ -70,6 +79,10 @@ func (f *jsonRequestParser) Next(m proto.Message) error {
 		return err
 	}
 	f.requestCount++
+	if m2, ok := m.(protoreflect.ProtoMessage); ok && f.types != nil {
+		opts := protojson.UnmarshalOptions{DiscardUnknown: f.unmarshaler.AllowUnknownFields, Resolver: f.types}
+		return opts.Unmarshal(msg, m2)
+	}
 	return f.unmarshaler.Unmarshal(bytes.NewReader(msg), m)
 }
 
@@ -82,8 +95,12 @@ const (
 )
 
 type textRequestParser struct {
-	r            *bufio.Reader
-	err          error
+	r   *bufio.Reader
+	err error
+	// types, if not nil, resolves the extensions and Any messages of
+	// messages that implement the google.golang.org/protobuf API, which are
+	// then unmarshaled with prototext
+	types        *typeResolver
 	requestCount int
 }
 
@@ -119,6 +136,9 @@ func (f *textRequestParser) Next(m proto.Message) error {
 
 	f.requestCount++
 
+	if m2, ok := m.(protoreflect.ProtoMessage); ok && f.types != nil {
+		return prototext.UnmarshalOptions{Resolver: f.types}.Unmarshal(b, m2)
+	}
 	return proto.UnmarshalText(string(b), m)
 }
 
@@ -134,10 +154,13 @@ type Formatter func(proto.Message) (string, error)
 // is true. The given resolver is used to assist with encoding of
 // google.protobuf.Any messages.
 func NewJSONFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter {
-	marshaler := jsonpb.Marshaler{
+	return newJSONFormatter(false, jsonpb.Marshaler{
 		EmitDefaults: emitDefaults,
 		AnyResolver:  resolver,
-	}
+	})
+}
+
+func newJSONFormatter(compact bool, marshaler jsonpb.Marshaler) Formatter {
 	// Workaround for indentation issue in jsonpb with Any messages.
 	// Bug was originally fixed in https://github.com/golang/protobuf/pull/834
 	// but later re-introduced before the module was deprecated and frozen.
@@ -148,6 +171,9 @@ func NewJSONFormatter(emitDefaults bool, resolver jsonpb.AnyResolver) Formatter
 		if err != nil {
 			return "", err
 		}
+		if compact {
+			return output, nil
+		}
 		var buf bytes.Buffer
 		if err := json.Indent(&buf, []byte(output), "", "  "); err != nil {
 			return "", err
@@ -212,7 +238,8 @@ func (tf *textFormatter) format(m proto.Message) (string, error) {
 	return str, nil
 }
 
-// Format of request data. The allowed values are 'json' or 'text'.
+// Format of request data. The allowed values are 'json', 'text', or any other
+// format registered via RegisterFormat.
 type Format string
 
 const (
@@ -230,9 +257,10 @@ const (
 )
 
 // AnyResolverFromDescriptorSource returns an AnyResolver that will search for
-// types using the given descriptor source.
+// types using the given descriptor source. The messages it returns are dynamicpb
+// messages.
 func AnyResolverFromDescriptorSource(source DescriptorSource) jsonpb.AnyResolver {
-	return &anyResolver{source: source}
+	return &anyResolver{types: newTypeResolver(DescriptorSourceV2From(source))}
 }
 
 // AnyResolverFromDescriptorSourceWithFallback returns an AnyResolver that will
@@ -241,73 +269,22 @@ func AnyResolverFromDescriptorSource(source DescriptorSource) jsonpb.AnyResolver
 // JSON with a "@type" property, just like an Any message, but also with a
 // custom "@value" property that includes the binary encoded payload.
 func AnyResolverFromDescriptorSourceWithFallback(source DescriptorSource) jsonpb.AnyResolver {
-	res := anyResolver{source: source}
+	res := anyResolver{types: newTypeResolver(DescriptorSourceV2From(source))}
 	return &anyResolverWithFallback{AnyResolver: &res}
 }
 
 type anyResolver struct {
-	source DescriptorSource
-
-	er dynamic.ExtensionRegistry
-
-	mu       sync.RWMutex
-	mf       *dynamic.MessageFactory
-	resolved map[string]func() proto.Message
+	types *typeResolver
 }
 
 func (r *anyResolver) Resolve(typeUrl string) (proto.Message, error) {
-	mname := typeUrl
-	if slash := strings.LastIndex(mname, "/"); slash >= 0 {
-		mname = mname[slash+1:]
-	}
-
-	r.mu.RLock()
-	factory := r.resolved[mname]
-	r.mu.RUnlock()
-
-	// already resolved?
-	if factory != nil {
-		return factory(), nil
-	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// double-check, in case we were racing with another goroutine
-	// that resolved this one
-	factory = r.resolved[mname]
-	if factory != nil {
-		return factory(), nil
-	}
-
-	// use descriptor source to resolve message type
-	d, err := r.source.FindSymbol(mname)
-	if err != nil {
-		return nil, err
-	}
-	md, ok := d.(*desc.MessageDescriptor)
-	if !ok {
+	mt, err := r.types.FindMessageByURL(typeUrl)
+	if err == protoregistry.NotFound {
 		return nil, fmt.Errorf("unknown message: %s", typeUrl)
+	} else if err != nil {
+		return nil, err
 	}
-	// populate any extensions for this message, too (if there are any)
-	if exts, err := r.source.AllExtensionsForType(mname); err == nil {
-		if err := r.er.AddExtension(exts...); err != nil {
-			return nil, err
-		}
-	}
-
-	if r.mf == nil {
-		r.mf = dynamic.NewMessageFactoryWithExtensionRegistry(&r.er)
-	}
-
-	factory = func() proto.Message {
-		return r.mf.NewMessage(md)
-	}
-	if r.resolved == nil {
-		r.resolved = map[string]func() proto.Message{}
-	}
-	r.resolved[mname] = factory
-	return factory(), nil
+	return protoadapt.MessageV1Of(mt.New().Interface()), nil
 }
 
 // anyResolverWithFallback can provide a fallback value for unknown
@@ -315,6 +292,8 @@ func (r *anyResolver) Resolve(typeUrl string) (proto.Message, error) {
 // that has the base64-encoded data for the unknown message value.
 type anyResolverWithFallback struct {
 	jsonpb.AnyResolver
+	// if true, an error is returned instead of the fallback value
+	strict bool
 }
 
 func (r anyResolverWithFallback) Resolve(typeUrl string) (proto.Message, error) {
@@ -336,6 +315,10 @@ func (r anyResolverWithFallback) Resolve(typeUrl string) (proto.Message, error)
 		return reflect.New(mt.Elem()).Interface().(proto.Message), nil
 	}
 
+	if r.strict {
+		return nil, fmt.Errorf("could not resolve type of Any message: %s is not recognized", mname)
+	}
+
 	// finally, fallback to a special placeholder that can marshal itself
 	// to JSON using a special "@value" property to show base64-encoded
 	// data for the embedded message
@@ -389,6 +372,25 @@ type FormatOptions struct {
 	// FormatJSON only flag.
 	AllowUnknownFields bool
 
+	// UseProtoNames flag, when true, uses the original field names from the
+	// proto source in the output instead of lowerCamelCase JSON names. The
+	// parser accepts either form regardless of this flag.
+	// FormatJSON only flag.
+	UseProtoNames bool
+
+	// CompactJSON flag, when true, formats each message as JSON on a single
+	// line, without any indentation. This is suitable for newline-delimited
+	// JSON output.
+	// FormatJSON only flag.
+	CompactJSON bool
+
+	// FailOnUnknownAny flag, when true, causes formatting to fail if a
+	// google.protobuf.Any message contains a type that cannot be resolved.
+	// Otherwise, its contents are shown as base64-encoded binary data, in an
+	// "@value" property.
+	// FormatJSON only flag.
+	FailOnUnknownAny bool
+
 	// IncludeTextSeparator is true then, when invoked to format multiple messages,
 	// all messages after the first one will be prefixed with the
 	// ASCII 'Record Separator' character (0x1E).
@@ -397,24 +399,121 @@ type FormatOptions struct {
 	IncludeTextSeparator bool
 }
 
+// RequestParserFactory creates a parser that reads request data in some
+// format from the given reader. The given descriptor source may be used for
+// parsing message data (if needed by the format).
+type RequestParserFactory func(in io.Reader, descSource DescriptorSource, opts FormatOptions) (RequestParser, error)
+
+// FormatterFactory creates a formatter that prints response data in some
+// format. The given descriptor source may be used for formatting message data
+// (if needed by the format).
+type FormatterFactory func(descSource DescriptorSource, opts FormatOptions) (Formatter, error)
+
+type formatFactories struct {
+	parser    RequestParserFactory
+	formatter FormatterFactory
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[Format]formatFactories{}
+)
+
+func init() {
+	RegisterFormat(FormatJSON, jsonRequestParserFactory, jsonFormatterFactory)
+	RegisterFormat(FormatText, textRequestParserFactory, textFormatterFactory)
+}
+
+// RegisterFormat registers a format of request and response data, so that it
+// may be used with RequestParserAndFormatter. If a format with the given name
+// is already registered, such as FormatJSON or FormatText, it is replaced.
+// This is typically called from an init function. It panics if the name is
+// empty or either factory is nil.
+func RegisterFormat(name Format, parserFactory RequestParserFactory, formatterFactory FormatterFactory) {
+	if name == "" {
+		panic("grpcurl: RegisterFormat called with empty name")
+	}
+	if parserFactory == nil || formatterFactory == nil {
+		panic(fmt.Sprintf("grpcurl: RegisterFormat called with nil factory for format %q", name))
+	}
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[name] = formatFactories{parser: parserFactory, formatter: formatterFactory}
+}
+
+// RegisteredFormats returns the names of all registered formats, in sorted
+// order.
+func RegisteredFormats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]Format, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func jsonRequestParserFactory(in io.Reader, descSource DescriptorSource, opts FormatOptions) (RequestParser, error) {
+	resolver := AnyResolverFromDescriptorSource(descSource)
+	unmarshaler := jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: opts.AllowUnknownFields}
+	return &jsonRequestParser{
+		dec:         json.NewDecoder(in),
+		unmarshaler: unmarshaler,
+		types:       newTypeResolver(DescriptorSourceV2From(descSource)),
+	}, nil
+}
+
+func jsonFormatterFactory(descSource DescriptorSource, opts FormatOptions) (Formatter, error) {
+	marshaler := jsonpb.Marshaler{
+		EmitDefaults: opts.EmitJSONDefaultFields,
+		OrigName:     opts.UseProtoNames,
+		AnyResolver:  anyResolverWithFallback{AnyResolver: AnyResolverFromDescriptorSource(descSource), strict: opts.FailOnUnknownAny},
+	}
+	return newJSONFormatter(opts.CompactJSON, marshaler), nil
+}
+
+func textRequestParserFactory(in io.Reader, descSource DescriptorSource, _ FormatOptions) (RequestParser, error) {
+	return &textRequestParser{
+		r:     bufio.NewReader(in),
+		types: newTypeResolver(DescriptorSourceV2From(descSource)),
+	}, nil
+}
+
+func textFormatterFactory(_ DescriptorSource, opts FormatOptions) (Formatter, error) {
+	return NewTextFormatter(opts.IncludeTextSeparator), nil
+}
+
 // RequestParserAndFormatter returns a request parser and formatter for the
-// given format. The given descriptor source may be used for parsing message
-// data (if needed by the format).
+// given format, which must be FormatJSON, FormatText, or another format
+// registered via RegisterFormat. The given descriptor source may be used for
+// parsing message data (if needed by the format).
 // It accepts a set of options. The field EmitJSONDefaultFields and IncludeTextSeparator
-// are options for JSON and protobuf text formats, respectively. The AllowUnknownFields field
-// is a JSON-only format flag.
+// are options for JSON and protobuf text formats, respectively. The AllowUnknownFields
+// and UseProtoNames fields are JSON-only format flags.
 // Requests will be parsed from the given in.
 func RequestParserAndFormatter(format Format, descSource DescriptorSource, in io.Reader, opts FormatOptions) (RequestParser, Formatter, error) {
-	switch format {
-	case FormatJSON:
-		resolver := AnyResolverFromDescriptorSource(descSource)
-		unmarshaler := jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: opts.AllowUnknownFields}
-		return NewJSONRequestParserWithUnmarshaler(in, unmarshaler), NewJSONFormatter(opts.EmitJSONDefaultFields, anyResolverWithFallback{AnyResolver: resolver}), nil
-	case FormatText:
-		return NewTextRequestParser(in), NewTextFormatter(opts.IncludeTextSeparator), nil
-	default:
+	if in == nil {
+		// callers that only need a formatter may not supply any input
+		in = strings.NewReader("")
+	}
+	formatsMu.RLock()
+	factories, ok := formats[format]
+	formatsMu.RUnlock()
+	if !ok {
 		return nil, nil, fmt.Errorf("unknown format: %s", format)
 	}
+	parser, err := factories.parser(in, descSource, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	formatter, err := factories.formatter(descSource, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parser, formatter, nil
 }
 
 // RequestParserAndFormatterFor returns a request parser and formatter for the
@@ -431,9 +530,12 @@ func RequestParserAndFormatterFor(format Format, descSource DescriptorSource, em
 	})
 }
 
-// DefaultEventHandler logs events to a writer. This is not thread-safe, but is
-// safe for use with InvokeRPC as long as NumResponses and Status are not read
-// until the call to InvokeRPC completes.
+// DefaultEventHandler logs events to a writer. It is both an
+// InvocationEventHandler and a StreamEventHandler, whose events are adapted to
+// the former, so it produces the same output with InvokeRPC and with
+// InvokeRPCWithStreamHandler. This is not thread-safe, but is safe for use
+// with either as long as NumResponses and Status are not read until the call
+// completes.
 type DefaultEventHandler struct {
 	Out       io.Writer
 	Formatter Formatter
@@ -470,6 +572,7 @@ func NewDefaultEventHandler(out io.Writer, descSource DescriptorSource, formatte
 }
 
 var _ InvocationEventHandler = (*DefaultEventHandler)(nil)
+var _ StreamEventHandler = (*DefaultEventHandler)(nil)
 
 func (h *DefaultEventHandler) OnResolveMethod(md *desc.MethodDescriptor) {
 	if h.VerbosityLevel > 0 {
@@ -509,11 +612,153 @@ func (h *DefaultEventHandler) OnReceiveResponse(resp proto.Message) {
 
 func (h *DefaultEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
 	h.Status = stat
+	h.OnTrailers(md)
+}
+
+// OnSendMessage does nothing; request messages are not logged.
+func (h *DefaultEventHandler) OnSendMessage(MessageEvent) {}
+
+func (h *DefaultEventHandler) OnHeaders(md metadata.MD) {
+	h.OnReceiveHeaders(md)
+}
+
+func (h *DefaultEventHandler) OnReceiveMessage(ev MessageEvent) {
+	h.OnReceiveResponse(ev.Message)
+}
+
+func (h *DefaultEventHandler) OnTrailers(md metadata.MD) {
 	if h.VerbosityLevel > 0 {
 		fmt.Fprintf(h.Out, "\nResponse trailers received:\n%s\n", MetadataToString(md))
 	}
 }
 
+func (h *DefaultEventHandler) OnClose(stat *status.Status) {
+	h.Status = stat
+}
+
+// EnvelopeEventHandler is an InvocationEventHandler that writes the results
+// of an RPC as a single JSON object, so that programs can consume response
+// metadata and the status along with the response messages. The object is
+// written to Out when the RPC completes and has the following form:
+//
+//	{
+//	  "headers": {"name": ["value", ...], ...},
+//	  "messages": [...],
+//	  "trailers": {"name": ["value", ...], ...},
+//	  "status": {"code": 5, "name": "NotFound", "message": "...", "details": [...]}
+//	}
+//
+// The values of binary headers and trailers (those whose names end in "-bin")
+// are base64-encoded. If any response message cannot be formatted, an "error"
+// property describes the failure. The Formatter must produce JSON, like one
+// returned by NewJSONFormatter. It is not thread-safe, but is safe for use
+// with InvokeRPC as long as NumResponses and Status are not read until the
+// call to InvokeRPC completes.
+type EnvelopeEventHandler struct {
+	Out       io.Writer
+	Formatter Formatter
+	// Compact, if true, causes the object to be written on a single line
+	// instead of being indented.
+	Compact bool
+
+	// NumResponses is the number of responses that have been received.
+	NumResponses int
+	// Status is the status that was received at the end of an RPC. It is
+	// nil if the RPC is still in progress.
+	Status *status.Status
+
+	envelope rpcEnvelope
+}
+
+type rpcEnvelope struct {
+	Headers  map[string][]string `json:"headers"`
+	Messages []json.RawMessage   `json:"messages"`
+	Trailers map[string][]string `json:"trailers"`
+	Status   envelopeStatus      `json:"status"`
+	Error    string              `json:"error,omitempty"`
+}
+
+type envelopeStatus struct {
+	Code    int               `json:"code"`
+	Name    string            `json:"name"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+var _ InvocationEventHandler = (*EnvelopeEventHandler)(nil)
+
+func (h *EnvelopeEventHandler) OnResolveMethod(*desc.MethodDescriptor) {}
+
+func (h *EnvelopeEventHandler) OnSendHeaders(metadata.MD) {}
+
+func (h *EnvelopeEventHandler) OnReceiveHeaders(md metadata.MD) {
+	h.envelope.Headers = metadataForJSON(md)
+}
+
+func (h *EnvelopeEventHandler) OnReceiveResponse(resp proto.Message) {
+	h.NumResponses++
+	respStr, err := h.Formatter(resp)
+	if err != nil {
+		if h.envelope.Error == "" {
+			h.envelope.Error = fmt.Sprintf("failed to format response message %d: %v", h.NumResponses, err)
+		}
+		return
+	}
+	h.envelope.Messages = append(h.envelope.Messages, json.RawMessage(respStr))
+}
+
+func (h *EnvelopeEventHandler) OnReceiveTrailers(stat *status.Status, md metadata.MD) {
+	h.Status = stat
+	h.envelope.Trailers = metadataForJSON(md)
+	h.envelope.Status = envelopeStatus{
+		Code:    int(stat.Code()),
+		Name:    stat.Code().String(),
+		Message: stat.Message(),
+	}
+	for i, det := range stat.Proto().GetDetails() {
+		detStr, err := h.Formatter(det)
+		if err != nil {
+			if h.envelope.Error == "" {
+				h.envelope.Error = fmt.Sprintf("failed to format status detail %d: %v", i+1, err)
+			}
+			continue
+		}
+		h.envelope.Status.Details = append(h.envelope.Status.Details, json.RawMessage(detStr))
+	}
+	if h.envelope.Headers == nil {
+		h.envelope.Headers = map[string][]string{}
+	}
+	if h.envelope.Messages == nil {
+		h.envelope.Messages = []json.RawMessage{}
+	}
+
+	enc := json.NewEncoder(h.Out)
+	enc.SetEscapeHTML(false)
+	if !h.Compact {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(&h.envelope); err != nil {
+		fmt.Fprintf(h.Out, "Failed to format results: %v\n", err)
+	}
+}
+
+// metadataForJSON converts the given metadata to a map, with the values of
+// binary headers base64-encoded. It never returns nil.
+func metadataForJSON(md metadata.MD) map[string][]string {
+	result := make(map[string][]string, len(md))
+	for k, vs := range md {
+		vals := make([]string, len(vs))
+		for i, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			vals[i] = v
+		}
+		result[k] = vals
+	}
+	return result
+}
+
 // PrintStatus prints details about the given status to the given writer. The given
 // formatter is used to print any detail messages that may be included in the status.
 // If the given status has a code of OK, "OK" is printed and that is all. Otherwise,
@@ -521,6 +766,18 @@ func (h *DefaultEventHandler) OnReceiveTrailers(stat *status.Status, md metadata
 // string, and each detail message if any are present. The detail messages will be
 // printed as proto text format or JSON, depending on the given formatter.
 func PrintStatus(w io.Writer, stat *status.Status, formatter Formatter) {
+	printStatus(w, stat, formatter, false)
+}
+
+// PrintStatusWithDetailTables is like PrintStatus, except that detail messages of
+// the common google.rpc types that describe violations (BadRequest, QuotaFailure,
+// PreconditionFailure) and ErrorInfo are printed as tables instead of with the given
+// formatter.
+func PrintStatusWithDetailTables(w io.Writer, stat *status.Status, formatter Formatter) {
+	printStatus(w, stat, formatter, true)
+}
+
+func printStatus(w io.Writer, stat *status.Status, formatter Formatter, detailTables bool) {
 	if stat.Code() == codes.OK {
 		fmt.Fprintln(w, "OK")
 		return
@@ -535,7 +792,15 @@ func PrintStatus(w io.Writer, stat *status.Status, formatter Formatter) {
 			fmt.Fprintf(w, "%s\t", prefix)
 			prefix = strings.Repeat(" ", len(prefix)) + "\t"
 
-			output, err := formatter(det)
+			var output string
+			ok := false
+			if detailTables {
+				output, ok = formatErrorDetail(det)
+			}
+			var err error
+			if !ok {
+				output, err = formatter(det)
+			}
 			if err != nil {
 				fmt.Fprintf(w, "Error parsing detail message: %v\n", err)
 			} else {
@@ -1,7 +1,9 @@
 package grpcurl
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"strings"
@@ -10,7 +12,11 @@ import (
 	"github.com/golang/protobuf/jsonpb"  //lint:ignore SA1019 we have to import these because some of their types appear in exported API
 	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -182,6 +188,189 @@ func TestHandler(t *testing.T) {
 	}
 }
 
+func TestUseProtoNames(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	msg := &descriptorpb.FieldDescriptorProto{TypeName: proto.String(".foo.Bar")}
+	for _, useProtoNames := range []bool{false, true} {
+		expected := `"typeName"`
+		if useProtoNames {
+			expected = `"type_name"`
+		}
+		in := strings.NewReader(`{"type_name": ".foo.Bar"} {"typeName": ".foo.Bar"}`)
+		rf, formatter, err := RequestParserAndFormatter(FormatJSON, source, in, FormatOptions{UseProtoNames: useProtoNames})
+		if err != nil {
+			t.Fatalf("failed to create parser and formatter: %v", err)
+		}
+		str, err := formatter(msg)
+		if err != nil {
+			t.Fatalf("failed to format message: %v", err)
+		}
+		if !strings.Contains(str, expected) {
+			t.Errorf("useProtoNames=%v: expected output to contain %s, got:\n%s", useProtoNames, expected, str)
+		}
+		// either form is accepted as input
+		for i := 0; i < 2; i++ {
+			var req descriptorpb.FieldDescriptorProto
+			if err := rf.Next(&req); err != nil {
+				t.Fatalf("failed to parse request #%d: %v", i+1, err)
+			}
+			if !proto.Equal(&req, msg) {
+				t.Errorf("useProtoNames=%v: wrong request #%d: expected %v, got %v", useProtoNames, i+1, msg, &req)
+			}
+		}
+	}
+}
+
+func TestCompactJSON(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	_, formatter, err := RequestParserAndFormatter(FormatJSON, source, nil, FormatOptions{CompactJSON: true})
+	if err != nil {
+		t.Fatalf("failed to create formatter: %v", err)
+	}
+	msg := &descriptorpb.FieldDescriptorProto{Name: proto.String("foo"), Number: proto.Int32(1)}
+	str, err := formatter(msg)
+	if err != nil {
+		t.Fatalf("failed to format message: %v", err)
+	}
+	if expected := `{"name":"foo","number":1}`; str != expected {
+		t.Errorf("expected %s, got %s", expected, str)
+	}
+}
+
+// hexRequestParser parses requests from lines of hex-encoded binary data.
+type hexRequestParser struct {
+	scanner     *bufio.Scanner
+	numRequests int
+}
+
+func (p *hexRequestParser) Next(msg proto.Message) error {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	b, err := hex.DecodeString(p.scanner.Text())
+	if err != nil {
+		return err
+	}
+	p.numRequests++
+	return proto.Unmarshal(b, msg)
+}
+
+func (p *hexRequestParser) NumRequests() int {
+	return p.numRequests
+}
+
+func TestRegisterFormat(t *testing.T) {
+	const formatHex = Format("hex")
+	RegisterFormat(formatHex, func(in io.Reader, _ DescriptorSource, _ FormatOptions) (RequestParser, error) {
+		return &hexRequestParser{scanner: bufio.NewScanner(in)}, nil
+	}, func(_ DescriptorSource, _ FormatOptions) (Formatter, error) {
+		return func(msg proto.Message) (string, error) {
+			b, err := proto.Marshal(msg)
+			return hex.EncodeToString(b), err
+		}, nil
+	})
+	defer func() {
+		formatsMu.Lock()
+		delete(formats, formatHex)
+		formatsMu.Unlock()
+	}()
+
+	registered := RegisteredFormats()
+	expected := []Format{formatHex, FormatJSON, FormatText}
+	if fmt.Sprint(registered) != fmt.Sprint(expected) {
+		t.Errorf("expected registered formats %v, got %v", expected, registered)
+	}
+
+	msg := &descriptorpb.FieldDescriptorProto{Name: proto.String("foo"), Number: proto.Int32(1)}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %v", err)
+	}
+	in := strings.NewReader(hex.EncodeToString(b) + "\n")
+	rf, formatter, err := RequestParserAndFormatter(formatHex, nil, in, FormatOptions{})
+	if err != nil {
+		t.Fatalf("failed to create parser and formatter: %v", err)
+	}
+	var req descriptorpb.FieldDescriptorProto
+	if err := rf.Next(&req); err != nil {
+		t.Fatalf("failed to parse request: %v", err)
+	}
+	if !proto.Equal(&req, msg) {
+		t.Errorf("wrong request: expected %v, got %v", msg, &req)
+	}
+	if err := rf.Next(&req); err != io.EOF {
+		t.Errorf("expected io.EOF after last request, got %v", err)
+	}
+	str, err := formatter(msg)
+	if err != nil {
+		t.Fatalf("failed to format message: %v", err)
+	}
+	if expected := hex.EncodeToString(b); str != expected {
+		t.Errorf("expected %s, got %s", expected, str)
+	}
+
+	if _, _, err := RequestParserAndFormatter(Format("yaml"), nil, nil, FormatOptions{}); err == nil {
+		t.Error("expected error for unregistered format")
+	}
+}
+
+func TestFailOnUnknownAny(t *testing.T) {
+	source, err := DescriptorSourceFromProtoSets("internal/testing/example.protoset")
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	msg := &anypb.Any{TypeUrl: "type.googleapis.com/foo.Unknown", Value: []byte{8, 1}}
+	for _, strict := range []bool{false, true} {
+		_, formatter, err := RequestParserAndFormatter(FormatJSON, source, nil, FormatOptions{FailOnUnknownAny: strict, CompactJSON: true})
+		if err != nil {
+			t.Fatalf("failed to create formatter: %v", err)
+		}
+		str, err := formatter(msg)
+		if strict {
+			if err == nil || !strings.Contains(err.Error(), "foo.Unknown is not recognized") {
+				t.Errorf("expected error for unknown type, got %v: %s", err, str)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to format message: %v", err)
+		}
+		if !strings.Contains(str, `"@value":"CAE="`) {
+			t.Errorf("expected base64 value for unknown type, got %s", str)
+		}
+	}
+}
+
+func TestEnvelopeEventHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := &EnvelopeEventHandler{Out: &buf, Formatter: NewJSONFormatter(false, nil), Compact: true}
+	h.OnSendHeaders(metadata.Pairs("x-ignored", "abc"))
+	h.OnReceiveHeaders(metadata.Pairs("x-foo", "bar"))
+	h.OnReceiveResponse(&descriptorpb.FieldDescriptorProto{Name: proto.String("a")})
+	h.OnReceiveResponse(&descriptorpb.FieldDescriptorProto{Name: proto.String("b")})
+	if buf.Len() != 0 {
+		t.Fatalf("nothing should be written before the RPC completes, got %q", buf.String())
+	}
+	h.OnReceiveTrailers(status.New(codes.NotFound, "nope"), metadata.Pairs("x-baz-bin", "\x00\x01"))
+
+	expected := `{"headers":{"x-foo":["bar"]},"messages":[{"name":"a"},{"name":"b"}],"trailers":{"x-baz-bin":["AAE="]},"status":{"code":5,"name":"NotFound","message":"nope"}}` + "\n"
+	if actual := buf.String(); actual != expected {
+		t.Errorf("wrong output:\nexpected %s\ngot %s", expected, actual)
+	}
+	if h.NumResponses != 2 || h.Status.Code() != codes.NotFound {
+		t.Errorf("wrong results: %d responses, status %v", h.NumResponses, h.Status.Code())
+	}
+}
+
 // compare checks that actual and expected are equal, returning true if so.
 // A simple equality check (==) does not suffice because jsonpb formats
 // structpb.Value strangely. So if that formatting gets fixed, we don't
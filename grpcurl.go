@@ -30,7 +30,9 @@ import (
 	xdsCredentials "google.golang.org/grpc/credentials/xds"
 	_ "google.golang.org/grpc/health" // import grpc/health to enable transparent client side checking
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
 	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -52,7 +54,7 @@ type sourceWithFiles interface {
 	GetAllFiles() ([]*desc.FileDescriptor, error)
 }
 
-var _ sourceWithFiles = (*fileSource)(nil)
+var _ sourceWithFiles = (*v1Source)(nil)
 
 // GetAllFiles uses the given descriptor source to return a list of file descriptors.
 func GetAllFiles(source DescriptorSource) ([]*desc.FileDescriptor, error) {
@@ -67,31 +69,39 @@ func GetAllFiles(source DescriptorSource) ([]*desc.FileDescriptor, error) {
 	} else {
 		// Source does not implement GetAllFiles method, so use ListServices
 		// and grab files from there.
-		svcNames, err := source.ListServices()
+		files, firstError = allFilesOfServices(source)
+	}
+
+	sort.Sort(filesByName(files))
+	return files, firstError
+}
+
+// allFilesOfServices returns the files that define the services of the given
+// source, and their dependencies. Like GetAllFiles, it returns as many files
+// as it can, along with the first error that occurred.
+func allFilesOfServices(source DescriptorSource) ([]*desc.FileDescriptor, error) {
+	svcNames, err := source.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var firstError error
+	allFiles := map[string]*desc.FileDescriptor{}
+	for _, name := range svcNames {
+		d, err := source.FindSymbol(name)
 		if err != nil {
-			firstError = err
-		} else {
-			allFiles := map[string]*desc.FileDescriptor{}
-			for _, name := range svcNames {
-				d, err := source.FindSymbol(name)
-				if err != nil {
-					if firstError == nil {
-						firstError = err
-					}
-				} else {
-					addAllFilesToSet(d.GetFile(), allFiles)
-				}
-			}
-			files = make([]*desc.FileDescriptor, len(allFiles))
-			i := 0
-			for _, fd := range allFiles {
-				files[i] = fd
-				i++
+			if firstError == nil {
+				firstError = err
 			}
+		} else {
+			addAllFilesToSet(d.GetFile(), allFiles)
 		}
 	}
-
-	sort.Sort(filesByName(files))
+	files := make([]*desc.FileDescriptor, len(allFiles))
+	i := 0
+	for _, fd := range allFiles {
+		files[i] = fd
+		i++
+	}
 	return files, firstError
 }
 
@@ -250,19 +260,23 @@ func MetadataToString(md metadata.MD) string {
 	return b.String()
 }
 
+// printer is used to describe elements. When the descriptors include source
+// code info, the leading and trailing comments of each element are printed,
+// since they are usually its documentation.
 var printer = &protoprint.Printer{
 	Compact:                  true,
-	OmitComments:             protoprint.CommentsNonDoc,
+	OmitComments:             protoprint.CommentsDetached | protoprint.CommentsTokens,
 	SortElements:             true,
 	ForceFullyQualifiedNames: true,
 }
 
 // GetDescriptorText returns a string representation of the given descriptor.
 // This returns a snippet of proto source that describes the given element.
-func GetDescriptorText(dsc desc.Descriptor, _ DescriptorSource) (string, error) {
-	// Note: DescriptorSource is not used, but remains an argument for backwards
-	// compatibility with previous implementation.
-	txt, err := printer.PrintProtoToString(dsc)
+// Custom options are printed with their names and values if their extensions
+// are visible to the element's file or, failing that, known to the given
+// source, which may be nil.
+func GetDescriptorText(dsc desc.Descriptor, source DescriptorSource) (string, error) {
+	txt, err := printer.PrintProtoToString(withSourceExtensions(dsc, source))
 	if err != nil {
 		return "", err
 	}
@@ -273,6 +287,301 @@ func GetDescriptorText(dsc desc.Descriptor, _ DescriptorSource) (string, error)
 	return txt, nil
 }
 
+// GetStandaloneDescriptorText returns a string representation of the given
+// descriptor, like GetDescriptorText, but preceded by the syntax (or edition),
+// package, and import statements of its file. Only the imports that are needed
+// by the element are included: those that define the types it references and
+// the custom options it uses. So a top-level element can be pasted into a
+// .proto file of its own and compiled, as long as it does not refer to other
+// elements in the same file.
+func GetStandaloneDescriptorText(dsc desc.Descriptor, source DescriptorSource) (string, error) {
+	txt, err := GetDescriptorText(dsc, source)
+	if err != nil {
+		return "", err
+	}
+	dsc = withSourceExtensions(dsc, source)
+	fd := dsc.GetFile()
+	fdp := fd.AsFileDescriptorProto()
+	var b strings.Builder
+	switch fdp.GetSyntax() {
+	case "editions":
+		fmt.Fprintf(&b, "edition = %q;\n", strings.TrimPrefix(fdp.GetEdition().String(), "EDITION_"))
+	case "proto3":
+		b.WriteString("syntax = \"proto3\";\n")
+	default:
+		b.WriteString("syntax = \"proto2\";\n")
+	}
+	if pkg := fd.GetPackage(); pkg != "" {
+		fmt.Fprintf(&b, "\npackage %s;\n", pkg)
+	}
+	if imports := descriptorImports(dsc); len(imports) > 0 {
+		b.WriteString("\n")
+		for _, imp := range imports {
+			fmt.Fprintf(&b, "import %q;\n", imp)
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(txt)
+	return b.String(), nil
+}
+
+// descriptorImports returns the sorted names of the files that define the
+// types referenced by the given element, and the custom options it uses,
+// including those of any nested elements. The element's own file is not
+// included.
+func descriptorImports(dsc desc.Descriptor) []string {
+	files := map[string]struct{}{}
+	var visit func(d desc.Descriptor)
+	visit = func(d desc.Descriptor) {
+		addOptionImports(d, files)
+		switch d := d.(type) {
+		case *desc.MessageDescriptor:
+			for _, fld := range d.GetFields() {
+				visit(fld)
+			}
+			for _, ood := range d.GetOneOfs() {
+				addOptionImports(ood, files)
+			}
+			for _, nested := range d.GetNestedMessageTypes() {
+				visit(nested)
+			}
+			for _, nested := range d.GetNestedEnumTypes() {
+				visit(nested)
+			}
+			for _, ext := range d.GetNestedExtensions() {
+				visit(ext)
+			}
+		case *desc.FieldDescriptor:
+			if md := d.GetMessageType(); md != nil {
+				files[md.GetFile().GetName()] = struct{}{}
+				if md.IsMapEntry() {
+					// map fields are printed using their key and value types
+					visit(md)
+				}
+			}
+			if ed := d.GetEnumType(); ed != nil {
+				files[ed.GetFile().GetName()] = struct{}{}
+			}
+			if d.IsExtension() {
+				files[d.GetOwner().GetFile().GetName()] = struct{}{}
+			}
+		case *desc.OneOfDescriptor:
+			for _, fld := range d.GetChoices() {
+				visit(fld)
+			}
+		case *desc.EnumDescriptor:
+			for _, val := range d.GetValues() {
+				visit(val)
+			}
+		case *desc.ServiceDescriptor:
+			for _, mtd := range d.GetMethods() {
+				visit(mtd)
+			}
+		case *desc.MethodDescriptor:
+			files[d.GetInputType().GetFile().GetName()] = struct{}{}
+			files[d.GetOutputType().GetFile().GetName()] = struct{}{}
+		}
+	}
+	visit(dsc)
+	delete(files, dsc.GetFile().GetName())
+
+	imports := make([]string, 0, len(files))
+	for name := range files {
+		imports = append(imports, name)
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// addOptionImports adds to the given set the files that define the custom
+// options used by the given element. Custom options are usually unknown
+// fields, unless the program that loaded the descriptors was linked with the
+// options' generated code, so those are resolved using the extensions visible
+// to the element's file.
+func addOptionImports(dsc desc.Descriptor, files map[string]struct{}) {
+	opts := dsc.GetOptions()
+	if opts == nil {
+		return
+	}
+	ref := proto.MessageReflect(opts)
+	if !ref.IsValid() {
+		return
+	}
+	ref.Range(func(fld protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if fld.IsExtension() {
+			files[fld.ParentFile().Path()] = struct{}{}
+		}
+		return true
+	})
+	unknown := ref.GetUnknown()
+	for len(unknown) > 0 {
+		num, _, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			return
+		}
+		unknown = unknown[n:]
+		if ext := findVisibleExtension(dsc.GetFile(), ref.Descriptor().FullName(), num, map[string]bool{}); ext != nil {
+			files[ext.GetFile().GetName()] = struct{}{}
+		}
+	}
+}
+
+// withSourceExtensions returns the given descriptor or, if it uses custom
+// options whose extensions are not visible to its file, an equivalent
+// descriptor from a copy of its file that also imports the files, known to
+// the given source, that define them. This is the case when the options are
+// defined in files that the server does not link with the file, or that are
+// in a different descriptor source. Without those extensions, the options
+// are unknown fields, which the printer omits.
+func withSourceExtensions(dsc desc.Descriptor, source DescriptorSource) desc.Descriptor {
+	if source == nil {
+		return dsc
+	}
+	fd := dsc.GetFile()
+	// the field numbers of the unresolved options, by the options' type
+	unresolved := map[string]map[int32]bool{}
+	visitDescriptors(dsc, func(d desc.Descriptor) {
+		opts := d.GetOptions()
+		if opts == nil {
+			return
+		}
+		ref := proto.MessageReflect(opts)
+		if !ref.IsValid() {
+			return
+		}
+		unknown := ref.GetUnknown()
+		for len(unknown) > 0 {
+			num, _, n := protowire.ConsumeField(unknown)
+			if n < 0 {
+				return
+			}
+			unknown = unknown[n:]
+			extendee := ref.Descriptor().FullName()
+			if findVisibleExtension(fd, extendee, num, map[string]bool{}) == nil {
+				if unresolved[string(extendee)] == nil {
+					unresolved[string(extendee)] = map[int32]bool{}
+				}
+				unresolved[string(extendee)][int32(num)] = true
+			}
+		}
+	})
+	if len(unresolved) == 0 {
+		return dsc
+	}
+
+	fdp := protov2.Clone(fd.AsFileDescriptorProto()).(*descriptorpb.FileDescriptorProto)
+	deps := fd.GetDependencies()
+	imported := map[string]bool{fd.GetName(): true}
+	for _, dep := range deps {
+		imported[dep.GetName()] = true
+	}
+	for extendee, nums := range unresolved {
+		exts, err := source.AllExtensionsForType(extendee)
+		if err != nil {
+			continue
+		}
+		for _, ext := range exts {
+			if extFile := ext.GetFile(); nums[ext.GetNumber()] && !imported[extFile.GetName()] {
+				imported[extFile.GetName()] = true
+				fdp.Dependency = append(fdp.Dependency, extFile.GetName())
+				deps = append(deps, extFile)
+			}
+		}
+	}
+	if len(deps) == len(fd.GetDependencies()) {
+		return dsc
+	}
+	newFd, err := desc.CreateFileDescriptor(fdp, deps...)
+	if err != nil {
+		return dsc
+	}
+	if _, ok := dsc.(*desc.FileDescriptor); ok {
+		return newFd
+	}
+	if d := newFd.FindSymbol(dsc.GetFullyQualifiedName()); d != nil {
+		return d
+	}
+	return dsc
+}
+
+// visitDescriptors calls the given function for the given element and all of
+// its nested elements.
+func visitDescriptors(dsc desc.Descriptor, fn func(desc.Descriptor)) {
+	fn(dsc)
+	switch d := dsc.(type) {
+	case *desc.FileDescriptor:
+		for _, md := range d.GetMessageTypes() {
+			visitDescriptors(md, fn)
+		}
+		for _, ed := range d.GetEnumTypes() {
+			visitDescriptors(ed, fn)
+		}
+		for _, ext := range d.GetExtensions() {
+			fn(ext)
+		}
+		for _, sd := range d.GetServices() {
+			visitDescriptors(sd, fn)
+		}
+	case *desc.MessageDescriptor:
+		for _, fld := range d.GetFields() {
+			fn(fld)
+		}
+		for _, ood := range d.GetOneOfs() {
+			fn(ood)
+		}
+		for _, nested := range d.GetNestedMessageTypes() {
+			visitDescriptors(nested, fn)
+		}
+		for _, nested := range d.GetNestedEnumTypes() {
+			visitDescriptors(nested, fn)
+		}
+		for _, ext := range d.GetNestedExtensions() {
+			fn(ext)
+		}
+	case *desc.EnumDescriptor:
+		for _, val := range d.GetValues() {
+			fn(val)
+		}
+	case *desc.ServiceDescriptor:
+		for _, mtd := range d.GetMethods() {
+			fn(mtd)
+		}
+	}
+}
+
+// findVisibleExtension returns the extension of the given message with the
+// given field number that is defined in the given file or in one of the files
+// it imports (directly or publicly), or nil if there is no such extension.
+func findVisibleExtension(fd *desc.FileDescriptor, extendee protoreflect.FullName, num protowire.Number, seen map[string]bool) *desc.FieldDescriptor {
+	if seen[fd.GetName()] {
+		return nil
+	}
+	seen[fd.GetName()] = true
+	var find func(exts []*desc.FieldDescriptor, msgs []*desc.MessageDescriptor) *desc.FieldDescriptor
+	find = func(exts []*desc.FieldDescriptor, msgs []*desc.MessageDescriptor) *desc.FieldDescriptor {
+		for _, ext := range exts {
+			if ext.GetOwner().GetFullyQualifiedName() == string(extendee) && ext.GetNumber() == int32(num) {
+				return ext
+			}
+		}
+		for _, md := range msgs {
+			if ext := find(md.GetNestedExtensions(), md.GetNestedMessageTypes()); ext != nil {
+				return ext
+			}
+		}
+		return nil
+	}
+	if ext := find(fd.GetExtensions(), fd.GetMessageTypes()); ext != nil {
+		return ext
+	}
+	for _, dep := range fd.GetDependencies() {
+		if ext := findVisibleExtension(dep, extendee, num, seen); ext != nil {
+			return ext
+		}
+	}
+	return nil
+}
+
 // EnsureExtensions uses the given descriptor source to download extensions for
 // the given message. It returns a copy of the given message, but as a dynamic
 // message that knows about all extensions known to the given descriptor source.
@@ -398,12 +707,36 @@ func fullyConvertToDynamic(msgFact *dynamic.MessageFactory, msg proto.Message) (
 // are not empty, so they will render with a single element (to show the types
 // and optionally nested fields). It also ensures that nested messages are not
 // nil by setting them to a message that is also fleshed out as a template
-// message.
+// message. Only one field of each oneof is set: the first one. Earlier
+// versions set the last field of each oneof instead, since setting each field
+// cleared the one set before it, so templates of messages with oneofs have
+// changed.
 func MakeTemplate(md *desc.MessageDescriptor) proto.Message {
-	return makeTemplate(md, nil)
+	return makeTemplate(md, nil, &TemplateOptions{})
+}
+
+// TemplateOptions is a set of options for making templates.
+type TemplateOptions struct {
+	// MaxDepth is the number of levels of nested messages to flesh out,
+	// including the template's own. Message fields that are deeper are not
+	// set, except for a oneof's field, which is set to an empty message to
+	// show which field of the oneof is used. Well-known types, which render
+	// as JSON scalars, arrays, or objects, are always set. If zero, there is
+	// no limit, though recursive message types are never fleshed out more
+	// than once.
+	MaxDepth int
+	// Oneofs names the fields that are set for the oneofs that include them,
+	// instead of their first field. Each is a field's name, or its
+	// fully-qualified name to select a field of a particular message.
+	Oneofs []string
+}
+
+// MakeTemplateWithOptions is like MakeTemplate, but with the given options.
+func MakeTemplateWithOptions(md *desc.MessageDescriptor, opts TemplateOptions) proto.Message {
+	return makeTemplate(md, nil, &opts)
 }
 
-func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) proto.Message {
+func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor, opts *TemplateOptions) proto.Message {
 	switch md.GetFullyQualifiedName() {
 	case "google.protobuf.Any":
 		// empty type URL is not allowed by JSON representation
@@ -457,12 +790,31 @@ func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) pr
 		}
 	}
 	path = append(path, dm.GetMessageDescriptor())
+	// whether nested messages, other than well-known types, are fleshed out
+	nest := func(md *desc.MessageDescriptor) bool {
+		return opts.MaxDepth <= 0 || len(path) < opts.MaxDepth || isWellKnownType(md)
+	}
 
 	// for repeated fields, add a single element with default value
 	// and for message fields, add a message with all default fields
 	// that also has non-nil message and non-empty repeated fields
 
 	for _, fd := range dm.GetMessageDescriptor().GetFields() {
+		if ood := fd.GetOneOf(); ood != nil && !ood.IsSynthetic() && fd != templateOneofChoice(ood, opts.Oneofs) {
+			continue
+		}
+		if fd.IsMap() {
+			// add a single entry, whose value is fleshed out like a field's
+			entry := dynamic.NewMessage(fd.GetMessageType())
+			if val := fd.GetMapValueType(); val.GetMessageType() != nil {
+				if !nest(val.GetMessageType()) {
+					continue
+				}
+				entry.SetField(val, makeTemplate(val.GetMessageType(), path, opts))
+			}
+			dm.AddRepeatedField(fd, entry)
+			continue
+		}
 		if fd.IsRepeated() {
 			switch fd.GetType() {
 			case descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
@@ -501,15 +853,56 @@ func makeTemplate(md *desc.MessageDescriptor, path []*desc.MessageDescriptor) pr
 
 			case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
 				descriptorpb.FieldDescriptorProto_TYPE_GROUP:
-				dm.AddRepeatedField(fd, makeTemplate(fd.GetMessageType(), path))
+				if nest(fd.GetMessageType()) {
+					dm.AddRepeatedField(fd, makeTemplate(fd.GetMessageType(), path, opts))
+				}
 			}
 		} else if fd.GetMessageType() != nil {
-			dm.SetField(fd, makeTemplate(fd.GetMessageType(), path))
+			if nest(fd.GetMessageType()) {
+				dm.SetField(fd, makeTemplate(fd.GetMessageType(), path, opts))
+			} else if ood := fd.GetOneOf(); ood != nil && !ood.IsSynthetic() {
+				// still show which field of the oneof is set
+				dm.SetField(fd, dynamic.NewMessage(fd.GetMessageType()))
+			}
+		} else if fd.GetOneOf() != nil && !fd.GetOneOf().IsSynthetic() {
+			// set the chosen scalar field, so that the template shows it
+			dm.SetField(fd, fd.GetDefaultValue())
 		}
 	}
 	return dm
 }
 
+// templateOneofChoice returns the field of the given oneof that is set in a
+// template: the first one that is named by the given choices, or else the
+// oneof's first field.
+func templateOneofChoice(ood *desc.OneOfDescriptor, choices []string) *desc.FieldDescriptor {
+	for _, choice := range choices {
+		for _, fd := range ood.GetChoices() {
+			if choice == fd.GetName() || strings.TrimPrefix(choice, ".") == fd.GetFullyQualifiedName() {
+				return fd
+			}
+		}
+	}
+	return ood.GetChoices()[0]
+}
+
+// isWellKnownType reports whether the given message is one of the well-known
+// types that render as a JSON scalar, array, or object of arbitrary fields.
+func isWellKnownType(md *desc.MessageDescriptor) bool {
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Any", "google.protobuf.Value", "google.protobuf.ListValue",
+		"google.protobuf.Struct", "google.protobuf.Timestamp", "google.protobuf.Duration",
+		"google.protobuf.FieldMask", "google.protobuf.Empty",
+		"google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		return true
+	}
+	return false
+}
+
 // ClientTransportCredentials is a helper function that constructs a TLS config with
 // the given properties (see ClientTLSConfig) and then constructs and returns gRPC
 // transport credentials using that config.
@@ -7,14 +7,18 @@ import (
 	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/golang/protobuf/jsonpb"  //lint:ignore SA1019 we have to import these because some of their types appear in exported API
-	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
+	"github.com/golang/protobuf/jsonpb"             //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/golang/protobuf/proto"              //lint:ignore SA1019 same as above
+	"github.com/jhump/protoreflect/desc"            //lint:ignore SA1019 same as above
+	"github.com/jhump/protoreflect/desc/protoparse" //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -22,6 +26,11 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
 
 	. "github.com/fullstorydev/grpcurl"
 	grpcurl_testing "github.com/fullstorydev/grpcurl/internal/testing"
@@ -383,6 +392,101 @@ func TestMakeTemplateKnownTypes(t *testing.T) {
 	}
 }
 
+func TestMakeTemplateWithOptions(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"tmpl.proto": `syntax = "proto3";
+package tmpl;
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/duration.proto";
+import "google/protobuf/struct.proto";
+message Leaf { int32 n = 1; }
+message Branch { Leaf leaf = 1; }
+message Payment {
+  oneof method {
+    string card = 1;
+    Branch bank = 2;
+  }
+  map<string, Branch> branches = 3;
+  repeated Branch list = 4;
+  Branch branch = 5;
+  google.protobuf.Timestamp at = 6;
+  google.protobuf.Duration ttl = 7;
+  google.protobuf.Struct meta = 8;
+}`,
+		}),
+	}
+	fds, err := p.ParseFiles("tmpl.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	md := fds[0].FindMessage("tmpl.Payment")
+
+	testCases := []struct {
+		name     string
+		opts     TemplateOptions
+		expected string
+	}{
+		{
+			name: "default",
+			expected: `{
+  "card": "",
+  "branches": {"": {"leaf": {"n": 0}}},
+  "list": [{"leaf": {"n": 0}}],
+  "branch": {"leaf": {"n": 0}},
+  "at": "1970-01-01T00:00:00Z",
+  "ttl": "0s",
+  "meta": {"google.protobuf.Struct": "supports arbitrary JSON objects"}
+}`,
+		},
+		{
+			name: "depth and oneof",
+			opts: TemplateOptions{MaxDepth: 2, Oneofs: []string{"tmpl.Payment.bank"}},
+			expected: `{
+  "bank": {"leaf": null},
+  "branches": {"": {"leaf": null}},
+  "list": [{"leaf": null}],
+  "branch": {"leaf": null},
+  "at": "1970-01-01T00:00:00Z",
+  "ttl": "0s",
+  "meta": {"google.protobuf.Struct": "supports arbitrary JSON objects"}
+}`,
+		},
+		{
+			name: "top level only",
+			opts: TemplateOptions{MaxDepth: 1, Oneofs: []string{"bank"}},
+			expected: `{
+  "bank": {"leaf": null},
+  "branches": {},
+  "list": [],
+  "branch": null,
+  "at": "1970-01-01T00:00:00Z",
+  "ttl": "0s",
+  "meta": {"google.protobuf.Struct": "supports arbitrary JSON objects"}
+}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jsm := jsonpb.Marshaler{EmitDefaults: true}
+			out, err := jsm.MarshalToString(MakeTemplateWithOptions(md, tc.opts))
+			if err != nil {
+				t.Fatalf("failed to marshal to JSON: %v", err)
+			}
+			var actual, expected interface{}
+			if err := json.Unmarshal([]byte(out), &actual); err != nil {
+				t.Fatalf("failed to parse actual JSON: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+				t.Fatalf("failed to parse expected JSON: %v", err)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("template message is not as expected; want:\n%s\ngot:\n%s", tc.expected, out)
+			}
+		})
+	}
+}
+
 func TestDescribe(t *testing.T) {
 	for _, ds := range descSources {
 		t.Run(ds.name, func(t *testing.T) {
@@ -440,6 +544,163 @@ field: <
 	}
 }
 
+func TestGetStandaloneDescriptorText(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"opts.proto": `syntax = "proto3";
+package opts;
+import "google/protobuf/descriptor.proto";
+extend google.protobuf.MessageOptions { string label = 50001; }
+extend google.protobuf.FieldOptions { bool sensitive = 50002; }`,
+			"types.proto": `syntax = "proto3";
+package types;
+message Money { int64 units = 1; }
+enum Color { RED = 0; }`,
+			"unused.proto": `syntax = "proto3";
+package unused;
+message Unused {}`,
+			"main.proto": `syntax = "proto3";
+package main.v1;
+import "opts.proto";
+import "types.proto";
+import "unused.proto";
+import "google/protobuf/timestamp.proto";
+message Order {
+  option (opts.label) = "order";
+  types.Money price = 1;
+  string card = 2 [(opts.sensitive) = true];
+  map<string, google.protobuf.Timestamp> events = 3;
+}
+message Paint { types.Color color = 1; }`,
+		}),
+		IncludeSourceCodeInfo: true,
+	}
+	fds, err := p.ParseFiles("main.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	// also check descriptors whose custom options are unknown fields, like
+	// those downloaded from a server via reflection
+	fdps := desc.ToFileDescriptorSet(fds...)
+	b, err := proto.Marshal(fdps)
+	if err != nil {
+		t.Fatalf("failed to marshal descriptors: %v", err)
+	}
+	var unresolved descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &unresolved); err != nil {
+		t.Fatalf("failed to unmarshal descriptors: %v", err)
+	}
+	fromBytes, err := desc.CreateFileDescriptorFromSet(&unresolved)
+	if err != nil {
+		t.Fatalf("failed to create descriptors: %v", err)
+	}
+
+	for name, fd := range map[string]*desc.FileDescriptor{"parsed": fds[0], "unresolved": fromBytes} {
+		t.Run(name, func(t *testing.T) {
+			txt, err := GetStandaloneDescriptorText(fd.FindMessage("main.v1.Order"), nil)
+			if err != nil {
+				t.Fatalf("failed to get descriptor text: %v", err)
+			}
+			expectedPrefix := `syntax = "proto3";
+
+package main.v1;
+
+import "google/protobuf/timestamp.proto";
+import "opts.proto";
+import "types.proto";
+
+message Order {
+  option (.opts.label) = "order";
+`
+			if !strings.HasPrefix(txt, expectedPrefix) {
+				t.Errorf("expected text to start with:\n%s\ngot:\n%s", expectedPrefix, txt)
+			}
+			if !strings.Contains(txt, "(.opts.sensitive) = true") {
+				t.Errorf("expected field option to be resolved, got:\n%s", txt)
+			}
+
+			txt, err = GetStandaloneDescriptorText(fd.FindMessage("main.v1.Paint"), nil)
+			if err != nil {
+				t.Fatalf("failed to get descriptor text: %v", err)
+			}
+			if !strings.HasPrefix(txt, "syntax = \"proto3\";\n\npackage main.v1;\n\nimport \"types.proto\";\n\nmessage Paint {") {
+				t.Errorf("expected only the import for the enum, got:\n%s", txt)
+			}
+		})
+	}
+}
+
+func TestGetDescriptorTextResolvesOptionsFromSource(t *testing.T) {
+	p := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"opts.proto": `syntax = "proto3";
+package opts;
+import "google/protobuf/descriptor.proto";
+message Rule { string role = 1; repeated string scopes = 2; }
+extend google.protobuf.MethodOptions { Rule auth = 50001; }`,
+			"main.proto": `syntax = "proto3";
+package main.v1;
+import "opts.proto";
+import "google/protobuf/empty.proto";
+service Admin {
+  rpc Reset(google.protobuf.Empty) returns (google.protobuf.Empty) {
+    option (opts.auth) = { role: "admin", scopes: ["reset"] };
+  }
+}`,
+		}),
+	}
+	fds, err := p.ParseFiles("main.proto")
+	if err != nil {
+		t.Fatalf("failed to parse protos: %v", err)
+	}
+	// make the options unknown fields, and drop the import of the file that
+	// defines them, so that the file does not link them
+	b, err := proto.Marshal(desc.ToFileDescriptorSet(fds...))
+	if err != nil {
+		t.Fatalf("failed to marshal descriptors: %v", err)
+	}
+	var fdps descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &fdps); err != nil {
+		t.Fatalf("failed to unmarshal descriptors: %v", err)
+	}
+	for _, fdp := range fdps.File {
+		if fdp.GetName() == "main.proto" {
+			fdp.Dependency = []string{"google/protobuf/empty.proto"}
+		}
+	}
+	source, err := DescriptorSourceFromFileDescriptorSet(&fdps)
+	if err != nil {
+		t.Fatalf("failed to create descriptor source: %v", err)
+	}
+	dsc, err := source.FindSymbol("main.v1.Admin")
+	if err != nil {
+		t.Fatalf("failed to find service: %v", err)
+	}
+
+	const option = `option (.opts.auth) = { role: "admin", scopes: [ "reset" ] };`
+	txt, err := GetDescriptorText(dsc, nil)
+	if err != nil {
+		t.Fatalf("failed to get descriptor text: %v", err)
+	}
+	if strings.Contains(txt, "opts.auth") {
+		t.Errorf("expected option to be unresolved without a source, got:\n%s", txt)
+	}
+	txt, err = GetDescriptorText(dsc, source)
+	if err != nil {
+		t.Fatalf("failed to get descriptor text: %v", err)
+	}
+	if !strings.Contains(txt, option) {
+		t.Errorf("expected text to contain %s, got:\n%s", option, txt)
+	}
+	txt, err = GetStandaloneDescriptorText(dsc, source)
+	if err != nil {
+		t.Fatalf("failed to get descriptor text: %v", err)
+	}
+	if !strings.Contains(txt, `import "opts.proto";`) || !strings.Contains(txt, option) {
+		t.Errorf("expected text to import and use the option, got:\n%s", txt)
+	}
+}
+
 const (
 	// type == COMPRESSABLE, but that is default (since it has
 	// numeric value == 0) and thus doesn't actually get included
@@ -727,6 +988,424 @@ func doTestFullDuplexStream(t *testing.T, cc *grpc.ClientConn, source Descriptor
 	h.check(t, "testing.TestService.FullDuplexCall", codes.ResourceExhausted, 3, 6)
 }
 
+// countingChannel is a channel that is not a *grpc.ClientConn, which counts
+// the RPCs that are made via it.
+type countingChannel struct {
+	grpc.ClientConnInterface
+	count int32
+}
+
+func (ch *countingChannel) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	atomic.AddInt32(&ch.count, 1)
+	return ch.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (ch *countingChannel) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	atomic.AddInt32(&ch.count, 1)
+	return ch.ClientConnInterface.NewStream(ctx, desc, method, opts...)
+}
+
+func TestInvokeRPCWithChannel(t *testing.T) {
+	ch := &countingChannel{ClientConnInterface: ccNoReflect}
+	h := &handler{reqMessages: []string{payload1}}
+	err := InvokeRPC(context.Background(), sourceProtoset, ch, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, h.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	h.check(t, "testing.TestService.UnaryCall", codes.OK, 1, 1)
+
+	h = &handler{reqMessages: []string{payload1, payload2}}
+	err = InvokeRPC(context.Background(), sourceProtoset, ch, "testing.TestService/StreamingInputCall", makeHeaders(codes.OK), h, h.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	h.check(t, "testing.TestService.StreamingInputCall", codes.OK, 2, 1)
+
+	if count := atomic.LoadInt32(&ch.count); count != 2 {
+		t.Errorf("expected 2 RPCs via channel, got %d", count)
+	}
+}
+
+func TestInvokeInProcess(t *testing.T) {
+	svr := grpc.NewServer()
+	grpcurl_testing.RegisterTestServiceServer(svr, grpcurl_testing.TestServer{})
+	defer svr.Stop()
+
+	// the server can be used for more than one call
+	for i := 0; i < 2; i++ {
+		h := &handler{reqMessages: []string{payload1}}
+		err := InvokeInProcess(context.Background(), sourceProtoset, svr, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, h.supplyRequest)
+		if err != nil {
+			t.Fatalf("unexpected error during RPC: %v", err)
+		}
+		if h.check(t, "testing.TestService.UnaryCall", codes.OK, 1, 1) {
+			if h.respMessages[0] != payload1 {
+				t.Errorf("unexpected response from RPC: expecting %s; got %s", payload1, h.respMessages[0])
+			}
+		}
+	}
+
+	h := &handler{reqMessages: []string{payload1, payload2}}
+	err := InvokeInProcess(context.Background(), sourceProtoset, svr, "testing.TestService/StreamingInputCall", makeHeaders(codes.NotFound), h, h.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	h.check(t, "testing.TestService.StreamingInputCall", codes.NotFound, -2, 0)
+}
+
+func TestInvokeRPCV2Editions(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "editions.proto"), []byte(`
+		edition = "2023";
+		package editions;
+		message Msg {
+			string name = 1;
+			int32 count = 2 [features.field_presence = IMPLICIT];
+			extensions 100 to 200;
+		}
+		extend Msg {
+			string tag = 100;
+		}
+		service Echo {
+			rpc Echo(Msg) returns (Msg);
+			rpc EchoStream(stream Msg) returns (stream Msg);
+		}
+		`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := DescriptorSourceFromProtoFiles([]string{dir}, "editions.proto")
+	if err != nil {
+		t.Fatalf("failed to parse proto: %v", err)
+	}
+	v2 := DescriptorSourceV2From(source)
+	d, err := v2.FindDescriptorByName("editions.Msg")
+	if err != nil {
+		t.Fatalf("failed to find message: %v", err)
+	}
+	md := d.(protoreflect.MessageDescriptor)
+
+	// the server echoes each request, whose extension it does not know
+	svr := grpc.NewServer(grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		for {
+			msg := dynamicpb.NewMessage(md)
+			if err := stream.RecvMsg(msg); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go svr.Serve(l)
+	defer svr.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	const req = `{"name":"foo","count":2,"[editions.tag]":"bar"}`
+	for method, in := range map[string]string{"editions.Echo/Echo": req, "editions.Echo/EchoStream": req + req} {
+		rf, formatter, err := RequestParserAndFormatter(FormatJSON, source, strings.NewReader(in), FormatOptions{CompactJSON: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &handlerV2{formatter: formatter}
+		if err := InvokeRPCV2(context.Background(), v2, cc, method, nil, h, rf.Next); err != nil {
+			t.Fatalf("%s: unexpected error during RPC: %v", method, err)
+		}
+		if h.method == nil || h.method.FullName() != protoreflect.FullName(strings.Replace(method, "/", ".", 1)) {
+			t.Errorf("%s: unexpected method: %v", method, h.method)
+		}
+		if h.status.Code() != codes.OK {
+			t.Errorf("%s: unexpected status: %v", method, h.status)
+		}
+		if len(h.responses) != rf.NumRequests() {
+			t.Fatalf("%s: expected %d responses, got %d", method, rf.NumRequests(), len(h.responses))
+		}
+		for _, resp := range h.responses {
+			if resp != req {
+				t.Errorf("%s: expected response %s, got %s", method, req, resp)
+			}
+		}
+	}
+
+	// the methods of files with editions can also be invoked with the desc
+	// package's API
+	rf, formatter, err := RequestParserAndFormatter(FormatJSON, source, strings.NewReader(req), FormatOptions{CompactJSON: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	h := NewDefaultEventHandler(&out, source, formatter, false)
+	if err := InvokeRPC(context.Background(), source, cc, "editions.Echo/Echo", nil, h, rf.Next); err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	if h.Status.Code() != codes.OK {
+		t.Errorf("unexpected status: %v", h.Status)
+	}
+	if out.String() != req+"\n" {
+		t.Errorf("expected output %s, got %s", req, out.String())
+	}
+}
+
+// handlerV2 is an InvocationEventHandlerV2 that keeps the method, the
+// formatted responses, and the status of a call.
+type handlerV2 struct {
+	formatter Formatter
+	method    protoreflect.MethodDescriptor
+	responses []string
+	status    *status.Status
+}
+
+func (h *handlerV2) OnResolveMethod(md protoreflect.MethodDescriptor) {
+	h.method = md
+}
+
+func (h *handlerV2) OnSendHeaders(metadata.MD) {}
+
+func (h *handlerV2) OnReceiveHeaders(metadata.MD) {}
+
+func (h *handlerV2) OnReceiveResponse(resp protov2.Message) {
+	str, err := h.formatter(protoadapt.MessageV1Of(resp))
+	if err != nil {
+		str = err.Error()
+	}
+	h.responses = append(h.responses, str)
+}
+
+func (h *handlerV2) OnReceiveTrailers(stat *status.Status, _ metadata.MD) {
+	h.status = stat
+}
+
+func TestChannelRequestSupplier(t *testing.T) {
+	ch := make(chan proto.Message)
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 3; i++ {
+			ch <- &grpcurl_testing.StreamingInputCallRequest{Payload: &grpcurl_testing.Payload{Body: make([]byte, i*10)}}
+		}
+	}()
+	h := &handler{}
+	err := InvokeRPC(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/StreamingInputCall", makeHeaders(codes.OK), h, ChannelRequestSupplier(ch))
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	if h.respStatus.Code() != codes.OK {
+		t.Errorf("wrong code: expecting %v, got %v", codes.OK, h.respStatus.Code())
+	} else if len(h.respMessages) != 1 {
+		t.Errorf("wrong number of messages received: expecting 1, got %v", len(h.respMessages))
+	} else {
+		var resp grpcurl_testing.StreamingInputCallResponse
+		if err := jsonpb.UnmarshalString(h.respMessages[0], &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.AggregatedPayloadSize != 60 {
+			t.Errorf("expected aggregated payload size 60, got %d", resp.AggregatedPayloadSize)
+		}
+	}
+
+	// a message of the wrong type
+	ch = make(chan proto.Message, 1)
+	ch <- &grpcurl_testing.SimpleRequest{}
+	close(ch)
+	h = &handler{}
+	err = InvokeRPC(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/StreamingInputCall", makeHeaders(codes.OK), h, ChannelRequestSupplier(ch))
+	if err == nil || !strings.Contains(err.Error(), "testing.SimpleRequest") {
+		t.Errorf("expected error about request type, got %v", err)
+	}
+}
+
+func TestChannelRequestSupplierContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan proto.Message, 1)
+	supplier := ChannelRequestSupplierContext(ctx, ch)
+	var req grpcurl_testing.SimpleRequest
+
+	ch <- &grpcurl_testing.SimpleRequest{ResponseSize: 10}
+	if err := supplier(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ResponseSize != 10 {
+		t.Errorf("expected response size 10, got %d", req.ResponseSize)
+	}
+	ch <- nil
+	if err := supplier(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ResponseSize != 0 {
+		t.Error("a nil message should be supplied as an empty request")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := supplier(&req); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	close(ch)
+	if err := supplier(&req); err != io.EOF {
+		t.Errorf("expected io.EOF for closed channel, got %v", err)
+	}
+}
+
+// streamHandler records the events of an RPC.
+type streamHandler struct {
+	mu     sync.Mutex
+	events []string
+	sent   []MessageEvent
+	recv   []MessageEvent
+	status *status.Status
+}
+
+func (h *streamHandler) record(event string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *streamHandler) OnResolveMethod(*desc.MethodDescriptor) { h.record("resolve") }
+
+func (h *streamHandler) OnSendHeaders(metadata.MD) { h.record("send-headers") }
+
+func (h *streamHandler) OnSendMessage(ev MessageEvent) {
+	h.record("send")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ev.Message = proto.Clone(ev.Message)
+	h.sent = append(h.sent, ev)
+}
+
+func (h *streamHandler) OnHeaders(metadata.MD) { h.record("headers") }
+
+func (h *streamHandler) OnReceiveMessage(ev MessageEvent) {
+	h.record("receive")
+	h.recv = append(h.recv, ev)
+}
+
+func (h *streamHandler) OnTrailers(metadata.MD) { h.record("trailers") }
+
+func (h *streamHandler) OnClose(stat *status.Status) {
+	h.record("close")
+	h.status = stat
+}
+
+func checkMessageEvents(t *testing.T, kind string, events []MessageEvent, expected int) {
+	t.Helper()
+	if len(events) != expected {
+		t.Errorf("expected %d %s messages, got %d", expected, kind, len(events))
+		return
+	}
+	for i, ev := range events {
+		if ev.Index != i {
+			t.Errorf("%s message %d has index %d", kind, i, ev.Index)
+		}
+		if ev.Size != proto.Size(ev.Message) || ev.Size == 0 {
+			t.Errorf("%s message %d has wrong size %d", kind, i, ev.Size)
+		}
+		if i > 0 && ev.Time.Before(events[i-1].Time) {
+			t.Errorf("%s message %d has time before that of the previous message", kind, i)
+		}
+	}
+}
+
+func TestInvokeRPCWithStreamHandler(t *testing.T) {
+	// Unary
+	h := &streamHandler{}
+	reqs := &handler{reqMessages: []string{payload1}}
+	err := InvokeRPCWithStreamHandler(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/UnaryCall", makeHeaders(codes.OK), h, reqs.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	expected := []string{"resolve", "send-headers", "send", "headers", "receive", "trailers", "close"}
+	if !reflect.DeepEqual(h.events, expected) {
+		t.Errorf("wrong events: expected %v, got %v", expected, h.events)
+	}
+	checkMessageEvents(t, "sent", h.sent, 1)
+	checkMessageEvents(t, "received", h.recv, 1)
+	if h.status.Code() != codes.OK {
+		t.Errorf("expected status OK, got %v", h.status.Code())
+	}
+
+	// Client stream that fails
+	h = &streamHandler{}
+	reqs = &handler{reqMessages: []string{payload1, payload2, payload3}}
+	err = InvokeRPCWithStreamHandler(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/StreamingInputCall", makeHeaders(codes.NotFound, true), h, reqs.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	checkMessageEvents(t, "sent", h.sent, 3)
+	checkMessageEvents(t, "received", h.recv, 0)
+	if h.status.Code() != codes.NotFound {
+		t.Errorf("expected status NotFound, got %v", h.status.Code())
+	}
+
+	// Bidi stream
+	h = &streamHandler{}
+	req := &grpcurl_testing.StreamingOutputCallRequest{}
+	var payloads []string
+	for i := 0; i < 3; i++ {
+		req.ResponseParameters = append(req.ResponseParameters, &grpcurl_testing.ResponseParameters{Size: int32((i + 1) * 10)})
+		payload, err := (&jsonpb.Marshaler{}).MarshalToString(req)
+		if err != nil {
+			t.Fatalf("failed to construct request %d: %v", i, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	reqs = &handler{reqMessages: payloads}
+	err = InvokeRPCWithStreamHandler(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/FullDuplexCall", makeHeaders(codes.OK), h, reqs.supplyRequest)
+	if err != nil {
+		t.Fatalf("unexpected error during RPC: %v", err)
+	}
+	checkMessageEvents(t, "sent", h.sent, 3)
+	checkMessageEvents(t, "received", h.recv, 6)
+	if last := h.events[len(h.events)-1]; last != "close" {
+		t.Errorf("expected last event to be close, got %s", last)
+	}
+
+	// The method cannot be resolved
+	h = &streamHandler{}
+	reqs = &handler{}
+	err = InvokeRPCWithStreamHandler(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/NoSuchMethod", nil, h, reqs.supplyRequest)
+	if err == nil {
+		t.Fatal("expected error for unknown method")
+	}
+	if expected := []string{"close"}; !reflect.DeepEqual(h.events, expected) {
+		t.Errorf("wrong events: expected %v, got %v", expected, h.events)
+	}
+	if h.status.Code() != codes.Unknown || h.status.Message() != err.Error() {
+		t.Errorf("unexpected status: %v", h.status)
+	}
+}
+
+func TestDefaultEventHandlerAsStreamEventHandler(t *testing.T) {
+	formatter := NewJSONFormatter(false, nil)
+	var viaInvocation, viaStream strings.Builder
+	h1 := &DefaultEventHandler{Out: &viaInvocation, Formatter: formatter, VerbosityLevel: 1}
+	reqs := &handler{reqMessages: []string{payload1}}
+	if err := InvokeRPC(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/UnaryCall", makeHeaders(codes.NotFound), h1, reqs.supplyRequest); err != nil {
+		t.Fatal(err)
+	}
+	h2 := &DefaultEventHandler{Out: &viaStream, Formatter: formatter, VerbosityLevel: 1}
+	reqs = &handler{reqMessages: []string{payload1}}
+	if err := InvokeRPCWithStreamHandler(context.Background(), sourceProtoset, ccNoReflect, "testing.TestService/UnaryCall", makeHeaders(codes.NotFound), h2, reqs.supplyRequest); err != nil {
+		t.Fatal(err)
+	}
+	if viaInvocation.String() != viaStream.String() {
+		t.Errorf("output differs:\n%s\nvs.\n%s", viaInvocation.String(), viaStream.String())
+	}
+	if h1.Status.Code() != codes.NotFound || h2.Status.Code() != codes.NotFound {
+		t.Errorf("unexpected status: %v, %v", h1.Status, h2.Status)
+	}
+}
+
 type handler struct {
 	method            *desc.MethodDescriptor
 	methodCount       int
@@ -757,6 +1436,15 @@ func (h *handler) getRequestData() ([]byte, error) {
 	return []byte(h.reqMessages[h.reqMessagesCount-1]), nil
 }
 
+// supplyRequest is a RequestSupplier, for use with InvokeRPC.
+func (h *handler) supplyRequest(m proto.Message) error {
+	data, err := h.getRequestData()
+	if err != nil {
+		return err
+	}
+	return jsonpb.UnmarshalString(string(data), m)
+}
+
 func (h *handler) OnResolveMethod(md *desc.MethodDescriptor) {
 	h.methodCount++
 	h.method = md
@@ -5,20 +5,25 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"strings"
 	"sync"
 	"sync/atomic"
 
-	"github.com/golang/protobuf/jsonpb"     //lint:ignore SA1019 we have to import these because some of their types appear in exported API
-	"github.com/golang/protobuf/proto"      //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/desc"    //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/dynamic" //lint:ignore SA1019 same as above
-	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"github.com/golang/protobuf/jsonpb"  //lint:ignore SA1019 we have to import these because some of their types appear in exported API
+	"github.com/golang/protobuf/proto"   //lint:ignore SA1019 same as above
+	"github.com/jhump/protoreflect/desc" //lint:ignore SA1019 same as above
 	"github.com/jhump/protoreflect/grpcreflect"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 // InvocationEventHandler is a bag of callbacks for handling events that occur in the course
@@ -70,11 +75,67 @@ func InvokeRpc(ctx context.Context, source DescriptorSource, cc *grpc.ClientConn
 // modify the given message argument.
 type RequestSupplier func(proto.Message) error
 
+// ChannelRequestSupplier returns a RequestSupplier that supplies the messages received from the
+// given channel, so that an application can produce the requests of a client-streaming or
+// bidi-streaming RPC while it is in progress. The supplier blocks until a message is received, and
+// returns io.EOF once the channel is closed. The messages may be of any Go type, such as generated
+// message types, as long as they are of the method's request type. A nil message is sent as an
+// empty request.
+func ChannelRequestSupplier(ch <-chan proto.Message) RequestSupplier {
+	return ChannelRequestSupplierContext(context.Background(), ch)
+}
+
+// ChannelRequestSupplierContext is like ChannelRequestSupplier, except that the supplier stops
+// waiting for a message, and returns the context's error, once the given context is done.
+func ChannelRequestSupplierContext(ctx context.Context, ch <-chan proto.Message) RequestSupplier {
+	return func(m proto.Message) error {
+		// a closed channel takes precedence over a done context, so the
+		// stream is ended normally
+		var msg proto.Message
+		var ok bool
+		select {
+		case msg, ok = <-ch:
+		case <-ctx.Done():
+			select {
+			case msg, ok = <-ch:
+			default:
+				return ctx.Err()
+			}
+		}
+		if !ok {
+			return io.EOF
+		}
+		return copyRequest(m, msg)
+	}
+}
+
+// copyRequest copies the given source message into dst, which may be of a
+// different Go type, such as a dynamic message, for the same message type.
+func copyRequest(dst, src proto.Message) error {
+	if src == nil {
+		dst.Reset()
+		return nil
+	}
+	if srcName, dstName := proto.MessageName(src), proto.MessageName(dst); srcName != dstName {
+		return fmt.Errorf("request message is a %s, but the method's request type is %s", srcName, dstName)
+	}
+	data, err := proto.Marshal(src)
+	if err != nil {
+		return err
+	}
+	dst.Reset()
+	return proto.Unmarshal(data, dst)
+}
+
 // InvokeRPC uses the given gRPC channel to invoke the given method. The given descriptor source
 // is used to determine the type of method and the type of request and response message. The given
 // headers are sent as request metadata. Methods on the given event handler are called as the
 // invocation proceeds.
 //
+// The channel is usually a *grpc.ClientConn, but it may be any implementation of
+// grpc.ClientConnInterface, such as one that wraps a connection or that uses a custom in-process
+// transport. See also InvokeInProcess.
+//
 // The given requestData function supplies the actual data to send. It should return io.EOF when
 // there is no more request data. If the method being invoked is a unary or server-streaming RPC
 // (e.g. exactly one request message) and there is no request data (e.g. the first invocation of
@@ -84,11 +145,12 @@ type RequestSupplier func(proto.Message) error
 // be thread-safe. This is because the requestData function may be called from a different goroutine
 // than the one invoking event callbacks. (This only happens for bi-directional streaming RPCs, where
 // one goroutine sends request messages and another consumes the response messages).
-func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpcdynamic.Channel, methodName string,
+//
+// The request and response messages are dynamicpb messages, as with InvokeRPCV2, which this
+// function is a wrapper around for sources and handlers that use the desc package.
+func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpc.ClientConnInterface, methodName string,
 	headers []string, handler InvocationEventHandler, requestData RequestSupplier) error {
 
-	md := MetadataFromHeaders(headers)
-
 	svc, mth := parseSymbol(methodName)
 	if svc == "" || mth == "" {
 		return fmt.Errorf("given method name %q is not in expected format: 'service/method' or 'service.method'", methodName)
@@ -96,17 +158,7 @@ func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpcdynamic.Chan
 
 	dsc, err := source.FindSymbol(svc)
 	if err != nil {
-		// return a gRPC status error if hasStatus is true
-		errStatus, hasStatus := status.FromError(err)
-		switch {
-		case hasStatus && isNotFoundError(err):
-			return status.Errorf(errStatus.Code(), "target server does not expose service %q: %s", svc, errStatus.Message())
-		case hasStatus:
-			return status.Errorf(errStatus.Code(), "failed to query for service descriptor %q: %s", svc, errStatus.Message())
-		case isNotFoundError(err):
-			return fmt.Errorf("target server does not expose service %q", svc)
-		}
-		return fmt.Errorf("failed to query for service descriptor %q: %v", svc, err)
+		return serviceNotFound(svc, err)
 	}
 	sd, ok := dsc.(*desc.ServiceDescriptor)
 	if !ok {
@@ -119,49 +171,222 @@ func InvokeRPC(ctx context.Context, source DescriptorSource, ch grpcdynamic.Chan
 
 	handler.OnResolveMethod(mtd)
 
+	return invokeMethod(ctx, DescriptorSourceV2From(source), ch, mtd.UnwrapMethod(), headers, v1Events{handler}, requestData)
+}
+
+// InvocationEventHandlerV2 is like InvocationEventHandler, except that it is given a
+// protoreflect.MethodDescriptor for the method that is being invoked, for use with
+// InvokeRPCV2.
+type InvocationEventHandlerV2 interface {
+	// OnResolveMethod is called with a descriptor of the method that is being invoked.
+	OnResolveMethod(protoreflect.MethodDescriptor)
+	// OnSendHeaders is called with the request metadata that is being sent.
+	OnSendHeaders(metadata.MD)
+	// OnReceiveHeaders is called when response headers have been received.
+	OnReceiveHeaders(metadata.MD)
+	// OnReceiveResponse is called for each response message received.
+	OnReceiveResponse(protov2.Message)
+	// OnReceiveTrailers is called when response trailers and final RPC status have been received.
+	OnReceiveTrailers(*status.Status, metadata.MD)
+}
+
+// InvokeRPCV2 is like InvokeRPC, except that it uses a DescriptorSourceV2 and an
+// InvocationEventHandlerV2. The request and response messages are dynamicpb messages, which
+// implement both the proto.Message interface of the google.golang.org/protobuf module and that
+// of the github.com/golang/protobuf module, so the messages given to requestData may be
+// populated with either module's APIs.
+func InvokeRPCV2(ctx context.Context, source DescriptorSourceV2, ch grpc.ClientConnInterface, methodName string,
+	headers []string, handler InvocationEventHandlerV2, requestData RequestSupplier) error {
+
+	svc, mth := parseSymbol(methodName)
+	if svc == "" || mth == "" {
+		return fmt.Errorf("given method name %q is not in expected format: 'service/method' or 'service.method'", methodName)
+	}
+
+	dsc, err := source.FindDescriptorByName(protoreflect.FullName(svc))
+	if err != nil {
+		return serviceNotFound(svc, err)
+	}
+	sd, ok := dsc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("target server does not expose service %q", svc)
+	}
+	mtd := sd.Methods().ByName(protoreflect.Name(mth))
+	if mtd == nil {
+		return fmt.Errorf("service %q does not include a method named %q", svc, mth)
+	}
+
+	handler.OnResolveMethod(mtd)
+
+	return invokeMethod(ctx, source, ch, mtd, headers, handler, requestData)
+}
+
+// serviceNotFound returns the error for a service that could not be found
+// because of the given error.
+func serviceNotFound(svc string, err error) error {
+	// return a gRPC status error if hasStatus is true
+	errStatus, hasStatus := status.FromError(err)
+	switch {
+	case hasStatus && isNotFoundError(err):
+		return status.Errorf(errStatus.Code(), "target server does not expose service %q: %s", svc, errStatus.Message())
+	case hasStatus:
+		return status.Errorf(errStatus.Code(), "failed to query for service descriptor %q: %s", svc, errStatus.Message())
+	case isNotFoundError(err):
+		return fmt.Errorf("target server does not expose service %q", svc)
+	}
+	return fmt.Errorf("failed to query for service descriptor %q: %v", svc, err)
+}
+
+// invocationEvents are the events of an InvocationEventHandlerV2 after the
+// method is resolved.
+type invocationEvents interface {
+	OnSendHeaders(metadata.MD)
+	OnReceiveHeaders(metadata.MD)
+	OnReceiveResponse(protov2.Message)
+	OnReceiveTrailers(*status.Status, metadata.MD)
+}
+
+// v1Events adapts an InvocationEventHandler to invocationEvents.
+type v1Events struct {
+	InvocationEventHandler
+}
+
+func (h v1Events) OnReceiveResponse(resp protov2.Message) {
+	h.InvocationEventHandler.OnReceiveResponse(protoadapt.MessageV1Of(resp))
+}
+
+// invokeMethod invokes the given method, which has been resolved, and sends
+// the remaining events to the given handler.
+func invokeMethod(ctx context.Context, source DescriptorSourceV2, ch grpc.ClientConnInterface, mtd protoreflect.MethodDescriptor,
+	headers []string, handler invocationEvents, requestData RequestSupplier) error {
+
+	md := MetadataFromHeaders(headers)
+
 	// we also download any applicable extensions so we can provide full support for parsing user-provided data
-	var ext dynamic.ExtensionRegistry
-	alreadyFetched := map[string]bool{}
-	if err = fetchAllExtensions(source, &ext, mtd.GetInputType(), alreadyFetched); err != nil {
-		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetInputType().GetFullyQualifiedName(), err)
+	types := newTypeResolver(source)
+	alreadyFetched := map[protoreflect.FullName]bool{}
+	if err := types.addAllExtensions(mtd.Input(), alreadyFetched); err != nil {
+		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.Input().FullName(), err)
 	}
-	if err = fetchAllExtensions(source, &ext, mtd.GetOutputType(), alreadyFetched); err != nil {
-		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.GetOutputType().GetFullyQualifiedName(), err)
+	if err := types.addAllExtensions(mtd.Output(), alreadyFetched); err != nil {
+		return fmt.Errorf("error resolving server extensions for message %s: %v", mtd.Output().FullName(), err)
 	}
 
-	msgFactory := dynamic.NewMessageFactoryWithExtensionRegistry(&ext)
-	req := msgFactory.NewMessage(mtd.GetInputType())
+	req := dynamicpb.NewMessage(mtd.Input())
 
 	handler.OnSendHeaders(md)
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	stub := grpcdynamic.NewStubWithMessageFactory(ch, msgFactory)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	if mtd.IsClientStreaming() && mtd.IsServerStreaming() {
-		return invokeBidi(ctx, stub, mtd, handler, requestData, req)
-	} else if mtd.IsClientStreaming() {
-		return invokeClientStream(ctx, stub, mtd, handler, requestData, req)
-	} else if mtd.IsServerStreaming() {
-		return invokeServerStream(ctx, stub, mtd, handler, requestData, req)
+	inv := &methodInvocation{ch: ch, mtd: mtd, types: types, handler: handler, requestData: requestData}
+	if mtd.IsStreamingClient() && mtd.IsStreamingServer() {
+		return inv.invokeBidi(ctx, req)
+	} else if mtd.IsStreamingClient() {
+		return inv.invokeClientStream(ctx, req)
+	} else if mtd.IsStreamingServer() {
+		return inv.invokeServerStream(ctx, req)
 	} else {
-		return invokeUnary(ctx, stub, mtd, handler, requestData, req)
+		return inv.invokeUnary(ctx, req)
 	}
 }
 
-func invokeUnary(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+// inProcessBufferSize is the size of the buffer of the in-memory connection
+// used by InvokeInProcess.
+const inProcessBufferSize = 1024 * 1024
 
-	err := requestData(req)
+// InvokeInProcess invokes the given method on the given server, without using the network, by
+// serving it via an in-memory connection for the duration of the call. This is useful for tests
+// of servers and of event handlers. The server must not have been stopped, but it need not be
+// serving any other listener. The other arguments are the same as for InvokeRPC.
+func InvokeInProcess(ctx context.Context, source DescriptorSource, server *grpc.Server, methodName string,
+	headers []string, handler InvocationEventHandler, requestData RequestSupplier) error {
+
+	lis := bufconn.Listen(inProcessBufferSize)
+	go func() {
+		// this returns once the listener is closed
+		_ = server.Serve(lis)
+	}()
+	defer lis.Close()
+
+	cc, err := grpc.DialContext(ctx, "passthrough:///in-process",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	return InvokeRPC(ctx, source, cc, methodName, headers, handler, requestData)
+}
+
+// methodInvocation is the invocation of a resolved method.
+type methodInvocation struct {
+	ch          grpc.ClientConnInterface
+	mtd         protoreflect.MethodDescriptor
+	types       *typeResolver
+	handler     invocationEvents
+	requestData RequestSupplier
+}
+
+// path returns the path of the method, which is the name of the RPC on the
+// wire.
+func (inv *methodInvocation) path() string {
+	return fmt.Sprintf("/%s/%s", inv.mtd.Parent().FullName(), inv.mtd.Name())
+}
+
+func (inv *methodInvocation) newStream(ctx context.Context) (grpc.ClientStream, error) {
+	sd := &grpc.StreamDesc{
+		StreamName:    string(inv.mtd.Name()),
+		ClientStreams: inv.mtd.IsStreamingClient(),
+		ServerStreams: inv.mtd.IsStreamingServer(),
+	}
+	return inv.ch.NewStream(ctx, sd, inv.path())
+}
+
+// newResponse returns a new response message.
+func (inv *methodInvocation) newResponse() *dynamicpb.Message {
+	return dynamicpb.NewMessage(inv.mtd.Output())
+}
+
+// recvMsg receives a response message from the given stream.
+func (inv *methodInvocation) recvMsg(str grpc.ClientStream) (*dynamicpb.Message, error) {
+	resp := inv.newResponse()
+	if err := str.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	if err := inv.resolveExtensions(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// resolveExtensions parses the extensions of the given response, which the
+// codec leaves as unknown fields since their types are only known to the
+// descriptor source.
+func (inv *methodInvocation) resolveExtensions(resp *dynamicpb.Message) error {
+	if !inv.types.hasExtensions() {
+		return nil
+	}
+	b, err := protov2.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return protov2.UnmarshalOptions{Resolver: inv.types}.Unmarshal(b, resp)
+}
+
+func (inv *methodInvocation) invokeUnary(ctx context.Context, req proto.Message) error {
+	err := inv.requestData(req)
 	if err != nil && err != io.EOF {
 		return fmt.Errorf("error getting request data: %v", err)
 	}
 	if err != io.EOF {
 		// verify there is no second message, which is a usage error
-		err := requestData(req)
+		err := inv.requestData(req)
 		if err == nil {
-			return fmt.Errorf("method %q is a unary RPC, but request data contained more than 1 message", md.GetFullyQualifiedName())
+			return fmt.Errorf("method %q is a unary RPC, but request data contained more than 1 message", inv.mtd.FullName())
 		} else if err != io.EOF {
 			return fmt.Errorf("error getting request data: %v", err)
 		}
@@ -170,38 +395,60 @@ func invokeUnary(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDesc
 	// Now we can actually invoke the RPC!
 	var respHeaders metadata.MD
 	var respTrailers metadata.MD
-	resp, err := stub.InvokeRpc(ctx, md, req, grpc.Trailer(&respTrailers), grpc.Header(&respHeaders))
+	resp := inv.newResponse()
+	err = inv.ch.Invoke(ctx, inv.path(), req, resp, grpc.Trailer(&respTrailers), grpc.Header(&respHeaders))
+	if err == nil {
+		err = inv.resolveExtensions(resp)
+	}
 
 	stat, ok := status.FromError(err)
 	if !ok {
 		// Error codes sent from the server will get printed differently below.
 		// So just bail for other kinds of errors here.
-		return fmt.Errorf("grpc call for %q failed: %v", md.GetFullyQualifiedName(), err)
+		return fmt.Errorf("grpc call for %q failed: %v", inv.mtd.FullName(), err)
 	}
 
-	handler.OnReceiveHeaders(respHeaders)
+	inv.handler.OnReceiveHeaders(respHeaders)
 
 	if stat.Code() == codes.OK {
-		handler.OnReceiveResponse(resp)
+		inv.handler.OnReceiveResponse(resp)
 	}
 
-	handler.OnReceiveTrailers(stat, respTrailers)
+	inv.handler.OnReceiveTrailers(stat, respTrailers)
 
 	return nil
 }
 
-func invokeClientStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
+// closeAndReceive closes the request stream of a client-streaming RPC and
+// receives its response.
+func (inv *methodInvocation) closeAndReceive(str grpc.ClientStream) (proto.Message, error) {
+	if err := str.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp, err := inv.recvMsg(str)
+	if err != nil {
+		return nil, err
+	}
+	// make sure we get EOF for a second message
+	if err := str.RecvMsg(inv.newResponse()); err != io.EOF {
+		if err == nil {
+			return nil, fmt.Errorf("client-streaming method %q returned more than one response message", inv.mtd.FullName())
+		}
+		return nil, err
+	}
+	return resp, nil
+}
 
+func (inv *methodInvocation) invokeClientStream(ctx context.Context, req proto.Message) error {
 	// invoke the RPC!
-	str, err := stub.InvokeRpcClientStream(ctx, md)
+	str, err := inv.newStream(ctx)
 
 	// Upload each request message in the stream
 	var resp proto.Message
 	for err == nil {
-		err = requestData(req)
+		err = inv.requestData(req)
 		if err == io.EOF {
-			resp, err = str.CloseAndReceive()
+			resp, err = inv.closeAndReceive(str)
 			break
 		}
 		if err != nil {
@@ -212,7 +459,7 @@ func invokeClientStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.Met
 		if err == io.EOF {
 			// We get EOF on send if the server says "go away"
 			// We have to use CloseAndReceive to get the actual code
-			resp, err = str.CloseAndReceive()
+			resp, err = inv.closeAndReceive(str)
 			break
 		}
 
@@ -224,87 +471,91 @@ func invokeClientStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.Met
 	if !ok {
 		// Error codes sent from the server will get printed differently below.
 		// So just bail for other kinds of errors here.
-		return fmt.Errorf("grpc call for %q failed: %v", md.GetFullyQualifiedName(), err)
+		return fmt.Errorf("grpc call for %q failed: %v", inv.mtd.FullName(), err)
 	}
 
 	if str != nil {
 		if respHeaders, err := str.Header(); err == nil {
-			handler.OnReceiveHeaders(respHeaders)
+			inv.handler.OnReceiveHeaders(respHeaders)
 		}
 	}
 
 	if stat.Code() == codes.OK {
-		handler.OnReceiveResponse(resp)
+		inv.handler.OnReceiveResponse(protoadapt.MessageV2Of(resp))
 	}
 
 	if str != nil {
-		handler.OnReceiveTrailers(stat, str.Trailer())
+		inv.handler.OnReceiveTrailers(stat, str.Trailer())
 	}
 
 	return nil
 }
 
-func invokeServerStream(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
-
-	err := requestData(req)
+func (inv *methodInvocation) invokeServerStream(ctx context.Context, req proto.Message) error {
+	err := inv.requestData(req)
 	if err != nil && err != io.EOF {
 		return fmt.Errorf("error getting request data: %v", err)
 	}
 	if err != io.EOF {
 		// verify there is no second message, which is a usage error
-		err := requestData(req)
+		err := inv.requestData(req)
 		if err == nil {
-			return fmt.Errorf("method %q is a server-streaming RPC, but request data contained more than 1 message", md.GetFullyQualifiedName())
+			return fmt.Errorf("method %q is a server-streaming RPC, but request data contained more than 1 message", inv.mtd.FullName())
 		} else if err != io.EOF {
 			return fmt.Errorf("error getting request data: %v", err)
 		}
 	}
 
 	// Now we can actually invoke the RPC!
-	str, err := stub.InvokeRpcServerStream(ctx, md, req)
+	str, err := inv.newStream(ctx)
+	if err == nil {
+		if err = str.SendMsg(req); err == nil {
+			err = str.CloseSend()
+		}
+		if err != nil {
+			str = nil
+		}
+	}
 
 	if str != nil {
 		if respHeaders, err := str.Header(); err == nil {
-			handler.OnReceiveHeaders(respHeaders)
+			inv.handler.OnReceiveHeaders(respHeaders)
 		}
 	}
 
 	// Download each response message
 	for err == nil {
-		var resp proto.Message
-		resp, err = str.RecvMsg()
+		var resp *dynamicpb.Message
+		resp, err = inv.recvMsg(str)
 		if err != nil {
 			if err == io.EOF {
 				err = nil
 			}
 			break
 		}
-		handler.OnReceiveResponse(resp)
+		inv.handler.OnReceiveResponse(resp)
 	}
 
 	stat, ok := status.FromError(err)
 	if !ok {
 		// Error codes sent from the server will get printed differently below.
 		// So just bail for other kinds of errors here.
-		return fmt.Errorf("grpc call for %q failed: %v", md.GetFullyQualifiedName(), err)
+		return fmt.Errorf("grpc call for %q failed: %v", inv.mtd.FullName(), err)
 	}
 
 	if str != nil {
-		handler.OnReceiveTrailers(stat, str.Trailer())
+		inv.handler.OnReceiveTrailers(stat, str.Trailer())
 	}
 
 	return nil
 }
 
-func invokeBidi(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescriptor, handler InvocationEventHandler,
-	requestData RequestSupplier, req proto.Message) error {
-
+func (inv *methodInvocation) invokeBidi(ctx context.Context, req proto.Message) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// invoke the RPC!
-	str, err := stub.InvokeRpcBidiStream(ctx, md)
+	str, err := inv.newStream(ctx)
 
 	var wg sync.WaitGroup
 	var sendErr atomic.Value
@@ -319,7 +570,7 @@ func invokeBidi(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescr
 			// Concurrently upload each request message in the stream
 			var err error
 			for err == nil {
-				err = requestData(req)
+				err = inv.requestData(req)
 
 				if err == io.EOF {
 					err = str.CloseSend()
@@ -344,21 +595,21 @@ func invokeBidi(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescr
 
 	if str != nil {
 		if respHeaders, err := str.Header(); err == nil {
-			handler.OnReceiveHeaders(respHeaders)
+			inv.handler.OnReceiveHeaders(respHeaders)
 		}
 	}
 
 	// Download each response message
 	for err == nil {
-		var resp proto.Message
-		resp, err = str.RecvMsg()
+		var resp *dynamicpb.Message
+		resp, err = inv.recvMsg(str)
 		if err != nil {
 			if err == io.EOF {
 				err = nil
 			}
 			break
 		}
-		handler.OnReceiveResponse(resp)
+		inv.handler.OnReceiveResponse(resp)
 	}
 
 	if se, ok := sendErr.Load().(error); ok && se != io.EOF {
@@ -369,11 +620,11 @@ func invokeBidi(ctx context.Context, stub grpcdynamic.Stub, md *desc.MethodDescr
 	if !ok {
 		// Error codes sent from the server will get printed differently below.
 		// So just bail for other kinds of errors here.
-		return fmt.Errorf("grpc call for %q failed: %v", md.GetFullyQualifiedName(), err)
+		return fmt.Errorf("grpc call for %q failed: %v", inv.mtd.FullName(), err)
 	}
 
 	if str != nil {
-		handler.OnReceiveTrailers(stat, str.Trailer())
+		inv.handler.OnReceiveTrailers(stat, str.Trailer())
 	}
 
 	return nil
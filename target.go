@@ -0,0 +1,135 @@
+package grpcurl
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// Target is a target address, parsed by ParseTarget.
+type Target struct {
+	// Address is the address to dial. For a URL, it is in "host:port" form,
+	// with IPv6 literals in brackets. For other targets, it is the target
+	// itself, except that the zone of an IPv6 literal is escaped.
+	Address string
+	// Scheme is the scheme of the target, if it is a URL or has some other
+	// scheme, like "dns" or "xds". It is empty for "host:port" targets and
+	// for local sockets and pipes.
+	Scheme string
+	// Host is the host name or IP address of a URL, or of a bracketed IPv6
+	// literal, without brackets and with an unescaped zone. For other
+	// targets, it is the target itself.
+	Host string
+	// Port is the port of a URL, which defaults to 80 for "http" and 443 for
+	// "https", or of a bracketed IPv6 literal, if given. It is empty for
+	// other targets.
+	Port string
+	// Path is the path of a URL, if any.
+	Path string
+	// UseTLS is true if the target is an "https" URL.
+	UseTLS bool
+	// IsURL is true if the target is an "http" or "https" URL.
+	IsURL bool
+}
+
+// targetsAsIs are the prefixes of targets that are dialed as they are:
+// Unix domain sockets, abstract Unix sockets, Windows named pipes, and xDS.
+var targetsAsIs = []string{"unix:", "unix-abstract:", "npipe://", "xds:///"}
+
+// ParseTarget parses the address of a server, as given to grpcurl. It may be
+// one of the following:
+//   - A "host:port" address, which is returned as is. The host may be a
+//     bracketed IPv6 literal, like "[::1]:50051", whose port is optional.
+//     The literal may include a zone, like "[fe80::1%eth0]:50051", in which
+//     case the '%' may also be escaped as "%25", as in URLs (RFC 6874).
+//   - An "http" or "https" URL, like "https://api.example.com/prefix", which
+//     is dialed at its host and port. The port defaults to 80 or 443,
+//     respectively, and TLS is used for "https". The path is returned, so
+//     the caller may use it as a prefix of the RPCs' paths.
+//   - A target for a Unix domain socket ("unix:" or "unix-abstract:"), a
+//     Windows named pipe ("npipe://"), or xDS ("xds:///"), which is returned
+//     as is.
+//   - A target with any other scheme, like "dns:///api.example.com:443",
+//     which is returned as is, for the gRPC resolver of that scheme.
+//
+// It returns an error only for a malformed bracketed IPv6 literal.
+func ParseTarget(target string) (*Target, error) {
+	for _, prefix := range targetsAsIs {
+		if strings.HasPrefix(target, prefix) {
+			return &Target{Address: target, Host: target}, nil
+		}
+	}
+
+	// A bracketed IPv6 literal, possibly with a zone, is a host:port
+	if strings.HasPrefix(target, "[") {
+		return parseIPv6Target(target)
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Scheme == "" {
+		// not a URL, so it is a host:port
+		return &Target{Address: target, Host: target}, nil
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		if parsed.Host == "" && parsed.Path == "" && parsed.RawQuery == "" && parsed.Fragment == "" {
+			// a host:port whose host was parsed as the scheme
+			return &Target{Address: target, Host: target}, nil
+		}
+		// an unknown scheme, which is left to gRPC
+		return &Target{Address: target, Scheme: parsed.Scheme, Host: target}, nil
+	}
+
+	host, port := parsed.Hostname(), parsed.Port()
+	if port == "" {
+		if parsed.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	return &Target{
+		Address: net.JoinHostPort(escapeZone(host), port),
+		Scheme:  parsed.Scheme,
+		Host:    host,
+		Port:    port,
+		Path:    parsed.Path,
+		UseTLS:  parsed.Scheme == "https",
+		IsURL:   true,
+	}, nil
+}
+
+// parseIPv6Target parses a target of the form "[host]:port" or "[host]", where
+// host is an IPv6 literal. The host may include a zone, like "fe80::1%eth0".
+// As in URLs (RFC 6874), the '%' that introduces the zone may be escaped as
+// "%25". The resulting address always uses the escaped form, since grpc-go
+// parses addresses as URLs.
+func parseIPv6Target(target string) (*Target, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		if !strings.HasSuffix(target, "]") {
+			return nil, err
+		}
+		// no port
+		host, port = target[1:len(target)-1], ""
+	}
+	if pos := strings.Index(host, "%25"); pos >= 0 {
+		host = host[:pos] + "%" + host[pos+3:]
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !addr.Is6() {
+		return nil, fmt.Errorf("invalid IPv6 address %q", host)
+	}
+	address := "[" + escapeZone(host) + "]"
+	if port != "" {
+		address = net.JoinHostPort(escapeZone(host), port)
+	}
+	return &Target{Address: address, Host: host, Port: port}, nil
+}
+
+// escapeZone escapes the '%' that introduces the zone in an IPv6 literal, if
+// present, so that it can be used in a URL.
+func escapeZone(host string) string {
+	return strings.Replace(host, "%", "%25", 1)
+}
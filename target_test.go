@@ -0,0 +1,75 @@
+package grpcurl_test
+
+import (
+	"testing"
+
+	. "github.com/fullstorydev/grpcurl"
+)
+
+func TestParseTarget(t *testing.T) {
+	testCases := []struct {
+		target  string
+		address string
+		scheme  string
+		host    string
+		port    string
+		path    string
+		useTLS  bool
+		isURL   bool
+	}{
+		{target: "localhost:8080", address: "localhost:8080", host: "localhost:8080"},
+		{target: "localhost", address: "localhost", host: "localhost"},
+		{target: "unix:///tmp/sock", address: "unix:///tmp/sock", host: "unix:///tmp/sock"},
+		{target: "unix:sock", address: "unix:sock", host: "unix:sock"},
+		{target: "unix-abstract:name", address: "unix-abstract:name", host: "unix-abstract:name"},
+		{target: "npipe:////./pipe/name", address: "npipe:////./pipe/name", host: "npipe:////./pipe/name"},
+		{target: "xds:///api.example.com", address: "xds:///api.example.com", host: "xds:///api.example.com"},
+		// other schemes are left to gRPC
+		{target: "dns:///example.com:443", address: "dns:///example.com:443", scheme: "dns", host: "dns:///example.com:443"},
+		{target: "http://example.com", address: "example.com:80", scheme: "http", host: "example.com", port: "80", isURL: true},
+		{target: "https://example.com", address: "example.com:443", scheme: "https", host: "example.com", port: "443", useTLS: true, isURL: true},
+		{target: "https://example.com:8443/api", address: "example.com:8443", scheme: "https", host: "example.com", port: "8443", path: "/api", useTLS: true, isURL: true},
+		// IPv6 literals in host:port form
+		{target: "[::1]:50051", address: "[::1]:50051", host: "::1", port: "50051"},
+		{target: "[::1]", address: "[::1]", host: "::1"},
+		{target: "[fe80::1%eth0]:50051", address: "[fe80::1%25eth0]:50051", host: "fe80::1%eth0", port: "50051"},
+		{target: "[fe80::1%25eth0]:50051", address: "[fe80::1%25eth0]:50051", host: "fe80::1%eth0", port: "50051"},
+		// IPv6 literals in URL form
+		{target: "http://[::1]:50051", address: "[::1]:50051", scheme: "http", host: "::1", port: "50051", isURL: true},
+		{target: "https://[fe80::1%25eth0]", address: "[fe80::1%25eth0]:443", scheme: "https", host: "fe80::1%eth0", port: "443", useTLS: true, isURL: true},
+	}
+	for _, tc := range testCases {
+		pt, err := ParseTarget(tc.target)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.target, err)
+			continue
+		}
+		if pt.Address != tc.address {
+			t.Errorf("%s: wrong address: expected %q, got %q", tc.target, tc.address, pt.Address)
+		}
+		if pt.Scheme != tc.scheme {
+			t.Errorf("%s: wrong scheme: expected %q, got %q", tc.target, tc.scheme, pt.Scheme)
+		}
+		if pt.Host != tc.host {
+			t.Errorf("%s: wrong host: expected %q, got %q", tc.target, tc.host, pt.Host)
+		}
+		if pt.Port != tc.port {
+			t.Errorf("%s: wrong port: expected %q, got %q", tc.target, tc.port, pt.Port)
+		}
+		if pt.Path != tc.path {
+			t.Errorf("%s: wrong path: expected %q, got %q", tc.target, tc.path, pt.Path)
+		}
+		if pt.UseTLS != tc.useTLS {
+			t.Errorf("%s: wrong useTLS: expected %v, got %v", tc.target, tc.useTLS, pt.UseTLS)
+		}
+		if pt.IsURL != tc.isURL {
+			t.Errorf("%s: wrong isURL: expected %v, got %v", tc.target, tc.isURL, pt.IsURL)
+		}
+	}
+
+	for _, target := range []string{"[::1", "[not-an-ip]:80", "[127.0.0.1]:80"} {
+		if _, err := ParseTarget(target); err == nil {
+			t.Errorf("%s: expected error", target)
+		}
+	}
+}